@@ -0,0 +1,215 @@
+//! `dodot completion <shell>` — print a shell completion script.
+//!
+//! The script is generated by `clap_complete` from the same clap tree
+//! `main.rs` parses with, so subcommands and flags never drift from
+//! the real CLI. Before generating, arguments that take repo-specific
+//! words get those words attached as possible values — pack names and
+//! `[groups]` names for pack selectors, gate labels for `--only-os`,
+//! prompt keys for `prompts reset`. The values are a snapshot of the
+//! repo at generation time, which is why the help recommends the
+//! `eval` form: every new shell regenerates.
+//!
+//! File arguments inside a pack — `eject <pack> <file>`, `run <pack>
+//! <script>` — depend on the pack the user just typed, so no snapshot
+//! can hold them. For bash, zsh and fish the script gets a small
+//! wrapper that, in that position, calls the hidden `dodot
+//! complete-files <pack> <prefix>` and offers what it prints; every
+//! other position goes to the generated completion as before.
+//!
+//! Outside a dotfiles repo (or with a config that doesn't load) the
+//! script still generates, just without the dynamic values.
+
+use std::io::Write;
+
+use clap::builder::PossibleValuesParser;
+use clap::{Arg, Command as ClapCommand};
+use clap_complete::Shell;
+use dodot_lib::commands::completion::{self, CompletionValues};
+use dodot_lib::packs::orchestration::ExecutionContext;
+
+/// Generate the completion script for `shell` and write it to stdout.
+pub fn passthrough(shell: Shell) -> Result<(), anyhow::Error> {
+    let values = repo_values().unwrap_or_default();
+    let mut cmd = with_values(crate::build_clap_command(), &values);
+    let stdout = std::io::stdout();
+    let mut out = stdout.lock();
+    clap_complete::generate(shell, &mut cmd, "dodot", &mut out);
+    out.write_all(live_files_script(shell).as_bytes())?;
+    out.flush()?;
+    Ok(())
+}
+
+/// `dodot complete-files <pack> [<prefix>]`: one candidate per line,
+/// nothing at all on any error — a completion must never print one.
+pub fn files_passthrough(pack: &str, prefix: &str) {
+    let root = match crate::handlers::discover_dotfiles_root() {
+        Ok(root) => root,
+        Err(_) => return,
+    };
+    let Ok(ctx) = ExecutionContext::production(&root, false) else {
+        return;
+    };
+    match completion::pack_files(pack, prefix, &ctx) {
+        Ok(files) => {
+            for file in files {
+                println!("{file}");
+            }
+        }
+        Err(e) => tracing::debug!(error = %e, "completion: no pack files"),
+    }
+}
+
+/// Subcommands whose second positional is a file inside the first.
+const PACK_FILE_COMMANDS: &[&str] = &["eject", "run"];
+
+/// Shell code appended to the generated script so pack-file
+/// arguments complete from the live pack. Empty for shells without
+/// one (elvish, PowerShell), which keep plain path completion.
+fn live_files_script(shell: Shell) -> String {
+    let commands = PACK_FILE_COMMANDS.join("|");
+    match shell {
+        Shell::Bash => format!(
+            r#"
+_dodot_live() {{
+    case "${{COMP_WORDS[1]}}" in
+        {commands})
+            if [[ ${{COMP_CWORD}} -eq 3 && "${{COMP_WORDS[3]}}" != [~/]* ]]; then
+                local IFS=$'\n'
+                COMPREPLY=( $(dodot complete-files "${{COMP_WORDS[2]}}" "${{COMP_WORDS[3]}}" 2>/dev/null) )
+                if [[ ${{#COMPREPLY[@]}} -eq 1 && "${{COMPREPLY[0]}}" == */ ]]; then
+                    compopt -o nospace 2>/dev/null
+                fi
+                return 0
+            fi ;;
+    esac
+    _dodot "$@"
+}}
+complete -F _dodot_live -o bashdefault -o default dodot
+"#
+        ),
+        Shell::Zsh => format!(
+            r#"
+_dodot_live() {{
+    if (( CURRENT == 4 )) && [[ "${{words[2]}}" == ({commands}) && "${{words[4]}}" != [~/]* ]]; then
+        local -a files
+        files=(${{(f)"$(dodot complete-files "${{words[3]}}" "${{words[4]}}" 2>/dev/null)"}})
+        compadd -S '' -- ${{(M)files:#*/}}
+        compadd -- ${{files:#*/}}
+        return
+    fi
+    _dodot "$@"
+}}
+compdef _dodot_live dodot
+"#
+        ),
+        Shell::Fish => format!(
+            "\ncomplete -c dodot -n '__fish_seen_subcommand_from {}; and test (count (commandline -opc)) -eq 3' \
+             -f -a '(dodot complete-files (commandline -opc)[3] (commandline -ct) 2>/dev/null)'\n",
+            PACK_FILE_COMMANDS.join(" ")
+        ),
+        _ => String::new(),
+    }
+}
+
+fn repo_values() -> Option<CompletionValues> {
+    let root = crate::handlers::discover_dotfiles_root().ok()?;
+    let ctx = ExecutionContext::production(&root, false).ok()?;
+    match completion::values(&ctx) {
+        Ok(values) => Some(values),
+        Err(e) => {
+            tracing::debug!(error = %e, "completion: no repo values");
+            None
+        }
+    }
+}
+
+/// Attach `values` to the arguments that accept them. Only used for
+/// generation — the command that parses real invocations keeps its
+/// free-form arguments, so globs and not-yet-known packs still work.
+fn with_values(cmd: ClapCommand, values: &CompletionValues) -> ClapCommand {
+    let selectors = values.pack_selectors();
+    let mut cmd = cmd;
+    for sub in ["status", "up", "down", "provision", "disable", "enable"] {
+        cmd = cmd.mut_subcommand(sub, |c| c.mut_arg("packs", |a| possible(a, &selectors)));
+    }
+    for sub in ["fill", "run", "addignore", "pin", "unpin", "eject"] {
+        cmd = cmd.mut_subcommand(sub, |c| c.mut_arg("pack", |a| possible(a, &values.packs)));
+    }
+    cmd.mut_subcommand("adopt", |c| {
+        c.mut_arg("into", |a| possible(a, &values.packs))
+            .mut_arg("only-os", |a| possible(a, &values.gate_labels))
+    })
+    .mut_subcommand("protect", |c| {
+        c.mut_subcommand("add", |c| c.mut_arg("pack", |a| possible(a, &values.packs)))
+            .mut_subcommand("remove", |c| {
+                c.mut_arg("pack", |a| possible(a, &values.packs))
+            })
+    })
+    .mut_subcommand("probe", |c| {
+        c.mut_subcommand("app", |c| c.mut_arg("pack", |a| possible(a, &values.packs)))
+    })
+    .mut_subcommand("prompts", |c| {
+        c.mut_subcommand("reset", |c| {
+            c.mut_arg("key", |a| possible(a, &values.prompt_keys))
+        })
+    })
+}
+
+fn possible(arg: Arg, values: &[String]) -> Arg {
+    if values.is_empty() {
+        return arg;
+    }
+    arg.value_parser(PossibleValuesParser::new(values.iter().cloned()))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn pack_selectors_become_possible_values() {
+        let values = CompletionValues {
+            packs: vec!["git".into(), "vim".into()],
+            groups: vec!["dev".into()],
+            gate_labels: vec!["darwin".into()],
+            prompt_keys: vec!["magic.install_ladder".into()],
+        };
+        let cmd = with_values(crate::build_clap_command(), &values);
+
+        let up = cmd.find_subcommand("up").unwrap();
+        let packs = up.get_arguments().find(|a| a.get_id() == "packs").unwrap();
+        let names: Vec<String> = packs
+            .get_possible_values()
+            .iter()
+            .map(|v| v.get_name().to_string())
+            .collect();
+        assert_eq!(names, ["dev", "git", "vim"]);
+
+        let mut out = Vec::new();
+        let mut cmd = cmd;
+        clap_complete::generate(Shell::Zsh, &mut cmd, "dodot", &mut out);
+        let script = String::from_utf8(out).unwrap();
+        assert!(script.contains("magic.install_ladder"));
+    }
+
+    #[test]
+    fn live_file_completion_covers_pack_file_commands() {
+        for shell in [Shell::Bash, Shell::Zsh, Shell::Fish] {
+            let script = live_files_script(shell);
+            assert!(script.contains("dodot complete-files"), "{shell}");
+            assert!(
+                script.contains("eject") && script.contains("run"),
+                "{shell}"
+            );
+        }
+        assert!(live_files_script(Shell::Elvish).is_empty());
+    }
+
+    #[test]
+    fn empty_values_leave_arguments_free_form() {
+        let cmd = with_values(crate::build_clap_command(), &CompletionValues::default());
+        let up = cmd.find_subcommand("up").unwrap();
+        let packs = up.get_arguments().find(|a| a.get_id() == "packs").unwrap();
+        assert!(packs.get_possible_values().is_empty());
+    }
+}
@@ -9,14 +9,19 @@ use std::sync::atomic::{AtomicI32, Ordering};
 
 use standout::cli::{CommandContext, HandlerResult, Output};
 
-use dodot_lib::commands::{self, GroupMode, ViewMode};
+use dodot_lib::commands::{self, GroupMode, RenderVerbosity, ViewMode};
 use dodot_lib::packs::orchestration::ExecutionContext;
 
+use crate::interactive::Confirmation;
+
 /// Side-channel exit code set by handlers that succeeded in producing
 /// output but want the process to exit non-zero (e.g.
-/// `dodot transform check` when it found divergence). `main.rs` reads
-/// this after the dispatch loop and calls `std::process::exit` if it's
-/// non-zero. Default 0 — handlers that don't set it have no effect.
+/// `dodot transform check` when it found divergence, `dodot up` when
+/// some operations failed). `main.rs` reads this after the dispatch
+/// loop and calls `std::process::exit` if it's non-zero. Default 0 —
+/// handlers that don't set it have no effect. A failed handler leaves
+/// its error's code here too (see [`Explained`]), since standout hands
+/// `main.rs` only the message.
 ///
 /// Why a side-channel: standout's `Output` enum only carries
 /// Render/Silent/Binary; there's no exit-code variant. Returning `Err`
@@ -50,14 +55,22 @@ fn verbose_from(matches: &clap::ArgMatches) -> bool {
 /// to false for flags not defined on the current subcommand.
 fn build_ctx(matches: &clap::ArgMatches) -> Result<ExecutionContext, anyhow::Error> {
     let dotfiles_root = discover_dotfiles_root()?;
-    let mut ctx = ExecutionContext::production(&dotfiles_root, verbose_from(matches))?;
+    let mut ctx =
+        ExecutionContext::production(&dotfiles_root, verbose_from(matches)).explained()?;
 
     ctx.dry_run = flag_or_false(matches, "dry-run");
     ctx.no_provision = flag_or_false(matches, "no-provision");
     ctx.provision_rerun = flag_or_false(matches, "provision-rerun");
     ctx.force = flag_or_false(matches, "force");
+    ctx.lint = dodot_lib::shell::LintOptions {
+        enabled: flag_or_false(matches, "lint"),
+        strict: flag_or_false(matches, "strict"),
+    };
+    ctx.template_vars = template_vars_from(matches)?;
+    ctx.file_filter = file_filter_from(matches)?;
     ctx.view_mode = view_mode_from(matches);
     ctx.group_mode = group_mode_from(matches);
+    ctx.render_verbosity = render_verbosity_from(matches);
 
     Ok(ctx)
 }
@@ -65,20 +78,87 @@ fn build_ctx(matches: &clap::ArgMatches) -> Result<ExecutionContext, anyhow::Err
 /// Build a read-only context (no dry-run/provision flags).
 fn build_readonly_ctx(matches: &clap::ArgMatches) -> Result<ExecutionContext, anyhow::Error> {
     let dotfiles_root = discover_dotfiles_root()?;
-    let mut ctx = ExecutionContext::production(&dotfiles_root, verbose_from(matches))?;
+    let mut ctx =
+        ExecutionContext::production(&dotfiles_root, verbose_from(matches)).explained()?;
     ctx.view_mode = view_mode_from(matches);
     ctx.group_mode = group_mode_from(matches);
+    ctx.render_verbosity = render_verbosity_from(matches);
     Ok(ctx)
 }
 
+/// One-shot template variables: `--vars-file` (`-` reads it from
+/// stdin), then each `--var`. Empty for commands without the flags.
+fn template_vars_from(
+    matches: &clap::ArgMatches,
+) -> Result<std::collections::BTreeMap<String, String>, anyhow::Error> {
+    use dodot_lib::preprocessing::template::invocation;
+    use std::io::Read;
+
+    let pairs: Vec<String> = matches
+        .try_get_many::<String>("var")
+        .ok()
+        .flatten()
+        .map(|values| values.cloned().collect())
+        .unwrap_or_default();
+    let file = match matches.try_get_one::<String>("vars-file").ok().flatten() {
+        Some(path) if path == "-" => {
+            let mut text = String::new();
+            std::io::stdin().lock().read_to_string(&mut text)?;
+            Some(("stdin".to_string(), text))
+        }
+        Some(path) => {
+            let text = std::fs::read_to_string(path)
+                .map_err(|e| anyhow::anyhow!("--vars-file {path}: {e}"))?;
+            Some((path.clone(), text))
+        }
+        None => None,
+    };
+    let file = file
+        .as_ref()
+        .map(|(source, text)| (source.as_str(), text.as_str()));
+    invocation::invocation_vars(&pairs, file).explained()
+}
+
+/// `--only` / `--skip`. Lets everything through for commands without
+/// the flags.
+fn file_filter_from(
+    matches: &clap::ArgMatches,
+) -> Result<dodot_lib::rules::FileFilter, anyhow::Error> {
+    let globs = |id: &str| -> Vec<String> {
+        matches
+            .try_get_many::<String>(id)
+            .ok()
+            .flatten()
+            .map(|values| values.cloned().collect())
+            .unwrap_or_default()
+    };
+    dodot_lib::rules::FileFilter::new(&globs("only"), &globs("skip")).explained()
+}
+
 fn view_mode_from(matches: &clap::ArgMatches) -> ViewMode {
-    if flag_or_false(matches, "short") {
+    let view = matches.try_get_one::<String>("view").ok().flatten();
+    if let Some(mode) = view.and_then(|v| ViewMode::parse(v)) {
+        mode
+    } else if flag_or_false(matches, "short") {
         ViewMode::Short
     } else {
         ViewMode::Full
     }
 }
 
+/// `--quiet` trims pack-status output to errors and a summary line;
+/// `--verbose` / `--debug` add per-file actions, skipped rows and
+/// timings. clap rejects `--quiet` combined with either.
+fn render_verbosity_from(matches: &clap::ArgMatches) -> RenderVerbosity {
+    if flag_or_false(matches, "quiet") {
+        RenderVerbosity::Quiet
+    } else if verbose_from(matches) {
+        RenderVerbosity::Verbose
+    } else {
+        RenderVerbosity::Normal
+    }
+}
+
 fn group_mode_from(matches: &clap::ArgMatches) -> GroupMode {
     if flag_or_false(matches, "by-status") {
         GroupMode::Status
@@ -87,6 +167,23 @@ fn group_mode_from(matches: &clap::ArgMatches) -> GroupMode {
     }
 }
 
+/// Lib errors rendered with their catalog code and "What to do next"
+/// steps (see `dodot_lib::error::catalog`). Handlers call
+/// `.explained()?` on lib results instead of a bare `?`, which would
+/// keep only the one-line message.
+trait Explained<T> {
+    fn explained(self) -> Result<T, anyhow::Error>;
+}
+
+impl<T> Explained<T> for dodot_lib::Result<T> {
+    fn explained(self) -> Result<T, anyhow::Error> {
+        self.map_err(|e| {
+            PENDING_EXIT_CODE.store(e.exit_code().code(), Ordering::Relaxed);
+            anyhow::anyhow!(e.with_remediation())
+        })
+    }
+}
+
 /// Extract pack filter from positional "packs" argument.
 fn pack_filter(matches: &clap::ArgMatches) -> Option<Vec<String>> {
     matches
@@ -95,7 +192,7 @@ fn pack_filter(matches: &clap::ArgMatches) -> Option<Vec<String>> {
 }
 
 /// Discover the dotfiles root directory.
-fn discover_dotfiles_root() -> Result<PathBuf, anyhow::Error> {
+pub(crate) fn discover_dotfiles_root() -> Result<PathBuf, anyhow::Error> {
     // DOTFILES_ROOT env var
     if let Ok(root) = std::env::var("DOTFILES_ROOT") {
         let path = PathBuf::from(root);
@@ -122,6 +219,35 @@ fn discover_dotfiles_root() -> Result<PathBuf, anyhow::Error> {
     Ok(cwd)
 }
 
+/// Render a pack-status result, fitted to the terminal when the
+/// output is text (see [`commands::PackStatusResult::fit_to_width`]).
+fn render_packs(
+    mut result: commands::PackStatusResult,
+) -> HandlerResult<commands::PackStatusResult> {
+    if let Some(width) = dodot_lib::render::layout::output_width() {
+        result.fit_to_width(width);
+    }
+    Ok(Output::Render(result))
+}
+
+/// Render the dry-run `preview` of a destructive command the user
+/// didn't confirm. Declining at the prompt is a normal outcome; a
+/// non-TTY stdin without `--yes` exits with the usage code so a script
+/// notices it did nothing.
+fn render_cancelled(
+    mut preview: commands::PackStatusResult,
+    answer: Confirmation,
+    nothing_done: &str,
+) -> HandlerResult<commands::PackStatusResult> {
+    preview.message = Some(if answer == Confirmation::NoTerminal {
+        PENDING_EXIT_CODE.store(dodot_lib::ExitCode::Usage.code(), Ordering::Relaxed);
+        format!("Cancelled — {nothing_done}: stdin is not a terminal; pass --yes to confirm.")
+    } else {
+        format!("Cancelled — {nothing_done}.")
+    });
+    render_packs(preview)
+}
+
 // ── Command handlers ────────────────────────────────────────────
 
 pub fn status_handler(
@@ -132,9 +258,100 @@ pub fn status_handler(
     ctx.check_drift = matches.get_flag("check-drift");
     ctx.show_diff = matches.get_flag("diff");
     let filter = pack_filter(matches);
-    let result = commands::status::status(filter.as_deref(), &ctx)?;
+    let result = commands::status::status(filter.as_deref(), &ctx).explained()?;
+    let summary = commands::status::StatusSummary::from_result(&result);
+    if matches.get_flag("check") {
+        PENDING_EXIT_CODE.store(summary.outcome().exit_code(), Ordering::Relaxed);
+    }
+    // `--summary` is meant for prompts and login scripts: one line on
+    // stdout, no warnings on stderr.
+    if matches.get_flag("summary") {
+        println!("{}", summary.line());
+        return Ok(Output::Silent);
+    }
     print_warnings(&result.warnings);
-    Ok(Output::Render(result))
+    render_packs(result)
+}
+
+/// `dodot status --watch` — re-run status every `secs` seconds until
+/// interrupted. Text output redraws the screen with the rows that
+/// changed at the last transition on top; structured output (JSON)
+/// prints a new report only when something changed. Errors (a pack
+/// config mid-edit, say) are shown in place of the report and the
+/// watch carries on.
+pub fn status_watch(
+    matches: &clap::ArgMatches,
+    secs: u64,
+    mode: standout::OutputMode,
+) -> Result<(), anyhow::Error> {
+    use dodot_lib::commands::probe::format_unix_ts;
+    use standout::OutputMode;
+
+    let redraw = matches!(
+        mode,
+        OutputMode::Auto | OutputMode::Term | OutputMode::Text | OutputMode::TermDebug
+    );
+    let filter = pack_filter(matches);
+    let mut previous: Option<commands::PackStatusResult> = None;
+    let mut changes: Vec<String> = Vec::new();
+    let mut changed_at = String::new();
+    loop {
+        // Rebuilt every round so edits to the root config show up too.
+        let status = build_readonly_ctx(matches).and_then(|mut ctx| {
+            ctx.check_drift = matches.get_flag("check-drift");
+            ctx.show_diff = matches.get_flag("diff");
+            commands::status::status(filter.as_deref(), &ctx).explained()
+        });
+        let body = match status {
+            Ok(mut result) => {
+                let changed = previous
+                    .as_ref()
+                    .map(|before| commands::status::transitions(before, &result));
+                let fresh = changed.as_ref().map_or(true, |c| !c.is_empty());
+                if let Some(changed) = changed.filter(|c| !c.is_empty()) {
+                    changes = changed;
+                    changed_at = format_unix_ts(unix_now());
+                }
+                previous = Some(result.clone());
+                if let Some(width) = dodot_lib::render::layout::output_width() {
+                    result.fit_to_width(width);
+                }
+                (redraw || fresh)
+                    .then(|| dodot_lib::render::render("pack-status", &result, mode))
+                    .transpose()
+                    .map_err(|e| anyhow::anyhow!("render: {e}"))?
+            }
+            Err(e) if redraw => Some(format!("error: {e}")),
+            Err(e) => {
+                eprintln!("error: {e}");
+                None
+            }
+        };
+
+        if let Some(body) = body {
+            if redraw {
+                // Clear the screen and home the cursor.
+                print!("\x1b[2J\x1b[H");
+                println!("dodot status — every {secs}s, Ctrl-C to stop\n");
+                if !changes.is_empty() {
+                    println!("Changed at {changed_at} UTC:");
+                    for line in &changes {
+                        println!("  {line}");
+                    }
+                    println!();
+                }
+            }
+            println!("{body}");
+        }
+        std::thread::sleep(std::time::Duration::from_secs(secs));
+    }
+}
+
+fn unix_now() -> u64 {
+    std::time::SystemTime::now()
+        .duration_since(std::time::UNIX_EPOCH)
+        .map(|d| d.as_secs())
+        .unwrap_or(0)
 }
 
 pub fn up_handler(
@@ -143,37 +360,277 @@ pub fn up_handler(
 ) -> HandlerResult<commands::PackStatusResult> {
     let ctx = build_ctx(matches)?;
     let filter = pack_filter(matches);
+    if !ctx.dry_run {
+        fill_missing_template_vars(filter.as_deref(), flag_or_false(matches, "no-input"), &ctx)?;
+    }
     // Use the status-fallback variant so cross-pack conflicts still
     // render the full per-pack listing instead of a bare conflicts dump
     // — `up` and `status` output stay consistent.
-    let result = commands::up::up_or_status_for_conflict(filter.as_deref(), &ctx)?;
+    let result = commands::up::up_or_status_for_conflict(filter.as_deref(), &ctx).explained()?;
+    PENDING_EXIT_CODE.store(result.exit_code.code(), Ordering::Relaxed);
+    print_warnings(&result.warnings);
+    render_packs(result)
+}
+
+/// Ask for every template variable nothing defines, all at once,
+/// before `up` renders anything; the answers go to the host vars file.
+/// `--no-input`, or a stdin that isn't a terminal, fails instead with
+/// the list of missing keys.
+fn fill_missing_template_vars(
+    filter: Option<&[String]>,
+    no_input: bool,
+    ctx: &ExecutionContext,
+) -> Result<(), anyhow::Error> {
+    use dodot_lib::commands::template_vars;
+    use std::io::Write;
+
+    let missing = template_vars::missing(filter, ctx).explained()?;
+    if missing.is_empty() {
+        return Ok(());
+    }
+    // Answers are kept in the host vars file; under --no-write-home
+    // there's nowhere to keep them, so don't ask.
+    let cannot_record = ctx.fs.write_refused(&ctx.paths.host_vars_path());
+    if no_input || cannot_record || !crate::interactive::stdin_is_tty() {
+        return Err(anyhow::anyhow!(
+            template_vars::missing_error(&missing).with_remediation()
+        ));
+    }
+
+    let mut stderr = std::io::stderr();
+    writeln!(
+        stderr,
+        "{} template variable(s) have no value on this machine:",
+        missing.len()
+    )?;
+    for var in &missing {
+        writeln!(stderr, "  {}  ({})", var.key, var.templates.join(", "))?;
+    }
+    let mut answers = Vec::new();
+    for var in &missing {
+        let Some(value) = crate::interactive::prompt_value(&var.key)? else {
+            anyhow::bail!("input closed before every variable was answered; nothing was saved");
+        };
+        answers.push((var.key.clone(), value));
+    }
+    let path = template_vars::record(&answers, ctx).explained()?;
+    writeln!(stderr, "Saved to {}.\n", path.display())?;
+    Ok(())
+}
+
+pub fn plan_handler(
+    matches: &clap::ArgMatches,
+    _ctx: &CommandContext,
+) -> HandlerResult<commands::plan::PlanResult> {
+    let ctx = build_ctx(matches)?;
+    let filter = pack_filter(matches);
+    let out = matches
+        .get_one::<String>("out")
+        .map(std::path::absolute)
+        .transpose()?;
+    let result =
+        commands::plan::plan_command(filter.as_deref(), out.as_deref(), &ctx).explained()?;
+    Ok(Output::Render(result))
+}
+
+/// `dodot preview [<pack>...]`.
+pub fn preview_handler(
+    matches: &clap::ArgMatches,
+    _ctx: &CommandContext,
+) -> HandlerResult<commands::preview::PreviewResult> {
+    let ctx = build_readonly_ctx(matches)?;
+    let filter = pack_filter(matches);
+    let result = commands::preview::preview(filter.as_deref(), &ctx).explained()?;
     print_warnings(&result.warnings);
     Ok(Output::Render(result))
 }
 
-pub fn down_handler(
+/// `dodot apply <plan>` — provisioning follows the plan file, not a
+/// flag, so the run can't differ from what was previewed.
+pub fn apply_handler(
+    matches: &clap::ArgMatches,
+    _ctx: &CommandContext,
+) -> HandlerResult<commands::PackStatusResult> {
+    let mut ctx = build_ctx(matches)?;
+    let path = std::path::absolute(matches.get_one::<String>("plan").expect("plan is required"))?;
+    let plan = commands::plan::load(ctx.fs.as_ref(), &path).explained()?;
+    ctx.no_provision = plan.no_provision;
+    let result = commands::plan::apply(&plan, &ctx).explained()?;
+    print_warnings(&result.warnings);
+    render_packs(result)
+}
+
+/// `dodot clone <url> [dir]` — runs before any dotfiles root exists,
+/// so it clones first and only then builds the context, rooted at the
+/// fresh checkout. `DOTFILES_ROOT` is set for the rest of the process
+/// so anything downstream resolves the same root.
+pub fn clone_handler(
     matches: &clap::ArgMatches,
     _ctx: &CommandContext,
 ) -> HandlerResult<commands::PackStatusResult> {
+    use dodot_lib::commands::clone;
+
+    let url = matches.get_one::<String>("url").expect("url is required");
+    let dest = match matches.get_one::<String>("dir") {
+        Some(dir) => std::path::absolute(dir)?,
+        None => {
+            let home = std::env::var("HOME")
+                .map_err(|_| anyhow::anyhow!("HOME is not set; pass a directory to clone into"))?;
+            clone::default_clone_dest(std::path::Path::new(&home))
+        }
+    };
+    let shell_arg = matches.get_one::<String>("shell").map(String::as_str);
+    let shell = commands::git_alias::resolve_shell(shell_arg).explained()?;
+    let verbose = verbose_from(matches);
+
+    // `--dry-run` still clones: there's nothing to plan against
+    // without the checkout. It only spares the rc file and `$HOME`.
+    let fs = dodot_lib::fs::OsFs::new();
+    let runner = dodot_lib::datastore::ShellCommandRunner::new(verbose);
+    clone::clone_repo(url, &dest, &fs, &runner).explained()?;
+    std::env::set_var("DOTFILES_ROOT", &dest);
+
+    let mut ctx = ExecutionContext::production(&dest, verbose).explained()?;
+    ctx.dry_run = flag_or_false(matches, "dry-run");
+    ctx.no_provision = flag_or_false(matches, "no-provision");
+    ctx.view_mode = view_mode_from(matches);
+    ctx.group_mode = group_mode_from(matches);
+    ctx.render_verbosity = render_verbosity_from(matches);
+
+    let filter = matches
+        .get_many::<String>("packs")
+        .map(|vals| vals.cloned().collect::<Vec<_>>());
+    let deploy = !flag_or_false(matches, "no-up");
+    let result = clone::bootstrap(&ctx, shell, filter.as_deref(), deploy).explained()?;
+    print_warnings(&result.warnings);
+    render_packs(result)
+}
+
+pub fn provision_handler(
+    matches: &clap::ArgMatches,
+    _ctx: &CommandContext,
+) -> HandlerResult<commands::MessageResult> {
     let ctx = build_ctx(matches)?;
     let filter = pack_filter(matches);
-    let result = commands::down::down(filter.as_deref(), &ctx)?;
-    print_warnings(&result.warnings);
+    if matches.get_flag("status") {
+        let result = commands::provision::status(filter.as_deref(), &ctx).explained()?;
+        return Ok(Output::Render(result));
+    }
+    let upgrade = matches.get_flag("upgrade");
+    let result = commands::provision::provision(filter.as_deref(), upgrade, &ctx).explained()?;
     Ok(Output::Render(result))
 }
 
+pub fn down_handler(
+    matches: &clap::ArgMatches,
+    _ctx: &CommandContext,
+) -> HandlerResult<commands::PackStatusResult> {
+    let mut ctx = build_ctx(matches)?;
+    let filter = pack_filter(matches);
+    let assume_yes = flag_or_false(matches, "yes");
+    let options = commands::down::DownOptions {
+        deprovision: flag_or_false(matches, "deprovision"),
+    };
+    if !ctx.dry_run && !assume_yes {
+        // Plan the removal as a dry run so the prompt can say what
+        // would go, then run it for real only on an explicit yes.
+        ctx.dry_run = true;
+        let mut preview =
+            commands::down::down_with(filter.as_deref(), options, &ctx).explained()?;
+        ctx.dry_run = false;
+        if preview.packs.iter().any(|p| !p.files.is_empty()) {
+            let summary = down_summary(&preview.packs);
+            let answer =
+                crate::interactive::confirm_destructive(false, &summary, "Remove this state?")?;
+            if answer != Confirmation::Confirmed {
+                return render_cancelled(preview, answer, "nothing was removed");
+            }
+        }
+    }
+    let result = commands::down::down_with(filter.as_deref(), options, &ctx).explained()?;
+    PENDING_EXIT_CODE.store(result.exit_code.code(), Ordering::Relaxed);
+    print_warnings(&result.warnings);
+    render_packs(result)
+}
+
+/// Confirmation summary for `down`, built from its dry-run packs:
+/// how many symlinks go away, which other handler state is cleared,
+/// and whether provisioning is undone (`--deprovision`) or left alone.
+///
+/// The dry run lists one `would run` row per undo command — any handler
+/// can have those (system, autostart, …) — and `would remove` rows for
+/// the state itself, so the two are counted apart.
+fn down_summary(preview: &[commands::DisplayPack]) -> Vec<String> {
+    let packs = preview.iter().filter(|p| !p.files.is_empty()).count();
+    let (uninstalls, removals): (Vec<_>, Vec<_>) = preview
+        .iter()
+        .flat_map(|p| &p.files)
+        .partition(|f| f.status_label == "[dry-run] would run");
+    let uninstalls = uninstalls.len();
+    let symlinks = removals.iter().filter(|f| f.handler == "symlink").count();
+    let provisioned = removals
+        .iter()
+        .filter(|f| matches!(f.handler.as_str(), "install" | "homebrew" | "nix"))
+        .count();
+    let other = removals.len() - symlinks - provisioned;
+
+    let mut lines = vec![format!(
+        "dodot down will remove deployed state for {packs} pack(s):"
+    )];
+    if symlinks > 0 {
+        lines.push(format!("  {symlinks} symlink(s) removed"));
+    }
+    if other > 0 {
+        lines.push(format!(
+            "  {other} shell / path / other handler state(s) cleared"
+        ));
+    }
+    if uninstalls > 0 {
+        lines.push(format!("  {uninstalls} uninstall command(s) run"));
+    } else if provisioned > 0 {
+        lines.push(format!(
+            "  {provisioned} provisioning record(s) forgotten — installed packages are left untouched"
+        ));
+    }
+    lines
+}
+
 fn print_warnings(warnings: &[String]) {
     for w in warnings {
-        eprintln!("{w}");
+        eprintln!("{}", dodot_lib::render::glyphs::plain(w));
     }
 }
 
+/// `dodot changes [<pack>...]`.
+pub fn changes_handler(
+    matches: &clap::ArgMatches,
+    _ctx: &CommandContext,
+) -> HandlerResult<commands::changes::ChangesResult> {
+    let ctx = build_readonly_ctx(matches)?;
+    let filter = pack_filter(matches);
+    Ok(Output::Render(
+        commands::changes::changes(filter.as_deref(), &ctx).explained()?,
+    ))
+}
+
 pub fn list_handler(
     matches: &clap::ArgMatches,
     _ctx: &CommandContext,
 ) -> HandlerResult<commands::list::ListResult> {
     let ctx = build_readonly_ctx(matches)?;
-    let result = commands::list::list(&ctx)?;
+    if !matches.get_flag("files") {
+        return Ok(Output::Render(commands::list::list(&ctx).explained()?));
+    }
+    let query = commands::list::FileQuery {
+        handler: matches.get_one::<String>("handler").cloned(),
+        state: matches.get_one::<String>("state").cloned(),
+        sort: match matches.get_one::<String>("sort").map(String::as_str) {
+            Some("handler") => commands::list::FileSort::Handler,
+            Some("state") => commands::list::FileSort::State,
+            _ => commands::list::FileSort::Status,
+        },
+    };
+    let result = commands::list::list_files(&query, &ctx).explained()?;
     Ok(Output::Render(result))
 }
 
@@ -181,9 +638,24 @@ pub fn init_handler(
     matches: &clap::ArgMatches,
     _ctx: &CommandContext,
 ) -> HandlerResult<commands::init::InitResult> {
+    if let Some(dir) = matches.get_one::<String>("repo") {
+        // Like `clone`, this runs before there is a dotfiles root.
+        let dest = if dir.is_empty() {
+            let home = std::env::var("HOME")
+                .map_err(|_| anyhow::anyhow!("HOME is not set; pass a directory to --repo"))?;
+            commands::clone::default_clone_dest(std::path::Path::new(&home))
+        } else {
+            std::path::absolute(dir)?
+        };
+        let fs = dodot_lib::fs::OsFs::new();
+        let runner = dodot_lib::datastore::ShellCommandRunner::new(verbose_from(matches));
+        let result = commands::init::init_repo(&dest, &fs, &runner).explained()?;
+        return Ok(Output::Render(result));
+    }
     let ctx = build_readonly_ctx(matches)?;
     let pack_name = matches.get_one::<String>("pack").expect("pack is required");
-    let result = commands::init::init(pack_name, &ctx)?;
+    let pack_type = matches.get_one::<String>("type").map(String::as_str);
+    let result = commands::init::init_from(pack_name, pack_type, &ctx).explained()?;
     Ok(Output::Render(result))
 }
 
@@ -193,22 +665,88 @@ pub fn fill_handler(
 ) -> HandlerResult<commands::fill::FillResult> {
     let ctx = build_readonly_ctx(matches)?;
     let pack_name = matches.get_one::<String>("pack").expect("pack is required");
-    let result = commands::fill::fill(pack_name, &ctx)?;
+    let result = commands::fill::fill(pack_name, &ctx).explained()?;
+    Ok(Output::Render(result))
+}
+
+/// `dodot run <pack> <script> [ARGS...]` always streams the script's
+/// output — it's the point of running a maintenance script by hand.
+pub fn run_handler(
+    matches: &clap::ArgMatches,
+    _ctx: &CommandContext,
+) -> HandlerResult<commands::MessageResult> {
+    let mut ctx = build_readonly_ctx(matches)?;
+    ctx.command_runner = std::sync::Arc::new(dodot_lib::datastore::ShellCommandRunner::new(true));
+    ctx.verbose = true;
+    let pack_name = matches.get_one::<String>("pack").expect("pack is required");
+    let script = matches
+        .get_one::<String>("script")
+        .expect("script is required");
+    let args: Vec<String> = matches
+        .get_many::<String>("args")
+        .map(|v| v.cloned().collect())
+        .unwrap_or_default();
+    let result = commands::run::run(pack_name, script, &args, &ctx).explained()?;
     Ok(Output::Render(result))
 }
 
+/// `dodot serve --socket <path>` — runs until the process is stopped.
+/// The repo is reopened per connection with the flags given here, so
+/// `--verbose` on the server applies to every request.
+#[cfg(unix)]
+pub fn serve_handler(
+    matches: &clap::ArgMatches,
+    _ctx: &CommandContext,
+) -> HandlerResult<commands::MessageResult> {
+    let socket = matches
+        .get_one::<PathBuf>("socket")
+        .expect("socket is required");
+    let socket = std::path::absolute(socket)?;
+    let dotfiles_root = discover_dotfiles_root()?;
+    let verbose = verbose_from(matches);
+    eprintln!(
+        "dodot: serving {} on {}",
+        dotfiles_root.display(),
+        socket.display()
+    );
+    dodot_lib::serve::serve(&socket, &|| {
+        ExecutionContext::production(&dotfiles_root, verbose)
+            .map(dodot_lib::api::Dodot::from_context)
+    })
+    .explained()?;
+    Ok(Output::Render(commands::MessageResult {
+        message: "server stopped".into(),
+        details: Vec::new(),
+    }))
+}
+
+#[cfg(not(unix))]
+pub fn serve_handler(
+    _matches: &clap::ArgMatches,
+    _ctx: &CommandContext,
+) -> HandlerResult<commands::MessageResult> {
+    Err(anyhow::anyhow!(
+        "dodot serve needs Unix sockets, which this platform lacks"
+    ))
+}
+
 pub fn adopt_handler(
     matches: &clap::ArgMatches,
     _ctx: &CommandContext,
 ) -> HandlerResult<commands::PackStatusResult> {
     let ctx = build_readonly_ctx(matches)?;
+    if matches.get_flag("undo-last") {
+        let result = commands::adopt::undo_last(&ctx).explained()?;
+        print_warnings(&result.warnings);
+        return render_packs(result);
+    }
     // `--into` is optional. When absent, adopt infers the pack name
     // from each source's deployed path (XDG layout) or requires the
     // user to supply --into (HOME-direct dotfiles).
     let into = matches.get_one::<String>("into");
     let files: Vec<PathBuf> = matches
         .get_many::<String>("files")
-        .expect("files is required")
+        .expect("files is required without --undo-last")
         .map(PathBuf::from)
         .collect();
     let force = matches.get_flag("force");
@@ -216,17 +754,49 @@ pub fn adopt_handler(
     let dry_run = matches.get_flag("dry-run");
     let into_str = into.map(|s| s.as_str());
     let only_os = matches.get_one::<String>("only-os").map(|s| s.as_str());
-    let result = commands::adopt::adopt(into_str, &files, force, no_follow, dry_run, only_os, &ctx)
-        .map_err(|e| {
-            if matches!(e, dodot_lib::DodotError::PackNotFound { .. }) {
-                let hint_pack = into_str.unwrap_or("<pack>");
-                anyhow::anyhow!("{e}\n  Hint: run 'dodot init {hint_pack}' first to create it")
-            } else {
-                e.into()
-            }
-        })?;
+    let adopt = |dry_run: bool| {
+        commands::adopt::adopt(into_str, &files, force, no_follow, dry_run, only_os, &ctx).map_err(
+            |e| {
+                if matches!(e, dodot_lib::DodotError::PackNotFound { .. }) {
+                    let hint_pack = into_str.unwrap_or("<pack>");
+                    anyhow::anyhow!("{e}\n  Hint: run 'dodot init {hint_pack}' first to create it")
+                } else {
+                    anyhow::anyhow!(e.with_remediation())
+                }
+            },
+        )
+    };
+    if force && !dry_run {
+        let summary = vec![format!(
+            "--force: adopting {} file(s) overwrites anything already at their destination in the pack.",
+            files.len()
+        )];
+        let answer = crate::interactive::confirm_destructive(
+            matches.get_flag("yes"),
+            &summary,
+            "Overwrite?",
+        )?;
+        if answer != Confirmation::Confirmed {
+            return render_cancelled(adopt(true)?, answer, "nothing was adopted");
+        }
+    }
+    let result = adopt(dry_run)?;
     print_warnings(&result.warnings);
-    Ok(Output::Render(result))
+    render_packs(result)
+}
+
+/// `dodot eject <pack> <file>` — the reverse of `adopt`.
+pub fn eject_handler(
+    matches: &clap::ArgMatches,
+    _ctx: &CommandContext,
+) -> HandlerResult<commands::MessageResult> {
+    let ctx = build_ctx(matches)?;
+    let pack_name = matches.get_one::<String>("pack").expect("pack is required");
+    let file = matches.get_one::<String>("file").expect("file is required");
+    let keep = flag_or_false(matches, "keep");
+    Ok(Output::Render(
+        commands::eject::eject(pack_name, file, keep, &ctx).explained()?,
+    ))
 }
 
 pub fn addignore_handler(
@@ -235,17 +805,104 @@ pub fn addignore_handler(
 ) -> HandlerResult<commands::addignore::AddIgnoreResult> {
     let ctx = build_readonly_ctx(matches)?;
     let pack_name = matches.get_one::<String>("pack").expect("pack is required");
-    let result = commands::addignore::addignore(pack_name, &ctx)?;
+    let result = commands::addignore::addignore(pack_name, &ctx).explained()?;
+    Ok(Output::Render(result))
+}
+
+/// `dodot pin [<pack>]` — pin a pack, or list the pins.
+pub fn pin_handler(
+    matches: &clap::ArgMatches,
+    _ctx: &CommandContext,
+) -> HandlerResult<commands::pin::PinListResult> {
+    let result = match matches.get_one::<String>("pack") {
+        Some(pack_name) => {
+            let ctx = build_ctx(matches)?;
+            let reason = matches.get_one::<String>("reason").map(String::as_str);
+            commands::pin::pin(pack_name, reason, &ctx).explained()?
+        }
+        None => commands::pin::list(&build_readonly_ctx(matches)?).explained()?,
+    };
     Ok(Output::Render(result))
 }
 
+/// `dodot unpin <pack>`.
+pub fn unpin_handler(
+    matches: &clap::ArgMatches,
+    _ctx: &CommandContext,
+) -> HandlerResult<commands::MessageResult> {
+    let ctx = build_ctx(matches)?;
+    let pack_name = matches.get_one::<String>("pack").expect("pack is required");
+    Ok(Output::Render(
+        commands::pin::unpin(pack_name, &ctx).explained()?,
+    ))
+}
+
+/// `dodot disable [<pack>...]` — disable packs, or list the disabled.
+pub fn disable_handler(
+    matches: &clap::ArgMatches,
+    _ctx: &CommandContext,
+) -> HandlerResult<commands::MessageResult> {
+    let result = match pack_filter(matches) {
+        Some(packs) => commands::disable::disable(&packs, &build_ctx(matches)?).explained()?,
+        None => commands::disable::list(&build_readonly_ctx(matches)?).explained()?,
+    };
+    Ok(Output::Render(result))
+}
+
+/// `dodot enable <pack>...`.
+pub fn enable_handler(
+    matches: &clap::ArgMatches,
+    _ctx: &CommandContext,
+) -> HandlerResult<commands::MessageResult> {
+    let ctx = build_ctx(matches)?;
+    let packs = pack_filter(matches).expect("packs are required");
+    Ok(Output::Render(
+        commands::disable::enable(&packs, &ctx).explained()?,
+    ))
+}
+
+/// `dodot protect list`.
+pub fn protect_list_handler(
+    matches: &clap::ArgMatches,
+    _ctx: &CommandContext,
+) -> HandlerResult<commands::protect::ProtectListResult> {
+    let ctx = build_readonly_ctx(matches)?;
+    Ok(Output::Render(commands::protect::list(&ctx).explained()?))
+}
+
+/// `dodot protect add <path> [--pack PACK]`.
+pub fn protect_add_handler(
+    matches: &clap::ArgMatches,
+    _ctx: &CommandContext,
+) -> HandlerResult<commands::MessageResult> {
+    let ctx = build_ctx(matches)?;
+    let path = matches.get_one::<String>("path").expect("path is required");
+    let pack = matches.get_one::<String>("pack").map(String::as_str);
+    Ok(Output::Render(
+        commands::protect::add(path, pack, &ctx).explained()?,
+    ))
+}
+
+/// `dodot protect remove <path> [--pack PACK]`.
+pub fn protect_remove_handler(
+    matches: &clap::ArgMatches,
+    _ctx: &CommandContext,
+) -> HandlerResult<commands::MessageResult> {
+    let ctx = build_ctx(matches)?;
+    let path = matches.get_one::<String>("path").expect("path is required");
+    let pack = matches.get_one::<String>("pack").map(String::as_str);
+    Ok(Output::Render(
+        commands::protect::remove(path, pack, &ctx).explained()?,
+    ))
+}
+
 /// `dodot probe` — bare summary of probe subcommands.
 pub fn probe_summary_handler(
     matches: &clap::ArgMatches,
     _ctx: &CommandContext,
 ) -> HandlerResult<commands::probe::ProbeResult> {
     let ctx = build_readonly_ctx(matches)?;
-    Ok(Output::Render(commands::probe::summary(&ctx)?))
+    Ok(Output::Render(commands::probe::summary(&ctx).explained()?))
 }
 
 /// `dodot probe deployment-map` — source↔deployed map view.
@@ -254,7 +911,9 @@ pub fn probe_deployment_map_handler(
     _ctx: &CommandContext,
 ) -> HandlerResult<commands::probe::ProbeResult> {
     let ctx = build_readonly_ctx(matches)?;
-    Ok(Output::Render(commands::probe::deployment_map(&ctx)?))
+    Ok(Output::Render(
+        commands::probe::deployment_map(&ctx).explained()?,
+    ))
 }
 
 /// `dodot probe show-data-dir [--depth N]` — data-dir tree view.
@@ -267,7 +926,9 @@ pub fn probe_show_data_dir_handler(
         .get_one::<usize>("depth")
         .copied()
         .unwrap_or(commands::probe::DEFAULT_SHOW_DATA_DIR_DEPTH);
-    Ok(Output::Render(commands::probe::show_data_dir(&ctx, depth)?))
+    Ok(Output::Render(
+        commands::probe::show_data_dir(&ctx, depth).explained()?,
+    ))
 }
 
 /// `dodot probe app <pack> [--refresh]` — advisory introspection of
@@ -283,7 +944,9 @@ pub fn probe_app_handler(
         .cloned()
         .ok_or_else(|| anyhow::anyhow!("missing required argument: pack"))?;
     let refresh = flag_or_false(matches, "refresh");
-    Ok(Output::Render(commands::probe::app(&pack, refresh, &ctx)?))
+    Ok(Output::Render(
+        commands::probe::app(&pack, refresh, &ctx).explained()?,
+    ))
 }
 
 /// `dodot transform check [--strict]` — propagate deployed-file edits
@@ -301,11 +964,72 @@ pub fn transform_check_handler(
 ) -> HandlerResult<commands::transform::TransformCheckResult> {
     let ctx = build_ctx(matches)?;
     let strict = flag_or_false(matches, "strict");
-    let result = commands::transform::check(&ctx, strict)?;
+    let result = commands::transform::check(&ctx, strict).explained()?;
+    PENDING_EXIT_CODE.store(result.exit_code(), Ordering::Relaxed);
+    Ok(Output::Render(result))
+}
+
+/// `dodot template check [packs...]` — syntax errors, missing
+/// variables and the variable inventory of every template. Read-only;
+/// exits 1 when a template is broken or misses a variable.
+pub fn template_check_handler(
+    matches: &clap::ArgMatches,
+    _ctx: &CommandContext,
+) -> HandlerResult<commands::template_check::TemplateCheckResult> {
+    let mut ctx = build_readonly_ctx(matches)?;
+    ctx.template_vars = template_vars_from(matches)?;
+    let filter = pack_filter(matches);
+    let result = commands::template_check::check(filter.as_deref(), &ctx).explained()?;
     PENDING_EXIT_CODE.store(result.exit_code(), Ordering::Relaxed);
     Ok(Output::Render(result))
 }
 
+/// `dodot doctor [--shell]` — the checks the init script makes at
+/// shell start, all of them listed. Read-only; exits 2 on a problem.
+pub fn doctor_handler(
+    matches: &clap::ArgMatches,
+    _ctx: &CommandContext,
+) -> HandlerResult<commands::doctor::DoctorResult> {
+    let ctx = build_readonly_ctx(matches)?;
+    let result = commands::doctor::shell(&ctx).explained()?;
+    PENDING_EXIT_CODE.store(result.exit_code(), Ordering::Relaxed);
+    Ok(Output::Render(result))
+}
+
+/// `dodot trash list` — files `--force` moved aside. Read-only.
+pub fn trash_list_handler(
+    matches: &clap::ArgMatches,
+    _ctx: &CommandContext,
+) -> HandlerResult<commands::trash::TrashListResult> {
+    let ctx = build_readonly_ctx(matches)?;
+    Ok(Output::Render(commands::trash::list(&ctx).explained()?))
+}
+
+/// `dodot trash restore <id>` — put a trashed file back.
+pub fn trash_restore_handler(
+    matches: &clap::ArgMatches,
+    _ctx: &CommandContext,
+) -> HandlerResult<commands::MessageResult> {
+    let ctx = build_ctx(matches)?;
+    let id = matches.get_one::<String>("id").expect("id is required");
+    Ok(Output::Render(
+        commands::trash::restore(id, &ctx).explained()?,
+    ))
+}
+
+/// `dodot trash prune` — drop old and duplicate entries and
+/// unreferenced stored files.
+pub fn trash_prune_handler(
+    matches: &clap::ArgMatches,
+    _ctx: &CommandContext,
+) -> HandlerResult<commands::MessageResult> {
+    let ctx = build_ctx(matches)?;
+    let older_than = matches.get_one::<u64>("older-than").copied();
+    Ok(Output::Render(
+        commands::trash::prune(older_than, &ctx).explained()?,
+    ))
+}
+
 /// `dodot transform status` — read-only view of every cached
 /// preprocessed file with its current state. Always exits 0.
 pub fn transform_status_handler(
@@ -313,7 +1037,9 @@ pub fn transform_status_handler(
     _ctx: &CommandContext,
 ) -> HandlerResult<commands::transform::TransformStatusResult> {
     let ctx = build_readonly_ctx(matches)?;
-    Ok(Output::Render(commands::transform::status(&ctx)?))
+    Ok(Output::Render(
+        commands::transform::status(&ctx).explained()?,
+    ))
 }
 
 /// `dodot secret probe` — read-only view of every configured
@@ -325,7 +1051,7 @@ pub fn secret_probe_handler(
     _ctx: &CommandContext,
 ) -> HandlerResult<commands::secret::ProbeResult> {
     let ctx = build_readonly_ctx(matches)?;
-    Ok(Output::Render(commands::secret::probe(&ctx)?))
+    Ok(Output::Render(commands::secret::probe(&ctx).explained()?))
 }
 
 /// `dodot secret list` — read-only enumeration of every
@@ -336,7 +1062,7 @@ pub fn secret_list_handler(
     _ctx: &CommandContext,
 ) -> HandlerResult<commands::secret::ListResult> {
     let ctx = build_readonly_ctx(matches)?;
-    Ok(Output::Render(commands::secret::list(&ctx)?))
+    Ok(Output::Render(commands::secret::list(&ctx).explained()?))
 }
 
 /// `dodot git-show-alias [--shell <shell>]` — print the Tier 2
@@ -347,10 +1073,10 @@ pub fn git_show_alias_handler(
 ) -> HandlerResult<commands::git_alias::ShowAliasResult> {
     let ctx = build_readonly_ctx(matches)?;
     let shell_arg = matches.get_one::<String>("shell").map(String::as_str);
-    let shell = commands::git_alias::resolve_shell(shell_arg)?;
-    Ok(Output::Render(commands::git_alias::show_alias(
-        &ctx, shell,
-    )?))
+    let shell = commands::git_alias::resolve_shell(shell_arg).explained()?;
+    Ok(Output::Render(
+        commands::git_alias::show_alias(&ctx, shell).explained()?,
+    ))
 }
 
 /// `dodot git-install-alias [--shell <shell>]` — write the Tier 2
@@ -361,10 +1087,10 @@ pub fn git_install_alias_handler(
 ) -> HandlerResult<commands::git_alias::InstallAliasResult> {
     let ctx = build_ctx(matches)?;
     let shell_arg = matches.get_one::<String>("shell").map(String::as_str);
-    let shell = commands::git_alias::resolve_shell(shell_arg)?;
-    Ok(Output::Render(commands::git_alias::install_alias(
-        &ctx, shell,
-    )?))
+    let shell = commands::git_alias::resolve_shell(shell_arg).explained()?;
+    Ok(Output::Render(
+        commands::git_alias::install_alias(&ctx, shell).explained()?,
+    ))
 }
 
 /// `dodot template clean --path <path>` — git clean filter
@@ -431,7 +1157,7 @@ pub fn template_install_filter_handler(
 ) -> HandlerResult<commands::template_install_filter::InstallFilterResult> {
     let ctx = build_ctx(matches)?;
     Ok(Output::Render(
-        commands::template_install_filter::install_filter(&ctx)?,
+        commands::template_install_filter::install_filter(&ctx).explained()?,
     ))
 }
 
@@ -451,7 +1177,9 @@ pub fn refresh_handler(
     } else {
         commands::refresh::RefreshMode::Report
     };
-    Ok(Output::Render(commands::refresh::refresh(&ctx, mode)?))
+    Ok(Output::Render(
+        commands::refresh::refresh(&ctx, mode).explained()?,
+    ))
 }
 
 /// `dodot transform install-hook` — write `.git/hooks/pre-commit` with
@@ -463,7 +1191,9 @@ pub fn transform_install_hook_handler(
     _ctx: &CommandContext,
 ) -> HandlerResult<commands::transform::InstallHookResult> {
     let ctx = build_ctx(matches)?;
-    Ok(Output::Render(commands::transform::install_hook(&ctx)?))
+    Ok(Output::Render(
+        commands::transform::install_hook(&ctx).explained()?,
+    ))
 }
 
 /// `dodot probe shell-init` — most recent shell-startup profile.
@@ -487,15 +1217,18 @@ pub fn probe_shell_init_handler(
     let errors_only = flag_or_false(matches, "errors-only");
 
     let result = if errors_only {
-        commands::probe::shell_init_errors(&ctx, commands::probe::DEFAULT_FILTER_RUNS)?
+        commands::probe::shell_init_errors(&ctx, commands::probe::DEFAULT_FILTER_RUNS)
+            .explained()?
     } else if let Some(f) = filter {
-        commands::probe::shell_init_filter(&ctx, &f, commands::probe::DEFAULT_FILTER_RUNS)?
+        commands::probe::shell_init_filter(&ctx, &f, commands::probe::DEFAULT_FILTER_RUNS)
+            .explained()?
     } else if let Some(n) = runs {
-        commands::probe::shell_init_aggregate(&ctx, n)?
+        commands::probe::shell_init_aggregate(&ctx, n).explained()?
     } else if history {
-        commands::probe::shell_init_history(&ctx, commands::probe::DEFAULT_HISTORY_LIMIT)?
+        commands::probe::shell_init_history(&ctx, commands::probe::DEFAULT_HISTORY_LIMIT)
+            .explained()?
     } else {
-        commands::probe::shell_init(&ctx)?
+        commands::probe::shell_init(&ctx).explained()?
     };
     Ok(Output::Render(result))
 }
@@ -551,20 +1284,52 @@ fn clean_debug_format(input: &str) -> String {
     result
 }
 
-/// `dodot init-sh` — prints shell init script for `eval "$(dodot init-sh)"`.
-pub fn init_sh_passthrough() -> Result<(), anyhow::Error> {
+/// `dodot init-sh` — prints shell init script for `eval "$(dodot init-sh)"`,
+/// or with `--fish` the fish PATH script for `dodot init-sh --fish | source`.
+pub fn init_sh_passthrough(fish: bool) -> Result<(), anyhow::Error> {
     let dotfiles_root = discover_dotfiles_root()?;
     let ctx = ExecutionContext::production(&dotfiles_root, false)?;
     let root_config = ctx.config_manager.root_config()?;
-    let script = dodot_lib::shell::generate_init_script(
-        ctx.fs.as_ref(),
-        ctx.paths.as_ref(),
-        root_config.profiling.enabled,
-    )?;
+    // Best effort per pack: a broken `.dodot.toml` is logged and the
+    // pack gets the default placement.
+    let priorities = dodot_lib::packs::orchestration::path_priorities(&ctx)?;
+    let script = if fish {
+        // fish can't eval the POSIX script; it gets the PATH lines
+        // `dodot-init.fish` holds, built the same way.
+        let entries =
+            dodot_lib::shell::path_entries(ctx.fs.as_ref(), ctx.paths.as_ref(), &priorities)?;
+        dodot_lib::shell::exports::generate_fish_exports(&entries)
+    } else {
+        dodot_lib::shell::generate_init_script(
+            ctx.fs.as_ref(),
+            ctx.paths.as_ref(),
+            root_config.profiling.enabled,
+            &priorities,
+        )?
+    };
     print!("{script}");
     Ok(())
 }
 
+/// `dodot schema [COMMAND…]` — print a command's JSON Schema, or the
+/// list of commands that have one. Raw stdout so it pipes into
+/// validators as-is.
+pub fn schema_passthrough(matches: &clap::ArgMatches) -> Result<(), anyhow::Error> {
+    let words: Vec<String> = matches
+        .get_many::<String>("command")
+        .map(|v| v.cloned().collect())
+        .unwrap_or_default();
+    if words.is_empty() {
+        for (command, type_name) in commands::schema::SCHEMA_COMMANDS {
+            println!("{command:<15} {type_name}");
+        }
+        return Ok(());
+    }
+    let doc = commands::schema::schema(&words.join(" "))?;
+    println!("{doc:#}");
+    Ok(())
+}
+
 // ── Prompts (registry CLI surface) ─────────────────────────────
 
 pub fn prompts_list_handler(
@@ -572,7 +1337,7 @@ pub fn prompts_list_handler(
     _ctx: &CommandContext,
 ) -> HandlerResult<commands::prompts::PromptsListResult> {
     let ctx = build_readonly_ctx(matches)?;
-    let result = commands::prompts::list(&ctx)?;
+    let result = commands::prompts::list(&ctx).explained()?;
     Ok(Output::Render(result))
 }
 
@@ -593,7 +1358,99 @@ pub fn prompts_reset_handler(
             "`dodot prompts reset` requires either a key or --all"
         ));
     }
-    let result = commands::prompts::reset(key, &ctx)?;
+    let result = commands::prompts::reset(key, &ctx).explained()?;
+    Ok(Output::Render(result))
+}
+
+// ── State export / import ──────────────────────────────────────
+
+pub fn state_export_handler(
+    matches: &clap::ArgMatches,
+    _ctx: &CommandContext,
+) -> HandlerResult<commands::MessageResult> {
+    let ctx = build_ctx(matches)?;
+    let file = matches.get_one::<String>("file").expect("file is required");
+    let result = commands::state::export(&ctx, std::path::Path::new(file)).explained()?;
+    Ok(Output::Render(result))
+}
+
+/// `dodot migrate-state` — one-time move off the legacy data-dir
+/// layout.
+pub fn migrate_state_handler(
+    matches: &clap::ArgMatches,
+    _ctx: &CommandContext,
+) -> HandlerResult<commands::MessageResult> {
+    let ctx = build_ctx(matches)?;
+    let result = commands::migrate_state::migrate_state(&ctx).explained()?;
+    Ok(Output::Render(result))
+}
+
+/// `dodot relocate-data <dir>` — move the data dir and everything
+/// that points into it. A relative `dir` is taken from the current
+/// directory.
+pub fn relocate_data_handler(
+    matches: &clap::ArgMatches,
+    _ctx: &CommandContext,
+) -> HandlerResult<commands::MessageResult> {
+    let ctx = build_ctx(matches)?;
+    let dir = matches.get_one::<String>("dir").expect("dir is required");
+    let mut dir = PathBuf::from(dir);
+    if dir.is_relative() && !dir.starts_with("~") {
+        dir = std::env::current_dir()?.join(dir);
+    }
+    let result = commands::relocate_data::relocate_data(&dir, &ctx).explained()?;
+    Ok(Output::Render(result))
+}
+
+/// `dodot snippet [--install | --uninstall] [--shell <shell>]` —
+/// print, write or remove the rc block that loads dodot.
+pub fn snippet_handler(
+    matches: &clap::ArgMatches,
+    _ctx: &CommandContext,
+) -> HandlerResult<commands::MessageResult> {
+    use dodot_lib::commands::snippet;
+
+    let ctx = build_ctx(matches)?;
+    let shell_arg = matches.get_one::<String>("shell").map(String::as_str);
+    let shell = commands::git_alias::resolve_shell(shell_arg).explained()?;
+    let result = if flag_or_false(matches, "install") {
+        snippet::install(&ctx, shell)
+    } else if flag_or_false(matches, "uninstall") {
+        snippet::uninstall(&ctx, shell)
+    } else {
+        snippet::show(&ctx, shell)
+    };
+    Ok(Output::Render(result.explained()?))
+}
+
+pub fn state_import_handler(
+    matches: &clap::ArgMatches,
+    _ctx: &CommandContext,
+) -> HandlerResult<commands::MessageResult> {
+    let ctx = build_ctx(matches)?;
+    let file = matches.get_one::<String>("file").expect("file is required");
+    let result = commands::state::import(&ctx, std::path::Path::new(file)).explained()?;
+    Ok(Output::Render(result))
+}
+
+pub fn state_reindex_handler(
+    matches: &clap::ArgMatches,
+    _ctx: &CommandContext,
+) -> HandlerResult<commands::MessageResult> {
+    let ctx = build_ctx(matches)?;
+    let result = commands::state::reindex(&ctx).explained()?;
+    Ok(Output::Render(result))
+}
+
+// ── Error catalog ──────────────────────────────────────────────
+
+/// `dodot explain-error [CODE]` — needs no repo, so no context.
+pub fn explain_error_handler(
+    matches: &clap::ArgMatches,
+    _ctx: &CommandContext,
+) -> HandlerResult<commands::MessageResult> {
+    let code = matches.get_one::<String>("code").map(String::as_str);
+    let result = commands::explain_error::explain_error(code).explained()?;
     Ok(Output::Render(result))
 }
 
@@ -604,7 +1461,7 @@ pub fn git_install_filters_handler(
     _ctx: &CommandContext,
 ) -> HandlerResult<commands::MessageResult> {
     let ctx = build_readonly_ctx(matches)?;
-    let result = commands::git_filters::install_filters(&ctx)?;
+    let result = commands::git_filters::install_filters(&ctx).explained()?;
     Ok(Output::Render(result))
 }
 
@@ -613,7 +1470,7 @@ pub fn git_show_filters_handler(
     _ctx: &CommandContext,
 ) -> HandlerResult<commands::git_filters::ShowFiltersResult> {
     let ctx = build_readonly_ctx(matches)?;
-    let result = commands::git_filters::show_filters(&ctx)?;
+    let result = commands::git_filters::show_filters(&ctx).explained()?;
     Ok(Output::Render(result))
 }
 
@@ -1048,3 +1905,58 @@ pub fn plist_smudge_passthrough() -> Result<(), anyhow::Error> {
     stdout.flush()?;
     Ok(())
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use dodot_lib::commands::{DisplayFile, DisplayPack};
+
+    fn row(handler: &str, status_label: &str) -> DisplayFile {
+        DisplayFile {
+            name: handler.into(),
+            symbol: String::new(),
+            description: String::new(),
+            status: "pending".into(),
+            status_label: status_label.into(),
+            handler: handler.into(),
+            note_ref: None,
+            last_run: None,
+        }
+    }
+
+    #[test]
+    fn down_summary_counts_undo_commands_of_any_handler() {
+        // `down --deprovision` on a system pack: two undo commands and
+        // the handler's own state, no run-once handler in sight.
+        let packs = vec![DisplayPack::new(
+            "hosts".into(),
+            vec![
+                row("system", "[dry-run] would run"),
+                row("system", "[dry-run] would run"),
+                row("system", "[dry-run] would remove"),
+                row("symlink", "[dry-run] would remove"),
+            ],
+        )];
+        assert_eq!(
+            down_summary(&packs),
+            vec![
+                "dodot down will remove deployed state for 1 pack(s):",
+                "  1 symlink(s) removed",
+                "  1 shell / path / other handler state(s) cleared",
+                "  2 uninstall command(s) run",
+            ]
+        );
+
+        let packs = vec![DisplayPack::new(
+            "dev".into(),
+            vec![
+                row("autostart", "[dry-run] would remove"),
+                row("homebrew", "[dry-run] would remove"),
+            ],
+        )];
+        assert_eq!(
+            down_summary(&packs)[2],
+            "  1 provisioning record(s) forgotten — installed packages are left untouched"
+        );
+    }
+}
@@ -18,7 +18,7 @@
 
 use standout::{render_with_output, OutputMode};
 
-use dodot_lib::render::create_theme;
+use dodot_lib::render::{create_theme, glyphs};
 
 /// Embedded help texts, keyed by command path (`""` for top-level,
 /// `"up"` for `dodot up`, `"probe.shell-init"` for `dodot probe shell-init`).
@@ -31,12 +31,29 @@ const HELP_TEXTS: &[(&str, &str)] = &[
     ("down", include_str!("help/down.txt")),
     ("status", include_str!("help/status.txt")),
     ("list", include_str!("help/list.txt")),
+    ("changes", include_str!("help/changes.txt")),
+    ("provision", include_str!("help/provision.txt")),
+    ("plan", include_str!("help/plan.txt")),
+    ("apply", include_str!("help/apply.txt")),
+    ("preview", include_str!("help/preview.txt")),
     ("init", include_str!("help/init.txt")),
     ("fill", include_str!("help/fill.txt")),
+    ("run", include_str!("help/run.txt")),
+    ("serve", include_str!("help/serve.txt")),
     ("adopt", include_str!("help/adopt.txt")),
+    ("eject", include_str!("help/eject.txt")),
+    ("clone", include_str!("help/clone.txt")),
     ("addignore", include_str!("help/addignore.txt")),
+    ("pin", include_str!("help/pin.txt")),
+    ("unpin", include_str!("help/unpin.txt")),
+    ("disable", include_str!("help/disable.txt")),
+    ("enable", include_str!("help/enable.txt")),
+    ("protect", include_str!("help/protect.txt")),
     ("tutorial", include_str!("help/tutorial.txt")),
     ("init-sh", include_str!("help/init-sh.txt")),
+    ("snippet", include_str!("help/snippet.txt")),
+    ("completion", include_str!("help/completion.txt")),
+    ("schema", include_str!("help/schema.txt")),
     ("plist", include_str!("help/plist.txt")),
     (
         "git-install-filters",
@@ -47,6 +64,12 @@ const HELP_TEXTS: &[(&str, &str)] = &[
         include_str!("help/git-show-filters.txt"),
     ),
     ("prompts", include_str!("help/prompts.txt")),
+    ("state", include_str!("help/state.txt")),
+    ("migrate-state", include_str!("help/migrate-state.txt")),
+    ("relocate-data", include_str!("help/relocate-data.txt")),
+    ("trash", include_str!("help/trash.txt")),
+    ("explain-error", include_str!("help/explain-error.txt")),
+    ("doctor", include_str!("help/doctor.txt")),
     ("config", include_str!("help/config.txt")),
     (
         "probe.deployment-map",
@@ -172,8 +195,9 @@ pub fn render(text: &str, mode: OutputMode) -> String {
     // an empty struct is the conventional zero-data argument.
     #[derive(serde::Serialize)]
     struct NoData;
-    render_with_output(text, &NoData, &theme, mode)
-        .unwrap_or_else(|e| format!("(help render failed: {e})\n\n{text}"))
+    let rendered = render_with_output(text, &NoData, &theme, mode)
+        .unwrap_or_else(|e| format!("(help render failed: {e})\n\n{text}"));
+    glyphs::plain(&rendered).into_owned()
 }
 
 #[cfg(test)]
@@ -48,3 +48,70 @@ pub fn prompt_yes_no_show(prompt_lines: &[&str]) -> io::Result<YesNoShow> {
         _ => YesNoShow::No,
     })
 }
+
+/// Ask for a free-form value on stderr: `label: `. Returns the line
+/// without its newline, or `None` when stdin is closed.
+pub fn prompt_value(label: &str) -> io::Result<Option<String>> {
+    let mut stderr = io::stderr().lock();
+    write!(stderr, "{label}: ")?;
+    stderr.flush()?;
+
+    let mut buf = String::new();
+    if io::stdin().lock().read_line(&mut buf)? == 0 {
+        return Ok(None);
+    }
+    Ok(Some(buf.trim_end_matches(['\n', '\r']).to_string()))
+}
+
+/// How a [`confirm_destructive`] prompt ended.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Confirmation {
+    /// `--yes`, or the user answered `y`.
+    Confirmed,
+    /// The user answered anything else.
+    Declined,
+    /// stdin is not a terminal, so nobody could be asked.
+    NoTerminal,
+}
+
+/// Confirm a destructive action before running it.
+///
+/// `summary_lines` describe what's about to change (printed on
+/// stderr), followed by `question` and a `[y/N]` marker. Empty input
+/// and anything but `y`/`yes` decline — the safe default for an
+/// action that removes state.
+///
+/// `assume_yes` (the `--yes` / `-y` flag) skips the prompt entirely.
+/// Without it, a non-TTY stdin is [`Confirmation::NoTerminal`] rather
+/// than a silent "yes": scripts have to opt in explicitly. Callers
+/// treat both refusals as a cancel, and only the non-TTY one as a
+/// failed exit.
+pub fn confirm_destructive(
+    assume_yes: bool,
+    summary_lines: &[String],
+    question: &str,
+) -> io::Result<Confirmation> {
+    if assume_yes {
+        return Ok(Confirmation::Confirmed);
+    }
+    if !stdin_is_tty() {
+        return Ok(Confirmation::NoTerminal);
+    }
+
+    let mut stderr = io::stderr().lock();
+    for line in summary_lines {
+        writeln!(stderr, "{line}")?;
+    }
+    write!(stderr, "{question} [y/N] ")?;
+    stderr.flush()?;
+
+    let mut buf = String::new();
+    io::stdin().lock().read_line(&mut buf)?;
+    Ok(
+        if matches!(buf.trim().to_ascii_lowercase().as_str(), "y" | "yes") {
+            Confirmation::Confirmed
+        } else {
+            Confirmation::Declined
+        },
+    )
+}
@@ -4,10 +4,12 @@ use standout::{EmbeddedTemplates, OutputMode};
 
 use dodot_lib::render;
 
+mod completion;
 mod handlers;
 mod help;
 mod interactive;
 mod logging;
+mod progress;
 mod tutorial;
 
 fn main() {
@@ -17,6 +19,7 @@ fn main() {
     // own the dispatch instead of plumbing through standout's data
     // extractor.
     let raw_args: Vec<String> = std::env::args().collect();
+    let custom_theme = init_theme(&raw_args);
     if let Some(path) = help::detect_help_request(&raw_args) {
         let text = help::lookup(&path);
         // Help text is for humans — render with Auto so it picks up
@@ -25,7 +28,7 @@ fn main() {
         return;
     }
 
-    let app = build_app();
+    let app = build_app(custom_theme);
 
     // parse_with handles help rendering (with command groups) and exits if help requested
     let matches = app.parse_with(build_clap_command());
@@ -84,6 +87,13 @@ fn main() {
         .unwrap_or_else(|_| std::env::temp_dir().join("dodot-logs"));
     let _log_guard = logging::init(&log_dir, verbosity);
 
+    // --no-write-home reaches the library the way a cloned
+    // DOTFILES_ROOT does: through the environment, so every context
+    // built below wraps its filesystem in the home guard.
+    if matches.get_flag("no-write-home") {
+        std::env::set_var(dodot_lib::fs::NO_WRITE_HOME_ENV, "1");
+    }
+
     // Passthrough: config (clapfig handles its own output)
     if let Some(("config", sub_matches)) = matches.subcommand() {
         // If no config subcommand given, show config help instead of
@@ -108,8 +118,37 @@ fn main() {
     }
 
     // Passthrough: init-sh (raw stdout for shell eval)
-    if matches.subcommand_matches("init-sh").is_some() {
-        if let Err(e) = handlers::init_sh_passthrough() {
+    if let Some(sub) = matches.subcommand_matches("init-sh") {
+        if let Err(e) = handlers::init_sh_passthrough(sub.get_flag("fish")) {
+            eprintln!("error: {e}");
+            std::process::exit(1);
+        }
+        return;
+    }
+
+    // Passthrough: completion (raw stdout for shell eval, like init-sh)
+    if let Some(("completion", sub)) = matches.subcommand() {
+        let shell = *sub
+            .get_one::<clap_complete::Shell>("shell")
+            .expect("shell is required");
+        if let Err(e) = completion::passthrough(shell) {
+            eprintln!("error: {e}");
+            std::process::exit(1);
+        }
+        return;
+    }
+
+    // Passthrough: complete-files (called by the completion script)
+    if let Some(("complete-files", sub)) = matches.subcommand() {
+        let pack = sub.get_one::<String>("pack").expect("pack is required");
+        let prefix = sub.get_one::<String>("prefix").map_or("", String::as_str);
+        completion::files_passthrough(pack, prefix);
+        return;
+    }
+
+    // Passthrough: schema (raw JSON on stdout, no repo needed)
+    if let Some(("schema", sub)) = matches.subcommand() {
+        if let Err(e) = handlers::schema_passthrough(sub) {
             eprintln!("error: {e}");
             std::process::exit(1);
         }
@@ -137,10 +176,50 @@ fn main() {
     // Capture the matched subcommand name now so the post-dispatch hook
     // (which runs after standout consumed `matches`) can know what ran.
     let subcommand = matches.subcommand_name().map(str::to_string);
-    let output_mode = app.extract_output_mode(&matches);
-    match app.dispatch(matches, output_mode) {
+    let profile_started = matches.get_flag("profile").then(|| {
+        dodot_lib::timing::enable();
+        std::time::Instant::now()
+    });
+    let trace_dir = matches.get_one::<std::path::PathBuf>("trace-dir").cloned();
+    if trace_dir.is_some() {
+        dodot_lib::trace::enable();
+    }
+    let output_mode = no_color_override(app.extract_output_mode(&matches));
+    // Text output is fitted to the terminal; structured output keeps
+    // every string whole.
+    let text_output = matches!(
+        output_mode,
+        OutputMode::Auto | OutputMode::Term | OutputMode::Text | OutputMode::TermDebug
+    );
+    render::layout::set_output_width(text_output.then(render::layout::terminal_width));
+    // Structured output carries the data as it is.
+    if !text_output {
+        render::glyphs::set_ascii_only(false);
+    }
+    if matches.get_flag("stream") {
+        progress::install(output_mode);
+    }
+
+    // Passthrough: status --watch (redraws until interrupted, which
+    // standout's render-once dispatch can't do).
+    if let Some(("status", sub)) = matches.subcommand() {
+        if let Some(secs) = sub.get_one::<u64>("watch") {
+            if let Err(e) = handlers::status_watch(sub, *secs, output_mode) {
+                eprintln!("error: {e}");
+                std::process::exit(failure_code());
+            }
+            return;
+        }
+    }
+
+    let result = app.dispatch(matches, output_mode);
+    // The live display goes before the report that replaces it.
+    dodot_lib::progress::finish();
+    match result {
         standout::cli::RunResult::Handled(output) => {
-            println!("{output}");
+            println!("{}", render::glyphs::plain(&output));
+            report_profile(profile_started);
+            report_trace(trace_dir.as_deref(), &raw_args);
             // Post-up nudges. Both fire only after a successful `up`
             // and are soft (failures land in the debug log, never
             // stderr).
@@ -163,14 +242,23 @@ fn main() {
             // `dodot transform check` may have set a non-zero exit code
             // via PENDING_EXIT_CODE: the report still rendered above,
             // but findings are present and the pre-commit hook (R4) is
-            // counting on the process to exit 1. Read after print so
-            // the user sees the report even when we're about to exit.
+            // counting on the process to exit 1. `up` and `down` say
+            // how the run ended the same way (conflicts 3, partial
+            // failure 4, nothing to do 5). Read after print so the
+            // user sees the report even when we're about to exit.
+            let pending = handlers::PENDING_EXIT_CODE.load(std::sync::atomic::Ordering::Relaxed);
+            if pending != 0 {
+                std::process::exit(pending);
+            }
+        }
+        standout::cli::RunResult::Silent => {
+            // `dodot status --check --summary` prints its own line and
+            // still owes the caller an exit code.
             let pending = handlers::PENDING_EXIT_CODE.load(std::sync::atomic::Ordering::Relaxed);
             if pending != 0 {
                 std::process::exit(pending);
             }
         }
-        standout::cli::RunResult::Silent => {}
         standout::cli::RunResult::NoMatch(_) => {
             // No subcommand given — show help
             let _ = build_clap_command().print_help();
@@ -192,7 +280,9 @@ fn main() {
         // (status, up, down, list, init, fill, adopt, addignore, probe …).
         standout::cli::RunResult::Error(msg) => {
             eprintln!("{msg}");
-            std::process::exit(1);
+            report_profile(profile_started);
+            report_trace(trace_dir.as_deref(), &raw_args);
+            std::process::exit(failure_code());
         }
         // `RunResult` is `#[non_exhaustive]` cross-crate; the wildcard
         // keeps dodot building if a future variant is added without
@@ -204,6 +294,71 @@ fn main() {
     }
 }
 
+/// The exit code for a command that failed: the one its error carried
+/// (an unknown pack is 2, a conflict 3 — see `dodot_lib::ExitCode`),
+/// else 1.
+fn failure_code() -> i32 {
+    match handlers::PENDING_EXIT_CODE.load(std::sync::atomic::Ordering::Relaxed) {
+        0 => dodot_lib::ExitCode::Error.code(),
+        code => code,
+    }
+}
+
+/// `--profile`: print the per-phase timing table to stderr and save the
+/// raw spans as a trace file under `<data_dir>/probes/trace/`. Soft —
+/// a failed write is reported, never fatal.
+fn report_profile(started: Option<std::time::Instant>) {
+    use dodot_lib::timing;
+
+    let Some(started) = started else { return };
+    let spans = timing::take();
+    eprint!(
+        "\n{}",
+        timing::format_summary(&timing::summarize(&spans), started.elapsed())
+    );
+
+    let Ok(pather) = dodot_lib::paths::XdgPather::from_env() else {
+        return;
+    };
+    let stamp = std::time::SystemTime::now()
+        .duration_since(std::time::UNIX_EPOCH)
+        .map(|d| d.as_millis())
+        .unwrap_or(0);
+    let path = dodot_lib::paths::Pather::probes_trace_dir(&pather)
+        .join(format!("dodot-{stamp}.trace.json"));
+    match timing::write_trace(&dodot_lib::fs::OsFs::new(), &path, &spans) {
+        Ok(()) => eprintln!("trace: {}", path.display()),
+        Err(e) => eprintln!("warning: could not write trace: {e}"),
+    }
+}
+
+/// Write what `--trace-dir` recorded. `--var` values are masked in the
+/// saved command line: they are one-shot secrets more often than not.
+fn report_trace(dir: Option<&std::path::Path>, raw_args: &[String]) {
+    use dodot_lib::trace;
+
+    let Some(dir) = dir else { return };
+    let mut args = Vec::with_capacity(raw_args.len());
+    let mut mask_next = false;
+    for arg in raw_args {
+        let masked = if std::mem::take(&mut mask_next) {
+            arg.split_once('=').map(|(key, _)| format!("{key}=…"))
+        } else if arg == "--var" {
+            mask_next = true;
+            None
+        } else {
+            arg.strip_prefix("--var=")
+                .and_then(|pair| pair.split_once('='))
+                .map(|(key, _)| format!("--var={key}=…"))
+        };
+        args.push(masked.unwrap_or_else(|| arg.clone()));
+    }
+    match trace::write_artifacts(&dodot_lib::fs::OsFs::new(), dir, &args, &trace::take()) {
+        Ok(run_dir) => eprintln!("trace artifacts: {}", run_dir.display()),
+        Err(e) => eprintln!("warning: could not write trace artifacts: {e}"),
+    }
+}
+
 /// Templates shared with `dodot-lib` (via its `render` module). The
 /// CLI ships no private templates of its own, so we build the embedded
 /// source directly from the `pub const` strings exported by the lib
@@ -223,10 +378,13 @@ static TEMPLATE_ENTRIES: &[(&str, &str)] = &[
         render::TEMPLATE_TRANSFORM_INSTALL_HOOK,
     ),
     ("refresh.jinja", render::TEMPLATE_REFRESH),
+    ("plan.jinja", render::TEMPLATE_PLAN),
+    ("preview.jinja", render::TEMPLATE_PREVIEW),
     (
         "template-install-filter.jinja",
         render::TEMPLATE_TEMPLATE_INSTALL_FILTER,
     ),
+    ("template-check.jinja", render::TEMPLATE_TEMPLATE_CHECK),
     ("transform-status.jinja", render::TEMPLATE_TRANSFORM_STATUS),
     ("git-show-alias.jinja", render::TEMPLATE_GIT_SHOW_ALIAS),
     (
@@ -237,28 +395,125 @@ static TEMPLATE_ENTRIES: &[(&str, &str)] = &[
     ("secret-list.jinja", render::TEMPLATE_SECRET_LIST),
 ];
 
-fn build_app() -> App {
-    App::builder()
+/// Resolve the output theme before anything renders. `--theme` wins
+/// over the `preset` in `~/.config/dodot/theme.toml`; that file's
+/// `[styles]` overrides apply either way, and `--ascii` or its
+/// `ascii = true` switches to plain ASCII glyphs. A theme that fails
+/// to load falls back to the default with a warning instead of
+/// blocking the command. Returns whether a non-default theme is active.
+fn init_theme(raw_args: &[String]) -> bool {
+    let fs = dodot_lib::fs::OsFs::new();
+    let loaded = match dodot_lib::paths::XdgPather::from_env() {
+        Ok(pather) => render::ThemeSelection::load(&fs, &pather),
+        Err(_) => Ok(render::ThemeSelection::default()),
+    };
+    let ascii_flag = global_args(raw_args).any(|a| a == "--ascii");
+    let result = loaded.and_then(|mut selection| {
+        if let Some(preset) = theme_flag(raw_args) {
+            selection.preset = Some(preset);
+        }
+        render::glyphs::set_ascii_only(ascii_flag || selection.ascii);
+        let custom = !selection.is_default();
+        render::set_active_theme(selection).map(|()| custom)
+    });
+    result.unwrap_or_else(|e| {
+        render::glyphs::set_ascii_only(ascii_flag);
+        eprintln!(
+            "{}",
+            render::glyphs::plain(&format!("warning: {e}; using the default theme"))
+        );
+        false
+    })
+}
+
+/// Arguments ahead of `--`, where a global flag can appear.
+fn global_args(raw_args: &[String]) -> impl Iterator<Item = &String> {
+    raw_args.iter().skip(1).take_while(|a| *a != "--")
+}
+
+/// `--theme NAME` / `--theme=NAME`, read ahead of clap parsing because
+/// the theme has to be in place before the app (and `--help`) renders.
+fn theme_flag(raw_args: &[String]) -> Option<String> {
+    let mut args = global_args(raw_args);
+    while let Some(arg) = args.next() {
+        if arg == "--theme" {
+            return args.next().cloned();
+        }
+        if let Some(value) = arg.strip_prefix("--theme=") {
+            return Some(value.to_string());
+        }
+    }
+    None
+}
+
+/// The default look is the adaptive stylesheet in `src/styles`, which
+/// follows the terminal's light/dark scheme. A preset or user
+/// overrides replace it with the lib's merged theme so command output,
+/// help and the tutorial all agree.
+fn build_app(custom_theme: bool) -> App {
+    let builder = App::builder()
         .help_handling(true)
-        .templates(EmbeddedTemplates::new(TEMPLATE_ENTRIES, ""))
-        .styles(standout::embed_styles!("src/styles"))
-        .default_theme("dodot")
+        .templates(EmbeddedTemplates::new(TEMPLATE_ENTRIES, ""));
+    let builder = if custom_theme {
+        builder.theme(render::create_theme())
+    } else {
+        builder
+            .styles(standout::embed_styles!("src/styles"))
+            .default_theme("dodot")
+    };
+    builder
         .command("status", handlers::status_handler, "pack-status")
         .expect("register status")
         .command("up", handlers::up_handler, "pack-status")
         .expect("register up")
         .command("down", handlers::down_handler, "pack-status")
         .expect("register down")
+        .command("plan", handlers::plan_handler, "plan")
+        .expect("register plan")
+        .command("preview", handlers::preview_handler, "preview")
+        .expect("register preview")
+        .command("apply", handlers::apply_handler, "pack-status")
+        .expect("register apply")
+        .command("provision", handlers::provision_handler, "message")
+        .expect("register provision")
         .command("list", handlers::list_handler, "list")
         .expect("register list")
+        .command("changes", handlers::changes_handler, "message")
+        .expect("register changes")
+        .command("clone", handlers::clone_handler, "pack-status")
+        .expect("register clone")
         .command("init", handlers::init_handler, "message")
         .expect("register init")
         .command("fill", handlers::fill_handler, "message")
         .expect("register fill")
+        .command("run", handlers::run_handler, "message")
+        .expect("register run")
+        .command("serve", handlers::serve_handler, "message")
+        .expect("register serve")
         .command("adopt", handlers::adopt_handler, "pack-status")
         .expect("register adopt")
+        .command("eject", handlers::eject_handler, "message")
+        .expect("register eject")
         .command("addignore", handlers::addignore_handler, "message")
         .expect("register addignore")
+        .command("pin", handlers::pin_handler, "message")
+        .expect("register pin")
+        .command("unpin", handlers::unpin_handler, "message")
+        .expect("register unpin")
+        .command("disable", handlers::disable_handler, "message")
+        .expect("register disable")
+        .command("enable", handlers::enable_handler, "message")
+        .expect("register enable")
+        .command("protect.list", handlers::protect_list_handler, "message")
+        .expect("register protect.list")
+        .command("protect.add", handlers::protect_add_handler, "message")
+        .expect("register protect.add")
+        .command(
+            "protect.remove",
+            handlers::protect_remove_handler,
+            "message",
+        )
+        .expect("register protect.remove")
         .command("probe", handlers::probe_summary_handler, "probe")
         .expect("register probe")
         .command(
@@ -301,6 +556,22 @@ fn build_app() -> App {
         .expect("register prompts.list")
         .command("prompts.reset", handlers::prompts_reset_handler, "message")
         .expect("register prompts.reset")
+        .command("state.export", handlers::state_export_handler, "message")
+        .expect("register state.export")
+        .command("state.import", handlers::state_import_handler, "message")
+        .expect("register state.import")
+        .command("state.reindex", handlers::state_reindex_handler, "message")
+        .expect("register state.reindex")
+        .command("migrate-state", handlers::migrate_state_handler, "message")
+        .expect("register migrate-state")
+        .command("relocate-data", handlers::relocate_data_handler, "message")
+        .expect("register relocate-data")
+        .command("snippet", handlers::snippet_handler, "message")
+        .expect("register snippet")
+        .command("explain-error", handlers::explain_error_handler, "message")
+        .expect("register explain-error")
+        .command("doctor", handlers::doctor_handler, "message")
+        .expect("register doctor")
         .command(
             "transform.check",
             handlers::transform_check_handler,
@@ -321,6 +592,12 @@ fn build_app() -> App {
             "template-install-filter",
         )
         .expect("register template.install-filter")
+        .command(
+            "template.check",
+            handlers::template_check_handler,
+            "template-check",
+        )
+        .expect("register template.check")
         .command(
             "transform.status",
             handlers::transform_status_handler,
@@ -347,6 +624,12 @@ fn build_app() -> App {
         .expect("register secret.probe")
         .command("secret.list", handlers::secret_list_handler, "secret-list")
         .expect("register secret.list")
+        .command("trash.list", handlers::trash_list_handler, "message")
+        .expect("register trash.list")
+        .command("trash.restore", handlers::trash_restore_handler, "message")
+        .expect("register trash.restore")
+        .command("trash.prune", handlers::trash_prune_handler, "message")
+        .expect("register trash.prune")
         .command_groups(vec![
             CommandGroup {
                 title: "Core".into(),
@@ -356,22 +639,41 @@ fn build_app() -> App {
                     Some("down".into()),
                     Some("status".into()),
                     Some("list".into()),
+                    Some("provision".into()),
+                    Some("plan".into()),
+                    Some("apply".into()),
+                    Some("preview".into()),
                 ],
             },
             CommandGroup {
                 title: "Helpers".into(),
                 help: None,
                 commands: vec![
+                    Some("clone".into()),
                     Some("adopt".into()),
+                    Some("eject".into()),
+                    Some("trash".into()),
                     Some("init".into()),
                     Some("fill".into()),
+                    Some("run".into()),
+                    Some("serve".into()),
                     Some("addignore".into()),
+                    Some("pin".into()),
+                    Some("unpin".into()),
+                    Some("disable".into()),
+                    Some("enable".into()),
+                    Some("protect".into()),
                 ],
             },
             CommandGroup {
                 title: "Diagnostics".into(),
                 help: None,
-                commands: vec![Some("probe".into())],
+                commands: vec![
+                    Some("doctor".into()),
+                    Some("changes".into()),
+                    Some("probe".into()),
+                    Some("explain-error".into()),
+                ],
             },
             CommandGroup {
                 title: "Git filters".into(),
@@ -393,7 +695,13 @@ fn build_app() -> App {
                     Some("refresh".into()),
                     Some("tutorial".into()),
                     Some("init-sh".into()),
+                    Some("snippet".into()),
+                    Some("completion".into()),
+                    Some("schema".into()),
                     Some("prompts".into()),
+                    Some("state".into()),
+                    Some("migrate-state".into()),
+                    Some("relocate-data".into()),
                     Some("config".into()),
                     Some("help".into()),
                 ],
@@ -403,6 +711,35 @@ fn build_app() -> App {
         .expect("app build")
 }
 
+/// Honor the `NO_COLOR` convention (<https://no-color.org>): any
+/// non-empty value downgrades auto/terminal output to plain text.
+/// Explicit structured modes (`--output json` etc.) are left alone.
+fn no_color_override(mode: OutputMode) -> OutputMode {
+    let no_color = std::env::var_os("NO_COLOR").is_some_and(|v| !v.is_empty());
+    if no_color && matches!(mode, OutputMode::Auto | OutputMode::Term) {
+        OutputMode::Text
+    } else {
+        mode
+    }
+}
+
+/// `protect add` / `protect remove`: a path and the layer to edit.
+fn protect_edit_command(name: &'static str, about: &'static str) -> ClapCommand {
+    ClapCommand::new(name)
+        .about(about)
+        .arg(
+            Arg::new("path")
+                .help("Path under $HOME: ~/.netrc, .ssh/id_*, or an absolute path")
+                .required(true),
+        )
+        .arg(
+            Arg::new("pack")
+                .long("pack")
+                .value_name("PACK")
+                .help("Edit this pack's .dodot.toml instead of the root one"),
+        )
+}
+
 fn build_clap_command() -> ClapCommand {
     // `handlers::config_command` is the single source of truth for the
     // configured `ConfigCommand` — both this registration site and the
@@ -416,10 +753,18 @@ fn build_clap_command() -> ClapCommand {
         .arg(
             Arg::new("verbose")
                 .long("verbose")
-                .help("Enable verbose logging to stderr")
+                .help("Enable verbose logging to stderr and show per-file actions, skipped files and timings")
                 .global(true)
                 .action(ArgAction::SetTrue),
         )
+        .arg(
+            Arg::new("quiet")
+                .long("quiet")
+                .help("Only print errors and a one-line summary")
+                .global(true)
+                .conflicts_with_all(["verbose", "debug"])
+                .action(ArgAction::SetTrue),
+        )
         .arg(
             Arg::new("debug")
                 .long("debug")
@@ -443,6 +788,15 @@ fn build_clap_command() -> ClapCommand {
                 .conflicts_with("short")
                 .action(ArgAction::SetTrue),
         )
+        .arg(
+            Arg::new("view")
+                .long("view")
+                .help("Output layout: full (default), short, or table")
+                .global(true)
+                .value_name("VIEW")
+                .value_parser(["full", "short", "table"])
+                .conflicts_with_all(["short", "full"]),
+        )
         .arg(
             Arg::new("by-status")
                 .long("by-status")
@@ -459,20 +813,76 @@ fn build_clap_command() -> ClapCommand {
                 .conflicts_with("by-status")
                 .action(ArgAction::SetTrue),
         )
+        .arg(
+            Arg::new("profile")
+                .long("profile")
+                .help("Print a timing breakdown of the run and save a trace file")
+                .global(true)
+                .action(ArgAction::SetTrue),
+        )
+        .arg(
+            Arg::new("trace-dir")
+                .long("trace-dir")
+                .value_name("DIR")
+                .help("Save each pipeline stage's output (packs, matches, intents, operations) as JSON under DIR")
+                .global(true)
+                .value_parser(clap::value_parser!(std::path::PathBuf)),
+        )
+        .arg(
+            Arg::new("stream")
+                .long("stream")
+                .help("Show each operation on stderr as it finishes (lines, NDJSON with --output json, or a live tree in a terminal)")
+                .global(true)
+                .action(ArgAction::SetTrue),
+        )
+        .arg(
+            Arg::new("no-write-home")
+                .long("no-write-home")
+                .help("Keep every write inside dodot's data dir; change nothing else in $HOME")
+                .global(true)
+                .action(ArgAction::SetTrue),
+        )
+        .arg(
+            Arg::new("ascii")
+                .long("ascii")
+                .help("Plain ASCII output: no arrows, box drawing or other Unicode glyphs")
+                .global(true)
+                .action(ArgAction::SetTrue),
+        )
+        .arg(
+            Arg::new("theme")
+                .long("theme")
+                .value_name("THEME")
+                .help("Colour theme for output (overrides the preset in ~/.config/dodot/theme.toml)")
+                .global(true)
+                .value_parser(clap::builder::PossibleValuesParser::new(
+                    render::THEME_PRESETS.iter().copied(),
+                )),
+        )
+        .subcommand(
+            ClapCommand::new("changes")
+                .about("Show what the last `up` deployed differently from the one before")
+                .arg(
+                    Arg::new("packs")
+                        .help("Packs to compare (all if omitted)")
+                        .num_args(0..)
+                        .action(ArgAction::Append),
+                ),
+        )
         .subcommand(
             ClapCommand::new("status")
                 .about("Show deployment status of packs")
                 .after_help("Icons: ➞ symlink  ⚙ shell/homebrew  + path  × install script")
                 .arg(
                     Arg::new("packs")
-                        .help("Pack names to show (all if omitted)")
+                        .help("Packs to show: names, globs or [groups] names (all if omitted)")
                         .num_args(0..)
                         .action(ArgAction::Append),
                 )
                 .arg(
                     Arg::new("check-drift")
                         .long("check-drift")
-                        .help("Hash deployed externals and report any divergence from the configured signature (opt-in; can be slow for big trees)")
+                        .help("Hash deployed externals and report any divergence from the configured signature, and check that Brewfile packages are still installed (opt-in; can be slow for big trees)")
                         .action(ArgAction::SetTrue),
                 )
                 .arg(
@@ -480,6 +890,28 @@ fn build_clap_command() -> ClapCommand {
                         .long("diff")
                         .help("For run-once files reporting `older version`, show the unified diff between the previously-run snapshot and the current source")
                         .action(ArgAction::SetTrue),
+                )
+                .arg(
+                    Arg::new("check")
+                        .long("check")
+                        .help("Exit 0 when everything is deployed, 2 when changes are pending, 3 on errors or conflicts (for CI and login checks)")
+                        .action(ArgAction::SetTrue),
+                )
+                .arg(
+                    Arg::new("summary")
+                        .long("summary")
+                        .help("Print a single summary line instead of the full report (for shell prompts)")
+                        .action(ArgAction::SetTrue),
+                )
+                .arg(
+                    Arg::new("watch")
+                        .long("watch")
+                        .help("Redraw the report every SECS seconds (default 2) and list what changed, until Ctrl-C")
+                        .value_name("SECS")
+                        .num_args(0..=1)
+                        .default_missing_value("2")
+                        .value_parser(clap::value_parser!(u64).range(1..))
+                        .conflicts_with_all(["check", "summary"]),
                 ),
         )
         .subcommand(
@@ -487,7 +919,7 @@ fn build_clap_command() -> ClapCommand {
                 .about("Deploy packs")
                 .arg(
                     Arg::new("packs")
-                        .help("Pack names to deploy (all if omitted)")
+                        .help("Packs to deploy: names, globs or [groups] names (all if omitted)")
                         .num_args(0..)
                         .action(ArgAction::Append),
                 )
@@ -514,6 +946,92 @@ fn build_clap_command() -> ClapCommand {
                         .long("force")
                         .help("Overwrite pre-existing files at target locations")
                         .action(ArgAction::SetTrue),
+                )
+                .arg(
+                    Arg::new("no-input")
+                        .long("no-input")
+                        .help("Fail listing missing template variables instead of prompting for them")
+                        .action(ArgAction::SetTrue),
+                )
+                .arg(
+                    Arg::new("lint")
+                        .long("lint")
+                        .help("Run shellcheck over shell scripts and install scripts first")
+                        .action(ArgAction::SetTrue),
+                )
+                .arg(
+                    Arg::new("strict")
+                        .long("strict")
+                        .help("Like --lint, but stop before deploying if shellcheck finds anything")
+                        .action(ArgAction::SetTrue),
+                )
+                .arg(
+                    Arg::new("var")
+                        .long("var")
+                        .value_name("KEY=VALUE")
+                        .help("Set a template variable for this run only; never saved (repeatable)")
+                        .action(ArgAction::Append),
+                )
+                .arg(
+                    Arg::new("vars-file")
+                        .long("vars-file")
+                        .value_name("PATH")
+                        .help("Read one-shot template variables from a TOML file of strings (`-` for stdin)"),
+                )
+                .arg(
+                    Arg::new("only")
+                        .long("only")
+                        .value_name("GLOB")
+                        .help("Deploy only the pack files matching GLOB, a pack-relative path glob (repeatable)")
+                        .action(ArgAction::Append),
+                )
+                .arg(
+                    Arg::new("skip")
+                        .long("skip")
+                        .value_name("GLOB")
+                        .help("Leave out the pack files matching GLOB; wins over --only (repeatable)")
+                        .action(ArgAction::Append),
+                ),
+        )
+        .subcommand(
+            ClapCommand::new("plan")
+                .about("Show what `up` would change, optionally saving it for `apply`")
+                .arg(
+                    Arg::new("packs")
+                        .help("Packs to plan: names, globs or [groups] names (all if omitted)")
+                        .num_args(0..)
+                        .action(ArgAction::Append),
+                )
+                .arg(
+                    Arg::new("out")
+                        .long("out")
+                        .value_name("FILE")
+                        .help("Write the plan to FILE for `dodot apply`"),
+                )
+                .arg(
+                    Arg::new("no-provision")
+                        .long("no-provision")
+                        .help("Leave install scripts and Brewfile out of the plan")
+                        .action(ArgAction::SetTrue),
+                ),
+        )
+        .subcommand(
+            ClapCommand::new("preview")
+                .about("Show which home paths `up` would create, replace or leave in conflict")
+                .arg(
+                    Arg::new("packs")
+                        .help("Packs to preview: names, globs or [groups] names (all if omitted)")
+                        .num_args(0..)
+                        .action(ArgAction::Append),
+                ),
+        )
+        .subcommand(
+            ClapCommand::new("apply")
+                .about("Deploy a saved plan, refusing if anything changed since")
+                .arg(
+                    Arg::new("plan")
+                        .help("Plan file written by `dodot plan --out`")
+                        .required(true),
                 ),
         )
         .subcommand(
@@ -521,7 +1039,7 @@ fn build_clap_command() -> ClapCommand {
                 .about("Remove deployed state for packs")
                 .arg(
                     Arg::new("packs")
-                        .help("Pack names to deactivate (all if omitted)")
+                        .help("Packs to deactivate: names, globs or [groups] names (all if omitted)")
                         .num_args(0..)
                         .action(ArgAction::Append),
                 )
@@ -530,29 +1048,236 @@ fn build_clap_command() -> ClapCommand {
                         .long("dry-run")
                         .help("Show what would be done without making changes")
                         .action(ArgAction::SetTrue),
+                )
+                .arg(
+                    Arg::new("yes")
+                        .long("yes")
+                        .short('y')
+                        .help("Skip the confirmation prompt")
+                        .action(ArgAction::SetTrue),
+                )
+                .arg(
+                    Arg::new("deprovision")
+                        .long("deprovision")
+                        .help("Also undo provisioning (brew uninstall Brewfile entries)")
+                        .action(ArgAction::SetTrue),
+                ),
+        )
+        .subcommand(
+            ClapCommand::new("list")
+                .about("List all packs")
+                .arg(
+                    Arg::new("files")
+                        .long("files")
+                        .help("Also list every matched file with its handler and state")
+                        .action(ArgAction::SetTrue),
+                )
+                .arg(
+                    Arg::new("handler")
+                        .long("handler")
+                        .value_name("HANDLER")
+                        .help("With --files: only files claimed by this handler")
+                        .requires("files"),
+                )
+                .arg(
+                    Arg::new("state")
+                        .long("state")
+                        .value_name("STATE")
+                        .help("With --files: only files in this state (deployed, pending, …)")
+                        .requires("files"),
+                )
+                .arg(
+                    Arg::new("sort")
+                        .long("sort")
+                        .value_name("KEY")
+                        .help("With --files: order files by status (default), handler or state")
+                        .value_parser(["status", "handler", "state"])
+                        .requires("files"),
+                ),
+        )
+        .subcommand(
+            ClapCommand::new("provision")
+                .about("Re-run install scripts and Brewfiles without relinking")
+                .arg(
+                    Arg::new("packs")
+                        .help("Packs to provision: names, globs or [groups] names (all if omitted)")
+                        .num_args(0..)
+                        .action(ArgAction::Append),
+                )
+                .arg(
+                    Arg::new("upgrade")
+                        .long("upgrade")
+                        .help("Let brew upgrade pinned Brewfiles and rewrite Brewfile.lock.json")
+                        .action(ArgAction::SetTrue),
+                )
+                .arg(
+                    Arg::new("status")
+                        .long("status")
+                        .help("Show when each step last ran, where, for how long and how it exited; run nothing")
+                        .conflicts_with_all(["upgrade", "dry-run"])
+                        .action(ArgAction::SetTrue),
+                )
+                .arg(
+                    Arg::new("dry-run")
+                        .long("dry-run")
+                        .help("Show what would run without running it")
+                        .action(ArgAction::SetTrue),
+                )
+                .arg(
+                    Arg::new("lint")
+                        .long("lint")
+                        .help("Run shellcheck over the install scripts first")
+                        .action(ArgAction::SetTrue),
+                )
+                .arg(
+                    Arg::new("strict")
+                        .long("strict")
+                        .help("Like --lint, but run nothing if shellcheck finds anything")
+                        .action(ArgAction::SetTrue),
+                )
+                .arg(
+                    Arg::new("var")
+                        .long("var")
+                        .value_name("KEY=VALUE")
+                        .help("Set a template variable for this run only; never saved (repeatable)")
+                        .action(ArgAction::Append),
+                )
+                .arg(
+                    Arg::new("vars-file")
+                        .long("vars-file")
+                        .value_name("PATH")
+                        .help("Read one-shot template variables from a TOML file of strings (`-` for stdin)"),
+                )
+                .arg(
+                    Arg::new("only")
+                        .long("only")
+                        .value_name("GLOB")
+                        .help("Deploy only the pack files matching GLOB, a pack-relative path glob (repeatable)")
+                        .action(ArgAction::Append),
+                )
+                .arg(
+                    Arg::new("skip")
+                        .long("skip")
+                        .value_name("GLOB")
+                        .help("Leave out the pack files matching GLOB; wins over --only (repeatable)")
+                        .action(ArgAction::Append),
+                ),
+        )
+        .subcommand(
+            ClapCommand::new("clone")
+                .about("Clone a dotfiles repo, hook it into your shell and deploy it")
+                .arg(Arg::new("url").help("Git URL of the dotfiles repo").required(true))
+                .arg(Arg::new("dir").help("Where to clone (default: ~/dotfiles)"))
+                .arg(
+                    Arg::new("packs")
+                        .long("packs")
+                        .help("Only deploy these packs (comma-separated; all if omitted)")
+                        .value_name("PACKS")
+                        .value_delimiter(',')
+                        .action(ArgAction::Append),
+                )
+                .arg(
+                    Arg::new("shell")
+                        .long("shell")
+                        .help("Shell rc file to hook into (bash, zsh, fish). Auto-detected from $SHELL by default.")
+                        .value_name("SHELL")
+                        .num_args(1),
+                )
+                .arg(
+                    Arg::new("no-up")
+                        .long("no-up")
+                        .help("Clone and hook up the shell, but don't deploy")
+                        .action(ArgAction::SetTrue),
+                )
+                .arg(
+                    Arg::new("no-provision")
+                        .long("no-provision")
+                        .help("Skip install scripts and Brewfile")
+                        .action(ArgAction::SetTrue),
+                )
+                .arg(
+                    Arg::new("dry-run")
+                        .long("dry-run")
+                        .help("Clone, but only report the rc-file change and deployment instead of making them")
+                        .action(ArgAction::SetTrue),
                 ),
         )
-        .subcommand(ClapCommand::new("list").about("List all packs"))
         .subcommand(
             ClapCommand::new("init")
-                .about("Create a new pack")
-                .arg(Arg::new("pack").help("Pack name").required(true)),
+                .about("Create a new pack, or a whole dotfiles repo with --repo")
+                .arg(
+                    Arg::new("pack")
+                        .help("Pack name")
+                        .required_unless_present("repo")
+                        .conflicts_with("repo"),
+                )
+                .arg(
+                    Arg::new("type")
+                        .long("type")
+                        .value_name("TYPE")
+                        .help("Start from the archetype in ~/.config/dodot/templates/<TYPE>/"),
+                )
+                .arg(
+                    Arg::new("repo")
+                        .long("repo")
+                        .value_name("DIR")
+                        .num_args(0..=1)
+                        .default_missing_value("")
+                        .conflicts_with("type")
+                        .help("Scaffold a new dotfiles repo with sample packs in DIR (default: ~/dotfiles)"),
+                ),
         )
         .subcommand(
             ClapCommand::new("fill")
                 .about("Add placeholder files to an existing pack")
                 .arg(Arg::new("pack").help("Pack name").required(true)),
         )
+        .subcommand(
+            ClapCommand::new("run")
+                .about("Run a script from a pack with dodot's environment, outside provisioning")
+                .arg(Arg::new("pack").help("Pack name").required(true))
+                .arg(
+                    Arg::new("script")
+                        .help("Script path, relative to the pack")
+                        .required(true),
+                )
+                .arg(
+                    Arg::new("args")
+                        .help("Arguments passed through to the script")
+                        .num_args(0..)
+                        .trailing_var_arg(true)
+                        .allow_hyphen_values(true),
+                ),
+        )
+        .subcommand(
+            ClapCommand::new("serve")
+                .about("Answer status, plan, link and provision requests on a Unix socket")
+                .arg(
+                    Arg::new("socket")
+                        .long("socket")
+                        .value_name("PATH")
+                        .help("Socket to listen on; a stale one is replaced")
+                        .value_parser(clap::value_parser!(std::path::PathBuf))
+                        .required(true),
+                ),
+        )
         .subcommand(
             ClapCommand::new("adopt")
                 .about("Move files into a pack, symlinking from original location")
                 .arg(
                     Arg::new("files")
                         .help("Files to adopt (pack inferred from path)")
-                        .required(true)
+                        .required_unless_present("undo-last")
                         .num_args(1..)
                         .action(ArgAction::Append),
                 )
+                .arg(
+                    Arg::new("undo-last")
+                        .long("undo-last")
+                        .help("Revert the most recent adoption, putting its files back")
+                        .conflicts_with_all(["files", "into", "force", "dry-run", "no-follow", "only-os"])
+                        .action(ArgAction::SetTrue),
+                )
                 .arg(
                     Arg::new("into")
                         .long("into")
@@ -566,6 +1291,13 @@ fn build_clap_command() -> ClapCommand {
                         .help("Overwrite existing destination files in the pack")
                         .action(ArgAction::SetTrue),
                 )
+                .arg(
+                    Arg::new("yes")
+                        .long("yes")
+                        .short('y')
+                        .help("Skip the --force overwrite confirmation")
+                        .action(ArgAction::SetTrue),
+                )
                 .arg(
                     Arg::new("dry-run")
                         .long("dry-run")
@@ -591,18 +1323,170 @@ fn build_clap_command() -> ClapCommand {
                         .num_args(1),
                 ),
         )
+        .subcommand(
+            ClapCommand::new("eject")
+                .about("Take a file back out of a pack, leaving a real copy where it was linked")
+                .arg(Arg::new("pack").help("Pack name").required(true))
+                .arg(
+                    Arg::new("file")
+                        .help("Path inside the pack, or the deployed path (e.g. ~/.vimrc)")
+                        .required(true),
+                )
+                .arg(
+                    Arg::new("keep")
+                        .long("keep")
+                        .help("Leave the source in the pack")
+                        .action(ArgAction::SetTrue),
+                )
+                .arg(
+                    Arg::new("dry-run")
+                        .long("dry-run")
+                        .help("Show what would be ejected without making changes")
+                        .action(ArgAction::SetTrue),
+                ),
+        )
         .subcommand(
             ClapCommand::new("addignore")
                 .about("Mark a pack as pack-ignored (drops a .dodotignore marker)")
                 .arg(Arg::new("pack").help("Pack name").required(true)),
         )
+        .subcommand(
+            ClapCommand::new("pin")
+                .about("Freeze a pack on this machine so `up` leaves it alone; no pack lists pins")
+                .arg(Arg::new("pack").help("Pack name"))
+                .arg(
+                    Arg::new("reason")
+                        .long("reason")
+                        .value_name("TEXT")
+                        .help("Why it is pinned, shown by `dodot pin`")
+                        .requires("pack"),
+                ),
+        )
+        .subcommand(
+            ClapCommand::new("unpin")
+                .about("Let `up` manage a pinned pack again")
+                .arg(Arg::new("pack").help("Pack name").required(true)),
+        )
+        .subcommand(
+            ClapCommand::new("disable")
+                .about("Switch packs off, keeping provisioning state; no pack lists disabled packs")
+                .arg(
+                    Arg::new("packs")
+                        .help("Packs to disable: names, globs or [groups] names")
+                        .num_args(0..)
+                        .action(ArgAction::Append),
+                )
+                .arg(
+                    Arg::new("dry-run")
+                        .long("dry-run")
+                        .help("Show what would be done without making changes")
+                        .action(ArgAction::SetTrue),
+                ),
+        )
+        .subcommand(
+            ClapCommand::new("enable")
+                .about("Restore disabled packs exactly as they were, without re-running installs")
+                .arg(
+                    Arg::new("packs")
+                        .help("Packs to enable: names, globs or [groups] names")
+                        .num_args(1..)
+                        .required(true)
+                        .action(ArgAction::Append),
+                )
+                .arg(
+                    Arg::new("dry-run")
+                        .long("dry-run")
+                        .help("Show what would be done without making changes")
+                        .action(ArgAction::SetTrue),
+                ),
+        )
+        .subcommand(
+            ClapCommand::new("protect")
+                .about("List, add and remove paths the symlink handler refuses to link")
+                .subcommand_required(true)
+                .arg_required_else_help(true)
+                .subcommand(
+                    ClapCommand::new("list")
+                        .about("Show every protected path and where it comes from"),
+                )
+                .subcommand(protect_edit_command(
+                    "add",
+                    "Protect a path (relative to $HOME; globs like .ssh/id_* work)",
+                ))
+                .subcommand(protect_edit_command("remove", "Stop protecting a path")),
+        )
         .subcommand(
             config_cmd
                 .as_command("config")
                 .about("Manage configuration"),
         )
         .subcommand(
-            ClapCommand::new("init-sh").about("Print shell init script for eval in .zshrc/.bashrc"),
+            ClapCommand::new("init-sh")
+                .about("Print shell init script for eval in .zshrc/.bashrc")
+                .arg(
+                    Arg::new("fish")
+                        .long("fish")
+                        .action(ArgAction::SetTrue)
+                        .help("Print the fish PATH script instead, for `| source` in config.fish"),
+                ),
+        )
+        .subcommand(
+            ClapCommand::new("snippet")
+                .about("Print, install or remove the shell rc block that loads dodot")
+                .arg(
+                    Arg::new("shell")
+                        .long("shell")
+                        .help("Target shell (bash, zsh, fish). Auto-detected from $SHELL by default.")
+                        .value_name("SHELL")
+                        .num_args(1),
+                )
+                .arg(
+                    Arg::new("install")
+                        .long("install")
+                        .help("Add the block to the rc file, or update it in place")
+                        .action(ArgAction::SetTrue),
+                )
+                .arg(
+                    Arg::new("uninstall")
+                        .long("uninstall")
+                        .help("Remove the block from the rc file")
+                        .conflicts_with("install")
+                        .action(ArgAction::SetTrue),
+                )
+                .arg(
+                    Arg::new("force")
+                        .long("force")
+                        .help("Replace or remove the block even if it was edited by hand")
+                        .action(ArgAction::SetTrue),
+                ),
+        )
+        .subcommand(
+            ClapCommand::new("completion")
+                .about("Print a shell completion script (includes this repo's packs and groups)")
+                .arg(
+                    Arg::new("shell")
+                        .help("Target shell")
+                        .value_name("SHELL")
+                        .required(true)
+                        .value_parser(clap::value_parser!(clap_complete::Shell)),
+                ),
+        )
+        .subcommand(
+            ClapCommand::new("complete-files")
+                .about("List files in a pack for shell completion")
+                .hide(true)
+                .arg(Arg::new("pack").required(true))
+                .arg(Arg::new("prefix").allow_hyphen_values(true)),
+        )
+        .subcommand(
+            ClapCommand::new("schema")
+                .about("Print the JSON Schema of a command's --output json result")
+                .arg(
+                    Arg::new("command")
+                        .help("Command, e.g. `status` or `trash list`; omit to list them")
+                        .value_name("COMMAND")
+                        .num_args(0..),
+                ),
         )
         .subcommand(
             ClapCommand::new("git-show-alias")
@@ -613,7 +1497,7 @@ fn build_clap_command() -> ClapCommand {
                 .arg(
                     Arg::new("shell")
                         .long("shell")
-                        .help("Target shell (bash, zsh). Auto-detected from $SHELL by default.")
+                        .help("Target shell (bash, zsh, fish). Auto-detected from $SHELL by default.")
                         .value_name("SHELL")
                         .num_args(1),
                 ),
@@ -627,7 +1511,7 @@ fn build_clap_command() -> ClapCommand {
                 .arg(
                     Arg::new("shell")
                         .long("shell")
-                        .help("Target shell (bash, zsh). Auto-detected from $SHELL by default.")
+                        .help("Target shell (bash, zsh, fish). Auto-detected from $SHELL by default.")
                         .value_name("SHELL")
                         .num_args(1),
                 ),
@@ -635,8 +1519,8 @@ fn build_clap_command() -> ClapCommand {
         .subcommand(
             ClapCommand::new("template")
                 .about(
-                    "Template-source git integration: the clean filter (passthrough) and \
-                     filter installer.",
+                    "Templates: lint them, and the git integration — the clean filter \
+                     (passthrough) and filter installer.",
                 )
                 .subcommand_required(true)
                 .arg_required_else_help(true)
@@ -660,6 +1544,33 @@ fn build_clap_command() -> ClapCommand {
                         "Register the dodot-template clean filter in the dotfiles repo's \
                          .git/config (idempotent, per-clone, per-machine).",
                     ),
+                )
+                .subcommand(
+                    ClapCommand::new("check")
+                        .about(
+                            "Parse every template, list the variables each one reads and \
+                             where they come from, and flag syntax errors and missing \
+                             variables. Renders nothing; exits 1 on a finding.",
+                        )
+                        .arg(
+                            Arg::new("packs")
+                                .help("Packs to check: names, globs or [groups] names (all if omitted)")
+                                .num_args(0..)
+                                .action(ArgAction::Append),
+                        )
+                        .arg(
+                            Arg::new("var")
+                                .long("var")
+                                .value_name("KEY=VALUE")
+                                .help("Check as if this template variable were set (repeatable)")
+                                .action(ArgAction::Append),
+                        )
+                        .arg(
+                            Arg::new("vars-file")
+                                .long("vars-file")
+                                .value_name("PATH")
+                                .help("Read template variables from a TOML file of strings (`-` for stdin)"),
+                        ),
                 ),
         )
         .subcommand(
@@ -709,6 +1620,88 @@ fn build_clap_command() -> ClapCommand {
                         ),
                 ),
         )
+        .subcommand(
+            ClapCommand::new("doctor")
+                .about("Check that the shell integration on this machine works")
+                .arg(
+                    Arg::new("shell")
+                        .long("shell")
+                        .help("Shell-integration checks (currently the only group)")
+                        .action(ArgAction::SetTrue),
+                ),
+        )
+        .subcommand(
+            ClapCommand::new("explain-error")
+                .about("Explain an error code (e.g. LINK004) and what to do about it")
+                .arg(
+                    Arg::new("code")
+                        .help("Error code from a dodot error message (omit to list all)")
+                        .num_args(0..=1),
+                ),
+        )
+        .subcommand(
+            ClapCommand::new("state")
+                .about("Export, import or reindex datastore state")
+                .subcommand_required(true)
+                .arg_required_else_help(true)
+                .subcommand(
+                    ClapCommand::new("export")
+                        .about("Write sentinels and data links to a JSON file")
+                        .arg(Arg::new("file").help("State file to write").required(true))
+                        .arg(
+                            Arg::new("dry-run")
+                                .long("dry-run")
+                                .help("Report what would be exported without writing")
+                                .action(ArgAction::SetTrue),
+                        ),
+                )
+                .subcommand(
+                    ClapCommand::new("import")
+                        .about("Restore exported state, validated against this repo")
+                        .arg(Arg::new("file").help("State file to read").required(true))
+                        .arg(
+                            Arg::new("dry-run")
+                                .long("dry-run")
+                                .help("Report what would be restored without writing")
+                                .action(ArgAction::SetTrue),
+                        )
+                        .arg(
+                            Arg::new("force")
+                                .long("force")
+                                .help("Overwrite entries already in the datastore")
+                                .action(ArgAction::SetTrue),
+                        ),
+                )
+                .subcommand(
+                    ClapCommand::new("reindex")
+                        .about("Rebuild the sqlite datastore index from the data dir"),
+                ),
+        )
+        .subcommand(
+            ClapCommand::new("migrate-state")
+                .about("Move a data dir from the legacy deployed/ + sentinels/ layout to packs/<pack>/<handler>/")
+                .arg(
+                    Arg::new("dry-run")
+                        .long("dry-run")
+                        .help("List the moves and relinks without changing anything")
+                        .action(ArgAction::SetTrue),
+                ),
+        )
+        .subcommand(
+            ClapCommand::new("relocate-data")
+                .about("Move the data dir, repointing the links, scripts and settings that name it")
+                .arg(
+                    Arg::new("dir")
+                        .help("New data dir: absent or an empty directory")
+                        .required(true)
+                )
+                .arg(
+                    Arg::new("dry-run")
+                        .long("dry-run")
+                        .help("List the move and relinks without changing anything")
+                        .action(ArgAction::SetTrue),
+                ),
+        )
         .subcommand(
             ClapCommand::new("refresh")
                 .about(
@@ -773,6 +1766,52 @@ fn build_clap_command() -> ClapCommand {
                     ),
                 ),
         )
+        .subcommand(
+            ClapCommand::new("trash")
+                .about("List, restore and prune files that `up --force` replaced")
+                .visible_alias("backups")
+                .subcommand_required(true)
+                .arg_required_else_help(true)
+                .subcommand(
+                    ClapCommand::new("list")
+                        .about("Show trashed files, newest first, with their original paths"),
+                )
+                .subcommand(
+                    ClapCommand::new("restore")
+                        .about("Move a trashed file back to its original path")
+                        .arg(
+                            Arg::new("id")
+                                .help("Entry id, as shown by `dodot trash list`")
+                                .required(true),
+                        )
+                        .arg(
+                            Arg::new("dry-run")
+                                .long("dry-run")
+                                .help("Show what would be restored without moving anything")
+                                .action(ArgAction::SetTrue),
+                        ),
+                )
+                .subcommand(
+                    ClapCommand::new("prune")
+                        .about(
+                            "Drop duplicate (and, with --older-than, old) entries and the \
+                             stored files nothing refers to any more",
+                        )
+                        .arg(
+                            Arg::new("older-than")
+                                .long("older-than")
+                                .help("Also drop entries trashed more than DAYS days ago")
+                                .value_name("DAYS")
+                                .value_parser(clap::value_parser!(u64)),
+                        )
+                        .arg(
+                            Arg::new("dry-run")
+                                .long("dry-run")
+                                .help("Show what would be removed without deleting anything")
+                                .action(ArgAction::SetTrue),
+                        ),
+                ),
+        )
         .subcommand(
             ClapCommand::new("secret")
                 .about("Inspect secret providers and template references (Phase S5)")
@@ -0,0 +1,172 @@
+//! `--stream`: show operations on stderr as they finish.
+//!
+//! The sink follows the output mode, so stdout still carries exactly
+//! the usual report (and a JSON consumer still gets one document):
+//!
+//! - `text`: one line per operation.
+//! - `json` / `yaml`: one NDJSON object per operation.
+//! - `term`: a per-pack tree redrawn in place, showing each pack's
+//!   latest operation, and erased before the final report prints.
+//!   When stderr isn't a terminal there is nothing to redraw, so it
+//!   falls back to lines.
+
+use std::io::{IsTerminal, Write};
+use std::sync::{Arc, Mutex};
+
+use dodot_lib::progress::{self, ProgressEvent, ProgressSink};
+use dodot_lib::render::{glyphs, layout};
+use standout::OutputMode;
+
+/// Rows the tree may use when `LINES` doesn't say.
+const DEFAULT_ROWS: usize = 24;
+
+/// Install the sink for `mode`.
+pub fn install(mode: OutputMode) {
+    let sink: Arc<dyn ProgressSink> = match mode {
+        OutputMode::Auto | OutputMode::Term | OutputMode::TermDebug
+            if std::io::stderr().is_terminal() =>
+        {
+            Arc::new(Tree::default())
+        }
+        OutputMode::Auto | OutputMode::Term | OutputMode::TermDebug | OutputMode::Text => {
+            Arc::new(Lines)
+        }
+        _ => Arc::new(Ndjson),
+    };
+    progress::install(sink);
+}
+
+fn mark(event: &ProgressEvent) -> &'static str {
+    if event.success {
+        "ok"
+    } else {
+        "error"
+    }
+}
+
+struct Lines;
+
+impl ProgressSink for Lines {
+    fn operation(&self, event: &ProgressEvent) {
+        eprintln!(
+            "{} {}/{}: {}",
+            mark(event),
+            event.pack,
+            event.handler,
+            glyphs::plain(&event.message)
+        );
+    }
+}
+
+struct Ndjson;
+
+impl ProgressSink for Ndjson {
+    fn operation(&self, event: &ProgressEvent) {
+        eprintln!("{}", event.to_json_line());
+    }
+}
+
+#[derive(Default)]
+struct Tree {
+    state: Mutex<TreeState>,
+}
+
+#[derive(Default)]
+struct TreeState {
+    /// Packs in the order they first reported.
+    packs: Vec<PackRow>,
+    /// Lines currently on screen.
+    drawn: usize,
+}
+
+struct PackRow {
+    name: String,
+    done: usize,
+    failed: usize,
+    latest: String,
+}
+
+impl TreeState {
+    fn record(&mut self, event: &ProgressEvent) {
+        let row = match self.packs.iter().position(|p| p.name == event.pack) {
+            Some(i) => &mut self.packs[i],
+            None => {
+                self.packs.push(PackRow {
+                    name: event.pack.clone(),
+                    done: 0,
+                    failed: 0,
+                    latest: String::new(),
+                });
+                self.packs.last_mut().expect("just pushed")
+            }
+        };
+        row.done += 1;
+        if !event.success {
+            row.failed += 1;
+        }
+        row.latest = format!("{}: {}", event.handler, event.message);
+    }
+
+    /// The tree's lines, newest packs last, cut to what fits on screen.
+    fn lines(&self, width: usize, rows: usize) -> Vec<String> {
+        let mut lines = Vec::new();
+        for pack in &self.packs {
+            let (symbol, colour) = if pack.failed > 0 {
+                (glyphs::symbol("✗"), "31")
+            } else {
+                (glyphs::symbol("✓"), "32")
+            };
+            let mut count = format!("{} done", pack.done);
+            if pack.failed > 0 {
+                count.push_str(&format!(", {} failed", pack.failed));
+            }
+            let header = layout::truncate_end(&format!("{} ({count})", pack.name), width - 2);
+            lines.push(format!("\x1b[{colour}m{symbol}\x1b[0m {header}"));
+            lines.push(format!(
+                "  \x1b[2m{} {}\x1b[0m",
+                glyphs::symbol("└"),
+                layout::truncate_end(&glyphs::plain(&pack.latest), width - 4)
+            ));
+        }
+        let keep = rows.saturating_sub(1).max(2);
+        if lines.len() > keep {
+            lines.drain(..lines.len() - keep);
+        }
+        lines
+    }
+
+    /// Move back to where the tree started and clear to the end.
+    fn erase(&mut self, out: &mut impl Write) {
+        if self.drawn > 0 {
+            let _ = write!(out, "\x1b[{}F\x1b[J", self.drawn);
+            self.drawn = 0;
+        }
+    }
+}
+
+impl ProgressSink for Tree {
+    fn operation(&self, event: &ProgressEvent) {
+        let mut state = self.state.lock().unwrap();
+        state.record(event);
+        let width = layout::terminal_width().max(8);
+        let rows = std::env::var("LINES")
+            .ok()
+            .and_then(|v| v.trim().parse().ok())
+            .unwrap_or(DEFAULT_ROWS);
+        let lines = state.lines(width, rows);
+
+        let mut out = std::io::stderr().lock();
+        state.erase(&mut out);
+        for line in &lines {
+            let _ = writeln!(out, "{line}");
+        }
+        state.drawn = lines.len();
+        let _ = out.flush();
+    }
+
+    fn finish(&self) {
+        let mut out = std::io::stderr().lock();
+        self.state.lock().unwrap().erase(&mut out);
+        let _ = out.flush();
+    }
+}
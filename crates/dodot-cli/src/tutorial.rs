@@ -270,6 +270,9 @@ impl TutorialEnv {
             force: false,
             check_drift: false,
             show_diff: false,
+            lint: Default::default(),
+            template_vars: Default::default(),
+            file_filter: Default::default(),
             view_mode: ViewMode::Full,
             group_mode: GroupMode::Name,
             verbose: false,
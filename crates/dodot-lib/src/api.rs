@@ -0,0 +1,270 @@
+//! Programmatic entry points for embedding dodot.
+//!
+//! The `commands::*` functions are what the CLI calls, but their
+//! signatures grow a positional parameter every time a flag is added
+//! and they expect the caller to have set the matching
+//! [`ExecutionContext`] fields first. Provisioning tools and TUIs that
+//! want to drive dodot in-process should use this facade instead: one
+//! [`Dodot`] per dotfiles root, one options struct per command, and a
+//! [`write_report`] helper that renders any result into a caller-owned
+//! [`std::io::Write`].
+//!
+//! Options structs are `#[non_exhaustive]` with `Default`, so new knobs
+//! can land without breaking callers. They also deserialize from JSON
+//! with every field optional, which is how [`crate::serve`] takes them
+//! over its socket:
+//!
+//! ```no_run
+//! use dodot_lib::api::{Dodot, OutputMode, UpOptions};
+//!
+//! let mut dodot = Dodot::open("/home/me/dotfiles".as_ref())?;
+//! let mut opts = UpOptions::default();
+//! opts.packs = vec!["vim".into()];
+//! opts.dry_run = true;
+//! let result = dodot.up(&opts)?;
+//! dodot_lib::api::write_report(&mut std::io::stdout(), &result, OutputMode::Text)?;
+//! # Ok::<(), dodot_lib::DodotError>(())
+//! ```
+
+use std::io::Write;
+use std::path::{Path, PathBuf};
+
+use serde::Deserialize;
+
+use crate::commands::plan::Plan;
+use crate::commands::{self, MessageResult, PackStatusResult};
+use crate::packs::orchestration::ExecutionContext;
+use crate::{DodotError, Result};
+
+pub use standout_render::OutputMode;
+
+/// Options for [`Dodot::up`].
+#[derive(Debug, Clone, Default, Deserialize)]
+#[serde(default, deny_unknown_fields)]
+#[non_exhaustive]
+pub struct UpOptions {
+    /// Packs to deploy; empty means every pack.
+    pub packs: Vec<String>,
+    pub dry_run: bool,
+    /// Overwrite conflicting files at target paths.
+    pub force: bool,
+    /// Deploy links only; skip `install` / `homebrew` handlers.
+    pub no_provision: bool,
+    /// Re-run provisioning handlers even if they already ran.
+    pub provision_rerun: bool,
+}
+
+/// Options for [`Dodot::down`].
+#[derive(Debug, Clone, Default, Deserialize)]
+#[serde(default, deny_unknown_fields)]
+#[non_exhaustive]
+pub struct DownOptions {
+    /// Packs to remove; empty means every pack.
+    pub packs: Vec<String>,
+    pub dry_run: bool,
+}
+
+/// Options for [`Dodot::status`].
+#[derive(Debug, Clone, Default, Deserialize)]
+#[serde(default, deny_unknown_fields)]
+#[non_exhaustive]
+pub struct StatusOptions {
+    /// Packs to report on; empty means every pack.
+    pub packs: Vec<String>,
+    /// Hash deployed externals and warn on drift (`--check-drift`).
+    pub check_drift: bool,
+    /// Include diffs for changed run-once sources (`--diff`).
+    pub show_diff: bool,
+}
+
+/// Options for [`Dodot::plan`].
+#[derive(Debug, Clone, Default, Deserialize)]
+#[serde(default, deny_unknown_fields)]
+#[non_exhaustive]
+pub struct PlanOptions {
+    /// Packs to plan; empty means every pack.
+    pub packs: Vec<String>,
+    /// Leave provisioning handlers out of the plan.
+    pub no_provision: bool,
+}
+
+/// Options for [`Dodot::provision`].
+#[derive(Debug, Clone, Default, Deserialize)]
+#[serde(default, deny_unknown_fields)]
+#[non_exhaustive]
+pub struct ProvisionOptions {
+    /// Packs to provision; empty means every pack.
+    pub packs: Vec<String>,
+    /// Let brew upgrade pinned Brewfiles and rewrite their locks.
+    pub upgrade: bool,
+    pub dry_run: bool,
+    /// Report what each step last did instead of running anything.
+    pub status: bool,
+}
+
+/// Options for [`Dodot::adopt`].
+#[derive(Debug, Clone, Default, Deserialize)]
+#[serde(default, deny_unknown_fields)]
+#[non_exhaustive]
+pub struct AdoptOptions {
+    /// Files or directories to move into the dotfiles repo.
+    pub sources: Vec<PathBuf>,
+    /// Target pack (`--into`); `None` infers one per source.
+    pub into: Option<String>,
+    /// Gate label to nest sources under (`--only-os`).
+    pub only_os: Option<String>,
+    pub force: bool,
+    /// Adopt a symlink itself rather than what it points at.
+    pub no_follow: bool,
+    pub dry_run: bool,
+}
+
+/// A dotfiles repository that dodot can operate on.
+///
+/// Holds one [`ExecutionContext`]; each call applies its options to the
+/// context before running, so no flag leaks from one call into the
+/// next.
+pub struct Dodot {
+    ctx: ExecutionContext,
+}
+
+impl Dodot {
+    /// Open the dotfiles repo at `dotfiles_root` with the production
+    /// wiring (real filesystem, XDG paths, subprocess runner).
+    pub fn open(dotfiles_root: &Path) -> Result<Self> {
+        Ok(Self::from_context(ExecutionContext::production(
+            dotfiles_root,
+            false,
+        )?))
+    }
+
+    /// Wrap an existing context — for callers that need a custom
+    /// filesystem, datastore or command runner.
+    pub fn from_context(ctx: ExecutionContext) -> Self {
+        Self { ctx }
+    }
+
+    /// The underlying context, for anything the facade doesn't cover.
+    pub fn context(&self) -> &ExecutionContext {
+        &self.ctx
+    }
+
+    /// Deploy packs (`dodot up`).
+    pub fn up(&mut self, opts: &UpOptions) -> Result<PackStatusResult> {
+        self.reset();
+        self.ctx.dry_run = opts.dry_run;
+        self.ctx.force = opts.force;
+        self.ctx.no_provision = opts.no_provision;
+        self.ctx.provision_rerun = opts.provision_rerun;
+        commands::up::up(filter(&opts.packs), &self.ctx)
+    }
+
+    /// Remove deployed state for packs (`dodot down`).
+    pub fn down(&mut self, opts: &DownOptions) -> Result<PackStatusResult> {
+        self.reset();
+        self.ctx.dry_run = opts.dry_run;
+        commands::down::down(filter(&opts.packs), &self.ctx)
+    }
+
+    /// Report deployment state without changing anything (`dodot status`).
+    pub fn status(&mut self, opts: &StatusOptions) -> Result<PackStatusResult> {
+        self.reset();
+        self.ctx.check_drift = opts.check_drift;
+        self.ctx.show_diff = opts.show_diff;
+        commands::status::status(filter(&opts.packs), &self.ctx)
+    }
+
+    /// Preview what `up` would change (`dodot plan`).
+    pub fn plan(&mut self, opts: &PlanOptions) -> Result<Plan> {
+        self.reset();
+        self.ctx.no_provision = opts.no_provision;
+        commands::plan::plan(filter(&opts.packs), &self.ctx)
+    }
+
+    /// Re-run provisioning without relinking (`dodot provision`).
+    pub fn provision(&mut self, opts: &ProvisionOptions) -> Result<MessageResult> {
+        self.reset();
+        self.ctx.dry_run = opts.dry_run;
+        if opts.status {
+            return commands::provision::status(filter(&opts.packs), &self.ctx);
+        }
+        commands::provision::provision(filter(&opts.packs), opts.upgrade, &self.ctx)
+    }
+
+    /// Move existing files into a pack and link them back (`dodot adopt`).
+    pub fn adopt(&mut self, opts: &AdoptOptions) -> Result<PackStatusResult> {
+        self.reset();
+        commands::adopt::adopt(
+            opts.into.as_deref(),
+            &opts.sources,
+            opts.force,
+            opts.no_follow,
+            opts.dry_run,
+            opts.only_os.as_deref(),
+            &self.ctx,
+        )
+    }
+
+    /// Revert the most recent adoption (`dodot adopt --undo-last`).
+    pub fn undo_adopt(&mut self) -> Result<PackStatusResult> {
+        self.reset();
+        commands::adopt::undo_last(&self.ctx)
+    }
+
+    fn reset(&mut self) {
+        self.ctx.dry_run = false;
+        self.ctx.force = false;
+        self.ctx.no_provision = false;
+        self.ctx.provision_rerun = false;
+        self.ctx.check_drift = false;
+        self.ctx.show_diff = false;
+    }
+}
+
+fn filter(packs: &[String]) -> Option<&[String]> {
+    (!packs.is_empty()).then_some(packs)
+}
+
+/// Render a command result the way the CLI would and write it to `out`.
+/// `OutputMode::Json` writes the serialized result.
+pub fn write_report(
+    out: &mut dyn Write,
+    result: &PackStatusResult,
+    mode: OutputMode,
+) -> Result<()> {
+    let text = crate::render::render("pack-status", result, mode)?;
+    writeln!(out, "{}", text.trim_end())
+        .map_err(|e| DodotError::Other(format!("writing report: {e}")))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::commands::tests::support::make_ctx;
+    use crate::testing::TempEnvironment;
+
+    #[test]
+    fn up_then_status_through_facade() {
+        let env = TempEnvironment::builder()
+            .pack("vim")
+            .file("vimrc", "set nocompatible")
+            .done()
+            .build();
+        let mut dodot = Dodot::from_context(make_ctx(&env));
+
+        let mut up = UpOptions::default();
+        up.dry_run = true;
+        dodot.up(&up).unwrap();
+        env.assert_not_exists(&env.home.join(".vimrc"));
+
+        dodot.up(&UpOptions::default()).unwrap();
+        env.assert_exists(&env.home.join(".vimrc"));
+
+        let result = dodot.status(&StatusOptions::default()).unwrap();
+        let mut out = Vec::new();
+        write_report(&mut out, &result, OutputMode::Text).unwrap();
+        let text = String::from_utf8(out).unwrap();
+        assert!(text.contains("vim"), "report: {text}");
+        assert!(text.contains("vimrc"), "report: {text}");
+    }
+}
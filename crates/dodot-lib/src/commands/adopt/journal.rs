@@ -0,0 +1,192 @@
+//! The adopt journal: what each adoption moved, so it can be undone.
+//!
+//! Before the copy phase touches anything, adopt appends a record of
+//! every planned move (source, pack destination) to
+//! `<data_dir>/adopt-journal.json`, marked in progress. The record is
+//! committed once every source has been swapped for its symlink, and
+//! dropped if the adoption is rolled back. A record still in progress
+//! means dodot died mid-adoption; the next `adopt` refuses to run until
+//! `dodot adopt --undo-last` has rolled it back.
+//!
+//! Rolling an entry back is the swap in reverse: the pack copy is
+//! copied back over the symlink at the source, then removed from the
+//! pack. The same [`rollback`] serves a failed swap phase and
+//! `--undo-last`, so an undo brings back the file as it is in the pack
+//! now, edits included.
+
+use std::path::{Path, PathBuf};
+
+use serde::{Deserialize, Serialize};
+
+use crate::fs::Fs;
+use crate::paths::Pather;
+use crate::{DodotError, Result};
+
+const SCHEMA_VERSION: u32 = 1;
+
+/// Adoptions kept for `--undo-last`; older records are dropped.
+const MAX_RECORDS: usize = 20;
+
+/// One source an adoption moved.
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq)]
+pub struct JournalEntry {
+    pub source: PathBuf,
+    pub pack_dest: PathBuf,
+    /// `pack_dest` held content before the adoption (`--force`). That
+    /// content is gone, so a rollback restores the source but leaves
+    /// the pack copy in place.
+    #[serde(default)]
+    pub overwrote: bool,
+}
+
+/// One adoption.
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq)]
+pub struct JournalRecord {
+    /// Unix seconds.
+    pub adopted_at: u64,
+    /// Display name of the target pack.
+    pub pack: String,
+    /// The adoption created the pack directory.
+    #[serde(default)]
+    pub created_pack: bool,
+    pub pack_path: PathBuf,
+    /// `false` until every source has been swapped.
+    pub committed: bool,
+    pub entries: Vec<JournalEntry>,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+struct JournalFile {
+    version: u32,
+    #[serde(default)]
+    adoptions: Vec<JournalRecord>,
+}
+
+impl Default for JournalFile {
+    fn default() -> Self {
+        Self {
+            version: SCHEMA_VERSION,
+            adoptions: Vec::new(),
+        }
+    }
+}
+
+/// This machine's recent adoptions, oldest first. Mutations are
+/// in-memory until [`Journal::save`].
+#[derive(Debug, Clone, Default)]
+pub struct Journal {
+    file: JournalFile,
+}
+
+impl Journal {
+    /// Read the journal. Missing means nothing was adopted.
+    pub fn load(fs: &dyn Fs, paths: &dyn Pather) -> Result<Self> {
+        let path = paths.adopt_journal_path();
+        if !fs.exists(&path) {
+            return Ok(Self::default());
+        }
+        let raw = fs.read_to_string(&path)?;
+        let file: JournalFile = serde_json::from_str(&raw)
+            .map_err(|e| DodotError::Other(format!("failed to parse {}: {e}", path.display())))?;
+        if file.version != SCHEMA_VERSION {
+            return Err(DodotError::Other(format!(
+                "{} has unsupported schema version {} (expected {SCHEMA_VERSION})",
+                path.display(),
+                file.version
+            )));
+        }
+        Ok(Self { file })
+    }
+
+    /// Write the journal, or remove it once it is empty.
+    pub fn save(&self, fs: &dyn Fs, paths: &dyn Pather) -> Result<()> {
+        let path = paths.adopt_journal_path();
+        if self.file.adoptions.is_empty() {
+            if fs.exists(&path) {
+                fs.remove_file(&path)?;
+            }
+            return Ok(());
+        }
+        if let Some(parent) = path.parent() {
+            fs.mkdir_all(parent)?;
+        }
+        let body = serde_json::to_string_pretty(&self.file)
+            .map_err(|e| DodotError::Other(format!("failed to serialise adopt journal: {e}")))?;
+        fs.write_file_atomic(&path, body.as_bytes())
+    }
+
+    /// Append `record` as the latest adoption.
+    pub fn push(&mut self, record: JournalRecord) {
+        self.file.adoptions.push(record);
+        let excess = self.file.adoptions.len().saturating_sub(MAX_RECORDS);
+        self.file.adoptions.drain(..excess);
+    }
+
+    pub fn last(&self) -> Option<&JournalRecord> {
+        self.file.adoptions.last()
+    }
+
+    pub fn last_mut(&mut self) -> Option<&mut JournalRecord> {
+        self.file.adoptions.last_mut()
+    }
+
+    pub fn pop(&mut self) -> Option<JournalRecord> {
+        self.file.adoptions.pop()
+    }
+}
+
+/// What rolling back one entry did.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum Rollback {
+    /// The source is a real file or directory again.
+    Restored,
+    /// The source was never swapped; only the pack copy was removed.
+    Unswapped,
+    /// The source is no longer the adoption's symlink (replaced or
+    /// edited since); it was left alone, and so was the pack copy.
+    Changed,
+}
+
+/// Undo one entry: put the pack copy back at the source, then remove
+/// it from the pack unless the adoption overwrote something there.
+/// `committed` says every source was swapped, so a real file at the
+/// source is the user's, not the original.
+pub fn rollback(entry: &JournalEntry, committed: bool, fs: &dyn Fs) -> Result<Rollback> {
+    let outcome = if fs.is_symlink(&entry.source) {
+        if fs.readlink(&entry.source)? != entry.pack_dest {
+            return Ok(Rollback::Changed);
+        }
+        restore(&entry.source, &entry.pack_dest, fs)?;
+        Rollback::Restored
+    } else if fs.exists(&entry.source) {
+        if committed {
+            return Ok(Rollback::Changed);
+        }
+        Rollback::Unswapped
+    } else if !committed && fs.exists(&entry.pack_dest) {
+        // Died between moving a directory aside and linking it.
+        restore(&entry.source, &entry.pack_dest, fs)?;
+        Rollback::Restored
+    } else {
+        return Ok(Rollback::Changed);
+    };
+    if !entry.overwrote {
+        super::remove_best_effort(fs, &entry.pack_dest);
+    }
+    Ok(outcome)
+}
+
+/// Replace whatever is at `source` with a copy of `pack_dest`. The
+/// copy lands beside `source` first, so a failed copy leaves the
+/// symlink in place.
+fn restore(source: &Path, pack_dest: &Path, fs: &dyn Fs) -> Result<()> {
+    let stage = super::temp_sibling(source, "undo");
+    if let Err(e) = super::copy_tree(pack_dest, &stage, fs) {
+        super::remove_best_effort(fs, &stage);
+        return Err(e);
+    }
+    if fs.is_symlink(source) {
+        fs.remove_file(source)?;
+    }
+    fs.rename(&stage, source)
+}
@@ -30,8 +30,13 @@
 //! 2. **Swap phase** — per source, atomically replace the original with a
 //!    symlink to the pack copy. Files use a symlink-at-temp + rename-over-original
 //!    trick (POSIX atomic). Directories use a rename-to-backup + symlink + rm-backup
-//!    dance (one-step recoverable). A per-file failure cleans up that source's pack
-//!    copy only; previously-adopted sources remain adopted.
+//!    dance (one-step recoverable). The phase is all-or-nothing: if any source
+//!    fails, the sources already swapped are restored from their pack copies and
+//!    the copies removed, so a failed adopt leaves nothing stranded in the pack.
+//!
+//! Every adoption is recorded in the [`journal`] before the copy phase starts,
+//! so one interrupted by a crash can still be rolled back, and the most recent
+//! one can be reverted on demand with [`undo_last`] (`dodot adopt --undo-last`).
 //!
 //! Cross-pack deployment conflicts are detected after the copy phase and before
 //! the swap phase — adoption is refused if deploying the adopted files would
@@ -47,12 +52,13 @@
 //! against the existing pack inventory.
 
 mod infer;
+pub mod journal;
 
 use std::collections::BTreeSet;
 use std::path::{Path, PathBuf};
 
 use crate::commands::status;
-use crate::commands::{DisplayFile, DisplayNote, PackStatusResult};
+use crate::commands::PackStatusResult;
 use crate::conflicts;
 use crate::fs::Fs;
 use crate::packs;
@@ -61,6 +67,7 @@ use crate::rules;
 use crate::{DodotError, Result};
 
 use self::infer::{infer_target, InferredTarget};
+use self::journal::{Journal, JournalEntry, JournalRecord, Rollback};
 
 /// Re-export so the round-trip property test in `commands::tests` can
 /// drive the same `home.X` / `_home/X/` conventions inference uses.
@@ -155,13 +162,23 @@ pub fn adopt(
     let pack_display = resolved.display_name.clone();
     let pack_path = ctx.paths.pack_path(&pack_dir);
 
+    let mut journal = Journal::load(ctx.fs.as_ref(), ctx.paths.as_ref())?;
+    if !dry_run && journal.last().is_some_and(|r| !r.committed) {
+        return Err(DodotError::Other(
+            "an earlier adopt was interrupted before it finished; \
+             run `dodot adopt --undo-last` to roll it back first"
+                .into(),
+        ));
+    }
+
     // ── Auto-create the pack if inferred and missing ─────────────────
     //
     // Inferred-but-absent packs are created as empty directories. The
     // explicit `--into` path goes through `resolve_pack_dir_name` and
     // errors on miss instead — that's the typo-guard the user opted
     // into by naming a specific pack.
-    if !ctx.fs.exists(&pack_path) {
+    let created_pack = !ctx.fs.exists(&pack_path);
+    if created_pack {
         ctx.fs.mkdir_all(&pack_path)?;
     }
 
@@ -193,15 +210,38 @@ pub fn adopt(
         return Ok(result);
     }
 
+    // Journal the adoption before anything moves, so a crash from
+    // here on can be rolled back.
+    if !dry_run {
+        journal.push(JournalRecord {
+            adopted_at: crate::datastore::sentinel::unix_now(),
+            pack: pack_display.clone(),
+            created_pack,
+            pack_path: pack_path.clone(),
+            committed: false,
+            entries: plans
+                .iter()
+                .map(|p| JournalEntry {
+                    source: p.source.clone(),
+                    pack_dest: p.pack_dest.clone(),
+                    overwrote: p.destructive_overwrite,
+                })
+                .collect(),
+        });
+        journal.save(ctx.fs.as_ref(), ctx.paths.as_ref())?;
+    }
+
     // Phase 1 — copy every source into the pack. On failure, cleanup and bail.
     if let Err(e) = copy_all(&plans, ctx.fs.as_ref()) {
         cleanup_pack_copies(&plans, ctx.fs.as_ref());
+        abandon(&mut journal, dry_run, ctx)?;
         return Err(e);
     }
 
     // Cross-pack deploy conflict simulation happens with the copies in place.
     if let Err(e) = check_deploy_conflicts(ctx) {
         cleanup_pack_copies(&plans, ctx.fs.as_ref());
+        abandon(&mut journal, dry_run, ctx)?;
         return Err(e);
     }
 
@@ -216,8 +256,31 @@ pub fn adopt(
         return Ok(result);
     }
 
-    // Phase 2 — per-source atomic swap. Failures are recorded, not fatal.
-    let failures = swap_all(&plans, ctx.fs.as_ref());
+    // Phase 2 — per-source atomic swap, all or nothing.
+    if let Err(failure) = swap_all(&plans, ctx.fs.as_ref()) {
+        let record = journal.last().cloned().expect("adoption was journaled");
+        let unrestored = roll_back_record(&record, ctx.fs.as_ref());
+        // Anything left unrestored keeps the record in progress, so
+        // `--undo-last` can retry it.
+        let outcome = if unrestored.is_empty() {
+            abandon(&mut journal, dry_run, ctx)?;
+            "every source was rolled back".to_string()
+        } else {
+            format!(
+                "could not restore {}; run `dodot adopt --undo-last` to retry",
+                unrestored.join(", ")
+            )
+        };
+        return Err(DodotError::Other(format!(
+            "adopt failed: {}: {}; {outcome}",
+            failure.source.display(),
+            failure.reason
+        )));
+    }
+    if let Some(record) = journal.last_mut() {
+        record.committed = true;
+    }
+    journal.save(ctx.fs.as_ref(), ctx.paths.as_ref())?;
 
     let mut result = status::status(Some(std::slice::from_ref(&pack_display)), ctx)?;
     result.dry_run = false;
@@ -364,41 +427,87 @@ pub fn adopt(
         );
     }
 
-    // Adopt failures are real errors — surface them in the same
-    // command-wide notes list that drives `[N]` markers for status/up.
-    // To keep the model consistent ("every note is referenced by a row"),
-    // synthesize an error row in the target pack for the file we tried
-    // (and failed) to adopt. Post-rollback the pack doesn't actually
-    // contain that file, so this row is purely informational about the
-    // attempt — but it anchors the `[N]` back to a visible listing entry
-    // instead of leaving an orphaned footnote at the bottom.
-    for f in &failures {
-        let src_name = f
-            .source
-            .file_name()
-            .map(|n| n.to_string_lossy().into_owned())
-            .unwrap_or_else(|| f.source.display().to_string());
-        result.notes.push(DisplayNote {
-            body: format!("adopt failed: {}: {}", f.source.display(), f.reason),
-            hint: None,
-        });
-        let note_ref = Some(result.notes.len() as u32);
-        if let Some(pack) = result.packs.iter_mut().find(|p| p.name == pack_display) {
-            pack.files.push(DisplayFile {
-                name: src_name,
-                symbol: "×".into(),
-                description: "adopt failed".into(),
-                status: "error".into(),
-                status_label: "error".into(),
-                handler: String::new(),
-                note_ref,
-            });
-            pack.recompute_summary();
+    Ok(result)
+}
+
+/// Revert the most recent adoption (`dodot adopt --undo-last`), or
+/// finish rolling back one that was interrupted. Returns the pack's
+/// status; sources that changed since the adoption are left alone and
+/// listed in its warnings.
+pub fn undo_last(ctx: &ExecutionContext) -> Result<PackStatusResult> {
+    let mut journal = Journal::load(ctx.fs.as_ref(), ctx.paths.as_ref())?;
+    let Some(record) = journal.last().cloned() else {
+        return Err(DodotError::Other("no adoption to undo".into()));
+    };
+    let fs = ctx.fs.as_ref();
+    let mut warnings = Vec::new();
+    let mut restored = 0;
+    for entry in &record.entries {
+        match journal::rollback(entry, record.committed, fs)? {
+            Rollback::Restored => restored += 1,
+            Rollback::Unswapped => {}
+            Rollback::Changed => warnings.push(format!(
+                "left {} alone: it changed since the adoption",
+                entry.source.display()
+            )),
         }
     }
+    remove_created_pack(&record, fs);
+    journal.pop();
+    journal.save(fs, ctx.paths.as_ref())?;
+
+    // A pack the adoption created is gone again; show nothing then.
+    let shown = if fs.exists(&record.pack_path) {
+        vec![record.pack.clone()]
+    } else {
+        Vec::new()
+    };
+    let mut result = status::status(Some(&shown), ctx)?;
+    let state = if record.committed {
+        "adoption"
+    } else {
+        "interrupted adoption"
+    };
+    result.message = Some(format!(
+        "Undid the {state} into {}: {restored} of {} source(s) restored.",
+        record.pack,
+        record.entries.len()
+    ));
+    result.warnings.extend(warnings);
     Ok(result)
 }
 
+/// Roll back every entry of `record` after a failed swap phase,
+/// returning the sources that couldn't be restored.
+fn roll_back_record(record: &JournalRecord, fs: &dyn Fs) -> Vec<String> {
+    let unrestored = record
+        .entries
+        .iter()
+        .filter(|entry| journal::rollback(entry, false, fs).is_err())
+        .map(|entry| entry.source.display().to_string())
+        .collect::<Vec<_>>();
+    if unrestored.is_empty() {
+        remove_created_pack(record, fs);
+    }
+    unrestored
+}
+
+/// Remove a pack directory the adoption created, once it's empty again.
+fn remove_created_pack(record: &JournalRecord, fs: &dyn Fs) {
+    if record.created_pack && fs.read_dir(&record.pack_path).is_ok_and(|e| e.is_empty()) {
+        let _ = fs.remove_dir_all(&record.pack_path);
+    }
+}
+
+/// Drop the in-progress record of an adoption that was unwound.
+fn abandon(journal: &mut Journal, dry_run: bool, ctx: &ExecutionContext) -> Result<()> {
+    if dry_run {
+        return Ok(());
+    }
+    journal.pop();
+    journal.save(ctx.fs.as_ref(), ctx.paths.as_ref())
+}
+
 // ── Pack resolution (override / inference / aggregation) ─────────────
 
 /// Outcome of resolving the (single) pack the entire adopt invocation
@@ -978,10 +1087,10 @@ fn remove_best_effort(fs: &dyn Fs, path: &Path) {
 
 fn check_deploy_conflicts(ctx: &ExecutionContext) -> Result<()> {
     let root_config = ctx.config_manager.root_config()?;
-    let packs::DiscoveredPacks { packs: all, .. } = packs::scan_packs(
+    let packs::DiscoveredPacks { packs: all, .. } = packs::scan_root(
         ctx.fs.as_ref(),
         ctx.paths.dotfiles_root(),
-        &root_config.pack.ignore,
+        &root_config.pack,
     )?;
 
     let mut pack_intents = Vec::new();
@@ -1010,24 +1119,21 @@ struct AdoptFailure {
     reason: String,
 }
 
-fn swap_all(plans: &[AdoptPlan], fs: &dyn Fs) -> Vec<AdoptFailure> {
-    let mut failures = Vec::new();
+/// Swap every source, stopping at the first failure. Rolling back the
+/// sources already swapped is the caller's job (see [`journal::rollback`]).
+fn swap_all(plans: &[AdoptPlan], fs: &dyn Fs) -> std::result::Result<(), AdoptFailure> {
     for plan in plans {
         let result = if plan.is_dir {
             swap_dir(&plan.source, &plan.pack_dest, fs)
         } else {
             swap_file_atomic(&plan.source, &plan.pack_dest, fs)
         };
-        if let Err(e) = result {
-            // Roll back just this source: its pack copy is now orphaned.
-            remove_best_effort(fs, &plan.pack_dest);
-            failures.push(AdoptFailure {
-                source: plan.source.clone(),
-                reason: format!("{}", e),
-            });
-        }
+        result.map_err(|e| AdoptFailure {
+            source: plan.source.clone(),
+            reason: format!("{}", e),
+        })?;
     }
-    failures
+    Ok(())
 }
 
 /// Atomic file swap: create symlink at a temp sibling, then rename over the
@@ -0,0 +1,373 @@
+//! `changes` — what the last `up` deployed differently from the one
+//! before it.
+//!
+//! Every `dodot up` that deploys records, per pack, the actions the
+//! handlers came up with: each matched file, the handler that claimed
+//! it and, for links, its deploy target. The records live in
+//! `<data_dir>/run-actions.json`, newest last, [`KEEP_RUNS`] of them.
+//! `dodot changes` compares the newest with the one before: files newly
+//! matched or gone, files that moved to another handler, links whose
+//! target changed, and packs that appeared or left. It is a change log
+//! of the deployment itself; what changed *inside* a file is `git`'s
+//! business.
+//!
+//! An `up` limited to some packs records those packs and carries the
+//! rest over from the previous run, so a filtered run doesn't read as
+//! every other pack disappearing. The same goes for packs skipped as
+//! pinned or disabled, as long as they are still in the repo.
+
+use std::collections::{BTreeMap, BTreeSet};
+
+use serde::{Deserialize, Serialize};
+
+use crate::commands::probe::format_unix_ts;
+use crate::commands::status_report::StatusReport;
+use crate::packs::orchestration::ExecutionContext;
+use crate::packs::Pack;
+use crate::{DodotError, Result};
+
+const SCHEMA_VERSION: u32 = 1;
+
+/// Runs kept in the history.
+pub const KEEP_RUNS: usize = 10;
+
+/// One thing a handler does with a file.
+#[derive(Debug, Clone, PartialEq, Eq, PartialOrd, Ord, Serialize, Deserialize)]
+pub struct Action {
+    /// Pack-relative path.
+    pub name: String,
+    pub handler: String,
+    /// Deploy path with `$HOME` collapsed, for link items.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub target: Option<String>,
+}
+
+/// One pack's actions in one run.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct PackActions {
+    /// On-disk directory name, to tell whether the pack still exists.
+    pub dir: String,
+    pub actions: Vec<Action>,
+}
+
+/// The actions of one `up`, by pack display name.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct RunActions {
+    /// Unix seconds.
+    pub recorded_at: u64,
+    pub packs: BTreeMap<String, PackActions>,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+struct HistoryFile {
+    version: u32,
+    #[serde(default)]
+    runs: Vec<RunActions>,
+}
+
+/// Load the recorded runs, oldest first. Missing means none.
+pub fn load_history(ctx: &ExecutionContext) -> Result<Vec<RunActions>> {
+    let path = ctx.paths.run_actions_path();
+    if !ctx.fs.exists(&path) {
+        return Ok(Vec::new());
+    }
+    let raw = ctx.fs.read_to_string(&path)?;
+    let file: HistoryFile = serde_json::from_str(&raw)
+        .map_err(|e| DodotError::Other(format!("failed to parse {}: {e}", path.display())))?;
+    if file.version != SCHEMA_VERSION {
+        return Err(DodotError::Other(format!(
+            "{} has unsupported schema version {} (expected {SCHEMA_VERSION})",
+            path.display(),
+            file.version
+        )));
+    }
+    Ok(file.runs)
+}
+
+/// Record the actions of an `up` that deployed `packs`, as `report`
+/// shows them after the run.
+pub fn record_run(packs: &[Pack], report: &StatusReport, ctx: &ExecutionContext) -> Result<()> {
+    let mut runs = load_history(ctx)?;
+    let mut current: BTreeMap<String, PackActions> =
+        runs.last().map(|run| run.packs.clone()).unwrap_or_default();
+    current.retain(|_, pack| ctx.fs.exists(&ctx.paths.pack_path(&pack.dir)));
+    for pack in packs {
+        let mut actions: Vec<Action> = report
+            .packs
+            .iter()
+            .filter(|r| r.name == pack.display_name)
+            .flat_map(|r| r.handlers.iter())
+            .flat_map(|h| h.items.iter())
+            .map(|item| Action {
+                name: item.name.clone(),
+                handler: item.handler.clone(),
+                target: item.target.clone(),
+            })
+            .collect();
+        actions.sort();
+        actions.dedup();
+        current.insert(
+            pack.display_name.clone(),
+            PackActions {
+                dir: pack.name.clone(),
+                actions,
+            },
+        );
+    }
+    runs.push(RunActions {
+        recorded_at: crate::datastore::sentinel::unix_now(),
+        packs: current,
+    });
+    let excess = runs.len().saturating_sub(KEEP_RUNS);
+    runs.drain(..excess);
+
+    let path = ctx.paths.run_actions_path();
+    if let Some(parent) = path.parent() {
+        ctx.fs.mkdir_all(parent)?;
+    }
+    let body = serde_json::to_string_pretty(&HistoryFile {
+        version: SCHEMA_VERSION,
+        runs,
+    })
+    .map_err(|e| DodotError::Other(format!("failed to serialise run history: {e}")))?;
+    ctx.fs.write_file_atomic(&path, body.as_bytes())
+}
+
+/// How one file's deployment changed between two runs.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "lowercase")]
+pub enum ChangeKind {
+    /// Newly matched.
+    Added,
+    /// No longer matched.
+    Removed,
+    /// Still matched, by another handler or to another target.
+    Changed,
+}
+
+/// One difference between two runs.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct ActionChange {
+    /// Pack display name.
+    pub pack: String,
+    pub kind: ChangeKind,
+    /// Pack-relative path.
+    pub name: String,
+    /// The action in the newer run, or in the older one for `removed`.
+    pub handler: String,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub target: Option<String>,
+    /// The older run's handler, for `changed` when it differs.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub previous_handler: Option<String>,
+    /// The older run's target, for `changed` when it differs.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub previous_target: Option<String>,
+}
+
+/// `dodot changes`. `message` / `details` feed the `message` template;
+/// `changes` is the structured diff for `--output json`.
+#[derive(Debug, Clone, Serialize)]
+pub struct ChangesResult {
+    pub message: String,
+    pub details: Vec<String>,
+    pub changes: Vec<ActionChange>,
+}
+
+/// Compare the last recorded `up` with the one before it, limited to
+/// `pack_filter` when given.
+pub fn changes(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<ChangesResult> {
+    let runs = load_history(ctx)?;
+    let (older, newer) = match runs.as_slice() {
+        [.., older, newer] => (older, newer),
+        _ => {
+            return Ok(ChangesResult {
+                message: "Nothing to compare yet: changes are recorded from the second \
+                          `dodot up` on."
+                    .into(),
+                details: Vec::new(),
+                changes: Vec::new(),
+            })
+        }
+    };
+    let selected = |pack: &str| pack_filter.map_or(true, |names| names.iter().any(|n| n == pack));
+    let pack_names: BTreeSet<&String> = older
+        .packs
+        .keys()
+        .chain(newer.packs.keys())
+        .filter(|p| selected(p))
+        .collect();
+
+    let mut changes = Vec::new();
+    let mut details = Vec::new();
+    for pack in pack_names {
+        let before = older.packs.get(pack);
+        let after = newer.packs.get(pack);
+        match (before, after) {
+            (None, Some(_)) => details.push(format!("{pack}: new pack")),
+            (Some(_), None) => details.push(format!("{pack}: pack gone")),
+            _ => {}
+        }
+        let pack_changes = diff_pack(
+            pack,
+            before.map_or(&[][..], |p| &p.actions),
+            after.map_or(&[][..], |p| &p.actions),
+        );
+        details.extend(pack_changes.iter().map(describe));
+        changes.extend(pack_changes);
+    }
+
+    let span = format!(
+        "the last `up` ({}) and the one before ({})",
+        format_unix_ts(newer.recorded_at),
+        format_unix_ts(older.recorded_at)
+    );
+    let message = if details.is_empty() {
+        format!("No deployment changes between {span}.")
+    } else {
+        format!("Deployment changes between {span}:")
+    };
+    Ok(ChangesResult {
+        message,
+        details,
+        changes,
+    })
+}
+
+/// Diff one pack's actions, matched up by file name. A file claimed
+/// by several handlers (an install script that is also linked, say)
+/// is compared handler by handler.
+fn diff_pack(pack: &str, before: &[Action], after: &[Action]) -> Vec<ActionChange> {
+    let by_name = |actions: &[Action]| {
+        let mut map: BTreeMap<String, Vec<Action>> = BTreeMap::new();
+        for action in actions {
+            map.entry(action.name.clone())
+                .or_default()
+                .push(action.clone());
+        }
+        map
+    };
+    let (before, after) = (by_name(before), by_name(after));
+    let names: BTreeSet<&String> = before.keys().chain(after.keys()).collect();
+
+    let change = |kind, action: &Action| ActionChange {
+        pack: pack.to_string(),
+        kind,
+        name: action.name.clone(),
+        handler: action.handler.clone(),
+        target: action.target.clone(),
+        previous_handler: None,
+        previous_target: None,
+    };
+    let mut changes = Vec::new();
+    for name in names {
+        let old = before.get(name).map(Vec::as_slice).unwrap_or_default();
+        let new = after.get(name).map(Vec::as_slice).unwrap_or_default();
+        // Same handler on both sides: at most the target moved.
+        for action in new {
+            match old.iter().find(|o| o.handler == action.handler) {
+                Some(o) if o.target != action.target => changes.push(ActionChange {
+                    previous_target: o.target.clone(),
+                    ..change(ChangeKind::Changed, action)
+                }),
+                Some(_) => {}
+                None => match old
+                    .iter()
+                    .find(|o| !new.iter().any(|n| n.handler == o.handler))
+                {
+                    // One handler gave the file up and another took it.
+                    Some(o) if old.len() == 1 && new.len() == 1 => changes.push(ActionChange {
+                        previous_handler: Some(o.handler.clone()),
+                        previous_target: (o.target != action.target)
+                            .then(|| o.target.clone())
+                            .flatten(),
+                        ..change(ChangeKind::Changed, action)
+                    }),
+                    _ => changes.push(change(ChangeKind::Added, action)),
+                },
+            }
+        }
+        let handed_over = old.len() == 1 && new.len() == 1;
+        for action in old {
+            if !new.iter().any(|n| n.handler == action.handler) && !handed_over {
+                changes.push(change(ChangeKind::Removed, action));
+            }
+        }
+    }
+    changes
+}
+
+fn describe(change: &ActionChange) -> String {
+    let target = |t: &Option<String>| t.as_ref().map(|t| format!(" → {t}")).unwrap_or_default();
+    match change.kind {
+        ChangeKind::Added => format!(
+            "{}: + {} ({}){}",
+            change.pack,
+            change.name,
+            change.handler,
+            target(&change.target)
+        ),
+        ChangeKind::Removed => format!(
+            "{}: - {} ({}){}",
+            change.pack,
+            change.name,
+            change.handler,
+            target(&change.target)
+        ),
+        ChangeKind::Changed => {
+            // A new handler usually means a new target too; the
+            // handler is the news.
+            let what = match &change.previous_handler {
+                Some(previous) => format!("handler {previous} → {}", change.handler),
+                None => format!(
+                    "target {} → {}",
+                    change.previous_target.as_deref().unwrap_or("none"),
+                    change.target.as_deref().unwrap_or("none")
+                ),
+            };
+            format!("{}: ~ {} ({what})", change.pack, change.name)
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn action(name: &str, handler: &str, target: Option<&str>) -> Action {
+        Action {
+            name: name.into(),
+            handler: handler.into(),
+            target: target.map(str::to_string),
+        }
+    }
+
+    #[test]
+    fn diff_reports_added_removed_and_changed_actions() {
+        let before = [
+            action("aliases.sh", "shell", None),
+            action("gone", "symlink", Some("~/.gone")),
+            action("tool", "symlink", Some("~/.tool")),
+            action("vimrc", "symlink", Some("~/.vimrc")),
+        ];
+        let after = [
+            action("aliases.sh", "shell", None),
+            action("init.lua", "symlink", Some("~/.config/nvim/init.lua")),
+            action("tool", "path", None),
+            action("vimrc", "symlink", Some("~/.config/vim/vimrc")),
+        ];
+        let lines: Vec<String> = diff_pack("vim", &before, &after)
+            .iter()
+            .map(describe)
+            .collect();
+        assert_eq!(
+            lines,
+            [
+                "vim: - gone (symlink) → ~/.gone",
+                "vim: + init.lua (symlink) → ~/.config/nvim/init.lua",
+                "vim: ~ tool (handler symlink → path)",
+                "vim: ~ vimrc (target ~/.vimrc → ~/.config/vim/vimrc)",
+            ]
+        );
+    }
+}
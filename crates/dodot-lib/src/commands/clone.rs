@@ -0,0 +1,106 @@
+//! `dodot clone <git-url> [DIR]` — bootstrap a new machine in one step.
+//!
+//! 1. `git clone` the repo to `DIR` (default `~/dotfiles`, the
+//!    location the docs use throughout);
+//! 2. install the `dodot snippet` block in the shell rc file — it
+//!    exports `DOTFILES_ROOT` and loads the init script, so every later
+//!    dodot invocation and every new shell finds the repo;
+//! 3. `dodot up` — all packs, or just the ones named with `--packs`.
+//!
+//! Cloning happens before there is a dotfiles root to build an
+//! [`ExecutionContext`] around, so it is its own step
+//! ([`clone_repo`]); the CLI then builds the context for the fresh
+//! clone and hands it to [`bootstrap`] for the rest.
+
+use std::path::{Path, PathBuf};
+
+use crate::commands::git_alias::{render_home_relative, InstallAliasOutcome, Shell};
+use crate::commands::PackStatusResult;
+use crate::datastore::{format_command_for_display, CommandRunner};
+use crate::fs::Fs;
+use crate::packs::orchestration::ExecutionContext;
+use crate::{DodotError, Result};
+
+/// Clone destination under `$HOME` when no `DIR` is given.
+pub const DEFAULT_CLONE_DIR: &str = "dotfiles";
+
+/// `git clone url dest`. Refuses a `dest` that already exists and is
+/// not empty — git would too, but with a less useful message.
+pub fn clone_repo(url: &str, dest: &Path, fs: &dyn Fs, runner: &dyn CommandRunner) -> Result<()> {
+    if fs.exists(dest) && !fs.read_dir(dest).map(|e| e.is_empty()).unwrap_or(false) {
+        return Err(DodotError::Other(format!(
+            "{} already exists and is not empty; pass another directory, \
+             or run `dodot up` there if it already holds your dotfiles",
+            dest.display()
+        )));
+    }
+    if let Some(parent) = dest.parent() {
+        fs.mkdir_all(parent)?;
+    }
+
+    let arguments = vec![
+        "clone".to_string(),
+        url.to_string(),
+        dest.display().to_string(),
+    ];
+    let output = runner.run("git", &arguments)?;
+    if output.exit_code != 0 {
+        return Err(DodotError::CommandFailed {
+            command: format_command_for_display("git", &arguments),
+            exit_code: output.exit_code,
+            stderr: output.stderr,
+            stdout: output.stdout,
+        });
+    }
+    Ok(())
+}
+
+/// Install the shell snippet for `shell` and deploy. `ctx` is rooted
+/// at the fresh clone. With `deploy = false` the result is a status
+/// report instead, so the user sees what `up` would do.
+pub fn bootstrap(
+    ctx: &ExecutionContext,
+    shell: Shell,
+    pack_filter: Option<&[String]>,
+    deploy: bool,
+) -> Result<PackStatusResult> {
+    let root = ctx.paths.dotfiles_root();
+    let rc_path = ctx.paths.home_dir().join(shell.rc_relative_path());
+    let rc_display = render_home_relative(&rc_path, ctx.paths.home_dir());
+    let outcome = if ctx.dry_run {
+        None
+    } else {
+        Some(crate::commands::snippet::install_block(ctx, shell)?)
+    };
+
+    let mut result = if deploy {
+        crate::commands::up::up_or_status_for_conflict(pack_filter, ctx)?
+    } else {
+        crate::commands::status::status(pack_filter, ctx)?
+    };
+
+    let snippet_line = match outcome {
+        None => format!("Would add the dodot snippet to {rc_display}."),
+        Some(InstallAliasOutcome::AlreadyInstalled) => {
+            format!("{rc_display} already loads dodot.")
+        }
+        Some(_) => format!(
+            "Added the dodot snippet to {rc_display}; open a new shell or run `source {rc_display}`."
+        ),
+    };
+    let lead = format!("Cloned into {}.", root.display());
+    let mut message = vec![lead, snippet_line];
+    if !deploy {
+        message.push("Run `dodot up` to deploy.".into());
+    }
+    if let Some(existing) = result.message.take() {
+        message.push(existing);
+    }
+    result.message = Some(message.join("\n"));
+    Ok(result)
+}
+
+/// `~/dotfiles` for `home`.
+pub fn default_clone_dest(home: &Path) -> PathBuf {
+    home.join(DEFAULT_CLONE_DIR)
+}
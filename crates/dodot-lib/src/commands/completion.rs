@@ -0,0 +1,179 @@
+//! Values for `dodot completion` — the repo-specific words a shell
+//! should offer, gathered when the completion script is generated.
+//!
+//! Static completion (subcommands, flags) comes from the clap command
+//! tree; this module supplies what only the dotfiles repo knows: pack
+//! names, `[groups]` names, gate labels, and prompt keys. A script
+//! generated from `eval "$(dodot completion zsh)"` in an rc file picks
+//! up new packs with the next shell.
+//!
+//! File arguments inside a pack (`eject <pack> <file>`, `run <pack>
+//! <script>`) can't be snapshotted that way, so the script asks
+//! [`pack_files`] at completion time instead.
+
+use crate::gates::GateTable;
+use crate::packs;
+use crate::packs::orchestration::ExecutionContext;
+use crate::prompts::catalog;
+use crate::rules::should_skip_entry;
+use crate::Result;
+
+/// Dynamic completion candidates, each list sorted and de-duplicated.
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct CompletionValues {
+    /// Display names of active (non-ignored) packs.
+    pub packs: Vec<String>,
+    /// `[groups]` names from the root config.
+    pub groups: Vec<String>,
+    /// Built-in gate labels plus root `[gates]` entries, for `--only-os`.
+    pub gate_labels: Vec<String>,
+    /// Keys `dodot prompts reset` accepts.
+    pub prompt_keys: Vec<String>,
+}
+
+impl CompletionValues {
+    /// What a pack-selector argument (`up`, `down`, `status`) accepts:
+    /// pack names and group names.
+    pub fn pack_selectors(&self) -> Vec<String> {
+        let mut all: Vec<String> = self.packs.iter().chain(&self.groups).cloned().collect();
+        all.sort();
+        all.dedup();
+        all
+    }
+}
+
+/// Collect completion candidates for the repo behind `ctx`.
+pub fn values(ctx: &ExecutionContext) -> Result<CompletionValues> {
+    let root_config = ctx.config_manager.root_config()?;
+    let scanned = packs::scan_root(
+        ctx.fs.as_ref(),
+        ctx.paths.dotfiles_root(),
+        &root_config.pack,
+    )?;
+    let mut pack_names: Vec<String> = scanned.packs.into_iter().map(|p| p.display_name).collect();
+    pack_names.sort();
+    pack_names.dedup();
+
+    let mut groups: Vec<String> = root_config.groups.keys().cloned().collect();
+    groups.sort();
+
+    let mut gates = GateTable::with_builtins();
+    gates.merge_user(&root_config.gates)?;
+    let gate_labels = gates.labels().into_iter().map(str::to_string).collect();
+
+    let mut prompt_keys: Vec<String> = catalog::KNOWN_PROMPTS
+        .iter()
+        .map(|d| d.key.to_string())
+        .collect();
+    prompt_keys.sort();
+
+    Ok(CompletionValues {
+        packs: pack_names,
+        groups,
+        gate_labels,
+        prompt_keys,
+    })
+}
+
+/// Entries of `pack` whose pack-relative path starts with `prefix`,
+/// for completing a file argument. One directory level at a time,
+/// like path completion: `nvim/l` lists the `nvim/` entries starting
+/// with `l`, and directories end in `/` so the shell can descend.
+/// Hidden entries show only once the typed name starts with `.`. An
+/// unknown pack, or a prefix leaving the pack, yields nothing.
+pub fn pack_files(pack: &str, prefix: &str, ctx: &ExecutionContext) -> Result<Vec<String>> {
+    let root_config = ctx.config_manager.root_config()?;
+    let scanned = packs::scan_root(
+        ctx.fs.as_ref(),
+        ctx.paths.dotfiles_root(),
+        &root_config.pack,
+    )?;
+    let Some(pack) = scanned
+        .packs
+        .iter()
+        .find(|p| p.display_name == pack || p.name == pack)
+    else {
+        return Ok(Vec::new());
+    };
+    let (dir, partial) = prefix.rsplit_once('/').unwrap_or(("", prefix));
+    if dir.starts_with('/') || dir.split('/').any(|s| s == "..") {
+        return Ok(Vec::new());
+    }
+    let base = pack.path.join(dir);
+    if !ctx.fs.is_dir(&base) {
+        return Ok(Vec::new());
+    }
+    let mut out = Vec::new();
+    for entry in ctx.fs.read_dir(&base)? {
+        if !entry.name.starts_with(partial)
+            || (entry.name.starts_with('.') && !partial.starts_with('.'))
+            || should_skip_entry(&entry.name, &root_config.pack.ignore)
+        {
+            continue;
+        }
+        let rel = if dir.is_empty() {
+            entry.name
+        } else {
+            format!("{dir}/{}", entry.name)
+        };
+        out.push(if entry.is_dir { format!("{rel}/") } else { rel });
+    }
+    Ok(out)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::commands::tests::support::make_ctx;
+    use crate::fs::Fs;
+    use crate::testing::TempEnvironment;
+
+    #[test]
+    fn collects_packs_groups_and_labels() {
+        let env = TempEnvironment::builder()
+            .pack("vim")
+            .file("vimrc", "x")
+            .done()
+            .pack("020-git")
+            .file("gitconfig", "x")
+            .done()
+            .build();
+        env.fs
+            .write_file(
+                &env.dotfiles_root.join(".dodot.toml"),
+                b"[groups]\nvim = [\"git\"]\ndev = [\"vim\"]\n\n[gates.work]\nhostname = \"corp-mbp\"\n",
+            )
+            .unwrap();
+        let values = values(&make_ctx(&env)).unwrap();
+
+        assert_eq!(values.packs, ["git", "vim"]);
+        assert_eq!(values.groups, ["dev", "vim"]);
+        // A group named like a pack is offered once.
+        assert_eq!(values.pack_selectors(), ["dev", "git", "vim"]);
+        assert!(values.gate_labels.contains(&"darwin".to_string()));
+        assert!(values.gate_labels.contains(&"work".to_string()));
+        assert!(values
+            .prompt_keys
+            .contains(&"magic.install_ladder".to_string()));
+    }
+
+    #[test]
+    fn pack_files_complete_one_level_at_a_time() {
+        let env = TempEnvironment::builder()
+            .pack("010-nvim")
+            .file("init.lua", "x")
+            .file("lua/plugins.lua", "x")
+            .file("lua/lsp.lua", "x")
+            .file(".luarc.json", "{}")
+            .done()
+            .build();
+        let ctx = make_ctx(&env);
+        let files = |prefix| pack_files("nvim", prefix, &ctx).unwrap();
+
+        assert_eq!(files(""), ["init.lua", "lua/"]);
+        assert_eq!(files("lua/p"), ["lua/plugins.lua"]);
+        assert_eq!(files("."), [".luarc.json"]);
+        assert!(files("../").is_empty());
+        assert!(pack_files("nope", "", &ctx).unwrap().is_empty());
+    }
+}
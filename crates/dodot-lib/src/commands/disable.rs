@@ -0,0 +1,210 @@
+//! `disable` / `enable` — switch a pack off on this machine without
+//! forgetting it, and back on.
+//!
+//! Storage and semantics live in [`crate::packs::disabled`]. `disable`
+//! asks the configuration handlers for the same undo plan `down` runs,
+//! but only removes the user-visible links; the handlers' state moves
+//! aside instead of being cleared, and code-execution state is not
+//! touched. `enable` puts it all back without planning the pack again,
+//! so install scripts and `brew bundle` never re-run.
+
+use tracing::info;
+
+use crate::commands::down::{self, DownOptions};
+use crate::commands::probe::format_unix_ts;
+use crate::commands::MessageResult;
+use crate::handlers;
+use crate::handlers::undo::UndoAction;
+use crate::packs::disabled::{self, DisabledPack, RemovedLink};
+use crate::packs::orchestration::{self, ExecutionContext};
+use crate::{packs, DodotError, Result};
+
+/// List this machine's disabled packs (`dodot disable` with no pack).
+pub fn list(ctx: &ExecutionContext) -> Result<MessageResult> {
+    let (fs, paths) = (ctx.fs.as_ref(), ctx.paths.as_ref());
+    let mut details = Vec::new();
+    for dir in disabled::list(fs, paths)? {
+        if let Some(record) = disabled::load(fs, paths, &dir)? {
+            details.push(format!(
+                "{}  disabled {}",
+                packs::display_name_for(&dir),
+                format_unix_ts(record.disabled_at)
+            ));
+        }
+    }
+    let message = if details.is_empty() {
+        "No packs are disabled.".to_string()
+    } else {
+        format!(
+            "{} pack(s) disabled; `dodot enable <pack>` restores them.",
+            details.len()
+        )
+    };
+    Ok(MessageResult { message, details })
+}
+
+/// Disable `pack_names`: remove their links and shell state, keeping
+/// provisioning sentinels and a record for [`enable`].
+pub fn disable(pack_names: &[String], ctx: &ExecutionContext) -> Result<MessageResult> {
+    let names = orchestration::expand_pack_selectors(pack_names, ctx)?;
+    let mut details = orchestration::validate_pack_names(&names, ctx)?;
+    let root_config = ctx.config_manager.root_config()?;
+    let mut all_packs = packs::discover_root(
+        ctx.fs.as_ref(),
+        ctx.paths.dotfiles_root(),
+        &root_config.pack,
+    )?;
+    all_packs.retain(|p| names.iter().any(|n| n == &p.display_name || n == &p.name));
+
+    let config_handlers = handlers::configuration_handler_names(ctx.fs.as_ref());
+    let registry = handlers::create_registry(ctx.fs.as_ref(), ctx.command_runner.as_ref());
+    let (fs, paths) = (ctx.fs.as_ref(), ctx.paths.as_ref());
+    let mut count = 0;
+    for pack in &all_packs {
+        if disabled::is_disabled(fs, paths, &pack.name) {
+            details.push(format!("{}: already disabled", pack.display_name));
+            continue;
+        }
+        let handlers: Vec<String> = ctx
+            .datastore
+            .list_pack_handlers(&pack.name)?
+            .into_iter()
+            .filter(|h| config_handlers.contains(h))
+            .collect();
+        if handlers.is_empty() {
+            details.push(format!(
+                "{}: nothing deployed to disable",
+                pack.display_name
+            ));
+            continue;
+        }
+
+        info!(pack = %pack.display_name, handlers = ?handlers, "disabling pack");
+        let undo = down::plan_undo(pack, &handlers, &registry, DownOptions::default(), ctx)?;
+        let mut record = DisabledPack::new(crate::datastore::sentinel::unix_now());
+        for (handler, steps) in &undo {
+            for step in steps {
+                if let UndoAction::RemoveUserLink { path } = step {
+                    record.links.push(RemovedLink {
+                        path: path.clone(),
+                        target: fs.readlink(path)?,
+                    });
+                }
+            }
+            record.handlers.push(handler.clone());
+        }
+        count += 1;
+        details.push(format!(
+            "{}: {} link(s) removed; {} state set aside",
+            pack.display_name,
+            record.links.len(),
+            record.handlers.join(", ")
+        ));
+        if ctx.dry_run {
+            continue;
+        }
+
+        // Record first: an interrupted disable is finished by `enable`
+        // (which skips what is already back in place) or by `down`.
+        disabled::save(fs, paths, &pack.name, &record)?;
+        for link in &record.links {
+            fs.remove_file(&link.path)?;
+        }
+        for handler in &record.handlers {
+            disabled::stash(fs, paths, &pack.name, handler)?;
+        }
+    }
+
+    if count > 0 && !ctx.dry_run {
+        ctx.datastore.reindex()?;
+        down::write_generated(&root_config, ctx)?;
+    }
+    let message = match (count, ctx.dry_run) {
+        (0, _) => "Nothing to disable.".to_string(),
+        (n, true) => format!("Would disable {n} pack(s)."),
+        (n, false) => format!(
+            "Disabled {n} pack(s). Provisioning state is kept; `dodot enable <pack>` restores them."
+        ),
+    };
+    Ok(MessageResult { message, details })
+}
+
+/// Enable `pack_names`: restore what [`disable`] set aside and recreate
+/// the links it removed. Nothing is planned or run.
+pub fn enable(pack_names: &[String], ctx: &ExecutionContext) -> Result<MessageResult> {
+    let names = orchestration::expand_pack_selectors(pack_names, ctx)?;
+    let (fs, paths) = (ctx.fs.as_ref(), ctx.paths.as_ref());
+    let mut details = Vec::new();
+    let mut count = 0;
+    for name in &names {
+        let pack_dir = orchestration::resolve_pack_dir_name(name, ctx)?;
+        let display = packs::display_name_for(&pack_dir);
+        let Some(record) = disabled::load(fs, paths, &pack_dir)? else {
+            details.push(format!("{display}: not disabled"));
+            continue;
+        };
+
+        for handler in &record.handlers {
+            let stashed = disabled::stashed_handler_dir(paths, &pack_dir, handler);
+            if fs.exists(&stashed) && fs.exists(&paths.handler_data_dir(&pack_dir, handler)) {
+                return Err(DodotError::Other(format!(
+                    "pack '{display}' has {handler} state both deployed and set aside; \
+                     run `dodot down {display}` and `dodot up {display}` to start over"
+                )));
+            }
+        }
+
+        info!(pack = %display, handlers = ?record.handlers, "enabling pack");
+        count += 1;
+        // State first, so the recreated links resolve the moment
+        // they exist.
+        if !ctx.dry_run {
+            for handler in &record.handlers {
+                if fs.exists(&disabled::stashed_handler_dir(paths, &pack_dir, handler)) {
+                    disabled::restore(fs, paths, &pack_dir, handler)?;
+                }
+            }
+        }
+        let mut restored = 0;
+        let mut left_alone = Vec::new();
+        for link in &record.links {
+            if fs.is_symlink(&link.path) && fs.readlink(&link.path)? == link.target {
+                continue;
+            }
+            if fs.is_symlink(&link.path) || fs.exists(&link.path) {
+                left_alone.push(link.path.display().to_string());
+                continue;
+            }
+            restored += 1;
+            if !ctx.dry_run {
+                if let Some(parent) = link.path.parent() {
+                    fs.mkdir_all(parent)?;
+                }
+                fs.symlink(&link.target, &link.path)?;
+            }
+        }
+        details.push(format!(
+            "{display}: {restored} link(s) restored; {} state back in place",
+            record.handlers.join(", ")
+        ));
+        details.extend(
+            left_alone
+                .into_iter()
+                .map(|path| format!("  {path} exists, left alone")),
+        );
+        if !ctx.dry_run {
+            disabled::discard(fs, paths, &pack_dir)?;
+        }
+    }
+
+    if count > 0 && !ctx.dry_run {
+        ctx.datastore.reindex()?;
+        down::write_generated(&ctx.config_manager.root_config()?, ctx)?;
+    }
+    let message = match (count, ctx.dry_run) {
+        (0, _) => "Nothing to enable.".to_string(),
+        (n, true) => format!("Would enable {n} pack(s)."),
+        (n, false) => format!("Enabled {n} pack(s)."),
+    };
+    Ok(MessageResult { message, details })
+}
@@ -0,0 +1,52 @@
+//! `doctor` — check that this machine's dodot setup works.
+//!
+//! `dodot doctor --shell` runs the shell-integration checks the init
+//! script makes at every shell start ([`crate::shell::health`]), plus
+//! the ones a running script can't make about itself, and lists every
+//! problem rather than the first.
+
+use serde::Serialize;
+
+use crate::packs::orchestration::ExecutionContext;
+use crate::shell::health::{self, HealthIssue};
+use crate::Result;
+
+/// `dodot doctor`. `message` / `details` feed the `message` template.
+#[derive(Debug, Clone, Serialize)]
+pub struct DoctorResult {
+    pub message: String,
+    pub details: Vec<String>,
+    pub issues: Vec<HealthIssue>,
+}
+
+impl DoctorResult {
+    /// 0 when healthy, 2 when a check failed — 1 stays reserved for
+    /// dodot itself failing, as with `status --check`.
+    pub fn exit_code(&self) -> i32 {
+        if self.issues.is_empty() {
+            0
+        } else {
+            2
+        }
+    }
+}
+
+/// Run the shell-integration checks.
+pub fn shell(ctx: &ExecutionContext) -> Result<DoctorResult> {
+    let issues = health::check(ctx.fs.as_ref(), ctx.paths.as_ref())?;
+    let message = if issues.is_empty() {
+        "Shell integration looks healthy.".to_string()
+    } else {
+        format!(
+            "{} shell-integration problem(s). Run `{}` to fix.",
+            issues.len(),
+            health::FIX
+        )
+    };
+    let details = issues.iter().map(|i| format!("  {}", i.problem)).collect();
+    Ok(DoctorResult {
+        message,
+        details,
+        issues,
+    })
+}
@@ -8,19 +8,53 @@
 //! line.
 //!
 //! Dry-run keeps the per-handler "would remove" rendering.
+//!
+//! What gets undone is up to each handler: `down` asks it for
+//! [`UndoAction`]s (see [`crate::handlers::undo`]) against a passive
+//! plan of the pack and runs them in order. Commands that reverse
+//! provisioning only run with [`DownOptions::deprovision`].
 
 use tracing::{debug, info};
 
-use crate::commands::{handler_symbol, status, DisplayFile, DisplayPack, PackStatusResult};
-use crate::handlers::HANDLER_SYMLINK;
+use crate::commands::{
+    handler_symbol, phase_sections, status, summary_line, DisplayFile, DisplayPack,
+    PackStatusResult,
+};
+use crate::config::DodotConfig;
+use crate::handlers::undo::{UndoAction, UndoContext};
+use crate::handlers::{self, HANDLER_SYMLINK};
+use crate::operations::HandlerIntent;
 use crate::packs;
+use crate::packs::disabled;
 use crate::packs::orchestration::{self, ExecutionContext};
 use crate::probe;
 use crate::shell;
 use crate::Result;
 
+/// Options beyond the shared [`ExecutionContext`] flags.
+#[derive(Debug, Clone, Copy, Default)]
+pub struct DownOptions {
+    /// Also run the handlers' provisioning reversals
+    /// (`brew uninstall` of a pack's Brewfile entries).
+    pub deprovision: bool,
+}
+
 /// Run the `down` command: remove all state for specified (or all) packs.
 pub fn down(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<PackStatusResult> {
+    down_with(pack_filter, DownOptions::default(), ctx)
+}
+
+/// [`down`] with explicit [`DownOptions`].
+pub fn down_with(
+    pack_filter: Option<&[String]>,
+    options: DownOptions,
+    ctx: &ExecutionContext,
+) -> Result<PackStatusResult> {
+    let started = std::time::Instant::now();
+    let expanded = pack_filter
+        .map(|names| orchestration::expand_pack_selectors(names, ctx))
+        .transpose()?;
+    let pack_filter = expanded.as_deref();
     info!(dry_run = ctx.dry_run, "starting down command");
 
     // Validate pack names before doing anything
@@ -30,10 +64,10 @@ pub fn down(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<Pa
     }
 
     let root_config = ctx.config_manager.root_config()?;
-    let mut all_packs = packs::discover_packs(
+    let mut all_packs = packs::discover_root(
         ctx.fs.as_ref(),
         ctx.paths.dotfiles_root(),
-        &root_config.pack.ignore,
+        &root_config.pack,
     )?;
     info!(count = all_packs.len(), "discovered packs");
 
@@ -49,14 +83,19 @@ pub fn down(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<Pa
     let mut affected_packs = Vec::new();
     let mut dry_run_display: Vec<DisplayPack> = Vec::new();
     let mut any_removed = false;
+    let mut actions: Vec<String> = Vec::new();
+    let registry = handlers::create_registry(ctx.fs.as_ref(), ctx.command_runner.as_ref());
 
     for pack in &all_packs {
         // Datastore is keyed by the on-disk directory name, not the
         // display name — the directory `010-nvim` keeps its `010-nvim/`
         // subtree in the datastore.
         let handlers = ctx.datastore.list_pack_handlers(&pack.name)?;
+        // A disabled pack's configuration state is set aside, not in
+        // the datastore; `down` forgets it along with the rest.
+        let was_disabled = disabled::is_disabled(ctx.fs.as_ref(), ctx.paths.as_ref(), &pack.name);
 
-        if handlers.is_empty() {
+        if handlers.is_empty() && !was_disabled {
             debug!(pack = %pack.display_name, "already down, skipping");
             continue;
         }
@@ -65,11 +104,31 @@ pub fn down(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<Pa
         any_removed = true;
         affected_packs.push(pack.display_name.clone());
 
+        let undo = plan_undo(pack, &handlers, &registry, options, ctx)?;
         if ctx.dry_run {
-            dry_run_display.push(build_dry_run_display(pack, &handlers, ctx)?);
+            dry_run_display.push(build_dry_run_display(pack, &handlers, &undo, ctx)?);
         } else {
-            for handler in &handlers {
-                ctx.datastore.remove_state(&pack.name, handler)?;
+            for (handler, steps) in &undo {
+                for step in steps {
+                    match step {
+                        UndoAction::RemoveUserLink { path } => ctx.fs.remove_file(path)?,
+                        UndoAction::RunCommand {
+                            executable,
+                            arguments,
+                        } => {
+                            ctx.command_runner.run(executable, arguments)?;
+                        }
+                        UndoAction::ClearState => {
+                            ctx.datastore.remove_state(&pack.name, handler)?
+                        }
+                    }
+                    if ctx.render_verbosity.is_verbose() {
+                        actions.push(format!("{}: {}", pack.display_name, step.describe(handler)));
+                    }
+                }
+            }
+            if was_disabled {
+                disabled::discard(ctx.fs.as_ref(), ctx.paths.as_ref(), &pack.name)?;
             }
         }
     }
@@ -92,14 +151,7 @@ pub fn down(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<Pa
     // Regenerate shell init script and deployment map (now reflecting
     // the removed state).
     if !ctx.dry_run {
-        info!("regenerating shell init script");
-        shell::write_init_script(
-            ctx.fs.as_ref(),
-            ctx.paths.as_ref(),
-            root_config.profiling.enabled,
-        )?;
-        info!("writing deployment map");
-        probe::write_deployment_map(ctx.fs.as_ref(), ctx.paths.as_ref())?;
+        write_generated(&root_config, ctx)?;
     }
 
     let display_packs = if ctx.dry_run {
@@ -116,6 +168,9 @@ pub fn down(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<Pa
         "Nothing to deactivate."
     };
 
+    let table = ctx.view_mode.table_for(&display_packs);
+    let summary = summary_line(&display_packs);
+    let phases = phase_sections(&display_packs, true, ctx.dry_run, ctx.fs.as_ref());
     Ok(PackStatusResult {
         message: Some(message.into()),
         dry_run: ctx.dry_run,
@@ -125,21 +180,129 @@ pub fn down(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<Pa
         conflicts: Vec::new(),
         ignored_packs: ignored.display_names,
         inactive_packs: Vec::new(),
+        role_inactive_packs: Vec::new(),
         view_mode: ctx.view_mode.as_str().into(),
         group_mode: ctx.group_mode.as_str().into(),
         diffs: Vec::new(),
+        table,
+        report: None,
+        verbosity: ctx.render_verbosity.as_str().into(),
+        summary,
+        actions,
+        elapsed: ctx.render_verbosity.elapsed_since(started),
+        phases,
+        estimate: None,
+        estimate_lines: Vec::new(),
+        exit_code: if any_removed {
+            crate::ExitCode::Success
+        } else {
+            crate::ExitCode::NothingToDo
+        },
     })
 }
 
+/// Rewrite everything dodot derives from the datastore — shell init,
+/// PATH exports, git includes, the deployment map — after state was
+/// removed. Shared with `disable` / `enable`.
+pub(crate) fn write_generated(root_config: &DodotConfig, ctx: &ExecutionContext) -> Result<()> {
+    info!("regenerating shell init script");
+    let path_priorities = orchestration::path_priorities(ctx)?;
+    shell::write_init_script(
+        ctx.fs.as_ref(),
+        ctx.paths.as_ref(),
+        root_config.profiling.enabled,
+        &path_priorities,
+    )?;
+    shell::write_path_exports(
+        ctx.fs.as_ref(),
+        ctx.paths.as_ref(),
+        &path_priorities,
+        root_config.path.shims,
+    )?;
+    info!("updating git config includes");
+    handlers::gitconfig::write_includes(ctx.fs.as_ref(), ctx.paths.as_ref())?;
+    info!("writing deployment map");
+    probe::write_deployment_map(ctx.fs.as_ref(), ctx.paths.as_ref())
+}
+
+/// Ask each handler with state how to undo itself for `pack`.
+///
+/// Handlers see a passive plan of the pack (no templates rendered, no
+/// files written). If planning fails — a pack broken since it was
+/// deployed — they get no intents and fall back to clearing state, so
+/// `down` still works on exactly the packs that most need it. State
+/// dirs with no registered handler are cleared.
+pub(crate) fn plan_undo(
+    pack: &packs::Pack,
+    handlers: &[String],
+    registry: &std::collections::HashMap<String, Box<dyn handlers::Handler + '_>>,
+    options: DownOptions,
+    ctx: &ExecutionContext,
+) -> Result<Vec<(String, Vec<UndoAction>)>> {
+    let intents: Vec<HandlerIntent> = match orchestration::plan_pack(
+        pack,
+        ctx,
+        crate::preprocessing::PreprocessMode::Passive,
+    ) {
+        Ok(plan) => plan.intents,
+        Err(e) => {
+            debug!(pack = %pack.display_name, error = %e, "undo planning failed; clearing state only");
+            Vec::new()
+        }
+    };
+
+    let mut out = Vec::with_capacity(handlers.len());
+    for handler in handlers {
+        let Some(h) = registry.get(handler) else {
+            out.push((handler.clone(), vec![UndoAction::ClearState]));
+            continue;
+        };
+        let handler_intents: Vec<HandlerIntent> = intents
+            .iter()
+            .filter(|i| i.handler() == handler)
+            .cloned()
+            .collect();
+        let handler_dir = ctx.paths.handler_data_dir(&pack.name, handler);
+        let cx = UndoContext {
+            pack: &pack.name,
+            pack_path: &pack.path,
+            handler_dir: &handler_dir,
+            intents: &handler_intents,
+            deprovision: options.deprovision,
+            fs: ctx.fs.as_ref(),
+        };
+        out.push((handler.clone(), h.undo_actions(&cx)?));
+    }
+    Ok(out)
+}
+
 /// Build the per-pack dry-run display: lists what would be removed,
 /// per-handler. For symlink handlers we list individual data-link entries
 /// since the user usually wants to know which files would be affected.
+/// Provisioning reversals (`--deprovision`) get one row per command.
 fn build_dry_run_display(
     pack: &packs::Pack,
     handlers: &[String],
+    undo: &[(String, Vec<UndoAction>)],
     ctx: &ExecutionContext,
 ) -> Result<DisplayPack> {
     let mut files = Vec::new();
+    for (handler, steps) in undo {
+        for step in steps {
+            if let UndoAction::RunCommand { .. } = step {
+                files.push(DisplayFile {
+                    name: step.describe(handler),
+                    symbol: handler_symbol(handler).into(),
+                    description: "would undo provisioning".into(),
+                    status: "pending".into(),
+                    status_label: "[dry-run] would run".into(),
+                    handler: handler.clone(),
+                    note_ref: None,
+                    last_run: None,
+                });
+            }
+        }
+    }
     for handler in handlers {
         if handler == HANDLER_SYMLINK {
             let handler_dir = ctx.paths.handler_data_dir(&pack.name, handler);
@@ -153,6 +316,7 @@ fn build_dry_run_display(
                     status_label: "[dry-run] would remove".into(),
                     handler: handler.clone(),
                     note_ref: None,
+                    last_run: None,
                 });
             }
         } else {
@@ -164,6 +328,7 @@ fn build_dry_run_display(
                 status_label: "[dry-run] would remove".into(),
                 handler: handler.clone(),
                 note_ref: None,
+                last_run: None,
             });
         }
     }
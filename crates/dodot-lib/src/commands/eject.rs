@@ -0,0 +1,196 @@
+//! `eject` command — the reverse of `adopt`.
+//!
+//! ```text
+//! dodot eject <pack> <file>          # real file at the target, source removed
+//! dodot eject <pack> <file> --keep   # same, but the pack keeps its copy
+//! ```
+//!
+//! `<file>` is the path inside the pack (`vimrc`, `_home/.ssh/config`)
+//! or the deployed path (`~/.vimrc`). The deployed symlink is replaced
+//! by a real copy of the source — a copy to a temp sibling renamed over
+//! the link, so the target is never missing — and the pack's datastore
+//! entry for the file goes away. Only then is the source removed.
+//!
+//! Copy-mode targets are already real files and are left as they are;
+//! hard links are broken into independent copies.
+//!
+//! With `--keep` the source stays in the pack, so the next `dodot up`
+//! finds a real file where it would link and reports a conflict — add
+//! the file to `[pack] ignore` to stop managing it for good.
+
+use std::path::Path;
+
+use crate::commands::MessageResult;
+use crate::copies;
+use crate::fs::Fs;
+use crate::operations::{HandlerIntent, LinkMode};
+use crate::packs::orchestration::{self, ExecutionContext};
+use crate::paths::expand_tilde;
+use crate::preprocessing::PreprocessMode;
+use crate::{DodotError, Result};
+
+/// Eject `file` from `pack_name`.
+pub fn eject(
+    pack_name: &str,
+    file: &str,
+    keep: bool,
+    ctx: &ExecutionContext,
+) -> Result<MessageResult> {
+    let fs = ctx.fs.as_ref();
+    let pack_dir = orchestration::resolve_pack_dir_name(pack_name, ctx)?;
+    let pack = orchestration::prepare_packs(Some(std::slice::from_ref(&pack_dir)), ctx)?
+        .into_iter()
+        .next()
+        .ok_or_else(|| DodotError::PackNotFound {
+            name: pack_name.to_string(),
+        })?;
+
+    let deployed = expand_tilde(file, ctx.paths.home_dir());
+    let in_pack = pack.path.join(file);
+    let plan = orchestration::plan_pack(&pack, ctx, PreprocessMode::Passive)?;
+    let Some((handler, source, user_path, mode)) =
+        plan.intents.into_iter().find_map(|intent| match intent {
+            HandlerIntent::Link {
+                handler,
+                source,
+                user_path,
+                mode,
+                ..
+            } if source == in_pack || user_path == deployed => {
+                Some((handler, source, user_path, mode))
+            }
+            _ => None,
+        })
+    else {
+        return Err(DodotError::Other(format!(
+            "pack '{}' doesn't link `{file}` anywhere; `dodot status {}` lists what it deploys",
+            pack.display_name, pack.display_name
+        )));
+    };
+    if !source.starts_with(&pack.path) {
+        return Err(DodotError::Other(format!(
+            "`{file}` is generated from a template; eject the deployed file by hand and remove its source from '{}'",
+            pack.display_name
+        )));
+    }
+
+    let is_link = fs.is_symlink(&user_path);
+    if !is_link && !fs.exists(&user_path) {
+        return Err(DodotError::Other(format!(
+            "{} isn't deployed; run `dodot up {}` first, or take the file out of the pack by hand",
+            user_path.display(),
+            pack.display_name
+        )));
+    }
+    if is_link && mode == LinkMode::Symlink && !links_to(fs, &user_path, &source) {
+        return Err(DodotError::Other(format!(
+            "{} is a symlink dodot didn't create; leaving it alone",
+            user_path.display()
+        )));
+    }
+
+    let mut details = Vec::new();
+    if ctx.dry_run {
+        details.push(format!(
+            "would copy {} to {}",
+            source.display(),
+            user_path.display()
+        ));
+        if !keep {
+            details.push(format!("would remove {}", source.display()));
+        }
+        return Ok(MessageResult {
+            message: format!("[dry-run] would eject {}.", user_path.display()),
+            details,
+        });
+    }
+
+    if is_link || mode == LinkMode::Hardlink {
+        replace_with_copy(fs, &source, &user_path)?;
+    }
+    forget(ctx, &pack.name, &handler, &source, &user_path)?;
+
+    if keep {
+        details.push(format!(
+            "{} stays in the pack; the next `dodot up` will report a conflict for it unless it's added to `[pack] ignore`.",
+            source.display()
+        ));
+    } else if fs.is_dir(&source) {
+        fs.remove_dir_all(&source)?;
+    } else {
+        fs.remove_file(&source)?;
+    }
+    Ok(MessageResult {
+        message: format!(
+            "Ejected {} from '{}'; it is a regular file now.",
+            user_path.display(),
+            pack.display_name
+        ),
+        details,
+    })
+}
+
+/// Whether following `link` ends at `source` (through the data link).
+fn links_to(fs: &dyn Fs, link: &Path, source: &Path) -> bool {
+    let Ok(hop) = fs.readlink(link) else {
+        return false;
+    };
+    hop == source || fs.readlink(&hop).is_ok_and(|target| target == source)
+}
+
+/// Copy `source` next to `user_path`, then move it into place. Files
+/// are renamed over the old link atomically; a directory can't replace
+/// anything in one rename, so the old target goes first.
+fn replace_with_copy(fs: &dyn Fs, source: &Path, user_path: &Path) -> Result<()> {
+    let parent = user_path.parent().unwrap_or(Path::new("."));
+    let name = user_path
+        .file_name()
+        .map(|n| n.to_string_lossy().into_owned())
+        .unwrap_or_default();
+    let tmp = parent.join(format!(".dodot-eject-{name}"));
+    if fs.exists(&tmp) {
+        fs.remove_dir_all(&tmp).or_else(|_| fs.remove_file(&tmp))?;
+    }
+    if let Err(e) = copies::materialize(fs, source, &tmp, LinkMode::Copy) {
+        let _ = fs.remove_dir_all(&tmp).or_else(|_| fs.remove_file(&tmp));
+        return Err(e);
+    }
+    if fs.is_dir(&tmp) {
+        if fs.is_symlink(user_path) {
+            fs.remove_file(user_path)?;
+        } else {
+            fs.remove_dir_all(user_path)?;
+        }
+    }
+    fs.rename(&tmp, user_path)
+}
+
+/// Drop the datastore's knowledge of one linked file: its data link,
+/// its copy record, and the handler directory once nothing is left.
+fn forget(
+    ctx: &ExecutionContext,
+    pack: &str,
+    handler: &str,
+    source: &Path,
+    user_path: &Path,
+) -> Result<()> {
+    let fs = ctx.fs.as_ref();
+    let handler_dir = ctx.paths.handler_data_dir(pack, handler);
+    if fs.is_dir(&handler_dir) {
+        for entry in fs.read_dir(&handler_dir)? {
+            if entry.is_symlink && fs.readlink(&entry.path)? == source {
+                fs.remove_file(&entry.path)?;
+            }
+        }
+        if fs.read_dir(&handler_dir)?.is_empty() {
+            ctx.datastore.remove_state(pack, handler)?;
+        } else {
+            ctx.datastore.reindex()?;
+        }
+    }
+    let record = copies::record_path(ctx.paths.as_ref(), pack, user_path);
+    if fs.exists(&record) {
+        fs.remove_file(&record)?;
+    }
+    Ok(())
+}
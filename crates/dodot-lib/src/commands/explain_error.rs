@@ -0,0 +1,53 @@
+//! `dodot explain-error [CODE]` — print an error-catalog entry.
+//!
+//! Reads [`crate::error::catalog`]; needs no repo or context, so it
+//! works from anywhere, including right after a failure outside the
+//! dotfiles root. Without a code it lists every known code.
+
+use crate::commands::MessageResult;
+use crate::error::catalog::{self, KNOWN_ERRORS};
+use crate::{DodotError, Result};
+
+/// Explain `code`, or list the catalog when `code` is `None`.
+pub fn explain_error(code: Option<&str>) -> Result<MessageResult> {
+    let Some(code) = code else {
+        return Ok(MessageResult {
+            message: format!("{} error codes:", KNOWN_ERRORS.len()),
+            details: KNOWN_ERRORS
+                .iter()
+                .map(|d| format!("{:<8} {}", d.code, d.title))
+                .collect(),
+        });
+    };
+    let d = catalog::lookup(code).ok_or_else(|| {
+        DodotError::Other(format!(
+            "unknown error code {code:?}; run `dodot explain-error` to list them"
+        ))
+    })?;
+
+    let mut details = vec![d.explanation.to_string(), String::new()];
+    details.push("What to do next:".into());
+    details.extend(d.remediation.iter().map(|step| format!("  - {step}")));
+    Ok(MessageResult {
+        message: format!("{}: {}", d.code, d.title),
+        details,
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn explains_a_code_and_lists_the_catalog() {
+        let r = explain_error(Some("link004")).unwrap();
+        assert_eq!(r.message, "LINK004: cross-pack conflict");
+        assert!(r.details.iter().any(|l| l == "What to do next:"));
+
+        let all = explain_error(None).unwrap();
+        assert_eq!(all.details.len(), KNOWN_ERRORS.len());
+
+        let err = explain_error(Some("NOPE999")).unwrap_err().to_string();
+        assert!(err.contains("unknown error code"), "{err}");
+    }
+}
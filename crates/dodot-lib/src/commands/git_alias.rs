@@ -24,8 +24,9 @@
 //! interactive use gets the magic.
 
 use serde::Serialize;
-use std::path::PathBuf;
+use std::path::{Path, PathBuf};
 
+use crate::fs::Fs;
 use crate::packs::orchestration::ExecutionContext;
 use crate::{DodotError, Result};
 
@@ -46,17 +47,18 @@ pub(crate) const ALIAS_GUARD_END: &str = "# <<< dodot git alias <<<";
 pub enum Shell {
     Bash,
     Zsh,
+    Fish,
 }
 
 impl Shell {
     /// Detect from `$SHELL`. Returns `None` when `$SHELL` is unset
     /// or names a shell we don't support — the caller (typically
     /// [`resolve_shell`]) surfaces a clear error rather than
-    /// silently writing a bashrc snippet for a fish/nu user.
+    /// silently writing a bashrc snippet for a nu user.
     ///
     /// Why fail explicitly: silently falling back to `Bash` means
     /// `dodot git-install-alias` happily writes `~/.bashrc` for a
-    /// fish user, who then never sees the alias take effect.
+    /// nu user, who then never sees the alias take effect.
     /// Better to refuse with a message that points at `--shell`.
     pub fn detect() -> Option<Self> {
         std::env::var("SHELL").ok().and_then(|s| {
@@ -64,6 +66,8 @@ impl Shell {
                 Some(Shell::Zsh)
             } else if s.ends_with("/bash") || s == "bash" {
                 Some(Shell::Bash)
+            } else if s.ends_with("/fish") || s == "fish" {
+                Some(Shell::Fish)
             } else {
                 None
             }
@@ -76,6 +80,7 @@ impl Shell {
         match s.to_ascii_lowercase().as_str() {
             "bash" => Some(Shell::Bash),
             "zsh" => Some(Shell::Zsh),
+            "fish" => Some(Shell::Fish),
             _ => None,
         }
     }
@@ -83,23 +88,23 @@ impl Shell {
     /// Path to the rc file we write to for this shell, relative to
     /// `$HOME`. Used by [`install_alias`] to compute the absolute
     /// path. We pick the most universally-sourced file: `.bashrc`
-    /// on bash, `.zshrc` on zsh. Users with non-standard setups can
-    /// run `git-show-alias` and paste manually.
+    /// on bash, `.zshrc` on zsh, `config.fish` on fish. Users with
+    /// non-standard setups can run `git-show-alias` and paste manually.
     pub fn rc_relative_path(self) -> &'static str {
         match self {
             Shell::Bash => ".bashrc",
             Shell::Zsh => ".zshrc",
+            Shell::Fish => ".config/fish/config.fish",
         }
     }
 
-    /// The alias line for this shell. Both bash and zsh accept the
-    /// same `alias` syntax; we pin them per-shell anyway because
-    /// future shells (fish, nu) will need different forms and
-    /// keeping the dispatch on a single match is the cleanest
-    /// extension point.
+    /// The alias line for this shell. Bash and zsh share the same
+    /// `alias` syntax; fish has no `&&` in older releases and takes
+    /// the alias body as a separate argument.
     pub fn alias_line(self) -> &'static str {
         match self {
             Shell::Bash | Shell::Zsh => "alias git='dodot refresh --quiet && command git'",
+            Shell::Fish => "alias git 'dodot refresh --quiet; and command git'",
         }
     }
 }
@@ -201,42 +206,13 @@ pub fn install_alias(ctx: &ExecutionContext, shell: Shell) -> Result<InstallAlia
     let rc_path = ctx.paths.home_dir().join(shell.rc_relative_path());
     let block = managed_block(shell);
 
-    let outcome = if ctx.fs.exists(&rc_path) {
-        let existing = ctx.fs.read_to_string(&rc_path)?;
-        if let Some((start_byte, end_byte)) = find_managed_block(&existing) {
-            let current_block = &existing[start_byte..end_byte];
-            if current_block == block {
-                InstallAliasOutcome::AlreadyInstalled
-            } else {
-                let mut new_content = String::with_capacity(existing.len() + block.len());
-                new_content.push_str(&existing[..start_byte]);
-                new_content.push_str(&block);
-                new_content.push_str(&existing[end_byte..]);
-                ctx.fs.write_file(&rc_path, new_content.as_bytes())?;
-                InstallAliasOutcome::Updated
-            }
-        } else {
-            // Append, preserving existing rc content. Add a leading
-            // blank line so the block is visually separate from
-            // whatever the user has above.
-            let mut new_content = existing.clone();
-            if !new_content.ends_with('\n') {
-                new_content.push('\n');
-            }
-            if !new_content.ends_with("\n\n") {
-                new_content.push('\n');
-            }
-            new_content.push_str(&block);
-            ctx.fs.write_file(&rc_path, new_content.as_bytes())?;
-            InstallAliasOutcome::Appended
-        }
-    } else {
-        // Create the rc file with just our block. Most users will
-        // already have one; this branch covers the rare empty-home
-        // setup or a truly fresh shell install.
-        ctx.fs.write_file(&rc_path, block.as_bytes())?;
-        InstallAliasOutcome::Created
-    };
+    let outcome = upsert_guarded_block(
+        ctx.fs.as_ref(),
+        &rc_path,
+        &block,
+        ALIAS_GUARD_START,
+        ALIAS_GUARD_END,
+    )?;
 
     Ok(InstallAliasResult {
         shell,
@@ -252,7 +228,7 @@ pub fn install_alias(ctx: &ExecutionContext, shell: Shell) -> Result<InstallAlia
 
 // ── helpers ─────────────────────────────────────────────────────
 
-fn render_home_relative(p: &std::path::Path, home: &std::path::Path) -> String {
+pub(crate) fn render_home_relative(p: &std::path::Path, home: &std::path::Path) -> String {
     if let Ok(rel) = p.strip_prefix(home) {
         format!("~/{}", rel.display())
     } else {
@@ -266,11 +242,19 @@ fn render_home_relative(p: &std::path::Path, home: &std::path::Path) -> String {
 /// inclusive byte range (with the trailing newline if any). Returns
 /// `None` if either guard is missing.
 fn find_managed_block(text: &str) -> Option<(usize, usize)> {
-    let start = text.find(ALIAS_GUARD_START)?;
-    let after_start = start + ALIAS_GUARD_START.len();
-    let end_rel = text[after_start..].find(ALIAS_GUARD_END)?;
+    find_guarded_block(text, ALIAS_GUARD_START, ALIAS_GUARD_END)
+}
+
+pub(crate) fn find_guarded_block(
+    text: &str,
+    guard_start: &str,
+    guard_end: &str,
+) -> Option<(usize, usize)> {
+    let start = text.find(guard_start)?;
+    let after_start = start + guard_start.len();
+    let end_rel = text[after_start..].find(guard_end)?;
     let end_guard_start = after_start + end_rel;
-    let end_byte = end_guard_start + ALIAS_GUARD_END.len();
+    let end_byte = end_guard_start + guard_end.len();
     let end_byte = if text.as_bytes().get(end_byte) == Some(&b'\n') {
         end_byte + 1
     } else {
@@ -279,20 +263,72 @@ fn find_managed_block(text: &str) -> Option<(usize, usize)> {
     Some((start, end_byte))
 }
 
+/// Write `block` (which opens with `guard_start` and closes with
+/// `guard_end`) into the rc file at `rc_path`: create the file, append
+/// to it, replace an older copy of the block in place, or leave a
+/// current one alone. Content outside the guards is never touched.
+/// Shared by every installer that manages a block in a shell rc file.
+pub(crate) fn upsert_guarded_block(
+    fs: &dyn Fs,
+    rc_path: &Path,
+    block: &str,
+    guard_start: &str,
+    guard_end: &str,
+) -> Result<InstallAliasOutcome> {
+    if !fs.exists(rc_path) {
+        // Create the rc file with just our block. Most users will
+        // already have one; this branch covers the rare empty-home
+        // setup or a truly fresh shell install (fish keeps its rc
+        // under ~/.config/fish, which may not exist yet).
+        if let Some(parent) = rc_path.parent() {
+            fs.mkdir_all(parent)?;
+        }
+        fs.write_file(rc_path, block.as_bytes())?;
+        return Ok(InstallAliasOutcome::Created);
+    }
+
+    let existing = fs.read_to_string(rc_path)?;
+    if let Some((start_byte, end_byte)) = find_guarded_block(&existing, guard_start, guard_end) {
+        if &existing[start_byte..end_byte] == block {
+            return Ok(InstallAliasOutcome::AlreadyInstalled);
+        }
+        let mut new_content = String::with_capacity(existing.len() + block.len());
+        new_content.push_str(&existing[..start_byte]);
+        new_content.push_str(block);
+        new_content.push_str(&existing[end_byte..]);
+        fs.write_file(rc_path, new_content.as_bytes())?;
+        return Ok(InstallAliasOutcome::Updated);
+    }
+
+    // Append, preserving existing rc content. Add a leading blank
+    // line so the block is visually separate from whatever the user
+    // has above.
+    let mut new_content = existing;
+    if !new_content.ends_with('\n') {
+        new_content.push('\n');
+    }
+    if !new_content.ends_with("\n\n") {
+        new_content.push('\n');
+    }
+    new_content.push_str(block);
+    fs.write_file(rc_path, new_content.as_bytes())?;
+    Ok(InstallAliasOutcome::Appended)
+}
+
 /// Diagnostic helper for the CLI: detect or validate a shell from
 /// the `--shell` CLI value, surfacing a clear error for unknown
 /// shells. Returns the resolved [`Shell`] or a `DodotError::Other`.
 ///
 /// When `explicit` is `None` and `Shell::detect()` returns `None`
 /// (unsupported `$SHELL`), errors out asking the user to pass
-/// `--shell bash` or `--shell zsh`. Better than silently falling
-/// back to bash on a fish/nu setup, which would produce an alias
-/// that never fires.
+/// `--shell bash`, `zsh` or `fish`. Better than silently falling
+/// back to bash on a nu setup, which would produce an alias that
+/// never fires.
 pub fn resolve_shell(explicit: Option<&str>) -> Result<Shell> {
     if let Some(name) = explicit {
         return Shell::from_str_opt(name).ok_or_else(|| {
             DodotError::Other(format!(
-                "unsupported shell {name:?}: dodot can install the git alias for `bash` or `zsh`. \
+                "unsupported shell {name:?}: dodot supports `bash`, `zsh` and `fish`. \
                  For other shells, run `dodot git-show-alias --shell bash` and adapt the snippet."
             ))
         });
@@ -301,15 +337,15 @@ pub fn resolve_shell(explicit: Option<&str>) -> Result<Shell> {
         let detected = std::env::var("SHELL").unwrap_or_default();
         if detected.is_empty() {
             DodotError::Other(
-                "$SHELL is unset; pass `--shell bash` or `--shell zsh` so dodot knows which \
+                "$SHELL is unset; pass `--shell bash`, `zsh` or `fish` so dodot knows which \
                  rc file to write."
                     .into(),
             )
         } else {
             DodotError::Other(format!(
-                "could not detect shell from $SHELL ({detected:?}): dodot can install the git \
-                 alias for `bash` or `zsh`. Pass `--shell bash` or `--shell zsh` explicitly, or \
-                 run `dodot git-show-alias --shell bash` and adapt the snippet for your shell."
+                "could not detect shell from $SHELL ({detected:?}): dodot supports `bash`, \
+                 `zsh` and `fish`. Pass `--shell bash`, `zsh` or `fish` explicitly, or run \
+                 `dodot git-show-alias --shell bash` and adapt the snippet for your shell."
             ))
         }
     })
@@ -379,8 +415,12 @@ mod tests {
             force: false,
             check_drift: false,
             show_diff: false,
+            lint: Default::default(),
+            template_vars: Default::default(),
+            file_filter: Default::default(),
             view_mode: crate::commands::ViewMode::Full,
             group_mode: crate::commands::GroupMode::Name,
+            render_verbosity: crate::commands::RenderVerbosity::Normal,
             verbose: false,
             host_facts: Arc::new(crate::gates::HostFacts::detect()),
         }
@@ -393,7 +433,8 @@ mod tests {
         assert_eq!(Shell::from_str_opt("bash"), Some(Shell::Bash));
         assert_eq!(Shell::from_str_opt("BASH"), Some(Shell::Bash));
         assert_eq!(Shell::from_str_opt("zsh"), Some(Shell::Zsh));
-        assert_eq!(Shell::from_str_opt("fish"), None);
+        assert_eq!(Shell::from_str_opt("fish"), Some(Shell::Fish));
+        assert_eq!(Shell::from_str_opt("nu"), None);
         assert_eq!(Shell::from_str_opt("Powershell"), None);
     }
 
@@ -401,6 +442,7 @@ mod tests {
     fn rc_paths_match_shell_conventions() {
         assert_eq!(Shell::Bash.rc_relative_path(), ".bashrc");
         assert_eq!(Shell::Zsh.rc_relative_path(), ".zshrc");
+        assert_eq!(Shell::Fish.rc_relative_path(), ".config/fish/config.fish");
     }
 
     #[test]
@@ -417,9 +459,9 @@ mod tests {
 
     #[test]
     fn resolve_shell_explicit_unknown_returns_error() {
-        let err = resolve_shell(Some("fish")).unwrap_err();
+        let err = resolve_shell(Some("nu")).unwrap_err();
         let msg = format!("{err}");
-        assert!(msg.contains("fish"), "msg: {msg}");
+        assert!(msg.contains("nu"), "msg: {msg}");
         assert!(
             msg.contains("bash"),
             "msg should suggest supported shells: {msg}"
@@ -456,22 +498,28 @@ mod tests {
     }
 
     #[test]
-    fn detect_returns_none_for_unknown_shell() {
-        // fish/nu/etc. don't auto-detect — the caller must `--shell`.
+    fn detect_returns_some_for_fish() {
         let _g = ShellEnvGuard::set("/usr/bin/fish");
+        assert_eq!(Shell::detect(), Some(Shell::Fish));
+    }
+
+    #[test]
+    fn detect_returns_none_for_unknown_shell() {
+        // nu/etc. don't auto-detect — the caller must `--shell`.
+        let _g = ShellEnvGuard::set("/usr/bin/nu");
         assert_eq!(Shell::detect(), None);
     }
 
     #[test]
     fn resolve_shell_no_explicit_unsupported_shell_errors() {
-        // The PR-review fix from R7: a fish/nu user running
+        // The PR-review fix from R7: a nu user running
         // `dodot git-show-alias` (no --shell) gets a clear error
-        // pointing at `--shell bash|zsh`, NOT a silent fall-
+        // pointing at `--shell bash|zsh|fish`, NOT a silent fall-
         // through to bash that writes a useless ~/.bashrc.
-        let _g = ShellEnvGuard::set("/usr/bin/fish");
+        let _g = ShellEnvGuard::set("/usr/bin/nu");
         let err = resolve_shell(None).unwrap_err();
         let msg = format!("{err}");
-        assert!(msg.contains("fish"), "msg: {msg}");
+        assert!(msg.contains("nu"), "msg: {msg}");
         assert!(msg.contains("--shell"), "msg should suggest --shell: {msg}");
     }
 
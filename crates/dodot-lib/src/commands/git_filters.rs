@@ -238,7 +238,7 @@ pub fn detect_plist_files(ctx: &ExecutionContext) -> Result<Vec<std::path::PathB
         return Ok(Vec::new());
     }
     let root_config = ctx.config_manager.root_config()?;
-    let packs = crate::packs::discover_packs(ctx.fs.as_ref(), root, &root_config.pack.ignore)?;
+    let packs = crate::packs::discover_root(ctx.fs.as_ref(), root, &root_config.pack)?;
     detect_plist_files_in(ctx, &packs)
 }
 
@@ -435,6 +435,7 @@ fn git_config_set(
             command: format!("git -C {} config {} {}", root.display(), key, value),
             exit_code: out.exit_code,
             stderr: out.stderr,
+            stdout: out.stdout,
         });
     }
     Ok(())
@@ -490,8 +491,12 @@ mod tests {
             force: false,
             check_drift: false,
             show_diff: false,
+            lint: Default::default(),
+            template_vars: Default::default(),
+            file_filter: Default::default(),
             view_mode: crate::commands::ViewMode::Full,
             group_mode: crate::commands::GroupMode::Name,
+            render_verbosity: crate::commands::RenderVerbosity::Normal,
             verbose: false,
             host_facts: Arc::new(crate::gates::HostFacts::detect()),
         }
@@ -1,10 +1,31 @@
 //! `init` command — create a new pack with default structure.
+//!
+//! `init --type <name>` starts the pack from a user archetype instead:
+//! a directory at `<config_dir>/templates/<name>/` (normally
+//! `~/.config/dodot/templates/<name>/`) whose contents are copied into
+//! the new pack. `{{ pack }}` in file contents and file names becomes
+//! the pack name; nothing else is interpreted, so archetypes can carry
+//! `.tmpl` files for the preprocessor untouched.
+//!
+//! `init --repo [DIR]` scaffolds a whole dotfiles repository instead:
+//! `git init`, a commented root `.dodot.toml`, a README, a CI workflow
+//! that plans every pack against an empty home, and three small sample
+//! packs (`shell`, `git`, `vim`) to edit or delete. Like `clone`, it
+//! runs before there is a dotfiles root, so it takes the filesystem
+//! and command runner directly ([`init_repo`]).
+
+use std::path::{Path, PathBuf};
 
 use serde::Serialize;
 
+use crate::datastore::{format_command_for_display, CommandRunner};
+use crate::fs::Fs;
 use crate::packs::orchestration::ExecutionContext;
 use crate::{DodotError, Result};
 
+/// Placeholder spellings replaced by the pack name in archetypes.
+const PACK_PLACEHOLDERS: &[&str] = &["{{ pack }}", "{{pack}}"];
+
 #[derive(Debug, Clone, Serialize)]
 pub struct InitResult {
     pub message: String,
@@ -13,6 +34,28 @@ pub struct InitResult {
 
 /// Create a new pack directory with default structure.
 pub fn init(pack_name: &str, ctx: &ExecutionContext) -> Result<InitResult> {
+    init_from(pack_name, None, ctx)
+}
+
+/// Create a new pack, from the archetype `pack_type` when given.
+///
+/// The archetype is checked before anything is created, so an unknown
+/// type leaves the dotfiles root untouched. An archetype without its
+/// own `.dodot.toml` gets the default one.
+pub fn init_from(
+    pack_name: &str,
+    pack_type: Option<&str>,
+    ctx: &ExecutionContext,
+) -> Result<InitResult> {
+    // A flat root never discovers directories as packs; the new one
+    // would just be a subdirectory of the implicit pack.
+    if ctx.paths.flat_layout() {
+        return Err(DodotError::PackInvalid {
+            name: pack_name.into(),
+            reason: "the dotfiles root uses `[pack] layout = \"flat\"` and is its own only pack"
+                .into(),
+        });
+    }
     let pack_path = ctx.paths.pack_path(pack_name);
 
     if ctx.fs.exists(&pack_path) {
@@ -22,7 +65,31 @@ pub fn init(pack_name: &str, ctx: &ExecutionContext) -> Result<InitResult> {
         });
     }
 
+    let archetype = match pack_type {
+        Some(name) => Some(archetype_dir(name, ctx)?),
+        None => None,
+    };
+
     ctx.fs.mkdir_all(&pack_path)?;
+    let mut details = vec![format!("Created {}", pack_path.display())];
+
+    if let Some(source) = &archetype {
+        let mut copied = Vec::new();
+        copy_archetype(ctx.fs.as_ref(), source, &pack_path, pack_name, &mut copied)?;
+        details.extend(
+            copied
+                .iter()
+                .map(|path| format!("Created {}", path.display())),
+        );
+    }
+
+    let message = match pack_type {
+        Some(t) => format!("Pack '{pack_name}' initialized from type '{t}'."),
+        None => format!("Pack '{pack_name}' initialized."),
+    };
+    if ctx.fs.exists(&pack_path.join(".dodot.toml")) {
+        return Ok(InitResult { message, details });
+    }
 
     // Write default .dodot.toml
     let config_content = format!(
@@ -46,13 +113,269 @@ pub fn init(pack_name: &str, ctx: &ExecutionContext) -> Result<InitResult> {
     ctx.fs
         .write_file(&pack_path.join(".dodot.toml"), config_content.as_bytes())?;
 
-    let details = vec![
-        format!("Created {}", pack_path.display()),
-        format!("Created {}/.dodot.toml", pack_path.display()),
-    ];
+    details.push(format!("Created {}/.dodot.toml", pack_path.display()));
+
+    Ok(InitResult { message, details })
+}
+
+/// One file `init --repo` writes, relative to the repo root.
+struct RepoFile {
+    path: &'static str,
+    content: &'static str,
+}
+
+const REPO_FILES: &[RepoFile] = &[
+    RepoFile {
+        path: ".dodot.toml",
+        content: r#"# Root dodot configuration: applies to every pack.
+# Each pack can add its own .dodot.toml to override these.
+# See: dodot config gen --help
+
+[pack]
+# ignore = ["*.bak", "*.tmp"]
+
+[symlink]
+# mode = "symlink"                 # or "copy" / "hardlink"
+# force_home = ["ssh", "bashrc", "zshrc"]
+
+# [symlink.targets]
+# "vim/home.vimrc" = "~/.vimrc"
+"#,
+    },
+    RepoFile {
+        path: "README.md",
+        content: r#"# dotfiles
+
+Managed with [dodot](https://github.com/arthur-debert/dodot). Every
+top-level directory is a *pack*: a group of related files that dodot
+deploys together.
+
+| Pack    | What it holds                                          |
+|---------|--------------------------------------------------------|
+| `shell` | `*.sh` files sourced into every shell session          |
+| `git`   | `config` and `ignore`, linked into `~/.config/git/`    |
+| `vim`   | `home.vimrc`, linked to `~/.vimrc`                     |
+
+## Use
+
+```sh
+dodot status      # what would be deployed, and where
+dodot up          # deploy every pack
+dodot up vim      # or just one
+dodot down vim    # take a pack back out
+```
+
+Add the shell integration to your rc file once, so the `shell` pack
+is sourced in new shells:
+
+```sh
+eval "$(dodot init-sh)"
+```
+
+## New machine
+
+```sh
+dodot clone <this repo's URL>
+```
+
+## Adding things
+
+```sh
+dodot init tmux                  # a new pack
+dodot adopt --into shell ~/.inputrc   # move an existing file into a pack
+```
+"#,
+    },
+    RepoFile {
+        path: ".gitignore",
+        content: r#"# Editor and OS droppings
+.DS_Store
+*.swp
+*~
+"#,
+    },
+    RepoFile {
+        path: ".github/workflows/dodot.yml",
+        content: r#"# Plan every pack against an empty home directory, so a broken
+# .dodot.toml or a routing conflict fails the build instead of the
+# next `dodot up`.
+name: dodot
+
+on: [push, pull_request]
+
+jobs:
+  plan:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v4
+      - run: cargo install --locked dodot
+      - name: dodot plan
+        env:
+          DOTFILES_ROOT: ${{ github.workspace }}
+        run: |
+          export HOME="$(mktemp -d)"
+          dodot plan --no-provision
+"#,
+    },
+    RepoFile {
+        path: "shell/aliases.sh",
+        content: r#"# Sourced into every shell session by `dodot init-sh`.
+# Any *.sh file in a pack is, so split things up as they grow.
+
+alias ll='ls -la'
+# alias g='git'
+"#,
+    },
+    RepoFile {
+        path: "shell/env.sh",
+        content: r#"# Environment for every shell session.
+
+# export EDITOR=vim
+"#,
+    },
+    RepoFile {
+        path: "git/config",
+        content: r#"# Linked to ~/.config/git/config, which git reads alongside
+# ~/.gitconfig.
+
+[user]
+#	name = Your Name
+#	email = you@example.com
+
+[init]
+	defaultBranch = main
+"#,
+    },
+    RepoFile {
+        path: "git/ignore",
+        content: r#"# Global gitignore: linked to ~/.config/git/ignore, git's default
+# core.excludesFile.
+.DS_Store
+*.swp
+"#,
+    },
+    RepoFile {
+        path: "vim/home.vimrc",
+        content: r#"" The `home.` prefix links this file to ~/.vimrc.
+
+set nocompatible
+syntax on
+set number
+"#,
+    },
+];
+
+/// Scaffold a new dotfiles repository at `dest`: `git init`, then the
+/// root config, README, CI workflow and sample packs. Refuses a `dest`
+/// that exists and is not empty, so it never mixes into an existing
+/// repo; nothing is written if `git init` fails.
+pub fn init_repo(dest: &Path, fs: &dyn Fs, runner: &dyn CommandRunner) -> Result<InitResult> {
+    if fs.exists(dest) && !fs.read_dir(dest).map(|e| e.is_empty()).unwrap_or(false) {
+        return Err(DodotError::Other(format!(
+            "{} already exists and is not empty; pass another directory, \
+             or `dodot init <pack>` to add a pack to it",
+            dest.display()
+        )));
+    }
+    fs.mkdir_all(dest)?;
+
+    let arguments = vec!["init".to_string(), dest.display().to_string()];
+    let output = runner.run("git", &arguments)?;
+    if output.exit_code != 0 {
+        return Err(DodotError::CommandFailed {
+            command: format_command_for_display("git", &arguments),
+            exit_code: output.exit_code,
+            stderr: output.stderr,
+            stdout: output.stdout,
+        });
+    }
+
+    let mut details = vec![format!("Initialized git repository in {}", dest.display())];
+    for file in REPO_FILES {
+        let path = dest.join(file.path);
+        if let Some(parent) = path.parent() {
+            fs.mkdir_all(parent)?;
+        }
+        fs.write_file(&path, file.content.as_bytes())?;
+        details.push(format!("Created {}", path.display()));
+    }
+    details.push(format!(
+        "Next: `export DOTFILES_ROOT={}` (or run dodot from inside the repo), then `dodot status`",
+        dest.display()
+    ));
 
     Ok(InitResult {
-        message: format!("Pack '{pack_name}' initialized."),
+        message: format!("Dotfiles repo initialized at {}.", dest.display()),
         details,
     })
 }
+
+/// Archetype names available under the templates dir, sorted.
+pub fn available_types(ctx: &ExecutionContext) -> Vec<String> {
+    let dir = ctx.paths.pack_templates_dir();
+    ctx.fs
+        .read_dir(&dir)
+        .unwrap_or_default()
+        .into_iter()
+        .filter(|e| e.is_dir && !e.name.starts_with('.'))
+        .map(|e| e.name)
+        .collect()
+}
+
+fn archetype_dir(name: &str, ctx: &ExecutionContext) -> Result<PathBuf> {
+    let dir = ctx.paths.pack_templates_dir().join(name);
+    let plain = !name.is_empty() && !name.contains(['/', '\\']) && !name.starts_with('.');
+    if plain && ctx.fs.is_dir(&dir) {
+        return Ok(dir);
+    }
+    let known = available_types(ctx);
+    let hint = if known.is_empty() {
+        format!(
+            "no pack types defined; add one as a directory under {}",
+            ctx.paths.pack_templates_dir().display()
+        )
+    } else {
+        format!("available: {}", known.join(", "))
+    };
+    Err(DodotError::Other(format!(
+        "unknown pack type `{name}` ({hint})"
+    )))
+}
+
+/// Copy `src` into `dst`, substituting the pack name into file names
+/// and text contents. Binary files are copied byte for byte; modes are
+/// kept so executable scripts stay executable. `copied` collects the
+/// paths written.
+fn copy_archetype(
+    fs: &dyn Fs,
+    src: &Path,
+    dst: &Path,
+    pack_name: &str,
+    copied: &mut Vec<PathBuf>,
+) -> Result<()> {
+    for entry in fs.read_dir(src)? {
+        let target = dst.join(substitute(&entry.name, pack_name));
+        if entry.is_symlink {
+            fs.symlink(&fs.readlink(&entry.path)?, &target)?;
+        } else if entry.is_dir {
+            fs.mkdir_all(&target)?;
+            copy_archetype(fs, &entry.path, &target, pack_name, copied)?;
+            continue;
+        } else {
+            let bytes = fs.read_file(&entry.path)?;
+            match String::from_utf8(bytes) {
+                Ok(text) => fs.write_file(&target, substitute(&text, pack_name).as_bytes())?,
+                Err(raw) => fs.write_file(&target, raw.as_bytes())?,
+            }
+            let _ = fs.set_permissions(&target, fs.lstat(&entry.path)?.mode);
+        }
+        copied.push(target);
+    }
+    Ok(())
+}
+
+fn substitute(text: &str, pack_name: &str) -> String {
+    PACK_PLACEHOLDERS
+        .iter()
+        .fold(text.to_string(), |acc, p| acc.replace(p, pack_name))
+}
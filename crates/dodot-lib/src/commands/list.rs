@@ -1,8 +1,15 @@
 //! `list` command — show all available packs.
+//!
+//! With `--files` it also shows every matched file per pack, with its
+//! handler and deployment state. Those come from the same
+//! [`status`](super::status::status) run `dodot status` does, so the
+//! two commands can't disagree about a file.
 
 use serde::Serialize;
 
+use crate::commands::status_report::ItemReport;
 use crate::packs;
+use crate::packs::metadata::PackMetadata;
 use crate::packs::orchestration::ExecutionContext;
 use crate::Result;
 
@@ -18,9 +25,88 @@ pub struct ListPack {
     /// directory name.
     pub name: String,
     pub ignored: bool,
+    /// The pack's `[pack]` metadata, when it sets any.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub metadata: Option<PackMetadata>,
+    /// Why this dodot won't deploy the pack (`[pack] min_dodot`).
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub incompatible: Option<String>,
+    /// Matched files, for `list --files`. Ignored packs and packs
+    /// inactive on this machine have none.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub files: Option<Vec<ListFile>>,
 }
 
-/// List all packs in the dotfiles root.
+/// One matched file in `list --files`.
+#[derive(Debug, Clone, Serialize)]
+pub struct ListFile {
+    /// Pack-relative path.
+    pub name: String,
+    pub handler: String,
+    /// Style bucket, as in `dodot status`: `deployed`, `pending`, …
+    pub state: String,
+    pub label: String,
+    /// Deploy path with `$HOME` collapsed, for link items.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub target: Option<String>,
+}
+
+impl From<&ItemReport> for ListFile {
+    fn from(item: &ItemReport) -> Self {
+        Self {
+            name: item.name.clone(),
+            handler: item.handler.clone(),
+            state: item.state.clone(),
+            label: item.label.clone(),
+            target: item.target.clone(),
+        }
+    }
+}
+
+/// Order of the files within each pack.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub enum FileSort {
+    /// The order `dodot status` shows them in.
+    #[default]
+    Status,
+    /// By handler name, then path.
+    Handler,
+    /// By state, then path.
+    State,
+}
+
+/// Which files `list --files` shows, and in what order.
+#[derive(Debug, Clone, Default)]
+pub struct FileQuery {
+    /// Keep only files claimed by this handler.
+    pub handler: Option<String>,
+    /// Keep only files in this state.
+    pub state: Option<String>,
+    pub sort: FileSort,
+}
+
+impl FileQuery {
+    fn apply(&self, items: impl Iterator<Item = ItemReport>) -> Vec<ListFile> {
+        let mut files: Vec<ListFile> = items
+            .filter(|i| self.handler.as_ref().map_or(true, |h| &i.handler == h))
+            .filter(|i| self.state.as_ref().map_or(true, |s| &i.state == s))
+            .map(|i| ListFile::from(&i))
+            .collect();
+        match self.sort {
+            FileSort::Status => {}
+            FileSort::Handler => {
+                files.sort_by(|a, b| a.handler.cmp(&b.handler).then_with(|| a.name.cmp(&b.name)))
+            }
+            FileSort::State => {
+                files.sort_by(|a, b| a.state.cmp(&b.state).then_with(|| a.name.cmp(&b.name)))
+            }
+        }
+        files
+    }
+}
+
+/// List all packs in the dotfiles root, with what each says about
+/// itself in its `[pack]` metadata.
 ///
 /// Packs appear in the order dodot would apply them (lexicographic by
 /// on-disk directory name); see the `packs` module docs for the pack
@@ -31,10 +117,10 @@ pub struct ListPack {
 /// never show ambiguous duplicates that `dodot up` would refuse.
 pub fn list(ctx: &ExecutionContext) -> Result<ListResult> {
     let root_config = ctx.config_manager.root_config()?;
-    let scanned = packs::scan_packs(
+    let scanned = packs::scan_root(
         ctx.fs.as_ref(),
         ctx.paths.dotfiles_root(),
-        &root_config.pack.ignore,
+        &root_config.pack,
     )?;
 
     // Two streams in: active packs (already carry display_name) and
@@ -43,11 +129,22 @@ pub fn list(ctx: &ExecutionContext) -> Result<ListResult> {
     // so the displayed order still matches deploy order.
     let mut entries: Vec<(String, ListPack)> = Vec::new();
     for p in scanned.packs {
+        // A pack whose config fails to load still lists; the commands
+        // that deploy it report the error.
+        let metadata = ctx
+            .config_manager
+            .config_for_pack(&p.path)
+            .ok()
+            .map(|cfg| PackMetadata::from_section(&cfg.pack))
+            .filter(|m| !m.is_empty());
         entries.push((
             p.name.clone(),
             ListPack {
                 name: p.display_name,
                 ignored: false,
+                incompatible: metadata.as_ref().and_then(PackMetadata::incompatibility),
+                metadata,
+                files: None,
             },
         ));
     }
@@ -58,6 +155,9 @@ pub fn list(ctx: &ExecutionContext) -> Result<ListResult> {
             ListPack {
                 name: display,
                 ignored: true,
+                metadata: None,
+                incompatible: None,
+                files: None,
             },
         ));
     }
@@ -67,3 +167,24 @@ pub fn list(ctx: &ExecutionContext) -> Result<ListResult> {
         packs: entries.into_iter().map(|(_, p)| p).collect(),
     })
 }
+
+/// [`list`], with each pack's matched files filtered and sorted by
+/// `query`.
+///
+/// Runs a full [`status`](super::status::status) pass, so this costs
+/// what `dodot status` costs. A pack whose files are all filtered out
+/// stays in the list with an empty `files`.
+pub fn list_files(query: &FileQuery, ctx: &ExecutionContext) -> Result<ListResult> {
+    let mut result = list(ctx)?;
+    let report = super::status::status(None, ctx)?.report.unwrap_or_default();
+    for pack in result.packs.iter_mut().filter(|p| !p.ignored) {
+        let items = report
+            .packs
+            .iter()
+            .filter(|r| r.name == pack.name)
+            .flat_map(|r| r.handlers.iter())
+            .flat_map(|h| h.items.iter().cloned());
+        pack.files = Some(query.apply(items));
+    }
+    Ok(result)
+}
@@ -0,0 +1,433 @@
+//! `dodot migrate-state` — move a data dir from the flat legacy layout
+//! to the per-pack one.
+//!
+//! Older dodot releases kept state by handler first, with the pack
+//! only implied by where a data link pointed:
+//!
+//! ```text
+//! <data_dir>/deployed/<handler>/<name>               -> <root>/<pack>/<rel>
+//! <data_dir>/sentinels/<handler>/<pack>/<sentinel>   (+ .snapshot siblings)
+//! ```
+//!
+//! The current layout is `<data_dir>/packs/<pack>/<handler>/<name>` for
+//! both (see `docs/dev/storage.lex`). Migration:
+//!
+//! 1. plans every move, deriving a data link's pack from its target,
+//!    and finds the user links (`~/.vimrc -> deployed/symlink/vimrc`)
+//!    that must be repointed at the moved data link;
+//! 2. applies the plan, rolling every step back if one fails;
+//! 3. verifies that every link which resolved before still resolves,
+//!    rolling back otherwise;
+//! 4. removes the emptied legacy directories and regenerates the
+//!    shell init files and deployment map, which embed datastore paths.
+//!
+//! Entries it can't place — a link into a pack that no longer exists,
+//! or a name the new layout already has — are left where they are and
+//! listed, so nothing is silently dropped.
+
+use std::path::{Path, PathBuf};
+
+use tracing::info;
+
+use crate::commands::MessageResult;
+use crate::fs::Fs;
+use crate::handlers::symlink::resolve_target;
+use crate::handlers::HANDLER_SYMLINK;
+use crate::packs::orchestration::{self, ExecutionContext};
+use crate::{probe, shell, DodotError, Result};
+
+/// Legacy directory holding data links, one subdir per handler.
+pub const LEGACY_DEPLOYED_DIR: &str = "deployed";
+/// Legacy directory holding run-once sentinels, by handler then pack.
+pub const LEGACY_SENTINELS_DIR: &str = "sentinels";
+
+/// One reversible step of a migration.
+#[derive(Debug, Clone, PartialEq, Eq)]
+enum Step {
+    /// Rename a datastore entry into the new layout.
+    Move {
+        from: PathBuf,
+        to: PathBuf,
+        /// Whether `from` resolved when planned (links only); checked
+        /// again at `to` after the move.
+        resolved: Option<bool>,
+    },
+    /// Repoint a user-visible symlink from the legacy data link to
+    /// the moved one.
+    Relink {
+        user_path: PathBuf,
+        old_target: PathBuf,
+        new_target: PathBuf,
+        resolved: bool,
+    },
+}
+
+#[derive(Debug, Default)]
+struct Plan {
+    steps: Vec<Step>,
+    skipped: Vec<String>,
+}
+
+/// Whether the data dir still has legacy state.
+pub fn needs_migration(fs: &dyn Fs, data_dir: &Path) -> bool {
+    fs.is_dir(&data_dir.join(LEGACY_DEPLOYED_DIR))
+        || fs.is_dir(&data_dir.join(LEGACY_SENTINELS_DIR))
+}
+
+/// Run `dodot migrate-state`. With `ctx.dry_run` only the plan is
+/// reported.
+pub fn migrate_state(ctx: &ExecutionContext) -> Result<MessageResult> {
+    let fs = ctx.fs.as_ref();
+    let data_dir = ctx.paths.data_dir().to_path_buf();
+    if !needs_migration(fs, &data_dir) {
+        return Ok(MessageResult {
+            message: "Data dir already uses the current layout; nothing to migrate.".into(),
+            details: Vec::new(),
+        });
+    }
+
+    let plan = plan(ctx)?;
+    let mut details: Vec<String> = plan.steps.iter().map(describe).collect();
+    details.extend(plan.skipped.iter().map(|s| format!("skipped: {s}")));
+
+    if ctx.dry_run {
+        return Ok(MessageResult {
+            message: format!(
+                "[dry-run] would migrate {} entr(ies) to the per-pack layout.",
+                plan.steps.len()
+            ),
+            details,
+        });
+    }
+
+    apply(fs, &plan.steps)?;
+    if let Some(broken) = verify(fs, &plan.steps) {
+        rollback(fs, &plan.steps);
+        return Err(DodotError::Other(format!(
+            "migration rolled back: {} resolved before the move but not after",
+            broken.display()
+        )));
+    }
+    info!(steps = plan.steps.len(), "migrated legacy data dir");
+
+    for dir in [LEGACY_DEPLOYED_DIR, LEGACY_SENTINELS_DIR] {
+        remove_empty_dirs(fs, &data_dir.join(dir));
+    }
+    ctx.datastore.reindex()?;
+    let root_config = ctx.config_manager.root_config()?;
+    let path_priorities = orchestration::path_priorities(ctx)?;
+    shell::write_init_script(
+        fs,
+        ctx.paths.as_ref(),
+        root_config.profiling.enabled,
+        &path_priorities,
+    )?;
+    shell::write_path_exports(
+        fs,
+        ctx.paths.as_ref(),
+        &path_priorities,
+        root_config.path.shims,
+    )?;
+    probe::write_deployment_map(fs, ctx.paths.as_ref())?;
+
+    let message = if needs_migration(fs, &data_dir) {
+        format!(
+            "Migrated {} entr(ies); skipped entries remain under {}/{{{LEGACY_DEPLOYED_DIR},{LEGACY_SENTINELS_DIR}}}.",
+            plan.steps.len(),
+            data_dir.display()
+        )
+    } else {
+        format!(
+            "Migrated {} entr(ies) to the per-pack layout.",
+            plan.steps.len()
+        )
+    };
+    Ok(MessageResult { message, details })
+}
+
+fn plan(ctx: &ExecutionContext) -> Result<Plan> {
+    let fs = ctx.fs.as_ref();
+    let paths = ctx.paths.as_ref();
+    let root = paths.dotfiles_root();
+    let mut plan = Plan::default();
+
+    let deployed = paths.data_dir().join(LEGACY_DEPLOYED_DIR);
+    for handler_dir in read_dirs(fs, &deployed)? {
+        let handler = handler_dir.name;
+        for entry in fs.read_dir(&handler_dir.path)? {
+            let from = entry.path;
+            let Ok(target) = fs.readlink(&from) else {
+                plan.skipped
+                    .push(format!("{} is not a data link", from.display()));
+                continue;
+            };
+            let Some((pack, rel)) = pack_of(&target, root, fs) else {
+                plan.skipped.push(format!(
+                    "{} points outside any pack ({}); `dodot up` recreates what's still needed",
+                    from.display(),
+                    target.display()
+                ));
+                continue;
+            };
+            let to = paths.handler_data_dir(&pack, &handler).join(&entry.name);
+            if fs.exists(&to) || fs.is_symlink(&to) {
+                plan.skipped
+                    .push(format!("{} already exists", to.display()));
+                continue;
+            }
+            if handler == HANDLER_SYMLINK {
+                let config = ctx
+                    .config_manager
+                    .config_for_pack(&root.join(&pack))?
+                    .to_handler_config();
+                let user_path = resolve_target(&pack, &rel, &config, paths);
+                if fs.readlink(&user_path).ok().as_deref() == Some(from.as_path()) {
+                    plan.steps.push(Step::Relink {
+                        resolved: fs.exists(&user_path),
+                        user_path,
+                        old_target: from.clone(),
+                        new_target: to.clone(),
+                    });
+                }
+            }
+            plan.steps.push(Step::Move {
+                resolved: Some(fs.exists(&from)),
+                from,
+                to,
+            });
+        }
+    }
+
+    let sentinels = paths.data_dir().join(LEGACY_SENTINELS_DIR);
+    for handler_dir in read_dirs(fs, &sentinels)? {
+        for pack_dir in read_dirs(fs, &handler_dir.path)? {
+            for entry in fs.read_dir(&pack_dir.path)? {
+                let to = paths
+                    .handler_data_dir(&pack_dir.name, &handler_dir.name)
+                    .join(&entry.name);
+                if fs.exists(&to) {
+                    plan.skipped
+                        .push(format!("{} already exists", to.display()));
+                    continue;
+                }
+                plan.steps.push(Step::Move {
+                    from: entry.path,
+                    to,
+                    resolved: None,
+                });
+            }
+        }
+    }
+
+    // Moves run before the relinks that depend on them.
+    plan.steps.sort_by_key(|s| matches!(s, Step::Relink { .. }));
+    Ok(plan)
+}
+
+/// `(pack dir name, path within the pack)` for a link target under the
+/// dotfiles root, if that pack still exists.
+fn pack_of(target: &Path, root: &Path, fs: &dyn Fs) -> Option<(String, String)> {
+    let rel = target.strip_prefix(root).ok()?;
+    let mut components = rel.components();
+    let pack = components
+        .next()?
+        .as_os_str()
+        .to_string_lossy()
+        .into_owned();
+    let within = components.as_path().to_string_lossy().into_owned();
+    (!within.is_empty() && fs.is_dir(&root.join(&pack))).then_some((pack, within))
+}
+
+fn read_dirs(fs: &dyn Fs, dir: &Path) -> Result<Vec<crate::fs::DirEntry>> {
+    if !fs.is_dir(dir) {
+        return Ok(Vec::new());
+    }
+    Ok(fs
+        .read_dir(dir)?
+        .into_iter()
+        .filter(|e| fs.is_dir(&e.path) && !fs.is_symlink(&e.path))
+        .collect())
+}
+
+fn apply(fs: &dyn Fs, steps: &[Step]) -> Result<()> {
+    for (done, step) in steps.iter().enumerate() {
+        if let Err(err) = apply_step(fs, step) {
+            rollback(fs, &steps[..done]);
+            return Err(err);
+        }
+    }
+    Ok(())
+}
+
+fn apply_step(fs: &dyn Fs, step: &Step) -> Result<()> {
+    match step {
+        Step::Move { from, to, .. } => {
+            if let Some(parent) = to.parent() {
+                fs.mkdir_all(parent)?;
+            }
+            fs.rename(from, to)
+        }
+        Step::Relink {
+            user_path,
+            new_target,
+            ..
+        } => {
+            fs.remove_file(user_path)?;
+            fs.symlink(new_target, user_path)
+        }
+    }
+}
+
+/// Undo `steps` in reverse. Best effort: this only runs after a
+/// failure, and each undo is the inverse of a step that succeeded.
+fn rollback(fs: &dyn Fs, steps: &[Step]) {
+    for step in steps.iter().rev() {
+        let _ = match step {
+            Step::Move { from, to, .. } => fs.rename(to, from),
+            Step::Relink {
+                user_path,
+                old_target,
+                ..
+            } => fs
+                .remove_file(user_path)
+                .and_then(|_| fs.symlink(old_target, user_path)),
+        };
+    }
+}
+
+/// First link that resolved before the migration and doesn't now.
+fn verify<'a>(fs: &dyn Fs, steps: &'a [Step]) -> Option<&'a Path> {
+    steps.iter().find_map(|step| match step {
+        Step::Move {
+            to,
+            resolved: Some(true),
+            ..
+        } if !fs.exists(to) => Some(to.as_path()),
+        Step::Relink {
+            user_path,
+            resolved: true,
+            ..
+        } if !fs.exists(user_path) => Some(user_path.as_path()),
+        _ => None,
+    })
+}
+
+fn remove_empty_dirs(fs: &dyn Fs, dir: &Path) -> bool {
+    if !fs.is_dir(dir) || fs.is_symlink(dir) {
+        return false;
+    }
+    let Ok(entries) = fs.read_dir(dir) else {
+        return false;
+    };
+    let mut empty = true;
+    for entry in entries {
+        empty &= remove_empty_dirs(fs, &entry.path);
+    }
+    empty && fs.remove_dir_all(dir).is_ok()
+}
+
+fn describe(step: &Step) -> String {
+    match step {
+        Step::Move { from, to, .. } => format!("{} → {}", from.display(), to.display()),
+        Step::Relink {
+            user_path,
+            new_target,
+            ..
+        } => format!("relink {} → {}", user_path.display(), new_target.display()),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::commands::tests::support::make_ctx;
+    use crate::testing::TempEnvironment;
+
+    fn legacy_env() -> TempEnvironment {
+        let env = TempEnvironment::builder()
+            .pack("bash")
+            .file("bashrc", "set -o vi")
+            .file("install.sh", "echo hi")
+            .done()
+            .build();
+        let data = env.paths.data_dir().to_path_buf();
+        let legacy_link = data.join("deployed/symlink/bashrc");
+        env.fs.mkdir_all(legacy_link.parent().unwrap()).unwrap();
+        env.fs
+            .symlink(&env.dotfiles_root.join("bash/bashrc"), &legacy_link)
+            .unwrap();
+        env.fs
+            .symlink(&legacy_link, &env.home.join(".bashrc"))
+            .unwrap();
+        let sentinel = data.join("sentinels/install/bash/install.sh-0123456789abcdef");
+        env.fs.mkdir_all(sentinel.parent().unwrap()).unwrap();
+        env.fs
+            .write_file(&sentinel, b"completed|1700000000")
+            .unwrap();
+        env
+    }
+
+    #[test]
+    fn migrates_links_sentinels_and_user_links() {
+        let env = legacy_env();
+        let ctx = make_ctx(&env);
+        let data = env.paths.data_dir().to_path_buf();
+
+        let result = migrate_state(&ctx).unwrap();
+        assert!(result.message.contains("Migrated 3"), "{}", result.message);
+
+        let new_link = env.paths.handler_data_dir("bash", "symlink").join("bashrc");
+        assert_eq!(
+            env.fs.readlink(&env.home.join(".bashrc")).unwrap(),
+            new_link
+        );
+        assert_eq!(
+            env.fs.read_to_string(&env.home.join(".bashrc")).unwrap(),
+            "set -o vi"
+        );
+        assert!(env.fs.exists(
+            &env.paths
+                .handler_data_dir("bash", "install")
+                .join("install.sh-0123456789abcdef")
+        ));
+        assert!(!env.fs.exists(&data.join(LEGACY_DEPLOYED_DIR)));
+        assert!(!env.fs.exists(&data.join(LEGACY_SENTINELS_DIR)));
+
+        let again = migrate_state(&ctx).unwrap();
+        assert!(
+            again.message.contains("nothing to migrate"),
+            "{}",
+            again.message
+        );
+    }
+
+    #[test]
+    fn dry_run_and_unplaceable_entries_leave_legacy_state() {
+        let env = legacy_env();
+        let data = env.paths.data_dir().to_path_buf();
+        let orphan = data.join("deployed/shell/gone.sh");
+        env.fs.mkdir_all(orphan.parent().unwrap()).unwrap();
+        env.fs
+            .symlink(&env.dotfiles_root.join("gone/gone.sh"), &orphan)
+            .unwrap();
+
+        let mut ctx = make_ctx(&env);
+        ctx.dry_run = true;
+        let preview = migrate_state(&ctx).unwrap();
+        assert!(preview.message.starts_with("[dry-run]"));
+        assert!(env.fs.is_symlink(&data.join("deployed/symlink/bashrc")));
+
+        ctx.dry_run = false;
+        let result = migrate_state(&ctx).unwrap();
+        assert!(
+            result
+                .details
+                .iter()
+                .any(|d| d.starts_with("skipped:") && d.contains("gone.sh")),
+            "{:?}",
+            result.details
+        );
+        assert!(env.fs.is_symlink(&orphan));
+        assert!(!env.fs.exists(&data.join("deployed/symlink")));
+    }
+}
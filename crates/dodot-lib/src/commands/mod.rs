@@ -7,28 +7,54 @@
 
 pub mod addignore;
 pub mod adopt;
+pub mod changes;
+pub mod clone;
+pub mod completion;
+pub mod disable;
+pub mod doctor;
 pub mod down;
+pub mod eject;
+pub mod explain_error;
 pub mod fill;
 pub mod git_alias;
 pub mod git_filters;
 pub mod init;
 pub mod list;
+pub mod migrate_state;
+pub mod pin;
+pub mod plan;
+pub mod preview;
 pub mod probe;
 pub mod prompts;
+pub mod protect;
+pub mod provision;
 pub mod refresh;
+pub mod relocate_data;
+pub mod run;
+pub mod schema;
 pub mod secret;
+pub mod snippet;
+pub mod state;
 pub mod status;
+pub mod status_report;
+pub mod template_check;
 pub mod template_clean;
 pub mod template_install_filter;
+pub mod template_vars;
 pub mod transform;
+pub mod trash;
 pub mod tutorial;
 pub mod up;
 
 #[cfg(test)]
-mod tests;
+pub(crate) mod tests;
 
 use serde::Serialize;
 
+use crate::render::layout::{
+    column_width, shrink_columns, terminal_width, truncate_end, truncate_middle, wrap_hanging,
+};
+
 /// Shared `{message, details}` result for commands whose output is a
 /// short headline plus a list of secondary lines. Renders through the
 /// `message` template. Per-command result types (e.g. `InitResult`,
@@ -43,19 +69,32 @@ pub struct MessageResult {
 
 // ── Shared display types ────────────────────────────────────────
 
-/// Handler symbols matching the Go implementation.
+/// Handler symbols matching the Go implementation, or their ASCII
+/// stand-ins under `--ascii`.
 pub fn handler_symbol(handler: &str) -> &'static str {
-    match handler {
+    crate::render::glyphs::symbol(match handler {
         "symlink" => "➞",
         "shell" => "⚙",
+        "gitconfig" => "⚙",
         "path" => "+",
         "homebrew" => "⚙",
         "install" => "×",
         "nix" => "⚙",
+        "npm" | "pip" | "cargo" | "gem" => "⚙",
+        "asdf" | "mise" | "flake" => "⚙",
+        "plugins" => "⚙",
+        "download" => "⚙",
+        "sshkeys" => "⚙",
+        "containers" => "⚙",
+        "system" => "#",
+        "autostart" => "⚙",
+        "agent" => "⚙",
+        "editors" => "➞",
+        "verify" => "✓",
         "skip" => "·",
         "gate" => "·",
         _ => "?",
-    }
+    })
 }
 
 /// Status string for standout template tag matching (maps to theme style names).
@@ -70,7 +109,7 @@ pub fn status_style(deployed: bool) -> &'static str {
 /// Human-readable handler description for a file.
 pub fn handler_description(handler: &str, rel_path: &str, user_target: Option<&str>) -> String {
     match handler {
-        "symlink" => {
+        "symlink" | "editors" => {
             // Callers normally pass a fully-resolved user_target (computed
             // by `resolve_target` with the pack name in scope). The
             // pack-namespaced XDG default cannot be reconstructed from
@@ -82,10 +121,26 @@ pub fn handler_description(handler: &str, rel_path: &str, user_target: Option<&s
                 .unwrap_or_else(|| "<symlink>".to_string())
         }
         "shell" => "shell profile".into(),
+        "gitconfig" => "git include".into(),
         "path" => format!("$PATH/{rel_path}"),
         "install" => "run script".into(),
         "homebrew" => "brew install".into(),
         "nix" => "nix profile install".into(),
+        "npm" => "npm install -g".into(),
+        "pip" => "pip install --user".into(),
+        "cargo" => "cargo install".into(),
+        "gem" => "gem install".into(),
+        "asdf" => "asdf install".into(),
+        "mise" => "mise install".into(),
+        "flake" => "nix profile install (flake)".into(),
+        "plugins" => "plugin managers".into(),
+        "download" => "downloaded tools".into(),
+        "sshkeys" => "ssh keys".into(),
+        "containers" => "container images".into(),
+        "system" => "system files (sudo)".into(),
+        "autostart" => "starts at login".into(),
+        "agent" => "gpg/ssh agent".into(),
+        "verify" => "post-deploy check".into(),
         "skip" => "not deployed".into(),
         "gate" => "not deployed".into(),
         _ => String::new(),
@@ -108,6 +163,13 @@ pub struct DisplayFile {
     /// assembly time and are stable within a single command invocation.
     #[serde(skip_serializing_if = "Option::is_none", default)]
     pub note_ref: Option<u32>,
+    /// Summary of the most recent recorded run (`"3d ago on mbp in
+    /// 42s"`) for run-once rows (`install`, `homebrew`, `nix`). `None`
+    /// for handlers that don't record runs, or when nothing ran yet.
+    /// Surfaced after the status label in the full view and in the
+    /// `last run` column of the table view.
+    #[serde(skip_serializing_if = "Option::is_none", default)]
+    pub last_run: Option<String>,
 }
 
 /// A pack entry for status display.
@@ -115,15 +177,22 @@ pub struct DisplayFile {
 pub struct DisplayPack {
     pub name: String,
     pub files: Vec<DisplayFile>,
-    /// Aggregated pack-level status, one of `"error"`, `"pending"`,
-    /// `"deployed"`. Rollup rules: `error` ← any file with `error` or
-    /// `broken`; otherwise `pending` ← any file with `pending`,
-    /// `warning`, or `stale`; otherwise `deployed`. Always populated so
+    /// Aggregated pack-level status, one of `"error"`, `"degraded"`,
+    /// `"pending"`, `"deployed"`. Rollup rules: `error` ← any file with
+    /// `error` or `broken`; otherwise `degraded` ← any failed
+    /// `[pack] verify` check; otherwise `pending` ← any file with
+    /// `pending`, `warning`, or `stale`; otherwise `deployed`. Always populated so
     /// JSON consumers and short-mode templates can use it uniformly.
     pub summary_status: String,
     /// Number of files in the pack whose status rolls up to
     /// `summary_status`. Displayed as `(N)` in short-mode output.
     pub summary_count: usize,
+    /// Frozen on this machine by `dodot pin`; `up` leaves it alone.
+    #[serde(skip_serializing_if = "is_false")]
+    pub pinned: bool,
+    /// Switched off on this machine by `dodot disable`.
+    #[serde(skip_serializing_if = "is_false")]
+    pub disabled: bool,
 }
 
 impl DisplayPack {
@@ -135,6 +204,8 @@ impl DisplayPack {
             files,
             summary_status,
             summary_count,
+            pinned: false,
+            disabled: false,
         }
     }
 
@@ -148,16 +219,22 @@ impl DisplayPack {
     }
 }
 
-/// Roll up per-file statuses into one of `error`, `pending`, `deployed`
-/// (precedence: error > pending > deployed). Returns the bucket name
-/// and the number of files that fall into it.
+fn is_false(b: &bool) -> bool {
+    !*b
+}
+
+/// Roll up per-file statuses into one of `error`, `degraded`,
+/// `pending`, `deployed` (precedence in that order). Returns the
+/// bucket name and the number of files that fall into it.
 fn aggregate_status(files: &[DisplayFile]) -> (String, usize) {
     let mut errors = 0usize;
+    let mut degradeds = 0usize;
     let mut pendings = 0usize;
     let mut deployeds = 0usize;
     for f in files {
         match f.status.as_str() {
             "error" | "broken" => errors += 1,
+            "degraded" => degradeds += 1,
             "pending" | "warning" | "stale" => pendings += 1,
             "deployed" => deployeds += 1,
             _ => {}
@@ -165,6 +242,8 @@ fn aggregate_status(files: &[DisplayFile]) -> (String, usize) {
     }
     if errors > 0 {
         ("error".into(), errors)
+    } else if degradeds > 0 {
+        ("degraded".into(), degradeds)
     } else if pendings > 0 {
         ("pending".into(), pendings)
     } else {
@@ -309,12 +388,19 @@ pub struct PackStatusResult {
     #[serde(skip_serializing_if = "Vec::is_empty")]
     pub ignored_packs: Vec<String>,
     /// Packs gated out by `[pack] os` on the current host. Each entry
-    /// is a pre-formatted display string (e.g. `"mac-tools (os=darwin,
-    /// current=linux)"`) so the template renders them under their own
-    /// heading without needing a typed structure. See
+    /// is a pre-formatted display string (e.g.
+    /// `"mac-tools (os=darwin, current=linux)"`) so the template
+    /// renders them under their own heading without needing a typed
+    /// structure. See
     /// `docs/proposals/conditional-running.lex` §5.3.
     #[serde(skip_serializing_if = "Vec::is_empty")]
     pub inactive_packs: Vec<String>,
+    /// Packs gated out by `[pack] roles` on this machine, in the same
+    /// display form (`"corp (role mismatch: roles=work, current=none)"`).
+    /// Kept apart from [`Self::inactive_packs`] so each gets its own
+    /// heading.
+    #[serde(skip_serializing_if = "Vec::is_empty")]
+    pub role_inactive_packs: Vec<String>,
     /// `"full"` (default) shows per-file listing; `"short"` collapses
     /// each pack to a single summary line.
     pub view_mode: String,
@@ -330,6 +416,197 @@ pub struct PackStatusResult {
     /// against packs with no `ran older version` entries).
     #[serde(skip_serializing_if = "Vec::is_empty")]
     pub diffs: Vec<DisplayDiff>,
+    /// Flattened, width-fitted rows for `view_mode == "table"`. `None`
+    /// in every other view so JSON consumers of the default output
+    /// don't see a second copy of `packs`.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub table: Option<DisplayTable>,
+    /// Typed pack → handler → item model behind `packs`. Set by
+    /// `status` (and commands that render through it); `None` for
+    /// dry-run previews, which describe planned operations rather than
+    /// verified state.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub report: Option<status_report::StatusReport>,
+    /// `"quiet"`, `"normal"` (default) or `"verbose"` — see
+    /// [`RenderVerbosity`]. Quiet renders only errors, conflicts and
+    /// `summary`; verbose adds `actions`, skipped rows and `elapsed`.
+    pub verbosity: String,
+    /// One-line rollup from [`summary_line`]. Always populated so JSON
+    /// consumers get it regardless of verbosity.
+    pub summary: String,
+    /// Per-operation lines from the run that produced this result.
+    /// Only filled at verbose level.
+    #[serde(skip_serializing_if = "Vec::is_empty")]
+    pub actions: Vec<String>,
+    /// Wall-clock time of the command. Only filled at verbose level.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub elapsed: Option<String>,
+    /// Link and Provision sections of a composite run (`up`, `down`),
+    /// from [`phase_sections`]. Empty for `status`, which has no phases
+    /// to report.
+    #[serde(skip_serializing_if = "Vec::is_empty")]
+    pub phases: Vec<DisplayPhase>,
+    /// Provisioning work a dry-run `up` would do — steps to run, brew
+    /// packages to install, bytes to download. `None` outside dry runs.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub estimate: Option<crate::execution::WorkEstimate>,
+    /// `estimate` as text lines, for the template (minijinja can't call
+    /// [`WorkEstimate::lines`](crate::execution::WorkEstimate::lines)).
+    #[serde(skip_serializing_if = "Vec::is_empty")]
+    pub estimate_lines: Vec<String>,
+    /// How the run ended. Not part of the report: the CLI turns it
+    /// into the process exit code.
+    #[serde(skip)]
+    pub exit_code: crate::ExitCode,
+}
+
+/// Totals for one half of a composite run: `link` covers the
+/// configuration handlers (symlink, shell, path, …), `provision` the
+/// run-once ones (install, homebrew, …).
+#[derive(Debug, Clone, Serialize)]
+pub struct DisplayPhase {
+    /// `"link"` or `"provision"`.
+    pub name: String,
+    /// `"Link"` or `"Provision"`, for the template.
+    pub label: String,
+    /// Rollup of the phase's rows, same buckets as
+    /// `DisplayPack.summary_status`.
+    pub status: String,
+    /// Rows that are deployed — or, on `up --dry-run`, planned.
+    pub done: usize,
+    /// Rows not (or not fully) deployed: still pending after `up`,
+    /// taken down by `down`.
+    pub pending: usize,
+    /// Rows that failed or are broken.
+    pub errors: usize,
+    /// `"3 linked, 1 pending"`, `"3 planned"` on a dry run, `"2 removed"`
+    /// for `down`.
+    pub summary: String,
+    /// Notes (1-based, into `notes`) attached to the phase's rows, so a
+    /// failure can be traced to the half of the run it came from.
+    #[serde(skip_serializing_if = "Vec::is_empty")]
+    pub note_refs: Vec<u32>,
+}
+
+/// One row of the status table: a single file of a single pack.
+#[derive(Debug, Clone, Serialize)]
+pub struct DisplayTableRow {
+    pub pack: String,
+    pub handler: String,
+    pub file: String,
+    /// Theme style name (same vocabulary as `DisplayFile.status`).
+    pub status: String,
+    pub state: String,
+    pub last_run: String,
+}
+
+/// Column widths for the status table, in characters. Every cell in
+/// `rows` already fits its column, so the template only pads.
+#[derive(Debug, Clone, Copy, Serialize, PartialEq, Eq)]
+pub struct TableWidths {
+    pub pack: usize,
+    pub handler: usize,
+    pub file: usize,
+    pub state: usize,
+    pub last_run: usize,
+}
+
+/// The `--view table` projection of a pack-status result.
+#[derive(Debug, Clone, Serialize)]
+pub struct DisplayTable {
+    pub rows: Vec<DisplayTableRow>,
+    pub widths: TableWidths,
+}
+
+/// Narrowest the file / state columns are squeezed to before we give
+/// up on fitting and let the terminal wrap.
+const MIN_FLEX_COLUMN: usize = 12;
+
+/// Separator between table columns (two spaces, like the tree view).
+const TABLE_GUTTER: usize = 2;
+
+impl DisplayTable {
+    const HEADERS: [&'static str; 5] = ["PACK", "HANDLER", "FILE", "STATE", "LAST RUN"];
+
+    /// Flatten `packs` into table rows and size the columns to fit
+    /// `max_width`. The pack, handler and last-run columns keep their
+    /// natural width; the file and state columns shrink (file first)
+    /// when the total would overflow. File paths then lose components
+    /// from the middle, states are cut at the end.
+    pub fn from_packs(packs: &[DisplayPack], max_width: usize) -> Self {
+        let mut rows: Vec<DisplayTableRow> = packs
+            .iter()
+            .flat_map(|p| {
+                p.files.iter().map(move |f| DisplayTableRow {
+                    pack: p.name.clone(),
+                    handler: f.handler.clone(),
+                    file: f.name.clone(),
+                    status: f.status.clone(),
+                    state: f.status_label.clone(),
+                    last_run: f.last_run.clone().unwrap_or_else(|| "-".into()),
+                })
+            })
+            .collect();
+
+        let [h_pack, h_handler, h_file, h_state, h_last] = Self::HEADERS;
+        let mut widths = TableWidths {
+            pack: column_width(h_pack, rows.iter().map(|r| r.pack.as_str())),
+            handler: column_width(h_handler, rows.iter().map(|r| r.handler.as_str())),
+            file: column_width(h_file, rows.iter().map(|r| r.file.as_str())),
+            state: column_width(h_state, rows.iter().map(|r| r.state.as_str())),
+            last_run: column_width(h_last, rows.iter().map(|r| r.last_run.as_str())),
+        };
+
+        let total =
+            |w: &TableWidths| w.pack + w.handler + w.file + w.state + w.last_run + TABLE_GUTTER * 4;
+        let overflow = total(&widths).saturating_sub(max_width);
+        shrink_columns(
+            &mut [&mut widths.file, &mut widths.state],
+            overflow,
+            MIN_FLEX_COLUMN,
+        );
+
+        for row in &mut rows {
+            row.file = truncate_middle(&row.file, widths.file);
+            row.state = truncate_end(&row.state, widths.state);
+        }
+
+        DisplayTable { rows, widths }
+    }
+}
+
+/// Width of the file-name column in the full view (`col(24)` in
+/// `pack-status.jinja`).
+const NAME_COLUMN: usize = 24;
+
+/// Width of the description column in the full view (`col(30)` in
+/// `pack-status.jinja`).
+const DESCRIPTION_COLUMN: usize = 30;
+
+/// Indent of a note body's continuation lines under `  [N] `, and of
+/// its `hint:` line.
+const NOTE_INDENT: usize = 6;
+
+impl PackStatusResult {
+    /// Fit the tree views to a `width`-column terminal. File names and
+    /// deploy paths that would overflow their column lose components
+    /// from the middle (`~/.config/…/init.lua`) instead of their file
+    /// name; note bodies and hints wrap with continuation lines
+    /// indented under the first. The CLI calls this once, just before
+    /// a text render — structured output keeps the full strings.
+    pub fn fit_to_width(&mut self, width: usize) {
+        for file in self.packs.iter_mut().flat_map(|p| p.files.iter_mut()) {
+            file.name = truncate_middle(&file.name, NAME_COLUMN);
+            file.description = truncate_middle(&file.description, DESCRIPTION_COLUMN);
+        }
+        for note in &mut self.notes {
+            note.body = wrap_hanging(&note.body, width, NOTE_INDENT);
+            if let Some(hint) = &note.hint {
+                let indent = NOTE_INDENT + "hint: ".len();
+                note.hint = Some(wrap_hanging(hint, width, indent));
+            }
+        }
+    }
 }
 
 /// View style for pack-status output.
@@ -338,6 +615,10 @@ pub enum ViewMode {
     #[default]
     Full,
     Short,
+    /// One aligned row per file with pack / handler / file / state /
+    /// last-run columns. Intended for large repos where the per-pack
+    /// tree scrolls off screen.
+    Table,
 }
 
 impl ViewMode {
@@ -345,8 +626,25 @@ impl ViewMode {
         match self {
             ViewMode::Full => "full",
             ViewMode::Short => "short",
+            ViewMode::Table => "table",
+        }
+    }
+
+    /// Parse the value of `--view`. Returns `None` for unknown names.
+    pub fn parse(s: &str) -> Option<Self> {
+        match s {
+            "full" => Some(ViewMode::Full),
+            "short" => Some(ViewMode::Short),
+            "table" => Some(ViewMode::Table),
+            _ => None,
         }
     }
+
+    /// Build the table projection for `packs` when this is the table
+    /// view; `None` otherwise.
+    pub fn table_for(self, packs: &[DisplayPack]) -> Option<DisplayTable> {
+        (self == ViewMode::Table).then(|| DisplayTable::from_packs(packs, terminal_width()))
+    }
 }
 
 /// Grouping style for pack-status output.
@@ -365,3 +663,179 @@ impl GroupMode {
         }
     }
 }
+
+/// How much of a pack-status result gets rendered. Orthogonal to the
+/// log level: `--verbose` also raises logging, but this field is what
+/// the `pack-status` template branches on.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Default)]
+pub enum RenderVerbosity {
+    /// Errors, conflicts and a one-line summary; no per-file rows.
+    Quiet,
+    #[default]
+    Normal,
+    /// Normal output plus per-file actions, skipped rows and timings.
+    Verbose,
+}
+
+impl RenderVerbosity {
+    pub fn as_str(self) -> &'static str {
+        match self {
+            RenderVerbosity::Quiet => "quiet",
+            RenderVerbosity::Normal => "normal",
+            RenderVerbosity::Verbose => "verbose",
+        }
+    }
+
+    pub fn is_verbose(self) -> bool {
+        self == RenderVerbosity::Verbose
+    }
+
+    /// `took 1.24s` for the verbose footer; `None` at other levels so
+    /// default JSON output stays free of wall-clock noise.
+    pub fn elapsed_since(self, started: std::time::Instant) -> Option<String> {
+        self.is_verbose()
+            .then(|| format!("took {:.2}s", started.elapsed().as_secs_f64()))
+    }
+}
+
+/// One-line rollup of a pack-status result: `"3 packs: 2 deployed,
+/// 1 pending"`. Zero buckets are left out; an empty run reads
+/// `"no packs"`.
+pub fn summary_line(packs: &[DisplayPack]) -> String {
+    if packs.is_empty() {
+        return "no packs".into();
+    }
+    let count = |status: &str| packs.iter().filter(|p| p.summary_status == status).count();
+    let buckets: Vec<String> = ["deployed", "pending", "degraded", "error"]
+        .into_iter()
+        .filter_map(|status| {
+            let n = count(status);
+            (n > 0).then(|| {
+                let label = if status == "error" && n > 1 {
+                    "errors"
+                } else {
+                    status
+                };
+                format!("{n} {label}")
+            })
+        })
+        .collect();
+    format!(
+        "{} pack{}: {}",
+        packs.len(),
+        if packs.len() == 1 { "" } else { "s" },
+        buckets.join(", ")
+    )
+}
+
+/// Split the rows of a composite run into its Link and Provision
+/// phases. `removing` is set for `down`, whose pending rows are the
+/// ones it took down. Rows of handlers outside the registry (`verify`)
+/// and skipped rows count toward neither; a phase with no rows is left
+/// out.
+pub fn phase_sections(
+    packs: &[DisplayPack],
+    removing: bool,
+    dry_run: bool,
+    fs: &dyn crate::fs::Fs,
+) -> Vec<DisplayPhase> {
+    let runner = crate::datastore::NoopCommandRunner;
+    let registry = crate::handlers::create_registry(fs, &runner);
+    let phases = [
+        (
+            "link",
+            "Link",
+            crate::handlers::HandlerCategory::Configuration,
+        ),
+        (
+            "provision",
+            "Provision",
+            crate::handlers::HandlerCategory::CodeExecution,
+        ),
+    ];
+    phases
+        .into_iter()
+        .filter_map(|(name, label, category)| {
+            let files: Vec<DisplayFile> = packs
+                .iter()
+                .flat_map(|p| &p.files)
+                .filter(|f| f.status != "skipped")
+                .filter(|f| {
+                    registry
+                        .get(&f.handler)
+                        .is_some_and(|h| h.category() == category)
+                })
+                .cloned()
+                .collect();
+            if files.is_empty() {
+                return None;
+            }
+            let count = |statuses: &[&str]| {
+                files
+                    .iter()
+                    .filter(|f| statuses.contains(&f.status.as_str()))
+                    .count()
+            };
+            let done = count(&["deployed"]);
+            let pending = count(&["pending", "warning", "stale"]);
+            let errors = count(&["error", "broken"]);
+            let done_label = match (removing, dry_run, name) {
+                (true, _, _) => "still deployed",
+                (false, true, _) => "planned",
+                (false, false, "link") => "linked",
+                (false, false, _) => "provisioned",
+            };
+            let pending_label = match (removing, dry_run) {
+                (true, true) => "to remove",
+                (true, false) => "removed",
+                (false, _) => "pending",
+            };
+            let buckets: Vec<String> = [
+                (done, done_label),
+                (pending, pending_label),
+                (errors, if errors == 1 { "error" } else { "errors" }),
+            ]
+            .into_iter()
+            .filter(|(n, _)| *n > 0)
+            .map(|(n, label)| format!("{n} {label}"))
+            .collect();
+            let mut note_refs: Vec<u32> = files.iter().filter_map(|f| f.note_ref).collect();
+            note_refs.sort_unstable();
+            note_refs.dedup();
+            Some(DisplayPhase {
+                name: name.into(),
+                label: label.into(),
+                status: aggregate_status(&files).0,
+                done,
+                pending,
+                errors,
+                summary: if buckets.is_empty() {
+                    "nothing to do".into()
+                } else {
+                    buckets.join(", ")
+                },
+                note_refs,
+            })
+        })
+        .collect()
+}
+
+/// Per-operation lines for the verbose view (`vim: linked ~/.vimrc`),
+/// in execution order. Empty unless `verbosity` is verbose.
+pub fn action_lines(
+    pack_results: &[crate::packs::orchestration::PackResult],
+    verbosity: RenderVerbosity,
+) -> Vec<String> {
+    if !verbosity.is_verbose() {
+        return Vec::new();
+    }
+    pack_results
+        .iter()
+        .flat_map(|pr| {
+            pr.operations.iter().map(move |op| {
+                let mark = if op.success { "" } else { " (failed)" };
+                format!("{}: {}{mark}", pr.pack_name, op.message)
+            })
+        })
+        .collect()
+}
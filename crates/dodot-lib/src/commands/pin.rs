@@ -0,0 +1,127 @@
+//! `pin` / `unpin` — freeze a pack on this machine, and thaw it.
+//!
+//! Storage and semantics live in [`crate::packs::pins`]; these wrap it
+//! for the CLI. `dodot pin` with no pack lists the pins.
+
+use serde::Serialize;
+
+use crate::commands::probe::format_unix_ts;
+use crate::commands::MessageResult;
+use crate::packs::orchestration::{self, ExecutionContext};
+use crate::packs::pins::{Pin, Pins};
+use crate::{packs, Result};
+
+/// One row of `dodot pin` without arguments.
+#[derive(Debug, Clone, Serialize)]
+pub struct PinnedPack {
+    /// Display name (prefix stripped).
+    pub name: String,
+    #[serde(flatten)]
+    pub pin: Pin,
+}
+
+/// `dodot pin`. `message` / `details` feed the `message` template;
+/// `pins` is every pin after the command, for `--output json`.
+#[derive(Debug, Clone, Serialize)]
+pub struct PinListResult {
+    pub message: String,
+    pub details: Vec<String>,
+    pub pins: Vec<PinnedPack>,
+}
+
+/// List this machine's pinned packs.
+pub fn list(ctx: &ExecutionContext) -> Result<PinListResult> {
+    let pins: Vec<PinnedPack> = Pins::load(ctx.fs.as_ref(), ctx.paths.as_ref())?
+        .iter()
+        .map(|(dir, pin)| PinnedPack {
+            name: packs::display_name_for(dir).to_string(),
+            pin: pin.clone(),
+        })
+        .collect();
+    let message = if pins.is_empty() {
+        "No packs are pinned.".to_string()
+    } else {
+        format!(
+            "{} pack(s) pinned; `dodot up` leaves them alone until `dodot unpin <pack>`.",
+            pins.len()
+        )
+    };
+    let details = pins
+        .iter()
+        .map(|p| match &p.pin.reason {
+            Some(reason) => format!(
+                "{}  pinned {}  — {reason}",
+                p.name,
+                format_unix_ts(p.pin.pinned_at)
+            ),
+            None => format!("{}  pinned {}", p.name, format_unix_ts(p.pin.pinned_at)),
+        })
+        .collect();
+    Ok(PinListResult {
+        message,
+        details,
+        pins,
+    })
+}
+
+/// Pin `pack_name` so `up`, `plan` and `provision` skip it.
+pub fn pin(pack_name: &str, reason: Option<&str>, ctx: &ExecutionContext) -> Result<PinListResult> {
+    let pack_dir = orchestration::resolve_pack_dir_name(pack_name, ctx)?;
+    let display = packs::display_name_for(&pack_dir);
+    let mut pins = Pins::load(ctx.fs.as_ref(), ctx.paths.as_ref())?;
+    let pinned = pins.pin(
+        &pack_dir,
+        Pin {
+            pinned_at: crate::datastore::sentinel::unix_now(),
+            reason: reason.map(str::to_string),
+        },
+    );
+    let mut details = Vec::new();
+    let message = if pinned {
+        pins.save(ctx.fs.as_ref(), ctx.paths.as_ref())?;
+        if ctx.datastore.list_pack_handlers(&pack_dir)?.is_empty() {
+            details.push(format!(
+                "Pack '{display}' isn't deployed here, so it stays undeployed while pinned."
+            ));
+        }
+        format!(
+            "Pack '{display}' pinned. `dodot up` will leave it as it is until `dodot unpin {display}`."
+        )
+    } else {
+        format!("Pack '{display}' is already pinned.")
+    };
+    Ok(PinListResult {
+        message,
+        details,
+        pins: list(ctx)?.pins,
+    })
+}
+
+/// Unpin `pack_name`. A pin whose pack left the dotfiles root can
+/// still be removed by name.
+pub fn unpin(pack_name: &str, ctx: &ExecutionContext) -> Result<MessageResult> {
+    let mut pins = Pins::load(ctx.fs.as_ref(), ctx.paths.as_ref())?;
+    let pack_dir = match orchestration::resolve_pack_dir_name(pack_name, ctx) {
+        Ok(dir) => dir,
+        Err(e) => pins
+            .iter()
+            .map(|(dir, _)| dir)
+            .find(|dir| *dir == pack_name || packs::display_name_for(dir) == pack_name)
+            .map(str::to_string)
+            .ok_or(e)?,
+    };
+    let display = packs::display_name_for(&pack_dir);
+    if !pins.unpin(&pack_dir) {
+        return Ok(MessageResult {
+            message: format!("Pack '{display}' is not pinned."),
+            details: Vec::new(),
+        });
+    }
+    pins.save(ctx.fs.as_ref(), ctx.paths.as_ref())?;
+    Ok(MessageResult {
+        message: format!(
+            "Pack '{display}' unpinned. Run `dodot up {display}` to bring it up to date."
+        ),
+        details: Vec::new(),
+    })
+}
@@ -0,0 +1,341 @@
+//! `plan` and `apply` — preview `up` as a saved action set, then run it.
+//!
+//! `dodot plan` works out what `dodot up` would change without touching
+//! anything: files to add (not deployed yet), to change (deployed but
+//! stale or broken), and to remove (datastore entries whose source left
+//! the pack). The plan can be written to a file; `dodot apply <file>`
+//! re-plans, refuses if anything drifted, and otherwise runs `up` over
+//! the same packs with the same flags.
+//!
+//! Drift is anything that would make the run differ from the preview:
+//! a pack's contents (a digest of the whole pack directory), the
+//! resolved root config, the set of planned packs, or the computed
+//! changes themselves (someone ran `up` or edited a deployed file in
+//! between). A stale plan applies nothing.
+
+use std::collections::BTreeSet;
+use std::path::Path;
+
+use serde::{Deserialize, Serialize};
+use tracing::info;
+
+use crate::commands::{status, PackStatusResult};
+use crate::copies;
+use crate::fs::Fs;
+use crate::handlers;
+use crate::packs::orchestration::{self, ExecutionContext};
+use crate::preprocessing::baseline::hex_sha256;
+use crate::probe::{collect_deployment_map, DeploymentKind};
+use crate::{DodotError, Result};
+
+/// Bumped when the plan file layout changes; `apply` refuses others.
+pub const PLAN_FORMAT: u32 = 1;
+
+/// What `up` would do to one file.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum ChangeKind {
+    Add,
+    Change,
+    Remove,
+}
+
+/// One planned change.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct PlannedChange {
+    pub kind: ChangeKind,
+    pub handler: String,
+    /// Pack-relative path.
+    pub name: String,
+    /// Deploy path with `$HOME` collapsed, for link items.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub target: Option<String>,
+    /// Why a deployed file changes, or what blocks an add.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub reason: Option<String>,
+}
+
+/// One pack's changes, with the digest of its contents at plan time.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct PlannedPack {
+    /// Display name (prefix stripped).
+    pub name: String,
+    pub checksum: String,
+    pub changes: Vec<PlannedChange>,
+}
+
+/// A saved plan: what `dodot plan` wrote and `dodot apply` reads.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct Plan {
+    pub format: u32,
+    /// Unix seconds.
+    pub created_at: u64,
+    /// Pack selectors as given; empty means every pack.
+    pub selection: Vec<String>,
+    pub no_provision: bool,
+    /// Digest of the resolved root config.
+    pub config_checksum: String,
+    pub packs: Vec<PlannedPack>,
+}
+
+impl Plan {
+    /// `(add, change, remove)` counts.
+    pub fn counts(&self) -> (usize, usize, usize) {
+        let changes = self.packs.iter().flat_map(|p| &p.changes);
+        let mut counts = (0, 0, 0);
+        for change in changes {
+            match change.kind {
+                ChangeKind::Add => counts.0 += 1,
+                ChangeKind::Change => counts.1 += 1,
+                ChangeKind::Remove => counts.2 += 1,
+            }
+        }
+        counts
+    }
+
+    /// `2 to add, 1 to change, 0 to remove`.
+    pub fn summary(&self) -> String {
+        let (add, change, remove) = self.counts();
+        format!("{add} to add, {change} to change, {remove} to remove")
+    }
+
+    /// Ways `current` differs from this plan. Empty when the plan still
+    /// describes exactly what `up` would do.
+    pub fn drift(&self, current: &Plan) -> Vec<String> {
+        let mut reasons = Vec::new();
+        if self.config_checksum != current.config_checksum {
+            reasons.push("the root config changed".to_string());
+        }
+        for pack in &self.packs {
+            match current.packs.iter().find(|p| p.name == pack.name) {
+                None => reasons.push(format!("pack `{}` is gone", pack.name)),
+                Some(now) if now.checksum != pack.checksum => {
+                    reasons.push(format!("pack `{}` was edited", pack.name))
+                }
+                Some(now) if now.changes != pack.changes => {
+                    reasons.push(format!("pack `{}` has different changes now", pack.name))
+                }
+                Some(_) => {}
+            }
+        }
+        for pack in &current.packs {
+            if !self.packs.iter().any(|p| p.name == pack.name) {
+                reasons.push(format!("pack `{}` is new", pack.name));
+            }
+        }
+        reasons
+    }
+}
+
+/// Result of `dodot plan`.
+#[derive(Debug, Clone, Serialize)]
+pub struct PlanResult {
+    pub message: String,
+    pub summary: String,
+    /// Where the plan was written, if it was.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub path: Option<String>,
+    pub plan: Plan,
+}
+
+/// Compute the plan for `pack_filter` without changing anything.
+/// `ctx.no_provision` leaves provisioning handlers out, as it does
+/// for `up`.
+pub fn plan(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<Plan> {
+    let expanded = pack_filter
+        .map(|names| orchestration::expand_pack_selectors(names, ctx))
+        .transpose()?;
+    let mut packs = orchestration::prepare_packs(expanded.as_deref(), ctx)?;
+    // `apply` runs `up`, which leaves pinned, disabled and incompatible
+    // packs alone.
+    orchestration::drop_pinned(&mut packs, ctx)?;
+    orchestration::drop_disabled(&mut packs, ctx)?;
+    orchestration::drop_incompatible(&mut packs, ctx)?;
+    let pack_names: Vec<String> = packs.iter().map(|p| p.display_name.clone()).collect();
+    let report = status::status(Some(&pack_names), ctx)?
+        .report
+        .unwrap_or_default();
+    let config_handlers = handlers::configuration_handler_names(ctx.fs.as_ref());
+    let deployed = collect_deployment_map(ctx.fs.as_ref(), ctx.paths.as_ref())?;
+
+    let config = serde_json::to_vec(&ctx.config_manager.root_config()?)
+        .map_err(|e| DodotError::Other(format!("config serialization failed: {e}")))?;
+
+    let mut planned = Vec::with_capacity(packs.len());
+    for pack in &packs {
+        let items: Vec<_> = report
+            .packs
+            .iter()
+            .filter(|p| p.name == pack.display_name)
+            .flat_map(|p| &p.handlers)
+            .flat_map(|h| &h.items)
+            .collect();
+
+        let mut changes = Vec::new();
+        for item in &items {
+            let provisioning = !config_handlers.contains(&item.handler);
+            if provisioning && ctx.no_provision {
+                continue;
+            }
+            let kind = match item.state.as_str() {
+                "pending" | "warning" => ChangeKind::Add,
+                // Run-once files that ran an older version wait for
+                // `--provision-rerun`; plain `up` leaves them alone.
+                "stale" if provisioning => continue,
+                "stale" | "broken" => ChangeKind::Change,
+                _ => continue,
+            };
+            changes.push(PlannedChange {
+                kind,
+                handler: item.handler.clone(),
+                name: item.name.clone(),
+                target: item.target.clone(),
+                reason: (kind == ChangeKind::Change || item.state == "warning")
+                    .then(|| item.detail.clone().unwrap_or_else(|| item.label.clone())),
+            });
+        }
+
+        // `up` rebuilds configuration handler state from scratch, so a
+        // recorded link whose source no longer matches goes away.
+        let current: BTreeSet<(&str, &str)> = items
+            .iter()
+            .map(|i| (i.handler.as_str(), i.name.as_str()))
+            .collect();
+        for entry in deployed.iter().filter(|e| {
+            e.pack == pack.name
+                && e.kind == DeploymentKind::Symlink
+                && config_handlers.contains(&e.handler)
+        }) {
+            let Some(rel) = pack_relative(&entry.source, &pack.path) else {
+                continue;
+            };
+            let covered = current.iter().any(|(handler, name)| {
+                *handler == entry.handler
+                    && (*name == rel
+                        || rel.starts_with(&format!("{name}/"))
+                        || name.starts_with(&format!("{rel}/")))
+            });
+            if !covered {
+                changes.push(PlannedChange {
+                    kind: ChangeKind::Remove,
+                    handler: entry.handler.clone(),
+                    name: rel,
+                    target: None,
+                    reason: Some("no longer in the pack".into()),
+                });
+            }
+        }
+
+        planned.push(PlannedPack {
+            name: pack.display_name.clone(),
+            checksum: copies::content_hash(ctx.fs.as_ref(), &pack.path)?,
+            changes,
+        });
+    }
+
+    Ok(Plan {
+        format: PLAN_FORMAT,
+        created_at: crate::datastore::sentinel::unix_now(),
+        selection: pack_filter.map(<[String]>::to_vec).unwrap_or_default(),
+        no_provision: ctx.no_provision,
+        config_checksum: hex_sha256(&config)[..16].to_string(),
+        packs: planned,
+    })
+}
+
+/// `dodot plan`: compute the plan and, with `out`, write it there for
+/// `dodot apply`.
+pub fn plan_command(
+    pack_filter: Option<&[String]>,
+    out: Option<&Path>,
+    ctx: &ExecutionContext,
+) -> Result<PlanResult> {
+    let plan = plan(pack_filter, ctx)?;
+    if let Some(path) = out {
+        save(ctx.fs.as_ref(), path, &plan)?;
+    }
+    let summary = plan.summary();
+    let message = match out {
+        Some(path) => format!(
+            "Plan: {summary}. Saved to {}; run `dodot apply {}` to deploy it.",
+            path.display(),
+            path.display()
+        ),
+        None => format!("Plan: {summary}."),
+    };
+    Ok(PlanResult {
+        message,
+        summary,
+        path: out.map(|p| p.display().to_string()),
+        plan,
+    })
+}
+
+/// Run a saved plan: re-plan with the same selection, refuse on drift,
+/// then `up` the same packs. `ctx.no_provision` must match the plan's;
+/// the CLI sets it from the file.
+pub fn apply(saved: &Plan, ctx: &ExecutionContext) -> Result<PackStatusResult> {
+    if saved.no_provision != ctx.no_provision {
+        return Err(DodotError::Other(format!(
+            "plan was made {} --no-provision; apply it the same way",
+            if saved.no_provision {
+                "with"
+            } else {
+                "without"
+            }
+        )));
+    }
+    let selection = (!saved.selection.is_empty()).then_some(saved.selection.as_slice());
+    let current = plan(selection, ctx)?;
+    let drift = saved.drift(&current);
+    if !drift.is_empty() {
+        info!(count = drift.len(), "plan is stale");
+        return Err(DodotError::Other(format!(
+            "the plan is stale, nothing was applied:\n  - {}\nrun `dodot plan` again",
+            drift.join("\n  - ")
+        )));
+    }
+    crate::commands::up::up(selection, ctx)
+}
+
+/// Write `plan` to `path` as JSON.
+pub fn save(fs: &dyn Fs, path: &Path, plan: &Plan) -> Result<()> {
+    let body = serde_json::to_string_pretty(plan)
+        .map_err(|e| DodotError::Other(format!("plan serialization failed: {e}")))?;
+    if let Some(parent) = path.parent().filter(|p| !p.as_os_str().is_empty()) {
+        fs.mkdir_all(parent)?;
+    }
+    fs.write_file_atomic(path, body.as_bytes())
+}
+
+/// Read a plan written by [`save`].
+pub fn load(fs: &dyn Fs, path: &Path) -> Result<Plan> {
+    let text = fs.read_to_string(path)?;
+    let plan: Plan = serde_json::from_str(&text)
+        .map_err(|e| DodotError::Other(format!("{} is not a dodot plan: {e}", path.display())))?;
+    if plan.format != PLAN_FORMAT {
+        return Err(DodotError::Other(format!(
+            "{} is plan format {}, this dodot reads {PLAN_FORMAT}; run `dodot plan` again",
+            path.display(),
+            plan.format
+        )));
+    }
+    Ok(plan)
+}
+
+/// `source` relative to `pack_dir`, also across a symlinked dotfiles
+/// root.
+fn pack_relative(source: &Path, pack_dir: &Path) -> Option<String> {
+    if source.as_os_str().is_empty() {
+        return None;
+    }
+    let rel = source
+        .strip_prefix(pack_dir)
+        .ok()
+        .map(Path::to_path_buf)
+        .or_else(|| {
+            let canonical = pack_dir.canonicalize().ok()?;
+            source.strip_prefix(canonical).ok().map(Path::to_path_buf)
+        })?;
+    Some(rel.to_string_lossy().into_owned())
+}
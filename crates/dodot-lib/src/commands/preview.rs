@@ -0,0 +1,271 @@
+//! `preview` — every path `up` would put a link at, as a tree.
+//!
+//! `dodot plan` answers "what changes, per pack"; `dodot preview`
+//! answers "what happens to my home directory". It plans the same
+//! packs `up` would, then looks at each link target on disk and sorts
+//! it into one of three buckets:
+//!
+//! - *create* — nothing is there yet;
+//! - *replace* — something `up` takes over without asking: a symlink
+//!   (another host's included), a byte-identical copy, or dodot's own
+//!   stale or broken link;
+//! - *conflict* — a file or directory `up` refuses to touch without
+//!   `--force`, or a path two packs claim, which `up` refuses even
+//!   with `--force`.
+//!
+//! Targets already deployed are counted but left out of the tree.
+//! Only link targets are shown: shell and path entries and run-once
+//! sentinels live in dodot's data directory, not at a path of the
+//! user's choosing.
+
+use std::collections::BTreeMap;
+use std::path::{Path, PathBuf};
+
+use serde::Serialize;
+
+use crate::commands::status;
+use crate::fs::Fs;
+use crate::packs::orchestration::{self, ExecutionContext};
+use crate::paths::expand_tilde;
+use crate::Result;
+
+/// What `up` would do at one path.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "lowercase")]
+pub enum PathAction {
+    Create,
+    Replace,
+    Conflict,
+}
+
+/// One link target.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct PreviewPath {
+    /// Deploy path with `$HOME` collapsed.
+    pub path: String,
+    pub action: PathAction,
+    /// Pack display name.
+    pub pack: String,
+    pub handler: String,
+    /// Pack-relative source.
+    pub source: String,
+    /// What is in the way, for replace and conflict.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub reason: Option<String>,
+}
+
+/// One row of the rendered tree.
+#[derive(Debug, Clone, Serialize)]
+pub struct PreviewLine {
+    /// Box-drawing indent (`"│  ├─ "`).
+    pub prefix: String,
+    pub name: String,
+    /// Set on link targets; directories have none.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub action: Option<PathAction>,
+    /// `pack/source (handler)` and the reason, or `new` for a
+    /// directory `up` would create.
+    pub note: String,
+}
+
+/// Result of `dodot preview`.
+#[derive(Debug, Clone, Serialize)]
+pub struct PreviewResult {
+    pub message: String,
+    pub paths: Vec<PreviewPath>,
+    /// Targets already deployed as planned.
+    pub unchanged: usize,
+    pub lines: Vec<PreviewLine>,
+    #[serde(skip_serializing_if = "Vec::is_empty")]
+    pub warnings: Vec<String>,
+}
+
+/// Compute the preview for `pack_filter` without changing anything.
+pub fn preview(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<PreviewResult> {
+    let expanded = pack_filter
+        .map(|names| orchestration::expand_pack_selectors(names, ctx))
+        .transpose()?;
+    let mut packs = orchestration::prepare_packs(expanded.as_deref(), ctx)?;
+    // The packs `up` would deploy.
+    let mut warnings = orchestration::drop_pinned(&mut packs, ctx)?;
+    warnings.extend(orchestration::drop_disabled(&mut packs, ctx)?);
+    warnings.extend(orchestration::drop_incompatible(&mut packs, ctx)?);
+    let pack_names: Vec<String> = packs.iter().map(|p| p.display_name.clone()).collect();
+    let status = status::status(Some(&pack_names), ctx)?;
+    warnings.extend(status.warnings);
+    let contested: BTreeMap<&str, String> = status
+        .conflicts
+        .iter()
+        .filter(|c| c.kind == "symlink")
+        .map(|c| {
+            let claimants: Vec<String> = c
+                .claimants
+                .iter()
+                .map(|cl| format!("{}/{}", cl.pack, cl.source))
+                .collect();
+            (
+                c.target.as_str(),
+                format!("claimed by {}", claimants.join(" and ")),
+            )
+        })
+        .collect();
+    let report = status.report.unwrap_or_default();
+
+    let fs = ctx.fs.as_ref();
+    let home = ctx.paths.home_dir();
+    let mut paths = Vec::new();
+    let mut unchanged = 0;
+    for pack in &report.packs {
+        for item in pack.handlers.iter().flat_map(|h| &h.items) {
+            let Some(target) = &item.target else {
+                continue;
+            };
+            let reason = || item.detail.clone().unwrap_or_else(|| item.label.clone());
+            let (action, reason) = match item.state.as_str() {
+                _ if contested.contains_key(target.as_str()) => (
+                    PathAction::Conflict,
+                    contested.get(target.as_str()).cloned(),
+                ),
+                "pending" => {
+                    let on_disk = expand_tilde(target, home);
+                    if fs.is_symlink(&on_disk) {
+                        let link = fs.readlink(&on_disk).unwrap_or_default();
+                        let link = format!("a symlink to {}", collapse_home(&link, home));
+                        (PathAction::Replace, Some(link))
+                    } else if fs.exists(&on_disk) {
+                        (PathAction::Replace, Some("an identical copy".to_string()))
+                    } else {
+                        (PathAction::Create, None)
+                    }
+                }
+                // A link from a host sharing this home is taken over.
+                "warning" if reason().starts_with("linked by host") => {
+                    (PathAction::Replace, Some(reason()))
+                }
+                "warning" => (PathAction::Conflict, Some(reason())),
+                "broken" if item.label.starts_with("conflict") => {
+                    (PathAction::Conflict, Some(reason()))
+                }
+                "stale" | "broken" => (PathAction::Replace, Some(reason())),
+                _ => {
+                    unchanged += 1;
+                    continue;
+                }
+            };
+            paths.push(PreviewPath {
+                path: target.clone(),
+                action,
+                pack: pack.name.clone(),
+                handler: item.handler.clone(),
+                source: item.name.clone(),
+                reason,
+            });
+        }
+    }
+    paths.sort_by(|a, b| a.path.cmp(&b.path));
+
+    let lines = tree_lines(&paths, fs, home);
+    let count = |action| paths.iter().filter(|p| p.action == action).count();
+    let conflicts = count(PathAction::Conflict);
+    let mut message = format!(
+        "Preview: {} to create, {} to replace, {conflicts} in conflict ({unchanged} already in place).",
+        count(PathAction::Create),
+        count(PathAction::Replace),
+    );
+    if conflicts > 0 {
+        message.push_str(" `dodot up` stops at conflicts until they are resolved.");
+    }
+    Ok(PreviewResult {
+        message,
+        paths,
+        unchanged,
+        lines,
+        warnings,
+    })
+}
+
+/// A directory in the tree; `entry` indexes the path that ends here.
+#[derive(Default)]
+struct Node {
+    children: BTreeMap<String, Node>,
+    entry: Option<usize>,
+}
+
+/// Lay `paths` out as a tree under `~` (and `/` for targets outside
+/// the home directory), marking directories that don't exist yet.
+fn tree_lines(paths: &[PreviewPath], fs: &dyn Fs, home: &Path) -> Vec<PreviewLine> {
+    let mut roots: BTreeMap<String, Node> = BTreeMap::new();
+    for (i, p) in paths.iter().enumerate() {
+        let (root, rest) = match p.path.strip_prefix("~/") {
+            Some(rest) => ("~", rest),
+            None => ("/", p.path.trim_start_matches('/')),
+        };
+        let mut node = roots.entry(root.to_string()).or_default();
+        for part in rest.split('/').filter(|s| !s.is_empty()) {
+            node = node.children.entry(part.to_string()).or_default();
+        }
+        node.entry = Some(i);
+    }
+
+    let mut lines = Vec::new();
+    for (name, node) in &roots {
+        let dir = if name == "~" {
+            home.to_path_buf()
+        } else {
+            PathBuf::from("/")
+        };
+        lines.push(PreviewLine {
+            prefix: String::new(),
+            name: name.clone(),
+            action: None,
+            note: String::new(),
+        });
+        flatten(node, &dir, "", paths, fs, &mut lines);
+    }
+    lines
+}
+
+fn flatten(
+    node: &Node,
+    dir: &Path,
+    prefix: &str,
+    paths: &[PreviewPath],
+    fs: &dyn Fs,
+    out: &mut Vec<PreviewLine>,
+) {
+    let last = node.children.len().saturating_sub(1);
+    for (i, (name, child)) in node.children.iter().enumerate() {
+        let (branch, indent) = if i == last {
+            ("└─ ", "   ")
+        } else {
+            ("├─ ", "│  ")
+        };
+        let path = dir.join(name);
+        let (action, note) = match child.entry {
+            Some(e) => {
+                let p = &paths[e];
+                let mut note = format!("{}/{} ({})", p.pack, p.source, p.handler);
+                if let Some(reason) = &p.reason {
+                    note.push_str(&format!(" — {reason}"));
+                }
+                (Some(p.action), note)
+            }
+            None if !fs.exists(&path) => (None, "new".to_string()),
+            None => (None, String::new()),
+        };
+        out.push(PreviewLine {
+            prefix: format!("{prefix}{branch}"),
+            name: name.clone(),
+            action,
+            note,
+        });
+        flatten(child, &path, &format!("{prefix}{indent}"), paths, fs, out);
+    }
+}
+
+fn collapse_home(path: &Path, home: &Path) -> String {
+    match path.strip_prefix(home) {
+        Ok(rel) => format!("~/{}", rel.display()),
+        Err(_) => path.display().to_string(),
+    }
+}
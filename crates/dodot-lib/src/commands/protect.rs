@@ -0,0 +1,456 @@
+//! `dodot protect` — manage `[symlink] protected_paths`.
+//!
+//! `list` shows every protected path and where it comes from; `add`
+//! and `remove` edit the list in the root `.dodot.toml`, or with
+//! `--pack` in that pack's, whose entries add to the root's (see
+//! [`crate::config::ConfigManager::config_for_pack`]). Entries are
+//! relative to `$HOME` and may be globs; the symlink handler refuses
+//! any file they cover.
+//!
+//! Only the `protected_paths` array is rewritten, so comments and
+//! layout elsewhere in the file survive. A list in the root file
+//! replaces the built-in defaults, so the first `add` there writes the
+//! defaults out along with the new entry.
+
+use std::path::{Path, PathBuf};
+
+use serde::Serialize;
+
+use crate::commands::MessageResult;
+use crate::fs::Fs;
+use crate::packs::orchestration::{self, ExecutionContext};
+use crate::{packs, DodotError, Result};
+
+/// Config file the lists live in.
+const CONFIG_FILE: &str = ".dodot.toml";
+
+/// One row of `dodot protect list`.
+#[derive(Debug, Clone, Serialize)]
+pub struct ProtectedPath {
+    pub path: String,
+    /// `default`, `root`, or the pack that added it.
+    pub source: String,
+}
+
+/// `dodot protect list`. `message` / `details` feed the `message`
+/// template; `paths` is the full list for `--output json`.
+#[derive(Debug, Clone, Serialize)]
+pub struct ProtectListResult {
+    pub message: String,
+    pub details: Vec<String>,
+    pub paths: Vec<ProtectedPath>,
+}
+
+/// Every protected path: the root list (or the defaults), then what
+/// each pack adds.
+pub fn list(ctx: &ExecutionContext) -> Result<ProtectListResult> {
+    let fs = ctx.fs.as_ref();
+    let (root, source) = match own_list(fs, &root_file(ctx))? {
+        Some(list) => (list, "root"),
+        None => (root_list(ctx)?, "default"),
+    };
+    let mut paths: Vec<ProtectedPath> = root
+        .iter()
+        .map(|path| ProtectedPath {
+            path: path.clone(),
+            source: source.into(),
+        })
+        .collect();
+
+    let root_config = ctx.config_manager.root_config()?;
+    let scanned = packs::scan_root(fs, ctx.paths.dotfiles_root(), &root_config.pack)?;
+    for pack in &scanned.packs {
+        for path in own_list(fs, &pack.path.join(CONFIG_FILE))?.unwrap_or_default() {
+            if !root.contains(&path) {
+                paths.push(ProtectedPath {
+                    path,
+                    source: pack.display_name.clone(),
+                });
+            }
+        }
+    }
+
+    let width = paths.iter().map(|p| p.path.len()).max().unwrap_or(0);
+    let details = paths
+        .iter()
+        .map(|p| format!("{:width$}  {}", p.path, p.source))
+        .collect();
+    let message = if paths.is_empty() {
+        "Nothing is protected; `dodot protect add <path>` adds a path.".to_string()
+    } else {
+        format!(
+            "{} protected path(s); the symlink handler won't link anything they cover.",
+            paths.len()
+        )
+    };
+    Ok(ProtectListResult {
+        message,
+        details,
+        paths,
+    })
+}
+
+/// Protect `path`, in the root config or in `pack`'s.
+pub fn add(path: &str, pack: Option<&str>, ctx: &ExecutionContext) -> Result<MessageResult> {
+    let entry = normalize(path, ctx.paths.home_dir())?;
+    let layer = Layer::new(pack, ctx)?;
+    let root = match own_list(ctx.fs.as_ref(), &root_file(ctx))? {
+        Some(list) => list,
+        None => root_list(ctx)?,
+    };
+    if root.contains(&entry) {
+        return Ok(message(format!(
+            "`{entry}` is already protected by the root config."
+        )));
+    }
+    let mut list = layer.current(root, ctx)?;
+    if list.contains(&entry) {
+        return Ok(message(format!(
+            "`{entry}` is already protected by {}.",
+            layer.label
+        )));
+    }
+    list.push(entry.clone());
+    write_list(ctx.fs.as_ref(), &layer.file, &list)?;
+    Ok(MessageResult {
+        message: format!("Protected `{entry}` in {}.", layer.label),
+        details: vec![
+            "Files it covers are refused by the symlink handler; see `dodot protect list`.".into(),
+        ],
+    })
+}
+
+/// Stop protecting `path`, in the root config or in `pack`'s.
+pub fn remove(path: &str, pack: Option<&str>, ctx: &ExecutionContext) -> Result<MessageResult> {
+    let entry = normalize(path, ctx.paths.home_dir())?;
+    let layer = Layer::new(pack, ctx)?;
+    let root = match own_list(ctx.fs.as_ref(), &root_file(ctx))? {
+        Some(list) => list,
+        None => root_list(ctx)?,
+    };
+    let mut list = layer.current(root.clone(), ctx)?;
+    let Some(index) = list.iter().position(|p| *p == entry) else {
+        let hint = match pack {
+            Some(_) if root.contains(&entry) => {
+                " It comes from the root config; run without `--pack` to remove it."
+            }
+            None => " If a pack adds it, name the pack with `--pack`.",
+            Some(_) => "",
+        };
+        return Ok(message(format!(
+            "`{entry}` is not protected by {}.{hint}",
+            layer.label
+        )));
+    };
+    list.remove(index);
+    write_list(ctx.fs.as_ref(), &layer.file, &list)?;
+    Ok(message(format!(
+        "`{entry}` is no longer protected by {}.",
+        layer.label
+    )))
+}
+
+fn message(message: String) -> MessageResult {
+    MessageResult {
+        message,
+        details: Vec::new(),
+    }
+}
+
+/// The config file an edit goes to.
+struct Layer {
+    file: PathBuf,
+    /// "the root config" or "pack <name>".
+    label: String,
+    is_pack: bool,
+}
+
+impl Layer {
+    fn new(pack: Option<&str>, ctx: &ExecutionContext) -> Result<Self> {
+        Ok(match pack {
+            Some(name) => {
+                let dir = orchestration::resolve_pack_dir_name(name, ctx)?;
+                Layer {
+                    file: ctx.paths.dotfiles_root().join(&dir).join(CONFIG_FILE),
+                    label: format!("pack {}", packs::display_name_for(&dir)),
+                    is_pack: true,
+                }
+            }
+            None => Layer {
+                file: root_file(ctx),
+                label: "the root config".into(),
+                is_pack: false,
+            },
+        })
+    }
+
+    /// The list this layer holds now. `root` is the root's effective
+    /// list; a pack's list is only its additions.
+    fn current(&self, root: Vec<String>, ctx: &ExecutionContext) -> Result<Vec<String>> {
+        if self.is_pack {
+            Ok(own_list(ctx.fs.as_ref(), &self.file)?.unwrap_or_default())
+        } else {
+            Ok(root)
+        }
+    }
+}
+
+fn root_file(ctx: &ExecutionContext) -> PathBuf {
+    ctx.paths.dotfiles_root().join(CONFIG_FILE)
+}
+
+/// The root list as configured, defaults included.
+fn root_list(ctx: &ExecutionContext) -> Result<Vec<String>> {
+    Ok(ctx.config_manager.root_config()?.symlink.protected_paths)
+}
+
+/// Turn what the user typed into a `$HOME`-relative entry: `~/` and
+/// `$HOME/` are dropped, as is the home directory from an absolute
+/// path. Paths outside `$HOME` are refused — `[system] protected`
+/// guards those.
+fn normalize(input: &str, home: &Path) -> Result<String> {
+    let trimmed = input.trim().trim_end_matches('/');
+    let relative = if let Some(rest) = trimmed
+        .strip_prefix("~/")
+        .or_else(|| trimmed.strip_prefix("$HOME/"))
+    {
+        rest.to_string()
+    } else if trimmed.starts_with('/') {
+        match Path::new(trimmed).strip_prefix(home) {
+            Ok(rest) => rest.to_string_lossy().into_owned(),
+            Err(_) => {
+                return Err(DodotError::Other(format!(
+                    "{input} is outside $HOME; protected paths are relative to it \
+                     (system targets are guarded by `[system] protected`)"
+                )))
+            }
+        }
+    } else {
+        trimmed.strip_prefix("./").unwrap_or(trimmed).to_string()
+    };
+    if relative.is_empty() || relative.split('/').any(|c| c == "..") {
+        return Err(DodotError::Other(format!(
+            "{input:?} is not a path below $HOME"
+        )));
+    }
+    glob::Pattern::new(&relative)
+        .map_err(|e| DodotError::Other(format!("invalid pattern {relative:?}: {e}")))?;
+    Ok(relative)
+}
+
+/// `[symlink] protected_paths` as written in `file`, without defaults
+/// or includes. `None` when the file or the key is missing.
+fn own_list(fs: &dyn Fs, file: &Path) -> Result<Option<Vec<String>>> {
+    if !fs.exists(file) {
+        return Ok(None);
+    }
+    let text = String::from_utf8(fs.read_file(file)?)
+        .map_err(|_| DodotError::Config(format!("{} is not UTF-8", file.display())))?;
+    let table: toml::Table = text
+        .parse()
+        .map_err(|e| DodotError::Config(format!("failed to parse {}: {e}", file.display())))?;
+    Ok(list_in(&table))
+}
+
+fn list_in(table: &toml::Table) -> Option<Vec<String>> {
+    let items = table
+        .get("symlink")?
+        .as_table()?
+        .get("protected_paths")?
+        .as_array()?;
+    Some(
+        items
+            .iter()
+            .filter_map(|v| v.as_str().map(str::to_string))
+            .collect(),
+    )
+}
+
+/// Write `list` as `file`'s `[symlink] protected_paths`. The result is
+/// parsed back before it's saved, so a file this editor misreads is
+/// reported rather than damaged.
+fn write_list(fs: &dyn Fs, file: &Path, list: &[String]) -> Result<()> {
+    let text = if fs.exists(file) {
+        String::from_utf8(fs.read_file(file)?)
+            .map_err(|_| DodotError::Config(format!("{} is not UTF-8", file.display())))?
+    } else {
+        String::new()
+    };
+    let updated = set_protected_paths(&text, list);
+    let written = updated
+        .parse::<toml::Table>()
+        .ok()
+        .and_then(|table| list_in(&table));
+    if written.as_deref() != Some(list) {
+        return Err(DodotError::Config(format!(
+            "couldn't update {}; edit `[symlink] protected_paths` there by hand",
+            file.display()
+        )));
+    }
+    fs.write_file(file, updated.as_bytes())
+}
+
+/// `text` with its `[symlink] protected_paths` set to `list`: the
+/// existing array replaced in place, or the key (and if need be the
+/// section) added.
+fn set_protected_paths(text: &str, list: &[String]) -> String {
+    let assignment = format!("protected_paths = {}", format_array(list));
+
+    let mut offset = 0;
+    let mut section: Option<usize> = None;
+    for line in text.split_inclusive('\n') {
+        let start = offset;
+        offset += line.len();
+        let trimmed = line.trim();
+        if trimmed.starts_with('[') {
+            if section.is_some() {
+                break;
+            }
+            let header = trimmed.split('#').next().unwrap_or("").trim();
+            if header
+                .strip_prefix('[')
+                .and_then(|h| h.strip_suffix(']'))
+                .is_some_and(|name| name.trim() == "symlink")
+            {
+                section = Some(offset);
+            }
+            continue;
+        }
+        let Some(rest) = section.and(trimmed.strip_prefix("protected_paths")) else {
+            continue;
+        };
+        let Some(value) = rest.trim_start().strip_prefix('=') else {
+            continue;
+        };
+        let key_start = start + (line.len() - line.trim_start().len());
+        let value_start = key_start + trimmed.len() - value.len();
+        let Some(end) = array_end(text, value_start) else {
+            break;
+        };
+        return format!("{}{assignment}{}", &text[..key_start], &text[end..]);
+    }
+
+    match section {
+        Some(at) => {
+            let newline = if text[..at].ends_with('\n') { "" } else { "\n" };
+            format!("{}{newline}{assignment}\n{}", &text[..at], &text[at..])
+        }
+        None => {
+            let mut out = text.to_string();
+            if !out.is_empty() {
+                if !out.ends_with('\n') {
+                    out.push('\n');
+                }
+                out.push('\n');
+            }
+            out.push_str(&format!("[symlink]\n{assignment}\n"));
+            out
+        }
+    }
+}
+
+/// End (exclusive) of the array value that starts at or after `from`,
+/// skipping strings and comments inside it.
+fn array_end(text: &str, from: usize) -> Option<usize> {
+    let bytes = text.as_bytes();
+    let mut i = from;
+    while i < bytes.len() && bytes[i].is_ascii_whitespace() && bytes[i] != b'\n' {
+        i += 1;
+    }
+    if bytes.get(i) != Some(&b'[') {
+        return None;
+    }
+    let mut depth = 0;
+    while i < bytes.len() {
+        match bytes[i] {
+            b'[' => depth += 1,
+            b']' => {
+                depth -= 1;
+                if depth == 0 {
+                    return Some(i + 1);
+                }
+            }
+            b'"' => {
+                i += 1;
+                while i < bytes.len() && bytes[i] != b'"' {
+                    if bytes[i] == b'\\' {
+                        i += 1;
+                    }
+                    i += 1;
+                }
+            }
+            b'\'' => {
+                i += 1;
+                while i < bytes.len() && bytes[i] != b'\'' {
+                    i += 1;
+                }
+            }
+            b'#' => {
+                while i < bytes.len() && bytes[i] != b'\n' {
+                    i += 1;
+                }
+            }
+            _ => {}
+        }
+        i += 1;
+    }
+    None
+}
+
+fn format_array(list: &[String]) -> String {
+    if list.is_empty() {
+        return "[]".into();
+    }
+    let mut out = String::from("[\n");
+    for item in list {
+        out.push_str(&format!("    {},\n", toml::Value::String(item.clone())));
+    }
+    out.push(']');
+    out
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn list(items: &[&str]) -> Vec<String> {
+        items.iter().map(|s| s.to_string()).collect()
+    }
+
+    #[test]
+    fn existing_arrays_are_replaced_in_place() {
+        let text = "# my config\n[symlink]\nmode = \"copy\"\nprotected_paths = [\n  \".ssh/id_rsa\", # key\n  \"a]b\",\n] # trailing\n\n[pack]\nignore = []\n";
+        let updated = set_protected_paths(text, &list(&[".ssh/id_rsa", ".netrc"]));
+        assert_eq!(
+            updated,
+            "# my config\n[symlink]\nmode = \"copy\"\nprotected_paths = [\n    \".ssh/id_rsa\",\n    \".netrc\",\n] # trailing\n\n[pack]\nignore = []\n"
+        );
+    }
+
+    #[test]
+    fn missing_keys_and_sections_are_added() {
+        assert_eq!(
+            set_protected_paths("[symlink]\nmode = \"copy\"\n", &list(&[".netrc"])),
+            "[symlink]\nprotected_paths = [\n    \".netrc\",\n]\nmode = \"copy\"\n"
+        );
+        assert_eq!(
+            set_protected_paths("[pack]\nignore = []", &[]),
+            "[pack]\nignore = []\n\n[symlink]\nprotected_paths = []\n"
+        );
+        // A `protected_paths` in another table is left alone.
+        let other = "[other]\nprotected_paths = [\"x\"]\n";
+        assert!(set_protected_paths(other, &[]).starts_with(other));
+    }
+
+    #[test]
+    fn user_paths_become_home_relative_entries() {
+        let home = Path::new("/home/alice");
+        assert_eq!(normalize("~/.netrc", home).unwrap(), ".netrc");
+        assert_eq!(normalize("$HOME/.ssh/id_*", home).unwrap(), ".ssh/id_*");
+        assert_eq!(normalize("/home/alice/.aws/", home).unwrap(), ".aws");
+        assert_eq!(normalize("./.netrc", home).unwrap(), ".netrc");
+        assert!(normalize("/etc/hosts", home).is_err());
+        assert!(normalize("../x", home).is_err());
+        assert!(normalize(".ssh/[id", home).is_err());
+    }
+}
@@ -0,0 +1,224 @@
+//! `dodot provision [PACKS...] [--upgrade]` — re-run provisioning.
+//!
+//! Runs every run-once intent (install scripts, Brewfiles, nix
+//! manifests) of the selected packs again, whether or not its sentinel
+//! says it already ran, and without touching links or shell state —
+//! the provisioning half of `dodot up --provision-rerun` on its own.
+//!
+//! `--upgrade` is for pinned Brewfiles: a `Brewfile.lock.json` next to
+//! the Brewfile normally adds `--no-upgrade`; with `--upgrade` the
+//! flag is dropped so brew upgrades the formulae and rewrites the lock.
+//! Commit the new lockfile to move every machine to the new pins.
+//!
+//! Brewfiles resume past the entries a failed run already installed,
+//! as in `dodot up`, except under `--upgrade`, which wants every entry
+//! looked at again.
+//!
+//! `--dry-run` lists the commands and closes with an estimate of the
+//! work (see [`crate::execution::WorkEstimate`]).
+//!
+//! `--status` runs nothing: it lists each step with what its sentinel
+//! recorded about the last run — see [`status`].
+
+use std::path::Path;
+
+use crate::commands::{self, MessageResult};
+use crate::datastore::{format_command_for_display, DidRunStatus};
+use crate::handlers::homebrew::{self, NO_UPGRADE};
+use crate::handlers::HANDLER_HOMEBREW;
+use crate::operations::HandlerIntent;
+use crate::packs::orchestration::{self, ExecutionContext};
+use crate::Result;
+
+/// Re-run provisioning for `pack_filter` (all packs when `None`).
+/// Stops at the first failing command, like `brew bundle` itself.
+/// When it ends, `[notify]` hears about it (see [`crate::notify`]).
+pub fn provision(
+    pack_filter: Option<&[String]>,
+    upgrade: bool,
+    ctx: &ExecutionContext,
+) -> Result<MessageResult> {
+    let started = std::time::Instant::now();
+    let result = rerun(pack_filter, upgrade, ctx);
+    crate::notify::run_finished(
+        "provision",
+        started,
+        &result,
+        |r| (true, r.message.clone()),
+        ctx,
+    );
+    result
+}
+
+/// `dodot provision --status`: every provisioning step of
+/// `pack_filter`, whether it is up to date, and what the sentinel of
+/// its last run recorded — when and where it ran, for how long and the
+/// dodot that ran it. Read-only.
+pub fn status(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<MessageResult> {
+    let packs = orchestration::prepare_packs(pack_filter, ctx)?;
+    let now = crate::datastore::sentinel::unix_now();
+    let mut details = Vec::new();
+    let (mut steps, mut current) = (0, 0);
+    for pack in &packs {
+        for intent in orchestration::collect_pack_intents(pack, ctx)? {
+            let HandlerIntent::Run {
+                pack: pack_dir,
+                handler,
+                filename,
+                content_hash,
+                ..
+            } = intent
+            else {
+                continue;
+            };
+            steps += 1;
+            let state =
+                match ctx
+                    .datastore
+                    .did_run(&pack_dir, &handler, &filename, &content_hash)?
+                {
+                    DidRunStatus::NeverRan => "never ran",
+                    DidRunStatus::RanCurrent => {
+                        current += 1;
+                        "up to date"
+                    }
+                    DidRunStatus::RanDifferent { .. } => "changed since its last run",
+                };
+            let mut line = format!("  {}: {filename} ({handler}) — {state}", pack.display_name);
+            let last = commands::status::latest_run(Path::new(&filename), &pack_dir, &handler, ctx);
+            if let Some(record) = last {
+                line.push_str(&format!("; last ran {}", record.summary(now)));
+                if let Some(version) = &record.dodot_version {
+                    line.push_str(&format!(", dodot {version}"));
+                }
+            }
+            details.push(line);
+        }
+    }
+
+    let message = if steps == 0 {
+        "No provisioning steps.".to_string()
+    } else {
+        format!("{current} of {steps} provisioning step(s) up to date.")
+    };
+    Ok(MessageResult { message, details })
+}
+
+fn rerun(
+    pack_filter: Option<&[String]>,
+    upgrade: bool,
+    ctx: &ExecutionContext,
+) -> Result<MessageResult> {
+    let mut packs = orchestration::prepare_packs(pack_filter, ctx)?;
+    let mut skipped = orchestration::drop_pinned(&mut packs, ctx)?;
+    skipped.extend(orchestration::drop_disabled(&mut packs, ctx)?);
+    skipped.extend(orchestration::drop_incompatible(&mut packs, ctx)?);
+    let mut details = Vec::new();
+    let mut ran = 0;
+
+    let mut pack_intents = Vec::with_capacity(packs.len());
+    for pack in &packs {
+        pack_intents.push((
+            pack.display_name.clone(),
+            orchestration::collect_pack_intents(pack, ctx)?,
+        ));
+    }
+    // Same opt-in shellcheck pass as `up`: the scripts are linted
+    // before the first one runs.
+    let lint = crate::shell::lint::run(
+        &pack_intents,
+        ctx.lint,
+        &ctx.config_manager.root_config()?.lint,
+        ctx.fs.as_ref(),
+        ctx.command_runner.as_ref(),
+        ctx.paths.dotfiles_root(),
+        ctx.dry_run,
+    )?;
+    let estimate = if ctx.dry_run {
+        let run_intents = pack_intents
+            .iter()
+            .flat_map(|(_, intents)| intents)
+            .filter(|i| matches!(i, HandlerIntent::Run { .. }));
+        orchestration::ExecutorSettings::from_ctx(ctx)?
+            .rerunning()
+            .estimate(run_intents)
+            .lines()
+    } else {
+        Vec::new()
+    };
+
+    for (pack, intents) in pack_intents {
+        for intent in intents {
+            let HandlerIntent::Run {
+                pack: pack_dir,
+                handler,
+                executable,
+                mut arguments,
+                sentinel,
+                filename,
+                content_hash,
+            } = intent
+            else {
+                continue;
+            };
+            let brewfile = handler == HANDLER_HOMEBREW;
+            if upgrade && brewfile {
+                arguments.retain(|a| a != NO_UPGRADE);
+            }
+            let (executable, arguments) = if brewfile && !upgrade {
+                let progress = homebrew::load_progress(
+                    ctx.fs.as_ref(),
+                    ctx.paths.as_ref(),
+                    &pack_dir,
+                    &filename,
+                );
+                homebrew::resume_command(&executable, &arguments, progress.as_ref(), &content_hash)
+            } else {
+                (executable, arguments)
+            };
+
+            if ctx.dry_run {
+                details.push(format!(
+                    "  {pack}: would run {}",
+                    format_command_for_display(&executable, &arguments)
+                ));
+                continue;
+            }
+            let outcome = ctx.datastore.run_and_record(
+                &pack_dir,
+                &handler,
+                &executable,
+                &arguments,
+                &sentinel,
+                true,
+            );
+            if brewfile {
+                homebrew::record_outcome(
+                    ctx.fs.as_ref(),
+                    ctx.paths.as_ref(),
+                    &pack_dir,
+                    &filename,
+                    &content_hash,
+                    &outcome,
+                );
+            }
+            outcome?;
+            details.push(format!("  {pack}: {filename} ({handler})"));
+            ran += 1;
+        }
+    }
+
+    let message = if ctx.dry_run {
+        format!("Would re-run {} provisioning step(s).", details.len())
+    } else if ran == 0 {
+        "Nothing to provision.".to_string()
+    } else if upgrade {
+        format!("Re-ran {ran} provisioning step(s), upgrading pinned Brewfiles.")
+    } else {
+        format!("Re-ran {ran} provisioning step(s).")
+    };
+    details.extend(estimate.into_iter().map(|l| format!("  estimate: {l}")));
+    details.extend(skipped.into_iter().map(|w| format!("  {w}")));
+    details.extend(lint.into_iter().map(|w| format!("  {w}")));
+    Ok(MessageResult { message, details })
+}
@@ -0,0 +1,481 @@
+//! `dodot relocate-data` — move the data dir somewhere else.
+//!
+//! The data dir (`~/.local/share/dodot` unless moved) is referenced
+//! from outside itself: under the default `double` link mode every
+//! deployed target is a symlink to a data link inside it, and the init
+//! scripts, fish and nushell exports, shims, git include block and
+//! deployment map all embed its path. Moving it by hand means finding
+//! every one of those. Relocation:
+//!
+//! 1. plans the relinks — every deployed target that points into the
+//!    data dir, taken from the status report;
+//! 2. moves the directory: a rename, or a copy then delete when the
+//!    new place is on another filesystem;
+//! 3. rewrites symlinks inside the moved tree that point back into it,
+//!    and repoints the home symlinks;
+//! 4. records the new place as `data_dir` in
+//!    `~/.config/dodot/local.toml`, which every later command reads;
+//! 5. regenerates the init scripts, exports, git includes and the
+//!    deployment map, which embed datastore paths.
+//!
+//! If step 3 or 4 fails, every link is restored and the directory goes
+//! back where it was. With `[datastore] per_host` the whole shared
+//! tree moves, `hosts/` included; the other hosts' generated files
+//! catch up on their next `dodot up` there.
+
+use std::path::{Path, PathBuf};
+
+use tracing::info;
+
+use crate::commands::{status, MessageResult};
+use crate::fs::Fs;
+use crate::packs::orchestration::{self, ExecutionContext};
+use crate::paths::{expand_tilde, Pather, XdgPather};
+use crate::{handlers, probe, shell, DodotError, Result};
+
+/// `EXDEV`: a rename across filesystems (same value on Linux and macOS).
+const CROSS_DEVICE: i32 = 18;
+
+/// A deployed target to repoint at the moved data dir.
+#[derive(Debug, Clone, PartialEq, Eq)]
+struct Relink {
+    user_path: PathBuf,
+    new_target: PathBuf,
+}
+
+/// How the directory got to its new place.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum Transfer {
+    Renamed,
+    /// Copied across filesystems; the original is removed only once
+    /// everything else succeeded.
+    Copied,
+}
+
+/// Run `dodot relocate-data <new_dir>`. With `ctx.dry_run` only the
+/// plan is reported.
+pub fn relocate_data(new_dir: &Path, ctx: &ExecutionContext) -> Result<MessageResult> {
+    let fs = ctx.fs.as_ref();
+    let paths = ctx.paths.as_ref();
+    let old = base_data_dir(paths);
+    let new = expand_tilde(&new_dir.to_string_lossy(), paths.home_dir());
+    if !new.is_absolute() {
+        return Err(DodotError::Other(format!(
+            "the new data dir must be an absolute path or start with `~/`, got {}",
+            new_dir.display()
+        )));
+    }
+    if new == old {
+        return Ok(MessageResult {
+            message: format!("The data dir is already at {}.", old.display()),
+            details: Vec::new(),
+        });
+    }
+    if new.starts_with(&old) || old.starts_with(&new) {
+        return Err(DodotError::Other(format!(
+            "can't move the data dir {} to {}: one contains the other",
+            old.display(),
+            new.display()
+        )));
+    }
+    if fs.exists(&new) && !is_empty_dir(fs, &new) {
+        return Err(DodotError::Other(format!(
+            "{} already exists and isn't an empty directory",
+            new.display()
+        )));
+    }
+
+    let present = fs.is_dir(&old);
+    let relinks = if present {
+        plan_relinks(&old, &new, ctx)?
+    } else {
+        Vec::new()
+    };
+    let mut details: Vec<String> = relinks
+        .iter()
+        .map(|r| {
+            format!(
+                "relink {} → {}",
+                r.user_path.display(),
+                r.new_target.display()
+            )
+        })
+        .collect();
+
+    if ctx.dry_run {
+        let message = if present {
+            format!(
+                "[dry-run] would move {} to {} and repoint {} link(s).",
+                old.display(),
+                new.display(),
+                relinks.len()
+            )
+        } else {
+            format!(
+                "[dry-run] {} doesn't exist yet; would record {} as the data dir.",
+                old.display(),
+                new.display()
+            )
+        };
+        return Ok(MessageResult { message, details });
+    }
+
+    // Read before anything moves, so a config error stops the command
+    // while the old layout is still intact.
+    let root_config = ctx.config_manager.root_config()?;
+    let path_priorities = orchestration::path_priorities(ctx)?;
+
+    let moved_by = if present {
+        Some(transfer(fs, &old, &new)?)
+    } else {
+        None
+    };
+    let mut undo = Vec::new();
+    if let Err(err) = repoint(fs, paths, &old, &new, &relinks, present, &mut undo) {
+        rollback(fs, &undo);
+        match moved_by {
+            Some(Transfer::Renamed) => {
+                let _ = fs.rename(&new, &old);
+            }
+            Some(Transfer::Copied) => {
+                let _ = fs.remove_dir_all(&new);
+            }
+            None => {}
+        }
+        return Err(err);
+    }
+    if moved_by == Some(Transfer::Copied) {
+        fs.remove_dir_all(&old)?;
+    }
+    info!(from = %old.display(), to = %new.display(), "relocated data dir");
+
+    let moved = relocated_pather(paths, &new)?;
+    shell::write_init_script(fs, &moved, root_config.profiling.enabled, &path_priorities)?;
+    shell::write_path_exports(fs, &moved, &path_priorities, root_config.path.shims)?;
+    if fs.write_refused(moved.home_dir()) {
+        details.push("--no-write-home: the git config include block was not rewritten".into());
+    } else {
+        handlers::gitconfig::write_includes(fs, &moved)?;
+    }
+    probe::write_deployment_map(fs, &moved)?;
+
+    if fs.exists(&new.join("dodot.db")) {
+        details.push(format!(
+            "note: run `dodot state reindex` to rebuild the datastore index ({}) from the new data dir",
+            new.join("dodot.db").display()
+        ));
+    }
+    if paths.hosts_dir().is_some() {
+        details.push(
+            "note: other hosts sharing this data dir pick up the new place on their next `dodot up`"
+                .into(),
+        );
+    }
+    details.push(format!(
+        "note: rc files and PATH settings that name {} directly (fish and nushell init, shims) need the new path",
+        old.display()
+    ));
+
+    let message = if present {
+        format!(
+            "Moved the data dir from {} to {} and repointed {} link(s).",
+            old.display(),
+            new.display(),
+            relinks.len()
+        )
+    } else {
+        format!(
+            "Recorded {} as the data dir; nothing was there to move.",
+            new.display()
+        )
+    };
+    Ok(MessageResult { message, details })
+}
+
+/// The data dir as a whole: with per-host state, the directory that
+/// holds `hosts/`.
+fn base_data_dir(paths: &dyn Pather) -> PathBuf {
+    paths
+        .hosts_dir()
+        .and_then(Path::parent)
+        .unwrap_or(paths.data_dir())
+        .to_path_buf()
+}
+
+/// Deployed targets that are symlinks into `old`, repointed under `new`.
+fn plan_relinks(old: &Path, new: &Path, ctx: &ExecutionContext) -> Result<Vec<Relink>> {
+    let report = status::status(None, ctx)?.report.unwrap_or_default();
+    let mut relinks = Vec::new();
+    for item in report
+        .packs
+        .iter()
+        .flat_map(|p| &p.handlers)
+        .flat_map(|h| &h.items)
+    {
+        let Some(target) = &item.target else {
+            continue;
+        };
+        let user_path = expand_tilde(target, ctx.paths.home_dir());
+        let Ok(points_to) = ctx.fs.readlink(&user_path) else {
+            continue;
+        };
+        let Ok(rel) = points_to.strip_prefix(old) else {
+            continue;
+        };
+        let relink = Relink {
+            new_target: new.join(rel),
+            user_path,
+        };
+        if !relinks.contains(&relink) {
+            relinks.push(relink);
+        }
+    }
+    Ok(relinks)
+}
+
+fn is_empty_dir(fs: &dyn Fs, dir: &Path) -> bool {
+    fs.is_dir(dir) && fs.read_dir(dir).is_ok_and(|entries| entries.is_empty())
+}
+
+/// Move `old` to `new`, copying when a rename can't cross filesystems.
+fn transfer(fs: &dyn Fs, old: &Path, new: &Path) -> Result<Transfer> {
+    if let Some(parent) = new.parent() {
+        fs.mkdir_all(parent)?;
+    }
+    // Checked empty by the caller; a rename won't replace it everywhere.
+    if fs.is_dir(new) {
+        fs.remove_dir_all(new)?;
+    }
+    match fs.rename(old, new) {
+        Ok(()) => Ok(Transfer::Renamed),
+        Err(DodotError::Fs { source, .. }) if source.raw_os_error() == Some(CROSS_DEVICE) => {
+            if let Err(err) = copy_tree(fs, old, new) {
+                let _ = fs.remove_dir_all(new);
+                return Err(err);
+            }
+            Ok(Transfer::Copied)
+        }
+        Err(err) => Err(err),
+    }
+}
+
+/// Copy a directory tree, recreating symlinks as symlinks.
+fn copy_tree(fs: &dyn Fs, from: &Path, to: &Path) -> Result<()> {
+    fs.mkdir_all(to)?;
+    for entry in fs.read_dir(from)? {
+        let dest = to.join(&entry.name);
+        if entry.is_symlink {
+            fs.symlink(&fs.readlink(&entry.path)?, &dest)?;
+        } else if entry.is_dir {
+            copy_tree(fs, &entry.path, &dest)?;
+        } else {
+            fs.copy_file(&entry.path, &dest)?;
+        }
+    }
+    Ok(())
+}
+
+/// Steps 3 and 4: everything after the move that can be undone. Each
+/// replaced link goes into `undo` with its previous target.
+fn repoint(
+    fs: &dyn Fs,
+    paths: &dyn Pather,
+    old: &Path,
+    new: &Path,
+    relinks: &[Relink],
+    present: bool,
+    undo: &mut Vec<(PathBuf, PathBuf)>,
+) -> Result<()> {
+    if present {
+        rewrite_links(fs, new, old, new, undo)?;
+    }
+    for relink in relinks {
+        let previous = fs.readlink(&relink.user_path)?;
+        replace_link(fs, &relink.user_path, &relink.new_target)?;
+        undo.push((relink.user_path.clone(), previous));
+    }
+    record_data_dir(fs, paths, new)
+}
+
+/// Repoint symlinks under `dir` that point into `old` at the same
+/// place under `new`. Symlinked directories are not descended.
+fn rewrite_links(
+    fs: &dyn Fs,
+    dir: &Path,
+    old: &Path,
+    new: &Path,
+    undo: &mut Vec<(PathBuf, PathBuf)>,
+) -> Result<()> {
+    for entry in fs.read_dir(dir)? {
+        if entry.is_symlink {
+            let target = fs.readlink(&entry.path)?;
+            if let Ok(rel) = target.strip_prefix(old) {
+                replace_link(fs, &entry.path, &new.join(rel))?;
+                undo.push((entry.path, target));
+            }
+        } else if entry.is_dir {
+            rewrite_links(fs, &entry.path, old, new, undo)?;
+        }
+    }
+    Ok(())
+}
+
+fn replace_link(fs: &dyn Fs, link: &Path, target: &Path) -> Result<()> {
+    fs.remove_file(link)?;
+    fs.symlink(target, link)
+}
+
+/// Put the replaced links back, newest first. Best effort: this only
+/// runs after a failure.
+fn rollback(fs: &dyn Fs, undo: &[(PathBuf, PathBuf)]) {
+    for (link, target) in undo.iter().rev() {
+        let _ = replace_link(fs, link, target);
+    }
+}
+
+/// Set `data_dir` in local.toml, keeping every other line as written.
+/// A path under `$HOME` is stored as `~/…` so it reads the same on a
+/// home shared between machines.
+fn record_data_dir(fs: &dyn Fs, paths: &dyn Pather, new: &Path) -> Result<()> {
+    let path = paths.local_config_path();
+    let value = match new.strip_prefix(paths.home_dir()) {
+        Ok(rel) => format!("~/{}", rel.display()),
+        Err(_) => new.display().to_string(),
+    };
+    let setting = format!("data_dir = {}", toml::Value::String(value));
+
+    let existing = if fs.exists(&path) {
+        fs.read_to_string(&path)?
+    } else {
+        String::new()
+    };
+    let mut lines = Vec::new();
+    let mut in_table = false;
+    let mut replaced = false;
+    for line in existing.lines() {
+        let trimmed = line.trim_start();
+        in_table |= trimmed.starts_with('[');
+        let is_setting = trimmed
+            .strip_prefix("data_dir")
+            .is_some_and(|rest| rest.trim_start().starts_with('='));
+        if !in_table && is_setting {
+            if !replaced {
+                lines.push(setting.clone());
+                replaced = true;
+            }
+            continue;
+        }
+        lines.push(line.to_string());
+    }
+    if !replaced {
+        // Top-level keys go before the first table.
+        lines.insert(0, setting);
+    }
+    if let Some(parent) = path.parent() {
+        fs.mkdir_all(parent)?;
+    }
+    fs.write_file_atomic(&path, format!("{}\n", lines.join("\n")).as_bytes())
+}
+
+/// The current paths with the data dir at `new`.
+fn relocated_pather(paths: &dyn Pather, new: &Path) -> Result<XdgPather> {
+    let mut builder = XdgPather::builder()
+        .home(paths.home_dir())
+        .dotfiles_root(paths.dotfiles_root())
+        .data_dir(new)
+        .config_dir(paths.config_dir())
+        .cache_dir(paths.cache_dir())
+        .xdg_config_home(paths.xdg_config_home())
+        .app_support_dir(paths.app_support_dir())
+        .flat_layout(paths.flat_layout());
+    if paths.hosts_dir().is_some() {
+        if let Some(host) = paths.data_dir().file_name() {
+            builder = builder.host(host.to_string_lossy());
+        }
+    }
+    builder.build()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::commands::tests::support::make_ctx;
+    use crate::commands::up;
+    use crate::testing::TempEnvironment;
+
+    fn deployed_env() -> TempEnvironment {
+        let env = TempEnvironment::builder()
+            .pack("vim")
+            .file("vimrc", "set nocompatible")
+            .file("aliases.sh", "alias vi=vim")
+            .done()
+            .build();
+        up::up(None, &make_ctx(&env)).unwrap();
+        env
+    }
+
+    #[test]
+    fn moves_the_data_dir_and_repoints_links_and_scripts() {
+        let env = deployed_env();
+        let ctx = make_ctx(&env);
+        let old = env.data_dir.clone();
+        let new = env.home.join("state/dodot");
+        let local_toml = env.paths.local_config_path();
+        env.fs.mkdir_all(local_toml.parent().unwrap()).unwrap();
+        env.fs
+            .write_file(&local_toml, b"roles = [\"work\"]\n")
+            .unwrap();
+
+        let result = relocate_data(Path::new("~/state/dodot"), &ctx).unwrap();
+        assert!(result.message.contains("1 link(s)"), "{}", result.message);
+
+        assert!(!env.fs.exists(&old));
+        let vimrc = env.home.join(".vimrc");
+        assert_eq!(
+            env.fs.readlink(&vimrc).unwrap(),
+            new.join("packs/vim/symlink/vimrc")
+        );
+        assert_eq!(env.fs.read_to_string(&vimrc).unwrap(), "set nocompatible");
+
+        let init = env
+            .fs
+            .read_to_string(&new.join("shell/dodot-init.sh"))
+            .unwrap();
+        assert!(init.contains(&new.display().to_string()), "{init}");
+        assert!(!init.contains(&old.display().to_string()), "{init}");
+
+        let local = env.fs.read_to_string(&local_toml).unwrap();
+        assert_eq!(local, "data_dir = \"~/state/dodot\"\nroles = [\"work\"]\n");
+    }
+
+    #[test]
+    fn dry_run_and_bad_destinations_change_nothing() {
+        let env = deployed_env();
+        let mut ctx = make_ctx(&env);
+        ctx.dry_run = true;
+        let new = env.home.join("state/dodot");
+
+        let result = relocate_data(&new, &ctx).unwrap();
+        assert!(
+            result.message.starts_with("[dry-run]"),
+            "{}",
+            result.message
+        );
+        assert!(result.details.iter().any(|d| d.contains(".vimrc")));
+        assert!(env.fs.exists(&env.data_dir));
+        assert!(!env.fs.exists(&new));
+
+        ctx.dry_run = false;
+        let inside = env.data_dir.join("nested");
+        assert!(relocate_data(&inside, &ctx).is_err());
+        env.fs.mkdir_all(&new).unwrap();
+        env.fs.write_file(&new.join("taken"), b"x").unwrap();
+        let err = relocate_data(&new, &ctx).unwrap_err();
+        assert!(
+            err.to_string().contains("isn't an empty directory"),
+            "{err}"
+        );
+        assert!(relocate_data(Path::new("relative/dir"), &ctx).is_err());
+        assert!(env.fs.exists(&env.data_dir));
+    }
+}
@@ -0,0 +1,122 @@
+//! `dodot run <pack> <script> [ARGS...]` — run a script shipped in a
+//! pack, outside provisioning.
+//!
+//! For maintenance scripts (`prune-caches.sh`, `reindex-notes.sh`)
+//! that live next to the configs they maintain but must not run on
+//! every `dodot up`. The script gets the same interpreter choice as
+//! install scripts (by extension: `.zsh` → zsh, everything else →
+//! bash) and these variables on top of the caller's environment:
+//!
+//! - `DOTFILES_ROOT` — the dotfiles root dodot resolved
+//! - `DODOT_PACK` — the pack's display name
+//! - `DODOT_DATA_DIR` — dodot's data directory
+//!
+//! Nothing is recorded in the datastore: no sentinel, no snapshot, so
+//! the script runs every time it is asked to. Start and finish are
+//! logged like any other command.
+
+use std::path::{Component, Path, PathBuf};
+
+use crate::commands::MessageResult;
+use crate::handlers::install::interpreter_for;
+use crate::packs::orchestration::{self, ExecutionContext};
+use crate::{DodotError, Result};
+
+/// Resolve `script` inside `pack_name` and run it with `args`.
+pub fn run(
+    pack_name: &str,
+    script: &str,
+    args: &[String],
+    ctx: &ExecutionContext,
+) -> Result<MessageResult> {
+    let pack_dir = orchestration::resolve_pack_dir_name(pack_name, ctx)?;
+    let display = crate::packs::display_name_for(&pack_dir);
+    let pack_path = ctx.paths.pack_path(&pack_dir);
+
+    let relative = pack_relative(script)?;
+    let script_path = pack_path.join(&relative);
+    if !ctx.fs.exists(&script_path) || ctx.fs.is_dir(&script_path) {
+        return Err(DodotError::Other(format!(
+            "no script `{}` in pack '{display}'",
+            relative.display()
+        )));
+    }
+
+    let interpreter = interpreter_for(&script_path);
+    let command = env_command(ctx, display, interpreter, &script_path, args);
+    tracing::info!(
+        pack = display,
+        script = %relative.display(),
+        "running pack script"
+    );
+    let started = std::time::Instant::now();
+    let output = ctx.command_runner.run("env", &command)?;
+    let elapsed = started.elapsed();
+    tracing::info!(
+        pack = display,
+        script = %relative.display(),
+        exit_code = output.exit_code,
+        elapsed_ms = elapsed.as_millis() as u64,
+        "pack script finished"
+    );
+
+    // A verbose runner has already streamed the output; otherwise
+    // hand it back for rendering.
+    let details = if ctx.verbose {
+        Vec::new()
+    } else {
+        output.stdout.lines().map(str::to_string).collect()
+    };
+    Ok(MessageResult {
+        message: format!(
+            "Ran {} from '{display}' ({:.2}s)",
+            relative.display(),
+            elapsed.as_secs_f64()
+        ),
+        details,
+    })
+}
+
+/// Scripts are named relative to the pack root and must stay inside
+/// it — `dodot run vim ../other/x.sh` is rejected rather than resolved.
+fn pack_relative(script: &str) -> Result<PathBuf> {
+    let mut cleaned = PathBuf::new();
+    for component in Path::new(script).components() {
+        match component {
+            Component::Normal(n) => cleaned.push(n),
+            Component::CurDir => {}
+            Component::ParentDir | Component::RootDir | Component::Prefix(_) => {
+                return Err(DodotError::Other(format!(
+                    "script path must be relative to the pack: {script}"
+                )));
+            }
+        }
+    }
+    if cleaned.as_os_str().is_empty() {
+        return Err(DodotError::Other("no script given".into()));
+    }
+    Ok(cleaned)
+}
+
+/// `env` arguments that set the dodot variables and then exec the
+/// interpreter. Going through `env` keeps [`CommandRunner`] free of an
+/// environment parameter only this command needs.
+///
+/// [`CommandRunner`]: crate::datastore::CommandRunner
+fn env_command(
+    ctx: &ExecutionContext,
+    pack: &str,
+    interpreter: &str,
+    script_path: &Path,
+    args: &[String],
+) -> Vec<String> {
+    let mut command = vec![
+        format!("DOTFILES_ROOT={}", ctx.paths.dotfiles_root().display()),
+        format!("DODOT_PACK={pack}"),
+        format!("DODOT_DATA_DIR={}", ctx.paths.data_dir().display()),
+        interpreter.to_string(),
+        script_path.to_string_lossy().into_owned(),
+    ];
+    command.extend(args.iter().cloned());
+    command
+}
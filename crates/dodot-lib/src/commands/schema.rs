@@ -0,0 +1,779 @@
+//! `dodot schema` — JSON Schemas for `--output json`.
+//!
+//! Every command serializes its result type as-is under `--output
+//! json`. The schemas here describe those types ([`PackStatusResult`],
+//! [`ListResult`], [`MessageResult`], [`TrashListResult`],
+//! [`PlanResult`], [`PinListResult`], [`ProtectListResult`],
+//! [`DoctorResult`]) so scripts
+//! can validate against a stated contract instead of whatever the
+//! current build happens to print.
+//!
+//! They are written next to the types rather than derived, and kept
+//! honest by tests that serialize real command results and check them
+//! against the schema with `additionalProperties: false` everywhere:
+//! a field added to a result type without a schema entry fails the
+//! build. Schemas follow JSON Schema draft 2020-12.
+//!
+//! [`PackStatusResult`]: crate::commands::PackStatusResult
+//! [`ListResult`]: crate::commands::list::ListResult
+//! [`MessageResult`]: crate::commands::MessageResult
+//! [`TrashListResult`]: crate::commands::trash::TrashListResult
+//! [`PlanResult`]: crate::commands::plan::PlanResult
+//! [`PinListResult`]: crate::commands::pin::PinListResult
+//! [`ProtectListResult`]: crate::commands::protect::ProtectListResult
+//! [`DoctorResult`]: crate::commands::doctor::DoctorResult
+
+use serde_json::{json, Map, Value};
+
+use crate::{DodotError, Result};
+
+const DRAFT: &str = "https://json-schema.org/draft/2020-12/schema";
+
+/// Commands with a schema, and the result type each one prints.
+/// Subcommands are written with a space, as typed.
+pub const SCHEMA_COMMANDS: &[(&str, &str)] = &[
+    ("status", "PackStatusResult"),
+    ("up", "PackStatusResult"),
+    ("down", "PackStatusResult"),
+    ("adopt", "PackStatusResult"),
+    ("clone", "PackStatusResult"),
+    ("list", "ListResult"),
+    ("plan", "PlanResult"),
+    ("apply", "PackStatusResult"),
+    ("provision", "MessageResult"),
+    ("run", "MessageResult"),
+    ("explain-error", "MessageResult"),
+    ("migrate-state", "MessageResult"),
+    ("relocate-data", "MessageResult"),
+    ("state export", "MessageResult"),
+    ("state import", "MessageResult"),
+    ("state reindex", "MessageResult"),
+    ("prompts reset", "MessageResult"),
+    ("trash list", "TrashListResult"),
+    ("trash restore", "MessageResult"),
+    ("trash prune", "MessageResult"),
+    ("pin", "PinListResult"),
+    ("unpin", "MessageResult"),
+    ("protect list", "ProtectListResult"),
+    ("protect add", "MessageResult"),
+    ("protect remove", "MessageResult"),
+    ("doctor", "DoctorResult"),
+    ("eject", "MessageResult"),
+];
+
+/// The schema for `command`'s JSON output.
+pub fn schema(command: &str) -> Result<Value> {
+    let command = command.split_whitespace().collect::<Vec<_>>().join(" ");
+    let Some((_, type_name)) = SCHEMA_COMMANDS.iter().find(|(c, _)| *c == command) else {
+        let known: Vec<&str> = SCHEMA_COMMANDS.iter().map(|(c, _)| *c).collect();
+        return Err(DodotError::Other(format!(
+            "no JSON schema for `{command}`; available: {}",
+            known.join(", ")
+        )));
+    };
+    Ok(schema_for_type(type_name, &command))
+}
+
+fn schema_for_type(type_name: &str, command: &str) -> Value {
+    let (root, defs) = match type_name {
+        "PackStatusResult" => (pack_status_result(), pack_status_defs()),
+        "ListResult" => (list_result(), Map::new()),
+        "TrashListResult" => (trash_list_result(), Map::new()),
+        "PlanResult" => (plan_result(), Map::new()),
+        "PinListResult" => (pin_list_result(), Map::new()),
+        "ProtectListResult" => (protect_list_result(), Map::new()),
+        "DoctorResult" => (doctor_result(), Map::new()),
+        _ => (message_result(), Map::new()),
+    };
+    let mut doc = Map::new();
+    doc.insert("$schema".into(), DRAFT.into());
+    doc.insert(
+        "title".into(),
+        format!("dodot {command} --output json ({type_name})").into(),
+    );
+    let Value::Object(root) = root else {
+        unreachable!("schema roots are objects")
+    };
+    doc.extend(root);
+    if !defs.is_empty() {
+        doc.insert("$defs".into(), Value::Object(defs));
+    }
+    Value::Object(doc)
+}
+
+/// A closed object: `required` fields always serialize, `optional`
+/// ones are omitted when empty.
+fn object(required: &[(&str, Value)], optional: &[(&str, Value)]) -> Value {
+    let mut properties = Map::new();
+    for (name, schema) in required.iter().chain(optional) {
+        properties.insert((*name).into(), schema.clone());
+    }
+    json!({
+        "type": "object",
+        "properties": properties,
+        "required": required.iter().map(|(n, _)| *n).collect::<Vec<_>>(),
+        "additionalProperties": false,
+    })
+}
+
+fn string() -> Value {
+    json!({ "type": "string" })
+}
+
+fn described(description: &str) -> Value {
+    json!({ "type": "string", "description": description })
+}
+
+fn one_of(values: &[&str]) -> Value {
+    json!({ "type": "string", "enum": values })
+}
+
+fn count() -> Value {
+    json!({ "type": "integer", "minimum": 0 })
+}
+
+fn array_of(items: Value) -> Value {
+    json!({ "type": "array", "items": items })
+}
+
+fn reference(name: &str) -> Value {
+    json!({ "$ref": format!("#/$defs/{name}") })
+}
+
+fn message_result() -> Value {
+    object(
+        &[("message", string()), ("details", array_of(string()))],
+        &[],
+    )
+}
+
+fn list_result() -> Value {
+    object(
+        &[(
+            "packs",
+            array_of(object(
+                &[
+                    ("name", described("Pack name, ordering prefix stripped.")),
+                    ("ignored", json!({ "type": "boolean" })),
+                ],
+                &[
+                    (
+                        "metadata",
+                        object(
+                            &[],
+                            &[
+                                ("description", string()),
+                                ("author", string()),
+                                ("version", string()),
+                                ("url", string()),
+                                (
+                                    "min_dodot",
+                                    described("Oldest dodot release the pack works with."),
+                                ),
+                            ],
+                        ),
+                    ),
+                    (
+                        "incompatible",
+                        described("Why this dodot won't deploy the pack (`min_dodot`)."),
+                    ),
+                    (
+                        "files",
+                        array_of(object(
+                            &[
+                                ("name", described("Pack-relative path.")),
+                                ("handler", string()),
+                                (
+                                    "state",
+                                    described("Style bucket, as in `status`: deployed, pending, …"),
+                                ),
+                                ("label", string()),
+                            ],
+                            &[("target", string())],
+                        )),
+                    ),
+                ],
+            )),
+        )],
+        &[],
+    )
+}
+
+fn doctor_result() -> Value {
+    object(
+        &[
+            ("message", string()),
+            ("details", array_of(string())),
+            (
+                "issues",
+                array_of(object(&[("problem", string()), ("fix", string())], &[])),
+            ),
+        ],
+        &[],
+    )
+}
+
+fn pin_list_result() -> Value {
+    object(
+        &[
+            ("message", string()),
+            ("details", array_of(string())),
+            (
+                "pins",
+                array_of(object(
+                    &[
+                        ("name", string()),
+                        ("pinned_at", described_count("Unix seconds.")),
+                    ],
+                    &[("reason", string())],
+                )),
+            ),
+        ],
+        &[],
+    )
+}
+
+fn protect_list_result() -> Value {
+    object(
+        &[
+            ("message", string()),
+            ("details", array_of(string())),
+            (
+                "paths",
+                array_of(object(
+                    &[
+                        ("path", described("Relative to $HOME; may be a glob.")),
+                        (
+                            "source",
+                            described("`default`, `root`, or the pack that adds it."),
+                        ),
+                    ],
+                    &[],
+                )),
+            ),
+        ],
+        &[],
+    )
+}
+
+fn trash_list_result() -> Value {
+    object(
+        &[
+            ("message", string()),
+            ("details", array_of(string())),
+            (
+                "entries",
+                array_of(object(
+                    &[
+                        ("id", described("What `dodot trash restore` takes.")),
+                        ("original_path", string()),
+                        ("pack", string()),
+                        ("trashed_at", described_count("Unix seconds.")),
+                        ("is_dir", json!({ "type": "boolean" })),
+                    ],
+                    &[
+                        (
+                            "sha256",
+                            described("Content hash of a trashed file; names its stored copy."),
+                        ),
+                        (
+                            "mode",
+                            described_count("Permission bits the file is restored with."),
+                        ),
+                    ],
+                )),
+            ),
+        ],
+        &[],
+    )
+}
+
+fn plan_result() -> Value {
+    let change = object(
+        &[
+            ("kind", one_of(&["add", "change", "remove"])),
+            ("handler", string()),
+            ("name", described("Pack-relative path.")),
+        ],
+        &[("target", string()), ("reason", string())],
+    );
+    let plan = object(
+        &[
+            (
+                "format",
+                described_count("Plan file format; `apply` refuses others."),
+            ),
+            ("created_at", described_count("Unix seconds.")),
+            ("selection", array_of(string())),
+            ("no_provision", json!({ "type": "boolean" })),
+            ("config_checksum", string()),
+            (
+                "packs",
+                array_of(object(
+                    &[
+                        ("name", described("Pack name, ordering prefix stripped.")),
+                        ("checksum", described("Digest of the pack directory.")),
+                        ("changes", array_of(change)),
+                    ],
+                    &[],
+                )),
+            ),
+        ],
+        &[],
+    );
+    object(
+        &[
+            ("message", string()),
+            (
+                "summary",
+                described("`N to add, N to change, N to remove`."),
+            ),
+            ("plan", plan),
+        ],
+        &[("path", described("Where the plan was written."))],
+    )
+}
+
+fn described_count(description: &str) -> Value {
+    json!({ "type": "integer", "minimum": 0, "description": description })
+}
+
+fn pack_status_result() -> Value {
+    object(
+        &[
+            ("dry_run", json!({ "type": "boolean" })),
+            ("packs", array_of(reference("DisplayPack"))),
+            ("view_mode", one_of(&["full", "short", "table"])),
+            ("group_mode", one_of(&["name", "status"])),
+            ("verbosity", one_of(&["quiet", "normal", "verbose"])),
+            ("summary", described("One-line rollup of the whole result.")),
+        ],
+        &[
+            ("message", string()),
+            ("warnings", array_of(string())),
+            (
+                "notes",
+                array_of(object(&[("body", string())], &[("hint", string())])),
+            ),
+            ("conflicts", array_of(reference("DisplayConflict"))),
+            ("ignored_packs", array_of(string())),
+            ("inactive_packs", array_of(string())),
+            ("role_inactive_packs", array_of(string())),
+            ("diffs", array_of(reference("DisplayDiff"))),
+            ("table", reference("DisplayTable")),
+            ("report", reference("StatusReport")),
+            ("actions", array_of(string())),
+            ("elapsed", string()),
+            ("phases", array_of(reference("DisplayPhase"))),
+            ("estimate", reference("WorkEstimate")),
+            ("estimate_lines", array_of(string())),
+        ],
+    )
+}
+
+fn pack_status_defs() -> Map<String, Value> {
+    let status = described(
+        "Style bucket: deployed, pending, warning, stale, broken, degraded, skipped, error, …",
+    );
+    let mut defs = Map::new();
+    defs.insert(
+        "DisplayPack".into(),
+        object(
+            &[
+                ("name", string()),
+                ("files", array_of(reference("DisplayFile"))),
+                (
+                    "summary_status",
+                    one_of(&["error", "degraded", "pending", "deployed"]),
+                ),
+                ("summary_count", count()),
+            ],
+            &[
+                ("pinned", json!({ "type": "boolean" })),
+                ("disabled", json!({ "type": "boolean" })),
+            ],
+        ),
+    );
+    defs.insert(
+        "DisplayFile".into(),
+        object(
+            &[
+                ("name", string()),
+                ("symbol", string()),
+                ("description", string()),
+                ("status", status.clone()),
+                ("status_label", string()),
+                ("handler", string()),
+            ],
+            &[
+                (
+                    "note_ref",
+                    json!({ "type": "integer", "minimum": 1,
+                            "description": "1-based index into `notes`." }),
+                ),
+                ("last_run", string()),
+            ],
+        ),
+    );
+    defs.insert(
+        "DisplayPhase".into(),
+        object(
+            &[
+                ("name", one_of(&["link", "provision"])),
+                ("label", string()),
+                (
+                    "status",
+                    one_of(&["error", "degraded", "pending", "deployed"]),
+                ),
+                ("done", count()),
+                ("pending", count()),
+                ("errors", count()),
+                ("summary", string()),
+            ],
+            &[(
+                "note_refs",
+                array_of(json!({ "type": "integer", "minimum": 1 })),
+            )],
+        ),
+    );
+    defs.insert(
+        "WorkEstimate".into(),
+        object(
+            &[
+                (
+                    "runs",
+                    array_of(object(
+                        &[
+                            ("pack", string()),
+                            ("handler", string()),
+                            ("filename", string()),
+                            ("reason", one_of(&["first-run", "changed", "forced"])),
+                        ],
+                        &[],
+                    )),
+                ),
+                ("brew_missing", array_of(string())),
+                ("brew_unknown", count()),
+                (
+                    "downloads",
+                    array_of(object(
+                        &[("pack", string()), ("name", string()), ("url", string())],
+                        &[("bytes", count())],
+                    )),
+                ),
+                ("held_back", array_of(string())),
+            ],
+            &[],
+        ),
+    );
+    defs.insert(
+        "DisplayConflict".into(),
+        object(
+            &[
+                ("kind", one_of(&["symlink", "path"])),
+                ("target", string()),
+                (
+                    "claimants",
+                    array_of(object(&[("pack", string()), ("source", string())], &[])),
+                ),
+            ],
+            &[],
+        ),
+    );
+    defs.insert(
+        "DisplayDiff".into(),
+        object(
+            &[
+                ("pack", string()),
+                ("file", string()),
+                ("handler", string()),
+                ("body", described("Unified diff.")),
+            ],
+            &[],
+        ),
+    );
+    defs.insert(
+        "DisplayTable".into(),
+        object(
+            &[
+                (
+                    "rows",
+                    array_of(object(
+                        &[
+                            ("pack", string()),
+                            ("handler", string()),
+                            ("file", string()),
+                            ("status", status.clone()),
+                            ("state", string()),
+                            ("last_run", string()),
+                        ],
+                        &[],
+                    )),
+                ),
+                (
+                    "widths",
+                    object(
+                        &[
+                            ("pack", count()),
+                            ("handler", count()),
+                            ("file", count()),
+                            ("state", count()),
+                            ("last_run", count()),
+                        ],
+                        &[],
+                    ),
+                ),
+            ],
+            &[],
+        ),
+    );
+    defs.insert(
+        "StatusReport".into(),
+        object(
+            &[(
+                "packs",
+                array_of(object(
+                    &[
+                        ("name", string()),
+                        (
+                            "handlers",
+                            array_of(object(
+                                &[
+                                    ("handler", string()),
+                                    ("items", array_of(reference("ItemReport"))),
+                                ],
+                                &[],
+                            )),
+                        ),
+                    ],
+                    &[],
+                )),
+            )],
+            &[],
+        ),
+    );
+    defs.insert(
+        "ItemReport".into(),
+        object(
+            &[
+                ("name", described("Pack-relative path.")),
+                ("state", status),
+                ("label", string()),
+            ],
+            &[
+                ("target", string()),
+                ("detail", string()),
+                ("last_run", reference("SentinelRecord")),
+            ],
+        ),
+    );
+    defs.insert(
+        "SentinelRecord".into(),
+        object(
+            &[("completed_at", described_count("Unix seconds."))],
+            &[
+                ("exit_code", json!({ "type": "integer" })),
+                ("duration_ms", count()),
+                ("dodot_version", string()),
+                ("hostname", string()),
+            ],
+        ),
+    );
+    defs
+}
+
+/// Check `value` against `schema` (the subset of JSON Schema used
+/// above). Returns the first mismatch as `<json path>: <reason>`.
+#[cfg(test)]
+pub(crate) fn validate(schema: &Value, value: &Value) -> std::result::Result<(), String> {
+    check(schema, schema, value, "$")
+}
+
+#[cfg(test)]
+fn check(root: &Value, schema: &Value, value: &Value, at: &str) -> std::result::Result<(), String> {
+    if let Some(target) = schema.get("$ref").and_then(Value::as_str) {
+        let name = target.trim_start_matches("#/$defs/");
+        let def = root
+            .pointer(&format!("/$defs/{name}"))
+            .ok_or_else(|| format!("{at}: dangling $ref {target}"))?;
+        return check(root, def, value, at);
+    }
+    if let Some(allowed) = schema.get("enum").and_then(Value::as_array) {
+        if !allowed.contains(value) {
+            return Err(format!("{at}: {value} not in {allowed:?}"));
+        }
+    }
+    let ok = match schema.get("type").and_then(Value::as_str) {
+        Some("object") => value.is_object(),
+        Some("array") => value.is_array(),
+        Some("string") => value.is_string(),
+        Some("boolean") => value.is_boolean(),
+        Some("integer") => value.is_i64() || value.is_u64(),
+        _ => true,
+    };
+    if !ok {
+        return Err(format!("{at}: expected {}, got {value}", schema["type"]));
+    }
+    if let Some(min) = schema.get("minimum").and_then(Value::as_i64) {
+        if value.as_i64().is_some_and(|v| v < min) {
+            return Err(format!("{at}: {value} below minimum {min}"));
+        }
+    }
+    if let Some(items) = schema.get("items") {
+        for (i, item) in value.as_array().into_iter().flatten().enumerate() {
+            check(root, items, item, &format!("{at}[{i}]"))?;
+        }
+    }
+    if let Some(fields) = value.as_object() {
+        let properties = schema.get("properties").and_then(Value::as_object);
+        for name in schema
+            .get("required")
+            .and_then(Value::as_array)
+            .into_iter()
+            .flatten()
+            .filter_map(Value::as_str)
+        {
+            if !fields.contains_key(name) {
+                return Err(format!("{at}: missing required `{name}`"));
+            }
+        }
+        for (name, field) in fields {
+            match properties.and_then(|p| p.get(name)) {
+                Some(sub) => check(root, sub, field, &format!("{at}.{name}"))?,
+                None if schema.get("additionalProperties") == Some(&Value::Bool(false)) => {
+                    return Err(format!("{at}: `{name}` is not in the schema"));
+                }
+                None => {}
+            }
+        }
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::commands::tests::support::make_ctx;
+    use crate::testing::TempEnvironment;
+
+    #[test]
+    fn every_listed_command_has_a_schema_whose_refs_resolve() {
+        for (command, type_name) in SCHEMA_COMMANDS {
+            let doc = schema(command).unwrap();
+            assert_eq!(doc["$schema"], DRAFT);
+            assert!(doc["title"].as_str().unwrap().contains(type_name));
+            let text = doc.to_string();
+            for name in text.split("#/$defs/").skip(1) {
+                let name = name.split('"').next().unwrap();
+                assert!(
+                    doc.pointer(&format!("/$defs/{name}")).is_some(),
+                    "{command}: dangling ref {name}"
+                );
+            }
+        }
+        assert_eq!(
+            schema("trash  list").unwrap()["title"],
+            schema("trash list").unwrap()["title"]
+        );
+        let err = schema("frobnicate").unwrap_err().to_string();
+        assert!(err.contains("available: status"), "{err}");
+    }
+
+    #[test]
+    fn real_results_match_their_schemas() {
+        let env = TempEnvironment::builder()
+            .pack("git")
+            .file("gitconfig", "[user]\n  name = test")
+            .file("aliases.sh", "alias g=git")
+            .done()
+            .pack("vim")
+            .file("vimrc", "set nocompatible")
+            .file("install.sh", "echo hi")
+            .done()
+            .build();
+        let ctx = make_ctx(&env);
+
+        let pending = crate::commands::status::status(None, &ctx).unwrap();
+        crate::commands::up::up(None, &ctx).unwrap();
+        let deployed = crate::commands::status::status(None, &ctx).unwrap();
+        let status_schema = schema("status").unwrap();
+        for result in [&pending, &deployed] {
+            let value = serde_json::to_value(result).unwrap();
+            validate(&status_schema, &value).unwrap_or_else(|e| panic!("{e}\n{value:#}"));
+        }
+
+        let list_schema = schema("list").unwrap();
+        let list = crate::commands::list::list(&ctx).unwrap();
+        validate(&list_schema, &serde_json::to_value(list).unwrap()).unwrap();
+        let files = crate::commands::list::list_files(&Default::default(), &ctx).unwrap();
+        validate(&list_schema, &serde_json::to_value(files).unwrap()).unwrap();
+
+        let message = crate::commands::MessageResult {
+            message: "done".into(),
+            details: vec!["a".into()],
+        };
+        validate(
+            &schema("run").unwrap(),
+            &serde_json::to_value(message).unwrap(),
+        )
+        .unwrap();
+
+        let plan = crate::commands::plan::plan_command(None, None, &ctx).unwrap();
+        validate(
+            &schema("plan").unwrap(),
+            &serde_json::to_value(plan).unwrap(),
+        )
+        .unwrap();
+
+        let trash = crate::commands::trash::list(&ctx).unwrap();
+        validate(
+            &schema("trash list").unwrap(),
+            &serde_json::to_value(trash).unwrap(),
+        )
+        .unwrap();
+
+        let pinned = crate::commands::pin::pin("vim", Some("testing"), &ctx).unwrap();
+        validate(
+            &schema("pin").unwrap(),
+            &serde_json::to_value(pinned).unwrap(),
+        )
+        .unwrap();
+        let protected = crate::commands::protect::list(&ctx).unwrap();
+        validate(
+            &schema("protect list").unwrap(),
+            &serde_json::to_value(protected).unwrap(),
+        )
+        .unwrap();
+        let value =
+            serde_json::to_value(crate::commands::status::status(None, &ctx).unwrap()).unwrap();
+        assert_eq!(value["packs"][1]["pinned"], true, "{value:#}");
+        validate(&status_schema, &value).unwrap_or_else(|e| panic!("{e}\n{value:#}"));
+
+        env.fs
+            .remove_file(&env.dotfiles_root.join("git/aliases.sh"))
+            .unwrap();
+        let doctor = crate::commands::doctor::shell(&ctx).unwrap();
+        assert!(!doctor.issues.is_empty());
+        validate(
+            &schema("doctor").unwrap(),
+            &serde_json::to_value(doctor).unwrap(),
+        )
+        .unwrap();
+    }
+
+    #[test]
+    fn validator_rejects_unknown_and_missing_fields() {
+        let doc = schema("list").unwrap();
+        assert!(validate(
+            &doc,
+            &json!({ "packs": [{ "name": "vim", "ignored": false }] })
+        )
+        .is_ok());
+        assert!(validate(&doc, &json!({ "packs": [{ "name": "vim" }] }))
+            .unwrap_err()
+            .contains("missing required `ignored`"));
+        assert!(validate(&doc, &json!({ "packs": [], "extra": 1 }))
+            .unwrap_err()
+            .contains("`extra` is not in the schema"));
+    }
+}
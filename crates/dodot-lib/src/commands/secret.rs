@@ -217,6 +217,9 @@ pub fn list(ctx: &ExecutionContext) -> Result<ListResult> {
             if p.secret_tool.enabled {
                 s.insert("secret-tool".into());
             }
+            if p.vault.enabled {
+                s.insert("vault".into());
+            }
         }
         s
     };
@@ -228,11 +231,11 @@ pub fn list(ctx: &ExecutionContext) -> Result<ListResult> {
 
     for pack in &packs {
         let pack_config = ctx.config_manager.config_for_pack(&pack.path)?;
-        // Skip packs gated out by `[pack] os` on this host — same
-        // posture as `dodot status`. Without this, `secret list`
-        // surfaces references from packs that won't run on the
-        // current OS, which is misleading.
-        if !crate::gates::pack_os_active(&pack_config.pack.os, host) {
+        // Skip packs gated out by `[pack] os` or `[pack] roles` on
+        // this host — same posture as `dodot status`. Without this,
+        // `secret list` surfaces references from packs that won't run
+        // here, which is misleading.
+        if crate::gates::pack_inactive_reason(&pack_config.pack, host).is_some() {
             continue;
         }
         let gates = {
@@ -240,6 +243,7 @@ pub fn list(ctx: &ExecutionContext) -> Result<ListResult> {
             if !pack_config.gates.is_empty() {
                 t.merge_user(&pack_config.gates)?;
             }
+            t.set_platform_suffixes(pack_config.mappings.platform_suffixes);
             t
         };
         let compiled_mapping_gates =
@@ -277,7 +281,7 @@ pub fn list(ctx: &ExecutionContext) -> Result<ListResult> {
                 .iter()
                 .find(|(pat, _)| pat.matches(&rel_str_for_glob))
                 .map(|(_, label)| *label);
-            let basename_gate = crate::gates::parse_basename_gate(&filename);
+            let basename_gate = gates.parse_basename(&filename);
 
             if let (Some(map_label), crate::gates::BasenameGate::Found { .. }) =
                 (mapping_match, &basename_gate)
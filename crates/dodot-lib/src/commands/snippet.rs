@@ -0,0 +1,254 @@
+//! `dodot snippet` — the shell rc block that loads dodot.
+//!
+//! The block exports `DOTFILES_ROOT` and loads the init script:
+//! `eval "$(dodot init-sh)"` for bash and zsh, `dodot init-sh --fish
+//! | source` for fish (which can't eval the POSIX script). Neither
+//! names a generated file, so a `$HOME` shared between hosts with
+//! per-host data dirs gets one block that suits them all. It
+//! sits between two guard lines, and its last line before the closing
+//! guard records a checksum of the lines above it:
+//!
+//! ```text
+//! # >>> dodot (managed by `dodot snippet`) >>>
+//! export DOTFILES_ROOT='/home/me/dotfiles'
+//! eval "$(dodot init-sh)"
+//! # checksum: 3f2a…
+//! # <<< dodot <<<
+//! ```
+//!
+//! - `dodot snippet` prints the block for the shell and says whether
+//!   the rc file already has it.
+//! - `--install` writes it: creates the rc file, appends, or replaces
+//!   an older block in place. Running it again changes nothing.
+//! - `--uninstall` removes it.
+//!
+//! Both refuse to touch a block whose checksum no longer matches —
+//! someone edited inside the guards — unless `--force` is given.
+//! Content outside the guards is never touched. `dodot clone` installs
+//! the same block; blocks it wrote before the checksum existed are
+//! recognised and upgraded.
+
+use crate::commands::git_alias::{
+    find_guarded_block, render_home_relative, upsert_guarded_block, InstallAliasOutcome, Shell,
+};
+use crate::commands::MessageResult;
+use crate::handlers::run_once::file_checksum_bytes;
+use crate::packs::orchestration::ExecutionContext;
+use crate::{DodotError, Result};
+
+pub(crate) const GUARD_START: &str = "# >>> dodot (managed by `dodot snippet`) >>>";
+pub(crate) const GUARD_END: &str = "# <<< dodot <<<";
+
+/// Guard line of blocks `dodot clone` wrote before this command
+/// existed. Same body, no checksum.
+const LEGACY_GUARD_START: &str = "# >>> dodot (managed by `dodot clone`) >>>";
+
+const CHECKSUM_PREFIX: &str = "# checksum: ";
+
+/// What the rc file holds for the block.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+enum BlockState {
+    Missing,
+    /// Byte-for-byte the block `install` would write.
+    Current,
+    /// A dodot-written block with other content — the dotfiles root
+    /// moved, or it predates the checksum.
+    Outdated,
+    /// The checksum doesn't match the lines above it.
+    Edited,
+}
+
+/// The rc block for `shell`, pointing at this context's dotfiles root.
+pub fn block(ctx: &ExecutionContext, shell: Shell) -> String {
+    let root = ctx.paths.dotfiles_root().display().to_string();
+    let body = match shell {
+        Shell::Bash | Shell::Zsh => format!(
+            "export DOTFILES_ROOT={}\neval \"$(dodot init-sh)\"\n",
+            crate::shell::sh_quote(&root)
+        ),
+        Shell::Fish => format!(
+            "set -gx DOTFILES_ROOT {}\ndodot init-sh --fish | source\n",
+            crate::shell::exports::fish_quote(&root)
+        ),
+    };
+    format!(
+        "{GUARD_START}\n{body}{CHECKSUM_PREFIX}{}\n{GUARD_END}\n",
+        file_checksum_bytes(body.as_bytes())
+    )
+}
+
+/// Byte range of the block in `text`, under the current or the legacy
+/// guard.
+fn locate(text: &str) -> Option<(usize, usize)> {
+    find_guarded_block(text, GUARD_START, GUARD_END)
+        .or_else(|| find_guarded_block(text, LEGACY_GUARD_START, GUARD_END))
+}
+
+fn state_of(existing: &str, wanted: &str) -> BlockState {
+    if existing == wanted {
+        return BlockState::Current;
+    }
+    let lines: Vec<&str> = existing.lines().collect();
+    // Guard, body…, checksum, guard.
+    let recorded = lines
+        .len()
+        .checked_sub(2)
+        .and_then(|i| lines[i].strip_prefix(CHECKSUM_PREFIX));
+    match recorded {
+        None if existing.starts_with(LEGACY_GUARD_START) => BlockState::Outdated,
+        None => BlockState::Edited,
+        Some(sum) => {
+            let body: String = lines[1..lines.len() - 2]
+                .iter()
+                .map(|l| format!("{l}\n"))
+                .collect();
+            if file_checksum_bytes(body.as_bytes()) == sum.trim() {
+                BlockState::Outdated
+            } else {
+                BlockState::Edited
+            }
+        }
+    }
+}
+
+/// The rc file's text, the block's range in it and its state.
+fn inspect(
+    ctx: &ExecutionContext,
+    shell: Shell,
+) -> Result<(Option<String>, Option<(usize, usize)>, BlockState)> {
+    let rc_path = ctx.paths.home_dir().join(shell.rc_relative_path());
+    if !ctx.fs.exists(&rc_path) {
+        return Ok((None, None, BlockState::Missing));
+    }
+    let text = ctx.fs.read_to_string(&rc_path)?;
+    let Some(range) = locate(&text) else {
+        return Ok((Some(text), None, BlockState::Missing));
+    };
+    let state = state_of(&text[range.0..range.1], &block(ctx, shell));
+    Ok((Some(text), Some(range), state))
+}
+
+fn edited_error(rc_display: &str) -> DodotError {
+    DodotError::Other(format!(
+        "the dodot block in {rc_display} was edited by hand (its checksum no longer \
+         matches). Move your changes outside the `# >>> dodot` / `# <<< dodot <<<` \
+         lines, or re-run with --force to overwrite them."
+    ))
+}
+
+/// Install or update the block. Shared with `dodot clone`.
+pub(crate) fn install_block(ctx: &ExecutionContext, shell: Shell) -> Result<InstallAliasOutcome> {
+    let rc_path = ctx.paths.home_dir().join(shell.rc_relative_path());
+    let wanted = block(ctx, shell);
+    let (text, range, state) = inspect(ctx, shell)?;
+    match (state, text, range) {
+        (BlockState::Current, ..) => Ok(InstallAliasOutcome::AlreadyInstalled),
+        (BlockState::Edited, ..) if !ctx.force => Err(edited_error(&render_home_relative(
+            &rc_path,
+            ctx.paths.home_dir(),
+        ))),
+        (_, Some(text), Some((start, end))) => {
+            let updated = format!("{}{wanted}{}", &text[..start], &text[end..]);
+            ctx.fs.write_file(&rc_path, updated.as_bytes())?;
+            Ok(InstallAliasOutcome::Updated)
+        }
+        _ => upsert_guarded_block(ctx.fs.as_ref(), &rc_path, &wanted, GUARD_START, GUARD_END),
+    }
+}
+
+/// `dodot snippet` — print the block.
+pub fn show(ctx: &ExecutionContext, shell: Shell) -> Result<MessageResult> {
+    let rc_path = ctx.paths.home_dir().join(shell.rc_relative_path());
+    let rc_display = render_home_relative(&rc_path, ctx.paths.home_dir());
+    let (_, _, state) = inspect(ctx, shell)?;
+    let message = match state {
+        BlockState::Current => format!("{rc_display} already loads dodot:"),
+        BlockState::Missing => {
+            format!("Add this to {rc_display}, or run `dodot snippet --install`:")
+        }
+        BlockState::Outdated => format!(
+            "{rc_display} has an older dodot block; `dodot snippet --install` replaces it with:"
+        ),
+        BlockState::Edited => format!(
+            "{rc_display} has a dodot block edited by hand; \
+             `dodot snippet --install --force` replaces it with:"
+        ),
+    };
+    Ok(MessageResult {
+        message,
+        details: block(ctx, shell).lines().map(str::to_string).collect(),
+    })
+}
+
+/// `dodot snippet --install`.
+pub fn install(ctx: &ExecutionContext, shell: Shell) -> Result<MessageResult> {
+    let rc_path = ctx.paths.home_dir().join(shell.rc_relative_path());
+    let rc_display = render_home_relative(&rc_path, ctx.paths.home_dir());
+    let message = match install_block(ctx, shell)? {
+        InstallAliasOutcome::AlreadyInstalled => {
+            return Ok(MessageResult {
+                message: format!("{rc_display} already loads dodot; nothing to do."),
+                details: Vec::new(),
+            })
+        }
+        InstallAliasOutcome::Created => format!("Created {rc_display} with the dodot block."),
+        InstallAliasOutcome::Appended => format!("Added the dodot block to {rc_display}."),
+        InstallAliasOutcome::Updated => format!("Updated the dodot block in {rc_display}."),
+    };
+    Ok(MessageResult {
+        message,
+        details: vec![format!(
+            "Open a new shell, or run `source {rc_display}`, to pick it up."
+        )],
+    })
+}
+
+/// `dodot snippet --uninstall`.
+pub fn uninstall(ctx: &ExecutionContext, shell: Shell) -> Result<MessageResult> {
+    let rc_path = ctx.paths.home_dir().join(shell.rc_relative_path());
+    let rc_display = render_home_relative(&rc_path, ctx.paths.home_dir());
+    let (text, range, state) = inspect(ctx, shell)?;
+    let (Some(text), Some((start, end))) = (text, range) else {
+        return Ok(MessageResult {
+            message: format!("{rc_display} has no dodot block; nothing to do."),
+            details: Vec::new(),
+        });
+    };
+    if state == BlockState::Edited && !ctx.force {
+        return Err(edited_error(&rc_display));
+    }
+    // Drop the blank line `install` put above the block, if any.
+    let before = &text[..start];
+    let before = before
+        .strip_suffix('\n')
+        .filter(|b| b.ends_with('\n'))
+        .unwrap_or(before);
+    let updated = format!("{before}{}", &text[end..]);
+    ctx.fs.write_file(&rc_path, updated.as_bytes())?;
+    Ok(MessageResult {
+        message: format!("Removed the dodot block from {rc_display}."),
+        details: vec!["New shells no longer load dodot; open shells keep what they loaded.".into()],
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn checksum_tells_outdated_from_edited_blocks() {
+        let body = "export DOTFILES_ROOT='/old'\neval \"$(dodot init-sh)\"\n";
+        let written = format!(
+            "{GUARD_START}\n{body}{CHECKSUM_PREFIX}{}\n{GUARD_END}\n",
+            file_checksum_bytes(body.as_bytes())
+        );
+        assert_eq!(state_of(&written, &written), BlockState::Current);
+        assert_eq!(state_of(&written, "other"), BlockState::Outdated);
+
+        let edited = written.replace("/old", "/mine");
+        assert_eq!(state_of(&edited, "other"), BlockState::Edited);
+
+        let legacy = format!("{LEGACY_GUARD_START}\n{body}{GUARD_END}\n");
+        assert_eq!(state_of(&legacy, "other"), BlockState::Outdated);
+    }
+}
@@ -0,0 +1,393 @@
+//! `dodot state export` / `dodot state import` — carry datastore state
+//! to a re-imaged machine.
+//!
+//! The datastore records "what was provisioned" as data links and
+//! sentinel files under `<data_dir>/packs/<pack>/<handler>/`. Export
+//! serializes those entries to one JSON file; import writes them back
+//! so the next `dodot up` finds install scripts and Brewfiles already
+//! recorded as run instead of re-running hours of installs.
+//!
+//! Import validates against the repo it runs in:
+//!
+//! - entries for packs that no longer exist are skipped;
+//! - data links are re-rooted from the exporting machine's dotfiles
+//!   root to this one's, and skipped when the source file is gone;
+//! - existing entries are kept unless `--force`.
+//!
+//! Rendered preprocessor output is not exported — `up` regenerates it.
+//! User-facing links (`~/.vimrc → datastore`) aren't datastore state
+//! either; `up` recreates them cheaply.
+
+use std::path::{Path, PathBuf};
+
+use serde::{Deserialize, Serialize};
+
+use crate::commands::MessageResult;
+use crate::datastore::sentinel::unix_now;
+use crate::fs::{Fs, ATOMIC_TMP_SUFFIX};
+use crate::packs;
+use crate::packs::orchestration::ExecutionContext;
+use crate::paths::Pather;
+use crate::{DodotError, Result};
+
+/// Bumped when the file layout changes incompatibly.
+pub const STATE_FORMAT_VERSION: u32 = 1;
+
+/// Handler dir holding rendered preprocessor output — regenerable, so
+/// not part of exported state.
+const PREPROCESSED_HANDLER: &str = "preprocessed";
+
+/// Serialized datastore state.
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct StateSnapshot {
+    pub version: u32,
+    /// Dotfiles root on the exporting machine; data links under it are
+    /// re-rooted on import.
+    pub dotfiles_root: PathBuf,
+    pub exported_at: u64,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub hostname: Option<String>,
+    pub entries: Vec<StateEntry>,
+}
+
+/// One file in a handler's data dir.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct StateEntry {
+    pub pack: String,
+    pub handler: String,
+    pub name: String,
+    #[serde(flatten)]
+    pub kind: StateEntryKind,
+}
+
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(tag = "kind", rename_all = "lowercase")]
+pub enum StateEntryKind {
+    /// Data link (symlink, shell, path handlers) and its target.
+    Link { target: PathBuf },
+    /// Sentinel or snapshot file and its text content.
+    File { content: String },
+}
+
+/// Write the datastore's state to `file`.
+pub fn export(ctx: &ExecutionContext, file: &Path) -> Result<MessageResult> {
+    let fs = ctx.fs.as_ref();
+    let (entries, skipped) = collect(fs, ctx.paths.as_ref())?;
+    let snapshot = StateSnapshot {
+        version: STATE_FORMAT_VERSION,
+        dotfiles_root: ctx.paths.dotfiles_root().to_path_buf(),
+        exported_at: unix_now(),
+        hostname: crate::gates::detect_hostname(),
+        entries,
+    };
+    let json = serde_json::to_string_pretty(&snapshot)
+        .map_err(|e| DodotError::Other(format!("failed to serialize state: {e}")))?;
+
+    let (links, files) = count_kinds(&snapshot.entries);
+    let mut details = vec![format!("{links} data link(s), {files} sentinel file(s)")];
+    if skipped > 0 {
+        details.push(format!(
+            "{skipped} non-text file(s) left out; `dodot up` rebuilds them"
+        ));
+    }
+    if ctx.dry_run {
+        details.push("Dry run: nothing written.".into());
+    } else {
+        if let Some(parent) = file.parent().filter(|p| !p.as_os_str().is_empty()) {
+            fs.mkdir_all(parent)?;
+        }
+        fs.write_file_atomic(file, json.as_bytes())?;
+    }
+    details.push(format!(
+        "Restore on another machine with `dodot state import {}`.",
+        file.display()
+    ));
+
+    Ok(MessageResult {
+        message: format!("Exported dodot state to {}", file.display()),
+        details,
+    })
+}
+
+/// Restore state from `file` into this machine's datastore.
+pub fn import(ctx: &ExecutionContext, file: &Path) -> Result<MessageResult> {
+    let fs = ctx.fs.as_ref();
+    let paths = ctx.paths.as_ref();
+    let snapshot = parse(&fs.read_to_string(file)?)?;
+
+    let root_config = ctx.config_manager.root_config()?;
+    let scanned = packs::scan_root(fs, paths.dotfiles_root(), &root_config.pack)?;
+    let known: Vec<&str> = scanned.packs.iter().map(|p| p.name.as_str()).collect();
+
+    let mut restored = 0;
+    let mut kept = 0;
+    let mut problems: Vec<String> = Vec::new();
+    for entry in &snapshot.entries {
+        let label = format!("{}/{}/{}", entry.pack, entry.handler, entry.name);
+        if !known.contains(&entry.pack.as_str()) {
+            problems.push(format!("{label}: pack not in this repo"));
+            continue;
+        }
+        if !is_plain_name(&entry.pack)
+            || !is_plain_name(&entry.handler)
+            || !is_plain_name(&entry.name)
+        {
+            problems.push(format!("{label}: not a valid datastore path"));
+            continue;
+        }
+        let dest = paths
+            .handler_data_dir(&entry.pack, &entry.handler)
+            .join(&entry.name);
+        if (fs.exists(&dest) || fs.is_symlink(&dest)) && !ctx.force {
+            kept += 1;
+            continue;
+        }
+
+        match &entry.kind {
+            StateEntryKind::Link { target } => {
+                let target = reroot(target, &snapshot.dotfiles_root, paths.dotfiles_root());
+                if !fs.exists(&target) {
+                    problems.push(format!(
+                        "{label}: source {} does not exist here",
+                        target.display()
+                    ));
+                    continue;
+                }
+                if !ctx.dry_run {
+                    replace(fs, &dest)?;
+                    fs.symlink(&target, &dest)?;
+                }
+            }
+            StateEntryKind::File { content } => {
+                if !ctx.dry_run {
+                    replace(fs, &dest)?;
+                    fs.write_file_atomic(&dest, content.as_bytes())?;
+                }
+            }
+        }
+        restored += 1;
+    }
+
+    let mut details = vec![format!(
+        "{restored} restored, {kept} already present{}",
+        if ctx.force {
+            ""
+        } else {
+            " (kept; use --force to overwrite)"
+        }
+    )];
+    if !problems.is_empty() {
+        details.push(format!("{} skipped:", problems.len()));
+        details.extend(problems.into_iter().map(|p| format!("  {p}")));
+    }
+    if ctx.dry_run {
+        details.push("Dry run: nothing written.".into());
+    } else {
+        ctx.datastore.reindex()?;
+        details.push("Run `dodot up` to recreate user links and the init script.".into());
+    }
+
+    let from = snapshot
+        .hostname
+        .as_deref()
+        .map(|h| format!(" (exported on {h})"))
+        .unwrap_or_default();
+    Ok(MessageResult {
+        message: format!("Imported dodot state from {}{from}", file.display()),
+        details,
+    })
+}
+
+/// Rebuild the datastore's index from the files under the data dir,
+/// after editing them by hand (deleting a sentinel to force a re-run).
+/// Only the `sqlite` backend keeps one.
+pub fn reindex(ctx: &ExecutionContext) -> Result<MessageResult> {
+    ctx.datastore.reindex()?;
+    Ok(MessageResult {
+        message: "Rebuilt the datastore index from the data dir.".into(),
+        details: Vec::new(),
+    })
+}
+
+fn parse(json: &str) -> Result<StateSnapshot> {
+    let snapshot: StateSnapshot = serde_json::from_str(json)
+        .map_err(|e| DodotError::Other(format!("not a dodot state file: {e}")))?;
+    if snapshot.version != STATE_FORMAT_VERSION {
+        return Err(DodotError::Other(format!(
+            "unsupported state file version {} (this dodot reads version {STATE_FORMAT_VERSION})",
+            snapshot.version
+        )));
+    }
+    Ok(snapshot)
+}
+
+/// Walk `<data_dir>/packs/<pack>/<handler>/`. Returns the entries plus
+/// how many files were left out for not being text.
+fn collect(fs: &dyn Fs, paths: &dyn Pather) -> Result<(Vec<StateEntry>, usize)> {
+    let mut entries = Vec::new();
+    let mut skipped = 0;
+    let packs_dir = paths.data_dir().join("packs");
+    if !fs.is_dir(&packs_dir) {
+        return Ok((entries, skipped));
+    }
+    for pack in fs.read_dir(&packs_dir)?.into_iter().filter(|e| e.is_dir) {
+        for handler in fs.read_dir(&pack.path)?.into_iter().filter(|e| e.is_dir) {
+            if handler.name == PREPROCESSED_HANDLER {
+                continue;
+            }
+            for item in fs.read_dir(&handler.path)? {
+                if item.name.ends_with(ATOMIC_TMP_SUFFIX) {
+                    continue;
+                }
+                let kind = if item.is_symlink {
+                    StateEntryKind::Link {
+                        target: fs.readlink(&item.path)?,
+                    }
+                } else if item.is_file {
+                    match String::from_utf8(fs.read_file(&item.path)?) {
+                        Ok(content) => StateEntryKind::File { content },
+                        Err(_) => {
+                            skipped += 1;
+                            continue;
+                        }
+                    }
+                } else {
+                    continue;
+                };
+                entries.push(StateEntry {
+                    pack: pack.name.clone(),
+                    handler: handler.name.clone(),
+                    name: item.name,
+                    kind,
+                });
+            }
+        }
+    }
+    entries.sort_by(|a, b| (&a.pack, &a.handler, &a.name).cmp(&(&b.pack, &b.handler, &b.name)));
+    Ok((entries, skipped))
+}
+
+fn count_kinds(entries: &[StateEntry]) -> (usize, usize) {
+    let links = entries
+        .iter()
+        .filter(|e| matches!(e.kind, StateEntryKind::Link { .. }))
+        .count();
+    (links, entries.len() - links)
+}
+
+/// Move `target` from under `old_root` to under `new_root`. Targets
+/// outside the old root (absolute paths elsewhere) are kept as-is.
+fn reroot(target: &Path, old_root: &Path, new_root: &Path) -> PathBuf {
+    match target.strip_prefix(old_root) {
+        Ok(rel) => new_root.join(rel),
+        Err(_) => target.to_path_buf(),
+    }
+}
+
+/// A single path component — keeps a crafted state file from writing
+/// outside the data dir.
+fn is_plain_name(name: &str) -> bool {
+    !name.is_empty() && name != "." && name != ".." && !name.contains(['/', '\\'])
+}
+
+fn replace(fs: &dyn Fs, dest: &Path) -> Result<()> {
+    if fs.is_symlink(dest) || fs.exists(dest) {
+        fs.remove_file(dest)?;
+    } else if let Some(parent) = dest.parent() {
+        fs.mkdir_all(parent)?;
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::commands::tests::support::make_ctx;
+    use crate::testing::TempEnvironment;
+
+    #[test]
+    fn export_then_import_restores_sentinels_and_links() {
+        let env = TempEnvironment::builder()
+            .pack("vim")
+            .file("vimrc", "x")
+            .file("install.sh", "echo hi")
+            .done()
+            .build();
+        let fs = env.fs.as_ref();
+        let install_dir = env.paths.handler_data_dir("vim", "install");
+        let symlink_dir = env.paths.handler_data_dir("vim", "symlink");
+        fs.mkdir_all(&install_dir).unwrap();
+        fs.mkdir_all(&symlink_dir).unwrap();
+        fs.write_file(
+            &install_dir.join("install.sh-0123456789abcdef"),
+            b"{\"completed_at\":1700000000}",
+        )
+        .unwrap();
+        fs.symlink(
+            &env.dotfiles_root.join("vim/vimrc"),
+            &symlink_dir.join("vimrc"),
+        )
+        .unwrap();
+        // A sentinel for a pack this repo no longer has.
+        let gone = env.paths.handler_data_dir("old", "install");
+        fs.mkdir_all(&gone).unwrap();
+        fs.write_file(&gone.join("install.sh-fedcba9876543210"), b"completed|1")
+            .unwrap();
+
+        let ctx = make_ctx(&env);
+        let file = env.home.join("dodot-state.json");
+        export(&ctx, &file).unwrap();
+        let snapshot = parse(&fs.read_to_string(&file).unwrap()).unwrap();
+        assert_eq!(snapshot.entries.len(), 3);
+
+        fs.remove_dir_all(&env.paths.data_dir().join("packs"))
+            .unwrap();
+        let result = import(&ctx, &file).unwrap();
+        assert!(
+            result.details[0].starts_with("2 restored"),
+            "{:?}",
+            result.details
+        );
+        assert!(
+            result.details.iter().any(|d| d.contains("old/install")),
+            "{:?}",
+            result.details
+        );
+        assert_eq!(
+            fs.read_to_string(&install_dir.join("install.sh-0123456789abcdef"))
+                .unwrap(),
+            "{\"completed_at\":1700000000}"
+        );
+        assert_eq!(
+            fs.readlink(&symlink_dir.join("vimrc")).unwrap(),
+            env.dotfiles_root.join("vim/vimrc")
+        );
+        assert!(!fs.exists(&gone));
+
+        // Importing again keeps what is there.
+        let again = import(&ctx, &file).unwrap();
+        assert!(again.details[0].starts_with("0 restored, 2 already present"));
+    }
+
+    #[test]
+    fn reroot_moves_targets_under_the_new_root() {
+        assert_eq!(
+            reroot(
+                Path::new("/old/dots/vim/vimrc"),
+                Path::new("/old/dots"),
+                Path::new("/new/dots")
+            ),
+            PathBuf::from("/new/dots/vim/vimrc")
+        );
+        assert_eq!(
+            reroot(
+                Path::new("/opt/x"),
+                Path::new("/old/dots"),
+                Path::new("/new")
+            ),
+            PathBuf::from("/opt/x")
+        );
+        assert!(!is_plain_name(".."));
+        assert!(!is_plain_name("a/b"));
+    }
+}
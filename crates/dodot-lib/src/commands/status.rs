@@ -8,23 +8,27 @@
 //! potential conflicts as warnings — even for packs that aren't deployed
 //! yet. This lets users see problems before they run `up`.
 
+use serde::Serialize;
 use tracing::{debug, info};
 
+use crate::commands::status_report::{ItemReport, PackReport, StatusReport};
 use crate::commands::{
-    handler_description, handler_symbol, DisplayConflict, DisplayDiff, DisplayFile, DisplayNote,
-    DisplayPack, PackStatusResult,
+    summary_line, DisplayConflict, DisplayDiff, DisplayNote, DisplayPack, PackStatusResult,
 };
 use crate::config::mappings_to_rules;
 use crate::conflicts;
-use crate::datastore::DidRunStatus;
+use crate::copies;
+use crate::datastore::{DidRunStatus, SentinelRecord};
+use crate::fs::Fs;
 use crate::handlers::run_once::{file_checksum, run_once_status_messages};
 use crate::handlers::{
-    self, HANDLER_GATE, HANDLER_HOMEBREW, HANDLER_IGNORE, HANDLER_INSTALL, HANDLER_NIX,
-    HANDLER_SKIP, HANDLER_SYMLINK,
+    self, HANDLER_EDITORS, HANDLER_GATE, HANDLER_HOMEBREW, HANDLER_IGNORE, HANDLER_INSTALL,
+    HANDLER_NIX, HANDLER_PATH, HANDLER_SKIP, HANDLER_SYMLINK,
 };
-use crate::operations::HandlerIntent;
+use crate::operations::{HandlerIntent, LinkMode};
 use crate::packs::orchestration::{self, ExecutionContext};
 use crate::packs::{self};
+use crate::paths::Pather;
 use crate::rules::Scanner;
 use crate::Result;
 
@@ -57,10 +61,24 @@ enum Health {
     /// version" copy plus a `(N+ M-)` line summary when a snapshot is
     /// on disk).
     RanOlderVersion { label: String },
+    /// Brewfile whose last run failed partway: some entries installed,
+    /// `failed` didn't. Still pending — the next run retries the rest.
+    PartiallyRan {
+        installed: usize,
+        failed: Vec<String>,
+    },
+    /// Shell source whose content no longer matches the checksum
+    /// recorded at the last `dodot up`. Still sourced (the link is
+    /// live); flagged so edits from a pull or another editor are
+    /// visible. See [`crate::shell::checksum`].
+    ChangedSinceLinked,
     /// File matched the `mappings.skip` list (README, LICENSE, …).
     /// No handler runs on it, but it surfaces in status so users can see
     /// the rule applied rather than wondering why the file is "missing."
     Skipped,
+    /// File left out of this invocation by `--only` / `--skip` (the
+    /// flag). Whatever an earlier `dodot up` deployed for it stays.
+    Excluded(String),
     /// File carries a gate label whose predicate evaluates false on this
     /// host (e.g. `install._linux.sh` on macOS). The file is not deployed
     /// but is surfaced so users see the rule applied. The footnote shows
@@ -90,7 +108,10 @@ impl Health {
             // pack with an older-version entry is one user action away
             // from being current.
             Health::RanOlderVersion { .. } => "stale",
+            Health::PartiallyRan { .. } => "warning",
+            Health::ChangedSinceLinked => "stale",
             Health::Skipped => "skipped",
+            Health::Excluded(_) => "skipped",
             Health::Gated { .. } => "skipped",
         }
     }
@@ -116,7 +137,15 @@ impl Health {
             Health::Broken(reason) => reason.clone(),
             Health::Stale(reason) => reason.clone(),
             Health::RanOlderVersion { label } => label.clone(),
+            Health::PartiallyRan { failed, .. } => {
+                format!("brew packages partly installed ({} failed)", failed.len())
+            }
+            Health::ChangedSinceLinked => "changed since linked".into(),
             Health::Skipped => "skipped".into(),
+            Health::Excluded(flag) => format!("skipped ({flag})"),
+            Health::Gated { label, .. } if label == crate::gates::ROLE_MISMATCH => {
+                format!("skipped: {label}")
+            }
             Health::Gated { label, .. } => format!("gated out ({label})"),
         }
     }
@@ -127,6 +156,11 @@ impl Health {
         match self {
             Health::PendingConflict { reason } => Some(reason.clone()),
             Health::DeployedWithError { reason, .. } => Some(reason.clone()),
+            Health::PartiallyRan { installed, failed } => Some(format!(
+                "failed: {}; {installed} other entr{} installed — `dodot up` retries the rest",
+                failed.join(", "),
+                if *installed == 1 { "y" } else { "ies" }
+            )),
             Health::Gated {
                 expected, actual, ..
             } => Some(format!("expected {expected}; got {actual}")),
@@ -223,21 +257,20 @@ fn verify_symlink(
     source: &std::path::Path,
     user_target: &std::path::Path,
     pack: &str,
-    ctx: &ExecutionContext,
+    handler: &str,
+    fs: &dyn Fs,
+    paths: &dyn Pather,
 ) -> Health {
     let filename = match source.file_name() {
         Some(f) => f,
         None => return Health::Pending,
     };
 
-    let data_link = ctx
-        .paths
-        .handler_data_dir(pack, HANDLER_SYMLINK)
-        .join(filename);
+    let data_link = paths.handler_data_dir(pack, handler).join(filename);
 
     // Step 1: Does the data link exist and is it a symlink?
-    if !ctx.fs.is_symlink(&data_link) {
-        if ctx.fs.exists(&data_link) {
+    if !fs.is_symlink(&data_link) {
+        if fs.exists(&data_link) {
             return Health::Broken("broken: data link exists but is not a symlink".into());
         }
         // No data link yet. Before declaring plain "pending", peek at the
@@ -255,19 +288,27 @@ fn verify_symlink(
         // #44: a non-symlink file whose content is byte-identical to the
         // source is also NOT a conflict — the executor will auto-replace
         // it without `--force`. Stay plain `pending` for that case.
-        if !ctx.fs.is_symlink(user_target) && ctx.fs.exists(user_target) {
-            if crate::equivalence::is_equivalent(user_target, source, ctx.fs.as_ref()) {
+        // Shared `$HOME` with per-host state: another machine's `up`
+        // owns the link, and ours would take it over.
+        if let Some(host) = foreign_host(user_target, fs, paths) {
+            return Health::PendingConflict {
+                reason: format!(
+                    "linked by host `{host}`, which shares this home; `dodot up` here takes it over"
+                ),
+            };
+        }
+        if !fs.is_symlink(user_target) && fs.exists(user_target) {
+            if crate::equivalence::is_equivalent(user_target, source, fs) {
                 return Health::Pending;
             }
-            let reason =
-                describe_blocking_target(user_target, ctx.fs.as_ref(), ctx.paths.home_dir());
+            let reason = describe_blocking_target(user_target, fs, paths.home_dir());
             return Health::PendingConflict { reason };
         }
         return Health::Pending;
     }
 
     // Step 2: Does data link point to the correct source?
-    match ctx.fs.readlink(&data_link) {
+    match fs.readlink(&data_link) {
         Ok(target) if target == source => {}
         Ok(target) => {
             return Health::Broken(format!("broken: data link points to {}", target.display()));
@@ -276,28 +317,32 @@ fn verify_symlink(
     }
 
     // Step 3: Does the source file still exist?
-    if !ctx.fs.exists(source) {
+    if !fs.exists(source) {
         return Health::Broken("broken: source file missing".into());
     }
 
     // Step 4: Check user link at the intent's target
-    if ctx.fs.is_symlink(user_target) {
-        match ctx.fs.readlink(user_target) {
-            Ok(link_target) if link_target == data_link => {
-                // Full chain verified
+    if fs.is_symlink(user_target) {
+        match fs.readlink(user_target) {
+            // Full chain verified, or a direct link (`[symlink]
+            // link_strategy = "direct"`) to the recorded source
+            Ok(link_target) if link_target == data_link || link_target == source => {
                 Health::Deployed
             }
-            Ok(_) => {
+            Ok(link_target) => match paths.linked_host(&link_target) {
+                Some(host) => Health::Stale(format!(
+                    "stale: linked by host `{host}` (shared home), re-deploy to take over"
+                )),
                 // User link exists but points elsewhere (another pack, manual link, etc.)
-                Health::Stale("stale: user link points elsewhere, re-deploy to fix".into())
-            }
+                None => Health::Stale("stale: user link points elsewhere, re-deploy to fix".into()),
+            },
             Err(_) => Health::Broken("broken: cannot read user link".into()),
         }
-    } else if ctx.fs.exists(user_target) {
+    } else if fs.exists(user_target) {
         // Non-symlink file at target. If its content is byte-identical to
         // the source, `up` will auto-replace it (#44) — surface as Stale
         // (re-deploy fixes), not Broken. Otherwise it's a real conflict.
-        if crate::equivalence::is_equivalent(user_target, source, ctx.fs.as_ref()) {
+        if crate::equivalence::is_equivalent(user_target, source, fs) {
             Health::Stale("stale: user link missing, re-deploy to fix".into())
         } else {
             Health::Broken("conflict: non-symlink file at target path".into())
@@ -309,6 +354,64 @@ fn verify_symlink(
     }
 }
 
+/// The host whose per-host data dir the symlink at `user_target`
+/// points into, when that isn't this host.
+fn foreign_host(user_target: &std::path::Path, fs: &dyn Fs, paths: &dyn Pather) -> Option<String> {
+    if !fs.is_symlink(user_target) {
+        return None;
+    }
+    paths.linked_host(&fs.readlink(user_target).ok()?)
+}
+
+/// Verify a target deployed with `[symlink] mode = "copy" | "hardlink"`.
+///
+/// There is no user-side chain to follow, so after checking the data
+/// link (same bookkeeping as symlink mode) the verdict comes from the
+/// content-hash comparison in [`copies::copy_state`]: a source edited
+/// since the last deploy is stale, a target edited in place is a
+/// conflict `up` won't resolve without `--force`.
+fn verify_copy(
+    source: &std::path::Path,
+    user_target: &std::path::Path,
+    pack: &str,
+    handler: &str,
+    fs: &dyn Fs,
+    paths: &dyn Pather,
+) -> Health {
+    let Some(filename) = source.file_name() else {
+        return Health::Pending;
+    };
+    let data_link = paths.handler_data_dir(pack, handler).join(filename);
+    let state = copies::copy_state(fs, paths, pack, source, user_target);
+
+    if !fs.is_symlink(&data_link) {
+        if state == copies::CopyState::Unrecorded && !fs.is_symlink(user_target) {
+            let reason = describe_blocking_target(user_target, fs, paths.home_dir());
+            return Health::PendingConflict { reason };
+        }
+        return Health::Pending;
+    }
+    if !fs.exists(source) {
+        return Health::Broken("broken: source file missing".into());
+    }
+    if fs.is_symlink(user_target) {
+        return Health::Stale("stale: target is a symlink, re-deploy to copy".into());
+    }
+    match state {
+        copies::CopyState::Current => Health::Deployed,
+        copies::CopyState::SourceChanged => {
+            Health::Stale("stale: source changed since copy, re-deploy to update".into())
+        }
+        copies::CopyState::TargetEdited => {
+            Health::Broken("conflict: target edited since copy (up --force overwrites)".into())
+        }
+        copies::CopyState::Missing => Health::Stale("stale: copy missing, re-deploy to fix".into()),
+        copies::CopyState::Unrecorded => Health::Broken(
+            "conflict: target differs from source and was not deployed by dodot".into(),
+        ),
+    }
+}
+
 /// Verify shell/path handler chain for a single file.
 ///
 /// Checks: data link exists → points to source → source exists.
@@ -376,6 +479,12 @@ fn verify_staged(
         if let Some((label, reason)) = recent_runtime_failures(source, pack, &filename_str, ctx) {
             return Health::DeployedWithError { label, reason };
         }
+
+        // (3) Content edited since the last `dodot up` recorded its
+        //     checksum.
+        if crate::shell::changed_since_linked(ctx.fs.as_ref(), ctx.paths.as_ref(), pack, source) {
+            return Health::ChangedSinceLinked;
+        }
     }
 
     Health::Deployed
@@ -428,7 +537,26 @@ fn run_once_health(
     };
 
     match status {
+        DidRunStatus::NeverRan if handler == HANDLER_HOMEBREW => {
+            match crate::handlers::homebrew::load_progress(
+                ctx.fs.as_ref(),
+                ctx.paths.as_ref(),
+                pack,
+                &filename,
+            ) {
+                Some(p) if p.applies_to(&current_hash) && !p.failed.is_empty() => {
+                    Health::PartiallyRan {
+                        installed: p.installed.len(),
+                        failed: p.failed,
+                    }
+                }
+                _ => Health::Pending,
+            }
+        }
         DidRunStatus::NeverRan => Health::Pending,
+        DidRunStatus::RanCurrent if handler == HANDLER_HOMEBREW && ctx.check_drift => {
+            brew_installed_health(file, ctx)
+        }
         DidRunStatus::RanCurrent => Health::Deployed,
         DidRunStatus::RanDifferent {
             previous_snapshot, ..
@@ -465,6 +593,114 @@ fn run_once_health(
     }
 }
 
+/// `--check-drift` for a Brewfile that ran: look its packages up in the
+/// Homebrew prefix and flag the ones uninstalled since. No prefix (brew
+/// gone entirely) or an unreadable Brewfile leaves the row deployed —
+/// the check only adds information it can stand behind.
+fn brew_installed_health(file: &std::path::Path, ctx: &ExecutionContext) -> Health {
+    use crate::handlers::homebrew;
+
+    let Some(prefix) = homebrew::brew_prefix(ctx.fs.as_ref(), ctx.command_runner.as_ref()) else {
+        return Health::Deployed;
+    };
+    let Ok(text) = ctx.fs.read_to_string(file) else {
+        return Health::Deployed;
+    };
+    let missing = homebrew::missing_from_prefix(ctx.fs.as_ref(), &prefix, &text);
+    if missing.is_empty() {
+        return Health::Deployed;
+    }
+    Health::DeployedWithError {
+        label: format!("brew packages missing ({})", missing.len()),
+        reason: format!(
+            "not installed: {} — `dodot up --provision-rerun` reinstalls them",
+            missing.join(", ")
+        ),
+    }
+}
+
+/// Handlers whose rows are backed by content-hash sentinels.
+fn is_run_once(handler: &str) -> bool {
+    handler == HANDLER_INSTALL
+        || handler == HANDLER_HOMEBREW
+        || handler == HANDLER_NIX
+        || crate::handlers::packages::PackageTool::ALL
+            .iter()
+            .any(|t| t.handler_name() == handler)
+}
+
+/// The newest [`SentinelRecord`] for `file` in `pack`/`handler` — the
+/// provisioning status of one run-once source: when it last ran, where,
+/// for how long, and with which dodot.
+pub fn latest_run(
+    file: &std::path::Path,
+    pack: &str,
+    handler: &str,
+    ctx: &ExecutionContext,
+) -> Option<SentinelRecord> {
+    let sentinels = ctx.datastore.list_handler_sentinels(pack, handler).ok()?;
+    latest_run_in(&sentinels, file, pack, handler, ctx)
+}
+
+/// [`latest_run`] over an already-listed sentinel directory, so
+/// `status` lists each pack's sentinels once instead of once per file.
+fn latest_run_in(
+    sentinels: &[String],
+    file: &std::path::Path,
+    pack: &str,
+    handler: &str,
+    ctx: &ExecutionContext,
+) -> Option<SentinelRecord> {
+    let filename = file.file_name()?.to_string_lossy().into_owned();
+    let prefix = format!("{filename}-");
+    sentinels
+        .iter()
+        // `<filename>-<16 hex>`; skips `.snapshot` siblings and
+        // sentinels of other files that share a name prefix.
+        .filter(|s| s.starts_with(&prefix) && s.len() == prefix.len() + 16)
+        .filter_map(|s| {
+            let path = ctx.datastore.sentinel_path(pack, handler, s);
+            SentinelRecord::parse(&ctx.fs.read_to_string(&path).ok()?)
+        })
+        .max_by_key(|r| r.completed_at)
+}
+
+/// One Link intent to verify: handler, source, user path, mode.
+type LinkRow<'a> = (&'a str, &'a std::path::Path, &'a std::path::Path, LinkMode);
+
+/// Verify link intents, fanning out across threads for large packs.
+/// Each check is a handful of `lstat`/`readlink` calls (plus a content
+/// hash in copy mode), so wide packs spend most of their time waiting
+/// on the filesystem. Results come back in input order.
+fn verify_links(links: &[LinkRow<'_>], pack: &str, fs: &dyn Fs, paths: &dyn Pather) -> Vec<Health> {
+    let verify = |(handler, source, user_path, mode): &LinkRow<'_>| {
+        if *mode == LinkMode::Symlink {
+            verify_symlink(source, user_path, pack, handler, fs, paths)
+        } else {
+            verify_copy(source, user_path, pack, handler, fs, paths)
+        }
+    };
+    let workers = std::thread::available_parallelism().map_or(1, |n| n.get());
+    if links.len() < PARALLEL_VERIFY_MIN || workers < 2 {
+        return links.iter().map(verify).collect();
+    }
+    let chunk = links.len().div_ceil(workers);
+    std::thread::scope(|scope| {
+        let handles: Vec<_> = links
+            .chunks(chunk)
+            .map(|part| scope.spawn(move || part.iter().map(verify).collect::<Vec<_>>()))
+            .collect();
+        handles
+            .into_iter()
+            .flat_map(|h| h.join().expect("status verification thread panicked"))
+            .collect()
+    })
+}
+
+/// Below this many links per pack, thread start-up costs more than the
+/// checks themselves.
+const PARALLEL_VERIFY_MIN: usize = 16;
+
 /// `(N lines added, M lines removed)` summary for a `RanDifferent`
 /// row. Counts unified-diff `+` / `-` bodies (excluding the two
 /// header lines) so the result matches what a user would see in `diff
@@ -612,6 +848,12 @@ fn truncate_for_footnote(stderr: &str, budget: usize) -> String {
 /// Also performs cross-pack conflict detection and surfaces potential
 /// conflicts as warnings.
 pub fn status(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<PackStatusResult> {
+    let started = std::time::Instant::now();
+    // `lang-*` / `[groups]` names → exact pack names.
+    let expanded = pack_filter
+        .map(|names| orchestration::expand_pack_selectors(names, ctx))
+        .transpose()?;
+    let pack_filter = expanded.as_deref();
     info!("starting status command");
 
     // Validate pack names before doing anything
@@ -619,15 +861,23 @@ pub fn status(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<
     if let Some(names) = pack_filter {
         warnings = orchestration::validate_pack_names(names, ctx)?;
     }
+    // Leftovers from an interrupted run. `status` only reports them;
+    // `up` repairs.
+    warnings.extend(orchestration::damaged_generated_files(ctx));
+    // The context treats an unreadable roles file as no roles; say so
+    // here, where role-gated packs would otherwise just look inactive.
+    if let Err(err) = crate::gates::load_roles(ctx.fs.as_ref(), ctx.paths.as_ref()) {
+        warnings.push(format!("{err}; treating this machine as having no roles"));
+    }
 
     let root_config = ctx.config_manager.root_config()?;
     let packs::DiscoveredPacks {
         packs: mut all_packs,
         ignored: mut ignored_packs,
-    } = packs::scan_packs(
+    } = packs::scan_root(
         ctx.fs.as_ref(),
         ctx.paths.dotfiles_root(),
-        &root_config.pack.ignore,
+        &root_config.pack,
     )?;
     info!(count = all_packs.len(), "discovered packs");
 
@@ -641,15 +891,21 @@ pub fn status(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<
     }
 
     let registry = handlers::create_registry(ctx.fs.as_ref(), ctx.command_runner.as_ref());
+    let pins = crate::packs::pins::Pins::load(ctx.fs.as_ref(), ctx.paths.as_ref())?;
     let host = ctx.host_facts.as_ref();
     let mut display_packs = Vec::new();
     let mut notes: Vec<DisplayNote> = Vec::new();
     let mut inactive_packs: Vec<String> = Vec::new();
+    let mut role_inactive_packs: Vec<String> = Vec::new();
     // Accumulator for unified diffs of `RanOlderVersion` rows. Always
     // constructed (even when `--diff` is off) so the run-once branch
     // can take a `&mut` without conditional plumbing; only mutated
     // when `ctx.show_diff` is true and the row's snapshot is on disk.
     let mut diffs: Vec<DisplayDiff> = Vec::new();
+    // Typed pack → handler → item model; the display rows are derived
+    // from the same items so the two can't disagree.
+    let mut report = StatusReport::default();
+    let now = crate::datastore::sentinel::unix_now();
 
     // Collect intents across all packs for conflict detection
     let mut pack_intents = Vec::new();
@@ -664,16 +920,17 @@ pub fn status(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<
         let pack_config = ctx.config_manager.config_for_pack(&pack.path)?;
         pack.config = pack_config.to_handler_config();
 
-        // C3: pack-level OS gate. Inactive packs surface in their own
-        // section ("inactive on this OS") and skip the per-file
+        // C3: pack-level OS / roles gate. Inactive packs surface in
+        // their own section ("inactive on this OS", or "inactive for
+        // this machine's roles") and skip the per-file
         // walk/preprocess/match cycle entirely.
-        if !crate::gates::pack_os_active(&pack_config.pack.os, host) {
-            inactive_packs.push(format!(
-                "{} (os={}, current={})",
-                pack.display_name,
-                pack_config.pack.os.join(","),
-                host.os
-            ));
+        if let Some(reason) = crate::gates::pack_inactive_reason(&pack_config.pack, host) {
+            let entry = format!("{} ({reason})", pack.display_name);
+            if crate::gates::pack_os_active(&pack_config.pack.os, host) {
+                role_inactive_packs.push(entry);
+            } else {
+                inactive_packs.push(entry);
+            }
             continue;
         }
         active_packs.push((
@@ -681,7 +938,12 @@ pub fn status(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<
             pack.display_name.clone(),
             pack.path.clone(),
         ));
-        let rules = mappings_to_rules(&pack_config.mappings);
+        let mut rules = mappings_to_rules(&pack_config.mappings);
+        rules.extend(crate::config::user_rules(
+            &pack_config.rules,
+            &format!("pack {}", pack.name),
+            &host.roles,
+        )?);
 
         let scanner = Scanner::new(ctx.fs.as_ref());
 
@@ -693,6 +955,7 @@ pub fn status(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<
             if !pack_config.gates.is_empty() {
                 t.merge_user(&pack_config.gates)?;
             }
+            t.set_platform_suffixes(pack_config.mappings.platform_suffixes);
             t
         };
 
@@ -723,12 +986,28 @@ pub fn status(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<
                 &pack_config.preprocessor,
                 &root_config.secret,
                 ctx.paths.as_ref(),
+                crate::preprocessing::template::load_template_data(
+                    ctx.fs.as_ref(),
+                    ctx.paths.as_ref(),
+                    &pack.path,
+                )?,
                 ctx.command_runner.clone(),
             )?;
             if !registry.is_empty() {
                 // status is a Passive command — never evaluate
                 // templates, never write rendered files or baselines.
-                // See `secrets.lex` §7.4 / issue #121.
+                // See `secrets.lex` §7.4 / issue #121. Generator
+                // templates drop out; their last output is in the walk.
+                let entries = crate::preprocessing::generate::generate_into_pack(
+                    entries,
+                    &registry,
+                    &pack_config.preprocessor.template.generate,
+                    &pack,
+                    ctx.fs.as_ref(),
+                    ctx.paths.as_ref(),
+                    crate::preprocessing::PreprocessMode::Passive,
+                    /* force */ false,
+                )?;
                 match crate::preprocessing::pipeline::preprocess_pack(
                     entries,
                     &registry,
@@ -758,7 +1037,7 @@ pub fn status(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<
             crate::preprocessing::pipeline::PreprocessResult::passthrough(entries)
         };
         let all_entries = preprocess_result.merged_entries();
-        let matches = scanner.match_entries(
+        let mut matches = scanner.match_entries(
             &all_entries,
             &rules,
             &pack.name,
@@ -766,6 +1045,7 @@ pub fn status(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<
             host,
             &pack_config.mappings.gates,
         )?;
+        ctx.file_filter.apply(&mut matches);
 
         // Collect intents for conflict detection AND drive symlink
         // rendering off the same intents the executor sees. Without
@@ -801,7 +1081,11 @@ pub fn status(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<
             }
         };
 
-        let mut files = Vec::new();
+        let mut items: Vec<ItemReport> = Vec::new();
+        let path_placement = crate::shell::PathPlacement::from_config(&pack_config.path);
+        // Run-once sentinel listings, read once per handler per pack.
+        let mut sentinels: std::collections::HashMap<String, Vec<String>> =
+            std::collections::HashMap::new();
 
         // Pass 1: filter / non-deployable handlers (skip, gate) and the
         // remaining deployable handlers that we still verify match-side
@@ -815,14 +1099,17 @@ pub fn status(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<
             if m.handler == HANDLER_IGNORE {
                 continue;
             }
-            if m.handler == HANDLER_SYMLINK {
+            if m.handler == HANDLER_SYMLINK || m.handler == HANDLER_EDITORS {
                 continue;
             }
 
             let rel_str = m.relative_path.to_string_lossy().into_owned();
 
             let health = match m.handler.as_str() {
-                h if h == HANDLER_SKIP => Health::Skipped,
+                h if h == HANDLER_SKIP => match m.options.get(crate::rules::FILTERED_BY) {
+                    Some(flag) => Health::Excluded(flag.clone()),
+                    None => Health::Skipped,
+                },
                 h if h == HANDLER_GATE => {
                     // Scanner stamped these in `options` when the gate
                     // evaluated false: `gate_label`, `gate_predicate`,
@@ -850,17 +1137,15 @@ pub fn status(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<
                     }
                 }
                 "shell" | "path" => verify_staged(&m.absolute_path, &pack.name, &m.handler, ctx),
-                h if h == HANDLER_INSTALL || h == HANDLER_HOMEBREW || h == HANDLER_NIX => {
-                    run_once_health(
-                        &m.absolute_path,
-                        &pack.name,
-                        &pack.display_name,
-                        &m.handler,
-                        ctx,
-                        ctx.show_diff,
-                        &mut diffs,
-                    )
-                }
+                h if is_run_once(h) => run_once_health(
+                    &m.absolute_path,
+                    &pack.name,
+                    &pack.display_name,
+                    &m.handler,
+                    ctx,
+                    ctx.show_diff,
+                    &mut diffs,
+                ),
                 _ => {
                     // Future run-once handlers without dedicated routing
                     // (or any other Provision/Setup handler) fall back
@@ -882,26 +1167,31 @@ pub fn status(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<
                 }
             };
 
-            let status_label = health.label(&m.handler);
-            // For PendingConflict, allocate a command-wide note index and
-            // stash the reason in the global notes list. The row keeps
-            // its plain handler label; the template renders `[N]` next
-            // to it and the body appears in the notes section.
-            let note_ref = health.footnote_reason().map(|reason| {
-                notes.push(DisplayNote {
-                    body: reason,
-                    hint: None,
+            let last_run = if is_run_once(&m.handler) {
+                let listed = sentinels.entry(m.handler.clone()).or_insert_with(|| {
+                    ctx.datastore
+                        .list_handler_sentinels(&pack.name, &m.handler)
+                        .unwrap_or_default()
                 });
-                notes.len() as u32
-            });
-            files.push(DisplayFile {
-                name: rel_str.clone(),
-                symbol: handler_symbol(&m.handler).into(),
-                description: handler_description(&m.handler, &rel_str, None),
-                status: health.style().into(),
-                status_label,
+                latest_run_in(listed, &m.absolute_path, &pack.name, &m.handler, ctx)
+            } else {
+                None
+            };
+            let mut label = health.label(&m.handler);
+            // Prepending is the norm; a fallback directory says so.
+            if m.handler == HANDLER_PATH
+                && path_placement.position_for(&rel_str) == crate::shell::PathPosition::Append
+            {
+                label.push_str(" (append)");
+            }
+            items.push(ItemReport {
+                name: rel_str,
                 handler: m.handler.clone(),
-                note_ref,
+                state: health.style().into(),
+                label,
+                target: None,
+                detail: health.footnote_reason(),
+                last_run,
             });
         }
 
@@ -913,43 +1203,74 @@ pub fn status(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<
         // exactly one intent, matching the old per-match output. `_lib/`
         // on non-macOS yields zero intents (`Resolution::Skip`), so the
         // old explicit `_lib/`-suppress branch is no longer needed.
+        // The editors handler's links come through here too, verified
+        // against its own data dir.
         let home = ctx.paths.home_dir();
         let preprocessed_dir = ctx.paths.handler_data_dir(&pack.name, "preprocessed");
-        for intent in &intents_for_pack {
-            let HandlerIntent::Link {
-                source, user_path, ..
-            } = intent
-            else {
-                continue;
-            };
-
-            let name = intent_display_name(source, &pack.path, &preprocessed_dir);
-            let user_target_display = format_path_relative_to_home(user_path, home);
-            let health = verify_symlink(source, user_path, &pack.name, ctx);
-            let status_label = health.label(HANDLER_SYMLINK);
-            let note_ref = health.footnote_reason().map(|reason| {
-                notes.push(DisplayNote {
-                    body: reason,
-                    hint: None,
-                });
-                notes.len() as u32
-            });
-            files.push(DisplayFile {
-                name: name.clone(),
-                symbol: handler_symbol(HANDLER_SYMLINK).into(),
-                description: handler_description(
-                    HANDLER_SYMLINK,
-                    &name,
-                    Some(&user_target_display),
-                ),
-                status: health.style().into(),
-                status_label,
-                handler: HANDLER_SYMLINK.into(),
-                note_ref,
+        let links: Vec<LinkRow<'_>> = intents_for_pack
+            .iter()
+            .filter_map(|intent| match intent {
+                HandlerIntent::Link {
+                    handler,
+                    source,
+                    user_path,
+                    mode,
+                    ..
+                } => Some((
+                    handler.as_str(),
+                    source.as_path(),
+                    user_path.as_path(),
+                    *mode,
+                )),
+                _ => None,
+            })
+            .collect();
+        let mut healths = verify_links(&links, &pack.name, ctx.fs.as_ref(), ctx.paths.as_ref());
+        // A rule's `chmod` / `chown`: a deployed target whose mode or
+        // owner moved is stale until the next `up` re-applies them.
+        let wanted = intents_for_pack.iter().filter_map(|intent| match intent {
+            HandlerIntent::Link { perms, .. } => Some(perms.as_ref()),
+            _ => None,
+        });
+        for (((_, _, user_path, _), perms), health) in links.iter().zip(wanted).zip(&mut healths) {
+            if let (Health::Deployed, Some(perms)) = (&*health, perms) {
+                if let Some(diff) = crate::perms::drift(ctx.fs.as_ref(), user_path, perms) {
+                    *health = Health::Stale(format!(
+                        "stale: permissions drifted ({diff}), re-deploy to fix"
+                    ));
+                }
+            }
+        }
+        for ((handler, source, user_path, _), health) in links.iter().zip(healths) {
+            items.push(ItemReport {
+                name: intent_display_name(source, &pack.path, &preprocessed_dir),
+                handler: handler.to_string(),
+                state: health.style().into(),
+                label: health.label(handler),
+                target: Some(format_path_relative_to_home(user_path, home)),
+                detail: health.footnote_reason(),
+                last_run: None,
             });
         }
 
-        display_packs.push(DisplayPack::new(pack.display_name.clone(), files));
+        // Pass 3: `[pack] verify` rows from the last `up`'s record.
+        items.extend(verify_items(
+            &pack_config.pack.verify,
+            crate::verify::load_record(ctx.fs.as_ref(), ctx.paths.as_ref(), &pack.name).as_ref(),
+        ));
+
+        let files = items
+            .iter()
+            .map(|item| item.to_display(&mut notes, now))
+            .collect();
+        report
+            .packs
+            .push(PackReport::from_items(pack.display_name.clone(), &items));
+        let mut display_pack = DisplayPack::new(pack.display_name.clone(), files);
+        display_pack.pinned = pins.is_pinned(&pack.name);
+        display_pack.disabled =
+            crate::packs::disabled::is_disabled(ctx.fs.as_ref(), ctx.paths.as_ref(), &pack.name);
+        display_packs.push(display_pack);
     }
 
     // Detect and surface cross-pack conflicts as structured display data
@@ -986,6 +1307,8 @@ pub fn status(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<
         .iter()
         .map(|d| crate::packs::display_name_for(d).to_string())
         .collect();
+    let table = ctx.view_mode.table_for(&display_packs);
+    let summary = summary_line(&display_packs);
 
     Ok(PackStatusResult {
         message: None,
@@ -996,12 +1319,203 @@ pub fn status(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<
         conflicts: display_conflicts,
         ignored_packs: ignored_display,
         inactive_packs,
+        role_inactive_packs,
         view_mode: ctx.view_mode.as_str().into(),
         group_mode: ctx.group_mode.as_str().into(),
         diffs,
+        table,
+        report: Some(report),
+        verbosity: ctx.render_verbosity.as_str().into(),
+        summary,
+        actions: Vec::new(),
+        elapsed: ctx.render_verbosity.elapsed_since(started),
+        phases: Vec::new(),
+        estimate: None,
+        estimate_lines: Vec::new(),
+        exit_code: crate::ExitCode::Success,
     })
 }
 
+/// One row per configured `[pack] verify` check, from the record the
+/// last `dodot up` wrote. A check with no recorded result (never run,
+/// or added since) is pending; a failed one is `degraded` and carries
+/// its output as a footnote.
+fn verify_items(
+    configured: &[String],
+    record: Option<&crate::verify::VerifyRecord>,
+) -> Vec<ItemReport> {
+    configured
+        .iter()
+        .map(|command| {
+            let result = record.and_then(|r| r.result_for(command));
+            let (state, label, detail) = match result {
+                None => ("pending", "not checked yet".to_string(), None),
+                Some(r) if r.passed => ("deployed", "passed".to_string(), None),
+                Some(r) => {
+                    let detail = if r.output.is_empty() {
+                        format!("`{command}` exited {}", r.exit_code)
+                    } else {
+                        format!("`{command}` exited {}: {}", r.exit_code, r.output)
+                    };
+                    (
+                        "degraded",
+                        format!("failed (exit {})", r.exit_code),
+                        Some(detail),
+                    )
+                }
+            };
+            ItemReport {
+                name: command.clone(),
+                handler: crate::verify::VERIFY_DIR.into(),
+                state: state.into(),
+                label,
+                target: None,
+                detail,
+                last_run: None,
+            }
+        })
+        .collect()
+}
+
+/// Overall verdict of `dodot status --check`, worst first wins.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "snake_case")]
+pub enum StatusOutcome {
+    /// Every pack is deployed and current.
+    Deployed,
+    /// Something would change on the next `dodot up`.
+    Pending,
+    /// At least one pack has a broken or failed entry or a failing
+    /// verify check, or packs conflict.
+    Errors,
+}
+
+impl StatusOutcome {
+    /// Exit code for `--check`. 1 stays reserved for dodot itself
+    /// failing, so a CI job can tell "not deployed" from "couldn't
+    /// tell".
+    pub fn exit_code(self) -> i32 {
+        match self {
+            StatusOutcome::Deployed => 0,
+            StatusOutcome::Pending => 2,
+            StatusOutcome::Errors => 3,
+        }
+    }
+}
+
+/// Pack counts behind `--check` and `--summary`, by each pack's
+/// rolled-up status.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+pub struct StatusSummary {
+    pub packs: usize,
+    pub deployed: usize,
+    pub pending: usize,
+    /// Packs with a failing `[pack] verify` check.
+    pub degraded: usize,
+    pub errors: usize,
+    pub conflicts: usize,
+}
+
+impl StatusSummary {
+    pub fn from_result(result: &PackStatusResult) -> Self {
+        let count = |status: &str| {
+            result
+                .packs
+                .iter()
+                .filter(|p| p.summary_status == status)
+                .count()
+        };
+        StatusSummary {
+            packs: result.packs.len(),
+            deployed: count("deployed"),
+            pending: count("pending"),
+            degraded: count("degraded"),
+            errors: count("error"),
+            conflicts: result.conflicts.len(),
+        }
+    }
+
+    pub fn outcome(&self) -> StatusOutcome {
+        if self.errors > 0 || self.degraded > 0 || self.conflicts > 0 {
+            StatusOutcome::Errors
+        } else if self.pending > 0 {
+            StatusOutcome::Pending
+        } else {
+            StatusOutcome::Deployed
+        }
+    }
+
+    /// One short line for a shell prompt or a login message:
+    /// `dodot: ok (12 packs)`, `dodot: 2 pending, 1 error`.
+    pub fn line(&self) -> String {
+        if self.outcome() == StatusOutcome::Deployed {
+            let plural = if self.packs == 1 { "" } else { "s" };
+            return format!("dodot: ok ({} pack{plural})", self.packs);
+        }
+        let mut parts = Vec::new();
+        if self.pending > 0 {
+            parts.push(format!("{} pending", self.pending));
+        }
+        if self.degraded > 0 {
+            parts.push(format!("{} degraded", self.degraded));
+        }
+        if self.errors > 0 {
+            let plural = if self.errors == 1 { "" } else { "s" };
+            parts.push(format!("{} error{plural}", self.errors));
+        }
+        if self.conflicts > 0 {
+            let plural = if self.conflicts == 1 { "" } else { "s" };
+            parts.push(format!("{} conflict{plural}", self.conflicts));
+        }
+        format!("dodot: {}", parts.join(", "))
+    }
+}
+
+/// What changed between two `status` results, one line each, for
+/// `status --watch`: rows whose status moved (`vim / vimrc: pending →
+/// deployed`), rows that appeared or went away, and new cross-pack
+/// conflicts. Compare results before fitting them to the terminal —
+/// rows are matched by pack, handler and full name.
+pub fn transitions(before: &PackStatusResult, after: &PackStatusResult) -> Vec<String> {
+    use std::collections::BTreeMap;
+
+    let rows = |result: &PackStatusResult| -> BTreeMap<(String, String, String), String> {
+        result
+            .packs
+            .iter()
+            .flat_map(|p| {
+                p.files.iter().map(|f| {
+                    (
+                        (p.name.clone(), f.name.clone(), f.handler.clone()),
+                        f.status.clone(),
+                    )
+                })
+            })
+            .collect()
+    };
+    let (old, new) = (rows(before), rows(after));
+
+    let mut lines = Vec::new();
+    for ((pack, name, handler), status) in &new {
+        match old.get(&(pack.clone(), name.clone(), handler.clone())) {
+            Some(was) if was == status => {}
+            Some(was) => lines.push(format!("{pack} / {name}: {was} → {status}")),
+            None => lines.push(format!("{pack} / {name}: new ({status})")),
+        }
+    }
+    for (pack, name, handler) in old.keys() {
+        if !new.contains_key(&(pack.clone(), name.clone(), handler.clone())) {
+            lines.push(format!("{pack} / {name}: gone"));
+        }
+    }
+    for conflict in &after.conflicts {
+        if !before.conflicts.iter().any(|c| c.target == conflict.target) {
+            lines.push(format!("new conflict: {}", conflict.target));
+        }
+    }
+    lines
+}
+
 /// Run `--check-drift` over the supplied packs and emit a one-line
 /// warning per anomaly. `Clean` reports are dropped silently;
 /// everything else (drifted, missing, check-failed, not-implemented)
@@ -1171,7 +1685,7 @@ mod tests {
     use super::{run_once_health, Health};
     use crate::commands::DisplayDiff;
     use crate::fs::Fs;
-    use crate::handlers::HANDLER_INSTALL;
+    use crate::handlers::{HANDLER_HOMEBREW, HANDLER_INSTALL};
     use crate::packs::orchestration::ExecutionContext;
     use crate::paths::Pather;
     use crate::testing::TempEnvironment;
@@ -1212,8 +1726,12 @@ mod tests {
             force: false,
             check_drift: false,
             show_diff: false,
+            lint: Default::default(),
+            template_vars: Default::default(),
+            file_filter: Default::default(),
             view_mode: crate::commands::ViewMode::Full,
             group_mode: crate::commands::GroupMode::Name,
+            render_verbosity: crate::commands::RenderVerbosity::Normal,
             verbose: false,
             host_facts: Arc::new(crate::gates::HostFacts::detect()),
         }
@@ -1234,6 +1752,51 @@ mod tests {
         assert!(diffs.is_empty());
     }
 
+    #[test]
+    fn run_once_health_shows_failed_entries_of_a_partial_brew_bundle() {
+        let env = TempEnvironment::builder()
+            .pack("dev")
+            .file("Brewfile", "brew \"ripgrep\"\nbrew \"broken\"\n")
+            .done()
+            .build();
+        let ctx = ctx_for(&env);
+        let abs = env.dotfiles_root.join("dev/Brewfile");
+        let checksum = crate::handlers::run_once::file_checksum(env.fs.as_ref(), &abs).unwrap();
+        let progress = crate::handlers::homebrew::BundleProgress {
+            content_hash: checksum,
+            installed: vec!["ripgrep".into()],
+            failed: vec!["broken".into()],
+        };
+        crate::handlers::homebrew::write_progress(
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            "dev",
+            "Brewfile",
+            &progress,
+        )
+        .unwrap();
+
+        let mut diffs = Vec::new();
+        let h = run_once_health(
+            &abs,
+            "dev",
+            "dev",
+            HANDLER_HOMEBREW,
+            &ctx,
+            false,
+            &mut diffs,
+        );
+        assert_eq!(h.style(), "warning");
+        assert_eq!(
+            h.label(HANDLER_HOMEBREW),
+            "brew packages partly installed (1 failed)"
+        );
+        assert!(h
+            .footnote_reason()
+            .unwrap()
+            .contains("failed: broken; 1 other entry"));
+    }
+
     #[test]
     fn run_once_health_deployed_when_current_hash_matches() {
         let env = TempEnvironment::builder()
@@ -0,0 +1,144 @@
+//! Typed status model: pack → handler → item.
+//!
+//! [`status::status`](super::status::status) verifies every file once
+//! and records the verdict as an [`ItemReport`]. Everything downstream
+//! is derived from those items rather than re-verified: the
+//! `DisplayPack` rows the templates render (and that `up` / `down` /
+//! `adopt` reuse when they render through status), and the
+//! [`StatusReport`] carried on `PackStatusResult.report` for JSON
+//! consumers, grouped per handler so tooling doesn't have to parse
+//! display labels.
+
+use serde::Serialize;
+
+use crate::commands::{handler_description, handler_symbol, DisplayFile, DisplayNote};
+use crate::datastore::SentinelRecord;
+
+/// Verified state of every active pack in one `status` run.
+#[derive(Debug, Clone, Default, Serialize)]
+pub struct StatusReport {
+    pub packs: Vec<PackReport>,
+}
+
+/// One pack's items, grouped by the handler that claimed them.
+#[derive(Debug, Clone, Serialize)]
+pub struct PackReport {
+    /// Display name (prefix stripped).
+    pub name: String,
+    pub handlers: Vec<HandlerReport>,
+}
+
+/// Items claimed by one handler within a pack.
+#[derive(Debug, Clone, Serialize)]
+pub struct HandlerReport {
+    pub handler: String,
+    pub items: Vec<ItemReport>,
+}
+
+/// Verdict for a single file (or link intent).
+#[derive(Debug, Clone, Serialize)]
+pub struct ItemReport {
+    /// Pack-relative path.
+    pub name: String,
+    #[serde(skip)]
+    pub handler: String,
+    /// Style bucket: `deployed`, `pending`, `warning`, `stale`,
+    /// `broken`, `degraded`, `skipped`.
+    pub state: String,
+    /// Handler-specific label (`sourced`, `not in PATH`, …).
+    pub label: String,
+    /// Deploy path with `$HOME` collapsed, for link items.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub target: Option<String>,
+    /// Longer explanation (conflict reason, gate mismatch, syntax
+    /// error). Rendered as a footnote in text output.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub detail: Option<String>,
+    /// Most recent recorded run, for run-once handlers.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub last_run: Option<SentinelRecord>,
+}
+
+impl ItemReport {
+    /// The display row for this item. A `detail` is pushed onto
+    /// `notes` and referenced from the row by its 1-based index.
+    pub fn to_display(&self, notes: &mut Vec<DisplayNote>, now: u64) -> DisplayFile {
+        let note_ref = self.detail.as_ref().map(|reason| {
+            notes.push(DisplayNote {
+                body: reason.clone(),
+                hint: None,
+            });
+            notes.len() as u32
+        });
+        DisplayFile {
+            name: self.name.clone(),
+            symbol: handler_symbol(&self.handler).into(),
+            description: handler_description(&self.handler, &self.name, self.target.as_deref()),
+            status: self.state.clone(),
+            status_label: self.label.clone(),
+            handler: self.handler.clone(),
+            note_ref,
+            last_run: self.last_run.as_ref().map(|r| r.summary(now)),
+        }
+    }
+}
+
+impl PackReport {
+    /// Group `items` by handler, keeping handlers in order of first
+    /// appearance and items in their original order.
+    pub fn from_items(name: String, items: &[ItemReport]) -> Self {
+        let mut handlers: Vec<HandlerReport> = Vec::new();
+        for item in items {
+            match handlers.iter_mut().find(|h| h.handler == item.handler) {
+                Some(h) => h.items.push(item.clone()),
+                None => handlers.push(HandlerReport {
+                    handler: item.handler.clone(),
+                    items: vec![item.clone()],
+                }),
+            }
+        }
+        Self { name, handlers }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn item(name: &str, handler: &str) -> ItemReport {
+        ItemReport {
+            name: name.into(),
+            handler: handler.into(),
+            state: "pending".into(),
+            label: "pending".into(),
+            target: None,
+            detail: None,
+            last_run: None,
+        }
+    }
+
+    #[test]
+    fn groups_items_by_handler_in_first_seen_order() {
+        let items = vec![
+            item("install.sh", "install"),
+            item("aliases.sh", "shell"),
+            item("env.sh", "shell"),
+        ];
+        let pack = PackReport::from_items("dev".into(), &items);
+        let handlers: Vec<_> = pack.handlers.iter().map(|h| h.handler.as_str()).collect();
+        assert_eq!(handlers, ["install", "shell"]);
+        assert_eq!(pack.handlers[1].items.len(), 2);
+    }
+
+    #[test]
+    fn detail_becomes_a_numbered_note() {
+        let mut with_detail = item("vimrc", "symlink");
+        with_detail.detail = Some("~/.vimrc (existing file)".into());
+        let mut notes = Vec::new();
+        let plain = item("gvimrc", "symlink").to_display(&mut notes, 0);
+        let row = with_detail.to_display(&mut notes, 0);
+        assert_eq!(plain.note_ref, None);
+        assert_eq!(row.note_ref, Some(1));
+        assert_eq!(notes[0].body, "~/.vimrc (existing file)");
+    }
+}
@@ -0,0 +1,80 @@
+//! `dodot template check` — lint every template without rendering
+//! anything for real.
+//!
+//! For each template in the selected packs: whether it parses (and the
+//! line it breaks on when it doesn't), every variable it reads, and
+//! where each one's value comes from on this machine — `dodot.*`, the
+//! environment, `[preprocessor.template.vars]` / `--var`, or the data
+//! files. A variable nothing supplies is `missing` when the render
+//! fails without it and `optional` when the template guards it.
+//!
+//! Run it before the first `dodot up` on a new machine: it needs no
+//! deployed state, asks no secret provider (`secret(...)` is stubbed
+//! out) and writes nothing. The exit code is 1 when a template is
+//! broken or misses a variable.
+
+use serde::Serialize;
+
+use crate::commands::template_vars;
+use crate::packs::orchestration::ExecutionContext;
+use crate::preprocessing::template::{TemplateProblem, TemplateVar, VarSource};
+use crate::Result;
+
+/// One template's findings.
+#[derive(Debug, Clone, Serialize)]
+pub struct TemplateCheck {
+    /// `<pack>/<path>`.
+    pub template: String,
+    /// Every variable the template reads, sorted by name.
+    pub variables: Vec<TemplateVar>,
+    /// Variables the render fails without.
+    pub missing: Vec<String>,
+    /// Why the template doesn't parse or render, if it doesn't.
+    pub problem: Option<TemplateProblem>,
+}
+
+/// Result of `dodot template check`.
+#[derive(Debug, Clone, Serialize)]
+pub struct TemplateCheckResult {
+    pub templates: Vec<TemplateCheck>,
+    /// Templates that don't parse or render.
+    pub broken_count: usize,
+    /// Templates that miss at least one variable.
+    pub incomplete_count: usize,
+}
+
+impl TemplateCheckResult {
+    /// 0 when every template parses and has its variables, else 1.
+    pub fn exit_code(&self) -> i32 {
+        i32::from(self.broken_count + self.incomplete_count > 0)
+    }
+}
+
+/// Check every template in the selected packs, in pack and path order.
+pub fn check(
+    pack_filter: Option<&[String]>,
+    ctx: &ExecutionContext,
+) -> Result<TemplateCheckResult> {
+    let mut templates = Vec::new();
+    template_vars::each_template(pack_filter, ctx, |preprocessor, template, source| {
+        let inventory = preprocessor.inventory(source);
+        let missing = inventory
+            .variables
+            .iter()
+            .filter(|v| v.source == VarSource::Missing)
+            .map(|v| v.name.clone())
+            .collect();
+        templates.push(TemplateCheck {
+            template: template.to_string(),
+            variables: inventory.variables,
+            missing,
+            problem: inventory.problem,
+        });
+    })?;
+    templates.sort_by(|a, b| a.template.cmp(&b.template));
+    Ok(TemplateCheckResult {
+        broken_count: templates.iter().filter(|t| t.problem.is_some()).count(),
+        incomplete_count: templates.iter().filter(|t| !t.missing.is_empty()).count(),
+        templates,
+    })
+}
@@ -205,6 +205,7 @@ fn git_config_set(
             command: format!("git -C {} config {} {}", root.display(), key, value),
             exit_code: out.exit_code,
             stderr: out.stderr,
+            stdout: out.stdout,
         });
     }
     Ok(())
@@ -294,6 +295,7 @@ mod tests {
                             command: format!("git config --get {key}"),
                             exit_code: 1,
                             stderr: String::new(),
+                            stdout: String::new(),
                         }),
                     }
                 } else {
@@ -336,8 +338,12 @@ mod tests {
             force: false,
             check_drift: false,
             show_diff: false,
+            lint: Default::default(),
+            template_vars: Default::default(),
+            file_filter: Default::default(),
             view_mode: crate::commands::ViewMode::Full,
             group_mode: crate::commands::GroupMode::Name,
+            render_verbosity: crate::commands::RenderVerbosity::Normal,
             verbose: false,
             host_facts: Arc::new(crate::gates::HostFacts::detect()),
         }
@@ -0,0 +1,105 @@
+//! Missing template variables, found before `up` renders anything.
+//!
+//! A template that uses an undefined variable fails its render
+//! (`TMPL001`) — one template, one variable at a time. `dodot up`
+//! instead asks [`missing`] for every unresolved reference across the
+//! packs it is about to deploy, prompts for all of them in one go, and
+//! hands the answers to [`record`], which keeps them in the host vars
+//! file (`~/.config/dodot/vars.toml`) so this machine isn't asked
+//! again. With `--no-input`, or no terminal to prompt on, the list
+//! comes back as [`DodotError::TemplateVarsMissing`] instead.
+
+use std::collections::BTreeMap;
+use std::path::PathBuf;
+
+use serde::Serialize;
+
+use crate::packs::orchestration::{self, ExecutionContext};
+use crate::preprocessing::template::{self, TemplatePreprocessor};
+use crate::preprocessing::Preprocessor;
+use crate::rules::Scanner;
+use crate::{DodotError, Result};
+
+/// One variable no template source can resolve.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct MissingVar {
+    /// As the template writes it: `email`, `data.git.email`.
+    pub key: String,
+    /// The templates using it, as `<pack>/<path>`.
+    pub templates: Vec<String>,
+}
+
+/// Every missing variable in the templates of the selected packs,
+/// sorted by key.
+pub fn missing(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<Vec<MissingVar>> {
+    let mut found: BTreeMap<String, Vec<String>> = BTreeMap::new();
+    each_template(pack_filter, ctx, |preprocessor, template, source| {
+        for key in preprocessor.missing_variables(source) {
+            found.entry(key).or_default().push(template.to_string());
+        }
+    })?;
+    Ok(found
+        .into_iter()
+        .map(|(key, templates)| MissingVar { key, templates })
+        .collect())
+}
+
+/// Call `visit` with every readable template in the selected packs:
+/// the pack's preprocessor (vars, `--var` values and data files
+/// applied), the template as `<pack>/<path>`, and its source.
+pub(crate) fn each_template(
+    pack_filter: Option<&[String]>,
+    ctx: &ExecutionContext,
+    mut visit: impl FnMut(&TemplatePreprocessor, &str, &str),
+) -> Result<()> {
+    let fs = ctx.fs.as_ref();
+    for pack in orchestration::prepare_packs(pack_filter, ctx)? {
+        let mut pack_config = ctx.config_manager.config_for_pack(&pack.path)?;
+        template::invocation::apply(&mut pack_config, &ctx.template_vars);
+        let template_config = &pack_config.preprocessor.template;
+        let preprocessor = TemplatePreprocessor::new(
+            template_config.extensions.clone(),
+            template_config.vars.clone(),
+            ctx.paths.as_ref(),
+        )?
+        .with_data(template::load_template_data(
+            fs,
+            ctx.paths.as_ref(),
+            &pack.path,
+        )?);
+
+        let entries = Scanner::new(fs).walk_pack_recursive(&pack.path, &pack_config.pack.ignore)?;
+        for entry in entries {
+            let name = entry.relative_path.to_string_lossy();
+            if entry.is_dir || !preprocessor.matches_extension(&name) {
+                continue;
+            }
+            let Ok(source) = fs.read_to_string(&entry.absolute_path) else {
+                continue;
+            };
+            visit(
+                &preprocessor,
+                &format!("{}/{name}", pack.display_name),
+                &source,
+            );
+        }
+    }
+    Ok(())
+}
+
+/// The fail-fast form of [`missing`]: an error naming each key and
+/// the templates that need it.
+pub fn missing_error(missing: &[MissingVar]) -> DodotError {
+    DodotError::TemplateVarsMissing {
+        keys: missing
+            .iter()
+            .map(|m| format!("{} ({})", m.key, m.templates.join(", ")))
+            .collect(),
+    }
+}
+
+/// Keep `answers` (key, value) in the host vars file. Returns its
+/// path.
+pub fn record(answers: &[(String, String)], ctx: &ExecutionContext) -> Result<PathBuf> {
+    template::record_host_vars(ctx.fs.as_ref(), ctx.paths.as_ref(), answers)
+}
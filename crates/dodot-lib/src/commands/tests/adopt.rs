@@ -1,4 +1,4 @@
-//! Integration tests for the `adopt` command (and the related "adopt: pack not found hint" UX section).
+//! Integration tests for the `adopt` command (and the related "adopt: pack not found hint" UX section), and for `eject`, its reverse.
 
 #![allow(unused_imports)]
 
@@ -1447,6 +1447,62 @@ fn adopt_dry_run_makes_no_changes() {
     env.assert_not_exists(&env.dotfiles_root.join("vim/home.vimrc"));
 }
 
+#[test]
+fn adopt_undo_last_restores_the_source() {
+    let env = TempEnvironment::builder()
+        .pack("vim")
+        .file("placeholder", "")
+        .done()
+        .home_file(".vimrc", "set nocompatible")
+        .build();
+    let ctx = make_ctx(&env);
+    let source = env.home.join(".vimrc");
+    let in_pack = env.dotfiles_root.join("vim/home.vimrc");
+    let adopt = || {
+        commands::adopt::adopt(
+            Some("vim"),
+            std::slice::from_ref(&source),
+            false,
+            false,
+            false,
+            None,
+            &ctx,
+        )
+    };
+
+    adopt().unwrap();
+    assert!(env.fs.is_symlink(&source));
+    // Edits made in the pack since the adoption come back with the undo.
+    env.fs.write_file(&in_pack, b"set number").unwrap();
+
+    let undone = commands::adopt::undo_last(&ctx).unwrap();
+    let message = undone.message.unwrap_or_default();
+    assert!(message.contains("1 of 1"), "{message}");
+    env.assert_regular_file(&source, "set number");
+    env.assert_not_exists(&in_pack);
+    assert!(
+        commands::adopt::undo_last(&ctx).is_err(),
+        "journal is empty"
+    );
+
+    // An adoption that never committed blocks the next one until undone.
+    adopt().unwrap();
+    let journal = ctx.paths.adopt_journal_path();
+    let raw = env.fs.read_to_string(&journal).unwrap();
+    env.fs
+        .write_file(
+            &journal,
+            raw.replace("\"committed\": true", "\"committed\": false")
+                .as_bytes(),
+        )
+        .unwrap();
+    let err = adopt().unwrap_err().to_string();
+    assert!(err.contains("--undo-last"), "{err}");
+    commands::adopt::undo_last(&ctx).unwrap();
+    env.assert_regular_file(&source, "set number");
+    env.assert_not_exists(&journal);
+}
+
 #[test]
 fn adopt_no_follow_keeps_source_symlink_as_symlink() {
     let env = TempEnvironment::builder()
@@ -1652,3 +1708,48 @@ fn adopt_nonexistent_pack_returns_pack_not_found() {
         "expected PackNotFound, got: {err}"
     );
 }
+
+// ── eject ───────────────────────────────────────────────────
+
+#[test]
+fn eject_leaves_a_real_file_and_drops_the_source() {
+    let env = TempEnvironment::builder()
+        .pack("vim")
+        .file("vimrc", "set nocompatible")
+        .done()
+        .build();
+    let ctx = make_ctx(&env);
+    commands::up::up(None, &ctx).unwrap();
+    let target = env.home.join(".config/vim/vimrc");
+    assert!(env.fs.is_symlink(&target));
+
+    let result = commands::eject::eject("vim", "vimrc", false, &ctx).unwrap();
+    assert!(result.message.contains("Ejected"), "{}", result.message);
+    assert!(!env.fs.is_symlink(&target));
+    env.assert_file_contents(&target, "set nocompatible");
+    env.assert_not_exists(&env.dotfiles_root.join("vim/vimrc"));
+    env.assert_no_handler_state("vim", "symlink");
+}
+
+#[test]
+fn eject_keep_by_deployed_path_leaves_the_rest_of_the_pack() {
+    let env = TempEnvironment::builder()
+        .pack("vim")
+        .file("vimrc", "set nocompatible")
+        .file("gvimrc", "set guifont=Mono")
+        .done()
+        .build();
+    let ctx = make_ctx(&env);
+    commands::up::up(None, &ctx).unwrap();
+
+    let result = commands::eject::eject("vim", "~/.config/vim/vimrc", true, &ctx).unwrap();
+    assert_eq!(result.details.len(), 1, "{:?}", result.details);
+    assert!(!env.fs.is_symlink(&env.home.join(".config/vim/vimrc")));
+    env.assert_exists(&env.dotfiles_root.join("vim/vimrc"));
+    assert!(env.fs.is_symlink(&env.home.join(".config/vim/gvimrc")));
+    env.assert_exists(&env.paths.handler_data_dir("vim", "symlink").join("gvimrc"));
+    env.assert_not_exists(&env.paths.handler_data_dir("vim", "symlink").join("vimrc"));
+
+    let err = commands::eject::eject("vim", "nope", false, &ctx).unwrap_err();
+    assert!(err.to_string().contains("doesn't link"), "{err}");
+}
@@ -433,6 +433,7 @@ fn up_with_cross_pack_conflict_renders_full_status_view() {
         !result.conflicts.is_empty(),
         "expected conflicts section to be populated"
     );
+    assert_eq!(result.exit_code, crate::ExitCode::Conflict);
     let conflict = &result.conflicts[0];
     assert!(
         conflict.target.contains(".aliases"),
@@ -938,6 +939,75 @@ fn pack_os_inactive_pack_emits_no_operations_in_up() {
     assert!(result.packs.is_empty(), "packs: {:?}", result.packs);
 }
 
+// ── Machine roles ───────────────────────────────────────────────
+
+#[test]
+fn roles_skip_packs_and_rules_the_machine_is_not_tagged_for() {
+    let env = TempEnvironment::builder()
+        .pack("corp")
+        .file("vimrc", "x")
+        .config("[pack]\nroles = [\"work\"]")
+        .done()
+        .pack("sh")
+        .file("work.sh", "export CORP=1")
+        .config("[[rules]]\npattern = \"work.sh\"\nhandler = \"shell\"\nroles = [\"work\"]")
+        .done()
+        .build();
+
+    let mut ctx = make_ctx(&env);
+    let result = commands::status::status(None, &ctx).unwrap();
+    assert!(result.inactive_packs.is_empty());
+    assert_eq!(
+        result.role_inactive_packs,
+        vec!["corp (role mismatch: roles=work, current=none)"]
+    );
+    let output = render::render("pack-status", &result, OutputMode::Text).unwrap();
+    assert!(
+        output.contains("Inactive for this machine's roles"),
+        "output: {output}"
+    );
+    assert!(!output.contains("Inactive on this OS"), "output: {output}");
+    let file = &result.packs[0].files[0];
+    assert_eq!(file.name, "work.sh");
+    assert_eq!(file.status_label, "skipped: role mismatch");
+
+    let up = commands::up::up(None, &ctx).unwrap();
+    assert!(!env.home.join(".vimrc").exists(), "{:?}", up.packs);
+
+    let mut host = (*ctx.host_facts).clone();
+    host.roles = vec!["laptop".into(), "work".into()];
+    ctx.host_facts = Arc::new(host);
+    let result = commands::status::status(None, &ctx).unwrap();
+    assert!(result.role_inactive_packs.is_empty());
+    let sh = result.packs.iter().find(|p| p.name == "sh").unwrap();
+    assert_eq!(sh.files[0].handler, "shell");
+}
+
+#[test]
+fn status_warns_about_an_unreadable_roles_file() {
+    let env = TempEnvironment::builder()
+        .pack("corp")
+        .file("vimrc", "x")
+        .config("[pack]\nroles = [\"work\"]")
+        .done()
+        .build();
+    let local = env.paths.local_config_path();
+    env.fs.mkdir_all(local.parent().unwrap()).unwrap();
+    env.fs.write_file(&local, b"roles = [\"work\"").unwrap();
+
+    let ctx = make_ctx(&env);
+    let result = commands::status::status(None, &ctx).unwrap();
+    assert_eq!(result.role_inactive_packs.len(), 1);
+    assert!(
+        result
+            .warnings
+            .iter()
+            .any(|w| w.contains("local.toml") && w.contains("no roles")),
+        "{:?}",
+        result.warnings
+    );
+}
+
 // ── C5: adopt --only-os ─────────────────────────────────────────
 
 #[test]
@@ -9,7 +9,7 @@
 mod adopt;
 mod gating;
 mod probe;
-mod support;
+pub(crate) mod support;
 
 #[allow(unused_imports)]
 use std::sync::Arc;
@@ -61,6 +61,117 @@ fn status_shows_pending_before_up() {
     }
 }
 
+#[test]
+fn status_summary_tracks_deploy_state() {
+    use commands::status::{StatusOutcome, StatusSummary};
+
+    let env = TempEnvironment::builder()
+        .pack("vim")
+        .file("vimrc", "set nocompatible")
+        .done()
+        .pack("git")
+        .file("gitconfig", "[user]")
+        .done()
+        .build();
+    let ctx = make_ctx(&env);
+
+    let before = StatusSummary::from_result(&commands::status::status(None, &ctx).unwrap());
+    assert_eq!(before.pending, 2);
+    assert_eq!(before.outcome(), StatusOutcome::Pending);
+    assert_eq!(before.outcome().exit_code(), 2);
+    assert_eq!(before.line(), "dodot: 2 pending");
+
+    commands::up::up(None, &ctx).unwrap();
+    let after = StatusSummary::from_result(&commands::status::status(None, &ctx).unwrap());
+    assert_eq!(after.outcome(), StatusOutcome::Deployed);
+    assert_eq!(after.outcome().exit_code(), 0);
+    assert_eq!(after.line(), "dodot: ok (2 packs)");
+}
+
+#[test]
+fn transitions_name_rows_that_changed_between_refreshes() {
+    let env = TempEnvironment::builder()
+        .pack("vim")
+        .file("vimrc", "set nocompatible")
+        .done()
+        .build();
+    let ctx = make_ctx(&env);
+
+    let before = commands::status::status(None, &ctx).unwrap();
+    assert!(commands::status::transitions(&before, &before).is_empty());
+
+    commands::up::up(None, &ctx).unwrap();
+    env.fs
+        .write_file(&env.dotfiles_root.join("vim/gvimrc"), b"set guifont")
+        .unwrap();
+    let after = commands::status::status(None, &ctx).unwrap();
+    assert_eq!(
+        commands::status::transitions(&before, &after),
+        [
+            "vim / gvimrc: new (pending)",
+            "vim / vimrc: pending → deployed"
+        ]
+    );
+    assert_eq!(
+        commands::status::transitions(&after, &before),
+        ["vim / vimrc: deployed → pending", "vim / gvimrc: gone"]
+    );
+}
+
+#[test]
+fn verify_checks_run_on_up_and_degrade_the_pack_in_status() {
+    use commands::status::{StatusOutcome, StatusSummary};
+
+    let env = TempEnvironment::builder()
+        .pack("vim")
+        .file("vimrc", "set nocompatible")
+        .config("[pack]\nverify = [\"test -f vimrc\", \"test -f missing\"]\n")
+        .done()
+        .build();
+    let runner: Arc<dyn CommandRunner> = Arc::new(crate::datastore::ShellCommandRunner::new(false));
+    let ctx = make_ctx_with_runner(&env, runner);
+
+    let verify_rows = |result: &commands::PackStatusResult| -> Vec<(String, String)> {
+        result.packs[0]
+            .files
+            .iter()
+            .filter(|f| f.handler == "verify")
+            .map(|f| (f.name.clone(), f.status.clone()))
+            .collect()
+    };
+
+    let before = commands::status::status(None, &ctx).unwrap();
+    assert_eq!(
+        verify_rows(&before),
+        [
+            ("test -f vimrc".to_string(), "pending".to_string()),
+            ("test -f missing".to_string(), "pending".to_string()),
+        ]
+    );
+
+    let up = commands::up::up(None, &ctx).unwrap();
+    assert_eq!(up.packs[0].summary_status, "degraded");
+    assert_eq!(
+        verify_rows(&up),
+        [
+            ("test -f vimrc".to_string(), "deployed".to_string()),
+            ("test -f missing".to_string(), "degraded".to_string()),
+        ]
+    );
+
+    let summary = StatusSummary::from_result(&commands::status::status(None, &ctx).unwrap());
+    assert_eq!(summary.degraded, 1);
+    assert_eq!(summary.outcome(), StatusOutcome::Errors);
+    assert_eq!(summary.line(), "dodot: 1 degraded");
+
+    // Fixing the cause and re-running `up` clears the degraded state.
+    env.fs
+        .write_file(&env.dotfiles_root.join("vim/missing"), b"")
+        .unwrap();
+    let up = commands::up::up(None, &ctx).unwrap();
+    assert_eq!(up.packs[0].summary_status, "deployed");
+}
+
 /// On non-macOS, `_lib/<rest>` entries resolve to `Resolution::Skip`
 /// in the planner. Status must suppress the corresponding row and
 /// only surface the warning — otherwise the user sees a confusing
@@ -186,6 +297,89 @@ fn status_renders_with_standout() {
     assert!(json.contains("\"packs\""), "json: {json}");
 }
 
+#[test]
+fn up_and_down_group_rows_into_link_and_provision_phases() {
+    let env = TempEnvironment::builder()
+        .pack("vim")
+        .file("vimrc", "x")
+        .file("aliases.sh", "alias v=vim")
+        .file("install.sh", "#!/bin/sh\necho hi")
+        .done()
+        .build();
+
+    let mut ctx = make_ctx(&env);
+    ctx.dry_run = true;
+    let planned = commands::up::up(None, &ctx).unwrap();
+    let link = &planned.phases[0];
+    assert_eq!(link.name, "link");
+    assert!(
+        link.done > 0 && link.summary.ends_with(" planned"),
+        "{link:?}"
+    );
+    let output = render::render("pack-status", &planned, OutputMode::Text).unwrap();
+    assert!(output.contains("dry run"), "output: {output}");
+    assert!(output.contains("Planned, by phase"), "output: {output}");
+
+    // `make_ctx` skips provisioning, so install.sh stays pending.
+    ctx.dry_run = false;
+    let result = commands::up::up(None, &ctx).unwrap();
+    let names: Vec<&str> = result.phases.iter().map(|p| p.name.as_str()).collect();
+    assert_eq!(names, ["link", "provision"]);
+    assert_eq!(result.phases[0].summary, "2 linked");
+    assert_eq!(result.phases[0].status, "deployed");
+    assert_eq!(result.phases[1].summary, "1 pending");
+    assert_eq!(result.phases[1].errors, 0);
+    let output = render::render("pack-status", &result, OutputMode::Text).unwrap();
+    assert!(output.contains("By phase:"), "output: {output}");
+    assert!(output.contains("Provision"), "output: {output}");
+    let json = render::render("pack-status", &result, OutputMode::Json).unwrap();
+    assert!(json.contains("\"phases\""), "json: {json}");
+
+    let down = commands::down::down(None, &ctx).unwrap();
+    assert_eq!(down.phases[0].summary, "2 removed");
+
+    // `status` has no phases to report.
+    let status = commands::status::status(None, &ctx).unwrap();
+    assert!(status.phases.is_empty());
+}
+
+#[test]
+fn render_verbosity_controls_pack_status_detail() {
+    let env = TempEnvironment::builder()
+        .pack("vim")
+        .file("vimrc", "x")
+        .file("README.md", "# vim pack")
+        .done()
+        .build();
+
+    let mut ctx = make_ctx(&env);
+    let result = commands::status::status(None, &ctx).unwrap();
+    assert_eq!(result.summary, "1 pack: 1 pending");
+    assert!(result.elapsed.is_none());
+    let output = render::render("pack-status", &result, OutputMode::Text).unwrap();
+    assert!(output.contains("vimrc"), "output: {output}");
+    assert!(
+        !output.contains("README.md"),
+        "skipped rows hidden: {output}"
+    );
+    assert!(!output.contains("1 pack: 1 pending"), "output: {output}");
+
+    ctx.render_verbosity = commands::RenderVerbosity::Quiet;
+    let result = commands::status::status(None, &ctx).unwrap();
+    let output = render::render("pack-status", &result, OutputMode::Text).unwrap();
+    assert_eq!(output.trim(), "1 pack: 1 pending");
+
+    ctx.render_verbosity = commands::RenderVerbosity::Verbose;
+    let result = commands::status::status(None, &ctx).unwrap();
+    assert!(result.elapsed.as_deref().unwrap().starts_with("took "));
+    let output = render::render("pack-status", &result, OutputMode::Text).unwrap();
+    assert!(output.contains("README.md"), "output: {output}");
+    assert!(
+        output.contains("1 pack: 1 pending (took "),
+        "output: {output}"
+    );
+}
+
 #[test]
 fn status_lists_ignored_packs() {
     let env = TempEnvironment::builder()
@@ -401,6 +595,10 @@ fn up_deploys_packs() {
 
     assert!(!result.packs.is_empty());
     assert!(result.message.is_some());
+    env.assert_links(&[
+        ("~/.config/vim/vimrc", "vim/vimrc"),
+        ("~/.config/vim/gvimrc", "vim/gvimrc"),
+    ]);
 
     // After up, status should show deployed
     let status = commands::status::status(None, &ctx).unwrap();
@@ -412,6 +610,43 @@ fn up_deploys_packs() {
     assert!(deployed_count > 0, "some files should be deployed after up");
 }
 
+#[test]
+fn up_with_only_deploys_the_subset_and_marks_the_rest_skipped() {
+    let env = TempEnvironment::builder()
+        .pack("vim")
+        .file("vimrc", "set nocompatible")
+        .file("gvimrc", "set guifont=Mono")
+        .done()
+        .build();
+
+    let mut ctx = make_ctx(&env);
+    ctx.file_filter = crate::rules::FileFilter::new(&["vimrc".into()], &[]).unwrap();
+    let result = commands::up::up(None, &ctx).unwrap();
+    let label = |packs: &[commands::DisplayPack], name: &str| {
+        packs[0]
+            .files
+            .iter()
+            .find(|f| f.name == name)
+            .map(|f| f.status_label.clone())
+            .unwrap_or_else(|| panic!("no {name} row"))
+    };
+    assert_eq!(label(&result.packs, "gvimrc"), "skipped (--only)");
+
+    // Without the filter, the left-out file is simply not deployed yet.
+    let ctx = make_ctx(&env);
+    let status = commands::status::status(None, &ctx).unwrap();
+    let row = |name: &str| {
+        status.packs[0]
+            .files
+            .iter()
+            .find(|f| f.name == name)
+            .map(|f| f.status.clone())
+            .unwrap()
+    };
+    assert_eq!(row("vimrc"), "deployed");
+    assert_eq!(row("gvimrc"), "pending");
+}
+
 /// Regression for #42 (unify status rendering): `up` and `status` must
 /// produce identical per-file status_label strings for the same handler
 /// state. Before #42, `up` reported "staged bin" while `status` reported
@@ -478,6 +713,84 @@ fn up_and_status_produce_matching_labels() {
     );
 }
 
+#[test]
+fn large_file_guard_warns_or_skips_catchall_links() {
+    let blob = "\0".repeat(4096);
+    let env = TempEnvironment::builder()
+        .pack("junk")
+        .file("vimrc", "set nu")
+        .file("dump.db", &blob)
+        .config("[symlink]\nlarge_files = \"skip\"\nmax_binary_size_kb = 1\n")
+        .done()
+        .pack("keep")
+        .file("cache.db", &blob)
+        .config("[symlink]\nmax_binary_size_kb = 1\n")
+        .done()
+        .build();
+
+    let ctx = make_ctx(&env);
+    let result = commands::up::up(None, &ctx).unwrap();
+    let warned = |name: &str| {
+        result
+            .warnings
+            .iter()
+            .find(|w| w.contains(name))
+            .cloned()
+            .unwrap_or_else(|| panic!("no warning for {name}: {:?}", result.warnings))
+    };
+    assert!(warned("dump.db").contains("binary, 4.0 KB"));
+    assert!(warned("dump.db").contains("not linked"));
+    assert!(warned("cache.db").contains("linked anyway"));
+
+    env.assert_not_exists(&env.home.join(".config/junk/dump.db"));
+    assert!(env.fs.exists(&env.home.join(".config/junk/vimrc")));
+    assert!(env.fs.exists(&env.home.join(".config/keep/cache.db")));
+}
+
+#[test]
+fn gitconfig_fragments_are_included_on_up_and_dropped_on_down() {
+    let env = TempEnvironment::builder()
+        .pack("git")
+        .file("core.gitinclude", "[core]\n\tpager = less\n")
+        .done()
+        .pack("work")
+        .file("identity.gitinclude", "[user]\n\temail = me@work\n")
+        .done()
+        .home_file(".gitconfig", "[user]\n\tname = Me\n")
+        .build();
+    let gitconfig = env.home.join(".gitconfig");
+
+    let ctx = make_ctx(&env);
+    commands::up::up(None, &ctx).unwrap();
+    let content = env.fs.read_to_string(&gitconfig).unwrap();
+    assert!(content.starts_with("[user]\n\tname = Me\n"), "{content}");
+    assert!(content.contains("core.gitinclude"), "{content}");
+    assert!(content.contains("identity.gitinclude"), "{content}");
+    // Fragments are included, never linked into $HOME.
+    env.assert_not_exists(&env.home.join(".core.gitinclude"));
+
+    let status = commands::status::status(None, &ctx).unwrap();
+    let row = status
+        .packs
+        .iter()
+        .flat_map(|p| &p.files)
+        .find(|f| f.name == "core.gitinclude")
+        .unwrap();
+    assert_eq!(row.handler, "gitconfig");
+    assert_eq!(row.status, "deployed");
+
+    commands::down::down(Some(&["work".to_string()]), &ctx).unwrap();
+    let content = env.fs.read_to_string(&gitconfig).unwrap();
+    assert!(content.contains("core.gitinclude"), "{content}");
+    assert!(!content.contains("identity.gitinclude"), "{content}");
+
+    commands::down::down(None, &ctx).unwrap();
+    assert_eq!(
+        env.fs.read_to_string(&gitconfig).unwrap(),
+        "[user]\n\tname = Me\n"
+    );
+}
+
 /// Regression for #42: `down` should likewise render through status, not
 /// hand-rolled "removed" / "state removed" labels.
 #[test]
@@ -815,6 +1128,35 @@ fn up_dry_run_no_changes() {
     }
 }
 
+#[test]
+fn up_dry_run_estimates_the_provisioning_work() {
+    let env = TempEnvironment::builder()
+        .pack("vim")
+        .file("vimrc", "x")
+        .file("install.sh", "#!/bin/sh\necho hi")
+        .done()
+        .build();
+
+    let mut ctx = make_ctx(&env);
+    ctx.dry_run = true;
+    ctx.no_provision = false;
+
+    let result = commands::up::up(None, &ctx).unwrap();
+    let estimate = result.estimate.as_ref().expect("install.sh would run");
+    assert_eq!(estimate.runs.len(), 1);
+    assert_eq!(estimate.runs[0].filename, "install.sh");
+    let output = render::render("pack-status", &result, OutputMode::Text).unwrap();
+    assert!(
+        output.contains("1 provisioning step(s) to run (1 first run)"),
+        "output: {output}"
+    );
+
+    // Links alone cost nothing worth estimating.
+    ctx.no_provision = true;
+    let result = commands::up::up(None, &ctx).unwrap();
+    assert!(result.estimate.is_none());
+}
+
 #[test]
 fn up_dry_run_does_not_write_preprocessing_baselines() {
     // Baselines anchor "the state of the last successful `up`," so
@@ -1032,6 +1374,15 @@ fn up_force_overwrites_existing_files() {
     // File should now be a symlink with new content
     let content = env.fs.read_to_string(&env.home.join(".gitconfig")).unwrap();
     assert_eq!(content, "[user]\n  name = new");
+
+    // The original went to the trash, and restores over the link
+    let trashed = commands::trash::list(&ctx).unwrap();
+    assert_eq!(trashed.entries.len(), 1);
+    assert_eq!(trashed.entries[0].pack, "git");
+    commands::trash::restore(&trashed.entries[0].id, &ctx).unwrap();
+    let content = env.fs.read_to_string(&env.home.join(".gitconfig")).unwrap();
+    assert_eq!(content, "[user]\n  name = old");
+    assert!(!env.fs.is_symlink(&env.home.join(".gitconfig")));
 }
 
 // ── up: reconcile non-provisioning state (#58) ─────────────
@@ -1192,6 +1543,73 @@ fn up_preserves_install_sentinel_when_source_persists() {
     );
 }
 
+#[test]
+fn status_shows_recorded_run_metadata() {
+    let env = TempEnvironment::builder()
+        .pack("setup")
+        .file("install.sh", "#!/bin/sh\necho hi")
+        .done()
+        .build();
+    let ctx = make_ctx(&env);
+
+    // A sentinel from an earlier revision, written by a current dodot
+    // on another host.
+    let record = crate::datastore::SentinelRecord {
+        completed_at: crate::datastore::sentinel::unix_now() - 3 * 86_400,
+        duration_ms: Some(42_000),
+        dodot_version: Some("5.2.0".into()),
+        hostname: Some("mbp".into()),
+    };
+    let install_dir = env.paths.handler_data_dir("setup", "install");
+    env.fs.mkdir_all(&install_dir).unwrap();
+    env.fs
+        .write_file(
+            &install_dir.join("install.sh-aaaaaaaaaaaaaaaa"),
+            record.to_content().as_bytes(),
+        )
+        .unwrap();
+
+    let result = commands::status::status(None, &ctx).unwrap();
+    let row = result.packs[0]
+        .files
+        .iter()
+        .find(|f| f.handler == "install")
+        .unwrap();
+    assert_eq!(row.last_run.as_deref(), Some("3d ago on mbp in 42s"));
+}
+
+#[test]
+fn status_report_groups_items_by_handler_and_matches_rows() {
+    let mut builder = TempEnvironment::builder().pack("dev");
+    builder = builder.file("aliases.sh", "alias ll='ls -l'");
+    // Enough links to take the parallel verification path.
+    for i in 0..20 {
+        builder = builder.file(&format!("rc{i:02}"), "x");
+    }
+    let env = builder.done().build();
+    let ctx = make_ctx(&env);
+    commands::up::up(None, &ctx).unwrap();
+
+    let result = commands::status::status(None, &ctx).unwrap();
+    let report = result.report.expect("status carries a report");
+    let pack = &report.packs[0];
+    assert_eq!(pack.name, "dev");
+
+    let symlinks = pack
+        .handlers
+        .iter()
+        .find(|h| h.handler == "symlink")
+        .unwrap();
+    assert_eq!(symlinks.items.len(), 20);
+    assert!(symlinks.items.iter().all(|i| i.state == "deployed"));
+    assert_eq!(symlinks.items[0].name, "rc00");
+    assert_eq!(symlinks.items[0].target.as_deref(), Some("~/.rc00"));
+    assert!(pack.handlers.iter().any(|h| h.handler == "shell"));
+
+    let total: usize = pack.handlers.iter().map(|h| h.items.len()).sum();
+    assert_eq!(total, result.packs[0].files.len());
+}
+
 #[test]
 fn up_preserves_install_sentinel_when_source_deleted() {
     let env = TempEnvironment::builder()
@@ -1256,16 +1674,16 @@ fn down_removes_deployed_state() {
     let down_result = commands::down::down(None, &ctx).unwrap();
     assert!(down_result.message.is_some());
 
-    // After down, all files should be plain pending. The user-side
-    // symlinks left dangling by `down` are NOT conflicts — the executor's
-    // create_user_link gracefully replaces them on the next `up`. (#43
-    // refines `PendingConflict` to only fire when the executor would
-    // actually refuse: non-symlink + exists.)
+    // The symlink handler's undo removes the user-side link instead of
+    // leaving it dangling.
+    assert!(!env.fs.is_symlink(&env.home.join(".config/vim/vimrc")));
+
+    // After down, all files should be plain pending.
     let status = commands::status::status(None, &ctx).unwrap();
     for file in &status.packs[0].files {
         assert_eq!(
             file.status, "pending",
-            "file {} should be pending after down (dangling symlinks are not conflicts), got {}",
+            "file {} should be pending after down, got {}",
             file.name, file.status
         );
     }
@@ -1305,50 +1723,459 @@ fn list_shows_all_packs() {
     assert!(output.contains("(ignored)"), "output: {output}");
 }
 
-// ── init ────────────────────────────────────────────────────
-
 #[test]
-fn init_creates_pack_directory() {
-    let env = TempEnvironment::builder().build();
+fn pack_metadata_is_listed_and_min_dodot_enforced() {
+    let env = TempEnvironment::builder()
+        .pack("git")
+        .file("gitconfig", "x")
+        .config("[pack]\ndescription = \"Git identity\"\nversion = \"1.2\"\n")
+        .done()
+        .pack("future")
+        .file("futurerc", "x")
+        .config("[pack]\nmin_dodot = \"999.0\"\n")
+        .done()
+        .build();
     let ctx = make_ctx(&env);
 
-    let result = commands::init::init("newpack", &ctx).unwrap();
-    assert!(result.message.contains("newpack"));
+    let listed = commands::list::list(&ctx).unwrap();
+    let git = listed.packs.iter().find(|p| p.name == "git").unwrap();
+    assert_eq!(git.metadata.as_ref().unwrap().description, "Git identity");
+    assert!(git.incompatible.is_none());
+    let future = listed.packs.iter().find(|p| p.name == "future").unwrap();
+    assert!(future.incompatible.is_some());
+    let output = render::render("list", &listed, OutputMode::Text).unwrap();
+    assert!(output.contains("Git identity"), "output: {output}");
+    assert!(output.contains("needs dodot >= 999.0"), "output: {output}");
 
-    env.assert_dir_exists(&env.dotfiles_root.join("newpack"));
-    env.assert_exists(&env.dotfiles_root.join("newpack/.dodot.toml"));
+    let result = commands::up::up(None, &ctx).unwrap();
+    assert!(
+        result
+            .warnings
+            .iter()
+            .any(|w| w.starts_with("pack 'future' needs dodot >= 999.0")),
+        "warnings: {:?}",
+        result.warnings
+    );
+    env.assert_exists(&env.home.join(".gitconfig"));
+    env.assert_not_exists(&env.home.join(".futurerc"));
 }
 
 #[test]
-fn init_fails_if_exists() {
+fn changes_compares_the_last_two_up_runs() {
     let env = TempEnvironment::builder()
-        .pack("existing")
-        .file("f", "x")
+        .pack("vim")
+        .file("vimrc", "x")
         .done()
         .build();
     let ctx = make_ctx(&env);
 
-    let err = commands::init::init("existing", &ctx).unwrap_err();
+    commands::up::up(None, &ctx).unwrap();
+    let first = commands::changes::changes(None, &ctx).unwrap();
+    assert!(first.changes.is_empty());
     assert!(
-        matches!(err, crate::DodotError::PackInvalid { .. }),
-        "expected PackInvalid, got: {err}"
+        first.message.starts_with("Nothing to compare"),
+        "{}",
+        first.message
     );
-}
 
-// ── addignore ───────────────────────────────────────────────
+    env.fs
+        .write_file(&env.dotfiles_root.join("vim/gvimrc"), b"y")
+        .unwrap();
+    commands::up::up(None, &ctx).unwrap();
+    let result = commands::changes::changes(None, &ctx).unwrap();
+    assert_eq!(result.changes.len(), 1, "{:?}", result.details);
+    let change = &result.changes[0];
+    assert_eq!(change.kind, commands::changes::ChangeKind::Added);
+    assert_eq!(change.name, "gvimrc");
+    assert_eq!(change.handler, "symlink");
+
+    let other = vec!["git".to_string()];
+    assert!(commands::changes::changes(Some(&other), &ctx)
+        .unwrap()
+        .changes
+        .is_empty());
+}
 
 #[test]
-fn addignore_creates_file() {
+fn rule_chmod_is_applied_on_up_and_drift_shows_in_status() {
     let env = TempEnvironment::builder()
-        .pack("scratch")
-        .file("notes", "x")
+        .pack("net")
+        .file("netrc", "machine example.com")
+        .config(
+            "[[rules]]\npattern = \"netrc\"\nhandler = \"symlink\"\n\
+             options = { target = \"~/.netrc\", chmod = \"0600\" }",
+        )
         .done()
         .build();
     let ctx = make_ctx(&env);
+    let netrc = env.home.join(".netrc");
 
-    let result = commands::addignore::addignore("scratch", &ctx).unwrap();
-    assert!(result.message.contains("ignored"));
-    env.assert_exists(&env.dotfiles_root.join("scratch/.dodotignore"));
+    commands::up::up(None, &ctx).unwrap();
+    assert_eq!(env.fs.stat(&netrc).unwrap().mode & 0o777, 0o600);
+    let file = || commands::status::status(None, &ctx).unwrap().packs[0].files[0].clone();
+    assert_eq!(file().status, "deployed");
+
+    env.fs.set_permissions(&netrc, 0o644).unwrap();
+    let drifted = file();
+    assert_eq!(drifted.status, "stale");
+    assert!(
+        drifted.status_label.contains("mode 0644, want 0600"),
+        "{}",
+        drifted.status_label
+    );
+
+    commands::up::up(None, &ctx).unwrap();
+    assert_eq!(env.fs.stat(&netrc).unwrap().mode & 0o777, 0o600);
+}
+
+#[test]
+fn preview_marks_home_paths_and_changes_nothing() {
+    use commands::preview::PathAction;
+
+    let env = TempEnvironment::builder()
+        .pack("vim")
+        .file("vimrc", "set nocompatible")
+        .file("gvimrc", "set guifont=Mono")
+        .done()
+        .home_file(".vimrc", "mine")
+        .build();
+    let ctx = make_ctx(&env);
+
+    let result = commands::preview::preview(None, &ctx).unwrap();
+    let actions: Vec<(&str, PathAction)> = result
+        .paths
+        .iter()
+        .map(|p| (p.path.as_str(), p.action))
+        .collect();
+    assert_eq!(
+        actions,
+        vec![
+            ("~/.gvimrc", PathAction::Create),
+            ("~/.vimrc", PathAction::Conflict),
+        ]
+    );
+    let names: Vec<String> = result
+        .lines
+        .iter()
+        .map(|l| format!("{}{}", l.prefix, l.name))
+        .collect();
+    assert_eq!(names, vec!["~", "├─ .gvimrc", "└─ .vimrc"]);
+    assert!(
+        result.message.contains("1 in conflict"),
+        "{}",
+        result.message
+    );
+    env.assert_not_exists(&env.home.join(".gvimrc"));
+}
+
+#[test]
+fn list_files_filters_and_sorts_by_status_engine_state() {
+    let env = TempEnvironment::builder()
+        .pack("vim")
+        .file("vimrc", "x")
+        .file("aliases.sh", "alias v=vim")
+        .file("bin/vtool", "#!/bin/sh")
+        .done()
+        .pack("disabled")
+        .file("x", "x")
+        .ignored()
+        .done()
+        .build();
+    let ctx = make_ctx(&env);
+
+    let all = commands::list::list_files(&commands::list::FileQuery::default(), &ctx).unwrap();
+    let vim = all.packs.iter().find(|p| p.name == "vim").unwrap();
+    let files = vim.files.as_ref().unwrap();
+    assert_eq!(files.len(), 3);
+    assert!(files.iter().all(|f| f.state == "pending"), "{files:?}");
+    let disabled = all.packs.iter().find(|p| p.name == "disabled").unwrap();
+    assert!(disabled.files.is_none());
+
+    let by_handler = commands::list::FileQuery {
+        sort: commands::list::FileSort::Handler,
+        ..Default::default()
+    };
+    let sorted = commands::list::list_files(&by_handler, &ctx).unwrap();
+    let vim = sorted.packs.iter().find(|p| p.name == "vim").unwrap();
+    let handlers: Vec<&str> = vim
+        .files
+        .as_ref()
+        .unwrap()
+        .iter()
+        .map(|f| f.handler.as_str())
+        .collect();
+    assert_eq!(handlers, vec!["path", "shell", "symlink"]);
+
+    commands::up::up(None, &ctx).unwrap();
+    let query = commands::list::FileQuery {
+        handler: Some("symlink".into()),
+        state: Some("deployed".into()),
+        ..Default::default()
+    };
+    let result = commands::list::list_files(&query, &ctx).unwrap();
+    let vim = result.packs.iter().find(|p| p.name == "vim").unwrap();
+    let names: Vec<&str> = vim
+        .files
+        .as_ref()
+        .unwrap()
+        .iter()
+        .map(|f| f.name.as_str())
+        .collect();
+    assert_eq!(names, vec!["vimrc"]);
+
+    let output = render::render("list", &result, OutputMode::Text).unwrap();
+    assert!(output.contains("vimrc"), "output: {output}");
+    assert!(output.contains("symlink"), "output: {output}");
+    assert!(!output.contains("aliases.sh"), "output: {output}");
+}
+
+// ── init ────────────────────────────────────────────────────
+
+#[test]
+fn init_creates_pack_directory() {
+    let env = TempEnvironment::builder().build();
+    let ctx = make_ctx(&env);
+
+    let result = commands::init::init("newpack", &ctx).unwrap();
+    assert!(result.message.contains("newpack"));
+
+    env.assert_dir_exists(&env.dotfiles_root.join("newpack"));
+    env.assert_exists(&env.dotfiles_root.join("newpack/.dodot.toml"));
+}
+
+#[test]
+fn init_fails_if_exists() {
+    let env = TempEnvironment::builder()
+        .pack("existing")
+        .file("f", "x")
+        .done()
+        .build();
+    let ctx = make_ctx(&env);
+
+    let err = commands::init::init("existing", &ctx).unwrap_err();
+    assert!(
+        matches!(err, crate::DodotError::PackInvalid { .. }),
+        "expected PackInvalid, got: {err}"
+    );
+}
+
+#[test]
+fn init_type_copies_archetype_with_pack_name_substituted() {
+    let env = TempEnvironment::builder().build();
+    let archetype = env.paths.pack_templates_dir().join("service");
+    env.fs.mkdir_all(&archetype.join("bin")).unwrap();
+    env.fs
+        .write_file(
+            &archetype.join("bin/{{ pack }}-ctl"),
+            b"#!/bin/sh\necho {{pack}}\n",
+        )
+        .unwrap();
+    env.fs
+        .write_file(
+            &archetype.join("config.toml.tmpl"),
+            b"name = \"{{ data.name }}\"\n",
+        )
+        .unwrap();
+    let ctx = make_ctx(&env);
+
+    let result = commands::init::init_from("api", Some("service"), &ctx).unwrap();
+    assert!(
+        result.message.contains("from type 'service'"),
+        "{}",
+        result.message
+    );
+
+    let pack = env.dotfiles_root.join("api");
+    env.assert_file_contents(&pack.join("bin/api-ctl"), "#!/bin/sh\necho api\n");
+    // Other template syntax is left for the preprocessor.
+    env.assert_file_contents(
+        &pack.join("config.toml.tmpl"),
+        "name = \"{{ data.name }}\"\n",
+    );
+    // No archetype .dodot.toml: the default one is written.
+    env.assert_exists(&pack.join(".dodot.toml"));
+
+    let err = commands::init::init_from("web", Some("nope"), &ctx).unwrap_err();
+    assert!(err.to_string().contains("available: service"), "{err}");
+    assert!(!env.fs.exists(&env.dotfiles_root.join("web")));
+}
+
+#[test]
+fn init_repo_scaffolds_a_repo_with_sample_packs() {
+    let env = TempEnvironment::builder().build();
+    let dest = env.home.join("new-dotfiles");
+    let runner = CannedRunner::new();
+    runner.respond(&["git", "init", &dest.display().to_string()], "", 0);
+
+    let result = commands::init::init_repo(&dest, env.fs.as_ref(), &runner).unwrap();
+    assert!(
+        result.message.contains("new-dotfiles"),
+        "{}",
+        result.message
+    );
+    for file in [
+        ".dodot.toml",
+        "README.md",
+        ".github/workflows/dodot.yml",
+        "shell/aliases.sh",
+        "git/config",
+        "vim/home.vimrc",
+    ] {
+        env.assert_exists(&dest.join(file));
+    }
+
+    // The sample packs deploy where the README says they do.
+    let paths = crate::paths::XdgPather::builder()
+        .home(&env.home)
+        .dotfiles_root(&dest)
+        .xdg_config_home(env.home.join(".config"))
+        .data_dir(env.paths.data_dir())
+        .build()
+        .unwrap();
+    let config = crate::handlers::HandlerConfig::default();
+    assert_eq!(
+        crate::handlers::symlink::resolve_target("git", "config", &config, &paths),
+        env.home.join(".config/git/config")
+    );
+    assert_eq!(
+        crate::handlers::symlink::resolve_target("vim", "home.vimrc", &config, &paths),
+        env.home.join(".vimrc")
+    );
+
+    let err = commands::init::init_repo(&dest, env.fs.as_ref(), &runner).unwrap_err();
+    assert!(err.to_string().contains("not empty"), "{err}");
+}
+
+// ── clone ───────────────────────────────────────────────────
+
+#[test]
+fn clone_runs_git_clone_and_refuses_non_empty_dest() {
+    let env = TempEnvironment::builder().build();
+    let dest = env.home.join("dotfiles-new");
+    let runner = CannedRunner::new();
+    runner.respond(
+        &[
+            "git",
+            "clone",
+            "https://example.com/dots.git",
+            &dest.display().to_string(),
+        ],
+        "",
+        0,
+    );
+    commands::clone::clone_repo(
+        "https://example.com/dots.git",
+        &dest,
+        env.fs.as_ref(),
+        &runner,
+    )
+    .unwrap();
+
+    let err = commands::clone::clone_repo(
+        "https://example.com/dots.git",
+        &env.dotfiles_root,
+        env.fs.as_ref(),
+        &runner,
+    )
+    .unwrap_err();
+    assert!(err.to_string().contains("not empty"), "{err}");
+}
+
+#[test]
+fn clone_bootstrap_installs_snippet_once_and_deploys() {
+    let env = TempEnvironment::builder()
+        .pack("vim")
+        .file("vimrc", "set nocompatible")
+        .done()
+        .pack("git")
+        .file("gitconfig", "[user]")
+        .done()
+        .build();
+    let ctx = make_ctx(&env);
+    let packs = vec!["vim".to_string()];
+
+    let result =
+        commands::clone::bootstrap(&ctx, commands::git_alias::Shell::Zsh, Some(&packs), true)
+            .unwrap();
+    assert!(result.message.unwrap().contains("~/.zshrc"));
+    assert_eq!(result.packs.len(), 1);
+    assert!(env.fs.is_symlink(&env.home.join(".config/vim/vimrc")));
+    assert!(!env.fs.exists(&env.home.join(".config/git/gitconfig")));
+
+    commands::clone::bootstrap(&ctx, commands::git_alias::Shell::Zsh, Some(&packs), true).unwrap();
+    let rc = env.fs.read_to_string(&env.home.join(".zshrc")).unwrap();
+    assert_eq!(rc.matches("export DOTFILES_ROOT=").count(), 1, "{rc}");
+    assert!(
+        rc.contains(&env.dotfiles_root.display().to_string()),
+        "{rc}"
+    );
+}
+
+#[test]
+fn snippet_install_is_idempotent_refuses_edits_and_uninstalls_cleanly() {
+    use commands::git_alias::Shell;
+
+    let env = TempEnvironment::builder().build();
+    let mut ctx = make_ctx(&env);
+    let rc_path = env.home.join(".bashrc");
+    let original = "alias ll='ls -l'\n";
+    env.fs.write_file(&rc_path, original.as_bytes()).unwrap();
+
+    commands::snippet::install(&ctx, Shell::Bash).unwrap();
+    let installed = env.fs.read_to_string(&rc_path).unwrap();
+    assert!(installed.starts_with(original), "{installed}");
+    assert!(
+        installed.contains("eval \"$(dodot init-sh)\""),
+        "{installed}"
+    );
+    assert!(installed.contains("# checksum: "), "{installed}");
+
+    let again = commands::snippet::install(&ctx, Shell::Bash).unwrap();
+    assert!(again.message.contains("nothing to do"), "{}", again.message);
+    assert_eq!(env.fs.read_to_string(&rc_path).unwrap(), installed);
+
+    let edited = installed.replace("eval", "# eval");
+    env.fs.write_file(&rc_path, edited.as_bytes()).unwrap();
+    let err = commands::snippet::uninstall(&ctx, Shell::Bash).unwrap_err();
+    assert!(err.to_string().contains("--force"), "{err}");
+    assert_eq!(env.fs.read_to_string(&rc_path).unwrap(), edited);
+
+    ctx.force = true;
+    commands::snippet::uninstall(&ctx, Shell::Bash).unwrap();
+    assert_eq!(env.fs.read_to_string(&rc_path).unwrap(), original);
+}
+
+#[test]
+fn snippet_install_creates_the_fish_config() {
+    let env = TempEnvironment::builder().build();
+    let ctx = make_ctx(&env);
+
+    commands::snippet::install(&ctx, commands::git_alias::Shell::Fish).unwrap();
+    let config = env
+        .fs
+        .read_to_string(&env.home.join(".config/fish/config.fish"))
+        .unwrap();
+    assert!(config.contains("set -gx DOTFILES_ROOT"), "{config}");
+    // No generated path in the block: it stays the same on every host
+    // sharing this config.fish, whatever its data dir.
+    assert!(config.contains("dodot init-sh --fish | source"), "{config}");
+    assert!(!config.contains("dodot-init.fish"), "{config}");
+}
+
+// ── addignore ───────────────────────────────────────────────
+
+#[test]
+fn addignore_creates_file() {
+    let env = TempEnvironment::builder()
+        .pack("scratch")
+        .file("notes", "x")
+        .done()
+        .build();
+    let ctx = make_ctx(&env);
+
+    let result = commands::addignore::addignore("scratch", &ctx).unwrap();
+    assert!(result.message.contains("ignored"));
+    env.assert_exists(&env.dotfiles_root.join("scratch/.dodotignore"));
 }
 
 #[test]
@@ -1365,6 +2192,118 @@ fn addignore_idempotent() {
     assert!(result.message.contains("already ignored"));
 }
 
+// ── pin ────────────────────────────────────────────────────
+
+#[test]
+fn pinned_pack_is_left_alone_by_up_until_unpinned() {
+    let env = TempEnvironment::builder()
+        .pack("vim")
+        .file("vimrc", "x")
+        .done()
+        .pack("git")
+        .file("gitconfig", "[user]")
+        .done()
+        .build();
+    let ctx = make_ctx(&env);
+
+    let pinned = commands::pin::pin("vim", Some("testing"), &ctx).unwrap();
+    assert!(pinned.message.contains("pinned"), "{}", pinned.message);
+    assert_eq!(pinned.pins.len(), 1);
+    assert!(commands::pin::pin("vim", None, &ctx)
+        .unwrap()
+        .message
+        .contains("already pinned"));
+
+    let result = commands::up::up(None, &ctx).unwrap();
+    assert!(
+        result
+            .warnings
+            .iter()
+            .any(|w| w.contains("'vim' is pinned")),
+        "{:?}",
+        result.warnings
+    );
+    env.assert_no_handler_state("vim", "symlink");
+    env.assert_not_exists(&env.home.join(".config/vim/vimrc"));
+    env.assert_links(&[("~/.config/git/gitconfig", "git/gitconfig")]);
+
+    let status = commands::status::status(None, &ctx).unwrap();
+    let vim = status.packs.iter().find(|p| p.name == "vim").unwrap();
+    assert!(vim.pinned);
+
+    let unpinned = commands::pin::unpin("vim", &ctx).unwrap();
+    assert!(
+        unpinned.message.contains("unpinned"),
+        "{}",
+        unpinned.message
+    );
+    assert!(commands::pin::list(&ctx).unwrap().pins.is_empty());
+    commands::up::up(None, &ctx).unwrap();
+    env.assert_links(&[("~/.config/vim/vimrc", "vim/vimrc")]);
+}
+
+// ── protect ────────────────────────────────────────────────
+
+#[test]
+fn protect_edits_the_root_and_pack_lists() {
+    let env = TempEnvironment::builder()
+        .pack("work")
+        .file("netrc", "machine example.com")
+        .done()
+        .build();
+    let root_file = env.dotfiles_root.join(".dodot.toml");
+    env.fs
+        .write_file(&root_file, b"# mine\n[symlink]\nmode = \"symlink\"\n")
+        .unwrap();
+    let ctx = make_ctx(&env);
+    let read = |path: &std::path::Path| String::from_utf8(env.fs.read_file(path).unwrap()).unwrap();
+
+    let before = commands::protect::list(&ctx).unwrap();
+    assert!(before.paths.iter().all(|p| p.source == "default"));
+
+    let added = commands::protect::add("~/.netrc", None, &ctx).unwrap();
+    assert!(
+        added.message.contains("Protected `.netrc`"),
+        "{}",
+        added.message
+    );
+    let text = read(&root_file);
+    // The defaults are written out with the new entry; the rest of the
+    // file is untouched.
+    assert!(
+        text.starts_with("# mine\n[symlink]\nprotected_paths = [\n"),
+        "{text}"
+    );
+    assert!(text.contains("\".ssh/id_rsa\",\n"), "{text}");
+    assert!(
+        text.ends_with("    \".netrc\",\n]\nmode = \"symlink\"\n"),
+        "{text}"
+    );
+
+    commands::protect::add(".work/*", Some("work"), &ctx).unwrap();
+    assert!(commands::protect::add(".netrc", Some("work"), &ctx)
+        .unwrap()
+        .message
+        .contains("already protected by the root config"));
+    let listed = commands::protect::list(&ctx).unwrap();
+    assert_eq!(listed.paths.len(), before.paths.len() + 2);
+    let work = listed.paths.last().unwrap();
+    assert_eq!(
+        (work.path.as_str(), work.source.as_str()),
+        (".work/*", "work")
+    );
+
+    let not_there = commands::protect::remove(".netrc", Some("work"), &ctx).unwrap();
+    assert!(
+        not_there.message.contains("comes from the root config"),
+        "{}",
+        not_there.message
+    );
+    commands::protect::remove("~/.netrc", None, &ctx).unwrap();
+    assert!(!read(&root_file).contains(".netrc"));
+    assert!(commands::protect::add("/etc/hosts", None, &ctx).is_err());
+}
+
 // ── nonexistent pack ───────────────────────────────────────
 
 #[test]
@@ -1610,19 +2549,12 @@ fn status_does_not_flag_pre_existing_symlinks_as_conflict() {
         .pack("ghostty")
         .file("ghostrc", "x")
         .done()
+        // Equivalent symlink: ~/.kittyrc already points at dodot's source.
+        .home_symlink(".kittyrc", "dotfiles/kitty/kittyrc")
+        // Non-equivalent symlink: ~/.ghostrc points somewhere else entirely.
+        .home_symlink(".ghostrc", "/tmp/elsewhere")
         .build();
 
-    // Equivalent symlink: ~/.kittyrc already points at dodot's source.
-    let source = env.dotfiles_root.join("kitty/kittyrc");
-    let kitty_target = env.home.join(".kittyrc");
-    env.fs.symlink(&source, &kitty_target).unwrap();
-
-    // Non-equivalent symlink: ~/.ghostrc points somewhere else entirely.
-    let ghostty_target = env.home.join(".ghostrc");
-    env.fs
-        .symlink(std::path::Path::new("/tmp/elsewhere"), &ghostty_target)
-        .unwrap();
-
     let ctx = make_ctx(&env);
     let result = commands::status::status(None, &ctx).unwrap();
 
@@ -2126,6 +3058,7 @@ fn summary_aggregates_all_deployed_as_deployed() {
             status_label: "deployed".into(),
             handler: "symlink".into(),
             note_ref: None,
+            last_run: None,
         },
         DisplayFile {
             name: "b".into(),
@@ -2135,6 +3068,7 @@ fn summary_aggregates_all_deployed_as_deployed() {
             status_label: "deployed".into(),
             handler: "symlink".into(),
             note_ref: None,
+            last_run: None,
         },
     ];
     let pack = DisplayPack::new("vim".into(), files);
@@ -2154,6 +3088,7 @@ fn summary_rolls_up_error_over_pending_over_deployed() {
         status_label: status.into(),
         handler: "symlink".into(),
         note_ref: None,
+        last_run: None,
     };
 
     // error beats pending beats deployed
@@ -2174,6 +3109,12 @@ fn summary_rolls_up_error_over_pending_over_deployed() {
     let pack = DisplayPack::new("w".into(), vec![mk("warning"), mk("deployed")]);
     assert_eq!(pack.summary_status, "pending");
 
+    // a failed verify check degrades the pack, below error
+    let pack = DisplayPack::new("d".into(), vec![mk("degraded"), mk("pending")]);
+    assert_eq!(pack.summary_status, "degraded");
+    let pack = DisplayPack::new("e".into(), vec![mk("degraded"), mk("error")]);
+    assert_eq!(pack.summary_status, "error");
+
     // count counts only files in the winning bucket
     let pack = DisplayPack::new(
         "counts".into(),
@@ -2221,7 +3162,7 @@ fn short_mode_renders_one_line_per_pack_with_count() {
 }
 
 #[test]
-fn by_status_groups_packs_under_banners() {
+fn table_mode_renders_one_aligned_row_per_file() {
     let env = TempEnvironment::builder()
         .pack("vim")
         .file("vimrc", "x")
@@ -2232,22 +3173,709 @@ fn by_status_groups_packs_under_banners() {
         .build();
 
     let mut ctx = make_ctx(&env);
-    ctx.group_mode = crate::commands::GroupMode::Status;
+    ctx.view_mode = crate::commands::ViewMode::Table;
     let result = commands::status::status(None, &ctx).unwrap();
+    let table = result.table.as_ref().expect("table view populates rows");
+    assert_eq!(table.rows.len(), 2);
+    assert!(table.rows.iter().all(|r| r.last_run == "-"));
 
     let output = render::render("pack-status", &result, OutputMode::Text).unwrap();
+    let header = output
+        .lines()
+        .find(|l| l.starts_with("PACK"))
+        .unwrap_or_else(|| panic!("missing header row: {output}"));
+    let row = output
+        .lines()
+        .find(|l| l.contains("vimrc"))
+        .unwrap_or_else(|| panic!("missing vimrc row: {output}"));
+    // Columns line up: the FILE header sits over the file cell.
+    assert_eq!(header.find("FILE"), row.find("vimrc"), "output: {output}");
+}
 
-    // All packs pending, so only the Pending banner appears
-    assert!(output.contains("Pending Packs"), "output: {output}");
-    assert!(
-        !output.contains("Deployed Packs"),
-        "no deployed packs — deployed banner should be hidden: {output}"
-    );
-    assert!(
-        !output.contains("Error Packs"),
-        "no error packs — error banner should be hidden: {output}"
-    );
-    // Pack names still render within the group
-    assert!(output.contains("vim"), "output: {output}");
-    assert!(output.contains("nvim"), "output: {output}");
+#[test]
+fn table_mode_shrinks_file_column_to_fit_width() {
+    use crate::commands::{DisplayFile, DisplayPack, DisplayTable};
+
+    let long = "a/very/deeply/nested/path/that/will/not/fit/anywhere.conf";
+    let files = vec![DisplayFile {
+        name: long.into(),
+        symbol: "➞".into(),
+        description: "".into(),
+        status: "deployed".into(),
+        status_label: "deployed".into(),
+        handler: "symlink".into(),
+        note_ref: None,
+        last_run: None,
+    }];
+    let packs = vec![DisplayPack::new("vim".into(), files)];
+
+    let wide = DisplayTable::from_packs(&packs, 200);
+    assert_eq!(wide.rows[0].file, long);
+
+    let narrow = DisplayTable::from_packs(&packs, 60);
+    let w = narrow.widths;
+    assert!(w.pack + w.handler + w.file + w.state + w.last_run + 8 <= 60);
+    // Long paths lose their middle, so the file name survives.
+    assert_eq!(narrow.rows[0].file, "a/very/…/anywhere.conf");
+    assert!(narrow.rows[0].file.chars().count() <= w.file);
+}
+
+#[test]
+fn fitting_shortens_paths_and_wraps_notes() {
+    let env = TempEnvironment::builder()
+        .pack("nvim")
+        .file("init.lua", "x")
+        .done()
+        .build();
+    let ctx = make_ctx(&env);
+    let mut result = commands::status::status(None, &ctx).unwrap();
+    let file = &mut result.packs[0].files[0];
+    file.name = "lua/plugins/telescope/config.lua".into();
+    file.description = "~/.config/nvim/lua/plugins/telescope/config.lua".into();
+    result.notes.push(crate::commands::DisplayNote {
+        body: "the quick brown fox jumps over the lazy dog".into(),
+        hint: None,
+    });
+    result.fit_to_width(30);
+
+    let file = &result.packs[0].files[0];
+    assert_eq!(file.name, "lua/plugins/…/config.lua");
+    assert_eq!(file.description, "~/.config/nvim/…/config.lua");
+    let body = &result.notes.last().unwrap().body;
+    assert!(body.contains("\n      "), "{body}");
+    assert!(body.lines().all(|l| l.chars().count() <= 30), "{body}");
+}
+
+#[test]
+fn by_status_groups_packs_under_banners() {
+    let env = TempEnvironment::builder()
+        .pack("vim")
+        .file("vimrc", "x")
+        .done()
+        .pack("nvim")
+        .file("init.lua", "x")
+        .done()
+        .build();
+
+    let mut ctx = make_ctx(&env);
+    ctx.group_mode = crate::commands::GroupMode::Status;
+    let result = commands::status::status(None, &ctx).unwrap();
+
+    let output = render::render("pack-status", &result, OutputMode::Text).unwrap();
+
+    // All packs pending, so only the Pending banner appears
+    assert!(output.contains("Pending Packs"), "output: {output}");
+    assert!(
+        !output.contains("Deployed Packs"),
+        "no deployed packs — deployed banner should be hidden: {output}"
+    );
+    assert!(
+        !output.contains("Error Packs"),
+        "no error packs — error banner should be hidden: {output}"
+    );
+    // Pack names still render within the group
+    assert!(output.contains("vim"), "output: {output}");
+    assert!(output.contains("nvim"), "output: {output}");
+}
+
+#[test]
+fn run_executes_pack_script_with_dodot_env() {
+    let env = TempEnvironment::builder()
+        .pack("notes")
+        .file("bin/reindex.sh", "echo reindexed")
+        .done()
+        .build();
+    let script = env.dotfiles_root.join("notes/bin/reindex.sh");
+    let runner = Arc::new(CannedRunner::new());
+    runner.respond(
+        &[
+            "env",
+            &format!("DOTFILES_ROOT={}", env.dotfiles_root.display()),
+            "DODOT_PACK=notes",
+            &format!("DODOT_DATA_DIR={}", env.paths.data_dir().display()),
+            "bash",
+            &script.to_string_lossy(),
+            "--full",
+        ],
+        "reindexed\n",
+        0,
+    );
+    let ctx = make_ctx_with_runner(&env, runner);
+
+    let result =
+        commands::run::run("notes", "bin/reindex.sh", &["--full".to_string()], &ctx).unwrap();
+    assert!(result
+        .message
+        .starts_with("Ran bin/reindex.sh from 'notes'"));
+    assert_eq!(result.details, ["reindexed"]);
+    // Nothing recorded: a maintenance script isn't provisioning.
+    assert!(ctx
+        .datastore
+        .list_pack_handlers("notes")
+        .unwrap()
+        .is_empty());
+
+    let escape = commands::run::run("notes", "../other.sh", &[], &ctx);
+    assert!(escape.is_err());
+    let missing = commands::run::run("notes", "nope.sh", &[], &ctx);
+    assert!(missing.unwrap_err().to_string().contains("no script"));
+}
+
+#[test]
+fn provision_honors_brew_lockfile_unless_upgrading() {
+    let env = TempEnvironment::builder()
+        .pack("dev")
+        .file("Brewfile", "brew \"ripgrep\"")
+        .file("Brewfile.lock.json", "{}")
+        .done()
+        .build();
+    let mut ctx = make_ctx(&env);
+    ctx.dry_run = true;
+
+    let pinned = commands::provision::provision(None, false, &ctx).unwrap();
+    assert_eq!(pinned.details.len(), 1, "details: {:?}", pinned.details);
+    assert!(pinned.details[0].ends_with("--no-upgrade"));
+
+    let upgrade = commands::provision::provision(None, true, &ctx).unwrap();
+    assert!(!upgrade.details[0].contains("--no-upgrade"));
+
+    // The lockfile is read in place, never deployed.
+    let status = commands::status::status(None, &ctx).unwrap();
+    let lock = status.packs[0]
+        .files
+        .iter()
+        .find(|f| f.name == "Brewfile.lock.json")
+        .expect("lockfile row");
+    assert_eq!(lock.status, "skipped");
+}
+
+#[test]
+fn provision_status_reports_each_step_from_its_sentinel() {
+    let env = TempEnvironment::builder()
+        .pack("dev")
+        .file("install.sh", "echo hi")
+        .done()
+        .build();
+    let ctx = make_ctx(&env);
+
+    let before = commands::provision::status(None, &ctx).unwrap();
+    assert_eq!(before.message, "0 of 1 provisioning step(s) up to date.");
+    assert_eq!(
+        before.details,
+        vec!["  dev: install.sh (install) — never ran"]
+    );
+
+    commands::up::up(None, &ctx).unwrap();
+    let after = commands::provision::status(None, &ctx).unwrap();
+    assert_eq!(after.message, "1 of 1 provisioning step(s) up to date.");
+    let line = &after.details[0];
+    assert!(
+        line.starts_with("  dev: install.sh (install) — up to date; last ran just now"),
+        "{line}"
+    );
+    assert!(line.contains(", dodot "), "{line}");
+
+    env.fs
+        .write_file(&env.dotfiles_root.join("dev/install.sh"), b"echo bye")
+        .unwrap();
+    let changed = commands::provision::status(None, &ctx).unwrap();
+    assert!(
+        changed.details[0].contains("— changed since its last run; last ran"),
+        "{:?}",
+        changed.details
+    );
+}
+
+#[test]
+fn down_leaves_replaced_user_links_alone() {
+    let env = TempEnvironment::builder()
+        .pack("vim")
+        .file("vimrc", "x")
+        .done()
+        .build();
+    let ctx = make_ctx(&env);
+    commands::up::up(None, &ctx).unwrap();
+
+    // The user swapped dodot's link for a file of their own.
+    let user_path = env.home.join(".config/vim/vimrc");
+    env.fs.remove_file(&user_path).unwrap();
+    env.fs.write_file(&user_path, b"mine").unwrap();
+
+    commands::down::down(None, &ctx).unwrap();
+    env.assert_file_contents(&user_path, "mine");
+}
+
+#[test]
+fn down_deprovision_uninstalls_brewfile_entries() {
+    let env = TempEnvironment::builder()
+        .pack("dev")
+        .file("Brewfile", "brew \"ripgrep\"\ncask \"kitty\"")
+        .done()
+        .build();
+    let brewfile = env.dotfiles_root.join("dev/Brewfile");
+    let brewfile = brewfile.to_str().unwrap();
+    let runner = CannedRunner::new();
+    runner.respond(&["brew", "bundle", "--file", brewfile], "", 0);
+    runner.respond(
+        &["brew", "bundle", "list", "--file", brewfile, "--formula"],
+        "ripgrep\n",
+        0,
+    );
+    runner.respond(
+        &["brew", "bundle", "list", "--file", brewfile, "--cask"],
+        "kitty\n",
+        0,
+    );
+    let mut ctx = make_ctx_with_runner(&env, Arc::new(runner));
+    ctx.no_provision = false;
+    commands::up::up(None, &ctx).unwrap();
+
+    // Plain `down` only forgets the sentinel.
+    ctx.dry_run = true;
+    let plain = commands::down::down(None, &ctx).unwrap();
+    assert!(plain.packs[0]
+        .files
+        .iter()
+        .all(|f| f.status_label != "[dry-run] would run"));
+
+    let options = commands::down::DownOptions { deprovision: true };
+    let preview = commands::down::down_with(None, options, &ctx).unwrap();
+    let names: Vec<&str> = preview.packs[0]
+        .files
+        .iter()
+        .filter(|f| f.status_label == "[dry-run] would run")
+        .map(|f| f.name.as_str())
+        .collect();
+    assert_eq!(
+        names,
+        [
+            "run brew uninstall --formula ripgrep",
+            "run brew uninstall --cask kitty"
+        ]
+    );
+}
+
+#[test]
+fn disable_keeps_provisioning_and_enable_restores_without_rerunning() {
+    let env = TempEnvironment::builder()
+        .pack("vpn")
+        .file("vpnrc", "remote work")
+        .file("aliases.sh", "alias vpn=openvpn")
+        .file("install.sh", "#!/bin/sh\necho hi")
+        .done()
+        .build();
+    let mut ctx = make_ctx(&env);
+    ctx.no_provision = false;
+    commands::up::up(None, &ctx).unwrap();
+
+    let link = env.home.join(".vpnrc");
+    let install_dir = env.paths.handler_data_dir("vpn", "install");
+    let sentinels = env.list_dir_names(&install_dir);
+    assert!(env.fs.is_symlink(&link));
+
+    let result = commands::disable::disable(&["vpn".into()], &ctx).unwrap();
+    assert!(
+        result.message.starts_with("Disabled 1 pack(s)"),
+        "{result:?}"
+    );
+    assert!(!env.fs.is_symlink(&link));
+    assert!(!env.fs.exists(&env.paths.handler_data_dir("vpn", "shell")));
+    let init = env
+        .fs
+        .read_to_string(&env.paths.init_script_path())
+        .unwrap();
+    assert!(!init.contains("aliases.sh"), "{init}");
+    assert_eq!(env.list_dir_names(&install_dir), sentinels);
+
+    let status = commands::status::status(None, &ctx).unwrap();
+    assert!(status.packs[0].disabled);
+    let up = commands::up::up(None, &ctx).unwrap();
+    assert!(
+        up.warnings.iter().any(|w| w.contains("'vpn' is disabled")),
+        "{:?}",
+        up.warnings
+    );
+    assert!(!env.fs.is_symlink(&link), "up leaves a disabled pack off");
+
+    let result = commands::disable::enable(&["vpn".into()], &ctx).unwrap();
+    assert_eq!(result.message, "Enabled 1 pack(s).");
+    env.assert_file_contents(&link, "remote work");
+    let init = env
+        .fs
+        .read_to_string(&env.paths.init_script_path())
+        .unwrap();
+    assert!(init.contains("aliases.sh"), "{init}");
+    assert_eq!(env.list_dir_names(&install_dir), sentinels);
+    assert!(!commands::status::status(None, &ctx).unwrap().packs[0].disabled);
+}
+
+#[test]
+fn plan_previews_up_and_apply_refuses_a_stale_plan() {
+    use commands::plan::ChangeKind;
+
+    let env = TempEnvironment::builder()
+        .pack("vim")
+        .file("vimrc", "set nocompatible")
+        .file("gvimrc", "set guifont=Mono")
+        .file("aliases.sh", "alias v=vim")
+        .done()
+        .build();
+    let ctx = make_ctx(&env);
+
+    let plan = commands::plan::plan(None, &ctx).unwrap();
+    let kinds: Vec<(ChangeKind, &str)> = plan.packs[0]
+        .changes
+        .iter()
+        .map(|c| (c.kind, c.name.as_str()))
+        .collect();
+    assert_eq!(kinds.len(), 3, "{kinds:?}");
+    assert!(kinds.iter().all(|(k, _)| *k == ChangeKind::Add));
+    assert_eq!(plan.summary(), "3 to add, 0 to change, 0 to remove");
+    env.assert_not_exists(&env.home.join(".vimrc"));
+
+    // Round-trips through a file, and an untouched plan applies.
+    let file = env.home.join("dodot.plan");
+    commands::plan::save(env.fs.as_ref(), &file, &plan).unwrap();
+    let saved = commands::plan::load(env.fs.as_ref(), &file).unwrap();
+    assert_eq!(saved, plan);
+    commands::plan::apply(&saved, &ctx).unwrap();
+    env.assert_exists(&env.home.join(".vimrc"));
+    assert_eq!(
+        commands::plan::plan(None, &ctx).unwrap().summary(),
+        "0 to add, 0 to change, 0 to remove"
+    );
+
+    // A source leaving the pack is planned as a removal; editing the
+    // pack after planning makes the saved plan stale.
+    env.fs
+        .remove_file(&env.dotfiles_root.join("vim/gvimrc"))
+        .unwrap();
+    let plan = commands::plan::plan(None, &ctx).unwrap();
+    let removed: Vec<&str> = plan.packs[0]
+        .changes
+        .iter()
+        .filter(|c| c.kind == ChangeKind::Remove)
+        .map(|c| c.name.as_str())
+        .collect();
+    assert_eq!(removed, vec!["gvimrc"]);
+    env.fs
+        .write_file(&env.dotfiles_root.join("vim/vimrc"), b"set number")
+        .unwrap();
+    let err = commands::plan::apply(&plan, &ctx).unwrap_err().to_string();
+    assert!(err.contains("pack `vim` was edited"), "{err}");
+}
+
+#[test]
+fn per_host_state_keeps_hosts_apart_and_flags_links_from_another_host() {
+    let env = TempEnvironment::builder()
+        .pack("vim")
+        .file("vimrc", "set nocompatible")
+        .done()
+        .build();
+    let on_host = |host: &str| {
+        let paths: Arc<dyn Pather> = Arc::new(
+            crate::paths::XdgPather::builder()
+                .home(&env.home)
+                .dotfiles_root(&env.dotfiles_root)
+                .data_dir(env.paths.data_dir())
+                .config_dir(env.paths.config_dir())
+                .cache_dir(env.paths.cache_dir())
+                .xdg_config_home(env.paths.xdg_config_home())
+                .app_support_dir(env.paths.app_support_dir())
+                .host(host)
+                .build()
+                .unwrap(),
+        );
+        let mut ctx = make_ctx(&env);
+        ctx.datastore = Arc::new(FilesystemDataStore::new(
+            env.fs.clone(),
+            paths.clone(),
+            ctx.command_runner.clone(),
+        ));
+        ctx.paths = paths;
+        ctx
+    };
+    let vimrc_row = |ctx: &ExecutionContext| {
+        let result = commands::status::status(None, ctx).unwrap();
+        let file = result.packs[0]
+            .files
+            .iter()
+            .find(|f| f.name == "vimrc")
+            .unwrap()
+            .clone();
+        let note = file
+            .note_ref
+            .map(|n| result.notes[n as usize - 1].body.clone());
+        (file.status, file.status_label, note)
+    };
+
+    let laptop = on_host("laptop");
+    let desktop = on_host("desktop");
+    commands::up::up(None, &laptop).unwrap();
+    assert!(env
+        .fs
+        .exists(&env.paths.data_dir().join("hosts/laptop/packs/vim/symlink")));
+    assert_eq!(vimrc_row(&laptop).0, "deployed");
+
+    // The other host has no state of its own yet, and sees the link.
+    let (status, _, note) = vimrc_row(&desktop);
+    assert_eq!(status, "warning");
+    assert!(note.unwrap().contains("linked by host `laptop`"));
+
+    commands::up::up(None, &desktop).unwrap();
+    let (status, label, _) = vimrc_row(&laptop);
+    assert_eq!(status, "stale");
+    assert!(label.contains("linked by host `desktop`"), "{label}");
+}
+
+// ── template variables ─────────────────────────────────────
+
+#[test]
+fn missing_template_vars_are_listed_then_answered_once() {
+    let env = TempEnvironment::builder()
+        .pack("vim")
+        .file("vimrc.tmpl", "\" {{ name }} <{{ data.git.email }}>\n")
+        .done()
+        .pack("zsh")
+        .file("zshrc.tmpl", "export NAME={{ name }}\n")
+        .done()
+        .build();
+    let ctx = make_ctx(&env);
+
+    let missing = commands::template_vars::missing(None, &ctx).unwrap();
+    let keys: Vec<&str> = missing.iter().map(|m| m.key.as_str()).collect();
+    assert_eq!(keys, ["data.git.email", "name"]);
+    assert_eq!(missing[1].templates, ["vim/vimrc.tmpl", "zsh/zshrc.tmpl"]);
+    let err = commands::template_vars::missing_error(&missing);
+    assert_eq!(err.code(), Some("TMPL004"));
+    assert!(err
+        .to_string()
+        .contains("name (vim/vimrc.tmpl, zsh/zshrc.tmpl)"));
+
+    commands::template_vars::record(
+        &[
+            ("data.git.email".into(), "ada@example.com".into()),
+            ("name".into(), "Ada".into()),
+        ],
+        &ctx,
+    )
+    .unwrap();
+    assert!(commands::template_vars::missing(None, &ctx)
+        .unwrap()
+        .is_empty());
+
+    commands::up::up(None, &ctx).unwrap();
+    let rendered = env
+        .fs
+        .read_to_string(&env.home.join(".config/vim/vimrc"))
+        .unwrap();
+    assert_eq!(rendered, "\" Ada <ada@example.com>\n");
+}
+
+#[test]
+fn template_check_lists_variables_and_flags_broken_templates() {
+    let env = TempEnvironment::builder()
+        .pack("git")
+        .file(
+            "gitconfig.tmpl",
+            "[user]\n  name = {{ name }}\n  email = {{ email }}\n",
+        )
+        .file("ignore.tmpl", "{{ extra | default('') }}\n")
+        .config("[preprocessor.template.vars]\nname = \"Ada\"\n")
+        .done()
+        .pack("zsh")
+        .file("zshrc.tmpl", "export A=1\n{% for x in %}\n")
+        .done()
+        .build();
+    let ctx = make_ctx(&env);
+
+    let result = commands::template_check::check(None, &ctx).unwrap();
+    let names: Vec<&str> = result
+        .templates
+        .iter()
+        .map(|t| t.template.as_str())
+        .collect();
+    assert_eq!(
+        names,
+        ["git/gitconfig.tmpl", "git/ignore.tmpl", "zsh/zshrc.tmpl"]
+    );
+    let gitconfig = &result.templates[0];
+    assert_eq!(gitconfig.missing, ["email"]);
+    assert_eq!(gitconfig.variables.len(), 2);
+    assert!(result.templates[1].missing.is_empty());
+    let problem = result.templates[2].problem.as_ref().unwrap();
+    assert_eq!(problem.line, Some(2));
+    assert_eq!((result.broken_count, result.incomplete_count), (1, 1));
+    assert_eq!(result.exit_code(), 1);
+
+    let git = ["git".to_string()];
+    let mut ctx = ctx;
+    ctx.template_vars = [("email".to_string(), "ada@example.com".to_string())].into();
+    let result = commands::template_check::check(Some(&git), &ctx).unwrap();
+    assert_eq!(result.templates.len(), 2);
+    assert_eq!(result.exit_code(), 0);
+}
+
+#[test]
+fn one_shot_vars_render_but_are_never_saved() {
+    let env = TempEnvironment::builder()
+        .pack("gh")
+        .file("hosts.yml.tmpl", "oauth_token: {{ token }}\n")
+        .config("[preprocessor.template.vars]\ntoken = \"from-config\"\n")
+        .done()
+        .build();
+    let mut ctx = make_ctx(&env);
+    ctx.template_vars = crate::preprocessing::template::invocation::invocation_vars(
+        &["token=s3cret".to_string()],
+        None,
+    )
+    .unwrap();
+
+    assert!(commands::template_vars::missing(None, &ctx)
+        .unwrap()
+        .is_empty());
+    commands::up::up(None, &ctx).unwrap();
+    let rendered = env
+        .fs
+        .read_to_string(&env.home.join(".config/gh/hosts.yml"))
+        .unwrap();
+    assert_eq!(rendered, "oauth_token: s3cret\n");
+    assert!(!env.fs.exists(&env.paths.host_vars_path()));
+}
+
+#[test]
+fn no_write_home_stages_links_but_leaves_home_alone() {
+    let env = TempEnvironment::builder()
+        .pack("vim")
+        .file("vimrc", "set nocompatible")
+        .file("aliases.sh", "alias v=vim")
+        .done()
+        .build();
+    let mut ctx = make_ctx(&env);
+    ctx.fs = Arc::new(crate::fs::HomeGuardFs::new(
+        ctx.fs.clone(),
+        ctx.paths.as_ref(),
+    ));
+
+    commands::up::up(None, &ctx).unwrap();
+
+    assert!(!env.fs.exists(&env.home.join(".config/vim/vimrc")));
+    assert!(env.fs.is_dir(&ctx.paths.handler_data_dir("vim", "symlink")));
+    let init = env
+        .fs
+        .read_to_string(&ctx.paths.init_script_path())
+        .unwrap();
+    assert!(init.contains("aliases.sh"), "{init}");
+}
+
+#[test]
+fn up_and_down_report_how_the_run_ended() {
+    let env = TempEnvironment::builder()
+        .pack("vim")
+        .file("home.vimrc", "set nocompatible")
+        .done()
+        .home_file(".vimrc", "mine")
+        .build();
+
+    let mut ctx = make_ctx(&env);
+    let up = commands::up::up(None, &ctx).unwrap();
+    assert_eq!(up.exit_code, crate::ExitCode::Conflict, "{:?}", up.actions);
+
+    ctx.force = true;
+    let up = commands::up::up(None, &ctx).unwrap();
+    assert_eq!(up.exit_code, crate::ExitCode::Success);
+
+    let down = commands::down::down(None, &ctx).unwrap();
+    assert_eq!(down.exit_code, crate::ExitCode::Success);
+    let down = commands::down::down(None, &ctx).unwrap();
+    assert_eq!(down.exit_code, crate::ExitCode::NothingToDo);
+}
+
+#[test]
+fn generator_templates_render_into_the_pack_and_match_rules() {
+    let env = TempEnvironment::builder()
+        .pack("sh")
+        .file("aliases.sh.tmpl", "alias h='echo {{ greeting }}'\n")
+        .file(
+            ".dodot.toml",
+            "[preprocessor.template]\ngenerate = [\"aliases.sh.tmpl\"]\n\n\
+             [preprocessor.template.vars]\ngreeting = \"hi\"\n",
+        )
+        .done()
+        .build();
+    let output = env.dotfiles_root.join("sh/aliases.sh");
+
+    let ctx = make_ctx(&env);
+    let up = commands::up::up(None, &ctx).unwrap();
+    assert_eq!(up.exit_code, crate::ExitCode::Success, "{:?}", up.notes);
+    assert_eq!(
+        env.fs.read_to_string(&output).unwrap(),
+        "alias h='echo hi'\n"
+    );
+    let rows: Vec<(&str, &str)> = up.packs[0]
+        .files
+        .iter()
+        .map(|f| (f.name.as_str(), f.handler.as_str()))
+        .collect();
+    assert!(rows.contains(&("aliases.sh", "shell")), "{rows:?}");
+
+    // Status sees the output the run left, without rendering.
+    let status = commands::status::status(None, &ctx).unwrap();
+    assert_eq!(
+        status.packs[0].files.len(),
+        1,
+        "{:?}",
+        status.packs[0].files
+    );
+
+    // An edit to the output is not overwritten.
+    env.fs.write_file(&output, b"alias h=mine\n").unwrap();
+    let up = commands::up::up(None, &ctx).unwrap();
+    assert_eq!(up.exit_code, crate::ExitCode::Partial);
+    assert_eq!(env.fs.read_to_string(&output).unwrap(), "alias h=mine\n");
+}
+
+#[test]
+fn up_notifies_when_the_run_ends() {
+    struct Record(std::sync::Mutex<Vec<String>>);
+    impl CommandRunner for Record {
+        fn run(&self, exe: &str, args: &[String]) -> Result<CommandOutput> {
+            self.0
+                .lock()
+                .unwrap()
+                .push(format!("{exe} {}", args.join(" ")));
+            Ok(CommandOutput {
+                exit_code: 0,
+                stdout: String::new(),
+                stderr: String::new(),
+            })
+        }
+    }
+
+    let env = TempEnvironment::builder()
+        .pack("vim")
+        .file("vimrc", "x")
+        .done()
+        .build();
+    env.fs
+        .write_file(
+            &env.dotfiles_root.join(".dodot.toml"),
+            b"[notify]\ndesktop = true\nmin_seconds = 0\n",
+        )
+        .unwrap();
+    let runner = Arc::new(Record(std::sync::Mutex::new(Vec::new())));
+    let mut ctx = make_ctx_with_runner(&env, runner.clone());
+
+    ctx.dry_run = true;
+    commands::up::up(None, &ctx).unwrap();
+    assert!(runner.0.lock().unwrap().is_empty(), "dry runs stay quiet");
+
+    ctx.dry_run = false;
+    commands::up::up(None, &ctx).unwrap();
+    let calls = runner.0.lock().unwrap();
+    let notice = calls
+        .iter()
+        .find(|c| c.contains("dodot up finished"))
+        .unwrap_or_else(|| panic!("no notification in {calls:?}"));
+    assert!(notice.contains("Packs deployed."), "{notice}");
 }
@@ -2,9 +2,9 @@
 //!
 //! Holds the mock `CommandRunner` impls and the `make_ctx` /
 //! `make_ctx_with_runner` builders that every per-command test module
-//! reaches for. Visibility is `pub(super)` so other test files within
-//! the `tests/` directory can reuse them without exposing the helpers
-//! to the broader crate.
+//! reaches for. `make_ctx` is `pub(crate)` so the [`crate::api`]
+//! facade tests can build a context too; everything else stays
+//! `pub(super)` to the `tests/` directory.
 
 use std::sync::Arc;
 
@@ -68,7 +68,7 @@ impl CommandRunner for CannedRunner {
     }
 }
 
-pub(super) fn make_ctx(env: &TempEnvironment) -> ExecutionContext {
+pub(crate) fn make_ctx(env: &TempEnvironment) -> ExecutionContext {
     let runner: Arc<dyn CommandRunner> = Arc::new(MockCommandRunner);
     let datastore = Arc::new(FilesystemDataStore::new(
         env.fs.clone(),
@@ -90,8 +90,12 @@ pub(super) fn make_ctx(env: &TempEnvironment) -> ExecutionContext {
         force: false,
         check_drift: false,
         show_diff: false,
+        lint: Default::default(),
+        template_vars: Default::default(),
+        file_filter: Default::default(),
         view_mode: crate::commands::ViewMode::Full,
         group_mode: crate::commands::GroupMode::Name,
+        render_verbosity: crate::commands::RenderVerbosity::Normal,
         verbose: false,
         host_facts: Arc::new(crate::gates::HostFacts::detect()),
     }
@@ -123,8 +127,12 @@ pub(super) fn make_ctx_with_runner(
         force: false,
         check_drift: false,
         show_diff: false,
+        lint: Default::default(),
+        template_vars: Default::default(),
+        file_filter: Default::default(),
         view_mode: crate::commands::ViewMode::Full,
         group_mode: crate::commands::GroupMode::Name,
+        render_verbosity: crate::commands::RenderVerbosity::Normal,
         verbose: false,
         host_facts: Arc::new(crate::gates::HostFacts::detect()),
     }
@@ -48,8 +48,12 @@ pub(super) fn make_ctx(env: &TempEnvironment) -> ExecutionContext {
         force: false,
         check_drift: false,
         show_diff: false,
+        lint: Default::default(),
+        template_vars: Default::default(),
+        file_filter: Default::default(),
         view_mode: crate::commands::ViewMode::Full,
         group_mode: crate::commands::GroupMode::Name,
+        render_verbosity: crate::commands::RenderVerbosity::Normal,
         verbose: false,
         host_facts: Arc::new(crate::gates::HostFacts::detect()),
     }
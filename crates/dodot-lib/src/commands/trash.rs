@@ -0,0 +1,119 @@
+//! `dodot trash` (alias `dodot backups`) — inspect, restore and prune
+//! the user files `--force` replaced. Storage lives in
+//! [`crate::trash`]; these wrap it for the CLI.
+
+use serde::Serialize;
+
+use crate::commands::probe::format_unix_ts;
+use crate::commands::MessageResult;
+use crate::handlers::symlink::guard::human_size;
+use crate::packs::orchestration::ExecutionContext;
+use crate::trash::{self, TrashEntry};
+use crate::Result;
+
+/// `dodot trash list`. `message` / `details` feed the `message`
+/// template; `entries` is the full record for `--output json`.
+#[derive(Debug, Clone, Serialize)]
+pub struct TrashListResult {
+    pub message: String,
+    pub details: Vec<String>,
+    pub entries: Vec<TrashEntry>,
+}
+
+/// List trashed items, newest first.
+pub fn list(ctx: &ExecutionContext) -> Result<TrashListResult> {
+    let entries = trash::list(ctx.fs.as_ref(), ctx.paths.as_ref())?;
+    let message = if entries.is_empty() {
+        "Trash is empty.".to_string()
+    } else {
+        format!(
+            "{} item(s), {} in {}; restore with `dodot trash restore <id>`.",
+            entries.len(),
+            human_size(trash::disk_usage(ctx.fs.as_ref(), ctx.paths.as_ref())),
+            ctx.paths.trash_dir().display()
+        )
+    };
+    let details = entries
+        .iter()
+        .map(|e| {
+            format!(
+                "{}  {}  {}  ({})",
+                e.id,
+                format_unix_ts(e.trashed_at),
+                e.original_path.display(),
+                e.pack
+            )
+        })
+        .collect();
+    Ok(TrashListResult {
+        message,
+        details,
+        entries,
+    })
+}
+
+/// Put trash entry `id` back where it was. The dodot symlink that
+/// replaced it, if still there, is removed; the pack keeps reporting
+/// the target as a conflict until the file is dealt with.
+pub fn restore(id: &str, ctx: &ExecutionContext) -> Result<MessageResult> {
+    if ctx.dry_run {
+        return Ok(MessageResult {
+            message: format!("[dry-run] would restore `{id}`."),
+            details: Vec::new(),
+        });
+    }
+    let entry = trash::restore(ctx.fs.as_ref(), ctx.paths.as_ref(), id)?;
+    Ok(MessageResult {
+        message: format!("Restored {}.", entry.original_path.display()),
+        details: vec![format!(
+            "`dodot status {}` now shows it as a conflict; `dodot up --force {}` replaces it again.",
+            entry.pack, entry.pack
+        )],
+    })
+}
+
+/// Seconds in a day, for `--older-than`.
+const DAY_SECS: u64 = 24 * 60 * 60;
+
+/// Drop trash entries older than `older_than_days` (when given) and
+/// duplicates of newer entries, then the stored contents nothing
+/// refers to any more.
+pub fn prune(older_than_days: Option<u64>, ctx: &ExecutionContext) -> Result<MessageResult> {
+    let cutoff = older_than_days.map(|days| {
+        std::time::SystemTime::now()
+            .duration_since(std::time::UNIX_EPOCH)
+            .map(|d| d.as_secs())
+            .unwrap_or(0)
+            .saturating_sub(days.saturating_mul(DAY_SECS))
+    });
+    let report = trash::prune(ctx.fs.as_ref(), ctx.paths.as_ref(), cutoff, ctx.dry_run)?;
+    if report.entries.is_empty() && report.objects == 0 {
+        return Ok(MessageResult {
+            message: "Nothing to prune.".into(),
+            details: Vec::new(),
+        });
+    }
+    let verb = if ctx.dry_run {
+        "[dry-run] would remove"
+    } else {
+        "Removed"
+    };
+    Ok(MessageResult {
+        message: format!(
+            "{verb} {} entr{} and {} stored file(s), {}.",
+            report.entries.len(),
+            if report.entries.len() == 1 {
+                "y"
+            } else {
+                "ies"
+            },
+            report.objects,
+            human_size(report.bytes)
+        ),
+        details: report
+            .entries
+            .iter()
+            .map(|e| format!("{}  {}", e.id, e.original_path.display()))
+            .collect(),
+    })
+}
@@ -138,10 +138,10 @@ pub struct TutorialPack {
 /// has `recommended = true`.
 pub fn discover_and_classify(ctx: &ExecutionContext) -> Result<Vec<TutorialPack>> {
     let root_config = ctx.config_manager.root_config()?;
-    let scanned = packs::scan_packs(
+    let scanned = packs::scan_root(
         ctx.fs.as_ref(),
         ctx.paths.dotfiles_root(),
-        &root_config.pack.ignore,
+        &root_config.pack,
     )?;
 
     let mut entries: Vec<(String, PackKind, packs::Pack)> = scanned
@@ -211,7 +211,7 @@ pub fn detect_shell_integration(home: &Path) -> ShellIntegration {
     let rc_path_abs = home.join(rc_rel);
     let display = format!("~/{rc_rel}");
     let eval_line = if kind == "fish" {
-        "dodot init-sh | source".to_string()
+        "dodot init-sh --fish | source".to_string()
     } else {
         r#"eval "$(dodot init-sh)""#.to_string()
     };
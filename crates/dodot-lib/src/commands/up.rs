@@ -2,12 +2,19 @@
 //!
 //! Uses a two-phase execution model:
 //! 1. **Collect** intents from all packs (no mutations).
-//! 2. **Detect** cross-pack conflicts across all collected intents.
-//! 3. **Execute** only if no conflicts are found.
+//! 2. **Detect** cross-pack conflicts across all collected intents,
+//!    then run the [`preflight`](orchestration::preflight) checks
+//!    (writable targets, disk space, installed tools).
+//! 3. **Execute** only if no conflicts or pre-flight problems are found.
 //!
 //! This prevents partial deployments where one pack silently overwrites
 //! another pack's symlinks.
 //!
+//! Execution runs stage by stage across all packs (pre-provision,
+//! provision, link, post-link — see [`orchestration::schedule`]), so
+//! every pack is provisioned before any pack links, and packs whose
+//! handlers allow it provision in parallel.
+//!
 //! ## Output rendering
 //!
 //! For non-dry-run executions, `up` renders by calling `status::status()`
@@ -24,18 +31,19 @@ use std::collections::HashMap;
 use tracing::{debug, info};
 
 use crate::commands::{
-    handler_description, handler_symbol, status, status_style, DisplayConflict, DisplayFile,
-    DisplayNote, DisplayPack, PackStatusResult,
+    action_lines, handler_description, handler_symbol, phase_sections, status, status_style,
+    summary_line, DisplayConflict, DisplayFile, DisplayNote, DisplayPack, PackStatusResult,
 };
 use crate::conflicts;
 use crate::datastore::format_command_for_display;
 use crate::handlers;
 use crate::operations::HandlerIntent;
-use crate::packs::orchestration::{self, ExecutionContext, PackResult};
+use crate::packs::orchestration::{self, schedule, ExecutionContext, PackResult};
 use crate::packs::Pack;
 use crate::probe;
 use crate::shell;
-use crate::Result;
+use crate::verify;
+use crate::{ExitCode, Result};
 
 /// Run the `up` command: deploy packs and regenerate shell init.
 ///
@@ -44,7 +52,36 @@ use crate::Result;
 /// deployed and a `CrossPackConflict` error is returned — even if
 /// `--force` is set, because cross-pack conflicts are a configuration
 /// problem, not a deployment problem.
+///
+/// When the run ends, `[notify]` hears about it (see [`crate::notify`]).
 pub fn up(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<PackStatusResult> {
+    let started = std::time::Instant::now();
+    let result = deploy(pack_filter, ctx, started);
+    crate::notify::run_finished(
+        "up",
+        started,
+        &result,
+        |r| {
+            let success = r.packs.iter().all(|p| p.summary_status != "error");
+            let message = r.message.as_deref().unwrap_or_default();
+            (success, format!("{message} {}", r.summary))
+        },
+        ctx,
+    );
+    result
+}
+
+fn deploy(
+    pack_filter: Option<&[String]>,
+    ctx: &ExecutionContext,
+    started: std::time::Instant,
+) -> Result<PackStatusResult> {
+    // Globs and `[groups]` names become concrete pack names here, so
+    // everything below only ever sees exact names.
+    let expanded = pack_filter
+        .map(|names| orchestration::expand_pack_selectors(names, ctx))
+        .transpose()?;
+    let pack_filter = expanded.as_deref();
     info!(
         dry_run = ctx.dry_run,
         force = ctx.force,
@@ -59,6 +96,11 @@ pub fn up(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<Pack
         Some(names) => orchestration::validate_pack_names(names, ctx)?,
         None => Vec::new(),
     };
+    // Leftovers from an interrupted earlier run: stray temp files and
+    // truncated generated files. Reported so the crash isn't silent.
+    if !ctx.dry_run {
+        planning_warnings.extend(orchestration::repair_generated_files(ctx)?);
+    }
 
     // Discover `.dodotignore`-marked packs so we can both report them in
     // the same "Ignored Packs" section `status` shows and sweep any
@@ -67,8 +109,13 @@ pub fn up(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<Pack
     // regenerated init script. (issue #222)
     let ignored = orchestration::scan_ignored(pack_filter, ctx)?;
 
-    // Phase 1: Discover packs and collect intents
-    let packs = orchestration::prepare_packs(pack_filter, ctx)?;
+    // Phase 1: Discover packs and collect intents. Pinned packs keep
+    // whatever the last run left them with; disabled ones stay off
+    // until `dodot enable`.
+    let mut packs = orchestration::prepare_packs(pack_filter, ctx)?;
+    planning_warnings.extend(orchestration::drop_pinned(&mut packs, ctx)?);
+    planning_warnings.extend(orchestration::drop_disabled(&mut packs, ctx)?);
+    planning_warnings.extend(orchestration::drop_incompatible(&mut packs, ctx)?);
 
     // Preflight secret providers once per active run. Skipped on
     // `--dry-run` because the Passive envelope (`secrets.lex` §7.4) is
@@ -129,6 +176,32 @@ pub fn up(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<Pack
     }
     debug!("no cross-pack conflicts");
 
+    // Pre-flight: everything that would stop the run halfway (a
+    // read-only target dir, a full disk, a missing `brew`) is reported
+    // together, before anything changes. A dry run lists the problems
+    // alongside the plan instead.
+    let problems = orchestration::preflight::check(&pack_intents, ctx);
+    if !problems.is_empty() {
+        info!(count = problems.len(), "pre-flight checks failed");
+        if !ctx.dry_run {
+            return Err(crate::DodotError::PreflightFailed { problems });
+        }
+        planning_warnings.extend(problems.into_iter().map(|p| format!("pre-flight: {p}")));
+    }
+
+    // Opt-in shellcheck pass (`--lint`, `[lint] enabled`). Findings are
+    // warnings; a strict run stops on them here, before anything
+    // changes, like a failed pre-flight check.
+    planning_warnings.extend(shell::lint::run(
+        &pack_intents,
+        ctx.lint,
+        &ctx.config_manager.root_config()?.lint,
+        ctx.fs.as_ref(),
+        ctx.command_runner.as_ref(),
+        ctx.paths.dotfiles_root(),
+        ctx.dry_run,
+    )?);
+
     // Phase 3: Reconcile non-provisioning state, then execute intents.
     //
     // For configuration handlers (path, shell, symlink), every `up` is
@@ -143,8 +216,12 @@ pub fn up(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<Pack
     // independently of whether the source still exists right now;
     // wiping them would force install scripts and `brew bundle` to
     // re-execute on every up, defeating the sentinel mechanism.
+    //
+    // With `--only` / `--skip` the run deploys part of each pack, so
+    // nothing is wiped: the files it leaves out keep whatever an
+    // earlier `up` deployed for them.
     let mut pack_results: Vec<PackResult> = intent_errors;
-    let config_handlers = if ctx.dry_run {
+    let config_handlers = if ctx.dry_run || ctx.file_filter.is_active() {
         Vec::new()
     } else {
         handlers::configuration_handler_names(ctx.fs.as_ref())
@@ -154,9 +231,15 @@ pub fn up(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<Pack
     // missing-pack case a bug rather than silent skip.
     let pack_by_display: HashMap<&str, &Pack> =
         packs.iter().map(|p| (p.display_name.as_str(), p)).collect();
+    // Packs whose intents executed, for the `[pack] verify` pass once
+    // the generated files are current.
+    let mut executed: Vec<&Pack> = Vec::new();
 
+    // Reconcile every pack before any stage runs, so a pack whose
+    // reconcile fails sits the whole run out.
+    let mut runnable: Vec<(String, Vec<HandlerIntent>)> = Vec::with_capacity(pack_intents.len());
     for (pack_name, intents) in pack_intents {
-        info!(pack = %pack_name, intents = intents.len(), "executing pack");
+        info!(pack = %pack_name, intents = intents.len(), "scheduling pack");
 
         if !ctx.dry_run {
             let pack = pack_by_display
@@ -174,31 +257,66 @@ pub fn up(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<Pack
                 continue;
             }
         }
+        runnable.push((pack_name, intents));
+    }
 
-        match orchestration::execute_intents(intents, ctx) {
-            Ok(operations) => {
-                let success = operations.iter().all(|r| r.success);
-                let succeeded = operations.iter().filter(|o| o.success).count();
-                let failed = operations.iter().filter(|o| !o.success).count();
-                debug!(pack = %pack_name, succeeded, failed, "pack execution complete");
-                pack_results.push(PackResult {
-                    pack_name,
-                    success,
-                    operations,
-                    error: None,
-                });
-            }
-            Err(e) => {
-                info!(pack = %pack_name, error = %e, "pack execution failed");
-                pack_results.push(PackResult {
-                    pack_name,
-                    success: false,
-                    operations: Vec::new(),
-                    error: Some(format!("execution error: {e}")),
-                });
+    // Stage by stage across all packs; see `orchestration::schedule`.
+    let traits = schedule::handler_traits(ctx.fs.as_ref());
+    let settings = orchestration::ExecutorSettings::from_ctx(ctx)?;
+    // What the dry run would cost for real, summed up under the plan.
+    let estimate = ctx
+        .dry_run
+        .then(|| settings.estimate(runnable.iter().flat_map(|(_, intents)| intents)))
+        .filter(|e| !e.is_empty());
+    let order: Vec<String> = runnable.iter().map(|(name, _)| name.clone()).collect();
+    let mut operations: HashMap<String, Vec<crate::operations::OperationResult>> = order
+        .iter()
+        .map(|name| (name.clone(), Vec::new()))
+        .collect();
+    let mut errors: HashMap<String, String> = HashMap::new();
+    for (stage, work) in schedule::split_by_stage(runnable, &traits) {
+        let work = work
+            .into_iter()
+            .filter(|w| !errors.contains_key(&w.pack))
+            .collect();
+        for (pack_name, result) in schedule::run_stage(stage, work, &traits, &settings) {
+            match result {
+                Ok(ops) => operations
+                    .get_mut(&pack_name)
+                    .expect("every scheduled pack has an entry")
+                    .extend(ops),
+                Err(e) => {
+                    info!(pack = %pack_name, stage = stage.label(), error = %e, "pack execution failed");
+                    errors.insert(pack_name, format!("execution error: {e}"));
+                }
             }
         }
     }
+    for pack_name in order {
+        let operations = operations.remove(&pack_name).unwrap_or_default();
+        if let Some(error) = errors.remove(&pack_name) {
+            pack_results.push(PackResult {
+                pack_name,
+                success: false,
+                operations,
+                error: Some(error),
+            });
+            continue;
+        }
+        let success = operations.iter().all(|r| r.success);
+        let succeeded = operations.iter().filter(|o| o.success).count();
+        let failed = operations.iter().filter(|o| !o.success).count();
+        debug!(pack = %pack_name, succeeded, failed, "pack execution complete");
+        if let Some(pack) = pack_by_display.get(pack_name.as_str()) {
+            executed.push(pack);
+        }
+        pack_results.push(PackResult {
+            pack_name,
+            success,
+            operations,
+            error: None,
+        });
+    }
 
     // Regenerate shell init script and deployment map
     if !ctx.dry_run {
@@ -209,11 +327,30 @@ pub fn up(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<Pack
         orchestration::sweep_ignored_state(&ignored.sweep_dir_names, ctx)?;
         info!("regenerating shell init script");
         let root_config = ctx.config_manager.root_config()?;
+        let path_priorities = orchestration::path_priorities(ctx)?;
         shell::write_init_script(
             ctx.fs.as_ref(),
             ctx.paths.as_ref(),
             root_config.profiling.enabled,
+            &path_priorities,
         )?;
+        shell::write_path_exports(
+            ctx.fs.as_ref(),
+            ctx.paths.as_ref(),
+            &path_priorities,
+            root_config.path.shims,
+        )?;
+        if ctx.fs.write_refused(ctx.paths.home_dir()) {
+            let fragments =
+                handlers::gitconfig::staged_fragments(ctx.fs.as_ref(), ctx.paths.as_ref())?;
+            if !fragments.is_empty() {
+                planning_warnings
+                    .push("--no-write-home: the git config include block was not written".into());
+            }
+        } else {
+            info!("updating git config includes");
+            handlers::gitconfig::write_includes(ctx.fs.as_ref(), ctx.paths.as_ref())?;
+        }
         info!("writing deployment map");
         probe::write_deployment_map(ctx.fs.as_ref(), ctx.paths.as_ref())?;
         // cfprefsd cache-invalidation hint (macOS): if any plist file
@@ -270,6 +407,15 @@ pub fn up(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<Pack
                 if report.failures.len() == 1 { "" } else { "s" }
             );
         }
+        // Record each staged shell source's checksum so `status` can
+        // flag later edits as "changed since linked". Only the packs
+        // this run deployed — the others keep their previous record.
+        let pack_dirs: Vec<String> = packs.iter().map(|p| p.name.clone()).collect();
+        if let Err(e) =
+            shell::record_source_checksums(ctx.fs.as_ref(), ctx.paths.as_ref(), &pack_dirs)
+        {
+            debug!(error = %e, "failed to record shell source checksums");
+        }
         for interp in &report.missing_interpreters {
             // One-line skip notice per missing interpreter, not per
             // file. Doesn't fail the run — the file is still deployed.
@@ -277,11 +423,30 @@ pub fn up(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<Pack
                 "dodot: `{interp}` not on PATH, skipped syntax check for matching shell files"
             );
         }
+
+        // `[pack] verify` checks, last so they see the init script and
+        // PATH staging this run produced. The record is what the
+        // status render below (and every later `status`) reads.
+        for pack in &executed {
+            run_pack_checks(pack, ctx)?;
+        }
     }
 
     let has_failures = pack_results
         .iter()
         .any(|pr| !pr.success || pr.operations.iter().any(|op| !op.success));
+    let exit_code = if pack_results.is_empty() {
+        ExitCode::NothingToDo
+    } else if pack_results
+        .iter()
+        .any(|pr| pr.operations.iter().any(|op| op.conflict))
+    {
+        ExitCode::Conflict
+    } else if has_failures {
+        ExitCode::Partial
+    } else {
+        ExitCode::Success
+    };
 
     // Build display packs.
     //
@@ -294,8 +459,9 @@ pub fn up(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<Pack
     // For dry-run, render the simulated operations directly — there's no
     // post-execution state to verify, and the user wants to see the planned
     // changes, not the unchanged current state.
-    let (display_packs, notes) = if ctx.dry_run {
-        render_intents(&pack_results, ctx.paths.home_dir())
+    let (display_packs, notes, report) = if ctx.dry_run {
+        let (display_packs, notes) = render_intents(&pack_results, ctx.paths.home_dir());
+        (display_packs, notes, None)
     } else {
         let pack_names: Vec<String> = packs.iter().map(|p| p.display_name.clone()).collect();
         let status_result = status::status(Some(&pack_names), ctx)?;
@@ -308,7 +474,14 @@ pub fn up(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<Pack
             ctx.paths.home_dir(),
             &mut notes,
         );
-        (display_packs, notes)
+        // The action history behind `dodot changes`. Best effort: a
+        // failed write loses one entry of a change log, not the deploy.
+        if let Some(report) = &status_result.report {
+            if let Err(e) = crate::commands::changes::record_run(&packs, report, ctx) {
+                debug!(error = %e, "failed to record run actions");
+            }
+        }
+        (display_packs, notes, status_result.report)
     };
 
     let message = if has_failures {
@@ -317,6 +490,9 @@ pub fn up(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<Pack
         "Packs deployed.".into()
     };
 
+    let table = ctx.view_mode.table_for(&display_packs);
+    let summary = summary_line(&display_packs);
+    let phases = phase_sections(&display_packs, false, ctx.dry_run, ctx.fs.as_ref());
     Ok(PackStatusResult {
         message: Some(message),
         dry_run: ctx.dry_run,
@@ -326,9 +502,20 @@ pub fn up(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<Pack
         conflicts: Vec::new(),
         ignored_packs: ignored.display_names,
         inactive_packs: Vec::new(),
+        role_inactive_packs: Vec::new(),
         view_mode: ctx.view_mode.as_str().into(),
         group_mode: ctx.group_mode.as_str().into(),
         diffs: Vec::new(),
+        table,
+        report,
+        verbosity: ctx.render_verbosity.as_str().into(),
+        summary,
+        actions: action_lines(&pack_results, ctx.render_verbosity),
+        elapsed: ctx.render_verbosity.elapsed_since(started),
+        phases,
+        estimate_lines: estimate.as_ref().map(|e| e.lines()).unwrap_or_default(),
+        estimate,
+        exit_code,
     })
 }
 
@@ -361,6 +548,7 @@ pub fn up_or_status_for_conflict(
             base.message = Some("Cross-pack conflicts prevent deployment.".into());
             base.dry_run = ctx.dry_run;
             base.conflicts = display_conflicts;
+            base.exit_code = ExitCode::Conflict;
             Ok(base)
         }
         Err(e) => Err(e),
@@ -420,6 +608,27 @@ fn maybe_record_cfprefsd_drift(
 /// Remove datastore state for a pack across the given configuration
 /// handlers. Datastore is keyed by on-disk directory name (e.g.
 /// `010-nvim`), not the display name (`nvim`).
+/// Run `pack`'s `[pack] verify` checks and record the outcome. A pack
+/// without checks has any earlier record dropped, so removing the key
+/// also clears a `degraded` state.
+fn run_pack_checks(pack: &Pack, ctx: &ExecutionContext) -> Result<()> {
+    let commands = ctx.config_manager.config_for_pack(&pack.path)?.pack.verify;
+    if commands.is_empty() {
+        return verify::clear_record(ctx.fs.as_ref(), ctx.paths.as_ref(), &pack.name);
+    }
+    info!(pack = %pack.display_name, checks = commands.len(), "running verify checks");
+    let checks = verify::run_checks(ctx.command_runner.as_ref(), &pack.path, &commands);
+    let failed = checks.iter().filter(|c| !c.passed).count();
+    if failed > 0 {
+        info!(pack = %pack.display_name, failed, "verify checks failed");
+    }
+    let record = verify::VerifyRecord {
+        checked_at: crate::datastore::sentinel::unix_now(),
+        checks,
+    };
+    verify::write_record(ctx.fs.as_ref(), ctx.paths.as_ref(), &pack.name, &record)
+}
+
 fn wipe_configuration_state(
     pack: &Pack,
     config_handlers: &[String],
@@ -437,7 +646,8 @@ fn wipe_configuration_state(
 ///
 /// Returns (packs, notes). Failed operations keep their row but receive a
 /// `note_ref` into the command-wide notes list, keeping the column layout
-/// intact.
+/// intact. So do operations with a preview — the exact lines a staged
+/// file would add to the init script or git's config.
 fn render_intents(
     pack_results: &[PackResult],
     home: &std::path::Path,
@@ -452,7 +662,14 @@ fn render_intents(
                 .map(|op| {
                     let (handler, name, user_target) = extract_op_info(&op.operation, home);
                     let (status, status_label, note_ref) = if op.success {
-                        (status_style(true).to_string(), op.message.clone(), None)
+                        let note_ref = op.preview.as_ref().map(|preview| {
+                            notes.push(DisplayNote {
+                                body: preview.clone(),
+                                hint: None,
+                            });
+                            notes.len() as u32
+                        });
+                        (status_style(true).to_string(), op.message.clone(), note_ref)
                     } else {
                         notes.push(DisplayNote {
                             body: op.message.clone(),
@@ -472,6 +689,7 @@ fn render_intents(
                         status_label,
                         handler,
                         note_ref,
+                        last_run: None,
                     }
                 })
                 .collect();
@@ -489,6 +707,7 @@ fn render_intents(
                     status_label: "error".into(),
                     handler: String::new(),
                     note_ref: Some(notes.len() as u32),
+                    last_run: None,
                 });
             }
 
@@ -575,6 +794,7 @@ pub(crate) fn overlay_errors(
                         status_label: "error".into(),
                         handler,
                         note_ref: Some(notes.len() as u32),
+                        last_run: None,
                     });
                 }
             }
@@ -621,6 +841,7 @@ pub(crate) fn overlay_errors(
                         status_label: "error".into(),
                         handler: String::new(),
                         note_ref: Some(notes.len() as u32),
+                        last_run: None,
                     });
                 }
             }
@@ -0,0 +1,251 @@
+//! `include = [...]` in `.dodot.toml`: shared config fragments.
+//!
+//! A config file can pull in other TOML files so a rule set
+//! maintained once at repo level (standard shell mappings, a common
+//! skip list) is reused by many packs:
+//!
+//! ```toml
+//! # vim/.dodot.toml
+//! include = ["../_shared/rules-shell.toml"]
+//! ```
+//!
+//! Include paths are relative to the file that declares them and must
+//! resolve inside the dotfiles root. A fragment is a layer *under* the
+//! file that includes it: the including file's own keys win, and later
+//! entries in the list win over earlier ones. Merging follows the usual
+//! layer rules — scalars and arrays override, tables deep-merge.
+//! Fragments may include further fragments; a file that (directly or
+//! transitively) includes itself is a config error.
+//!
+//! clapfig's resolver knows nothing about `include`, so when any file
+//! in a resolution chain declares one, [`resolve`] re-does the merge at
+//! the TOML level and hands the result to confique for defaults.
+
+use std::path::{Path, PathBuf};
+
+use confique::Config;
+
+use super::DodotConfig;
+use crate::{DodotError, Result};
+
+const CONFIG_FILE: &str = ".dodot.toml";
+const INCLUDE_KEY: &str = "include";
+
+/// `.dodot.toml` files that apply at `at`, from the dotfiles root down
+/// to `at` (lowest precedence first).
+fn chain(at: &Path, root: &Path) -> Vec<PathBuf> {
+    let mut files = Vec::new();
+    for dir in at.ancestors() {
+        let file = dir.join(CONFIG_FILE);
+        if file.is_file() {
+            files.push(file);
+        }
+        if dir == root {
+            break;
+        }
+    }
+    files.reverse();
+    files
+}
+
+/// Whether any config file applying at `at` declares an `include`.
+/// Unparseable files answer `false`; clapfig reports those.
+pub(super) fn chain_has_includes(at: &Path, root: &Path) -> bool {
+    chain(at, root).iter().any(|file| {
+        std::fs::read_to_string(file)
+            .ok()
+            .and_then(|text| text.parse::<toml::Table>().ok())
+            .is_some_and(|table| table.contains_key(INCLUDE_KEY))
+    })
+}
+
+/// Resolve the config at `at` with every `include` expanded.
+pub(super) fn resolve(at: &Path, root: &Path) -> Result<DodotConfig> {
+    let canonical_root = canonical(root)?;
+    let mut merged = toml::Table::new();
+    for file in chain(at, root) {
+        let layer = load(&file, &canonical_root, &mut Vec::new())?;
+        deep_merge(&mut merged, layer);
+    }
+    let layer = toml::Value::Table(merged)
+        .try_into::<<DodotConfig as Config>::Layer>()
+        .map_err(|e| DodotError::Config(format!("invalid config after includes: {e}")))?;
+    DodotConfig::builder()
+        .preloaded(layer)
+        .load()
+        .map_err(|e| DodotError::Config(format!("invalid config after includes: {e}")))
+}
+
+/// Read `file` and the fragments it includes into one table. `stack`
+/// holds the files currently being expanded, for cycle detection.
+fn load(file: &Path, root: &Path, stack: &mut Vec<PathBuf>) -> Result<toml::Table> {
+    let path = canonical(file)?;
+    if stack.contains(&path) {
+        let cycle: Vec<String> = stack
+            .iter()
+            .chain(std::iter::once(&path))
+            .map(|p| display_relative(p, root))
+            .collect();
+        return Err(DodotError::Config(format!(
+            "config include cycle: {}",
+            cycle.join(" -> ")
+        )));
+    }
+
+    let text = std::fs::read_to_string(&path).map_err(|e| {
+        DodotError::Config(format!(
+            "failed to read {}: {e}",
+            display_relative(&path, root)
+        ))
+    })?;
+    let mut table: toml::Table = text.parse().map_err(|e| {
+        DodotError::Config(format!(
+            "failed to parse {}: {e}",
+            display_relative(&path, root)
+        ))
+    })?;
+    let includes = take_includes(&mut table, &path, root)?;
+
+    stack.push(path.clone());
+    let mut merged = toml::Table::new();
+    let base = path.parent().unwrap_or(root);
+    for include in includes {
+        let target = base.join(&include);
+        if !target.is_file() {
+            return Err(DodotError::Config(format!(
+                "{}: included file {include:?} not found",
+                display_relative(&path, root)
+            )));
+        }
+        if !canonical(&target)?.starts_with(root) {
+            return Err(DodotError::Config(format!(
+                "{}: included file {include:?} is outside the dotfiles root",
+                display_relative(&path, root)
+            )));
+        }
+        deep_merge(&mut merged, load(&target, root, stack)?);
+    }
+    stack.pop();
+
+    deep_merge(&mut merged, table);
+    Ok(merged)
+}
+
+/// Remove and validate the `include` key: an array of strings, the
+/// same shape the schema gives it.
+fn take_includes(table: &mut toml::Table, file: &Path, root: &Path) -> Result<Vec<String>> {
+    let bad = || {
+        DodotError::Config(format!(
+            "{}: `include` must be a list of paths",
+            display_relative(file, root)
+        ))
+    };
+    match table.remove(INCLUDE_KEY) {
+        None => Ok(Vec::new()),
+        Some(toml::Value::Array(items)) => items
+            .into_iter()
+            .map(|v| match v {
+                toml::Value::String(s) => Ok(s),
+                _ => Err(bad()),
+            })
+            .collect(),
+        Some(_) => Err(bad()),
+    }
+}
+
+/// Merge `over` into `base`: tables merge key by key, anything else
+/// in `over` replaces what `base` had.
+fn deep_merge(base: &mut toml::Table, over: toml::Table) {
+    for (key, value) in over {
+        match (base.get_mut(&key), value) {
+            (Some(toml::Value::Table(existing)), toml::Value::Table(incoming)) => {
+                deep_merge(existing, incoming);
+            }
+            (_, value) => {
+                base.insert(key, value);
+            }
+        }
+    }
+}
+
+fn canonical(path: &Path) -> Result<PathBuf> {
+    path.canonicalize()
+        .map_err(|e| DodotError::Config(format!("failed to resolve {}: {e}", path.display())))
+}
+
+fn display_relative(path: &Path, root: &Path) -> String {
+    path.strip_prefix(root)
+        .unwrap_or(path)
+        .display()
+        .to_string()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::config::ConfigManager;
+    use crate::fs::Fs;
+    use crate::testing::TempEnvironment;
+
+    #[test]
+    fn pack_includes_shared_fragment_under_its_own_keys() {
+        let env = TempEnvironment::builder()
+            .pack("vim")
+            .file("vimrc", "x")
+            .config(
+                "include = [\"../_shared/rules-shell.toml\"]\n\n[mappings]\nhomebrew = \"VimBrewfile\"\n",
+            )
+            .done()
+            .build();
+        let shared = env.dotfiles_root.join("_shared");
+        env.fs.mkdir_all(&shared).unwrap();
+        env.fs
+            .write_file(
+                &shared.join("rules-shell.toml"),
+                b"include = [\"base.toml\"]\n\n[mappings]\nshell = [\"*.sh\", \"*.fish\"]\nhomebrew = \"SharedBrewfile\"\n",
+            )
+            .unwrap();
+        env.fs
+            .write_file(
+                &shared.join("base.toml"),
+                b"[mappings]\ninstall = [\"setup.sh\"]\nshell = [\"*.sh\"]\n",
+            )
+            .unwrap();
+
+        let mgr = ConfigManager::new(&env.dotfiles_root).unwrap();
+        let cfg = mgr.config_for_pack(&env.dotfiles_root.join("vim")).unwrap();
+        assert_eq!(cfg.mappings.shell, ["*.sh", "*.fish"]);
+        assert_eq!(cfg.mappings.install, ["setup.sh"]);
+        assert_eq!(cfg.mappings.homebrew, "VimBrewfile");
+        // Untouched keys keep their defaults.
+        assert_eq!(cfg.mappings.path, "bin");
+    }
+
+    #[test]
+    fn include_cycles_are_reported() {
+        let env = TempEnvironment::builder()
+            .pack("vim")
+            .file("vimrc", "x")
+            .config("include = [\"../_shared/a.toml\"]\n")
+            .done()
+            .build();
+        let shared = env.dotfiles_root.join("_shared");
+        env.fs.mkdir_all(&shared).unwrap();
+        env.fs
+            .write_file(&shared.join("a.toml"), b"include = [\"b.toml\"]\n")
+            .unwrap();
+        env.fs
+            .write_file(&shared.join("b.toml"), b"include = [\"a.toml\"]\n")
+            .unwrap();
+
+        let mgr = ConfigManager::new(&env.dotfiles_root).unwrap();
+        let err = mgr
+            .config_for_pack(&env.dotfiles_root.join("vim"))
+            .unwrap_err()
+            .to_string();
+        assert!(
+            err.contains("_shared/a.toml -> _shared/b.toml -> _shared/a.toml"),
+            "{err}"
+        );
+    }
+}
@@ -10,6 +10,9 @@
 //! [`ConfigManager`] wraps clapfig's `Resolver` to provide per-pack
 //! config resolution with automatic caching and merging.
 
+mod include;
+
+use std::collections::BTreeMap;
 use std::path::{Path, PathBuf};
 
 use clapfig::{Boundary, Clapfig, SearchMode, SearchPath};
@@ -35,6 +38,12 @@ pub struct DodotConfig {
     #[config(nested)]
     pub path: PathSection,
 
+    #[config(nested)]
+    pub install: InstallSection,
+
+    #[config(nested)]
+    pub system: SystemSection,
+
     #[config(nested)]
     pub mappings: MappingsSection,
 
@@ -44,9 +53,18 @@ pub struct DodotConfig {
     #[config(nested)]
     pub profiling: ProfilingSection,
 
+    #[config(nested)]
+    pub datastore: DatastoreSection,
+
     #[config(nested)]
     pub secret: SecretSection,
 
+    #[config(nested)]
+    pub notify: NotifySection,
+
+    #[config(nested)]
+    pub lint: LintSection,
+
     /// User-defined gate labels.
     ///
     /// Each entry maps a label name to a table of `(dimension, value)`
@@ -68,6 +86,73 @@ pub struct DodotConfig {
     /// proposal in `docs/proposals/`.
     #[config(default = {})]
     pub gates: std::collections::HashMap<String, std::collections::HashMap<String, String>>,
+
+    /// Named pack groups for command-line selection.
+    ///
+    /// ```toml
+    /// [groups]
+    /// dev = ["go", "node", "python"]
+    /// lang = ["lang-*"]
+    /// ```
+    ///
+    /// `dodot up dev` then acts on every member. Members are pack
+    /// names or globs; groups don't nest. A real pack with the same
+    /// name as a group wins. Only read from the root config. See
+    /// [`crate::packs::orchestration::expand_pack_selectors`].
+    #[config(default = {})]
+    pub groups: std::collections::HashMap<String, Vec<String>>,
+
+    /// Other TOML files to layer under this one.
+    ///
+    /// ```toml
+    /// include = ["../_shared/rules-shell.toml"]
+    /// ```
+    ///
+    /// Paths are relative to the file that declares them and must stay
+    /// inside the dotfiles root. The including file's own keys win;
+    /// later entries win over earlier ones. Expanded by
+    /// [`ConfigManager`] — see [`include`] for the merge rules.
+    #[config(default = [])]
+    pub include: Vec<String>,
+
+    /// Extra pattern → handler rules, on top of the ones `[mappings]`
+    /// generates.
+    ///
+    /// ```toml
+    /// [[rules]]
+    /// pattern = "hosts"
+    /// handler = "symlink"
+    /// options = { target = "/etc/hosts", mode = "copy" }
+    /// ```
+    ///
+    /// `priority` defaults to [`DEFAULT_RULE_PRIORITY`], above the
+    /// mapping rules and below `skip`/`ignore`. `options` are checked
+    /// against the handler's schema ([`crate::handlers::options`]) at
+    /// load time. Like every list, a pack's `rules` replaces the
+    /// root's rather than extending it.
+    #[config(default = [])]
+    pub rules: Vec<RuleSpec>,
+}
+
+/// Priority of a `[[rules]]` entry that doesn't set one. Above the
+/// mapping rules (10–20) so a user rule beats the conventions, below
+/// `skip` (50) and `ignore` (100).
+pub const DEFAULT_RULE_PRIORITY: i32 = 30;
+
+/// One `[[rules]]` entry as written in `.dodot.toml`.
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+#[serde(deny_unknown_fields)]
+pub struct RuleSpec {
+    pub pattern: String,
+    pub handler: String,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub priority: Option<i32>,
+    #[serde(default, skip_serializing_if = "BTreeMap::is_empty")]
+    pub options: BTreeMap<String, toml::Value>,
+    /// Machine roles the rule applies on. On a machine with none of
+    /// them, files the rule matches are skipped instead of handled.
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub roles: Vec<String>,
 }
 
 /// Pack-level settings.
@@ -93,6 +178,62 @@ pub struct PackSection {
     /// `docs/proposals/conditional-running.lex` §5.3).
     #[config(default = [])]
     pub os: Vec<String>,
+
+    /// Machine roles this pack is for. Empty (the default) deploys on
+    /// every machine; otherwise the pack needs at least one of these
+    /// among the roles the machine is tagged with in
+    /// `<config_dir>/local.toml`, and is skipped — `role mismatch` in
+    /// `dodot status` — where it has none. Pack-level only, like `os`.
+    /// See [`crate::gates::roles_active`].
+    #[config(default = [])]
+    pub roles: Vec<String>,
+
+    /// Post-deploy checks. Each entry is a shell command run with
+    /// `sh -c` from the pack directory after `dodot up` has linked and
+    /// provisioned the pack:
+    ///
+    /// ```toml
+    /// [pack]
+    /// verify = ["git --version", "test -x ~/.local/bin/tool"]
+    /// ```
+    ///
+    /// A non-zero exit marks the pack `degraded` in `dodot status`
+    /// until a later `up` sees the check pass. Pack-level only, like
+    /// `os`. See [`crate::verify`].
+    #[config(default = [])]
+    pub verify: Vec<String>,
+
+    /// How the dotfiles root is organised: `"packs"` (one pack per
+    /// top-level directory) or `"flat"` (the root itself is a single
+    /// implicit pack, [`crate::packs::FLAT_PACK`]). Only read from the
+    /// root config. See [`crate::packs::Layout`].
+    #[config(default = "packs")]
+    pub layout: String,
+
+    /// One line saying what the pack is for, shown by `dodot list`.
+    #[config(default = "")]
+    pub description: String,
+
+    /// Who maintains the pack.
+    #[config(default = "")]
+    pub author: String,
+
+    /// The pack's own version, free-form. Informational only.
+    #[config(default = "")]
+    pub version: String,
+
+    /// Where the pack comes from or is documented.
+    #[config(default = "")]
+    pub url: String,
+
+    /// Oldest dodot release the pack works with, e.g. `"5.2"`. On an
+    /// older dodot, `up`, `plan` and `provision` skip the pack with a
+    /// warning. See [`crate::packs::metadata`].
+    ///
+    /// The metadata keys describe one pack, so like `verify` they are
+    /// pack-level only unless the root is a flat layout.
+    #[config(default = "")]
+    pub min_dodot: String,
 }
 
 /// Symlink handler settings.
@@ -135,7 +276,11 @@ pub struct SymlinkSection {
     #[config(default = {})]
     pub app_aliases: std::collections::HashMap<String, String>,
 
-    /// Paths that must not be symlinked for security reasons.
+    /// Paths that must not be symlinked for security reasons, relative
+    /// to `$HOME`. An entry covers everything below it and may be a
+    /// glob (`.ssh/id_*`). A pack's entries are added to the root's
+    /// rather than replacing them, so a pack can't lift a protection.
+    /// `dodot protect` edits this list.
     #[config(default = [
         ".ssh/id_rsa", ".ssh/id_ed25519", ".ssh/id_dsa", ".ssh/id_ecdsa",
         ".ssh/authorized_keys", ".gnupg", ".aws/credentials",
@@ -147,7 +292,8 @@ pub struct SymlinkSection {
     /// Custom per-file symlink target overrides.
     /// Maps relative pack filename to absolute or relative target path.
     /// Absolute paths are used as-is; relative paths are resolved from
-    /// `$XDG_CONFIG_HOME`.
+    /// `$XDG_CONFIG_HOME`. `~`, `$HOME`, `$XDG_*` and `${VAR:-default}`
+    /// are expanded (see [`crate::paths::expand_target`]).
     #[config(default = {})]
     pub targets: std::collections::HashMap<String, String>,
 
@@ -163,6 +309,42 @@ pub struct SymlinkSection {
     /// See `docs/proposals/plists.lex` §8.1.
     #[config(default = ["plist"])]
     pub plist_extensions: Vec<String>,
+
+    /// How deployed files reach their target: `"symlink"` (the
+    /// default double-link), `"copy"`, or `"hardlink"`. The latter two
+    /// exist for homes that can't follow symlinks (some network
+    /// filesystems, container bind mounts). Copies are tracked by
+    /// content hash, so `dodot status` reports when the source has
+    /// moved on and a re-deploy is needed. Hard links require source
+    /// and target on the same filesystem.
+    #[config(default = "symlink")]
+    pub mode: String,
+
+    /// Where a symlink at the target points: `"double"` (the default:
+    /// at the datastore data link, which points at the source) or
+    /// `"direct"` (straight at the source file). The data link is
+    /// recorded either way, so `status`, `down` and `disable` work the
+    /// same. Root-only: a pack's value is ignored.
+    #[config(default = "double")]
+    pub link_strategy: String,
+
+    /// What to do when the symlink handler is about to link a file
+    /// too large to be a dotfile — a dump or build artifact committed
+    /// by accident: `"warn"` (link it and warn, the default), `"skip"`
+    /// (leave it unlinked and warn) or `"off"`.
+    #[config(default = "warn")]
+    pub large_files: String,
+
+    /// Files above this size (MiB) trip the large-file guard. `0`
+    /// turns the size check off.
+    #[config(default = 50)]
+    pub max_file_size_mb: u64,
+
+    /// Binary files (a NUL byte near the start) above this size (KiB)
+    /// trip the large-file guard. Small binaries such as binary plists
+    /// pass. `0` turns the binary check off.
+    #[config(default = 1024)]
+    pub max_binary_size_kb: u64,
 }
 
 /// PATH handler settings.
@@ -196,6 +378,153 @@ pub struct PathSection {
     /// sourced by other scripts).
     #[config(default = true)]
     pub auto_chmod_exec: bool,
+
+    /// Ordering weight for this pack's `$PATH` entries in the
+    /// generated init script. Higher values resolve first; packs with
+    /// equal priority are ordered by name. The default `0` keeps every
+    /// pack on equal footing, which yields plain alphabetical order —
+    /// stable across machines regardless of directory listing order.
+    ///
+    /// Set it per pack (`[path] priority = 10` in the pack's
+    /// `.dodot.toml`) to let that pack's `bin/` shadow commands of the
+    /// same name from other packs. A `[[rules]]` entry routing to
+    /// `path` can override it for the directories it matches with
+    /// `options = { path_priority = N }`.
+    #[config(default = 0)]
+    pub priority: i32,
+
+    /// Which end of `$PATH` this pack's directories go on:
+    /// `"prepend"` (the default) puts them ahead of the system's, so
+    /// their commands win; `"append"` puts them after, for fallback
+    /// tools that should only be found when nothing else provides the
+    /// command. `priority` orders packs within each end.
+    #[config(default = "prepend")]
+    pub position: String,
+
+    /// Per-directory `position`, keyed by the directory's path in the
+    /// pack: `[path.positions] fallback = "append"`. Directories not
+    /// listed use `position`.
+    #[config(default = {})]
+    pub positions: std::collections::HashMap<String, String>,
+
+    /// Also write a shim per executable in every deployed path
+    /// directory to `<data_dir>/bin` (`~/.local/share/dodot/bin`).
+    /// Put that one directory on the launchd / systemd user `PATH` and
+    /// non-interactive shells, cron jobs and GUI apps see the same
+    /// commands an interactive shell does. Read from the root config
+    /// only; turning it off removes the shims on the next `up`.
+    #[config(default = false)]
+    pub shims: bool,
+}
+
+/// Install handler settings: the environment and limits install
+/// scripts run under. See [`crate::handlers::install::Sandbox`].
+#[derive(Config, Debug, Clone, Serialize, Deserialize)]
+pub struct InstallSection {
+    /// Run install scripts with a cleared environment: only the
+    /// variables in `env_allowlist` (with their current values) and
+    /// `DOTFILES_ROOT`, `DODOT_PACK` and `DODOT_DATA_DIR` reach the
+    /// script, so it can't quietly depend on something exported by the
+    /// interactive shell `dodot up` happened to run from.
+    #[config(default = false)]
+    pub sandbox: bool,
+
+    /// Variables passed through under `sandbox`. Unset ones are left
+    /// out rather than passed empty.
+    #[config(default = ["HOME", "USER", "LOGNAME", "PATH", "SHELL", "TERM", "LANG", "LC_ALL", "TMPDIR"])]
+    pub env_allowlist: Vec<String>,
+
+    /// Run scripts under `nice -n <value>` (1–19). `0` leaves the
+    /// priority alone.
+    #[config(default = 0)]
+    pub nice: i32,
+
+    /// Kill a script that runs longer than this many seconds, via
+    /// `timeout`. `0` means no limit.
+    #[config(default = 0)]
+    pub timeout_secs: u64,
+
+    /// Flags for `unshare` (Linux): when non-empty, scripts run as
+    /// `unshare <flags> <interpreter> …`, e.g. `["--user",
+    /// "--map-current-user", "--net"]` for no network access.
+    #[config(default = [])]
+    pub unshare: Vec<String>,
+}
+
+/// System handler settings: files outside `$HOME` installed with
+/// `sudo`. See [`crate::handlers::system`]. Root-only — pack-level
+/// entries are ignored, so a pack can't opt itself in.
+#[derive(Config, Debug, Clone, Serialize, Deserialize)]
+pub struct SystemSection {
+    /// Opt in to installing a pack's `_system/` files. Off by default:
+    /// the files are matched (so they never end up symlinked into
+    /// `$HOME`) but nothing is installed, and the pack gets a warning
+    /// saying why.
+    #[config(default = false)]
+    pub enabled: bool,
+
+    /// Ask on the terminal before each file is installed. Turning it
+    /// off is for unattended machines; `sudo` may still ask for a
+    /// password.
+    #[config(default = true)]
+    pub confirm: bool,
+
+    /// Absolute paths the handler refuses to write, on top of its
+    /// being outside `$HOME`. An entry covers the path itself and
+    /// everything below it. A pack file mapping to one is a planning
+    /// error, not a skip — editing these by hand is the safer route.
+    #[config(default = [
+        "/etc/sudoers", "/etc/sudoers.d",
+        "/etc/passwd", "/etc/shadow", "/etc/group", "/etc/gshadow",
+        "/etc/fstab", "/etc/pam.d", "/etc/ssh/sshd_config",
+        "/boot", "/bin", "/sbin", "/lib", "/usr/bin", "/usr/sbin", "/usr/lib",
+        "/System", "/Library/LaunchDaemons",
+    ])]
+    pub protected: Vec<String>,
+}
+
+/// Notifications when a deploy or provision run ends. See
+/// [`crate::notify`]. Root-only: where to be told is a property of the
+/// machine, not of a pack.
+#[derive(Config, Debug, Clone, Serialize, Deserialize)]
+pub struct NotifySection {
+    /// Show a desktop notification (`osascript` on macOS,
+    /// `notify-send` elsewhere).
+    #[config(default = false)]
+    pub desktop: bool,
+
+    /// URLs to POST the run summary to as JSON. The `text` field is
+    /// what Slack and Matrix (hookshot) incoming webhooks display.
+    #[config(default = [])]
+    pub webhooks: Vec<String>,
+
+    /// `"always"`, or `"failure"` to only hear about runs that failed.
+    #[config(default = "always")]
+    pub on: String,
+
+    /// Runs shorter than this many seconds don't notify — you were
+    /// still watching.
+    #[config(default = 30)]
+    pub min_seconds: u64,
+}
+
+/// shellcheck over shell profiles and install scripts during `up` and
+/// `provision`. See [`crate::shell::lint`]. Root-only.
+#[derive(Config, Debug, Clone, Serialize, Deserialize)]
+pub struct LintSection {
+    /// Lint every run, as if `--lint` were given.
+    #[config(default = false)]
+    pub enabled: bool,
+
+    /// Findings fail the run, as with `--strict`. Only applies while
+    /// linting is on.
+    #[config(default = false)]
+    pub strict: bool,
+
+    /// The least severe finding to report: `error`, `warning`, `info`
+    /// or `style` (shellcheck's `--severity`).
+    #[config(default = "warning")]
+    pub severity: String,
 }
 
 /// Preprocessing pipeline settings.
@@ -213,6 +542,24 @@ pub struct PreprocessorSection {
 
     #[config(nested)]
     pub gpg: PreprocessorGpgSection,
+
+    /// Deploy-time filter chains, keyed by filename glob.
+    ///
+    /// ```toml
+    /// [preprocessor.filters]
+    /// "*.conf"     = ["strip-comments", "line-endings:lf"]
+    /// "ssh_config" = ["envsubst", "chmod:600"]
+    /// ```
+    ///
+    /// A matching file is passed through each filter in order and
+    /// deployed from the datastore, like a rendered template. Built-in
+    /// filters: `strip-comments[:<marker>]`, `envsubst`,
+    /// `line-endings:lf|crlf`, `chmod:<octal>`. Files another
+    /// preprocessor claims (templates, archives) are not filtered.
+    /// When several globs match, the lexicographically first wins. See
+    /// [`crate::preprocessing::filter`].
+    #[config(default = {})]
+    pub filters: std::collections::HashMap<String, Vec<String>>,
 }
 
 /// Template preprocessor settings.
@@ -243,6 +590,14 @@ pub struct PreprocessorTemplateSection {
     /// (e.g. `"complex-config.toml.tmpl"`, `"*.gen.tmpl"`).
     #[config(default = [])]
     pub no_reverse: Vec<String>,
+
+    /// Glob patterns for templates that render into the pack rather
+    /// than the datastore: `aliases.sh.tmpl` writes `<pack>/aliases.sh`,
+    /// which rules then match like a hand-written file. Matched against
+    /// the source filename, like `no_reverse`. See
+    /// [`crate::preprocessing::generate`].
+    #[config(default = [])]
+    pub generate: Vec<String>,
 }
 
 /// `age` whole-file decryption preprocessor settings
@@ -302,6 +657,27 @@ pub struct PreprocessorGpgSection {
     pub extensions: Vec<String>,
 }
 
+/// Where dodot keeps deployment state. Root-only — there is one
+/// datastore per data dir.
+///
+/// `"filesystem"` (the default) keeps state as symlinks and sentinel
+/// files only. `"sqlite"` keeps the same files and additionally
+/// indexes them, plus the full run history, in `<data_dir>/dodot.db`;
+/// it needs a dodot built with the `sqlite` feature. See
+/// [`crate::datastore::open`].
+///
+/// `per_host` namespaces the data dir under `hosts/<hostname>/`, for a
+/// `$HOME` several machines mount (NFS): each host then keeps its own
+/// links, sentinels and init script, and `status` flags targets
+/// another host's `up` linked. See [`crate::paths::XdgPatherBuilder::host`].
+#[derive(Config, Debug, Clone, Serialize, Deserialize)]
+pub struct DatastoreSection {
+    #[config(default = "filesystem")]
+    pub backend: String,
+    #[config(default = false)]
+    pub per_host: bool,
+}
+
 /// Shell-init profiling settings. Root-only — per-pack overrides are
 /// meaningless (the init script is one thing; you can't half-profile it).
 ///
@@ -390,6 +766,9 @@ pub struct SecretProvidersSection {
     /// correct `[secret.providers.secret_tool]` block.
     #[config(nested)]
     pub secret_tool: SecretProviderSecretTool,
+
+    #[config(nested)]
+    pub vault: SecretProviderVault,
 }
 
 /// `pass` (password-store) provider config.
@@ -461,6 +840,32 @@ pub struct SecretProviderSecretTool {
     pub enabled: bool,
 }
 
+/// `vault` (HashiCorp Vault CLI) provider config.
+///
+/// Auth stays with the vault binary (`VAULT_TOKEN`, the token helper,
+/// or a Vault Agent). The knobs below override the matching `VAULT_*`
+/// variables; empty (the default) leaves them to the environment.
+#[derive(Config, Debug, Clone, Serialize, Deserialize)]
+pub struct SecretProviderVault {
+    /// Whether the `vault:` scheme is registered. Default false —
+    /// same opt-in posture as the other providers.
+    #[config(default = false)]
+    pub enabled: bool,
+
+    /// Server address, as `VAULT_ADDR`.
+    #[config(default = "")]
+    pub address: String,
+
+    /// Vault Agent address, as `VAULT_AGENT_ADDR`. Requests go
+    /// through the agent, which supplies its auto-auth token.
+    #[config(default = "")]
+    pub agent_address: String,
+
+    /// Enterprise namespace, as `VAULT_NAMESPACE`.
+    #[config(default = "")]
+    pub namespace: String,
+}
+
 /// File-to-handler mapping patterns.
 #[derive(Config, Debug, Clone, Serialize, Deserialize)]
 pub struct MappingsSection {
@@ -468,6 +873,15 @@ pub struct MappingsSection {
     #[config(default = "bin")]
     pub path: String,
 
+    /// Route executable files at a pack's root to the PATH handler, so
+    /// a script dropped into a pack is on `$PATH` without a rule. Sits
+    /// at priority 5: every named mapping (`install.sh`, `*.sh`, …)
+    /// still wins, and only the catchall symlink loses. Off by default:
+    /// turning it on moves executables that are symlinked today onto
+    /// `$PATH`, which an existing setup has to opt into.
+    #[config(default = false)]
+    pub executable: bool,
+
     /// Filename patterns for install scripts.
     ///
     /// The extension selects the interpreter used to run the script
@@ -518,6 +932,41 @@ pub struct MappingsSection {
     #[config(default = "packages.nix")]
     pub nix: String,
 
+    /// Filename pattern for the npm handler: global npm packages, one
+    /// per line (`#` comments allowed), installed with `npm install -g`.
+    #[config(default = "npm-packages.txt")]
+    pub npm: String,
+
+    /// Filename pattern for the pip handler: a pip requirements file
+    /// installed with `python3 -m pip install --user -r`.
+    #[config(default = "requirements-global.txt")]
+    pub pip: String,
+
+    /// Filename pattern for the cargo handler: crates to
+    /// `cargo install`, one per line.
+    #[config(default = "cargo-crates.txt")]
+    pub cargo: String,
+
+    /// Filename pattern for the gem handler: gems to `gem install`,
+    /// one per line.
+    #[config(default = "gems.txt")]
+    pub gem: String,
+
+    /// Filename pattern for the asdf handler: a `.tool-versions` file
+    /// whose tools are installed with `asdf install`.
+    #[config(default = ".tool-versions")]
+    pub asdf: String,
+
+    /// Filename pattern for the mise handler: a `mise.toml` whose
+    /// `[tools]` are installed with `mise install`.
+    #[config(default = "mise.toml")]
+    pub mise: String,
+
+    /// Filename pattern for the flake handler: a `flake.nix` whose
+    /// default package is installed with `nix profile install`.
+    #[config(default = "flake.nix")]
+    pub flake: String,
+
     /// Filename patterns for the externals handler.
     ///
     /// The file declares one TOML section per external resource (a
@@ -527,6 +976,70 @@ pub struct MappingsSection {
     #[config(default = ["externals.toml"])]
     pub externals: Vec<String>,
 
+    /// Filename patterns for the plugins handler.
+    ///
+    /// The file declares one TOML table per plugin manager (`[tpm]`,
+    /// `[vim-plug]`, `[zinit]`). See the
+    /// [`plugins`](crate::handlers::plugins) handler for the schema.
+    #[config(default = ["plugins.toml"])]
+    pub plugins: Vec<String>,
+
+    /// Filename patterns for the download handler.
+    ///
+    /// The file declares one TOML table per tool to download into the
+    /// pack's bin dir. See the [`download`](crate::handlers::download)
+    /// handler for the schema.
+    #[config(default = ["tools.toml"])]
+    pub download: Vec<String>,
+
+    /// Filename patterns for the sshkeys handler.
+    ///
+    /// The file declares one TOML table per keypair to generate. See
+    /// the [`sshkeys`](crate::handlers::sshkeys) handler for the schema.
+    #[config(default = ["sshkeys.toml"])]
+    pub sshkeys: Vec<String>,
+
+    /// Filename patterns for the containers handler.
+    ///
+    /// The file lists container images to pull and named volumes and
+    /// networks to create. See the
+    /// [`containers`](crate::handlers::containers) handler for the schema.
+    #[config(default = ["containers.toml", "devcontainer.toml"])]
+    pub containers: Vec<String>,
+
+    /// Filename patterns for the gitconfig handler: fragments added to
+    /// git's config as `include.path` entries rather than symlinked.
+    /// Not `*.gitconfig`, which would claim `home.gitconfig` from the
+    /// symlink handler.
+    #[config(default = ["*.gitinclude"])]
+    pub gitconfig: Vec<String>,
+
+    /// Directory name pattern for the system handler. Its contents
+    /// mirror absolute paths: `_system/etc/hosts.d/work` installs to
+    /// `/etc/hosts.d/work`. Matched even while `[system] enabled` is
+    /// off, so the tree is never symlinked into `$HOME`.
+    #[config(default = "_system")]
+    pub system: String,
+
+    /// Directory name pattern for the autostart handler: `.desktop`
+    /// entries and a `login-items.toml` for applications that start at
+    /// login. See the [`autostart`](crate::handlers::autostart) handler.
+    #[config(default = "autostart")]
+    pub autostart: String,
+
+    /// Directory names for the editors handler: settings linked to the
+    /// editor's per-platform location. Each name must be one the
+    /// [`editors`](crate::handlers::editors) handler knows; `cursor` is
+    /// left out by default since cursor themes use the same name.
+    #[config(default = ["vscode", "vscode-insiders", "vscodium", "jetbrains"])]
+    pub editors: Vec<String>,
+
+    /// Filename patterns for the agent handler: gpg-agent and ssh-agent
+    /// setup. See the [`agent`](crate::handlers::agent) handler for the
+    /// schema.
+    #[config(default = ["agent.toml"])]
+    pub agent: Vec<String>,
+
     /// Filename patterns to drop from handler processing entirely.
     /// Matches are silent: nothing surfaces in `dodot status`, mirroring
     /// `.gitignore`'s mental model. Defaults are empty; common build /
@@ -543,7 +1056,9 @@ pub struct MappingsSection {
     /// `dodot status` as "skipped"; no executable intent is produced.
     /// The defaults cover the common documentation/legal files that
     /// packs ship alongside real config; clear the list (or override
-    /// per-pack) to deploy a README intentionally.
+    /// per-pack) to deploy a README intentionally. `Brewfile.lock.json`
+    /// is skipped because the homebrew handler reads it in place, and
+    /// `data.toml` / `data.json` because they are template data.
     #[config(default = [
         "README", "README.*",
         "LICENSE", "LICENSE.*",
@@ -552,6 +1067,8 @@ pub struct MappingsSection {
         "AUTHORS", "AUTHORS.*",
         "NOTICE", "NOTICE.*",
         "COPYING", "COPYING.*",
+        "Brewfile.lock.json",
+        "data.toml", "data.json",
     ])]
     pub skip: Vec<String>,
 
@@ -585,6 +1102,13 @@ pub struct MappingsSection {
     /// glob patterns are a hard error at scan time.
     #[config(default = {})]
     pub gates: std::collections::HashMap<String, String>,
+
+    /// Also gate files on a bare OS/arch segment, without the `_`
+    /// marker: `aliases.linux.sh` deploys as `aliases.sh` on Linux
+    /// only. Only the built-in labels work this way. Off by default,
+    /// since it changes what existing files named like that do.
+    #[config(default = false)]
+    pub platform_suffixes: bool,
 }
 
 // ── Conversions ─────────────────────────────────────────────────
@@ -605,6 +1129,26 @@ impl DodotConfig {
             targets: self.symlink.targets.clone(),
             auto_chmod_exec: self.path.auto_chmod_exec,
             pack_ignore: self.pack.ignore.clone(),
+            system_enabled: self.system.enabled,
+            system_confirm: self.system.confirm,
+            system_protected: self.system.protected.clone(),
+            // Validated at load time (`check_symlink_mode`); the
+            // fallback only covers hand-built configs in tests.
+            link_mode: crate::operations::LinkMode::parse(&self.symlink.mode).unwrap_or_default(),
+            // Validated alongside `mode`.
+            large_files: crate::handlers::symlink::guard::LargeFiles::parse(
+                &self.symlink.large_files,
+            )
+            .unwrap_or_default(),
+            max_file_size: self.symlink.max_file_size_mb.saturating_mul(1024 * 1024),
+            max_binary_size: self.symlink.max_binary_size_kb.saturating_mul(1024),
+            install_sandbox: crate::handlers::install::Sandbox {
+                clean_env: self.install.sandbox,
+                env_allowlist: self.install.env_allowlist.clone(),
+                nice: self.install.nice,
+                timeout_secs: self.install.timeout_secs,
+                unshare: self.install.unshare.clone(),
+            },
         }
     }
 }
@@ -630,6 +1174,21 @@ pub fn mappings_to_rules(mappings: &MappingsSection) -> Vec<Rule> {
             handler: "path".into(),
             priority: 10,
             case_insensitive: false,
+            executable: false,
+            options: HashMap::new(),
+        });
+    }
+
+    // Executable files at the pack root → path handler. Priority 5:
+    // below every named mapping so an executable `install.sh` or
+    // `aliases.sh` keeps its handler, above the catchall.
+    if mappings.executable {
+        rules.push(Rule {
+            pattern: "*".into(),
+            handler: "path".into(),
+            priority: 5,
+            case_insensitive: false,
+            executable: true,
             options: HashMap::new(),
         });
     }
@@ -647,6 +1206,7 @@ pub fn mappings_to_rules(mappings: &MappingsSection) -> Vec<Rule> {
                 handler: "install".into(),
                 priority: 20,
                 case_insensitive: false,
+                executable: false,
                 options: HashMap::new(),
             });
         }
@@ -660,6 +1220,7 @@ pub fn mappings_to_rules(mappings: &MappingsSection) -> Vec<Rule> {
                 handler: "shell".into(),
                 priority: 10,
                 case_insensitive: false,
+                executable: false,
                 options: HashMap::new(),
             });
         }
@@ -672,6 +1233,7 @@ pub fn mappings_to_rules(mappings: &MappingsSection) -> Vec<Rule> {
             handler: "homebrew".into(),
             priority: 10,
             case_insensitive: false,
+            executable: false,
             options: HashMap::new(),
         });
     }
@@ -686,10 +1248,34 @@ pub fn mappings_to_rules(mappings: &MappingsSection) -> Vec<Rule> {
             handler: "nix".into(),
             priority: 10,
             case_insensitive: false,
+            executable: false,
             options: HashMap::new(),
         });
     }
 
+    // Language package and toolchain handlers — pack-root manifests,
+    // same shape and priority as homebrew.
+    for (pattern, handler) in [
+        (&mappings.npm, crate::handlers::HANDLER_NPM),
+        (&mappings.pip, crate::handlers::HANDLER_PIP),
+        (&mappings.cargo, crate::handlers::HANDLER_CARGO),
+        (&mappings.gem, crate::handlers::HANDLER_GEM),
+        (&mappings.asdf, crate::handlers::HANDLER_ASDF),
+        (&mappings.mise, crate::handlers::HANDLER_MISE),
+        (&mappings.flake, crate::handlers::HANDLER_FLAKE),
+    ] {
+        if !pattern.is_empty() {
+            rules.push(Rule {
+                pattern: pattern.clone(),
+                handler: handler.into(),
+                priority: 10,
+                case_insensitive: false,
+                executable: false,
+                options: HashMap::new(),
+            });
+        }
+    }
+
     // Externals handler — priority 20 so the precise `externals.toml`
     // match wins over any user-overridden `*.toml`-ish shell glob.
     for pattern in &mappings.externals {
@@ -699,6 +1285,145 @@ pub fn mappings_to_rules(mappings: &MappingsSection) -> Vec<Rule> {
                 handler: "external".into(),
                 priority: 20,
                 case_insensitive: false,
+                executable: false,
+                options: HashMap::new(),
+            });
+        }
+    }
+
+    // Plugins handler — priority 20, same reasoning as externals.
+    for pattern in &mappings.plugins {
+        if !pattern.is_empty() {
+            rules.push(Rule {
+                pattern: pattern.clone(),
+                handler: crate::handlers::HANDLER_PLUGINS.into(),
+                priority: 20,
+                case_insensitive: false,
+                executable: false,
+                options: HashMap::new(),
+            });
+        }
+    }
+
+    // Download handler — priority 20, same reasoning as externals.
+    for pattern in &mappings.download {
+        if !pattern.is_empty() {
+            rules.push(Rule {
+                pattern: pattern.clone(),
+                handler: crate::handlers::HANDLER_DOWNLOAD.into(),
+                priority: 20,
+                case_insensitive: false,
+                executable: false,
+                options: HashMap::new(),
+            });
+        }
+    }
+
+    // SSH keys handler — priority 20, same reasoning as externals.
+    for pattern in &mappings.sshkeys {
+        if !pattern.is_empty() {
+            rules.push(Rule {
+                pattern: pattern.clone(),
+                handler: crate::handlers::HANDLER_SSHKEYS.into(),
+                priority: 20,
+                case_insensitive: false,
+                executable: false,
+                options: HashMap::new(),
+            });
+        }
+    }
+
+    // Containers handler — priority 20, same reasoning as externals.
+    for pattern in &mappings.containers {
+        if !pattern.is_empty() {
+            rules.push(Rule {
+                pattern: pattern.clone(),
+                handler: crate::handlers::HANDLER_CONTAINERS.into(),
+                priority: 20,
+                case_insensitive: false,
+                executable: false,
+                options: HashMap::new(),
+            });
+        }
+    }
+
+    // Gitconfig handler — priority 20, same reasoning as externals.
+    for pattern in &mappings.gitconfig {
+        if !pattern.is_empty() {
+            rules.push(Rule {
+                pattern: pattern.clone(),
+                handler: crate::handlers::HANDLER_GITCONFIG.into(),
+                priority: 20,
+                case_insensitive: false,
+                executable: false,
+                options: HashMap::new(),
+            });
+        }
+    }
+
+    // System handler — a directory pattern like `path`, priority 20
+    // so a `_system/` tree is never handed to the catchall.
+    if !mappings.system.is_empty() {
+        let pattern = if mappings.system.ends_with('/') {
+            mappings.system.clone()
+        } else {
+            format!("{}/", mappings.system)
+        };
+        rules.push(Rule {
+            pattern,
+            handler: crate::handlers::HANDLER_SYSTEM.into(),
+            priority: 20,
+            case_insensitive: false,
+            executable: false,
+            options: HashMap::new(),
+        });
+    }
+
+    // Autostart handler — a directory pattern like `system`.
+    if !mappings.autostart.is_empty() {
+        let pattern = if mappings.autostart.ends_with('/') {
+            mappings.autostart.clone()
+        } else {
+            format!("{}/", mappings.autostart)
+        };
+        rules.push(Rule {
+            pattern,
+            handler: crate::handlers::HANDLER_AUTOSTART.into(),
+            priority: 20,
+            case_insensitive: false,
+            executable: false,
+            options: HashMap::new(),
+        });
+    }
+
+    // Editors handler — directory patterns like `autostart`.
+    for name in &mappings.editors {
+        if !name.is_empty() {
+            let pattern = if name.ends_with('/') {
+                name.clone()
+            } else {
+                format!("{name}/")
+            };
+            rules.push(Rule {
+                pattern,
+                handler: crate::handlers::HANDLER_EDITORS.into(),
+                priority: 20,
+                case_insensitive: false,
+                executable: false,
+                options: HashMap::new(),
+            });
+        }
+    }
+
+    // Agent handler — priority 20, same reasoning as externals.
+    for pattern in &mappings.agent {
+        if !pattern.is_empty() {
+            rules.push(Rule {
+                pattern: pattern.clone(),
+                handler: crate::handlers::HANDLER_AGENT.into(),
+                priority: 20,
+                case_insensitive: false,
+                executable: false,
                 options: HashMap::new(),
             });
         }
@@ -715,6 +1440,7 @@ pub fn mappings_to_rules(mappings: &MappingsSection) -> Vec<Rule> {
                 handler: crate::handlers::HANDLER_IGNORE.into(),
                 priority: 100,
                 case_insensitive: false,
+                executable: false,
                 options: HashMap::new(),
             });
         }
@@ -733,6 +1459,7 @@ pub fn mappings_to_rules(mappings: &MappingsSection) -> Vec<Rule> {
                 handler: crate::handlers::HANDLER_SKIP.into(),
                 priority: 50,
                 case_insensitive: true,
+                executable: false,
                 options: HashMap::new(),
             });
         }
@@ -744,12 +1471,71 @@ pub fn mappings_to_rules(mappings: &MappingsSection) -> Vec<Rule> {
         handler: "symlink".into(),
         priority: 0,
         case_insensitive: false,
+        executable: false,
         options: HashMap::new(),
     });
 
     rules
 }
 
+/// The `[[rules]]` entries as [`Rule`]s, options normalized. Fails on
+/// the first invalid entry; `scope` names where the config came from
+/// (`"pack vim"`, `"the root config"`) for the message.
+///
+/// A rule whose `roles` the machine (`host_roles`) has none of still
+/// claims its files, but for the `gate` handler: they are skipped and
+/// `dodot status` says why, rather than falling through to the next
+/// rule.
+pub fn user_rules(rules: &[RuleSpec], scope: &str, host_roles: &[String]) -> Result<Vec<Rule>> {
+    rules
+        .iter()
+        .enumerate()
+        .map(|(index, spec)| {
+            let invalid = |reason: String| {
+                DodotError::Config(format!(
+                    "invalid [[rules]] entry #{} (pattern {:?}) in {scope}: {reason}",
+                    index + 1,
+                    spec.pattern
+                ))
+            };
+            if spec.pattern.is_empty() {
+                return Err(invalid("`pattern` is empty".into()));
+            }
+            let options = crate::handlers::options::validate_options(&spec.handler, &spec.options)
+                .map_err(invalid)?;
+            if !spec.roles.is_empty() && !spec.roles.iter().any(|r| host_roles.contains(r)) {
+                let options = std::collections::HashMap::from([
+                    ("gate_label".into(), crate::gates::ROLE_MISMATCH.into()),
+                    (
+                        "gate_predicate".into(),
+                        format!("roles={}", spec.roles.join(",")),
+                    ),
+                    (
+                        "gate_host".into(),
+                        format!("roles={}", crate::gates::describe_roles(host_roles)),
+                    ),
+                ]);
+                return Ok(Rule {
+                    pattern: spec.pattern.clone(),
+                    handler: crate::handlers::HANDLER_GATE.into(),
+                    priority: spec.priority.unwrap_or(DEFAULT_RULE_PRIORITY),
+                    case_insensitive: false,
+                    executable: false,
+                    options,
+                });
+            }
+            Ok(Rule {
+                pattern: spec.pattern.clone(),
+                handler: spec.handler.clone(),
+                priority: spec.priority.unwrap_or(DEFAULT_RULE_PRIORITY),
+                case_insensitive: false,
+                executable: false,
+                options,
+            })
+        })
+        .collect()
+}
+
 // ── ConfigManager ───────────────────────────────────────────────
 
 /// Manages configuration loading and per-pack resolution.
@@ -790,12 +1576,11 @@ impl ConfigManager {
     /// Rejects root-level `[pack] os` since gating every pack from
     /// the root would silently neutralise the dotfiles repo for
     /// hosts not in the list — almost always a misconfiguration.
-    /// `[pack] os` is meaningful at pack-level only.
+    /// `[pack] os` is meaningful at pack-level only. Root-level
+    /// `[pack] roles`, `[pack] verify` and the pack metadata keys are
+    /// rejected for the same reason: every pack would inherit them.
     pub fn root_config(&self) -> Result<DodotConfig> {
-        let cfg = self
-            .resolver
-            .resolve_at(&self.dotfiles_root)
-            .map_err(|e| DodotError::Config(format!("failed to load root config: {e}")))?;
+        let cfg = self.resolve(&self.dotfiles_root, "root")?;
         if !cfg.pack.os.is_empty() {
             return Err(DodotError::Config(format!(
                 "root-level `[pack] os` is not allowed (found `os = {:?}` in \
@@ -804,6 +1589,44 @@ impl ConfigManager {
                 cfg.pack.os
             )));
         }
+        if !cfg.pack.roles.is_empty() {
+            return Err(DodotError::Config(format!(
+                "root-level `[pack] roles` is not allowed (found `roles = {:?}` \
+                 in the root .dodot.toml). It would skip every pack on machines \
+                 without those roles — move it into the specific pack's .dodot.toml.",
+                cfg.pack.roles
+            )));
+        }
+        let layout = crate::packs::Layout::parse(&cfg.pack.layout).ok_or_else(|| {
+            DodotError::Config(format!(
+                "invalid `[pack] layout = {:?}`: expected \"packs\" or \"flat\"",
+                cfg.pack.layout
+            ))
+        })?;
+        // A flat root is its own pack, so its checks are that pack's.
+        if !cfg.pack.verify.is_empty() && layout != crate::packs::Layout::Flat {
+            return Err(DodotError::Config(format!(
+                "root-level `[pack] verify` is not allowed (found `verify = {:?}` \
+                 in the root .dodot.toml). Checks belong to one pack — move \
+                 them into that pack's .dodot.toml.",
+                cfg.pack.verify
+            )));
+        }
+        if let Some(key) = metadata_key_set(&cfg.pack) {
+            if layout != crate::packs::Layout::Flat {
+                return Err(DodotError::Config(format!(
+                    "root-level `[pack] {key}` is not allowed. Pack metadata \
+                     describes one pack — move it into that pack's .dodot.toml."
+                )));
+            }
+        }
+        check_min_dodot(&cfg)?;
+        check_symlink_mode(&cfg)?;
+        check_path_position(&cfg)?;
+        check_install(&cfg)?;
+        crate::notify::check_config(&cfg.notify)?;
+        crate::shell::lint::check_config(&cfg.lint)?;
+        user_rules(&cfg.rules, "the root config", &[])?;
         Ok(cfg)
     }
 
@@ -812,10 +1635,47 @@ impl ConfigManager {
     /// Resolves by walking from `pack_path` up through ancestors,
     /// merging any `.dodot.toml` files found along the way (including
     /// the root config). Results are cached by absolute path.
+    /// `include` entries in any of those files are expanded in place.
     pub fn config_for_pack(&self, pack_path: &Path) -> Result<DodotConfig> {
-        self.resolver
-            .resolve_at(pack_path)
-            .map_err(|e| DodotError::Config(format!("failed to load pack config: {e}")))
+        let mut cfg = self.resolve(pack_path, "pack")?;
+        // `[system]` is root-only: a pack must not be able to opt
+        // itself into writing outside `$HOME`, or loosen the
+        // confirmation and protection around it. For the same reason
+        // its protected paths extend the root's.
+        let root = self.resolve(&self.dotfiles_root, "root")?;
+        cfg.system = root.system;
+        let mut protected = root.symlink.protected_paths;
+        for path in std::mem::take(&mut cfg.symlink.protected_paths) {
+            if !protected.contains(&path) {
+                protected.push(path);
+            }
+        }
+        cfg.symlink.protected_paths = protected;
+        cfg.symlink.link_strategy = root.symlink.link_strategy;
+        check_min_dodot(&cfg)?;
+        check_symlink_mode(&cfg)?;
+        check_path_position(&cfg)?;
+        check_install(&cfg)?;
+        let pack = pack_path
+            .file_name()
+            .map(|n| n.to_string_lossy().into_owned())
+            .unwrap_or_default();
+        user_rules(&cfg.rules, &format!("pack {pack}"), &[])?;
+        Ok(cfg)
+    }
+
+    /// clapfig resolution, redone with includes expanded when a file
+    /// in the chain declares any. clapfig still runs first so its
+    /// diagnostics (unknown keys, bad types) cover the files themselves.
+    fn resolve(&self, at: &Path, layer: &str) -> Result<DodotConfig> {
+        let cfg = self
+            .resolver
+            .resolve_at(at)
+            .map_err(|e| DodotError::Config(format!("failed to load {layer} config: {e}")))?;
+        if !include::chain_has_includes(at, &self.dotfiles_root) {
+            return Ok(cfg);
+        }
+        include::resolve(at, &self.dotfiles_root)
     }
 
     pub fn dotfiles_root(&self) -> &Path {
@@ -823,6 +1683,103 @@ impl ConfigManager {
     }
 }
 
+/// Reject unknown `[symlink] mode`, `link_strategy` and `large_files`
+/// values, and `[symlink.targets]` values using unknown variables, at
+/// load time rather than silently falling back to the defaults.
+fn check_symlink_mode(cfg: &DodotConfig) -> Result<()> {
+    if crate::operations::LinkMode::parse(&cfg.symlink.mode).is_none() {
+        return Err(DodotError::Config(format!(
+            "invalid `[symlink] mode = {:?}`: expected \"symlink\", \"copy\", or \"hardlink\"",
+            cfg.symlink.mode
+        )));
+    }
+    if crate::operations::LinkStrategy::parse(&cfg.symlink.link_strategy).is_none() {
+        return Err(DodotError::Config(format!(
+            "invalid `[symlink] link_strategy = {:?}`: expected \"double\" or \"direct\"",
+            cfg.symlink.link_strategy
+        )));
+    }
+    if crate::handlers::symlink::guard::LargeFiles::parse(&cfg.symlink.large_files).is_none() {
+        return Err(DodotError::Config(format!(
+            "invalid `[symlink] large_files = {:?}`: expected \"warn\", \"skip\", or \"off\"",
+            cfg.symlink.large_files
+        )));
+    }
+    for path in &cfg.symlink.protected_paths {
+        glob::Pattern::new(path).map_err(|e| {
+            DodotError::Config(format!(
+                "invalid `[symlink] protected_paths` entry {path:?}: {e}"
+            ))
+        })?;
+    }
+    for (file, target) in &cfg.symlink.targets {
+        crate::paths::check_target(target).map_err(|reason| {
+            DodotError::Config(format!(
+                "invalid `[symlink.targets]` entry {file:?} = {target:?}: {reason}"
+            ))
+        })?;
+    }
+    Ok(())
+}
+
+/// The first pack metadata key set in `pack`, for the root-level check.
+fn metadata_key_set(pack: &PackSection) -> Option<&'static str> {
+    [
+        ("description", &pack.description),
+        ("author", &pack.author),
+        ("version", &pack.version),
+        ("url", &pack.url),
+        ("min_dodot", &pack.min_dodot),
+    ]
+    .into_iter()
+    .find(|(_, value)| !value.is_empty())
+    .map(|(key, _)| key)
+}
+
+/// Reject a `[pack] min_dodot` that isn't a version. An unmet one is
+/// not an error here: the pack is skipped, see
+/// [`crate::packs::orchestration::drop_incompatible`].
+fn check_min_dodot(cfg: &DodotConfig) -> Result<()> {
+    let min = &cfg.pack.min_dodot;
+    if !min.is_empty() && crate::packs::metadata::parse_version(min).is_none() {
+        return Err(DodotError::Config(format!(
+            "invalid `[pack] min_dodot = {min:?}`: expected a version like \"5.2\""
+        )));
+    }
+    Ok(())
+}
+
+/// Reject an `[install] nice` outside what an unprivileged user can
+/// ask `nice` for.
+fn check_install(cfg: &DodotConfig) -> Result<()> {
+    if !(0..=19).contains(&cfg.install.nice) {
+        return Err(DodotError::Config(format!(
+            "invalid `[install] nice = {}`: expected 0 (off) to 19",
+            cfg.install.nice
+        )));
+    }
+    Ok(())
+}
+
+/// Reject unknown `[path] position` values, in the section and in
+/// `[path.positions]`.
+fn check_path_position(cfg: &DodotConfig) -> Result<()> {
+    let entries = std::iter::once(("[path] position".to_string(), &cfg.path.position)).chain(
+        cfg.path
+            .positions
+            .iter()
+            .map(|(dir, pos)| (format!("[path.positions] {dir:?}"), pos)),
+    );
+    for (key, value) in entries {
+        if crate::shell::PathPosition::parse(value).is_none() {
+            return Err(DodotError::Config(format!(
+                "invalid `{key} = {value:?}`: expected \"prepend\" or \"append\""
+            )));
+        }
+    }
+    Ok(())
+}
+
 #[cfg(test)]
 mod tests {
     use super::*;
@@ -905,8 +1862,33 @@ mod tests {
         );
         assert_eq!(cfg.mappings.homebrew, "Brewfile");
         assert_eq!(cfg.mappings.nix, "packages.nix");
+        assert_eq!(cfg.mappings.npm, "npm-packages.txt");
+        assert_eq!(cfg.mappings.gem, "gems.txt");
+        assert_eq!(cfg.mappings.asdf, ".tool-versions");
+        assert_eq!(cfg.mappings.flake, "flake.nix");
         assert_eq!(cfg.mappings.shell, vec!["*.sh", "*.bash", "*.zsh"]);
         assert_eq!(cfg.mappings.externals, vec!["externals.toml"]);
+        assert_eq!(cfg.mappings.plugins, vec!["plugins.toml"]);
+        assert_eq!(cfg.mappings.download, vec!["tools.toml"]);
+        assert_eq!(cfg.mappings.sshkeys, vec!["sshkeys.toml"]);
+        assert_eq!(
+            cfg.mappings.containers,
+            vec!["containers.toml", "devcontainer.toml"]
+        );
+        assert_eq!(cfg.mappings.gitconfig, vec!["*.gitinclude"]);
+        assert_eq!(cfg.symlink.large_files, "warn");
+        assert_eq!(cfg.symlink.max_file_size_mb, 50);
+        assert_eq!(cfg.symlink.max_binary_size_kb, 1024);
+        assert_eq!(cfg.mappings.system, "_system");
+        assert_eq!(cfg.mappings.autostart, "autostart");
+        assert_eq!(
+            cfg.mappings.editors,
+            vec!["vscode", "vscode-insiders", "vscodium", "jetbrains"]
+        );
+        assert_eq!(cfg.mappings.agent, vec!["agent.toml"]);
+        assert!(!cfg.system.enabled);
+        assert!(cfg.system.confirm);
+        assert!(cfg.system.protected.iter().any(|p| p == "/etc/sudoers"));
         assert!(cfg.mappings.ignore.is_empty());
         assert!(
             cfg.mappings.skip.iter().any(|p| p == "README"),
@@ -917,6 +1899,10 @@ mod tests {
         // ── profiling defaults ──────────────────────────────────
         assert!(cfg.profiling.enabled);
         assert_eq!(cfg.profiling.keep_last_runs, 100);
+
+        // ── datastore defaults ──────────────────────────────────
+        assert_eq!(cfg.datastore.backend, "filesystem");
+        assert!(!cfg.datastore.per_host);
     }
 
     #[test]
@@ -960,6 +1946,65 @@ homebrew = "MyBrewfile"
         assert_eq!(cfg.mappings.path, "bin");
     }
 
+    #[test]
+    fn system_section_is_root_only() {
+        let env = TempEnvironment::builder()
+            .pack("work")
+            .file("x", "x")
+            .config("[system]\nenabled = true\nconfirm = false\n")
+            .done()
+            .build();
+        env.fs
+            .write_file(
+                &env.dotfiles_root.join(".dodot.toml"),
+                b"[system]\nprotected = [\"/etc/hosts\"]\n",
+            )
+            .unwrap();
+
+        let mgr = ConfigManager::new(&env.dotfiles_root).unwrap();
+        let cfg = mgr
+            .config_for_pack(&env.dotfiles_root.join("work"))
+            .unwrap();
+        assert!(!cfg.system.enabled);
+        assert!(cfg.system.confirm);
+        assert_eq!(cfg.system.protected, vec!["/etc/hosts"]);
+    }
+
+    #[test]
+    fn pack_protected_paths_extend_the_root_list() {
+        let env = TempEnvironment::builder()
+            .pack("work")
+            .file("x", "x")
+            .config("[symlink]\nprotected_paths = [\".work/token\"]\n")
+            .done()
+            .build();
+        env.fs
+            .write_file(
+                &env.dotfiles_root.join(".dodot.toml"),
+                b"[symlink]\nprotected_paths = [\".ssh/id_*\"]\n",
+            )
+            .unwrap();
+
+        let mgr = ConfigManager::new(&env.dotfiles_root).unwrap();
+        let cfg = mgr
+            .config_for_pack(&env.dotfiles_root.join("work"))
+            .unwrap();
+        assert_eq!(cfg.symlink.protected_paths, [".ssh/id_*", ".work/token"]);
+
+        env.fs
+            .write_file(
+                &env.dotfiles_root.join(".dodot.toml"),
+                b"[symlink]\nprotected_paths = [\".ssh/[id\"]\n",
+            )
+            .unwrap();
+        let err = ConfigManager::new(&env.dotfiles_root)
+            .unwrap()
+            .root_config()
+            .unwrap_err()
+            .to_string();
+        assert!(err.contains("protected_paths` entry \".ssh/[id\""), "{err}");
+    }
+
     #[test]
     fn pack_config_overrides_root() {
         let env = TempEnvironment::builder()
@@ -1007,20 +2052,41 @@ homebrew = "RootBrewfile"
     fn mappings_to_rules_produces_expected_rules() {
         let mappings = MappingsSection {
             path: "bin".into(),
+            executable: true,
             install: vec!["install.sh".into(), "install.zsh".into()],
             shell: vec!["aliases.sh".into(), "profile.sh".into()],
             homebrew: "Brewfile".into(),
             nix: "packages.nix".into(),
+            npm: "npm-packages.txt".into(),
+            pip: "requirements-global.txt".into(),
+            cargo: "cargo-crates.txt".into(),
+            gem: "gems.txt".into(),
+            asdf: ".tool-versions".into(),
+            mise: "mise.toml".into(),
+            flake: "flake.nix".into(),
             externals: vec!["externals.toml".into()],
+            plugins: vec!["plugins.toml".into()],
+            download: vec!["tools.toml".into()],
+            sshkeys: vec!["sshkeys.toml".into()],
+            containers: vec!["containers.toml".into()],
+            gitconfig: vec!["*.gitinclude".into()],
+            system: "_system".into(),
+            autostart: "autostart".into(),
+            editors: vec!["vscode".into()],
+            agent: vec!["agent.toml".into()],
             ignore: vec!["*.tmp".into()],
             skip: vec![],
             gates: std::collections::HashMap::new(),
+            platform_suffixes: false,
         };
 
         let rules = mappings_to_rules(&mappings);
 
-        // path + 2 install + 2 shell + homebrew + nix + externals + ignore + catchall = 10
-        assert_eq!(rules.len(), 10, "rules: {rules:#?}");
+        // path + 2 install + 2 shell + homebrew + nix + npm/pip/cargo/gem
+        // + asdf/mise/flake + externals + plugins + download + sshkeys
+        // + containers + gitconfig + system + autostart + editors + agent
+        // + ignore + executable + catchall = 27
+        assert_eq!(rules.len(), 27, "rules: {rules:#?}");
 
         let handler_names: Vec<&str> = rules.iter().map(|r| r.handler.as_str()).collect();
         assert!(handler_names.contains(&"path"));
@@ -1028,7 +2094,23 @@ homebrew = "RootBrewfile"
         assert!(handler_names.contains(&"shell"));
         assert!(handler_names.contains(&"homebrew"));
         assert!(handler_names.contains(&"nix"));
+        assert!(handler_names.contains(&"npm"));
+        assert!(handler_names.contains(&"pip"));
+        assert!(handler_names.contains(&"cargo"));
+        assert!(handler_names.contains(&"gem"));
+        assert!(handler_names.contains(&"asdf"));
+        assert!(handler_names.contains(&"mise"));
+        assert!(handler_names.contains(&"flake"));
         assert!(handler_names.contains(&"external"));
+        assert!(handler_names.contains(&"plugins"));
+        assert!(handler_names.contains(&"download"));
+        assert!(handler_names.contains(&"sshkeys"));
+        assert!(handler_names.contains(&"containers"));
+        assert!(handler_names.contains(&"gitconfig"));
+        assert!(handler_names.contains(&"system"));
+        assert!(handler_names.contains(&"autostart"));
+        assert!(handler_names.contains(&"editors"));
+        assert!(handler_names.contains(&"agent"));
         assert!(handler_names.contains(&"ignore"));
         assert!(handler_names.contains(&"symlink"));
 
@@ -1039,8 +2121,14 @@ homebrew = "RootBrewfile"
         assert!(!ignore.pattern.starts_with('!'));
         assert!(!ignore.case_insensitive);
 
-        // Catchall should be lowest priority
-        let catchall = rules.iter().find(|r| r.pattern == "*").unwrap();
+        // Executables sit just above the catchall, which should be
+        // lowest priority
+        let executable = rules.iter().find(|r| r.executable).unwrap();
+        assert_eq!(
+            (executable.handler.as_str(), executable.priority),
+            ("path", 5)
+        );
+        let catchall = rules.iter().find(|r| r.handler == "symlink").unwrap();
         assert_eq!(catchall.priority, 0);
     }
 
@@ -1053,14 +2141,32 @@ homebrew = "RootBrewfile"
     fn install_rules_outrank_shell_glob() {
         let mappings = MappingsSection {
             path: "bin".into(),
+            executable: false,
             install: vec!["install.sh".into()],
             shell: vec!["*.sh".into()],
             homebrew: String::new(),
             nix: String::new(),
+            npm: String::new(),
+            pip: String::new(),
+            cargo: String::new(),
+            gem: String::new(),
+            asdf: String::new(),
+            mise: String::new(),
+            flake: String::new(),
             externals: vec![],
+            plugins: vec![],
+            download: vec![],
+            sshkeys: vec![],
+            containers: vec![],
+            gitconfig: vec![],
+            system: String::new(),
+            autostart: String::new(),
+            editors: vec![],
+            agent: vec![],
             ignore: vec![],
             skip: vec![],
             gates: std::collections::HashMap::new(),
+            platform_suffixes: false,
         };
 
         let rules = mappings_to_rules(&mappings);
@@ -1079,14 +2185,32 @@ homebrew = "RootBrewfile"
     fn mappings_skip_emits_priority_50_skip_rules() {
         let mappings = MappingsSection {
             path: String::new(),
+            executable: false,
             install: vec![],
             shell: vec![],
             homebrew: String::new(),
             nix: String::new(),
+            npm: String::new(),
+            pip: String::new(),
+            cargo: String::new(),
+            gem: String::new(),
+            asdf: String::new(),
+            mise: String::new(),
+            flake: String::new(),
             externals: vec![],
+            plugins: vec![],
+            download: vec![],
+            sshkeys: vec![],
+            containers: vec![],
+            gitconfig: vec![],
+            system: String::new(),
+            autostart: String::new(),
+            editors: vec![],
+            agent: vec![],
             ignore: vec![],
             skip: vec!["README".into(), "README.*".into(), "LICENSE".into()],
             gates: std::collections::HashMap::new(),
+            platform_suffixes: false,
         };
 
         let rules = mappings_to_rules(&mappings);
@@ -1209,4 +2333,81 @@ os = ["darwin"]
         assert!(msg.contains("[pack] os"), "missing key: {msg}");
         assert!(msg.contains("darwin"), "missing offending value: {msg}");
     }
+
+    #[test]
+    fn verify_is_pack_level_only() {
+        let env = TempEnvironment::builder().pack("git").done().build();
+        env.fs
+            .write_file(
+                &env.dotfiles_root.join("git/.dodot.toml"),
+                b"[pack]\nverify = [\"git --version\"]\n",
+            )
+            .unwrap();
+        let mgr = ConfigManager::new(&env.dotfiles_root).unwrap();
+        let cfg = mgr.config_for_pack(&env.dotfiles_root.join("git")).unwrap();
+        assert_eq!(cfg.pack.verify, ["git --version"]);
+
+        env.fs
+            .write_file(
+                &env.dotfiles_root.join(".dodot.toml"),
+                b"[pack]\nverify = [\"true\"]\n",
+            )
+            .unwrap();
+        let mgr = ConfigManager::new(&env.dotfiles_root).unwrap();
+        let msg = mgr.root_config().unwrap_err().to_string();
+        assert!(msg.contains("[pack] verify"), "{msg}");
+    }
+
+    #[test]
+    fn rules_are_loaded_with_default_priority() {
+        let env = TempEnvironment::builder().pack("etc").done().build();
+        env.fs
+            .write_file(
+                &env.dotfiles_root.join("etc/.dodot.toml"),
+                br#"
+[[rules]]
+pattern = "hosts"
+handler = "symlink"
+options = { target = "/etc/hosts" }
+"#,
+            )
+            .unwrap();
+
+        let mgr = ConfigManager::new(&env.dotfiles_root).unwrap();
+        let cfg = mgr.config_for_pack(&env.dotfiles_root.join("etc")).unwrap();
+        let rules = user_rules(&cfg.rules, "pack etc", &[]).unwrap();
+        assert_eq!(rules.len(), 1);
+        assert_eq!(rules[0].priority, DEFAULT_RULE_PRIORITY);
+        assert_eq!(rules[0].options["target"], "/etc/hosts");
+    }
+
+    #[test]
+    fn invalid_rule_options_name_pack_index_and_allowed_keys() {
+        let env = TempEnvironment::builder().pack("etc").done().build();
+        env.fs
+            .write_file(
+                &env.dotfiles_root.join("etc/.dodot.toml"),
+                br#"
+[[rules]]
+pattern = "motd"
+handler = "shell"
+
+[[rules]]
+pattern = "hosts"
+handler = "symlink"
+options = { destination = "/etc/hosts" }
+"#,
+            )
+            .unwrap();
+
+        let mgr = ConfigManager::new(&env.dotfiles_root).unwrap();
+        let msg = mgr
+            .config_for_pack(&env.dotfiles_root.join("etc"))
+            .unwrap_err()
+            .to_string();
+        assert!(msg.contains("pack etc"), "missing pack: {msg}");
+        assert!(msg.contains("#2"), "missing rule index: {msg}");
+        assert!(msg.contains("`destination`"), "missing bad key: {msg}");
+        assert!(msg.contains("`target`"), "missing allowed keys: {msg}");
+    }
 }
@@ -124,24 +124,39 @@ pub fn detect_cross_pack_conflicts(
                     });
             }
 
-            // PATH executable shadowing: list files inside staged directories
+            // PATH executable shadowing: list files inside staged
+            // directories, or the staged file itself
             if let HandlerIntent::Stage {
                 handler, source, ..
             } = intent
             {
                 if handler == HANDLER_PATH {
-                    if let Ok(entries) = fs.read_dir(source) {
-                        for entry in entries {
-                            if entry.is_file || entry.is_symlink {
-                                let key = Path::new("<path-executable>").join(&entry.name);
-                                kinds.insert(key.clone(), ConflictKind::PathExecutable);
-                                targets.entry(key).or_default().push(Claimant {
-                                    pack: pack_name.clone(),
-                                    handler: handler.clone(),
-                                    source: entry.path.clone(),
-                                });
-                            }
-                        }
+                    let executables: Vec<(String, PathBuf)> = if fs.is_dir(source) {
+                        fs.read_dir(source)
+                            .map(|entries| {
+                                entries
+                                    .into_iter()
+                                    .filter(|e| e.is_file || e.is_symlink)
+                                    .map(|e| (e.name, e.path))
+                                    .collect()
+                            })
+                            .unwrap_or_default()
+                    } else if fs.exists(source) {
+                        source
+                            .file_name()
+                            .map(|n| vec![(n.to_string_lossy().into_owned(), source.clone())])
+                            .unwrap_or_default()
+                    } else {
+                        Vec::new()
+                    };
+                    for (name, path) in executables {
+                        let key = Path::new("<path-executable>").join(&name);
+                        kinds.insert(key.clone(), ConflictKind::PathExecutable);
+                        targets.entry(key).or_default().push(Claimant {
+                            pack: pack_name.clone(),
+                            handler: handler.clone(),
+                            source: path,
+                        });
                     }
                 }
             }
@@ -185,6 +200,7 @@ fn intent_source(intent: &HandlerIntent) -> PathBuf {
             crate::external::FetchSpec::GitRepo { url, .. } => PathBuf::from(url),
             crate::external::FetchSpec::Archive { url, .. } => PathBuf::from(url),
             crate::external::FetchSpec::ArchiveFile { url, .. } => PathBuf::from(url),
+            crate::external::FetchSpec::Binary { url, .. } => PathBuf::from(url),
             crate::external::FetchSpec::Unsupported => PathBuf::from(format!("<external:{name}>")),
         },
     }
@@ -193,6 +209,7 @@ fn intent_source(intent: &HandlerIntent) -> PathBuf {
 #[cfg(test)]
 mod tests {
     use super::*;
+    use crate::operations::LinkMode;
     use crate::testing::TempEnvironment;
 
     fn link(pack: &str, source: &str, user_path: &str) -> HandlerIntent {
@@ -201,6 +218,8 @@ mod tests {
             handler: "symlink".into(),
             source: PathBuf::from(source),
             user_path: PathBuf::from(user_path),
+            mode: LinkMode::Symlink,
+            perms: None,
         }
     }
 
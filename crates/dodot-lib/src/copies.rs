@@ -0,0 +1,257 @@
+//! Copy and hard-link deployment for the symlink handler
+//! (`[symlink] mode = "copy" | "hardlink"`).
+//!
+//! In the default mode the user path is a symlink, so "is it current?"
+//! is answered by following the chain. A copy has no chain to follow,
+//! so at deploy time we record a content hash of what was written. The
+//! record lives in the datastore under the `copies` pseudo-handler
+//! directory (the same arrangement `preprocessed` uses for rendered
+//! files), keyed by a hash of the user path, and is swept by `down`
+//! together with the rest of the pack's state.
+//!
+//! Comparing three hashes — source now, target now, recorded at deploy
+//! — tells `status` and the executor which side moved (see
+//! [`CopyState`]). Hard links share an inode with the source, so they
+//! stay [`CopyState::Current`] until something (typically an editor
+//! that writes via rename) breaks the link; from then on they behave
+//! like a copy.
+
+use std::io::Read;
+use std::path::{Path, PathBuf};
+
+use sha2::{Digest, Sha256};
+
+use crate::fs::Fs;
+use crate::operations::LinkMode;
+use crate::paths::Pather;
+use crate::Result;
+
+/// Pseudo-handler directory under `packs/<pack>/` holding deploy
+/// records for copied / hard-linked targets.
+pub const COPIES_DIR: &str = "copies";
+
+/// Where a copied target stands relative to its source and to what
+/// dodot last deployed there.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum CopyState {
+    /// Target content matches the source.
+    Current,
+    /// Source changed since the last deploy; the target is exactly what
+    /// dodot wrote. Re-deploying updates it safely.
+    SourceChanged,
+    /// Target was edited in place since the last deploy. Re-deploying
+    /// would discard those edits, so it requires `--force`.
+    TargetEdited,
+    /// Nothing at the target path.
+    Missing,
+    /// Target exists, differs from the source, and dodot has no record
+    /// of deploying it — a pre-existing file.
+    Unrecorded,
+}
+
+/// 16-hex content digest of a file, or of a directory tree (relative
+/// paths and file bytes, in sorted order). Same width as the run-once
+/// sentinel hashes.
+pub fn content_hash(fs: &dyn Fs, path: &Path) -> Result<String> {
+    let mut hasher = Sha256::new();
+    hash_into(fs, path, Path::new(""), &mut hasher)?;
+    Ok(hex16(&hasher.finalize()))
+}
+
+fn hash_into(fs: &dyn Fs, path: &Path, rel: &Path, hasher: &mut Sha256) -> Result<()> {
+    if fs.is_dir(path) {
+        let mut entries = fs.read_dir(path)?;
+        entries.sort_by(|a, b| a.name.cmp(&b.name));
+        for entry in entries {
+            hash_into(fs, &entry.path, &rel.join(&entry.name), hasher)?;
+        }
+        return Ok(());
+    }
+    hasher.update(rel.to_string_lossy().as_bytes());
+    hasher.update([0u8]);
+    let mut reader = fs.open_read(path)?;
+    let mut buf = [0u8; 8192];
+    loop {
+        let n = reader.read(&mut buf).map_err(|e| crate::DodotError::Fs {
+            path: path.to_path_buf(),
+            source: e,
+        })?;
+        if n == 0 {
+            break;
+        }
+        hasher.update(&buf[..n]);
+    }
+    Ok(())
+}
+
+fn hex16(digest: &[u8]) -> String {
+    digest[..8].iter().map(|b| format!("{b:02x}")).collect()
+}
+
+/// Path of the deploy record for `user_path` in `pack`.
+pub fn record_path(paths: &dyn Pather, pack: &str, user_path: &Path) -> PathBuf {
+    let key = hex16(&Sha256::digest(user_path.to_string_lossy().as_bytes()));
+    paths.handler_data_dir(pack, COPIES_DIR).join(key)
+}
+
+/// The content hash recorded when `user_path` was last deployed, if any.
+pub fn recorded_hash(
+    fs: &dyn Fs,
+    paths: &dyn Pather,
+    pack: &str,
+    user_path: &Path,
+) -> Option<String> {
+    let content = fs
+        .read_to_string(&record_path(paths, pack, user_path))
+        .ok()?;
+    // `<hash>\t<user_path>` — the path is only there for humans
+    // poking around the data dir.
+    content.split('\t').next().map(str::to_string)
+}
+
+/// Record that `user_path` now holds content hashing to `hash`.
+pub fn write_record(
+    fs: &dyn Fs,
+    paths: &dyn Pather,
+    pack: &str,
+    user_path: &Path,
+    hash: &str,
+) -> Result<()> {
+    let path = record_path(paths, pack, user_path);
+    if let Some(parent) = path.parent() {
+        fs.mkdir_all(parent)?;
+    }
+    fs.write_file_atomic(
+        &path,
+        format!("{hash}\t{}\n", user_path.display()).as_bytes(),
+    )
+}
+
+/// Classify a copied target. A symlink at `user_path` is not a copy
+/// and reports [`CopyState::Unrecorded`] unless missing entirely;
+/// callers handle symlinks before asking.
+pub fn copy_state(
+    fs: &dyn Fs,
+    paths: &dyn Pather,
+    pack: &str,
+    source: &Path,
+    user_path: &Path,
+) -> CopyState {
+    if !fs.exists(user_path) && !fs.is_symlink(user_path) {
+        return CopyState::Missing;
+    }
+    let target = content_hash(fs, user_path).ok();
+    let current = content_hash(fs, source).ok();
+    if target.is_some() && target == current {
+        return CopyState::Current;
+    }
+    match recorded_hash(fs, paths, pack, user_path) {
+        Some(recorded) if target.as_deref() == Some(recorded.as_str()) => CopyState::SourceChanged,
+        Some(_) => CopyState::TargetEdited,
+        None => CopyState::Unrecorded,
+    }
+}
+
+/// Write `source` to `user_path` as a copy or a hard link. Directories
+/// are recreated and populated file by file (directories themselves
+/// can't be hard-linked). The caller clears any existing target first.
+pub fn materialize(fs: &dyn Fs, source: &Path, user_path: &Path, mode: LinkMode) -> Result<()> {
+    if let Some(parent) = user_path.parent() {
+        fs.mkdir_all(parent)?;
+    }
+    if fs.is_dir(source) {
+        fs.mkdir_all(user_path)?;
+        for entry in fs.read_dir(source)? {
+            materialize(fs, &entry.path, &user_path.join(&entry.name), mode)?;
+        }
+        return Ok(());
+    }
+    match mode {
+        LinkMode::Hardlink => fs.hard_link(source, user_path),
+        LinkMode::Copy | LinkMode::Symlink => fs.copy_file(source, user_path),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::testing::TempEnvironment;
+
+    fn env_with_vimrc() -> TempEnvironment {
+        TempEnvironment::builder()
+            .pack("vim")
+            .file("vimrc", "set nocompatible")
+            .done()
+            .build()
+    }
+
+    #[test]
+    fn copy_state_tracks_which_side_moved() {
+        let env = env_with_vimrc();
+        let fs = env.fs.as_ref();
+        let paths = env.paths.as_ref();
+        let source = env.dotfiles_root.join("vim/vimrc");
+        let target = env.home.join(".vimrc");
+
+        assert_eq!(
+            copy_state(fs, paths, "vim", &source, &target),
+            CopyState::Missing
+        );
+
+        materialize(fs, &source, &target, LinkMode::Copy).unwrap();
+        let hash = content_hash(fs, &source).unwrap();
+        write_record(fs, paths, "vim", &target, &hash).unwrap();
+        assert_eq!(
+            copy_state(fs, paths, "vim", &source, &target),
+            CopyState::Current
+        );
+
+        fs.write_file(&source, b"set number").unwrap();
+        assert_eq!(
+            copy_state(fs, paths, "vim", &source, &target),
+            CopyState::SourceChanged
+        );
+
+        fs.write_file(&target, b"local edit").unwrap();
+        assert_eq!(
+            copy_state(fs, paths, "vim", &source, &target),
+            CopyState::TargetEdited
+        );
+    }
+
+    #[test]
+    fn unrecorded_target_is_reported_as_such() {
+        let env = env_with_vimrc();
+        let target = env.home.join(".vimrc");
+        env.fs.write_file(&target, b"hand-written").unwrap();
+
+        let state = copy_state(
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            "vim",
+            &env.dotfiles_root.join("vim/vimrc"),
+            &target,
+        );
+        assert_eq!(state, CopyState::Unrecorded);
+    }
+
+    #[test]
+    fn directory_hash_covers_names_and_content() {
+        let env = TempEnvironment::builder()
+            .pack("nvim")
+            .file("nvim/init.lua", "a")
+            .file("nvim/lua/x.lua", "b")
+            .done()
+            .build();
+        let fs = env.fs.as_ref();
+        let dir = env.dotfiles_root.join("nvim/nvim");
+        let before = content_hash(fs, &dir).unwrap();
+
+        let copy = env.home.join("copy");
+        materialize(fs, &dir, &copy, LinkMode::Copy).unwrap();
+        assert_eq!(content_hash(fs, &copy).unwrap(), before);
+
+        fs.write_file(&dir.join("lua/x.lua"), b"c").unwrap();
+        assert_ne!(content_hash(fs, &dir).unwrap(), before);
+    }
+}
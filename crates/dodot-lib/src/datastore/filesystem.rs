@@ -1,7 +1,7 @@
 use std::path::{Component, Path, PathBuf};
 use std::sync::Arc;
 
-use crate::datastore::{CommandRunner, DataStore, DidRunStatus};
+use crate::datastore::{CommandRunner, DataStore, DidRunStatus, SentinelRecord};
 use crate::fs::Fs;
 use crate::paths::Pather;
 use crate::{DodotError, Result};
@@ -33,14 +33,13 @@ const HASH_LEN: usize = 16;
 
 /// Parse the unix timestamp recorded in a sentinel file's content.
 ///
-/// `run_and_record` writes `completed|<unix-secs>` to each sentinel.
-/// Returns `Some(ts)` when the content has that shape, `None` for
-/// any other content (older sentinel formats, manually-edited files,
-/// truncated reads). Callers in `did_run` use this to order
-/// multiple non-matching sentinels by recency for tie-break.
+/// Accepts both the JSON [`SentinelRecord`] `run_and_record` writes
+/// and the legacy `completed|<unix-secs>` line. Returns `None` for
+/// any other content (manually-edited files, truncated reads).
+/// Callers in `did_run` use this to order multiple non-matching
+/// sentinels by recency for tie-break.
 fn parse_completed_timestamp(content: &str) -> Option<u64> {
-    let payload = content.trim_end().strip_prefix("completed|")?;
-    payload.parse::<u64>().ok()
+    SentinelRecord::parse(content).map(|r| r.completed_at)
 }
 
 /// Parse a sentinel filename into its `(filename, hash)` parts.
@@ -48,7 +47,7 @@ fn parse_completed_timestamp(content: &str) -> Option<u64> {
 /// Returns `None` for any name that doesn't end in `-<16 lowercase
 /// hex chars>` — including the `.snapshot` sibling files, which
 /// have a different suffix shape.
-fn extract_sentinel_hash(sentinel_name: &str) -> Option<(&str, &str)> {
+pub(super) fn extract_sentinel_hash(sentinel_name: &str) -> Option<(&str, &str)> {
     if sentinel_name.len() < HASH_LEN + 1 {
         return None;
     }
@@ -259,24 +258,23 @@ impl DataStore for FilesystemDataStore {
             }
         }
 
+        let started = std::time::Instant::now();
         let result = self.runner.run(executable, arguments);
+        let elapsed_ms = started.elapsed().as_millis() as u64;
         match &result {
             Ok(_) => eprintln!("{header}  {green}OK{reset}"),
             Err(_) => eprintln!("{header}  {red}FAILED{reset}"),
         }
         result?;
 
-        // Record sentinel
+        // Record sentinel (successful runs only)
         let sentinel_dir = self.paths.handler_data_dir(pack, handler);
         self.fs.mkdir_all(&sentinel_dir)?;
 
         let sentinel_path = sentinel_dir.join(sentinel);
-        let timestamp = std::time::SystemTime::now()
-            .duration_since(std::time::UNIX_EPOCH)
-            .unwrap_or_default()
-            .as_secs();
-        let content = format!("completed|{timestamp}");
-        self.fs.write_file(&sentinel_path, content.as_bytes())?;
+        let record = SentinelRecord::now(Some(elapsed_ms));
+        self.fs
+            .write_file_atomic(&sentinel_path, record.to_content().as_bytes())?;
 
         // Snapshot the file we just ran so that a future `did_run`
         // can return its previous content for diff display when the
@@ -291,7 +289,7 @@ impl DataStore for FilesystemDataStore {
             let snapshot_path = sentinel_dir.join(format!("{sentinel}{SNAPSHOT_SUFFIX}"));
             match self.fs.read_file(Path::new(path_str)) {
                 Ok(bytes) => {
-                    if let Err(e) = self.fs.write_file(&snapshot_path, &bytes) {
+                    if let Err(e) = self.fs.write_file_atomic(&snapshot_path, &bytes) {
                         tracing::warn!(
                             pack,
                             handler,
@@ -454,7 +452,7 @@ impl DataStore for FilesystemDataStore {
         } else {
             self.fs.mkdir_all(&dir)?;
         }
-        self.fs.write_file(&path, content)?;
+        self.fs.write_file_atomic(&path, content)?;
         Ok(path)
     }
 
@@ -590,6 +588,7 @@ mod tests {
                     command: cmd_str.trim().to_string(),
                     exit_code: 1,
                     stderr: "mock failure".to_string(),
+                    stdout: String::new(),
                 })
             } else {
                 Ok(CommandOutput {
@@ -801,13 +800,18 @@ mod tests {
         assert!(ds.has_sentinel("vim", "install", "install.sh-abc").unwrap());
         assert_eq!(runner.calls(), vec!["echo hello"]);
 
-        // Sentinel file should contain "completed|..."
+        // Sentinel file should hold a JSON record of the run
         let sentinel_path = env
             .paths
             .handler_data_dir("vim", "install")
             .join("install.sh-abc");
         let content = env.fs.read_to_string(&sentinel_path).unwrap();
-        assert!(content.starts_with("completed|"), "got: {content}");
+        let record = SentinelRecord::parse(&content).expect("json sentinel");
+        assert!(record.duration_ms.is_some(), "got: {content}");
+        assert_eq!(
+            record.dodot_version.as_deref(),
+            Some(env!("CARGO_PKG_VERSION"))
+        );
     }
 
     #[test]
@@ -1388,6 +1392,10 @@ mod tests {
         assert_eq!(parse_completed_timestamp("completed|not-a-number"), None);
         assert_eq!(parse_completed_timestamp("running|12345"), None);
         assert_eq!(parse_completed_timestamp(""), None);
+        assert_eq!(
+            parse_completed_timestamp(r#"{"completed_at":1700000000,"exit_code":0}"#),
+            Some(1700000000)
+        );
     }
 
     #[test]
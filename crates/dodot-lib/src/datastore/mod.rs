@@ -3,14 +3,52 @@
 //! The [`DataStore`] trait defines dodot's 8-method storage API.
 //! [`FilesystemDataStore`] implements it using symlinks and sentinel
 //! files on a real (or test) filesystem via the [`Fs`](crate::fs::Fs) trait.
+//! With the `sqlite` feature, [`SqliteDataStore`] keeps the same files
+//! and indexes them in one database. [`open`] picks the backend named
+//! by `[datastore] backend`.
 
 mod filesystem;
+pub mod sentinel;
+#[cfg(feature = "sqlite")]
+pub mod sqlite;
 
 pub use filesystem::FilesystemDataStore;
+pub use sentinel::SentinelRecord;
+#[cfg(feature = "sqlite")]
+pub use sqlite::SqliteDataStore;
 
 use std::path::{Path, PathBuf};
+use std::sync::Arc;
 
-use crate::Result;
+use crate::fs::Fs;
+use crate::paths::Pather;
+use crate::{DodotError, Result};
+
+/// Construct the datastore named by `[datastore] backend`.
+///
+/// `"filesystem"` always works. `"sqlite"` needs the `sqlite` build
+/// feature; without it, and for any other name, this is a config
+/// error rather than a silent fallback — state written by one backend
+/// is readable by the other, but the run history is not.
+pub fn open(
+    backend: &str,
+    fs: Arc<dyn Fs>,
+    paths: Arc<dyn Pather>,
+    runner: Arc<dyn CommandRunner>,
+) -> Result<Arc<dyn DataStore>> {
+    match backend {
+        "filesystem" => Ok(Arc::new(FilesystemDataStore::new(fs, paths, runner))),
+        #[cfg(feature = "sqlite")]
+        "sqlite" => Ok(Arc::new(SqliteDataStore::open(fs, paths, runner)?)),
+        #[cfg(not(feature = "sqlite"))]
+        "sqlite" => Err(DodotError::Config(
+            "[datastore] backend = \"sqlite\" needs dodot built with the `sqlite` feature".into(),
+        )),
+        other => Err(DodotError::Config(format!(
+            "unknown [datastore] backend `{other}` (expected \"filesystem\" or \"sqlite\")"
+        ))),
+    }
+}
 
 /// Three-way result of [`DataStore::did_run`] — whether a file has
 /// been run by a handler, and if so, whether the recorded run matches
@@ -41,9 +79,11 @@ pub enum DidRunStatus {
 
 /// Dodot's storage interface.
 ///
-/// State is represented entirely by symlinks and sentinel files in the
-/// filesystem — no database, no lock files. Methods break into three
-/// groups:
+/// State is represented by symlinks and sentinel files in the
+/// filesystem — those files are what the shell and the user links
+/// consume, so every backend must write them. Backends may add an index
+/// on top (the `sqlite` backend does) but never replace them. Methods
+/// break into three groups:
 ///
 /// **Mutations** — modify state:
 /// - [`create_data_link`](DataStore::create_data_link)
@@ -77,7 +117,9 @@ pub trait DataStore: Send + Sync {
     /// Executes `command` via shell and records a sentinel on success.
     ///
     /// Idempotent: if the sentinel already exists, the command is not
-    /// re-run. The sentinel file stores `completed|{timestamp}`.
+    /// re-run. The sentinel file stores a JSON
+    /// [`SentinelRecord`] (completion time, exit code, duration, dodot
+    /// version, host).
     ///
     /// **Edge case**: if the command succeeds but the sentinel write
     /// fails, a subsequent call will re-run the command. This is by
@@ -110,7 +152,7 @@ pub trait DataStore: Send + Sync {
     ///   was at the time of that last run.
     ///
     /// Tie-break for multiple non-matching sentinels: most recently
-    /// completed run wins, as recorded by the `completed|<unix-ts>`
+    /// completed run wins, as recorded by the `completed_at` field
     /// payload [`run_and_record`](DataStore::run_and_record) writes
     /// to each sentinel. Sentinels whose payload doesn't parse fall
     /// to the bottom; ties on timestamp break by lexical order on
@@ -183,6 +225,13 @@ pub trait DataStore: Send + Sync {
 
     /// Returns the absolute path where a sentinel file would be stored.
     fn sentinel_path(&self, pack: &str, handler: &str, sentinel: &str) -> std::path::PathBuf;
+
+    /// Rebuild whatever the store keeps alongside the files from the
+    /// files on disk, after they were changed without going through
+    /// it. A no-op for stores that read the files directly.
+    fn reindex(&self) -> Result<()> {
+        Ok(())
+    }
 }
 
 /// Abstraction over process execution.
@@ -219,6 +268,14 @@ pub trait CommandRunner: Send + Sync {
             stderr: out.stderr,
         })
     }
+
+    /// Where `name` would be found if run, or `None` when it isn't
+    /// installed. `up`'s pre-flight asks before running anything, so
+    /// every missing tool is reported at once. Default: assume it's
+    /// there — test doubles that never spawn have nothing to look up.
+    fn find_executable(&self, name: &str) -> Option<PathBuf> {
+        Some(PathBuf::from(name))
+    }
 }
 
 /// [`CommandRunner`] that succeeds without spawning anything.
@@ -278,7 +335,7 @@ impl ShellCommandRunner {
     }
 }
 
-pub(crate) fn format_command_for_display(executable: &str, arguments: &[String]) -> String {
+pub fn format_command_for_display(executable: &str, arguments: &[String]) -> String {
     if arguments.is_empty() {
         return executable.to_string();
     }
@@ -322,6 +379,9 @@ impl CommandRunner for ShellCommandRunner {
         use std::sync::{Arc, Mutex};
         use std::thread;
 
+        let _span = crate::timing::span(crate::timing::Phase::Subprocess, || {
+            format_command_for_display(executable, arguments)
+        });
         let mut child = Command::new(executable)
             .args(arguments)
             .stdout(Stdio::piped())
@@ -331,6 +391,7 @@ impl CommandRunner for ShellCommandRunner {
                 command: format_command_for_display(executable, arguments),
                 exit_code: -1,
                 stderr: e.to_string(),
+                stdout: String::new(),
             })?;
 
         let stdout_pipe = child
@@ -433,6 +494,7 @@ impl CommandRunner for ShellCommandRunner {
             command: format_command_for_display(executable, arguments),
             exit_code: -1,
             stderr: e.to_string(),
+            stdout: String::new(),
         })?;
         let exit_code = status.code().unwrap_or(-1);
 
@@ -451,6 +513,7 @@ impl CommandRunner for ShellCommandRunner {
                 command: format_command_for_display(executable, arguments),
                 exit_code,
                 stderr: stderr_text,
+                stdout: stdout_buf,
             });
         }
 
@@ -473,6 +536,9 @@ impl CommandRunner for ShellCommandRunner {
         use std::sync::{Arc, Mutex};
         use std::thread;
 
+        let _span = crate::timing::span(crate::timing::Phase::Subprocess, || {
+            format_command_for_display(executable, arguments)
+        });
         let mut child = Command::new(executable)
             .args(arguments)
             .stdout(Stdio::piped())
@@ -482,6 +548,7 @@ impl CommandRunner for ShellCommandRunner {
                 command: format_command_for_display(executable, arguments),
                 exit_code: -1,
                 stderr: e.to_string(),
+                stdout: String::new(),
             })?;
 
         let mut stdout_pipe = child
@@ -520,6 +587,7 @@ impl CommandRunner for ShellCommandRunner {
                 command: format_command_for_display(executable, arguments),
                 exit_code: -1,
                 stderr: e.to_string(),
+                stdout: String::new(),
             });
         }
 
@@ -530,6 +598,7 @@ impl CommandRunner for ShellCommandRunner {
             command: format_command_for_display(executable, arguments),
             exit_code: -1,
             stderr: e.to_string(),
+            stdout: String::new(),
         })?;
         let exit_code = status.code().unwrap_or(-1);
 
@@ -555,12 +624,48 @@ impl CommandRunner for ShellCommandRunner {
             stderr: stderr_text,
         })
     }
+
+    /// Looks `name` up the way `Command::new` will: a name with a `/`
+    /// as-is, anything else in each `$PATH` directory in turn.
+    fn find_executable(&self, name: &str) -> Option<PathBuf> {
+        use std::os::unix::fs::PermissionsExt;
+
+        let runnable = |path: &Path| {
+            std::fs::metadata(path)
+                .is_ok_and(|m| m.is_file() && m.permissions().mode() & 0o111 != 0)
+        };
+        if name.contains('/') {
+            let path = PathBuf::from(name);
+            return runnable(&path).then_some(path);
+        }
+        std::env::split_paths(&std::env::var_os("PATH")?)
+            .map(|dir| dir.join(name))
+            .find(|path| runnable(path))
+    }
 }
 
 #[cfg(test)]
 mod tests {
     use super::*;
 
+    #[test]
+    fn open_rejects_unknown_backend() {
+        let env = crate::testing::TempEnvironment::builder().build();
+        let open_backend = |name: &str| {
+            open(
+                name,
+                env.fs.clone(),
+                env.paths.clone(),
+                Arc::new(NoopCommandRunner),
+            )
+        };
+        assert!(open_backend("filesystem").is_ok());
+        assert!(matches!(
+            open_backend("postgres"),
+            Err(DodotError::Config(msg)) if msg.contains("postgres")
+        ));
+    }
+
     #[test]
     fn parse_status_line_matches_no_space() {
         assert_eq!(parse_status_line("#status: building"), Some("building"));
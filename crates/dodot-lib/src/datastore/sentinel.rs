@@ -0,0 +1,135 @@
+//! Sentinel file payloads.
+//!
+//! A sentinel's *name* (`<filename>-<hash>`) says which revision ran;
+//! its *content* says how that run went. Sentinels used to hold only
+//! `completed|<unix-secs>`; they now hold a JSON [`SentinelRecord`]
+//! with the duration, dodot version and host as well, so `status` can
+//! say "ran 3d ago on mbp in 42s". Legacy payloads still parse — the
+//! extra fields just come back empty.
+//!
+//! There is no exit code: a sentinel is only written once a run
+//! succeeded, so it would always read 0.
+
+use serde::{Deserialize, Serialize};
+
+/// What dodot recorded about one completed run.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct SentinelRecord {
+    /// Unix seconds when the run finished.
+    pub completed_at: u64,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub duration_ms: Option<u64>,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub dodot_version: Option<String>,
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub hostname: Option<String>,
+}
+
+impl SentinelRecord {
+    /// A record for a run that just finished on this host.
+    /// `duration_ms` is `None` for sentinels that don't wrap a command
+    /// (externals record a fetch, not a run).
+    pub fn now(duration_ms: Option<u64>) -> Self {
+        Self {
+            completed_at: unix_now(),
+            duration_ms,
+            dodot_version: Some(env!("CARGO_PKG_VERSION").to_string()),
+            hostname: crate::gates::detect_hostname(),
+        }
+    }
+
+    /// Parse sentinel content: a JSON record, or the legacy
+    /// `completed|<unix-secs>` line. `None` for anything else
+    /// (manually edited, truncated).
+    pub fn parse(content: &str) -> Option<Self> {
+        let content = content.trim();
+        if content.starts_with('{') {
+            return serde_json::from_str(content).ok();
+        }
+        let completed_at = content.strip_prefix("completed|")?.parse().ok()?;
+        Some(Self {
+            completed_at,
+            duration_ms: None,
+            dodot_version: None,
+            hostname: None,
+        })
+    }
+
+    /// Serialized sentinel content.
+    pub fn to_content(&self) -> String {
+        // Plain struct of strings and integers — serialization can't fail.
+        serde_json::to_string(self).expect("sentinel record serializes")
+    }
+
+    /// One-line description relative to `now`: `3d ago on mbp in 42s`.
+    /// Host and duration are left out when the record doesn't have them.
+    pub fn summary(&self, now: u64) -> String {
+        let mut out = format_age(now.saturating_sub(self.completed_at));
+        if let Some(host) = &self.hostname {
+            out.push_str(&format!(" on {host}"));
+        }
+        if let Some(ms) = self.duration_ms {
+            out.push_str(&format!(" in {}", format_duration(ms)));
+        }
+        out
+    }
+}
+
+pub(crate) fn unix_now() -> u64 {
+    std::time::SystemTime::now()
+        .duration_since(std::time::UNIX_EPOCH)
+        .unwrap_or_default()
+        .as_secs()
+}
+
+/// Compact relative age: `just now`, `5m ago`, `3h ago`, `12d ago`.
+fn format_age(secs: u64) -> String {
+    match secs {
+        0..=59 => "just now".into(),
+        60..=3599 => format!("{}m ago", secs / 60),
+        3600..=86_399 => format!("{}h ago", secs / 3600),
+        _ => format!("{}d ago", secs / 86_400),
+    }
+}
+
+/// Compact run duration: `850ms`, `42s`, `3m12s`.
+fn format_duration(ms: u64) -> String {
+    match ms {
+        0..=999 => format!("{ms}ms"),
+        1000..=59_999 => format!("{}s", ms / 1000),
+        _ => format!("{}m{:02}s", ms / 60_000, (ms / 1000) % 60),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn parses_json_and_legacy_payloads() {
+        let record = SentinelRecord {
+            completed_at: 1_700_000_000,
+            duration_ms: Some(42_000),
+            dodot_version: Some("5.2.0".into()),
+            hostname: Some("mbp".into()),
+        };
+        assert_eq!(SentinelRecord::parse(&record.to_content()), Some(record));
+
+        let legacy = SentinelRecord::parse("completed|1700000000\n").unwrap();
+        assert_eq!(legacy.completed_at, 1_700_000_000);
+        assert_eq!(legacy.hostname, None);
+
+        assert_eq!(SentinelRecord::parse("running|12345"), None);
+        assert_eq!(SentinelRecord::parse("{not json"), None);
+    }
+
+    #[test]
+    fn summary_includes_what_was_recorded() {
+        let mut record = SentinelRecord::parse("completed|1000").unwrap();
+        assert_eq!(record.summary(1000 + 3 * 86_400), "3d ago");
+
+        record.hostname = Some("mbp".into());
+        record.duration_ms = Some(192_000);
+        assert_eq!(record.summary(1030), "just now on mbp in 3m12s");
+    }
+}
@@ -0,0 +1,658 @@
+//! SQLite-indexed [`DataStore`] (`[datastore] backend = "sqlite"`).
+//!
+//! The files under `<data_dir>/packs/` stay exactly as the filesystem
+//! backend lays them out — the shell sources the data links, the user
+//! links point at them, `status` and `probe` read them. What this
+//! backend adds is one database, `<data_dir>/dodot.db`, that indexes
+//! every entry the datastore writes and keeps the full run history:
+//!
+//! - `entries` — one row per top-level entry in a handler dir (data
+//!   link, rendered file, sentinel, directory). Answers
+//!   `has_handler_state`, `list_pack_handlers`, `has_sentinel` and
+//!   `list_handler_sentinels`.
+//! - `sentinels` — the [`SentinelRecord`] of every current sentinel,
+//!   with `completed_at` as a column so `did_run` picks the latest
+//!   prior run in one query instead of reading every sentinel file.
+//! - `runs` — append-only history of every `run_and_record` that
+//!   actually ran. `remove_state` (and `dodot down`) keep it.
+//!
+//! Writes delegate to [`FilesystemDataStore`] first and update the
+//! index in a transaction afterwards, so a crash between the two
+//! leaves a file without an index row, never the reverse. Queries
+//! trust the index and never touch the tree.
+//!
+//! The index is rebuilt from the files on disk by
+//! [`DataStore::reindex`]: when the database is created, after the
+//! commands that move state files themselves (`disable`, `enable`,
+//! `state import`, `eject`, `migrate-state`), and on `dodot state
+//! reindex` after editing the data dir by hand.
+
+use std::path::{Component, Path, PathBuf};
+use std::sync::{Arc, Mutex};
+
+use rusqlite::{params, Connection, OptionalExtension};
+
+use super::filesystem::{extract_sentinel_hash, SNAPSHOT_SUFFIX};
+use crate::datastore::{
+    CommandRunner, DataStore, DidRunStatus, FilesystemDataStore, SentinelRecord,
+};
+use crate::fs::Fs;
+use crate::paths::Pather;
+use crate::{DodotError, Result};
+
+/// Database file name, directly under the data dir.
+pub const DB_FILENAME: &str = "dodot.db";
+
+const SCHEMA: &str = "
+CREATE TABLE IF NOT EXISTS entries (
+    pack    TEXT NOT NULL,
+    handler TEXT NOT NULL,
+    name    TEXT NOT NULL,
+    kind    TEXT NOT NULL,
+    PRIMARY KEY (pack, handler, name)
+);
+CREATE TABLE IF NOT EXISTS sentinels (
+    pack         TEXT NOT NULL,
+    handler      TEXT NOT NULL,
+    name         TEXT NOT NULL,
+    completed_at INTEGER NOT NULL,
+    record       TEXT NOT NULL,
+    PRIMARY KEY (pack, handler, name)
+);
+CREATE TABLE IF NOT EXISTS runs (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    pack         TEXT NOT NULL,
+    handler      TEXT NOT NULL,
+    sentinel     TEXT NOT NULL,
+    completed_at INTEGER NOT NULL,
+    record       TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS runs_by_handler ON runs (pack, handler, completed_at);
+";
+
+const KIND_LINK: &str = "link";
+const KIND_FILE: &str = "file";
+const KIND_DIR: &str = "dir";
+
+/// One row of the run history.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct RunRecord {
+    pub sentinel: String,
+    pub record: SentinelRecord,
+}
+
+/// [`DataStore`] that keeps the filesystem layout and indexes it in
+/// SQLite. See the module docs.
+pub struct SqliteDataStore {
+    files: FilesystemDataStore,
+    fs: Arc<dyn Fs>,
+    paths: Arc<dyn Pather>,
+    conn: Mutex<Connection>,
+}
+
+fn db_err(e: rusqlite::Error) -> DodotError {
+    DodotError::Other(format!("datastore database: {e}"))
+}
+
+impl SqliteDataStore {
+    /// Open (or create) `<data_dir>/dodot.db`. A new database is
+    /// filled from whatever the filesystem backend left on disk, so
+    /// switching backends needs no migration step.
+    pub fn open(
+        fs: Arc<dyn Fs>,
+        paths: Arc<dyn Pather>,
+        runner: Arc<dyn CommandRunner>,
+    ) -> Result<Self> {
+        fs.mkdir_all(paths.data_dir())?;
+        let db_path = paths.data_dir().join(DB_FILENAME);
+        let fresh = !fs.exists(&db_path);
+        let conn = Connection::open(&db_path).map_err(db_err)?;
+        conn.execute_batch(SCHEMA).map_err(db_err)?;
+        let store = Self {
+            files: FilesystemDataStore::new(fs.clone(), paths.clone(), runner),
+            fs,
+            paths,
+            conn: Mutex::new(conn),
+        };
+        if fresh {
+            store.reindex()?;
+        }
+        Ok(store)
+    }
+
+    /// Names of the directories directly under `dir`; none when `dir`
+    /// doesn't exist.
+    fn subdirs(&self, dir: &Path) -> Result<Vec<String>> {
+        if !self.fs.is_dir(dir) {
+            return Ok(Vec::new());
+        }
+        Ok(self
+            .fs
+            .read_dir(dir)?
+            .into_iter()
+            .filter(|e| e.is_dir)
+            .map(|e| e.name)
+            .collect())
+    }
+
+    /// The entries directly under a handler dir, with the kind the
+    /// index stores for each, sorted by name.
+    fn scan(&self, dir: &Path) -> Result<Vec<(String, &'static str)>> {
+        if !self.fs.is_dir(dir) {
+            return Ok(Vec::new());
+        }
+        let mut entries: Vec<(String, &'static str)> = self
+            .fs
+            .read_dir(dir)?
+            .into_iter()
+            .map(|entry| {
+                let kind = if entry.is_symlink {
+                    KIND_LINK
+                } else if entry.is_dir {
+                    KIND_DIR
+                } else {
+                    KIND_FILE
+                };
+                (entry.name, kind)
+            })
+            .collect();
+        entries.sort();
+        Ok(entries)
+    }
+
+    /// The sentinel record in `dir/name`, if it is one.
+    fn read_record(&self, dir: &Path, name: &str, kind: &str) -> Option<SentinelRecord> {
+        if kind != KIND_FILE {
+            return None;
+        }
+        self.fs
+            .read_to_string(&dir.join(name))
+            .ok()
+            .and_then(|c| SentinelRecord::parse(&c))
+    }
+
+    /// The handlers with at least one indexed entry for `pack`.
+    fn indexed_handlers(&self, pack: &str) -> Result<Vec<String>> {
+        let conn = self.conn.lock().expect("datastore db lock");
+        let mut stmt = conn
+            .prepare("SELECT DISTINCT handler FROM entries WHERE pack = ?1 ORDER BY handler")
+            .map_err(db_err)?;
+        let rows = stmt
+            .query_map(params![pack], |row| row.get::<_, String>(0))
+            .map_err(db_err)?;
+        rows.collect::<rusqlite::Result<Vec<_>>>().map_err(db_err)
+    }
+
+    /// Every recorded run for `pack`/`handler`, oldest first.
+    pub fn run_history(&self, pack: &str, handler: &str) -> Result<Vec<RunRecord>> {
+        let conn = self.conn.lock().expect("datastore db lock");
+        let mut stmt = conn
+            .prepare(
+                "SELECT sentinel, record FROM runs WHERE pack = ?1 AND handler = ?2 \
+                 ORDER BY completed_at, id",
+            )
+            .map_err(db_err)?;
+        let rows = stmt
+            .query_map(params![pack, handler], |row| {
+                Ok((row.get::<_, String>(0)?, row.get::<_, String>(1)?))
+            })
+            .map_err(db_err)?;
+        let mut out = Vec::new();
+        for row in rows {
+            let (sentinel, content) = row.map_err(db_err)?;
+            if let Some(record) = SentinelRecord::parse(&content) {
+                out.push(RunRecord { sentinel, record });
+            }
+        }
+        Ok(out)
+    }
+
+    /// Index one entry written under `handler_data_dir(pack, handler)`.
+    /// Nested paths (`sub/file.txt`) index their top-level directory,
+    /// matching what a `read_dir` of the handler dir would show.
+    fn index_entry(&self, pack: &str, handler: &str, relative: &str, kind: &str) -> Result<()> {
+        let mut components = Path::new(relative).components().filter_map(|c| match c {
+            Component::Normal(s) => Some(s.to_string_lossy().into_owned()),
+            _ => None,
+        });
+        let Some(top) = components.next() else {
+            return Ok(());
+        };
+        let kind = if components.next().is_some() {
+            KIND_DIR
+        } else {
+            kind
+        };
+        let conn = self.conn.lock().expect("datastore db lock");
+        conn.execute(
+            "INSERT OR REPLACE INTO entries (pack, handler, name, kind) VALUES (?1, ?2, ?3, ?4)",
+            params![pack, handler, top, kind],
+        )
+        .map_err(db_err)?;
+        Ok(())
+    }
+
+    fn query_names(&self, sql: &str, pack: &str, handler: &str) -> Result<Vec<String>> {
+        let conn = self.conn.lock().expect("datastore db lock");
+        let mut stmt = conn.prepare(sql).map_err(db_err)?;
+        let rows = stmt
+            .query_map(params![pack, handler], |row| row.get::<_, String>(0))
+            .map_err(db_err)?;
+        rows.collect::<rusqlite::Result<Vec<_>>>().map_err(db_err)
+    }
+}
+
+fn insert_sentinel(
+    conn: &Connection,
+    pack: &str,
+    handler: &str,
+    name: &str,
+    record: &SentinelRecord,
+    log_run: bool,
+) -> Result<()> {
+    let content = record.to_content();
+    conn.execute(
+        "INSERT OR REPLACE INTO sentinels (pack, handler, name, completed_at, record) \
+         VALUES (?1, ?2, ?3, ?4, ?5)",
+        params![pack, handler, name, record.completed_at as i64, content],
+    )
+    .map_err(db_err)?;
+    if log_run {
+        // A rebuild sees sentinels the history already has.
+        conn.execute(
+            "INSERT INTO runs (pack, handler, sentinel, completed_at, record) \
+             SELECT ?1, ?2, ?3, ?4, ?5 WHERE NOT EXISTS (SELECT 1 FROM runs \
+             WHERE pack = ?1 AND handler = ?2 AND sentinel = ?3 AND completed_at = ?4)",
+            params![pack, handler, name, record.completed_at as i64, content],
+        )
+        .map_err(db_err)?;
+    }
+    Ok(())
+}
+
+impl DataStore for SqliteDataStore {
+    fn create_data_link(&self, pack: &str, handler: &str, source_file: &Path) -> Result<PathBuf> {
+        let link = self.files.create_data_link(pack, handler, source_file)?;
+        if let Some(name) = link.file_name() {
+            self.index_entry(pack, handler, &name.to_string_lossy(), KIND_LINK)?;
+        }
+        Ok(link)
+    }
+
+    fn create_user_link(&self, datastore_path: &Path, user_path: &Path) -> Result<()> {
+        // User links live outside the data dir; the deployment map
+        // already records them.
+        self.files.create_user_link(datastore_path, user_path)
+    }
+
+    fn run_and_record(
+        &self,
+        pack: &str,
+        handler: &str,
+        executable: &str,
+        arguments: &[String],
+        sentinel: &str,
+        force: bool,
+    ) -> Result<()> {
+        if !force && self.has_sentinel(pack, handler, sentinel)? {
+            return Ok(());
+        }
+        self.files
+            .run_and_record(pack, handler, executable, arguments, sentinel, true)?;
+
+        let path = self.files.sentinel_path(pack, handler, sentinel);
+        let Some(record) = self
+            .fs
+            .read_to_string(&path)
+            .ok()
+            .and_then(|c| SentinelRecord::parse(&c))
+        else {
+            return Ok(());
+        };
+        let snapshot = format!("{sentinel}{SNAPSHOT_SUFFIX}");
+        let has_snapshot = self.fs.exists(&path.with_file_name(&snapshot));
+
+        let mut conn = self.conn.lock().expect("datastore db lock");
+        let tx = conn.transaction().map_err(db_err)?;
+        tx.execute(
+            "INSERT OR REPLACE INTO entries (pack, handler, name, kind) VALUES (?1, ?2, ?3, ?4)",
+            params![pack, handler, sentinel, KIND_FILE],
+        )
+        .map_err(db_err)?;
+        if has_snapshot {
+            tx.execute(
+                "INSERT OR REPLACE INTO entries (pack, handler, name, kind) VALUES (?1, ?2, ?3, ?4)",
+                params![pack, handler, snapshot, KIND_FILE],
+            )
+            .map_err(db_err)?;
+        }
+        insert_sentinel(&tx, pack, handler, sentinel, &record, true)?;
+        tx.commit().map_err(db_err)
+    }
+
+    fn has_sentinel(&self, pack: &str, handler: &str, sentinel: &str) -> Result<bool> {
+        let conn = self.conn.lock().expect("datastore db lock");
+        let hit: Option<i64> = conn
+            .query_row(
+                "SELECT 1 FROM entries WHERE pack = ?1 AND handler = ?2 AND name = ?3",
+                params![pack, handler, sentinel],
+                |row| row.get(0),
+            )
+            .optional()
+            .map_err(db_err)?;
+        Ok(hit.is_some())
+    }
+
+    fn did_run(
+        &self,
+        pack: &str,
+        handler: &str,
+        filename: &str,
+        current_hash: &str,
+    ) -> Result<DidRunStatus> {
+        // Newest first; ties break on the name, like the filesystem
+        // backend.
+        let conn = self.conn.lock().expect("datastore db lock");
+        let mut stmt = conn
+            .prepare(
+                "SELECT name FROM sentinels WHERE pack = ?1 AND handler = ?2 \
+                 ORDER BY completed_at DESC, name DESC",
+            )
+            .map_err(db_err)?;
+        let names = stmt
+            .query_map(params![pack, handler], |row| row.get::<_, String>(0))
+            .map_err(db_err)?
+            .collect::<rusqlite::Result<Vec<_>>>()
+            .map_err(db_err)?;
+        drop(stmt);
+        drop(conn);
+
+        let matches: Vec<(String, String)> = names
+            .iter()
+            .filter_map(|name| {
+                let (fname, hash) = extract_sentinel_hash(name)?;
+                (fname == filename).then(|| (name.clone(), hash.to_string()))
+            })
+            .collect();
+        let Some((prior_name, prior_hash)) = matches.first().cloned() else {
+            return Ok(DidRunStatus::NeverRan);
+        };
+        if matches.iter().any(|(_, h)| h == current_hash) {
+            return Ok(DidRunStatus::RanCurrent);
+        }
+
+        let snapshot_path = self
+            .paths
+            .handler_data_dir(pack, handler)
+            .join(format!("{prior_name}{SNAPSHOT_SUFFIX}"));
+        let previous_snapshot = if self.fs.exists(&snapshot_path) {
+            self.fs.read_file(&snapshot_path).ok()
+        } else {
+            None
+        };
+        Ok(DidRunStatus::RanDifferent {
+            previous_hash: prior_hash,
+            previous_snapshot,
+        })
+    }
+
+    fn remove_state(&self, pack: &str, handler: &str) -> Result<()> {
+        self.files.remove_state(pack, handler)?;
+        let mut conn = self.conn.lock().expect("datastore db lock");
+        let tx = conn.transaction().map_err(db_err)?;
+        tx.execute(
+            "DELETE FROM entries WHERE pack = ?1 AND handler = ?2",
+            params![pack, handler],
+        )
+        .map_err(db_err)?;
+        tx.execute(
+            "DELETE FROM sentinels WHERE pack = ?1 AND handler = ?2",
+            params![pack, handler],
+        )
+        .map_err(db_err)?;
+        tx.commit().map_err(db_err)
+    }
+
+    fn has_handler_state(&self, pack: &str, handler: &str) -> Result<bool> {
+        let names = self.query_names(
+            "SELECT name FROM entries WHERE pack = ?1 AND handler = ?2 LIMIT 1",
+            pack,
+            handler,
+        )?;
+        Ok(!names.is_empty())
+    }
+
+    fn list_pack_handlers(&self, pack: &str) -> Result<Vec<String>> {
+        self.indexed_handlers(pack)
+    }
+
+    fn list_handler_sentinels(&self, pack: &str, handler: &str) -> Result<Vec<String>> {
+        self.query_names(
+            "SELECT name FROM entries WHERE pack = ?1 AND handler = ?2 AND kind = 'file' \
+             ORDER BY name",
+            pack,
+            handler,
+        )
+    }
+
+    fn write_rendered_file(
+        &self,
+        pack: &str,
+        handler: &str,
+        filename: &str,
+        content: &[u8],
+    ) -> Result<PathBuf> {
+        let path = self
+            .files
+            .write_rendered_file(pack, handler, filename, content)?;
+        self.index_entry(pack, handler, filename, KIND_FILE)?;
+        Ok(path)
+    }
+
+    fn write_rendered_file_with_mode(
+        &self,
+        pack: &str,
+        handler: &str,
+        filename: &str,
+        content: &[u8],
+        mode: u32,
+    ) -> Result<PathBuf> {
+        let path = self
+            .files
+            .write_rendered_file_with_mode(pack, handler, filename, content, mode)?;
+        self.index_entry(pack, handler, filename, KIND_FILE)?;
+        Ok(path)
+    }
+
+    fn write_rendered_dir(&self, pack: &str, handler: &str, relative: &str) -> Result<PathBuf> {
+        let path = self.files.write_rendered_dir(pack, handler, relative)?;
+        self.index_entry(pack, handler, relative, KIND_DIR)?;
+        Ok(path)
+    }
+
+    fn sentinel_path(&self, pack: &str, handler: &str, sentinel: &str) -> PathBuf {
+        self.files.sentinel_path(pack, handler, sentinel)
+    }
+
+    /// Rebuild `entries` and `sentinels` from the files on disk. Run
+    /// history can't be recovered from files; each current sentinel
+    /// not yet in `runs` seeds one row.
+    fn reindex(&self) -> Result<()> {
+        let packs_dir = self.paths.data_dir().join("packs");
+        let mut rows: Vec<(String, String, String, &'static str, Option<SentinelRecord>)> =
+            Vec::new();
+        for pack in self.subdirs(&packs_dir)? {
+            for handler in self.subdirs(&self.paths.pack_data_dir(&pack))? {
+                let dir = self.paths.handler_data_dir(&pack, &handler);
+                for (name, kind) in self.scan(&dir)? {
+                    let record = self.read_record(&dir, &name, kind);
+                    rows.push((pack.clone(), handler.clone(), name, kind, record));
+                }
+            }
+        }
+
+        let mut conn = self.conn.lock().expect("datastore db lock");
+        let tx = conn.transaction().map_err(db_err)?;
+        tx.execute_batch("DELETE FROM entries; DELETE FROM sentinels;")
+            .map_err(db_err)?;
+        for (pack, handler, name, kind, record) in &rows {
+            tx.execute(
+                "INSERT INTO entries (pack, handler, name, kind) VALUES (?1, ?2, ?3, ?4)",
+                params![pack, handler, name, kind],
+            )
+            .map_err(db_err)?;
+            if let Some(record) = record {
+                insert_sentinel(&tx, pack, handler, name, record, true)?;
+            }
+        }
+        tx.commit().map_err(db_err)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::datastore::NoopCommandRunner;
+    use crate::testing::TempEnvironment;
+
+    fn open(env: &TempEnvironment) -> SqliteDataStore {
+        SqliteDataStore::open(
+            env.fs.clone(),
+            env.paths.clone(),
+            Arc::new(NoopCommandRunner),
+        )
+        .unwrap()
+    }
+
+    #[test]
+    fn indexes_links_sentinels_and_keeps_run_history() {
+        let env = TempEnvironment::builder()
+            .pack("vim")
+            .file("vimrc", "x")
+            .file("install.sh", "echo hi")
+            .done()
+            .build();
+        let ds = open(&env);
+        let script = env.dotfiles_root.join("vim/install.sh");
+        let script_arg = script.to_string_lossy().into_owned();
+
+        ds.create_data_link("vim", "symlink", &env.dotfiles_root.join("vim/vimrc"))
+            .unwrap();
+        ds.run_and_record(
+            "vim",
+            "install",
+            "bash",
+            &[script_arg.clone()],
+            "install.sh-aaaaaaaaaaaaaaaa",
+            false,
+        )
+        .unwrap();
+
+        assert_eq!(
+            ds.list_pack_handlers("vim").unwrap(),
+            ["install", "symlink"]
+        );
+        assert!(ds
+            .has_sentinel("vim", "install", "install.sh-aaaaaaaaaaaaaaaa")
+            .unwrap());
+        assert_eq!(
+            ds.did_run("vim", "install", "install.sh", "aaaaaaaaaaaaaaaa")
+                .unwrap(),
+            DidRunStatus::RanCurrent
+        );
+        match ds
+            .did_run("vim", "install", "install.sh", "bbbbbbbbbbbbbbbb")
+            .unwrap()
+        {
+            DidRunStatus::RanDifferent {
+                previous_hash,
+                previous_snapshot,
+            } => {
+                assert_eq!(previous_hash, "aaaaaaaaaaaaaaaa");
+                assert_eq!(previous_snapshot.as_deref(), Some(&b"echo hi"[..]));
+            }
+            other => panic!("expected RanDifferent, got {other:?}"),
+        }
+
+        ds.remove_state("vim", "install").unwrap();
+        assert!(!ds.has_handler_state("vim", "install").unwrap());
+        assert_eq!(ds.run_history("vim", "install").unwrap().len(), 1);
+    }
+
+    #[test]
+    fn new_database_is_built_from_existing_files() {
+        let env = TempEnvironment::builder()
+            .pack("vim")
+            .file("vimrc", "x")
+            .done()
+            .build();
+        let files = FilesystemDataStore::new(
+            env.fs.clone(),
+            env.paths.clone(),
+            Arc::new(NoopCommandRunner),
+        );
+        files
+            .create_data_link("vim", "symlink", &env.dotfiles_root.join("vim/vimrc"))
+            .unwrap();
+
+        let ds = open(&env);
+        assert!(ds.has_handler_state("vim", "symlink").unwrap());
+        assert_eq!(ds.list_pack_handlers("vim").unwrap(), ["symlink"]);
+    }
+
+    #[test]
+    fn changes_behind_the_datastore_wait_for_reindex() {
+        let env = TempEnvironment::builder()
+            .pack("vim")
+            .file("vimrc", "x")
+            .done()
+            .build();
+        let ds = open(&env);
+        ds.create_data_link("vim", "symlink", &env.dotfiles_root.join("vim/vimrc"))
+            .unwrap();
+        assert!(ds.has_handler_state("vim", "symlink").unwrap());
+
+        // Removed without the datastore: the index is authoritative
+        // until a rebuild.
+        env.fs
+            .remove_dir_all(&env.paths.handler_data_dir("vim", "symlink"))
+            .unwrap();
+        assert!(ds.has_handler_state("vim", "symlink").unwrap());
+        ds.reindex().unwrap();
+        assert!(!ds.has_handler_state("vim", "symlink").unwrap());
+        assert!(ds.list_pack_handlers("vim").unwrap().is_empty());
+
+        // Written without the datastore: found by the rebuild, and the
+        // sentinel seeds the run history once however often it runs.
+        let files = FilesystemDataStore::new(
+            env.fs.clone(),
+            env.paths.clone(),
+            Arc::new(NoopCommandRunner),
+        );
+        files
+            .run_and_record(
+                "vim",
+                "install",
+                "true",
+                &[],
+                "install.sh-aaaaaaaaaaaaaaaa",
+                false,
+            )
+            .unwrap();
+        assert!(!ds
+            .has_sentinel("vim", "install", "install.sh-aaaaaaaaaaaaaaaa")
+            .unwrap());
+        ds.reindex().unwrap();
+        ds.reindex().unwrap();
+        assert!(ds
+            .has_sentinel("vim", "install", "install.sh-aaaaaaaaaaaaaaaa")
+            .unwrap());
+        assert_eq!(ds.list_pack_handlers("vim").unwrap(), ["install"]);
+        assert_eq!(
+            ds.did_run("vim", "install", "install.sh", "aaaaaaaaaaaaaaaa")
+                .unwrap(),
+            DidRunStatus::RanCurrent
+        );
+        assert_eq!(ds.run_history("vim", "install").unwrap().len(), 1);
+    }
+}
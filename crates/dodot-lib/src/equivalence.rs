@@ -115,21 +115,16 @@ mod tests {
             .pack("vim")
             .file("vimrc", "set nocompatible")
             .done()
+            .home_symlink(".vimrc", "dotfiles/vim/vimrc")
             .build();
 
         let source = env.dotfiles_root.join("vim/vimrc");
         let user_path = env.home.join(".vimrc");
-        let relative_target = std::path::PathBuf::from("dotfiles/vim/vimrc");
-        env.fs.symlink(&relative_target, &user_path).unwrap();
 
         // Sanity check the layout assumption that makes the relative path
         // resolve correctly (test would silently pass for the wrong reason
         // otherwise).
-        assert_eq!(
-            resolve_symlink_target(&user_path, &relative_target),
-            source,
-            "test layout assumption broke: relative target doesn't resolve to source"
-        );
+        env.assert_resolves_to(&user_path, &source);
 
         assert!(
             is_equivalent(&user_path, &source, env.fs.as_ref()),
@@ -177,13 +172,13 @@ mod tests {
             .pack("vim")
             .file("vimrc", "set nocompatible")
             .done()
+            .home_symlink(".vimrc.intermediate", "dotfiles/vim/vimrc")
+            .home_symlink(".vimrc", ".vimrc.intermediate")
             .build();
 
         let source = env.dotfiles_root.join("vim/vimrc");
-        let intermediate = env.home.join(".vimrc.intermediate");
         let user_path = env.home.join(".vimrc");
-        env.fs.symlink(&source, &intermediate).unwrap();
-        env.fs.symlink(&intermediate, &user_path).unwrap();
+        env.assert_resolves_to(&user_path, &source);
 
         assert!(!is_equivalent(&user_path, &source, env.fs.as_ref()));
     }
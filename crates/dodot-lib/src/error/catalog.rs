@@ -0,0 +1,314 @@
+//! Static catalog of error codes with remediation text.
+//!
+//! Every [`DodotError`] variant that a user can act on has a stable
+//! code (`LINK001`, `CONF001`, …). The CLI prints the code next to the
+//! error with a "What to do next" section built from this catalog, and
+//! `dodot explain-error <code>` prints the full entry. Codes are part of
+//! the user-facing surface — docs and issue reports cite them — so a
+//! code is never reused for a different error once shipped.
+//!
+//! Codes follow `<AREA><nnn>`: `FS` filesystem, `LINK` deployment
+//! targets, `PACK` pack discovery, `CONF` configuration, `INST` external
+//! commands, `PREP` preprocessing, `TMPL` templates. Adding a variant to
+//! `DodotError`? Give it a code in [`DodotError::code`] and an entry here.
+
+use super::DodotError;
+
+/// A documented error code.
+#[derive(Debug, Clone, Copy)]
+pub struct ErrorDescriptor {
+    pub code: &'static str,
+    /// One-line name of the failure.
+    pub title: &'static str,
+    /// Why this happens, in a sentence or two.
+    pub explanation: &'static str,
+    /// Concrete next steps, most likely fix first.
+    pub remediation: &'static [&'static str],
+}
+
+/// Every error code. Keep sorted by code so `dodot explain-error`
+/// output is stable across edits.
+pub const KNOWN_ERRORS: &[ErrorDescriptor] = &[
+    ErrorDescriptor {
+        code: "CONF001",
+        title: "invalid configuration",
+        explanation: "A .dodot.toml file (or a fragment it includes) could not be parsed, or \
+             holds a key or value dodot doesn't accept.",
+        remediation: &[
+            "Check the file and key named in the error; unknown keys are rejected, so look for typos.",
+            "Run `dodot config list` to see the merged configuration dodot resolves.",
+        ],
+    },
+    ErrorDescriptor {
+        code: "CONF002",
+        title: "invalid pattern",
+        explanation: "A glob in a mapping, ignore or skip list doesn't compile.",
+        remediation: &[
+            "Fix the pattern named in the error; `*`, `?`, `[abc]` and `**` are supported.",
+            "Quote the pattern in TOML so special characters survive: `skip = [\"*.md\"]`.",
+        ],
+    },
+    ErrorDescriptor {
+        code: "FS001",
+        title: "filesystem error",
+        explanation: "Reading or writing a file failed — usually permissions, a missing parent \
+             directory, or a full disk.",
+        remediation: &[
+            "Check that you own the path named in the error and that its directory exists.",
+            "Run `dodot probe show-data-dir` if the path is inside dodot's data directory.",
+        ],
+    },
+    ErrorDescriptor {
+        code: "FS002",
+        title: "home write refused",
+        explanation: "dodot is running with `--no-write-home` (or `DODOT_NO_WRITE_HOME`) and \
+             the operation needed to change a file in $HOME outside dodot's own directories.",
+        remediation: &[
+            "Drop `--no-write-home` on a machine where dodot may manage your dotfiles.",
+            "Otherwise skip the command; `dodot up` works without it and leaves $HOME alone.",
+        ],
+    },
+    ErrorDescriptor {
+        code: "FS003",
+        title: "pre-flight checks failed",
+        explanation: "Before changing anything, `dodot up` checks that every target directory \
+             is writable, that copies fit on disk and that the tools run-once files need are \
+             installed. At least one check failed; each problem is listed with the error.",
+        remediation: &[
+            "Fix the listed permissions (`chmod u+w <dir>`) or free up space, then re-run.",
+            "Install a missing tool, or leave its file out with `dodot up --no-provision`.",
+            "Run `dodot up --dry-run` to see the problems without the error.",
+        ],
+    },
+    ErrorDescriptor {
+        code: "INST001",
+        title: "external command failed",
+        explanation: "A command dodot ran on your behalf (an install script, `brew bundle`, \
+             git) exited non-zero. Its stderr is shown with the error.",
+        remediation: &[
+            "Read the command's stderr above; the fix is usually in the script or Brewfile itself.",
+            "Run the command by hand from the pack directory to reproduce it.",
+            "Re-run with `dodot up --provision-rerun` once fixed to retry provisioning.",
+        ],
+    },
+    ErrorDescriptor {
+        code: "LINK001",
+        title: "deploy target already exists",
+        explanation: "The path dodot wants to link to is occupied by a file or symlink dodot \
+             didn't create, and dodot won't overwrite files it doesn't own.",
+        remediation: &[
+            "Adopt the existing file into a pack: `dodot adopt <path>`.",
+            "Or move it aside and re-run `dodot up`.",
+            "Or overwrite it with `dodot up --force <pack>`.",
+        ],
+    },
+    ErrorDescriptor {
+        code: "LINK002",
+        title: "protected deploy target",
+        explanation: "The deploy target is listed in `[symlink] protected_paths` (SSH private \
+             keys, GnuPG, cloud credentials, …), which dodot never links.",
+        remediation: &[
+            "Rename the source file so it deploys somewhere else.",
+            "If linking it is intended, remove the entry from `[symlink] protected_paths` in .dodot.toml.",
+        ],
+    },
+    ErrorDescriptor {
+        code: "LINK003",
+        title: "routing override conflict",
+        explanation: "A file routes by its name prefix (`home.`, `_xdg/`, …) and also has a \
+             `[symlink.targets]` entry; dodot won't guess which one you meant.",
+        remediation: &[
+            "Drop the routing prefix from the file name, or",
+            "remove the file's entry from `[symlink.targets]`.",
+        ],
+    },
+    ErrorDescriptor {
+        code: "LINK004",
+        title: "cross-pack conflict",
+        explanation: "Two packs deploy to the same target path. Nothing is deployed until this \
+             is fixed, and `--force` does not override it.",
+        remediation: &[
+            "Remove or rename one of the files listed in the error.",
+            "Or give one of them a different target with `[symlink.targets]`.",
+            "Run `dodot status` to see both packs side by side.",
+        ],
+    },
+    ErrorDescriptor {
+        code: "PACK001",
+        title: "pack not found",
+        explanation: "No pack (or `[groups]` entry) with that name exists at the dotfiles root.",
+        remediation: &[
+            "Run `dodot list` to see the packs dodot discovers.",
+            "Create the pack first with `dodot init <pack>`.",
+            "Check you are in the right repo: dodot uses $DOTFILES_ROOT, then the git toplevel.",
+        ],
+    },
+    ErrorDescriptor {
+        code: "PACK002",
+        title: "invalid pack",
+        explanation: "The directory can't be used as a pack — for example its name is invalid \
+             or it already exists where a new pack was requested.",
+        remediation: &[
+            "Read the reason in the error and rename or fix the directory.",
+            "Hide a directory from discovery with `dodot addignore <pack>`.",
+        ],
+    },
+    ErrorDescriptor {
+        code: "PACK003",
+        title: "pack ordering collision",
+        explanation: "Two directories differ only by their ordering prefix (`010-vim`, \
+             `020-vim`) and so resolve to the same pack name.",
+        remediation: &["Rename or remove one of the directories listed in the error."],
+    },
+    ErrorDescriptor {
+        code: "PACK004",
+        title: "unknown handler",
+        explanation: "A mapping or rule names a handler dodot doesn't have.",
+        remediation: &[
+            "Check the handler name in `[mappings]` or `[[rules]]` for typos.",
+            "Run `dodot status` to see the handlers dodot uses for each file.",
+        ],
+    },
+    ErrorDescriptor {
+        code: "PREP001",
+        title: "preprocessing failed",
+        explanation: "A preprocessor (template, decryption, unarchive, filter) couldn't turn a \
+             source file into its deployable form.",
+        remediation: &[
+            "Read the preprocessor's message; it names the failing file.",
+            "Run `dodot transform status` to see every preprocessed file's state.",
+        ],
+    },
+    ErrorDescriptor {
+        code: "PREP002",
+        title: "preprocessing collision",
+        explanation: "A preprocessed file expands to the same name as another file in the pack \
+             (`vimrc.tmpl` next to `vimrc`).",
+        remediation: &["Rename or remove one of the two files named in the error."],
+    },
+    ErrorDescriptor {
+        code: "TMPL001",
+        title: "template render failed",
+        explanation: "A template has a syntax error or uses a variable that isn't defined.",
+        remediation: &[
+            "Fix the template at the line named in the error.",
+            "Define missing variables under `[preprocessor.template.vars]` in .dodot.toml.",
+        ],
+    },
+    ErrorDescriptor {
+        code: "TMPL002",
+        title: "reserved template variable",
+        explanation: "`dodot` and `env` are built-in template namespaces and can't be \
+             redefined.",
+        remediation: &["Rename the variable in `[preprocessor.template.vars]`."],
+    },
+    ErrorDescriptor {
+        code: "TMPL003",
+        title: "unresolved conflict markers",
+        explanation: "A template source still holds dodot-conflict markers from a reverse-merge \
+             that couldn't be applied cleanly.",
+        remediation: &[
+            "Inspect the conflict with `git diff -- <file>` and keep the side you want.",
+            "Delete the dodot-conflict marker lines, then re-run.",
+        ],
+    },
+    ErrorDescriptor {
+        code: "TMPL004",
+        title: "missing template variables",
+        explanation: "Templates reference variables nothing defines, and `dodot up` couldn't \
+             prompt for them (`--no-input`, or stdin isn't a terminal).",
+        remediation: &[
+            "Run `dodot up` in a terminal to be asked for every missing value at once.",
+            "Or set them in ~/.config/dodot/vars.toml: `data.git.email` as `email` under `[git]`, a bare name at the top level.",
+        ],
+    },
+];
+
+/// Look up a descriptor by code, ignoring case.
+pub fn lookup(code: &str) -> Option<&'static ErrorDescriptor> {
+    KNOWN_ERRORS
+        .iter()
+        .find(|d| d.code.eq_ignore_ascii_case(code))
+}
+
+impl DodotError {
+    /// The catalog code for this error, or `None` for free-form
+    /// [`DodotError::Other`] errors.
+    pub fn code(&self) -> Option<&'static str> {
+        Some(match self {
+            DodotError::Fs { .. } => "FS001",
+            DodotError::HomeWriteRefused { .. } => "FS002",
+            DodotError::PreflightFailed { .. } => "FS003",
+            DodotError::SymlinkConflict { .. } => "LINK001",
+            DodotError::ProtectedPath { .. } => "LINK002",
+            DodotError::RoutingOverrideConflict { .. } => "LINK003",
+            DodotError::CrossPackConflict { .. } => "LINK004",
+            DodotError::PackNotFound { .. } => "PACK001",
+            DodotError::PackInvalid { .. } => "PACK002",
+            DodotError::PackOrderingCollision { .. } => "PACK003",
+            DodotError::HandlerNotFound { .. } => "PACK004",
+            DodotError::Config(_) => "CONF001",
+            DodotError::InvalidPattern { .. } => "CONF002",
+            DodotError::CommandFailed { .. } => "INST001",
+            DodotError::PreprocessorError { .. } => "PREP001",
+            DodotError::PreprocessorCollision { .. } => "PREP002",
+            DodotError::TemplateRender { .. } => "TMPL001",
+            DodotError::TemplateReservedVar { .. } => "TMPL002",
+            DodotError::UnresolvedConflictMarker { .. } => "TMPL003",
+            DodotError::TemplateVarsMissing { .. } => "TMPL004",
+            DodotError::Other(_) => return None,
+        })
+    }
+
+    /// The catalog entry for this error, if it has one.
+    pub fn descriptor(&self) -> Option<&'static ErrorDescriptor> {
+        self.code().and_then(lookup)
+    }
+
+    /// The error message followed by its code and a "What to do next"
+    /// section — the form the CLI prints. Errors without a catalog
+    /// entry render as their plain message.
+    pub fn with_remediation(&self) -> String {
+        let Some(d) = self.descriptor() else {
+            return self.to_string();
+        };
+        let mut out = format!("{self} [{}]\n\nWhat to do next:\n", d.code);
+        for step in d.remediation {
+            out.push_str(&format!("  - {step}\n"));
+        }
+        out.push_str(&format!("\nMore: dodot explain-error {}", d.code));
+        out
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn catalog_is_sorted_and_every_code_resolves() {
+        let codes: Vec<&str> = KNOWN_ERRORS.iter().map(|d| d.code).collect();
+        let mut sorted = codes.clone();
+        sorted.sort();
+        sorted.dedup();
+        assert_eq!(codes, sorted, "KNOWN_ERRORS must be sorted and unique");
+
+        let err = DodotError::SymlinkConflict {
+            path: "/home/u/.vimrc".into(),
+        };
+        assert_eq!(err.descriptor().unwrap().code, "LINK001");
+        assert_eq!(lookup("link004").unwrap().title, "cross-pack conflict");
+    }
+
+    #[test]
+    fn remediation_section_follows_the_message() {
+        let err = DodotError::PackNotFound { name: "vim".into() };
+        let text = err.with_remediation();
+        assert!(text.starts_with("pack not found: vim [PACK001]\n\nWhat to do next:\n"));
+        assert!(text.contains("  - Run `dodot list`"));
+        assert!(text.ends_with("More: dodot explain-error PACK001"));
+
+        let other = DodotError::Other("boom".into());
+        assert_eq!(other.with_remediation(), "boom");
+    }
+}
@@ -0,0 +1,82 @@
+//! The process exit codes dodot commands end with.
+//!
+//! Scripts branch on how a run ended without parsing its output:
+//!
+//! | code | meaning                                                 |
+//! |------|---------------------------------------------------------|
+//! | 0    | success                                                 |
+//! | 1    | error                                                   |
+//! | 2    | usage: a bad flag, or a pack that doesn't exist         |
+//! | 3    | conflicts: files in the way, `--force` would replace them |
+//! | 4    | partial failure: the run finished, some operations failed |
+//! | 5    | nothing to do                                           |
+//!
+//! Errors map through [`DodotError::exit_code`]; commands that finish
+//! with a result say how it went in [`PackStatusResult::exit_code`].
+//! The CLI applies both after dispatch. The check commands (`status
+//! --check`, `doctor`, `transform check`) keep the codes they have
+//! always documented.
+//!
+//! [`PackStatusResult::exit_code`]: crate::commands::PackStatusResult::exit_code
+
+use serde::Serialize;
+
+use super::DodotError;
+
+/// How a command ended, as a process exit code.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "snake_case")]
+pub enum ExitCode {
+    #[default]
+    Success,
+    Error,
+    Usage,
+    Conflict,
+    Partial,
+    NothingToDo,
+}
+
+impl ExitCode {
+    pub fn code(self) -> i32 {
+        match self {
+            ExitCode::Success => 0,
+            ExitCode::Error => 1,
+            ExitCode::Usage => 2,
+            ExitCode::Conflict => 3,
+            ExitCode::Partial => 4,
+            ExitCode::NothingToDo => 5,
+        }
+    }
+}
+
+impl DodotError {
+    /// The exit code a command failing with this error ends with.
+    pub fn exit_code(&self) -> ExitCode {
+        match self {
+            DodotError::PackNotFound { .. } => ExitCode::Usage,
+            DodotError::SymlinkConflict { .. } | DodotError::CrossPackConflict { .. } => {
+                ExitCode::Conflict
+            }
+            _ => ExitCode::Error,
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn errors_map_to_their_documented_codes() {
+        let missing = DodotError::PackNotFound { name: "vim".into() };
+        assert_eq!(missing.exit_code().code(), 2);
+
+        let conflict = DodotError::SymlinkConflict {
+            path: "/home/u/.vimrc".into(),
+        };
+        assert_eq!(conflict.exit_code().code(), 3);
+
+        assert_eq!(DodotError::Config("bad".into()).exit_code().code(), 1);
+        assert_eq!(ExitCode::default().code(), 0);
+    }
+}
@@ -1,3 +1,8 @@
+pub mod catalog;
+mod exit;
+
+pub use exit::ExitCode;
+
 use std::path::PathBuf;
 use thiserror::Error;
 
@@ -14,6 +19,12 @@ pub enum DodotError {
         source: std::io::Error,
     },
 
+    #[error("refusing to write {path}: --no-write-home keeps dodot out of $HOME")]
+    HomeWriteRefused { path: PathBuf },
+
+    #[error("pre-flight checks failed, nothing was changed:\n{}", .problems.iter().map(|p| format!("  - {p}")).collect::<Vec<_>>().join("\n"))]
+    PreflightFailed { problems: Vec<String> },
+
     #[error("symlink conflict: {path} already exists and is not managed by dodot")]
     SymlinkConflict { path: PathBuf },
 
@@ -43,6 +54,9 @@ pub enum DodotError {
         command: String,
         exit_code: i32,
         stderr: String,
+        /// Whatever the command printed to stdout before it failed;
+        /// empty when it couldn't be started.
+        stdout: String,
     },
 
     #[error("invalid pattern {pattern}: {reason}")]
@@ -85,7 +99,7 @@ pub enum DodotError {
         message: String,
     },
 
-    #[error("template variable name \"{name}\" is reserved (dodot and env are built-in namespaces); choose a different name in [preprocessor.template.vars]")]
+    #[error("template variable name \"{name}\" is reserved (dodot, env and data are built-in namespaces); choose a different name in [preprocessor.template.vars]")]
     TemplateReservedVar { name: String },
 
     // Hint uses `git diff -- '<path>'`: the `--` separator defangs paths
@@ -99,6 +113,9 @@ pub enum DodotError {
         line_numbers: Vec<usize>,
     },
 
+    #[error("templates use variables with no value: {}", keys.join(", "))]
+    TemplateVarsMissing { keys: Vec<String> },
+
     #[error("{0}")]
     Other(String),
 }
@@ -0,0 +1,405 @@
+//! Dry-run cost estimate: how much provisioning work a plan holds.
+//!
+//! `dodot up --dry-run` and `dodot provision --dry-run` sum the plan up
+//! after the per-intent lines, so a quick relink is told apart from an
+//! afternoon of `brew install`:
+//!
+//! - the run-once commands that would run, and why (first run, changed
+//!   checksum, forced);
+//! - the Brewfile entries `brew bundle` would install, from
+//!   [`homebrew::missing_entries`];
+//! - what the fetches would download, sized by the server's
+//!   `Content-Length` (see
+//!   [`crate::external::HttpFetcher::content_length`]);
+//! - run-once files changed since their last run that stay skipped
+//!   without `--force`.
+//!
+//! Every query is best effort: a brew that can't be asked or a server
+//! that sends no length leaves that part unknown instead of failing
+//! the dry run.
+
+use serde::Serialize;
+
+use crate::datastore::DidRunStatus;
+use crate::external::FetchSpec;
+use crate::handlers::symlink::guard::human_size;
+use crate::handlers::{homebrew, HANDLER_HOMEBREW};
+use crate::operations::HandlerIntent;
+
+use super::{fetch_sentinel, Executor};
+
+/// Why a run-once command would run.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "kebab-case")]
+pub enum RunReason {
+    /// No sentinel for the file yet.
+    FirstRun,
+    /// The file changed since its last run, and `--force` re-runs it.
+    Changed,
+    /// Unchanged, re-run because of `--force` or `dodot provision`.
+    Forced,
+}
+
+/// One run-once command that would run.
+#[derive(Debug, Clone, Serialize)]
+pub struct RunEstimate {
+    pub pack: String,
+    pub handler: String,
+    pub filename: String,
+    pub reason: RunReason,
+}
+
+/// One fetch that would download.
+#[derive(Debug, Clone, Serialize)]
+pub struct DownloadEstimate {
+    pub pack: String,
+    pub name: String,
+    pub url: String,
+    /// `None` for git clones and servers that send no length.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub bytes: Option<u64>,
+}
+
+/// The provisioning work in a set of intents. Links and staged files
+/// are cheap and left out.
+#[derive(Debug, Clone, Default, Serialize)]
+pub struct WorkEstimate {
+    pub runs: Vec<RunEstimate>,
+    /// Brewfile entries not installed yet, over every Brewfile that
+    /// would run. Casks carry a ` (cask)` suffix.
+    pub brew_missing: Vec<String>,
+    /// Brewfiles that would run but brew couldn't be asked about.
+    pub brew_unknown: usize,
+    pub downloads: Vec<DownloadEstimate>,
+    /// `<pack>/<file>` of run-once files changed since their last run
+    /// that are skipped without `--force`.
+    pub held_back: Vec<String>,
+}
+
+impl WorkEstimate {
+    pub fn is_empty(&self) -> bool {
+        self.runs.is_empty() && self.downloads.is_empty() && self.held_back.is_empty()
+    }
+
+    /// Total bytes the downloads would fetch, and how many of them
+    /// have no known size.
+    pub fn download_bytes(&self) -> (u64, usize) {
+        let known = self.downloads.iter().filter_map(|d| d.bytes).sum();
+        let unknown = self.downloads.iter().filter(|d| d.bytes.is_none()).count();
+        (known, unknown)
+    }
+
+    /// One line per kind of work, for the text renderings.
+    pub fn lines(&self) -> Vec<String> {
+        let mut lines = Vec::new();
+        if !self.runs.is_empty() {
+            let why: Vec<String> = [
+                (RunReason::FirstRun, "first run"),
+                (RunReason::Changed, "changed"),
+                (RunReason::Forced, "forced"),
+            ]
+            .into_iter()
+            .filter_map(|(reason, label)| {
+                let n = self.runs.iter().filter(|r| r.reason == reason).count();
+                (n > 0).then(|| format!("{n} {label}"))
+            })
+            .collect();
+            lines.push(format!(
+                "{} provisioning step(s) to run ({})",
+                self.runs.len(),
+                why.join(", ")
+            ));
+        }
+
+        let brewfiles = self
+            .runs
+            .iter()
+            .filter(|r| r.handler == HANDLER_HOMEBREW)
+            .count();
+        if brewfiles > self.brew_unknown {
+            let mut line = match self.brew_missing.len() {
+                0 => "brew: every Brewfile entry is already installed".to_string(),
+                n => format!("brew: {n} package(s) to install"),
+            };
+            if self.brew_unknown > 0 {
+                line.push_str(&format!(
+                    "; {} Brewfile(s) brew couldn't check",
+                    self.brew_unknown
+                ));
+            }
+            lines.push(line);
+        } else if self.brew_unknown > 0 {
+            lines.push(format!(
+                "brew: {} Brewfile(s) brew couldn't check",
+                self.brew_unknown
+            ));
+        }
+
+        if !self.downloads.is_empty() {
+            let (bytes, unknown) = self.download_bytes();
+            let mut line = format!(
+                "downloads: {} to fetch, {}",
+                self.downloads.len(),
+                human_size(bytes)
+            );
+            if unknown > 0 {
+                line.push_str(&format!(" plus {unknown} of unknown size"));
+            }
+            lines.push(line);
+        }
+
+        if !self.held_back.is_empty() {
+            lines.push(format!(
+                "{} changed since the last run, skipped without --force: {}",
+                self.held_back.len(),
+                self.held_back.join(", ")
+            ));
+        }
+        lines
+    }
+}
+
+impl<'a> Executor<'a> {
+    /// Estimate the provisioning work in `intents` without doing any of
+    /// it. Follows the same run/skip policy as [`Executor::execute`].
+    pub fn estimate<'i>(
+        &self,
+        intents: impl IntoIterator<Item = &'i HandlerIntent>,
+    ) -> WorkEstimate {
+        let mut estimate = WorkEstimate::default();
+        for intent in intents {
+            match intent {
+                HandlerIntent::Run { .. } => self.estimate_run(intent, &mut estimate),
+                HandlerIntent::Fetch { .. } => self.estimate_fetch(intent, &mut estimate),
+                HandlerIntent::Link { .. } | HandlerIntent::Stage { .. } => {}
+            }
+        }
+        estimate
+    }
+
+    fn estimate_run(&self, intent: &HandlerIntent, estimate: &mut WorkEstimate) {
+        let HandlerIntent::Run {
+            pack,
+            handler,
+            arguments,
+            filename,
+            content_hash,
+            ..
+        } = intent
+        else {
+            return;
+        };
+
+        let status = self
+            .datastore
+            .did_run(pack, handler, filename, content_hash)
+            .unwrap_or(DidRunStatus::NeverRan);
+        let reason = match (status, self.provision_rerun) {
+            (DidRunStatus::NeverRan, _) => RunReason::FirstRun,
+            (DidRunStatus::RanDifferent { .. }, true) => RunReason::Changed,
+            (DidRunStatus::RanCurrent, true) => RunReason::Forced,
+            (DidRunStatus::RanDifferent { .. }, false) => {
+                estimate.held_back.push(format!("{pack}/{filename}"));
+                return;
+            }
+            (DidRunStatus::RanCurrent, false) => return,
+        };
+
+        if handler == HANDLER_HOMEBREW {
+            let missing = self
+                .command_runner
+                .zip(homebrew::brewfile_argument(arguments))
+                .and_then(|(runner, brewfile)| homebrew::missing_entries(runner, brewfile).ok());
+            match missing {
+                Some(missing) => estimate.brew_missing.extend(missing),
+                None => estimate.brew_unknown += 1,
+            }
+        }
+        estimate.runs.push(RunEstimate {
+            pack: pack.clone(),
+            handler: handler.clone(),
+            filename: filename.clone(),
+            reason,
+        });
+    }
+
+    fn estimate_fetch(&self, intent: &HandlerIntent, estimate: &mut WorkEstimate) {
+        let HandlerIntent::Fetch {
+            pack,
+            handler,
+            name,
+            spec,
+            ..
+        } = intent
+        else {
+            return;
+        };
+
+        let (url, bytes) = match spec {
+            FetchSpec::GitRepo { url, .. } => {
+                let clone = self.paths.handler_data_dir(pack, handler).join(name);
+                if self.fs.exists(&clone) {
+                    // An existing clone only fetches when upstream moved,
+                    // which the dry run doesn't ask.
+                    return;
+                }
+                (url, None)
+            }
+            FetchSpec::File { url, .. }
+            | FetchSpec::Archive { url, .. }
+            | FetchSpec::ArchiveFile { url, .. }
+            | FetchSpec::Binary { url, .. } => {
+                let fresh = !self.force
+                    && fetch_sentinel(name, spec).is_some_and(|s| {
+                        self.datastore
+                            .has_sentinel(pack, handler, &s)
+                            .unwrap_or(false)
+                    });
+                if fresh {
+                    return;
+                }
+                (url, self.fetcher().and_then(|f| f.content_length(url)))
+            }
+            FetchSpec::Unsupported => return,
+        };
+        estimate.downloads.push(DownloadEstimate {
+            pack: pack.clone(),
+            name: name.clone(),
+            url: url.clone(),
+            bytes,
+        });
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::super::test_support::make_datastore;
+    use super::*;
+    use crate::testing::TempEnvironment;
+
+    fn run_intent(filename: &str, hash: &str) -> HandlerIntent {
+        HandlerIntent::Run {
+            pack: "dev".into(),
+            handler: "install".into(),
+            executable: "bash".into(),
+            arguments: vec![format!("/p/{filename}")],
+            sentinel: format!("{filename}-{hash}"),
+            filename: filename.into(),
+            content_hash: hash.into(),
+        }
+    }
+
+    #[test]
+    fn estimate_counts_first_runs_and_holds_back_changed_files() {
+        let env = TempEnvironment::builder().build();
+        let (ds, _) = make_datastore(&env);
+        let executor = Executor::new(
+            &ds,
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            false,
+            false,
+            false,
+            true,
+        );
+        executor
+            .execute(vec![run_intent("install.sh", "aaaaaaaaaaaaaaaa")])
+            .unwrap();
+
+        let intents = [
+            run_intent("install.sh", "bbbbbbbbbbbbbbbb"),
+            run_intent("setup.sh", "cccccccccccccccc"),
+        ];
+        let estimate = executor.estimate(&intents);
+        assert_eq!(estimate.runs.len(), 1);
+        assert_eq!(estimate.runs[0].filename, "setup.sh");
+        assert_eq!(estimate.runs[0].reason, RunReason::FirstRun);
+        assert_eq!(estimate.held_back, vec!["dev/install.sh".to_string()]);
+
+        let lines = estimate.lines();
+        assert_eq!(lines[0], "1 provisioning step(s) to run (1 first run)");
+        assert!(lines[1].contains("dev/install.sh"), "{lines:?}");
+    }
+
+    /// `bundle check` fails and the Brewfile lists one formula brew
+    /// doesn't have — but only when asked about `/p/Brewfile`.
+    struct BrewRunner;
+    impl crate::datastore::CommandRunner for BrewRunner {
+        fn run(
+            &self,
+            _executable: &str,
+            arguments: &[String],
+        ) -> crate::Result<crate::datastore::CommandOutput> {
+            let args: Vec<&str> = arguments.iter().map(String::as_str).collect();
+            let failed = || crate::DodotError::CommandFailed {
+                command: args.join(" "),
+                exit_code: 1,
+                stderr: String::new(),
+                stdout: String::new(),
+            };
+            if homebrew::brewfile_argument(arguments).is_some_and(|f| f != "/p/Brewfile") {
+                return Err(failed());
+            }
+            let stdout = match args.as_slice() {
+                ["bundle", "check", ..] => return Err(failed()),
+                ["bundle", "list", .., "--formula"] => "ripgrep\n",
+                _ => "",
+            };
+            Ok(crate::datastore::CommandOutput {
+                exit_code: 0,
+                stdout: stdout.into(),
+                stderr: String::new(),
+            })
+        }
+    }
+
+    #[test]
+    fn estimate_asks_brew_about_a_pinned_brewfile() {
+        let env = TempEnvironment::builder().build();
+        let (ds, _) = make_datastore(&env);
+        let brew = BrewRunner;
+        let executor = Executor::new(
+            &ds,
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            true,
+            false,
+            false,
+            true,
+        )
+        .with_command_runner(&brew);
+
+        let intent = HandlerIntent::Run {
+            pack: "dev".into(),
+            handler: HANDLER_HOMEBREW.into(),
+            executable: "brew".into(),
+            arguments: ["bundle", homebrew::NO_UPGRADE, "--file", "/p/Brewfile"]
+                .map(String::from)
+                .to_vec(),
+            sentinel: "Brewfile-aaaaaaaaaaaaaaaa".into(),
+            filename: "Brewfile".into(),
+            content_hash: "aaaaaaaaaaaaaaaa".into(),
+        };
+        let estimate = executor.estimate([&intent]);
+        assert_eq!(estimate.brew_missing, vec!["ripgrep".to_string()]);
+        assert_eq!(estimate.brew_unknown, 0);
+    }
+
+    #[test]
+    fn download_lines_sum_known_sizes() {
+        let download = |bytes| DownloadEstimate {
+            pack: "tools".into(),
+            name: "rg".into(),
+            url: "https://example.com/rg".into(),
+            bytes,
+        };
+        let estimate = WorkEstimate {
+            downloads: vec![download(Some(2048)), download(Some(1024)), download(None)],
+            ..Default::default()
+        };
+        assert_eq!(
+            estimate.lines(),
+            vec!["downloads: 3 to fetch, 3.0 KB plus 1 of unknown size".to_string()]
+        );
+    }
+}
@@ -7,6 +7,8 @@
 //! - For `file`, the signature is the user-declared sha256 in
 //!   `externals.toml`. Re-running `up` with the same sha256 is a
 //!   no-op; bumping it invalidates the old sentinel.
+//! - For `archive`, `archive-file` and `binary`, it is the archive's
+//!   (or binary's) sha256, plus the member path when one is named.
 //! - For `git-repo`, the signature is the upstream HEAD SHA returned
 //!   by a cheap `git ls-remote`. If the remote SHA matches the local
 //!   clone's HEAD, the clone is left alone — even if `up` is run
@@ -95,10 +97,44 @@ impl<'a> Executor<'a> {
                 Some(member.as_str()),
                 user_path,
             ),
+            FetchSpec::Binary {
+                url,
+                sha256,
+                member,
+                format,
+            } => {
+                let results = match member {
+                    Some(m) => self.execute_fetch_archive(
+                        pack,
+                        handler,
+                        name,
+                        url,
+                        sha256,
+                        *format,
+                        Some(m.as_str()),
+                        user_path,
+                    )?,
+                    None => self.execute_fetch_file(pack, handler, name, url, sha256, user_path)?,
+                };
+                // Archive members may carry no mode, and a plain
+                // download never does.
+                let written = self
+                    .paths
+                    .handler_data_dir(pack, handler)
+                    .join(name)
+                    .join(match member {
+                        Some(m) => filename_for_target(Path::new(m)),
+                        None => filename_for_target(user_path),
+                    });
+                if self.fs.exists(&written) {
+                    self.fs.set_permissions(&written, 0o755)?;
+                }
+                Ok(results)
+            }
             FetchSpec::Unsupported => Ok(vec![OperationResult::fail(
                 fetch_op(pack, handler, name, "<unsupported>"),
                 format!(
-                    "external '{name}': unsupported type — supported in this release: `file`, `git-repo`, `archive`, `archive-file`"
+                    "external '{name}': unsupported type — supported in this release: `file`, `git-repo`, `archive`, `archive-file`, `binary`"
                 ),
             )]),
         }
@@ -209,6 +245,23 @@ impl<'a> Executor<'a> {
                 };
                 vec![OperationResult::ok(fetch_op(pack, handler, name, url), msg)]
             }
+            FetchSpec::Binary { url, sha256, .. } => {
+                let already = fetch_sentinel(name, spec).is_some_and(|s| {
+                    self.datastore
+                        .has_sentinel(pack, handler, &s)
+                        .unwrap_or(false)
+                });
+                let msg = if already {
+                    format!("[dry-run] {name} fresh (sha256 matches)")
+                } else {
+                    format!(
+                        "[dry-run] would download {url}, verify sha256={} → {}",
+                        short(sha256),
+                        user_path.display()
+                    )
+                };
+                vec![OperationResult::ok(fetch_op(pack, handler, name, url), msg)]
+            }
             FetchSpec::Unsupported => vec![OperationResult::fail(
                 fetch_op(pack, handler, name, "<unsupported>"),
                 format!("[dry-run] external '{name}': unsupported type"),
@@ -319,7 +372,7 @@ impl<'a> Executor<'a> {
         // Symlink the user-visible target → datastore copy. We already
         // pre-checked for non-symlink conflicts above, so this only
         // needs to handle "remove existing dodot symlink and re-create".
-        self.create_external_user_link(&datastore_path, user_path)?;
+        self.create_external_user_link(pack, &datastore_path, user_path)?;
 
         // Record sentinel so subsequent up's are no-ops.
         self.write_sentinel(pack, handler, &sentinel)?;
@@ -506,7 +559,7 @@ impl<'a> Executor<'a> {
         };
 
         // User-visible symlink.
-        self.create_external_user_link(&symlink_target, user_path)?;
+        self.create_external_user_link(pack, &symlink_target, user_path)?;
         self.write_sentinel(pack, handler, &sentinel)?;
 
         let create_link = Operation::CreateUserLink {
@@ -865,7 +918,7 @@ impl<'a> Executor<'a> {
         user_path: &Path,
         sha: &str,
     ) -> Result<Vec<OperationResult>> {
-        self.create_external_user_link(symlink_target, user_path)?;
+        self.create_external_user_link(pack, symlink_target, user_path)?;
         let sentinel = git_repo_sentinel(name, sha);
         self.write_sentinel(pack, handler, &sentinel)?;
 
@@ -937,7 +990,7 @@ impl<'a> Executor<'a> {
             )]);
         }
 
-        self.create_external_user_link(expected_datastore_path, user_path)?;
+        self.create_external_user_link(pack, expected_datastore_path, user_path)?;
         let create_link = Operation::CreateUserLink {
             pack: pack.to_string(),
             handler: handler.to_string(),
@@ -969,7 +1022,7 @@ impl<'a> Executor<'a> {
         if self.force {
             return None;
         }
-        Some(vec![OperationResult::fail(
+        Some(vec![OperationResult::conflict(
             op(),
             format!(
                 "{name}: conflict — {} already exists and is not a dodot symlink (use --force to overwrite)",
@@ -983,15 +1036,17 @@ impl<'a> Executor<'a> {
     /// needed. Non-symlink conflicts must be pre-checked via
     /// [`Self::check_external_target_conflict`] before calling — this
     /// helper assumes the caller has confirmed it's safe to overwrite.
-    fn create_external_user_link(&self, datastore_path: &Path, user_path: &Path) -> Result<()> {
+    fn create_external_user_link(
+        &self,
+        pack: &str,
+        datastore_path: &Path,
+        user_path: &Path,
+    ) -> Result<()> {
         if !self.fs.is_symlink(user_path) && self.fs.exists(user_path) {
             // Caller is supposed to have pre-checked. `--force` is the
-            // only way to land here; consume the conflicting path.
-            if self.fs.is_dir(user_path) {
-                self.fs.remove_dir_all(user_path)?;
-            } else {
-                self.fs.remove_file(user_path)?;
-            }
+            // only way to land here; the conflicting path goes to the
+            // trash.
+            self.clear_target(pack, user_path, true)?;
         }
         // `create_user_link` is idempotent against an existing dodot
         // symlink — replaces it if the target differs, no-ops if it
@@ -1003,17 +1058,31 @@ impl<'a> Executor<'a> {
         // Sentinels live alongside other handler state. The
         // `write_rendered_file` path conveniently creates parent dirs
         // and accepts arbitrary content.
-        let timestamp = std::time::SystemTime::now()
-            .duration_since(std::time::UNIX_EPOCH)
-            .unwrap_or_default()
-            .as_secs();
-        let content = format!("completed|{timestamp}");
+        let content = crate::datastore::SentinelRecord::now(None).to_content();
         self.datastore
             .write_rendered_file(pack, handler, sentinel, content.as_bytes())?;
         Ok(())
     }
 }
 
+/// The sentinel a successful fetch of `spec` leaves behind, for the
+/// content-addressed types. `None` for `git-repo`, whose sentinel
+/// depends on the upstream commit.
+pub(crate) fn fetch_sentinel(name: &str, spec: &FetchSpec) -> Option<String> {
+    match spec {
+        FetchSpec::File { sha256, .. } => Some(file_sentinel(name, sha256)),
+        FetchSpec::Archive { sha256, .. } => Some(archive_sentinel(name, sha256, None)),
+        FetchSpec::ArchiveFile { sha256, member, .. } => {
+            Some(archive_sentinel(name, sha256, Some(member)))
+        }
+        FetchSpec::Binary { sha256, member, .. } => Some(match member {
+            Some(m) => archive_sentinel(name, sha256, Some(m)),
+            None => file_sentinel(name, sha256),
+        }),
+        FetchSpec::GitRepo { .. } | FetchSpec::Unsupported => None,
+    }
+}
+
 /// Build the sentinel filename for a `type = "file"` entry.
 fn file_sentinel(name: &str, sha256: &str) -> String {
     format!("{name}-{}", short(sha256))
@@ -2201,4 +2270,59 @@ mod tests {
             results[0].message
         );
     }
+
+    #[test]
+    fn binary_is_written_executable_and_refetched_on_a_new_hash() {
+        use std::os::unix::fs::PermissionsExt;
+
+        let env = TempEnvironment::builder().build();
+        let (ds, _) = make_datastore(&env);
+        let v2 = b"#!/bin/sh\necho v2\n";
+        let fetcher = MockFetcher::new()
+            .with("https://example.com/1/tool", known_body())
+            .with("https://example.com/2/tool", v2);
+        let executor = Executor::new(
+            &ds,
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            false,
+            false,
+            false,
+            true,
+        )
+        .with_fetcher(&fetcher);
+
+        let bin = env
+            .paths
+            .handler_data_dir("cli", "download")
+            .join("bin/tool");
+        let intent = |version: &str, sha256: String| HandlerIntent::Fetch {
+            pack: "cli".into(),
+            handler: "download".into(),
+            name: "tool".into(),
+            spec: FetchSpec::Binary {
+                url: format!("https://example.com/{version}/tool"),
+                sha256,
+                member: None,
+                format: None,
+            },
+            user_path: bin.clone(),
+        };
+
+        let results = executor.execute(vec![intent("1", known_sha())]).unwrap();
+        assert!(results.iter().all(|r| r.success), "{results:?}");
+        let mode = std::fs::metadata(&bin).unwrap().permissions().mode();
+        assert_eq!(mode & 0o777, 0o755);
+
+        // Same hash: nothing to fetch. New version, new hash: refetched.
+        executor.execute(vec![intent("1", known_sha())]).unwrap();
+        executor
+            .execute(vec![intent("2", super::sha256_hex(v2))])
+            .unwrap();
+        assert_eq!(
+            fetcher.calls(),
+            ["https://example.com/1/tool", "https://example.com/2/tool"]
+        );
+        assert_eq!(env.fs.read_to_string(&bin).unwrap(), "#!/bin/sh\necho v2\n");
+    }
 }
@@ -1,16 +1,22 @@
 //! `Link` intent: deploy a source file by symlink, via the
 //! datastore-mediated double-link (source → datastore → user_path).
+//! Under `[symlink] link_strategy = "direct"` the user link points at
+//! the source instead; the data link is still created as the record.
 //!
 //! Owns ancestor-cycle detection (refuse to write through a symlink
 //! that resolves back into the dodot store), conflict handling (the
-//! `--force` / content-equivalence escape hatch), and the dry-run
+//! `--force` / content-equivalence escape hatch), the
+//! `--no-write-home` stop at the data link, and the dry-run
 //! simulation.
 
 use std::path::{Path, PathBuf};
 
 use tracing::{debug, info};
 
-use crate::operations::{HandlerIntent, Operation, OperationResult};
+use crate::copies;
+use crate::operations::{HandlerIntent, LinkMode, LinkStrategy, Operation, OperationResult};
+use crate::perms::{self, Perms};
+use crate::trash;
 use crate::Result;
 
 use super::Executor;
@@ -22,6 +28,8 @@ impl<'a> Executor<'a> {
             handler,
             source,
             user_path,
+            mode,
+            perms,
         } = intent
         else {
             unreachable!("execute_link called with non-Link intent");
@@ -52,6 +60,28 @@ impl<'a> Executor<'a> {
             )]);
         }
 
+        // --no-write-home: stage the data link, which lives in the data
+        // dir, and stop there. The file shows as pending in `status`.
+        if self.fs.write_refused(user_path) {
+            let op = Operation::CreateDataLink {
+                pack: pack.clone(),
+                handler: handler.clone(),
+                source: source.clone(),
+            };
+            if *mode == LinkMode::Symlink {
+                self.datastore.create_data_link(pack, handler, source)?;
+            }
+            info!(pack, path = %user_path.display(), "home write refused, not linking");
+            return Ok(vec![OperationResult::ok(
+                op,
+                no_write_home_message(source, user_path),
+            )]);
+        }
+
+        if *mode != LinkMode::Symlink {
+            return self.execute_copy(pack, handler, source, user_path, *mode, perms.as_ref());
+        }
+
         // Pre-check: does a non-symlink file exist at user_path?
         // We check BEFORE creating the data link to avoid leaving
         // dangling state when the user link would fail.
@@ -60,6 +90,7 @@ impl<'a> Executor<'a> {
         // the source we'd deploy, treat it as safe to replace —
         // the content reaching `user_path` doesn't change, only
         // the storage representation does. No `--force` required.
+        let mut trashed = None;
         if !self.fs.is_symlink(user_path) && self.fs.exists(user_path) {
             let content_equivalent = crate::equivalence::is_equivalent(user_path, source, self.fs);
             if self.force || content_equivalent {
@@ -69,19 +100,10 @@ impl<'a> Executor<'a> {
                         path = %user_path.display(),
                         "auto-replacing content-equivalent file with dodot symlink"
                     );
-                } else {
-                    info!(
-                        pack,
-                        path = %user_path.display(),
-                        "force-removing existing file"
-                    );
-                }
-                // Remove the existing path before creating the symlink
-                if self.fs.is_dir(user_path) {
-                    self.fs.remove_dir_all(user_path)?;
-                } else {
-                    self.fs.remove_file(user_path)?;
                 }
+                // Clear the existing path before creating the symlink;
+                // a forced replacement keeps the original in the trash.
+                trashed = self.clear_target(pack, user_path, !content_equivalent)?;
             } else {
                 info!(
                     pack,
@@ -96,7 +118,7 @@ impl<'a> Executor<'a> {
                     datastore_path: Default::default(),
                     user_path: user_path.clone(),
                 };
-                return Ok(vec![OperationResult::fail(
+                return Ok(vec![OperationResult::conflict(
                     op,
                     format!(
                         "conflict: {} already exists (use --force to overwrite)",
@@ -114,9 +136,14 @@ impl<'a> Executor<'a> {
             "created data link"
         );
 
-        // Step 2: Create user link (datastore → user location)
-        self.datastore
-            .create_user_link(&datastore_path, user_path)?;
+        // Step 2: Create user link (datastore → user location, or
+        // source → user location under the direct strategy)
+        let link_target = match self.link_strategy {
+            LinkStrategy::Double => datastore_path.as_path(),
+            LinkStrategy::Direct => source.as_path(),
+        };
+        self.datastore.create_user_link(link_target, user_path)?;
+        let note = self.apply_perms(user_path, perms.as_ref())?;
 
         let filename = source.file_name().unwrap_or_default().to_string_lossy();
         info!(
@@ -135,7 +162,13 @@ impl<'a> Executor<'a> {
 
         Ok(vec![OperationResult::ok(
             op,
-            format!("{} → {}", filename, user_path.display()),
+            format!(
+                "{} → {}{}{}",
+                filename,
+                user_path.display(),
+                trashed_suffix(trashed.as_deref()),
+                note_suffix(note.as_deref())
+            ),
         )])
     }
 
@@ -145,6 +178,8 @@ impl<'a> Executor<'a> {
             handler,
             source,
             user_path,
+            mode,
+            ..
         } = intent
         else {
             unreachable!("simulate_link called with non-Link intent");
@@ -164,6 +199,22 @@ impl<'a> Executor<'a> {
             )];
         }
 
+        if self.fs.write_refused(user_path) {
+            let op = Operation::CreateDataLink {
+                pack: pack.clone(),
+                handler: handler.clone(),
+                source: source.clone(),
+            };
+            return vec![OperationResult::ok(
+                op,
+                no_write_home_message(source, user_path),
+            )];
+        }
+
+        if *mode != LinkMode::Symlink {
+            return self.simulate_copy(pack, handler, source, user_path, *mode);
+        }
+
         // Check for conflicts even in dry-run
         if !self.fs.is_symlink(user_path) && self.fs.exists(user_path) {
             if self.force {
@@ -175,13 +226,13 @@ impl<'a> Executor<'a> {
                         user_path: user_path.clone(),
                     },
                     format!(
-                        "[dry-run] would overwrite {} → {}",
+                        "[dry-run] would overwrite {} → {} (original to trash)",
                         source.file_name().unwrap_or_default().to_string_lossy(),
                         user_path.display()
                     ),
                 )];
             } else {
-                return vec![OperationResult::fail(
+                return vec![OperationResult::conflict(
                     Operation::CreateUserLink {
                         pack: pack.clone(),
                         handler: handler.clone(),
@@ -211,6 +262,159 @@ impl<'a> Executor<'a> {
         )]
     }
 
+    /// `[symlink] mode = "copy" | "hardlink"`: record the data link as
+    /// usual (so `status` / `down` see the file), then write a copy or
+    /// hard link of the source at `user_path` and record its content
+    /// hash. An existing target is replaced when it is what dodot last
+    /// deployed (or already matches the source); local edits and
+    /// unrecorded files are conflicts unless `--force`.
+    fn execute_copy(
+        &self,
+        pack: &str,
+        handler: &str,
+        source: &Path,
+        user_path: &Path,
+        mode: LinkMode,
+        perms: Option<&Perms>,
+    ) -> Result<Vec<OperationResult>> {
+        let op = |datastore_path: PathBuf| Operation::CreateUserLink {
+            pack: pack.to_string(),
+            handler: handler.to_string(),
+            datastore_path,
+            user_path: user_path.to_path_buf(),
+        };
+
+        if let Some(reason) = self.copy_blocker(pack, source, user_path) {
+            return Ok(vec![OperationResult::conflict(op(PathBuf::new()), reason)]);
+        }
+        let mut trashed = None;
+        if self.fs.is_symlink(user_path) || self.fs.exists(user_path) {
+            // Only reachable for user content with --force, see copy_blocker.
+            let user_content = matches!(
+                copies::copy_state(self.fs, self.paths, pack, source, user_path),
+                copies::CopyState::TargetEdited | copies::CopyState::Unrecorded
+            );
+            trashed = self.clear_target(pack, user_path, user_content)?;
+        }
+
+        let datastore_path = self.datastore.create_data_link(pack, handler, source)?;
+        copies::materialize(self.fs, source, user_path, mode)?;
+        let hash = copies::content_hash(self.fs, source)?;
+        copies::write_record(self.fs, self.paths, pack, user_path, &hash)?;
+        let note = self.apply_perms(user_path, perms)?;
+
+        let filename = source.file_name().unwrap_or_default().to_string_lossy();
+        info!(
+            pack,
+            file = %filename,
+            target = %user_path.display(),
+            mode = mode.as_str(),
+            "deployed file"
+        );
+        Ok(vec![OperationResult::ok(
+            op(datastore_path),
+            format!(
+                "{} ⇒ {} ({}){}{}",
+                filename,
+                user_path.display(),
+                mode.as_str(),
+                trashed_suffix(trashed.as_deref()),
+                note_suffix(note.as_deref())
+            ),
+        )])
+    }
+
+    /// A rule's `chmod` / `chown` on the deployed target, after every
+    /// deploy so drift is undone by the next `up`. Returns a note for
+    /// the result message when the owner couldn't be changed.
+    fn apply_perms(&self, user_path: &Path, perms: Option<&Perms>) -> Result<Option<String>> {
+        let Some(perms) = perms else {
+            return Ok(None);
+        };
+        let note = perms::apply(self.fs, user_path, perms)?;
+        debug!(path = %user_path.display(), ?perms, "applied permissions");
+        Ok(note)
+    }
+
+    /// Empty `user_path` for a deploy. With `user_content` set (a file
+    /// dodot didn't put there, only replaced under `--force`) the
+    /// occupant moves to the trash and its entry id is returned;
+    /// otherwise it is deleted.
+    pub(super) fn clear_target(
+        &self,
+        pack: &str,
+        user_path: &Path,
+        user_content: bool,
+    ) -> Result<Option<String>> {
+        if self.fs.is_symlink(user_path) {
+            self.fs.remove_file(user_path)?;
+            return Ok(None);
+        }
+        if user_content {
+            let entry = trash::move_to_trash(self.fs, self.paths, pack, user_path)?;
+            info!(
+                pack,
+                path = %user_path.display(),
+                id = %entry.id,
+                "moved existing file to trash"
+            );
+            return Ok(Some(entry.id));
+        }
+        if self.fs.is_dir(user_path) {
+            self.fs.remove_dir_all(user_path)?;
+        } else {
+            self.fs.remove_file(user_path)?;
+        }
+        Ok(None)
+    }
+
+    fn simulate_copy(
+        &self,
+        pack: &str,
+        handler: &str,
+        source: &Path,
+        user_path: &Path,
+        mode: LinkMode,
+    ) -> Vec<OperationResult> {
+        let op = Operation::CreateUserLink {
+            pack: pack.to_string(),
+            handler: handler.to_string(),
+            datastore_path: Default::default(),
+            user_path: user_path.to_path_buf(),
+        };
+        if let Some(reason) = self.copy_blocker(pack, source, user_path) {
+            return vec![OperationResult::conflict(op, reason)];
+        }
+        vec![OperationResult::ok(
+            op,
+            format!(
+                "[dry-run] would {} {} → {}",
+                mode.as_str(),
+                source.file_name().unwrap_or_default().to_string_lossy(),
+                user_path.display()
+            ),
+        )]
+    }
+
+    /// Conflict reason when replacing `user_path` would lose content
+    /// dodot didn't put there; `None` when it's safe (or `--force`).
+    fn copy_blocker(&self, pack: &str, source: &Path, user_path: &Path) -> Option<String> {
+        if self.force || self.fs.is_symlink(user_path) {
+            return None;
+        }
+        match copies::copy_state(self.fs, self.paths, pack, source, user_path) {
+            copies::CopyState::TargetEdited => Some(format!(
+                "conflict: {} was edited since it was deployed (use --force to overwrite)",
+                user_path.display()
+            )),
+            copies::CopyState::Unrecorded => Some(format!(
+                "conflict: {} already exists (use --force to overwrite)",
+                user_path.display()
+            )),
+            _ => None,
+        }
+    }
+
     /// Walk `user_path`'s ancestors. If any is a symlink whose single-hop
     /// resolved target lives under `dotfiles_root` or `data_dir`, return
     /// `(ancestor, resolved_target)`. Writing through such an ancestor
@@ -244,6 +448,30 @@ impl<'a> Executor<'a> {
     }
 }
 
+/// Result-message tail pointing at a trashed original.
+pub(super) fn trashed_suffix(id: Option<&str>) -> String {
+    match id {
+        Some(id) => format!(" (previous file in trash: {id})"),
+        None => String::new(),
+    }
+}
+
+/// Result-message tail for a [`perms::apply`] note.
+fn note_suffix(note: Option<&str>) -> String {
+    match note {
+        Some(note) => format!(" ({note})"),
+        None => String::new(),
+    }
+}
+
+fn no_write_home_message(source: &Path, user_path: &Path) -> String {
+    format!(
+        "{} not linked to {} (--no-write-home)",
+        source.file_name().unwrap_or_default().to_string_lossy(),
+        user_path.display()
+    )
+}
+
 fn cycle_message(user_path: &Path, ancestor: &Path, target: &Path) -> String {
     format!(
         "cycle: {} is a symlink into the dodot store (-> {}); \
@@ -261,7 +489,7 @@ mod tests {
     use super::super::test_support::make_datastore;
     use super::super::Executor;
     use crate::fs::Fs;
-    use crate::operations::HandlerIntent;
+    use crate::operations::{HandlerIntent, LinkMode, LinkStrategy};
     use crate::testing::TempEnvironment;
     use std::path::Path;
 
@@ -292,6 +520,8 @@ mod tests {
                 handler: "symlink".into(),
                 source: source.clone(),
                 user_path: user_path.clone(),
+                mode: LinkMode::Symlink,
+                perms: None,
             }])
             .unwrap();
 
@@ -302,6 +532,51 @@ mod tests {
         env.assert_double_link("vim", "symlink", "vimrc", &source, &user_path);
     }
 
+    #[test]
+    fn direct_strategy_links_user_path_to_source() {
+        let env = TempEnvironment::builder()
+            .pack("vim")
+            .file("vimrc", "set nocompatible")
+            .done()
+            .build();
+        let (ds, _) = make_datastore(&env);
+        let executor = Executor::new(
+            &ds,
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            false,
+            false,
+            false,
+            true,
+        )
+        .with_link_strategy(LinkStrategy::Direct);
+
+        let source = env.dotfiles_root.join("vim/vimrc");
+        let user_path = env.home.join(".vimrc");
+        let results = executor
+            .execute(vec![HandlerIntent::Link {
+                pack: "vim".into(),
+                handler: "symlink".into(),
+                source: source.clone(),
+                user_path: user_path.clone(),
+                mode: LinkMode::Symlink,
+                perms: None,
+            }])
+            .unwrap();
+        assert!(results[0].success);
+
+        // The home link skips the datastore; the data link is still
+        // recorded, and `down` still recognises the link as dodot's.
+        let handler_dir = env.paths.handler_data_dir("vim", "symlink");
+        env.assert_symlink(&user_path, &source);
+        env.assert_symlink(&handler_dir.join("vimrc"), &source);
+        assert!(crate::handlers::undo::links_into(
+            env.fs.as_ref(),
+            &user_path,
+            &handler_dir
+        ));
+    }
+
     #[test]
     fn execute_link_conflict_returns_failed_result() {
         let env = TempEnvironment::builder()
@@ -330,6 +605,8 @@ mod tests {
                 handler: "symlink".into(),
                 source: source.clone(),
                 user_path: user_path.clone(),
+                mode: LinkMode::Symlink,
+                perms: None,
             }])
             .unwrap();
 
@@ -381,6 +658,8 @@ mod tests {
                 handler: "symlink".into(),
                 source: source.clone(),
                 user_path: user_path.clone(),
+                mode: LinkMode::Symlink,
+                perms: None,
             }])
             .unwrap();
 
@@ -422,12 +701,16 @@ mod tests {
                     handler: "symlink".into(),
                     source: env.dotfiles_root.join("vim/vimrc"),
                     user_path: env.home.join(".vimrc"),
+                    mode: LinkMode::Symlink,
+                    perms: None,
                 },
                 HandlerIntent::Link {
                     pack: "vim".into(),
                     handler: "symlink".into(),
                     source: env.dotfiles_root.join("vim/gvimrc"),
                     user_path: env.home.join(".gvimrc"),
+                    mode: LinkMode::Symlink,
+                    perms: None,
                 },
             ])
             .unwrap();
@@ -473,6 +756,8 @@ mod tests {
                 handler: "symlink".into(),
                 source: env.dotfiles_root.join("vim/vimrc"),
                 user_path: env.home.join(".vimrc"),
+                mode: LinkMode::Symlink,
+                perms: None,
             }])
             .unwrap();
 
@@ -514,6 +799,8 @@ mod tests {
                 handler: "symlink".into(),
                 source: source.clone(),
                 user_path: user_path.clone(),
+                mode: LinkMode::Symlink,
+                perms: None,
             }])
             .unwrap();
 
@@ -565,6 +852,8 @@ mod tests {
                 handler: "symlink".into(),
                 source: source.clone(),
                 user_path: user_path.clone(),
+                mode: LinkMode::Symlink,
+                perms: None,
             }])
             .unwrap();
 
@@ -608,6 +897,8 @@ mod tests {
                 handler: "symlink".into(),
                 source,
                 user_path,
+                mode: LinkMode::Symlink,
+                perms: None,
             }])
             .unwrap();
 
@@ -654,6 +945,8 @@ mod tests {
                 handler: "symlink".into(),
                 source: source.clone(),
                 user_path,
+                mode: LinkMode::Symlink,
+                perms: None,
             }])
             .unwrap();
 
@@ -703,6 +996,8 @@ mod tests {
                 handler: "symlink".into(),
                 source: source.clone(),
                 user_path,
+                mode: LinkMode::Symlink,
+                perms: None,
             }])
             .unwrap();
 
@@ -716,4 +1011,61 @@ mod tests {
         env.assert_no_handler_state("warp", "symlink");
         env.assert_file_contents(&source, "keep me");
     }
+
+    #[test]
+    fn copy_mode_writes_file_and_guards_local_edits() {
+        let env = TempEnvironment::builder()
+            .pack("vim")
+            .file("vimrc", "set nocompatible")
+            .done()
+            .build();
+        let (ds, _) = make_datastore(&env);
+        let source = env.dotfiles_root.join("vim/vimrc");
+        let user_path = env.home.join(".vimrc");
+        let intent = || HandlerIntent::Link {
+            pack: "vim".into(),
+            handler: "symlink".into(),
+            source: source.clone(),
+            user_path: user_path.clone(),
+            mode: LinkMode::Copy,
+            perms: None,
+        };
+        let run = |force: bool| {
+            Executor::new(
+                &ds,
+                env.fs.as_ref(),
+                env.paths.as_ref(),
+                false,
+                force,
+                false,
+                true,
+            )
+            .execute(vec![intent()])
+            .unwrap()
+        };
+
+        let results = run(false);
+        assert!(results[0].success, "msg: {}", results[0].message);
+        assert!(!env.fs.is_symlink(&user_path));
+        env.assert_file_contents(&user_path, "set nocompatible");
+
+        // Source change: re-deploy refreshes the copy.
+        env.fs.write_file(&source, b"set number").unwrap();
+        assert!(run(false)[0].success);
+        env.assert_file_contents(&user_path, "set number");
+
+        // Local edit: refused without --force, overwritten with it.
+        env.fs.write_file(&user_path, b"local tweak").unwrap();
+        let results = run(false);
+        assert!(!results[0].success);
+        assert!(
+            results[0].message.contains("--force"),
+            "msg: {}",
+            results[0].message
+        );
+        env.assert_file_contents(&user_path, "local tweak");
+
+        assert!(run(true)[0].success);
+        env.assert_file_contents(&user_path, "set number");
+    }
 }
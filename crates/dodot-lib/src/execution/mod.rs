@@ -6,7 +6,8 @@
 //! Per-intent logic lives in sibling files: [`mod@link`] for symlink
 //! deployment (with ancestor-cycle and conflict handling), [`mod@stage`]
 //! for datastore staging (with auto-chmod for path handler bins), and
-//! [`mod@run`] for sentinel-gated command execution. This file owns the
+//! [`mod@run`] for sentinel-gated command execution, and [`mod@estimate`]
+//! sums up the provisioning work a dry run would do. This file owns the
 //! Executor struct, the per-call `execute()` entry point, and the
 //! match-based dispatchers (`execute_one`, `simulate`).
 //!
@@ -23,18 +24,23 @@
 //! `$PATH`, it just won't be directly runnable until the user fixes
 //! permissions manually.
 
+mod estimate;
 mod fetch;
 mod link;
 mod run;
 mod stage;
 
+pub use estimate::{DownloadEstimate, RunEstimate, RunReason, WorkEstimate};
+pub(crate) use fetch::fetch_sentinel;
+
 use tracing::debug;
 
-use crate::datastore::DataStore;
+use crate::datastore::{CommandRunner, DataStore};
 use crate::external::{GitRunner, HttpFetcher};
 use crate::fs::Fs;
-use crate::operations::{HandlerIntent, OperationResult};
+use crate::operations::{HandlerIntent, LinkStrategy, OperationResult};
 use crate::paths::Pather;
+use crate::shell::PathPriorities;
 use crate::Result;
 
 /// Executes handler intents by dispatching to the DataStore.
@@ -55,6 +61,14 @@ pub struct Executor<'a> {
     /// Git runner for `git-repo` externals. Same opt-in posture as
     /// [`Self::fetcher`].
     git: Option<&'a dyn GitRunner>,
+    /// Runner for read-only queries during dry-run (e.g. `brew bundle
+    /// check`). Without one, dry-run falls back to "would execute".
+    command_runner: Option<&'a dyn CommandRunner>,
+    /// `[path]` placement per pack, so a dry-run shows the `PATH` line
+    /// a staged directory would get. Without it, prepending is assumed.
+    path_priorities: Option<&'a PathPriorities>,
+    /// `[symlink] link_strategy`: where user links point.
+    link_strategy: LinkStrategy,
 }
 
 impl<'a> Executor<'a> {
@@ -77,6 +91,9 @@ impl<'a> Executor<'a> {
             auto_chmod_exec,
             fetcher: None,
             git: None,
+            command_runner: None,
+            path_priorities: None,
+            link_strategy: LinkStrategy::Double,
         }
     }
 
@@ -93,6 +110,27 @@ impl<'a> Executor<'a> {
         self
     }
 
+    /// Builder-style: install the runner dry-run uses to ask external
+    /// tools what a command would do.
+    pub fn with_command_runner(mut self, runner: &'a dyn CommandRunner) -> Self {
+        self.command_runner = Some(runner);
+        self
+    }
+
+    /// Builder-style: install the `[path]` placements dry-run previews
+    /// `PATH` lines with.
+    pub fn with_path_priorities(mut self, priorities: &'a PathPriorities) -> Self {
+        self.path_priorities = Some(priorities);
+        self
+    }
+
+    /// Builder-style: point user links straight at their sources
+    /// instead of at the data links.
+    pub fn with_link_strategy(mut self, strategy: LinkStrategy) -> Self {
+        self.link_strategy = strategy;
+        self
+    }
+
     /// Accessor for the fetch dispatcher.
     pub(super) fn fetcher(&self) -> Option<&'a dyn HttpFetcher> {
         self.fetcher
@@ -124,7 +162,9 @@ impl<'a> Executor<'a> {
             let intent_results = if self.dry_run {
                 self.simulate(&intent)
             } else {
-                self.execute_one(&intent)?
+                let done = self.execute_one(&intent)?;
+                done.iter().for_each(crate::progress::report);
+                done
             };
             results.extend(intent_results);
         }
@@ -167,7 +207,7 @@ mod tests {
 
     use super::test_support::make_datastore;
     use super::Executor;
-    use crate::operations::HandlerIntent;
+    use crate::operations::{HandlerIntent, LinkMode};
     use crate::testing::TempEnvironment;
 
     #[test]
@@ -195,6 +235,8 @@ mod tests {
                     handler: "symlink".into(),
                     source: env.dotfiles_root.join("vim/vimrc"),
                     user_path: env.home.join(".vimrc"),
+                    mode: LinkMode::Symlink,
+                    perms: None,
                 },
                 HandlerIntent::Stage {
                     pack: "vim".into(),
@@ -253,12 +295,16 @@ mod tests {
                     handler: "symlink".into(),
                     source: env.dotfiles_root.join("vim/vimrc"),
                     user_path: env.home.join(".vimrc"),
+                    mode: LinkMode::Symlink,
+                    perms: None,
                 },
                 HandlerIntent::Link {
                     pack: "vim".into(),
                     handler: "symlink".into(),
                     source: env.dotfiles_root.join("vim/gvimrc"),
                     user_path: env.home.join(".gvimrc"),
+                    mode: LinkMode::Symlink,
+                    perms: None,
                 },
             ])
             .unwrap();
@@ -5,10 +5,19 @@
 //! Policy: run on `NeverRan`, skip silently on `RanCurrent`, skip with
 //! a "ran older version" notice on `RanDifferent`. `provision_rerun =
 //! true` (the `--force` flag) bypasses both skip cases.
+//!
+//! Dry-run says *why* a command would run (first run, changed checksum,
+//! forced) and, for Brewfiles, which entries `brew bundle` would
+//! actually install — see [`homebrew::missing_entries`].
+//!
+//! Brewfile runs resume: entries a failed run of the same content
+//! already installed are skipped, and the outcome updates the record —
+//! see [`homebrew::record_outcome`].
 
 use tracing::info;
 
 use crate::datastore::DidRunStatus;
+use crate::handlers::{homebrew, HANDLER_HOMEBREW};
 use crate::operations::{HandlerIntent, Operation, OperationResult};
 use crate::Result;
 
@@ -76,22 +85,33 @@ impl<'a> Executor<'a> {
             }
         }
 
+        let (executable, arguments) = if handler == HANDLER_HOMEBREW {
+            let progress = homebrew::load_progress(self.fs, self.paths, pack, filename);
+            homebrew::resume_command(executable, arguments, progress.as_ref(), content_hash)
+        } else {
+            (executable.clone(), arguments.clone())
+        };
         let cmd_str = format!("{} {}", executable, arguments.join(" "));
         info!(pack, handler = handler.as_str(), command = %cmd_str.trim(), "running command");
 
         // Run the command. `force=true` here tells run_and_record to
         // skip its own internal has_sentinel pre-check — we've already
         // made the policy decision above via did_run.
-        self.datastore
-            .run_and_record(pack, handler, executable, arguments, sentinel, true)?;
+        let outcome =
+            self.datastore
+                .run_and_record(pack, handler, &executable, &arguments, sentinel, true);
+        if handler == HANDLER_HOMEBREW {
+            homebrew::record_outcome(self.fs, self.paths, pack, filename, content_hash, &outcome);
+        }
+        outcome?;
 
         info!(pack, sentinel, "command completed, sentinel recorded");
 
         let op = Operation::RunCommand {
             pack: pack.clone(),
             handler: handler.clone(),
-            executable: executable.clone(),
-            arguments: arguments.clone(),
+            executable,
+            arguments,
             sentinel: sentinel.clone(),
         };
 
@@ -119,42 +139,43 @@ impl<'a> Executor<'a> {
         // the user sees the same skip/notify decisions they'd get on a
         // real run. We don't error on lookup failures — fall through
         // to "would execute" if did_run fails.
-        if !self.provision_rerun {
-            if let Ok(status) = self
-                .datastore
-                .did_run(pack, handler, filename, content_hash)
-            {
-                match status {
-                    DidRunStatus::RanCurrent => {
-                        let op = Operation::CheckSentinel {
-                            pack: pack.clone(),
-                            handler: handler.clone(),
-                            sentinel: sentinel.clone(),
-                        };
-                        return vec![OperationResult::ok(
-                            op,
-                            "[dry-run] would skip (already completed)",
-                        )];
-                    }
-                    DidRunStatus::RanDifferent { .. } => {
-                        let op = Operation::CheckSentinel {
-                            pack: pack.clone(),
-                            handler: handler.clone(),
-                            sentinel: sentinel.clone(),
-                        };
-                        return vec![OperationResult::ok(
-                            op,
-                            format!(
-                                "[dry-run] would skip (ran older version of {filename}; --force to apply)"
-                            ),
-                        )];
-                    }
-                    DidRunStatus::NeverRan => {}
-                }
+        let status = self
+            .datastore
+            .did_run(pack, handler, filename, content_hash)
+            .unwrap_or(DidRunStatus::NeverRan);
+        let check = || Operation::CheckSentinel {
+            pack: pack.clone(),
+            handler: handler.clone(),
+            sentinel: sentinel.clone(),
+        };
+        let reason = match (&status, self.provision_rerun) {
+            (DidRunStatus::RanCurrent, false) => {
+                return vec![OperationResult::ok(
+                    check(),
+                    "[dry-run] would skip (already completed)",
+                )];
             }
-        }
+            (DidRunStatus::RanDifferent { previous_hash, .. }, false) => {
+                return vec![OperationResult::ok(
+                    check(),
+                    format!(
+                        "[dry-run] would skip ({filename} changed since last run: \
+                         {previous_hash} → {content_hash}; --force to apply)"
+                    ),
+                )];
+            }
+            (DidRunStatus::NeverRan, _) => "never ran".to_string(),
+            (DidRunStatus::RanCurrent, true) => "forced; checksum unchanged".to_string(),
+            (DidRunStatus::RanDifferent { previous_hash, .. }, true) => {
+                format!("checksum changed: {previous_hash} → {content_hash}")
+            }
+        };
 
         let cmd_str = format!("{} {}", executable, arguments.join(" "));
+        let message = match self.brew_preview(handler, arguments) {
+            Some(preview) => format!("[dry-run] {preview} ({reason})"),
+            None => format!("[dry-run] would execute: {} ({reason})", cmd_str.trim()),
+        };
         vec![OperationResult::ok(
             Operation::RunCommand {
                 pack: pack.clone(),
@@ -163,19 +184,47 @@ impl<'a> Executor<'a> {
                 arguments: arguments.clone(),
                 sentinel: sentinel.clone(),
             },
-            format!("[dry-run] would execute: {}", cmd_str.trim()),
+            message,
         )]
     }
+
+    /// For a `homebrew` Run intent, ask brew what `brew bundle` would
+    /// actually install. `None` when there's no command runner wired,
+    /// the intent isn't a Brewfile, or brew itself can't be queried —
+    /// the caller then prints the plain command.
+    fn brew_preview(&self, handler: &str, arguments: &[String]) -> Option<String> {
+        if handler != HANDLER_HOMEBREW {
+            return None;
+        }
+        let runner = self.command_runner?;
+        let brewfile = homebrew::brewfile_argument(arguments)?;
+        let missing = homebrew::missing_entries(runner, brewfile).ok()?;
+        Some(if missing.is_empty() {
+            "would run brew bundle: all entries already installed".to_string()
+        } else {
+            format!(
+                "would install {} missing: {}",
+                missing.len(),
+                missing.join(", ")
+            )
+        })
+    }
 }
 
 #[cfg(test)]
 mod tests {
     use super::super::test_support::make_datastore;
     use super::super::Executor;
+    use crate::datastore::{CommandOutput, CommandRunner};
     use crate::fs::Fs;
+    use crate::handlers::homebrew::{BrewfileCommand, NO_UPGRADE};
+    use crate::handlers::run_once::RunOnceHandler;
+    use crate::handlers::{Handler, HandlerConfig};
     use crate::operations::HandlerIntent;
     use crate::paths::Pather;
+    use crate::rules::RuleMatch;
     use crate::testing::TempEnvironment;
+    use crate::{DodotError, Result};
 
     fn run_intent(
         pack: &str,
@@ -405,4 +454,175 @@ mod tests {
         assert!(results[0].message.contains("executed"));
         assert_eq!(runner.calls.lock().unwrap().as_slice(), &["echo forced"]);
     }
+
+    #[test]
+    fn dry_run_reports_checksum_change_when_forced() {
+        let env = TempEnvironment::builder().build();
+        let (ds, runner) = make_datastore(&env);
+
+        let sentinel_dir = env.paths.handler_data_dir("vim", "install");
+        env.fs.mkdir_all(&sentinel_dir).unwrap();
+        env.fs
+            .write_file(
+                &sentinel_dir.join("install.sh-aaaaaaaaaaaaaaaa"),
+                b"completed|12345",
+            )
+            .unwrap();
+
+        let executor = Executor::new(
+            &ds,
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            true, // dry_run
+            false,
+            true, // provision_rerun
+            true,
+        );
+        let results = executor
+            .execute(vec![run_intent(
+                "vim",
+                "install",
+                "echo",
+                &["forced"],
+                "install.sh",
+                "bbbbbbbbbbbbbbbb",
+            )])
+            .unwrap();
+
+        let msg = &results[0].message;
+        assert!(msg.contains("would execute"), "msg: {msg}");
+        assert!(
+            msg.contains("checksum changed: aaaaaaaaaaaaaaaa → bbbbbbbbbbbbbbbb"),
+            "msg: {msg}"
+        );
+        assert!(runner.calls.lock().unwrap().is_empty());
+    }
+
+    /// Answers the brew queries `missing_entries` makes: `bundle check`
+    /// fails, the Brewfile lists two formulae and a cask, and only one
+    /// formula is installed. A `--file` that isn't a Brewfile fails
+    /// like brew would.
+    struct BrewRunner;
+    impl CommandRunner for BrewRunner {
+        fn run(&self, exe: &str, args: &[String]) -> Result<CommandOutput> {
+            let args: Vec<&str> = args.iter().map(String::as_str).collect();
+            if let Some(i) = args.iter().position(|a| *a == "--file") {
+                if !args.get(i + 1).is_some_and(|f| f.ends_with("Brewfile")) {
+                    return Err(DodotError::CommandFailed {
+                        command: format!("{exe} {}", args.join(" ")),
+                        exit_code: 1,
+                        stderr: "invalid option".into(),
+                        stdout: String::new(),
+                    });
+                }
+            }
+            let stdout = match args.as_slice() {
+                ["bundle", "check", ..] => {
+                    return Err(DodotError::CommandFailed {
+                        command: format!("{exe} bundle check"),
+                        exit_code: 1,
+                        stderr: String::new(),
+                        stdout: String::new(),
+                    })
+                }
+                ["bundle", "list", .., "--formula"] => "ripgrep\nhomebrew/core/fd\n",
+                ["bundle", "list", .., "--cask"] => "wezterm\n",
+                ["list", "--formula", "-1"] => "ripgrep\n",
+                _ => "",
+            };
+            Ok(CommandOutput {
+                exit_code: 0,
+                stdout: stdout.into(),
+                stderr: String::new(),
+            })
+        }
+    }
+
+    #[test]
+    fn dry_run_lists_missing_brewfile_entries() {
+        let env = TempEnvironment::builder().build();
+        let (ds, runner) = make_datastore(&env);
+        let brew = BrewRunner;
+        let executor = Executor::new(
+            &ds,
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            true,
+            false,
+            false,
+            true,
+        )
+        .with_command_runner(&brew);
+
+        let results = executor
+            .execute(vec![run_intent(
+                "dev",
+                "homebrew",
+                "brew",
+                &["bundle", "--file", "/dotfiles/dev/Brewfile"],
+                "Brewfile",
+                "abc1234567890def",
+            )])
+            .unwrap();
+
+        let msg = &results[0].message;
+        assert!(
+            msg.contains("would install 2 missing: homebrew/core/fd, wezterm (cask)"),
+            "msg: {msg}"
+        );
+        assert!(msg.contains("never ran"), "msg: {msg}");
+        assert!(runner.calls.lock().unwrap().is_empty());
+    }
+
+    #[test]
+    fn dry_run_previews_a_pinned_brewfile() {
+        let env = TempEnvironment::builder()
+            .pack("dev")
+            .file("Brewfile", "brew \"ripgrep\"")
+            .file("Brewfile.lock.json", "{}")
+            .done()
+            .build();
+        let (ds, _) = make_datastore(&env);
+        let brew = BrewRunner;
+        let executor = Executor::new(
+            &ds,
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            true,
+            false,
+            false,
+            true,
+        )
+        .with_command_runner(&brew);
+
+        let handler = RunOnceHandler::new(env.fs.as_ref(), &brew, BrewfileCommand);
+        let intents = handler
+            .to_intents(
+                &[RuleMatch {
+                    relative_path: "Brewfile".into(),
+                    absolute_path: env.dotfiles_root.join("dev/Brewfile"),
+                    pack: "dev".into(),
+                    handler: "homebrew".into(),
+                    is_dir: false,
+                    options: Default::default(),
+                    preprocessor_source: None,
+                    rendered_bytes: None,
+                }],
+                &HandlerConfig::default(),
+                env.paths.as_ref(),
+                env.fs.as_ref() as &dyn Fs,
+            )
+            .unwrap();
+        let HandlerIntent::Run { arguments, .. } = &intents[0] else {
+            panic!("expected Run, got {:?}", intents[0]);
+        };
+        assert!(arguments.iter().any(|a| a == NO_UPGRADE), "{arguments:?}");
+
+        let results = executor.execute(intents).unwrap();
+        let msg = &results[0].message;
+        assert!(
+            msg.contains("would install 2 missing: homebrew/core/fd, wezterm (cask)"),
+            "msg: {msg}"
+        );
+    }
 }
@@ -5,8 +5,11 @@
 
 use tracing::{debug, info};
 
-use crate::handlers::HANDLER_PATH;
+use std::path::Path;
+
+use crate::handlers::{gitconfig, HANDLER_GITCONFIG, HANDLER_PATH, HANDLER_SHELL};
 use crate::operations::{HandlerIntent, Operation, OperationResult};
+use crate::shell;
 use crate::Result;
 
 use super::Executor;
@@ -35,8 +38,9 @@ impl<'a> Executor<'a> {
 
         let mut results = vec![OperationResult::ok(op, format!("staged {}", filename))];
 
-        // Auto-chmod +x for path handler directories
-        if handler == HANDLER_PATH && self.auto_chmod_exec {
+        // Auto-chmod +x for path handler directories. A single staged
+        // file was matched for its execute bit, so it already has one.
+        if handler == HANDLER_PATH && self.auto_chmod_exec && self.fs.is_dir(source) {
             debug!(pack, source = %source.display(), "checking executable permissions");
             results.extend(self.ensure_executable(pack, source));
         }
@@ -54,25 +58,97 @@ impl<'a> Executor<'a> {
             unreachable!("simulate_stage called with non-Stage intent");
         };
 
-        let mut results = vec![OperationResult::ok(
-            Operation::CreateDataLink {
-                pack: pack.clone(),
-                handler: handler.clone(),
-                source: source.clone(),
-            },
-            format!(
-                "[dry-run] would stage: {}",
-                source.file_name().unwrap_or_default().to_string_lossy()
+        let filename = source.file_name().unwrap_or_default().to_string_lossy();
+        let op = Operation::CreateDataLink {
+            pack: pack.clone(),
+            handler: handler.clone(),
+            source: source.clone(),
+        };
+        let staged = match self.prospective_entry(pack, handler, source) {
+            Some((file, _, true)) => OperationResult::ok(
+                op,
+                format!("[dry-run] would stage: {filename} ({file} already has it)"),
             ),
-        )];
+            Some((file, lines, false)) => {
+                OperationResult::ok(op, format!("[dry-run] would stage: {filename}")).with_preview(
+                    format!("{file} would gain:\n      {}", lines.join("\n      ")),
+                )
+            }
+            None => OperationResult::ok(op, format!("[dry-run] would stage: {filename}")),
+        };
+        let mut results = vec![staged];
 
-        if handler == HANDLER_PATH && self.auto_chmod_exec {
+        if handler == HANDLER_PATH && self.auto_chmod_exec && self.fs.is_dir(source) {
             results.extend(self.report_non_executable(pack, source));
         }
 
         results
     }
 
+    /// What staging `source` adds to a file dodot regenerates from the
+    /// datastore — the init script for shell and path, git's config for
+    /// gitconfig: the file's name, the lines, and whether an equivalent
+    /// entry is already there. `None` for other handlers.
+    fn prospective_entry(
+        &self,
+        pack: &str,
+        handler: &str,
+        source: &Path,
+    ) -> Option<(String, Vec<String>, bool)> {
+        if handler == HANDLER_GITCONFIG {
+            let fragment = self
+                .paths
+                .handler_data_dir(pack, handler)
+                .join(source.file_name()?);
+            let file = gitconfig::include_file(self.fs, self.paths)?;
+            return Some((
+                file.display().to_string(),
+                vec![gitconfig::include_line(&fragment)],
+                gitconfig::is_included(self.fs, self.paths, &fragment),
+            ));
+        }
+
+        let placement = self
+            .path_priorities
+            .and_then(|p| p.get(pack))
+            .cloned()
+            .unwrap_or_default();
+        // A staged directory goes on `$PATH` itself; staged executables
+        // through the data dir holding their links.
+        let (target, position) = if handler != HANDLER_PATH || self.fs.is_dir(source) {
+            let relative = source
+                .strip_prefix(self.paths.pack_path(pack))
+                .map(|r| r.to_string_lossy().into_owned())
+                .unwrap_or_default();
+            (source.to_path_buf(), placement.position_for(&relative))
+        } else {
+            (
+                self.paths.handler_data_dir(pack, handler),
+                placement.position,
+            )
+        };
+        let lazy = if handler == HANDLER_SHELL {
+            self.fs
+                .read_to_string(source)
+                .map(|content| shell::lazy_commands(&content))
+                .unwrap_or_default()
+        } else {
+            Vec::new()
+        };
+        let init_script = self.paths.init_script_path();
+        let current = self.fs.read_to_string(&init_script).unwrap_or_default();
+        let (lines, present) = shell::prospective_entry(
+            handler,
+            crate::packs::display_name_for(pack),
+            &target,
+            position,
+            &lazy,
+            &current,
+        )?;
+        let name = init_script.file_name()?.to_string_lossy().into_owned();
+        Some((name, lines, present))
+    }
+
     /// Ensure all files in a path-handler directory are executable.
     ///
     /// Iterates files in `dir`, checks each for the execute bit, and
@@ -301,15 +377,11 @@ mod tests {
     fn path_stage_skips_already_executable() {
         let env = TempEnvironment::builder()
             .pack("tools")
-            .file("bin/mytool", "#!/bin/sh\necho hello")
+            .file_with_mode("bin/mytool", "#!/bin/sh\necho hello", 0o755)
             .done()
             .build();
         let (ds, _) = make_datastore(&env);
 
-        // Pre-set execute permission
-        let tool_path = env.dotfiles_root.join("tools/bin/mytool");
-        env.fs.set_permissions(&tool_path, 0o755).unwrap();
-
         let executor = Executor::new(
             &ds,
             env.fs.as_ref(),
@@ -505,6 +577,56 @@ mod tests {
         );
     }
 
+    #[test]
+    fn dry_run_previews_init_script_lines() {
+        let env = TempEnvironment::builder()
+            .pack("vim")
+            .file("aliases.sh", "alias vi=vim")
+            .done()
+            .build();
+        let (ds, _) = make_datastore(&env);
+        let executor = Executor::new(
+            &ds,
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            true,
+            false,
+            false,
+            true,
+        );
+        let source = env.dotfiles_root.join("vim/aliases.sh");
+        let stage = || {
+            vec![HandlerIntent::Stage {
+                pack: "vim".into(),
+                handler: "shell".into(),
+                source: source.clone(),
+            }]
+        };
+
+        let results = executor.execute(stage()).unwrap();
+        let preview = results[0].preview.as_deref().expect("preview");
+        assert!(
+            preview.contains(&crate::shell::source_line(&source)),
+            "{preview}"
+        );
+
+        let init_script = env.paths.init_script_path();
+        env.fs.mkdir_all(init_script.parent().unwrap()).unwrap();
+        env.fs
+            .write_file(
+                &init_script,
+                format!("{}\n", crate::shell::source_line(&source)).as_bytes(),
+            )
+            .unwrap();
+        let results = executor.execute(stage()).unwrap();
+        assert!(results[0].preview.is_none());
+        assert!(
+            results[0].message.contains("already has it"),
+            "{}",
+            results[0].message
+        );
+    }
+
     #[test]
     fn path_stage_auto_chmod_multiple_files() {
         let env = TempEnvironment::builder()
@@ -94,7 +94,9 @@ pub fn detect_drift_for_pack(
                     detail: "git runner not configured".into(),
                 },
             },
-            FetchSpec::Archive { .. } | FetchSpec::ArchiveFile { .. } => DriftReport {
+            FetchSpec::Archive { .. }
+            | FetchSpec::ArchiveFile { .. }
+            | FetchSpec::Binary { .. } => DriftReport {
                 pack: pack.into(),
                 entry_name: name.clone(),
                 kind: DriftKind::NotImplemented,
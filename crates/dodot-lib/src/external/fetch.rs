@@ -39,6 +39,12 @@ impl HttpFetchError {
 pub trait HttpFetcher: Send + Sync {
     /// Fetch the entire body at `url` into memory.
     fn fetch(&self, url: &str) -> std::result::Result<Vec<u8>, HttpFetchError>;
+
+    /// Size of the body at `url` without fetching it, for dry-run
+    /// estimates. `None` when it can't be told; the default never can.
+    fn content_length(&self, _url: &str) -> Option<u64> {
+        None
+    }
 }
 
 /// Default fetcher: ureq for http(s), direct fs read for `file://`.
@@ -119,6 +125,19 @@ impl HttpFetcher for UreqFetcher {
             }),
         }
     }
+
+    /// `Content-Length` of a `HEAD` request (redirects followed), or
+    /// the file size for `file://`.
+    fn content_length(&self, url: &str) -> Option<u64> {
+        if let Some(rest) = url.strip_prefix("file://") {
+            return fs::metadata(rest).ok().map(|m| m.len());
+        }
+        if !(url.starts_with("http://") || url.starts_with("https://")) {
+            return None;
+        }
+        let resp = self.agent.head(url).call().ok()?;
+        resp.header("Content-Length")?.trim().parse().ok()
+    }
 }
 
 #[cfg(test)]
@@ -143,6 +162,14 @@ mod tests {
         assert!(err.is_transient(), "should be transient: {err:?}");
     }
 
+    #[test]
+    fn file_url_content_length_is_the_file_size() {
+        let mut f = NamedTempFile::new().unwrap();
+        f.write_all(b"twelve bytes").unwrap();
+        let url = format!("file://{}", f.path().display());
+        assert_eq!(UreqFetcher::new().content_length(&url), Some(12));
+    }
+
     #[test]
     fn rejects_unknown_scheme() {
         let err = UreqFetcher::new().fetch("ftp://example.com/x").unwrap_err();
@@ -133,6 +133,18 @@ pub enum FetchSpec {
         format: Option<ArchiveFormat>,
     },
 
+    /// An executable: the downloaded file itself, or one `member` of
+    /// the downloaded archive, written with mode `0755`. What the
+    /// download handler's `tools.toml` entries plan to.
+    Binary {
+        url: String,
+        sha256: String,
+        #[serde(default, skip_serializing_if = "Option::is_none")]
+        member: Option<String>,
+        #[serde(default, skip_serializing_if = "Option::is_none")]
+        format: Option<ArchiveFormat>,
+    },
+
     /// Catchall for type values dodot doesn't implement yet.
     #[serde(other)]
     Unsupported,
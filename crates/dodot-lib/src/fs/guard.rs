@@ -0,0 +1,206 @@
+//! [`HomeGuardFs`] — the filesystem behind `--no-write-home`.
+//!
+//! On a borrowed machine (a shared server, a colleague's laptop) you
+//! may want dodot's shell profile and `$PATH` additions without it
+//! touching any dotfile in `$HOME`. The guard wraps the real
+//! filesystem and refuses every mutation under `$HOME` except inside
+//! dodot's own directories — the data dir (intermediate links,
+//! `dodot-init.sh`, sentinels), the cache dir, and the dotfiles
+//! checkout itself. Paths outside `$HOME` aren't its concern.
+//!
+//! Reads pass straight through. Callers that can do something useful
+//! instead of failing ask [`Fs::write_refused`] first: the link
+//! executor stages the data link and leaves the user link out, `up`
+//! skips the `~/.gitconfig` include block.
+
+use std::path::{Path, PathBuf};
+use std::sync::Arc;
+
+use super::{DirEntry, Fs, FsMetadata};
+use crate::paths::Pather;
+use crate::{DodotError, Result};
+
+/// Environment variable that turns the guard on for every context
+/// built in this process. The CLI's global `--no-write-home` sets it.
+pub const NO_WRITE_HOME_ENV: &str = "DODOT_NO_WRITE_HOME";
+
+/// Whether [`NO_WRITE_HOME_ENV`] asks for the guard (set, and not
+/// empty or `0`).
+pub fn no_write_home_requested() -> bool {
+    std::env::var(NO_WRITE_HOME_ENV).is_ok_and(|v| !v.is_empty() && v != "0")
+}
+
+/// An [`Fs`] that refuses to write under `$HOME` outside dodot's own
+/// directories.
+pub struct HomeGuardFs {
+    inner: Arc<dyn Fs>,
+    home: PathBuf,
+    allowed: Vec<PathBuf>,
+}
+
+impl HomeGuardFs {
+    pub fn new(inner: Arc<dyn Fs>, paths: &dyn Pather) -> Self {
+        Self {
+            inner,
+            home: paths.home_dir().to_path_buf(),
+            allowed: vec![
+                paths.data_dir().to_path_buf(),
+                paths.cache_dir().to_path_buf(),
+                paths.dotfiles_root().to_path_buf(),
+            ],
+        }
+    }
+
+    fn check(&self, path: &Path) -> Result<()> {
+        if self.write_refused(path) {
+            return Err(DodotError::HomeWriteRefused {
+                path: path.to_path_buf(),
+            });
+        }
+        Ok(())
+    }
+}
+
+impl Fs for HomeGuardFs {
+    fn stat(&self, path: &Path) -> Result<FsMetadata> {
+        self.inner.stat(path)
+    }
+
+    fn lstat(&self, path: &Path) -> Result<FsMetadata> {
+        self.inner.lstat(path)
+    }
+
+    fn open_read(&self, path: &Path) -> Result<Box<dyn std::io::Read + Send + Sync>> {
+        self.inner.open_read(path)
+    }
+
+    fn read_file(&self, path: &Path) -> Result<Vec<u8>> {
+        self.inner.read_file(path)
+    }
+
+    fn read_to_string(&self, path: &Path) -> Result<String> {
+        self.inner.read_to_string(path)
+    }
+
+    fn write_file(&self, path: &Path, contents: &[u8]) -> Result<()> {
+        self.check(path)?;
+        self.inner.write_file(path, contents)
+    }
+
+    fn write_file_with_mode(&self, path: &Path, contents: &[u8], mode: u32) -> Result<()> {
+        self.check(path)?;
+        self.inner.write_file_with_mode(path, contents, mode)
+    }
+
+    fn write_file_atomic(&self, path: &Path, contents: &[u8]) -> Result<()> {
+        self.check(path)?;
+        self.inner.write_file_atomic(path, contents)
+    }
+
+    fn mkdir_all(&self, path: &Path) -> Result<()> {
+        // Creating a directory that already exists changes nothing.
+        if !self.inner.is_dir(path) {
+            self.check(path)?;
+        }
+        self.inner.mkdir_all(path)
+    }
+
+    fn symlink(&self, original: &Path, link: &Path) -> Result<()> {
+        self.check(link)?;
+        self.inner.symlink(original, link)
+    }
+
+    fn readlink(&self, path: &Path) -> Result<PathBuf> {
+        self.inner.readlink(path)
+    }
+
+    fn remove_file(&self, path: &Path) -> Result<()> {
+        self.check(path)?;
+        self.inner.remove_file(path)
+    }
+
+    fn remove_dir_all(&self, path: &Path) -> Result<()> {
+        self.check(path)?;
+        self.inner.remove_dir_all(path)
+    }
+
+    fn exists(&self, path: &Path) -> bool {
+        self.inner.exists(path)
+    }
+
+    fn is_symlink(&self, path: &Path) -> bool {
+        self.inner.is_symlink(path)
+    }
+
+    fn is_dir(&self, path: &Path) -> bool {
+        self.inner.is_dir(path)
+    }
+
+    fn read_dir(&self, path: &Path) -> Result<Vec<DirEntry>> {
+        self.inner.read_dir(path)
+    }
+
+    fn rename(&self, from: &Path, to: &Path) -> Result<()> {
+        self.check(from)?;
+        self.check(to)?;
+        self.inner.rename(from, to)
+    }
+
+    fn copy_file(&self, from: &Path, to: &Path) -> Result<()> {
+        self.check(to)?;
+        self.inner.copy_file(from, to)
+    }
+
+    fn hard_link(&self, original: &Path, link: &Path) -> Result<()> {
+        self.check(link)?;
+        self.inner.hard_link(original, link)
+    }
+
+    fn set_permissions(&self, path: &Path, mode: u32) -> Result<()> {
+        self.check(path)?;
+        self.inner.set_permissions(path, mode)
+    }
+
+    fn chown(&self, path: &Path, uid: Option<u32>, gid: Option<u32>) -> Result<()> {
+        self.check(path)?;
+        self.inner.chown(path, uid, gid)
+    }
+
+    fn modified(&self, path: &Path) -> Result<std::time::SystemTime> {
+        self.inner.modified(path)
+    }
+
+    fn set_modified(&self, path: &Path, time: std::time::SystemTime) -> Result<()> {
+        self.check(path)?;
+        self.inner.set_modified(path, time)
+    }
+
+    fn write_refused(&self, path: &Path) -> bool {
+        path.starts_with(&self.home) && !self.allowed.iter().any(|root| path.starts_with(root))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::testing::TempEnvironment;
+
+    #[test]
+    fn writes_under_home_stay_inside_dodots_directories() {
+        let env = TempEnvironment::builder().build();
+        let fs = HomeGuardFs::new(env.fs.clone(), env.paths.as_ref());
+
+        fs.mkdir_all(env.paths.data_dir()).unwrap();
+        let staged = env.paths.data_dir().join("staged");
+        fs.write_file(&staged, b"ok").unwrap();
+        assert!(!fs.write_refused(&staged));
+
+        let dotfile = env.home.join(".vimrc");
+        let err = fs.symlink(&staged, &dotfile).unwrap_err();
+        assert!(matches!(err, DodotError::HomeWriteRefused { .. }), "{err}");
+        assert!(fs.write_refused(&dotfile));
+        assert!(!env.fs.exists(&dotfile));
+        // Reads aren't guarded.
+        assert_eq!(fs.read_to_string(&staged).unwrap(), "ok");
+    }
+}
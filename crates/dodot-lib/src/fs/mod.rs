@@ -1,5 +1,7 @@
+mod guard;
 mod os;
 
+pub use guard::{no_write_home_requested, HomeGuardFs, NO_WRITE_HOME_ENV};
 pub use os::OsFs;
 
 use std::path::{Path, PathBuf};
@@ -15,6 +17,25 @@ pub struct FsMetadata {
     pub len: u64,
     /// Unix permission mode (e.g. `0o755`).
     pub mode: u32,
+    /// Owning user and group ids.
+    pub uid: u32,
+    pub gid: u32,
+}
+
+/// Suffix of the temporary sibling [`Fs::write_file_atomic`] writes
+/// before renaming. A file with this suffix is only ever left behind
+/// by a crash mid-write.
+pub const ATOMIC_TMP_SUFFIX: &str = ".dodot-tmp";
+
+/// Temporary sibling for an atomic write of `path`:
+/// `dir/.<name>.dodot-tmp`. Same directory, so the rename never
+/// crosses a filesystem.
+pub fn atomic_temp_path(path: &Path) -> PathBuf {
+    let name = path
+        .file_name()
+        .map(|n| n.to_string_lossy().into_owned())
+        .unwrap_or_default();
+    path.with_file_name(format!(".{name}{ATOMIC_TMP_SUFFIX}"))
 }
 
 /// A single directory entry returned by [`Fs::read_dir`].
@@ -81,6 +102,21 @@ pub trait Fs: Send + Sync {
         self.set_permissions(path, mode)
     }
 
+    /// Writes `contents` to `path` so that readers (and a crash) see
+    /// either the old file or the complete new one, never a truncated
+    /// mix: the bytes go to [`atomic_temp_path`], are flushed, and the
+    /// temp file is renamed over `path`. Used for everything dodot
+    /// regenerates in the data dir — sentinels, `dodot-init.sh`, the
+    /// deployment map, rendered files.
+    ///
+    /// Default impl is write-then-rename without the fsyncs; `OsFs`
+    /// overrides to sync the file and its directory.
+    fn write_file_atomic(&self, path: &Path, contents: &[u8]) -> Result<()> {
+        let tmp = atomic_temp_path(path);
+        self.write_file(&tmp, contents)?;
+        self.rename(&tmp, path)
+    }
+
     /// Creates `path` and all parent directories.
     fn mkdir_all(&self, path: &Path) -> Result<()>;
 
@@ -114,9 +150,17 @@ pub trait Fs: Send + Sync {
     /// Copies a file from `from` to `to`.
     fn copy_file(&self, from: &Path, to: &Path) -> Result<()>;
 
+    /// Creates a hard link at `link` to the existing file `original`.
+    /// Both paths must live on the same filesystem.
+    fn hard_link(&self, original: &Path, link: &Path) -> Result<()>;
+
     /// Sets file permissions (Unix mode).
     fn set_permissions(&self, path: &Path, mode: u32) -> Result<()>;
 
+    /// Changes the owning user and/or group (follows symlinks). `None`
+    /// leaves that id as it is. Usually needs root.
+    fn chown(&self, path: &Path, uid: Option<u32>, gid: Option<u32>) -> Result<()>;
+
     /// Returns the modification time of `path` (follows symlinks).
     /// Used by `dodot refresh` to compare deployed-side mtimes against
     /// source-side mtimes when deciding whether to touch the source.
@@ -140,4 +184,11 @@ pub trait Fs: Send + Sync {
     fn set_modified(&self, _path: &Path, _time: std::time::SystemTime) -> Result<()> {
         unimplemented!("Fs::set_modified is only implemented by OsFs")
     }
+
+    /// Whether a mutation of `path` would be refused outright. Only
+    /// [`HomeGuardFs`] refuses anything; callers that have a useful
+    /// fallback check this instead of handling the error.
+    fn write_refused(&self, _path: &Path) -> bool {
+        false
+    }
 }
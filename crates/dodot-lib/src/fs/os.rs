@@ -1,5 +1,5 @@
 use std::fs;
-use std::os::unix::fs::PermissionsExt;
+use std::os::unix::fs::{MetadataExt, PermissionsExt};
 use std::path::{Path, PathBuf};
 
 use crate::error::fs_err;
@@ -84,6 +84,28 @@ impl Fs for OsFs {
         Ok(())
     }
 
+    fn write_file_atomic(&self, path: &Path, contents: &[u8]) -> Result<()> {
+        use std::io::Write as _;
+        let tmp = crate::fs::atomic_temp_path(path);
+        let mut file = fs::File::create(&tmp).map_err(|e| fs_err(&tmp, e))?;
+        file.write_all(contents).map_err(|e| fs_err(&tmp, e))?;
+        file.sync_all().map_err(|e| fs_err(&tmp, e))?;
+        drop(file);
+        if let Err(e) = fs::rename(&tmp, path) {
+            let _ = fs::remove_file(&tmp);
+            return Err(fs_err(path, e));
+        }
+        // Persist the rename itself. Best-effort: some filesystems
+        // refuse to open or fsync a directory, and the file contents
+        // are already durable.
+        if let Some(dir) = path.parent() {
+            if let Ok(d) = fs::File::open(dir) {
+                let _ = d.sync_all();
+            }
+        }
+        Ok(())
+    }
+
     fn mkdir_all(&self, path: &Path) -> Result<()> {
         fs::create_dir_all(path).map_err(|e| fs_err(path, e))
     }
@@ -148,11 +170,19 @@ impl Fs for OsFs {
         fs::copy(from, to).map(|_| ()).map_err(|e| fs_err(from, e))
     }
 
+    fn hard_link(&self, original: &Path, link: &Path) -> Result<()> {
+        fs::hard_link(original, link).map_err(|e| fs_err(link, e))
+    }
+
     fn set_permissions(&self, path: &Path, mode: u32) -> Result<()> {
         let perms = fs::Permissions::from_mode(mode);
         fs::set_permissions(path, perms).map_err(|e| fs_err(path, e))
     }
 
+    fn chown(&self, path: &Path, uid: Option<u32>, gid: Option<u32>) -> Result<()> {
+        std::os::unix::fs::chown(path, uid, gid).map_err(|e| fs_err(path, e))
+    }
+
     fn modified(&self, path: &Path) -> Result<std::time::SystemTime> {
         fs::metadata(path)
             .and_then(|m| m.modified())
@@ -179,6 +209,8 @@ fn metadata_from_std(meta: &fs::Metadata, is_symlink: bool) -> FsMetadata {
         is_symlink,
         len: meta.len(),
         mode: meta.permissions().mode(),
+        uid: meta.uid(),
+        gid: meta.gid(),
     }
 }
 
@@ -277,6 +309,25 @@ mod tests {
         assert!(!fs.exists(&tmp.path().join("nope")));
     }
 
+    #[test]
+    fn write_file_atomic_replaces_without_leaving_temp() {
+        let tmp = TempDir::new().unwrap();
+        let fs = OsFs::new();
+        let path = tmp.path().join("sentinel");
+
+        fs.write_file(&path, b"old").unwrap();
+        fs.write_file_atomic(&path, b"new").unwrap();
+
+        assert_eq!(fs.read_to_string(&path).unwrap(), "new");
+        let names: Vec<String> = fs
+            .read_dir(tmp.path())
+            .unwrap()
+            .into_iter()
+            .map(|e| e.name)
+            .collect();
+        assert_eq!(names, vec!["sentinel"]);
+    }
+
     #[test]
     fn read_dir_sorted() {
         let tmp = TempDir::new().unwrap();
@@ -339,6 +390,21 @@ mod tests {
         assert_eq!(fs.read_to_string(&to).unwrap(), "copied");
     }
 
+    #[test]
+    fn hard_link_shares_content() {
+        let tmp = TempDir::new().unwrap();
+        let fs = OsFs::new();
+
+        let original = tmp.path().join("original.txt");
+        let link = tmp.path().join("link.txt");
+        fs.write_file(&original, b"v1").unwrap();
+        fs.hard_link(&original, &link).unwrap();
+        assert!(!fs.is_symlink(&link));
+
+        fs.write_file(&original, b"v2").unwrap();
+        assert_eq!(fs.read_to_string(&link).unwrap(), "v2");
+    }
+
     #[test]
     fn error_contains_path() {
         let fs = OsFs::new();
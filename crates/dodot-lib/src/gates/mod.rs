@@ -14,6 +14,9 @@
 //!
 //! - **Filename gates**: `<stem>._<label>.<ext>` and extensionless
 //!   `<name>._<label>` basenames. Parser is [`parse_basename_gate`].
+//!   With `[mappings] platform_suffixes = true`, the bare
+//!   `<stem>.<os-or-arch>.<ext>` convention for built-in labels too;
+//!   see [`GateTable::parse_basename`].
 //! - **Directory-segment gates**: `_<label>/` directory names, with
 //!   [`ROUTING_PREFIX_TOKENS`] (`home`/`xdg`/`app`/`lib`) excluded
 //!   because the symlink resolver owns those names. Parser is
@@ -25,6 +28,9 @@
 //!   dimension validation.
 //! - **Pack-level OS gating**: [`pack_os_active`] evaluates a
 //!   `[pack] os` allowlist against the current host.
+//! - **Machine roles**: the host-local `roles = [...]` tags
+//!   ([`load_roles`]) that `[pack] roles` and `[[rules]] roles`
+//!   require; [`roles_active`] is the check.
 //! - **Host facts**: [`HostFacts`] snapshot, detected once per
 //!   `ExecutionContext` to avoid repeated `hostname(1)` calls.
 //!
@@ -86,6 +92,10 @@ pub struct HostFacts {
     pub arch: String,
     pub hostname: Option<String>,
     pub username: Option<String>,
+    /// Roles this machine is tagged with (`work`, `laptop`, …). Not
+    /// detected: [`HostFacts::detect`] leaves them empty and the
+    /// execution context fills them in from [`load_roles`].
+    pub roles: Vec<String>,
 }
 
 impl HostFacts {
@@ -111,6 +121,7 @@ impl HostFacts {
             arch: detect_arch(),
             hostname: detect_hostname(),
             username: detect_username(),
+            roles: Vec::new(),
         }
     }
 
@@ -124,6 +135,7 @@ impl HostFacts {
             arch: arch.into(),
             hostname: Some("test-host".into()),
             username: Some("tester".into()),
+            roles: Vec::new(),
         }
     }
 
@@ -257,6 +269,9 @@ impl GatePredicate {
 #[derive(Debug, Clone, Default)]
 pub struct GateTable {
     labels: HashMap<String, GatePredicate>,
+    /// `[mappings] platform_suffixes`: also read bare
+    /// [`PLATFORM_SUFFIX_LABELS`] segments as gates.
+    platform_suffixes: bool,
 }
 
 impl GateTable {
@@ -293,7 +308,27 @@ impl GateTable {
             "x86_64".into(),
             GatePredicate::single(Dimension::Arch, "x86_64"),
         );
-        Self { labels }
+        Self {
+            labels,
+            platform_suffixes: false,
+        }
+    }
+
+    /// Turn the bare `.<os-or-arch>` filename form on or off. Off by
+    /// default: existing files like `aliases.linux.sh` would otherwise
+    /// become conditional without anyone asking for it.
+    pub fn set_platform_suffixes(&mut self, enabled: bool) {
+        self.platform_suffixes = enabled;
+    }
+
+    /// [`parse_basename_gate`], plus the bare platform-suffix form when
+    /// it is enabled. Every scan path parses filenames through this so
+    /// they agree on which files carry a gate.
+    pub fn parse_basename<'b>(&self, basename: &'b str) -> BasenameGate<'b> {
+        match parse_basename_gate(basename) {
+            BasenameGate::None if self.platform_suffixes => parse_platform_suffix(basename),
+            gate => gate,
+        }
     }
 
     /// Merge a user-supplied label set over the built-ins.
@@ -357,6 +392,13 @@ impl GateTable {
         self.labels.contains_key(label)
     }
 
+    /// Every known label, sorted.
+    pub fn labels(&self) -> Vec<&str> {
+        let mut labels: Vec<&str> = self.labels.keys().map(String::as_str).collect();
+        labels.sort_unstable();
+        labels
+    }
+
     #[cfg(test)]
     pub fn len(&self) -> usize {
         self.labels.len()
@@ -449,6 +491,86 @@ pub fn pack_os_active(allowed: &[String], host: &HostFacts) -> bool {
     })
 }
 
+/// Why a pack is inactive on this host, or `None` when it deploys.
+/// The `[pack] os` allowlist is checked first, then `[pack] roles`.
+/// The reason reads as a parenthetical after the pack name, e.g.
+/// `os=darwin, current=linux`.
+pub fn pack_inactive_reason(pack: &crate::config::PackSection, host: &HostFacts) -> Option<String> {
+    if !pack_os_active(&pack.os, host) {
+        return Some(format!("os={}, current={}", pack.os.join(","), host.os));
+    }
+    if !roles_active(&pack.roles, host) {
+        return Some(format!(
+            "{ROLE_MISMATCH}: roles={}, current={}",
+            pack.roles.join(","),
+            describe_roles(&host.roles)
+        ));
+    }
+    None
+}
+
+// ── Machine roles ───────────────────────────────────────────────
+
+/// Gate label stamped on entries skipped because the machine lacks a
+/// role their rule requires. `dodot status` shows them as
+/// `skipped: role mismatch`.
+pub const ROLE_MISMATCH: &str = "role mismatch";
+
+/// `true` when `required` is empty or names at least one of the
+/// host's roles. Like `[pack] os`, the list is an allowlist: a pack
+/// with `roles = ["work", "gpu"]` deploys on a machine with either.
+pub fn roles_active(required: &[String], host: &HostFacts) -> bool {
+    required.is_empty() || required.iter().any(|r| host.roles.contains(r))
+}
+
+/// A role list for display: comma-joined, or `none`.
+pub fn describe_roles(roles: &[String]) -> String {
+    if roles.is_empty() {
+        "none".into()
+    } else {
+        roles.join(",")
+    }
+}
+
+/// Read the machine's roles from `<config_dir>/local.toml`. A missing
+/// file, or one without `roles`, means an untagged machine.
+///
+/// ```toml
+/// roles = ["work", "laptop", "gpu"]
+/// ```
+pub fn load_roles(
+    fs: &dyn crate::fs::Fs,
+    pather: &dyn crate::paths::Pather,
+) -> Result<Vec<String>> {
+    #[derive(Deserialize)]
+    #[serde(deny_unknown_fields)]
+    struct Local {
+        #[serde(default)]
+        roles: Vec<String>,
+        /// Read by the path resolver; see `dodot relocate-data`.
+        #[serde(default)]
+        #[allow(dead_code)]
+        data_dir: Option<String>,
+    }
+
+    let path = pather.local_config_path();
+    if !fs.exists(&path) {
+        return Ok(Vec::new());
+    }
+    let text = fs.read_to_string(&path)?;
+    let local: Local = toml::from_str(&text)
+        .map_err(|e| DodotError::Config(format!("{}: {e}", path.display())))?;
+    for role in &local.roles {
+        if !is_valid_label(role) {
+            return Err(DodotError::Config(format!(
+                "{}: invalid role {role:?}: use letters, digits, `_` and `-`",
+                path.display()
+            )));
+        }
+    }
+    Ok(local.roles)
+}
+
 // ── Directory-segment gates ─────────────────────────────────────
 
 /// Routing-prefix tokens reserved by the symlink resolver
@@ -548,6 +670,41 @@ pub fn parse_basename_gate(basename: &str) -> BasenameGate<'_> {
     BasenameGate::None
 }
 
+/// Built-in labels that also gate as a bare `.<label>` segment, without
+/// the `_` marker, once `[mappings] platform_suffixes` is on:
+/// `gitconfig.darwin.tmpl`, `aliases.linux.sh`, `config.arm64.toml`.
+/// Limited to the OS/arch seed — a user label like `work` would make
+/// too many ordinary names (`notes.work.md`) silently conditional.
+pub const PLATFORM_SUFFIX_LABELS: &[&str] =
+    &["darwin", "macos", "linux", "arm64", "aarch64", "x86_64"];
+
+/// The bare-suffix form of [`GateTable::parse_basename`]: the rightmost
+/// dotted segment after the first that is one of
+/// [`PLATFORM_SUFFIX_LABELS`] is the gate, and is removed from the
+/// name. The first segment is never a label, so `linux.conf` is just
+/// a file.
+fn parse_platform_suffix(basename: &str) -> BasenameGate<'_> {
+    let Some(first_dot) = basename.find('.') else {
+        return BasenameGate::None;
+    };
+    if first_dot == 0 {
+        return BasenameGate::None;
+    }
+    let mut end = basename.len();
+    while let Some(dot) = basename[..end].rfind('.') {
+        let label = &basename[dot + 1..end];
+        if PLATFORM_SUFFIX_LABELS.contains(&label) {
+            let stripped = format!("{}{}", &basename[..dot], &basename[end..]);
+            return BasenameGate::Found { label, stripped };
+        }
+        if dot == first_dot {
+            break;
+        }
+        end = dot;
+    }
+    BasenameGate::None
+}
+
 fn is_valid_label(s: &str) -> bool {
     !s.is_empty()
         && s.bytes()
@@ -566,6 +723,7 @@ mod tests {
             arch: arch.into(),
             hostname: Some("test-host".into()),
             username: Some("tester".into()),
+            roles: Vec::new(),
         }
     }
 
@@ -631,6 +789,7 @@ mod tests {
             arch: "x86_64".into(),
             hostname: None,
             username: None,
+            roles: Vec::new(),
         };
         assert!(!p.matches(&h));
     }
@@ -855,6 +1014,46 @@ mod tests {
         }
     }
 
+    #[test]
+    fn parse_bare_platform_suffix() {
+        let mut gates = GateTable::with_builtins();
+        // Off by default: an existing `aliases.linux.sh` stays a file.
+        assert_eq!(gates.parse_basename("aliases.linux.sh"), BasenameGate::None);
+        gates.set_platform_suffixes(true);
+
+        let cases = [
+            ("gitconfig.darwin.tmpl", "darwin", "gitconfig.tmpl"),
+            ("aliases.linux.sh", "linux", "aliases.sh"),
+            ("config.arm64.toml", "arm64", "config.toml"),
+            ("home.bashrc.darwin", "darwin", "home.bashrc"),
+            ("aliases.linux.sh.tmpl", "linux", "aliases.sh.tmpl"),
+        ];
+        for (name, want_label, want_stripped) in cases {
+            match gates.parse_basename(name) {
+                BasenameGate::Found { label, stripped } => {
+                    assert_eq!(label, want_label, "{name}");
+                    assert_eq!(stripped, want_stripped, "{name}");
+                }
+                BasenameGate::None => panic!("expected a gate in {name}"),
+            }
+        }
+        // User labels, the leading segment, and near-misses stay literal.
+        assert_eq!(gates.parse_basename("notes.work.md"), BasenameGate::None);
+        assert_eq!(gates.parse_basename("linux.conf"), BasenameGate::None);
+        assert_eq!(
+            gates.parse_basename("config.Darwin.toml"),
+            BasenameGate::None
+        );
+        // The explicit `._` form wins over a bare suffix.
+        match gates.parse_basename("aliases.linux._work.sh") {
+            BasenameGate::Found { label, stripped } => {
+                assert_eq!(label, "work");
+                assert_eq!(stripped, "aliases.linux.sh");
+            }
+            BasenameGate::None => panic!("expected Found"),
+        }
+    }
+
     // ── Pack-level OS gate ──────────────────────────────────────
 
     #[test]
@@ -885,6 +1084,55 @@ mod tests {
         assert!(!pack_os_active(&allowed, &host("windows", "x86_64")));
     }
 
+    // ── Machine roles ───────────────────────────────────────────
+
+    #[test]
+    fn roles_are_an_allowlist_against_the_machine() {
+        let mut h = host("linux", "x86_64");
+        assert!(roles_active(&[], &h));
+        assert!(!roles_active(&["work".into()], &h), "untagged machine");
+        h.roles = vec!["laptop".into(), "work".into()];
+        assert!(roles_active(&["work".into(), "gpu".into()], &h));
+        assert!(!roles_active(&["gpu".into()], &h));
+    }
+
+    #[test]
+    fn inactive_reason_names_the_mismatch() {
+        let mut pack = crate::config::PackSection {
+            ignore: Vec::new(),
+            os: Vec::new(),
+            roles: vec!["work".into()],
+            verify: Vec::new(),
+            layout: "packs".into(),
+        };
+        let h = host("linux", "x86_64");
+        assert_eq!(
+            pack_inactive_reason(&pack, &h).as_deref(),
+            Some("role mismatch: roles=work, current=none")
+        );
+        pack.os = vec!["darwin".into()];
+        assert_eq!(
+            pack_inactive_reason(&pack, &h).as_deref(),
+            Some("os=darwin, current=linux")
+        );
+    }
+
+    #[test]
+    fn roles_load_from_local_config() {
+        let env = crate::testing::TempEnvironment::builder().build();
+        let (fs, paths) = (env.fs.as_ref(), env.paths.as_ref());
+        assert!(load_roles(fs, paths).unwrap().is_empty());
+
+        let path = paths.local_config_path();
+        fs.mkdir_all(path.parent().unwrap()).unwrap();
+        fs.write_file(&path, b"roles = [\"work\", \"gpu\"]\n")
+            .unwrap();
+        assert_eq!(load_roles(fs, paths).unwrap(), vec!["work", "gpu"]);
+
+        fs.write_file(&path, b"roles = [\"my laptop\"]\n").unwrap();
+        assert!(load_roles(fs, paths).is_err());
+    }
+
     // ── Directory-segment gate parsing ──────────────────────────
 
     #[test]
@@ -0,0 +1,714 @@
+//! Agent handler — gpg-agent and ssh-agent integration.
+//!
+//! The trigger file is `agent.toml` at the pack root:
+//!
+//! ```toml
+//! ssh = "gpg"                  # who answers SSH_AUTH_SOCK: "gpg" or "ssh"
+//!
+//! [gpg-agent]                  # written to gpg-agent.conf
+//! default-cache-ttl = 3600
+//! pinentry-program = "/opt/homebrew/bin/pinentry-mac"
+//! allow-loopback-pinentry = true
+//! ```
+//!
+//! The manifest plans up to three [`HandlerIntent::Run`]s, each with
+//! its own sentinel:
+//!
+//! - `gpg-agent.conf` — the `[gpg-agent]` table rendered one option
+//!   per line (plus `enable-ssh-support` for `ssh = "gpg"`) into
+//!   `${GNUPGHOME:-~/.gnupg}/gpg-agent.conf`, keeping any file it
+//!   replaces as `gpg-agent.conf.dodot-orig`, then `gpgconf --reload`.
+//! - `agent-env` — the exports shell init needs (`GPG_TTY`,
+//!   `SSH_AUTH_SOCK`), written to [`env_file`] in the datastore, which
+//!   [`crate::shell`] sources ahead of the pack's own shell scripts.
+//! - `gpg-agent-service` / `ssh-agent-service` — the agent's user unit
+//!   installed and enabled: gnupg's systemd sockets, a `ssh-agent`
+//!   user service, or a launchd agent for gpg-agent on macOS. macOS
+//!   runs ssh-agent through launchd already, so `ssh = "ssh"` plans
+//!   nothing there.
+//!
+//! Sentinels follow the run-once three-state policy of
+//! [`crate::handlers::system`]. `dodot down` clears them and the
+//! exports with them; `dodot down --deprovision` also restores
+//! `gpg-agent.conf` and takes the units dodot installed back out.
+//!
+//! User-facing reference: `docs/user/handlers/agent.lex`.
+
+use std::collections::BTreeMap;
+use std::path::{Path, PathBuf};
+
+use serde::Deserialize;
+
+use crate::datastore::{DataStore, DidRunStatus};
+use crate::fs::Fs;
+use crate::handlers::run_once::file_checksum_bytes;
+use crate::handlers::system::ORIGINAL_SUFFIX;
+use crate::handlers::undo::{UndoAction, UndoContext};
+use crate::handlers::{
+    ExecutionPhase, Handler, HandlerConfig, HandlerStatus, MatchMode, HANDLER_AGENT,
+    RESOURCE_GNUPG, RESOURCE_SSH_AGENT, RESOURCE_USER_SERVICES,
+};
+use crate::operations::HandlerIntent;
+use crate::paths::Pather;
+use crate::rules::RuleMatch;
+use crate::{DodotError, Result};
+
+/// Filename the handler matches against by default.
+pub const AGENT_TOML: &str = "agent.toml";
+
+/// Script `$0`.
+const SCRIPT_NAME: &str = "dodot-agent";
+
+/// Sentinel filenames, one per planned step.
+const CONF: &str = "gpg-agent.conf";
+const ENV: &str = "agent-env";
+const GPG_SERVICE: &str = "gpg-agent-service";
+const SSH_SERVICE: &str = "ssh-agent-service";
+
+/// gnupg's systemd user units.
+const GPG_SOCKET: &str = "gpg-agent.socket";
+const GPG_SSH_SOCKET: &str = "gpg-agent-ssh.socket";
+
+/// launchd label of the gpg-agent launch agent on macOS.
+const LAUNCHD_LABEL: &str = "org.gnupg.gpg-agent";
+
+/// The exports shell init sources for `pack`.
+pub fn env_file(paths: &dyn Pather, pack: &str) -> PathBuf {
+    paths.handler_data_dir(pack, HANDLER_AGENT).join("env.sh")
+}
+
+/// Which agent answers `SSH_AUTH_SOCK`.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum SshAgent {
+    /// gpg-agent, with `enable-ssh-support`.
+    Gpg,
+    /// OpenSSH's own ssh-agent.
+    Ssh,
+}
+
+/// `agent.toml`.
+#[derive(Debug, Clone, Default, PartialEq, Deserialize)]
+#[serde(deny_unknown_fields)]
+pub struct AgentSpec {
+    /// Who answers `SSH_AUTH_SOCK`. Unset leaves it alone.
+    #[serde(default)]
+    pub ssh: Option<SshAgent>,
+    /// gpg-agent options, by name.
+    #[serde(default, rename = "gpg-agent")]
+    pub gpg_agent: BTreeMap<String, toml::Value>,
+}
+
+impl AgentSpec {
+    /// Whether gpg-agent is involved at all.
+    pub fn uses_gpg(&self) -> bool {
+        self.ssh == Some(SshAgent::Gpg) || !self.gpg_agent.is_empty()
+    }
+}
+
+/// Parse `agent.toml`.
+pub fn parse_agent_toml(bytes: &[u8]) -> Result<AgentSpec> {
+    let text = std::str::from_utf8(bytes)
+        .map_err(|e| DodotError::Other(format!("{AGENT_TOML} is not UTF-8: {e}")))?;
+    let spec: AgentSpec = toml::from_str(text)
+        .map_err(|e| DodotError::Other(format!("failed to parse {AGENT_TOML}: {e}")))?;
+    // Render once so bad options fail at parse time, not at `up`.
+    render_gpg_agent_conf(&spec)?;
+    Ok(spec)
+}
+
+/// `gpg-agent.conf` for `spec`: `true` is a bare flag, `false` leaves
+/// the option out, numbers and strings follow the name.
+pub fn render_gpg_agent_conf(spec: &AgentSpec) -> Result<String> {
+    let mut out = String::from("# Written by dodot from agent.toml — edit that instead.\n");
+    let mut ssh_support = false;
+    for (name, value) in &spec.gpg_agent {
+        let err =
+            |reason: &str| DodotError::Other(format!("{AGENT_TOML}: [gpg-agent] {name}: {reason}"));
+        if name.is_empty()
+            || !name
+                .chars()
+                .all(|c| c.is_ascii_lowercase() || c.is_ascii_digit() || c == '-')
+        {
+            return Err(err("option names are lowercase letters, digits and `-`"));
+        }
+        match value {
+            toml::Value::Boolean(true) => out.push_str(&format!("{name}\n")),
+            toml::Value::Boolean(false) => {}
+            toml::Value::Integer(n) => out.push_str(&format!("{name} {n}\n")),
+            toml::Value::String(s) if !s.contains('\n') => out.push_str(&format!("{name} {s}\n")),
+            _ => return Err(err("expected true, a number, or a one-line string")),
+        }
+        ssh_support |= name == "enable-ssh-support" && *value == toml::Value::Boolean(true);
+    }
+    if spec.ssh == Some(SshAgent::Gpg) && !ssh_support {
+        out.push_str("enable-ssh-support\n");
+    }
+    Ok(out)
+}
+
+/// The shell init exports for `spec`, or `None` when there are none.
+pub fn render_env(spec: &AgentSpec, macos: bool) -> Option<String> {
+    let mut out = String::new();
+    if spec.uses_gpg() {
+        out.push_str("export GPG_TTY=\"$(tty)\"\n");
+    }
+    match spec.ssh {
+        Some(SshAgent::Gpg) => {
+            out.push_str("unset SSH_AGENT_PID\n");
+            out.push_str("export SSH_AUTH_SOCK=\"$(gpgconf --list-dirs agent-ssh-socket)\"\n");
+        }
+        // launchd hands every macOS session its own ssh-agent socket.
+        Some(SshAgent::Ssh) if !macos => out.push_str(
+            "export SSH_AUTH_SOCK=\"${XDG_RUNTIME_DIR:-/run/user/$(id -u)}/ssh-agent.socket\"\n",
+        ),
+        _ => {}
+    }
+    (!out.is_empty()).then_some(out)
+}
+
+/// Write `gpg-agent.conf`: `$1` the content. Identical content is a
+/// no-op.
+pub fn conf_install_script() -> String {
+    format!(
+        "set -e\n\
+         dir=\"${{GNUPGHOME:-$HOME/.gnupg}}\"\n\
+         conf=\"$dir/gpg-agent.conf\"\n\
+         [ -d \"$dir\" ] || mkdir -p -m 700 \"$dir\"\n\
+         printf '%s' \"$1\" > \"$conf.dodot-new\"\n\
+         if [ -f \"$conf\" ] && cmp -s \"$conf.dodot-new\" \"$conf\"; then rm -f \"$conf.dodot-new\"; echo \"# status: $conf already current\"; exit 0; fi\n\
+         if [ -e \"$conf\" ] && [ ! -e \"$conf{ORIGINAL_SUFFIX}\" ]; then cp -p \"$conf\" \"$conf{ORIGINAL_SUFFIX}\"; fi\n\
+         mv -f \"$conf.dodot-new\" \"$conf\"\n\
+         gpgconf --reload gpg-agent 2>/dev/null || true\n\
+         echo \"# status: wrote $conf\"\n"
+    )
+}
+
+/// Put back the `gpg-agent.conf` dodot replaced, or remove the one it
+/// wrote.
+pub fn conf_remove_script() -> String {
+    format!(
+        "set -e\n\
+         conf=\"${{GNUPGHOME:-$HOME/.gnupg}}/gpg-agent.conf\"\n\
+         if [ -e \"$conf{ORIGINAL_SUFFIX}\" ]; then mv -f \"$conf{ORIGINAL_SUFFIX}\" \"$conf\"\n\
+         elif [ -e \"$conf\" ]; then rm -f \"$conf\"\n\
+         fi\n\
+         gpgconf --reload gpg-agent 2>/dev/null || true\n"
+    )
+}
+
+/// Write the shell init exports: `$1` the env file, `$2` its content.
+pub fn env_install_script() -> String {
+    "set -e\n\
+     mkdir -p \"$(dirname \"$1\")\"\n\
+     printf '%s' \"$2\" > \"$1\"\n\
+     echo \"# status: agent exports added to shell init\"\n"
+        .into()
+}
+
+/// Enable gnupg's systemd sockets: `$1` the units, space-separated.
+pub fn systemd_gpg_script() -> String {
+    "set -e\n\
+     systemctl --user enable --now $1\n\
+     echo \"# status: enabled $1\"\n"
+        .into()
+}
+
+/// Disable the sockets dodot enabled, except `gpg-agent.socket`: gnupg
+/// turns that one on by default and gpg itself relies on it.
+pub fn systemd_gpg_remove_script() -> String {
+    format!(
+        "for unit in $1; do\n\
+           [ \"$unit\" = {GPG_SOCKET} ] || systemctl --user disable --now \"$unit\" || true\n\
+         done\n"
+    )
+}
+
+/// Install and enable a `ssh-agent` user service: `$1` the unit file.
+pub fn systemd_ssh_script() -> String {
+    format!(
+        "set -e\n\
+         agent=\"$(command -v ssh-agent)\" || {{ echo \"ssh-agent not found on PATH\" >&2; exit 1; }}\n\
+         mkdir -p \"$(dirname \"$1\")\"\n\
+         cat > \"$1.dodot-new\" <<EOF\n\
+         [Unit]\n\
+         Description=OpenSSH agent (installed by dodot)\n\
+         \n\
+         [Service]\n\
+         Type=simple\n\
+         ExecStart=$agent -D -a %t/ssh-agent.socket\n\
+         \n\
+         [Install]\n\
+         WantedBy=default.target\n\
+         EOF\n\
+         if [ -f \"$1\" ] && cmp -s \"$1.dodot-new\" \"$1\"; then rm -f \"$1.dodot-new\"\n\
+         else\n\
+           if [ -e \"$1\" ] && [ ! -e \"$1{ORIGINAL_SUFFIX}\" ]; then cp -p \"$1\" \"$1{ORIGINAL_SUFFIX}\"; fi\n\
+           mv -f \"$1.dodot-new\" \"$1\"\n\
+         fi\n\
+         systemctl --user daemon-reload\n\
+         systemctl --user enable --now ssh-agent.service\n\
+         echo \"# status: enabled ssh-agent.service\"\n"
+    )
+}
+
+/// Stop the `ssh-agent` user service and take its unit file back out.
+pub fn systemd_ssh_remove_script() -> String {
+    format!(
+        "systemctl --user disable --now ssh-agent.service || true\n\
+         if [ -e \"$1{ORIGINAL_SUFFIX}\" ]; then mv -f \"$1{ORIGINAL_SUFFIX}\" \"$1\"\n\
+         elif [ -e \"$1\" ]; then rm -f \"$1\"\n\
+         fi\n\
+         systemctl --user daemon-reload || true\n"
+    )
+}
+
+/// Install and load a launch agent starting gpg-agent at login: `$1`
+/// the plist.
+pub fn launchd_gpg_script() -> String {
+    format!(
+        "set -e\n\
+         gpgconf=\"$(command -v gpgconf)\" || {{ echo \"gpgconf not found on PATH\" >&2; exit 1; }}\n\
+         mkdir -p \"$(dirname \"$1\")\"\n\
+         cat > \"$1.dodot-new\" <<EOF\n\
+         <?xml version=\"1.0\" encoding=\"UTF-8\"?>\n\
+         <!DOCTYPE plist PUBLIC \"-//Apple//DTD PLIST 1.0//EN\" \"http://www.apple.com/DTDs/PropertyList-1.0.dtd\">\n\
+         <plist version=\"1.0\">\n\
+         <dict>\n\
+         \x20 <key>Label</key><string>{LAUNCHD_LABEL}</string>\n\
+         \x20 <key>ProgramArguments</key>\n\
+         \x20 <array><string>$gpgconf</string><string>--launch</string><string>gpg-agent</string></array>\n\
+         \x20 <key>RunAtLoad</key><true/>\n\
+         </dict>\n\
+         </plist>\n\
+         EOF\n\
+         if [ -f \"$1\" ] && cmp -s \"$1.dodot-new\" \"$1\"; then rm -f \"$1.dodot-new\"\n\
+         else\n\
+           if [ -e \"$1\" ] && [ ! -e \"$1{ORIGINAL_SUFFIX}\" ]; then cp -p \"$1\" \"$1{ORIGINAL_SUFFIX}\"; fi\n\
+           mv -f \"$1.dodot-new\" \"$1\"\n\
+         fi\n\
+         launchctl unload \"$1\" 2>/dev/null || true\n\
+         launchctl load -w \"$1\"\n\
+         echo \"# status: gpg-agent starts at login\"\n"
+    )
+}
+
+/// Unload the gpg-agent launch agent and take its plist back out.
+pub fn launchd_gpg_remove_script() -> String {
+    format!(
+        "launchctl unload -w \"$1\" 2>/dev/null || true\n\
+         if [ -e \"$1{ORIGINAL_SUFFIX}\" ]; then mv -f \"$1{ORIGINAL_SUFFIX}\" \"$1\"\n\
+         elif [ -e \"$1\" ]; then rm -f \"$1\"\n\
+         fi\n"
+    )
+}
+
+/// Where a pack's steps write. Sentinels don't depend on it, so status
+/// plans with the default.
+#[derive(Default)]
+struct Targets {
+    env_file: PathBuf,
+    /// The gpg-agent launch agent, on macOS.
+    plist: PathBuf,
+    /// The `ssh-agent` user service, on Linux.
+    ssh_unit: PathBuf,
+}
+
+impl Targets {
+    fn new(paths: &dyn Pather, pack: &str) -> Self {
+        Self {
+            env_file: env_file(paths, pack),
+            plist: paths
+                .home_dir()
+                .join("Library/LaunchAgents")
+                .join(format!("{LAUNCHD_LABEL}.plist")),
+            ssh_unit: paths
+                .xdg_config_home()
+                .join("systemd/user/ssh-agent.service"),
+        }
+    }
+}
+
+/// One planned step.
+struct Step {
+    /// Sentinel filename.
+    filename: &'static str,
+    checksum: String,
+    script: String,
+    /// `sh -c` arguments after the script name, before the manifest.
+    arguments: Vec<String>,
+}
+
+fn step(filename: &'static str, script: String, arguments: Vec<String>, content: &str) -> Step {
+    Step {
+        filename,
+        checksum: file_checksum_bytes(format!("{script}\n{content}").as_bytes()),
+        script,
+        arguments,
+    }
+}
+
+/// The steps `spec` plans on the given platform.
+fn steps(spec: &AgentSpec, targets: &Targets, macos: bool) -> Result<Vec<Step>> {
+    let path = |p: &PathBuf| p.to_string_lossy().into_owned();
+    let mut out = Vec::new();
+    if spec.uses_gpg() {
+        let conf = render_gpg_agent_conf(spec)?;
+        out.push(step(CONF, conf_install_script(), vec![conf.clone()], &conf));
+    }
+    if let Some(env) = render_env(spec, macos) {
+        let arguments = vec![path(&targets.env_file), env.clone()];
+        out.push(step(ENV, env_install_script(), arguments, &env));
+    }
+    if spec.uses_gpg() {
+        if macos {
+            let arguments = vec![path(&targets.plist)];
+            out.push(step(GPG_SERVICE, launchd_gpg_script(), arguments, ""));
+        } else {
+            let mut units = vec![GPG_SOCKET];
+            if spec.ssh == Some(SshAgent::Gpg) {
+                units.push(GPG_SSH_SOCKET);
+            }
+            let units = units.join(" ");
+            out.push(step(
+                GPG_SERVICE,
+                systemd_gpg_script(),
+                vec![units.clone()],
+                &units,
+            ));
+        }
+    }
+    if spec.ssh == Some(SshAgent::Ssh) && !macos {
+        let arguments = vec![path(&targets.ssh_unit)];
+        out.push(step(SSH_SERVICE, systemd_ssh_script(), arguments, ""));
+    }
+    Ok(out)
+}
+
+pub struct AgentHandler<'a> {
+    fs: &'a dyn Fs,
+    /// Which platform's units apply: launchd on macOS, systemd
+    /// elsewhere.
+    macos: bool,
+}
+
+impl<'a> AgentHandler<'a> {
+    pub fn new(fs: &'a dyn Fs) -> Self {
+        Self {
+            fs,
+            macos: cfg!(target_os = "macos"),
+        }
+    }
+
+    /// A handler for the given platform, whatever this one is.
+    pub fn for_platform(fs: &'a dyn Fs, macos: bool) -> Self {
+        Self { fs, macos }
+    }
+}
+
+impl Handler for AgentHandler<'_> {
+    fn name(&self) -> &str {
+        HANDLER_AGENT
+    }
+
+    /// After provisioning, so gnupg and its units are installed.
+    fn phase(&self) -> ExecutionPhase {
+        ExecutionPhase::Setup
+    }
+
+    /// One `gpg-agent.conf`, one agent per user, one service manager:
+    /// two packs' manifests must not interleave.
+    fn resources(&self) -> &'static [&'static str] {
+        &[RESOURCE_GNUPG, RESOURCE_SSH_AGENT, RESOURCE_USER_SERVICES]
+    }
+
+    fn match_mode(&self) -> MatchMode {
+        MatchMode::Precise
+    }
+
+    fn to_intents(
+        &self,
+        matches: &[RuleMatch],
+        _config: &HandlerConfig,
+        paths: &dyn Pather,
+        fs: &dyn Fs,
+    ) -> Result<Vec<HandlerIntent>> {
+        let mut intents = Vec::new();
+        for m in matches {
+            if m.is_dir {
+                continue;
+            }
+            let Some(bytes) = super::manifest_bytes(m, fs) else {
+                continue;
+            };
+            let spec = parse_agent_toml(&bytes)?;
+            for step in steps(&spec, &Targets::new(paths, &m.pack), self.macos)? {
+                // The manifest goes last so the run header names it.
+                let mut arguments = vec!["-c".into(), step.script, SCRIPT_NAME.into()];
+                arguments.extend(step.arguments);
+                arguments.push(m.absolute_path.to_string_lossy().into_owned());
+                intents.push(HandlerIntent::Run {
+                    pack: m.pack.clone(),
+                    handler: HANDLER_AGENT.into(),
+                    executable: "sh".into(),
+                    arguments,
+                    sentinel: format!("{}-{}", step.filename, step.checksum),
+                    filename: step.filename.into(),
+                    content_hash: step.checksum,
+                });
+            }
+        }
+        Ok(intents)
+    }
+
+    fn warnings_for_matches(
+        &self,
+        matches: &[RuleMatch],
+        _config: &HandlerConfig,
+        _paths: &dyn Pather,
+        fs: &dyn Fs,
+    ) -> Vec<String> {
+        let mut warnings = Vec::new();
+        if !self.macos {
+            return warnings;
+        }
+        for m in matches.iter().filter(|m| !m.is_dir) {
+            let Ok(spec) = fs
+                .read_file(&m.absolute_path)
+                .and_then(|b| parse_agent_toml(&b))
+            else {
+                continue;
+            };
+            if spec.ssh == Some(SshAgent::Ssh) {
+                warnings.push(format!(
+                    "warning: pack `{}` asks for ssh-agent; macOS runs it through launchd \
+                     already, so there is nothing to set up",
+                    m.pack
+                ));
+            }
+        }
+        warnings
+    }
+
+    fn check_status(
+        &self,
+        file: &Path,
+        pack: &str,
+        datastore: &dyn DataStore,
+    ) -> Result<HandlerStatus> {
+        let spec = parse_agent_toml(&self.fs.read_file(file)?)?;
+        let mut pending = Vec::new();
+        let mut older = Vec::new();
+        for step in steps(&spec, &Targets::default(), self.macos)? {
+            match datastore.did_run(pack, HANDLER_AGENT, step.filename, &step.checksum)? {
+                DidRunStatus::NeverRan => pending.push(step.filename),
+                DidRunStatus::RanDifferent { .. } => older.push(step.filename),
+                DidRunStatus::RanCurrent => {}
+            }
+        }
+        let message = if !pending.is_empty() {
+            format!("agent not set up: {}", pending.join(", "))
+        } else if !older.is_empty() {
+            format!(
+                "agent older version: {} (run `dodot up --provision-rerun` to apply current)",
+                older.join(", ")
+            )
+        } else {
+            "agent set up".into()
+        };
+        Ok(HandlerStatus {
+            file: file.to_string_lossy().into_owned(),
+            handler: HANDLER_AGENT.into(),
+            deployed: pending.is_empty(),
+            message,
+        })
+    }
+
+    /// Under `--deprovision`, restore `gpg-agent.conf` and take out the
+    /// units dodot installed. The exports go with the state.
+    fn undo_actions(&self, cx: &UndoContext) -> Result<Vec<UndoAction>> {
+        let mut actions = Vec::new();
+        if cx.deprovision {
+            for intent in cx.intents {
+                let HandlerIntent::Run {
+                    filename,
+                    arguments,
+                    ..
+                } = intent
+                else {
+                    continue;
+                };
+                // arguments: -c, script, $0, then the step's own.
+                let first = arguments.get(3).cloned().unwrap_or_default();
+                let (script, argument) = match filename.as_str() {
+                    CONF => (conf_remove_script(), None),
+                    GPG_SERVICE if self.macos => (launchd_gpg_remove_script(), Some(first)),
+                    GPG_SERVICE => (systemd_gpg_remove_script(), Some(first)),
+                    SSH_SERVICE => (systemd_ssh_remove_script(), Some(first)),
+                    _ => continue,
+                };
+                let mut arguments = vec!["-c".into(), script, SCRIPT_NAME.into()];
+                arguments.extend(argument);
+                actions.push(UndoAction::RunCommand {
+                    executable: "sh".into(),
+                    arguments,
+                });
+            }
+        }
+        actions.push(UndoAction::ClearState);
+        Ok(actions)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::testing::TempEnvironment;
+    use std::collections::HashMap;
+
+    fn plan(env: &TempEnvironment, content: &str, macos: bool) -> Result<Vec<HandlerIntent>> {
+        let path = env.dotfiles_root.join("gpg").join(AGENT_TOML);
+        env.fs.write_file(&path, content.as_bytes()).unwrap();
+        let m = RuleMatch {
+            relative_path: AGENT_TOML.into(),
+            absolute_path: path,
+            pack: "gpg".into(),
+            handler: HANDLER_AGENT.into(),
+            is_dir: false,
+            options: HashMap::new(),
+            preprocessor_source: None,
+            rendered_bytes: None,
+        };
+        AgentHandler::for_platform(env.fs.as_ref(), macos).to_intents(
+            &[m],
+            &HandlerConfig::default(),
+            env.paths.as_ref(),
+            env.fs.as_ref(),
+        )
+    }
+
+    fn env() -> TempEnvironment {
+        TempEnvironment::builder().pack("gpg").done().build()
+    }
+
+    fn steps_of(intents: &[HandlerIntent]) -> Vec<(String, Vec<String>)> {
+        intents
+            .iter()
+            .map(|i| {
+                let HandlerIntent::Run {
+                    filename,
+                    arguments,
+                    ..
+                } = i
+                else {
+                    panic!("expected Run intent");
+                };
+                (filename.clone(), arguments[3..].to_vec())
+            })
+            .collect()
+    }
+
+    #[test]
+    fn gpg_for_ssh_writes_conf_exports_and_enables_sockets_on_linux() {
+        let env = env();
+        let intents = plan(
+            &env,
+            "ssh = \"gpg\"\n\n[gpg-agent]\ndefault-cache-ttl = 3600\n\
+             allow-loopback-pinentry = true\nno-grab = false\n",
+            false,
+        )
+        .unwrap();
+        let steps = steps_of(&intents);
+        let names: Vec<&str> = steps.iter().map(|(n, _)| n.as_str()).collect();
+        assert_eq!(names, vec![CONF, ENV, GPG_SERVICE]);
+
+        let conf = &steps[0].1[0];
+        assert!(conf.contains("allow-loopback-pinentry\n"), "{conf}");
+        assert!(conf.contains("default-cache-ttl 3600\n"), "{conf}");
+        assert!(conf.ends_with("enable-ssh-support\n"), "{conf}");
+        assert!(!conf.contains("no-grab"), "{conf}");
+
+        let env_args = &steps[1].1;
+        assert_eq!(
+            env_args[0],
+            env_file(env.paths.as_ref(), "gpg").to_string_lossy()
+        );
+        assert!(env_args[1].contains("agent-ssh-socket"), "{}", env_args[1]);
+        assert!(env_args[1].contains("GPG_TTY"), "{}", env_args[1]);
+
+        assert_eq!(steps[2].1[0], "gpg-agent.socket gpg-agent-ssh.socket");
+        // The manifest is the last argument of every step.
+        assert!(steps
+            .iter()
+            .all(|(_, a)| a.last().unwrap().ends_with(AGENT_TOML)));
+    }
+
+    #[test]
+    fn ssh_agent_is_a_user_service_on_linux_and_launchd_own_on_macos() {
+        let env = env();
+        let linux = steps_of(&plan(&env, "ssh = \"ssh\"\n", false).unwrap());
+        let names: Vec<&str> = linux.iter().map(|(n, _)| n.as_str()).collect();
+        assert_eq!(names, vec![ENV, SSH_SERVICE]);
+        assert!(linux[0].1[1].contains("ssh-agent.socket"));
+        assert!(linux[1].1[0].ends_with("systemd/user/ssh-agent.service"));
+
+        assert!(plan(&env, "ssh = \"ssh\"\n", true).unwrap().is_empty());
+        let macos = steps_of(&plan(&env, "ssh = \"gpg\"\n", true).unwrap());
+        assert_eq!(macos[2].0, GPG_SERVICE);
+        assert!(macos[2].1[0].ends_with("Library/LaunchAgents/org.gnupg.gpg-agent.plist"));
+    }
+
+    #[test]
+    fn deprovision_restores_the_conf_and_removes_units() {
+        let env = env();
+        for macos in [false, true] {
+            let intents = plan(&env, "ssh = \"gpg\"\n", macos).unwrap();
+            let handler = AgentHandler::for_platform(env.fs.as_ref(), macos);
+            let cx = |deprovision| UndoContext {
+                pack: "gpg",
+                pack_path: Path::new("/unused"),
+                handler_dir: Path::new("/unused"),
+                intents: &intents,
+                deprovision,
+                fs: env.fs.as_ref(),
+            };
+            assert_eq!(
+                handler.undo_actions(&cx(false)).unwrap(),
+                vec![UndoAction::ClearState]
+            );
+            let actions = handler.undo_actions(&cx(true)).unwrap();
+            // Conf and service; the exports go with ClearState.
+            assert_eq!(actions.len(), 3);
+            let UndoAction::RunCommand { arguments, .. } = &actions[0] else {
+                panic!("expected RunCommand");
+            };
+            assert!(arguments[1].contains(ORIGINAL_SUFFIX));
+            let UndoAction::RunCommand { arguments, .. } = &actions[1] else {
+                panic!("expected RunCommand");
+            };
+            if macos {
+                assert!(arguments[1].contains("launchctl unload"));
+            } else {
+                assert!(arguments[1].contains("disable --now"));
+                assert_eq!(arguments[3], "gpg-agent.socket gpg-agent-ssh.socket");
+            }
+        }
+    }
+
+    #[test]
+    fn bad_manifests_are_rejected() {
+        let err = parse_agent_toml(b"ssh = \"putty\"\n")
+            .unwrap_err()
+            .to_string();
+        assert!(err.contains(AGENT_TOML), "{err}");
+        let err = parse_agent_toml(b"[gpg-agent]\nttl = [1]\n")
+            .unwrap_err()
+            .to_string();
+        assert!(err.contains("[gpg-agent] ttl"), "{err}");
+        let err = parse_agent_toml(b"[gpg-agent]\n\"Bad Name\" = 1\n")
+            .unwrap_err()
+            .to_string();
+        assert!(err.contains("lowercase"), "{err}");
+        assert!(parse_agent_toml(b"sssh = \"gpg\"\n").is_err());
+    }
+}
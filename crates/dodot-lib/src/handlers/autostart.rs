@@ -0,0 +1,617 @@
+//! Autostart handler — applications that start at login.
+//!
+//! A pack's `autostart/` directory holds one entry per application,
+//! in the form each platform understands:
+//!
+//! ```text
+//! desktop/autostart/syncthing.desktop    Linux (XDG autostart)
+//! desktop/autostart/login-items.toml     macOS login items
+//! ```
+//!
+//! `login-items.toml` has one table per login item:
+//!
+//! ```toml
+//! [rectangle]
+//! path = "/Applications/Rectangle.app"
+//!
+//! [bartender]
+//! path = "~/Applications/Bartender 5.app"
+//! hidden = true                    # start without showing a window
+//! ```
+//!
+//! Each entry is one [`HandlerIntent::Run`]. On Linux a `.desktop` file
+//! is copied into `$XDG_CONFIG_HOME/autostart/` — a copy, since some
+//! session managers skip symlinks there — keeping any file it replaces
+//! as `<name>.desktop.dodot-orig`. On macOS a login item is (re)created
+//! through `osascript` and System Events. Entries for the other
+//! platform are skipped with a warning, so one pack can carry both.
+//!
+//! Sentinels are per entry, with the run-once three-state policy of
+//! [`crate::handlers::system`]. `dodot down --deprovision` takes every
+//! entry back out: the `.desktop` file is removed (or its original
+//! restored) and the login item deleted.
+//!
+//! User-facing reference: `docs/user/handlers/autostart.lex`.
+
+use std::collections::BTreeMap;
+use std::path::{Path, PathBuf};
+
+use serde::Deserialize;
+
+use crate::datastore::{DataStore, DidRunStatus};
+use crate::fs::Fs;
+use crate::handlers::run_once::file_checksum_bytes;
+use crate::handlers::system::ORIGINAL_SUFFIX;
+use crate::handlers::undo::{UndoAction, UndoContext};
+use crate::handlers::{
+    ExecutionPhase, Handler, HandlerConfig, HandlerStatus, MatchMode, HANDLER_AUTOSTART,
+    RESOURCE_LOGIN_ITEMS,
+};
+use crate::operations::HandlerIntent;
+use crate::paths::Pather;
+use crate::rules::RuleMatch;
+use crate::{DodotError, Result};
+
+/// macOS login items, inside the `autostart/` directory.
+pub const LOGIN_ITEMS_TOML: &str = "login-items.toml";
+
+/// Extension of XDG autostart entries.
+const DESKTOP_EXT: &str = "desktop";
+
+/// Script `$0`.
+const SCRIPT_NAME: &str = "dodot-autostart";
+
+/// Prefix of a login item's sentinel filename, keeping it apart from
+/// `.desktop` entries of the same name.
+const LOGIN_ITEM_PREFIX: &str = "login-item-";
+
+/// Where `.desktop` entries go, under `$XDG_CONFIG_HOME`.
+pub fn autostart_dir(paths: &dyn Pather) -> PathBuf {
+    paths.xdg_config_home().join("autostart")
+}
+
+/// Install a `.desktop` file: `$1` the target, `$2` the pack file.
+/// Identical content is a no-op.
+pub fn desktop_install_script() -> String {
+    format!(
+        "set -e\n\
+         if [ -f \"$1\" ] && cmp -s \"$2\" \"$1\"; then echo \"# status: $1 already current\"; exit 0; fi\n\
+         mkdir -p \"$(dirname \"$1\")\"\n\
+         if [ -e \"$1\" ] && [ ! -e \"$1{ORIGINAL_SUFFIX}\" ]; then cp -p \"$1\" \"$1{ORIGINAL_SUFFIX}\"; fi\n\
+         cp \"$2\" \"$1.dodot-new\"\n\
+         mv -f \"$1.dodot-new\" \"$1\"\n\
+         echo \"# status: starts at login: $1\"\n"
+    )
+}
+
+/// Take a `.desktop` file back out: restore the original, or remove
+/// the entry dodot created.
+pub fn desktop_remove_script() -> String {
+    format!(
+        "set -e\n\
+         if [ -e \"$1{ORIGINAL_SUFFIX}\" ]; then mv -f \"$1{ORIGINAL_SUFFIX}\" \"$1\"\n\
+         elif [ -e \"$1\" ]; then rm -f \"$1\"\n\
+         fi\n"
+    )
+}
+
+/// Create a login item: `$1` the item's name (the app's, as System
+/// Events lists it), `$2` the app path, `$3` `true` to start hidden.
+/// An existing item of that name is replaced, so a changed `hidden`
+/// takes effect.
+pub fn login_item_add_script() -> String {
+    "set -e\n\
+     osascript - \"$1\" \"$2\" \"$3\" <<'APPLESCRIPT'\n\
+     on run argv\n\
+       set itemName to item 1 of argv\n\
+       tell application \"System Events\"\n\
+         if exists login item itemName then delete login item itemName\n\
+         make login item at end with properties {path:(item 2 of argv), hidden:((item 3 of argv) is \"true\")}\n\
+       end tell\n\
+     end run\n\
+     APPLESCRIPT\n\
+     echo \"# status: starts at login: $1\"\n"
+        .into()
+}
+
+/// Delete login item `$1`, if it's there.
+pub fn login_item_remove_script() -> String {
+    "set -e\n\
+     osascript - \"$1\" <<'APPLESCRIPT'\n\
+     on run argv\n\
+       tell application \"System Events\"\n\
+         if exists login item (item 1 of argv) then delete login item (item 1 of argv)\n\
+       end tell\n\
+     end run\n\
+     APPLESCRIPT\n"
+        .into()
+}
+
+/// One table in `login-items.toml`.
+#[derive(Debug, Clone, PartialEq, Eq, Deserialize)]
+#[serde(deny_unknown_fields)]
+pub struct LoginItem {
+    /// The `.app` bundle. Absolute, or `~/`-relative.
+    pub path: String,
+    /// Start without showing a window.
+    #[serde(default)]
+    pub hidden: bool,
+}
+
+impl LoginItem {
+    /// The bundle path with `~` expanded.
+    pub fn app_path(&self, home: &Path) -> PathBuf {
+        match self.path.strip_prefix("~/") {
+            Some(rest) => home.join(rest),
+            None => PathBuf::from(&self.path),
+        }
+    }
+
+    /// The name System Events knows the item by: the bundle's name
+    /// without `.app`.
+    pub fn item_name(&self) -> String {
+        let base = self.path.trim_end_matches('/');
+        let base = base.rsplit('/').next().unwrap_or(base);
+        base.strip_suffix(".app").unwrap_or(base).to_string()
+    }
+}
+
+/// Parse `login-items.toml` into name → (item, canonical table).
+pub fn parse_login_items(bytes: &[u8]) -> Result<BTreeMap<String, (LoginItem, String)>> {
+    let text = std::str::from_utf8(bytes)
+        .map_err(|e| DodotError::Other(format!("{LOGIN_ITEMS_TOML} is not UTF-8: {e}")))?;
+    let table: toml::Table = text
+        .parse()
+        .map_err(|e| DodotError::Other(format!("failed to parse {LOGIN_ITEMS_TOML}: {e}")))?;
+
+    let mut out = BTreeMap::new();
+    for (name, value) in table {
+        let err =
+            |reason: &str| DodotError::Other(format!("{LOGIN_ITEMS_TOML}: [{name}]: {reason}"));
+        if name.is_empty()
+            || !name
+                .chars()
+                .all(|c| c.is_ascii_alphanumeric() || c == '-' || c == '_')
+        {
+            return Err(err("names may only use letters, digits, `-` and `_`"));
+        }
+        let toml::Value::Table(body) = value else {
+            return Err(err("must be a table"));
+        };
+        // Hash the canonical TOML so formatting isn't a change.
+        let canonical = toml::to_string(&body).unwrap_or_default();
+        let item: LoginItem = toml::Value::Table(body)
+            .try_into()
+            .map_err(|e| err(&e.to_string()))?;
+        if !(item.path.starts_with('/') || item.path.starts_with("~/")) {
+            return Err(err("`path` must be absolute or start with `~/`"));
+        }
+        if !item.path.trim_end_matches('/').ends_with(".app") {
+            return Err(err("`path` must name an `.app` bundle"));
+        }
+        out.insert(name, (item, canonical));
+    }
+    Ok(out)
+}
+
+/// One autostart entry, as planned.
+struct Entry {
+    /// Sentinel filename.
+    filename: String,
+    /// What status and warnings call it.
+    shown: String,
+    checksum: String,
+    /// `sh -c` arguments after the script name.
+    arguments: Vec<String>,
+    login_item: bool,
+}
+
+/// The entries in an `autostart/` directory, for either platform.
+/// Other files are returned by name, for a warning. `home` expands
+/// `~/` in login item paths; `.desktop` files install into
+/// `autostart_dir`.
+fn entries(
+    fs: &dyn Fs,
+    dir: &Path,
+    home: &Path,
+    autostart_dir: &Path,
+) -> Result<(Vec<Entry>, Vec<String>)> {
+    let mut out = Vec::new();
+    let mut others = Vec::new();
+    let mut listing = fs.read_dir(dir)?;
+    listing.sort_by(|a, b| a.name.cmp(&b.name));
+    for file in listing {
+        if file.is_dir {
+            others.push(file.name);
+        } else if file.name == LOGIN_ITEMS_TOML {
+            for (name, (item, canonical)) in parse_login_items(&fs.read_file(&file.path)?)? {
+                let app = item.app_path(home);
+                out.push(Entry {
+                    filename: format!("{LOGIN_ITEM_PREFIX}{name}"),
+                    shown: item.item_name(),
+                    checksum: file_checksum_bytes(canonical.as_bytes()),
+                    arguments: vec![
+                        item.item_name(),
+                        app.to_string_lossy().into_owned(),
+                        item.hidden.to_string(),
+                    ],
+                    login_item: true,
+                });
+            }
+        } else if Path::new(&file.name).extension() == Some(DESKTOP_EXT.as_ref()) {
+            let target = autostart_dir.join(&file.name);
+            out.push(Entry {
+                filename: file.name.clone(),
+                shown: file.name.clone(),
+                checksum: file_checksum_bytes(&fs.read_file(&file.path)?),
+                // The pack file goes last so the run header names it.
+                arguments: vec![
+                    target.to_string_lossy().into_owned(),
+                    file.path.to_string_lossy().into_owned(),
+                ],
+                login_item: false,
+            });
+        } else {
+            others.push(file.name);
+        }
+    }
+    Ok((out, others))
+}
+
+pub struct AutostartHandler<'a> {
+    fs: &'a dyn Fs,
+    /// Which platform's entries apply: login items on macOS, `.desktop`
+    /// files elsewhere.
+    macos: bool,
+}
+
+impl<'a> AutostartHandler<'a> {
+    pub fn new(fs: &'a dyn Fs) -> Self {
+        Self {
+            fs,
+            macos: cfg!(target_os = "macos"),
+        }
+    }
+
+    /// A handler for the given platform, whatever this one is.
+    pub fn for_platform(fs: &'a dyn Fs, macos: bool) -> Self {
+        Self { fs, macos }
+    }
+}
+
+impl Handler for AutostartHandler<'_> {
+    fn name(&self) -> &str {
+        HANDLER_AUTOSTART
+    }
+
+    /// After provisioning, so the apps being started are installed.
+    fn phase(&self) -> ExecutionPhase {
+        ExecutionPhase::Setup
+    }
+
+    /// System Events edits the login items as one list.
+    fn resources(&self) -> &'static [&'static str] {
+        &[RESOURCE_LOGIN_ITEMS]
+    }
+
+    fn match_mode(&self) -> MatchMode {
+        MatchMode::Precise
+    }
+
+    fn to_intents(
+        &self,
+        matches: &[RuleMatch],
+        _config: &HandlerConfig,
+        paths: &dyn Pather,
+        fs: &dyn Fs,
+    ) -> Result<Vec<HandlerIntent>> {
+        let mut intents = Vec::new();
+        for m in matches {
+            if !m.is_dir {
+                continue;
+            }
+            let (entries, _) = entries(
+                fs,
+                &m.absolute_path,
+                paths.home_dir(),
+                &autostart_dir(paths),
+            )?;
+            for entry in entries {
+                if entry.login_item != self.macos {
+                    continue;
+                }
+                let script = if entry.login_item {
+                    login_item_add_script()
+                } else {
+                    desktop_install_script()
+                };
+                let mut arguments = vec!["-c".into(), script, SCRIPT_NAME.into()];
+                arguments.extend(entry.arguments);
+                intents.push(HandlerIntent::Run {
+                    pack: m.pack.clone(),
+                    handler: HANDLER_AUTOSTART.into(),
+                    executable: "sh".into(),
+                    arguments,
+                    sentinel: format!("{}-{}", entry.filename, entry.checksum),
+                    filename: entry.filename,
+                    content_hash: entry.checksum,
+                });
+            }
+        }
+        Ok(intents)
+    }
+
+    fn warnings_for_matches(
+        &self,
+        matches: &[RuleMatch],
+        _config: &HandlerConfig,
+        paths: &dyn Pather,
+        fs: &dyn Fs,
+    ) -> Vec<String> {
+        let mut warnings = Vec::new();
+        for m in matches.iter().filter(|m| m.is_dir) {
+            let Ok((entries, others)) = entries(
+                fs,
+                &m.absolute_path,
+                paths.home_dir(),
+                &autostart_dir(paths),
+            ) else {
+                continue;
+            };
+            let skipped: Vec<String> = entries
+                .iter()
+                .filter(|e| e.login_item != self.macos)
+                .map(|e| e.shown.clone())
+                .collect();
+            if !skipped.is_empty() {
+                let kind = if self.macos {
+                    ".desktop entries, which are Linux-only"
+                } else {
+                    "login items, which are macOS-only"
+                };
+                warnings.push(format!(
+                    "warning: pack `{}` skips {kind}: {}",
+                    m.pack,
+                    skipped.join(", ")
+                ));
+            }
+            if !others.is_empty() {
+                warnings.push(format!(
+                    "warning: pack `{}` has files in `{}` that are neither .desktop entries \
+                     nor {LOGIN_ITEMS_TOML}; they are ignored: {}",
+                    m.pack,
+                    m.relative_path.display(),
+                    others.join(", ")
+                ));
+            }
+        }
+        warnings
+    }
+
+    fn check_status(
+        &self,
+        file: &Path,
+        pack: &str,
+        datastore: &dyn DataStore,
+    ) -> Result<HandlerStatus> {
+        let mut pending = Vec::new();
+        let mut older = Vec::new();
+        if self.fs.is_dir(file) {
+            // Sentinels don't depend on where entries install, so no
+            // real paths are needed here.
+            let (entries, _) = entries(self.fs, file, Path::new("~"), Path::new(""))?;
+            for entry in entries.iter().filter(|e| e.login_item == self.macos) {
+                match datastore.did_run(
+                    pack,
+                    HANDLER_AUTOSTART,
+                    &entry.filename,
+                    &entry.checksum,
+                )? {
+                    DidRunStatus::NeverRan => pending.push(entry.shown.clone()),
+                    DidRunStatus::RanDifferent { .. } => older.push(entry.shown.clone()),
+                    DidRunStatus::RanCurrent => {}
+                }
+            }
+        }
+        let message = if !pending.is_empty() {
+            format!("not set to start at login: {}", pending.join(", "))
+        } else if !older.is_empty() {
+            format!(
+                "autostart older version: {} (run `dodot up --provision-rerun` to apply current)",
+                older.join(", ")
+            )
+        } else {
+            "starts at login".into()
+        };
+        Ok(HandlerStatus {
+            file: file.to_string_lossy().into_owned(),
+            handler: HANDLER_AUTOSTART.into(),
+            deployed: pending.is_empty(),
+            message,
+        })
+    }
+
+    /// Under `--deprovision`, take every planned entry back out.
+    fn undo_actions(&self, cx: &UndoContext) -> Result<Vec<UndoAction>> {
+        let mut actions = Vec::new();
+        if cx.deprovision {
+            for intent in cx.intents {
+                let HandlerIntent::Run {
+                    filename,
+                    arguments,
+                    ..
+                } = intent
+                else {
+                    continue;
+                };
+                // arguments: -c, script, $0, then the entry's own.
+                let Some(first) = arguments.get(3) else {
+                    continue;
+                };
+                let script = if filename.starts_with(LOGIN_ITEM_PREFIX) {
+                    login_item_remove_script()
+                } else {
+                    desktop_remove_script()
+                };
+                actions.push(UndoAction::RunCommand {
+                    executable: "sh".into(),
+                    arguments: vec!["-c".into(), script, SCRIPT_NAME.into(), first.clone()],
+                });
+            }
+        }
+        actions.push(UndoAction::ClearState);
+        Ok(actions)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::testing::TempEnvironment;
+    use std::collections::HashMap;
+
+    fn desktop_env() -> TempEnvironment {
+        TempEnvironment::builder()
+            .pack("desktop")
+            .file(
+                "autostart/syncthing.desktop",
+                "[Desktop Entry]\nExec=syncthing\n",
+            )
+            .file(
+                "autostart/login-items.toml",
+                "[rectangle]\npath = \"/Applications/Rectangle.app\"\n\n\
+                 [bartender]\npath = \"~/Applications/Bartender 5.app\"\nhidden = true\n",
+            )
+            .done()
+            .build()
+    }
+
+    fn plan(env: &TempEnvironment, macos: bool) -> Result<Vec<HandlerIntent>> {
+        let m = RuleMatch {
+            relative_path: "autostart".into(),
+            absolute_path: env.dotfiles_root.join("desktop/autostart"),
+            pack: "desktop".into(),
+            handler: HANDLER_AUTOSTART.into(),
+            is_dir: true,
+            options: HashMap::new(),
+            preprocessor_source: None,
+            rendered_bytes: None,
+        };
+        AutostartHandler::for_platform(env.fs.as_ref(), macos).to_intents(
+            &[m],
+            &HandlerConfig::default(),
+            env.paths.as_ref(),
+            env.fs.as_ref(),
+        )
+    }
+
+    #[test]
+    fn desktop_files_install_into_xdg_autostart_on_linux() {
+        let env = desktop_env();
+        let intents = plan(&env, false).unwrap();
+        assert_eq!(intents.len(), 1);
+        let HandlerIntent::Run {
+            arguments,
+            filename,
+            ..
+        } = &intents[0]
+        else {
+            panic!("expected Run intent");
+        };
+        assert_eq!(filename, "syncthing.desktop");
+        assert_eq!(
+            arguments[3],
+            env.paths
+                .xdg_config_home()
+                .join("autostart/syncthing.desktop")
+                .to_string_lossy()
+        );
+        assert!(arguments[4].ends_with("autostart/syncthing.desktop"));
+    }
+
+    #[test]
+    fn login_items_are_added_through_system_events_on_macos() {
+        let env = desktop_env();
+        let intents = plan(&env, true).unwrap();
+        let items: Vec<_> = intents
+            .iter()
+            .map(|i| {
+                let HandlerIntent::Run { arguments, .. } = i else {
+                    panic!("expected Run intent");
+                };
+                arguments[3..].to_vec()
+            })
+            .collect();
+        assert_eq!(
+            items,
+            vec![
+                vec![
+                    "Bartender 5".to_string(),
+                    env.home
+                        .join("Applications/Bartender 5.app")
+                        .to_string_lossy()
+                        .into_owned(),
+                    "true".into(),
+                ],
+                vec![
+                    "Rectangle".into(),
+                    "/Applications/Rectangle.app".into(),
+                    "false".into(),
+                ],
+            ]
+        );
+        let HandlerIntent::Run { arguments, .. } = &intents[0] else {
+            unreachable!()
+        };
+        assert!(arguments[1].contains("make login item"), "{}", arguments[1]);
+    }
+
+    #[test]
+    fn deprovision_takes_every_entry_back_out() {
+        let env = desktop_env();
+        for macos in [false, true] {
+            let intents = plan(&env, macos).unwrap();
+            let handler = AutostartHandler::for_platform(env.fs.as_ref(), macos);
+            let cx = |deprovision| UndoContext {
+                pack: "desktop",
+                pack_path: Path::new("/unused"),
+                handler_dir: Path::new("/unused"),
+                intents: &intents,
+                deprovision,
+                fs: env.fs.as_ref(),
+            };
+            assert_eq!(
+                handler.undo_actions(&cx(false)).unwrap(),
+                vec![UndoAction::ClearState]
+            );
+            let actions = handler.undo_actions(&cx(true)).unwrap();
+            assert_eq!(actions.len(), intents.len() + 1);
+            let UndoAction::RunCommand { arguments, .. } = &actions[0] else {
+                panic!("expected RunCommand");
+            };
+            if macos {
+                assert!(arguments[1].contains("delete login item"));
+                assert_eq!(arguments[3], "Bartender 5");
+            } else {
+                assert!(arguments[1].contains(ORIGINAL_SUFFIX));
+                assert!(arguments[3].ends_with("autostart/syncthing.desktop"));
+            }
+        }
+    }
+
+    #[test]
+    fn bad_login_items_are_rejected() {
+        let err = parse_login_items(b"[x]\npath = \"Rectangle.app\"\n")
+            .unwrap_err()
+            .to_string();
+        assert!(err.contains("absolute"), "{err}");
+        let err = parse_login_items(b"[x]\npath = \"/usr/bin/top\"\n")
+            .unwrap_err()
+            .to_string();
+        assert!(err.contains(".app"), "{err}");
+        let err = parse_login_items(b"[x]\npath = \"/A.app\"\nhiden = true\n")
+            .unwrap_err()
+            .to_string();
+        assert!(err.contains("[x]"), "{err}");
+    }
+}
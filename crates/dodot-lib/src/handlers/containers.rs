@@ -0,0 +1,363 @@
+//! Containers handler — pull images and create the named volumes and
+//! networks a machine's dev containers expect.
+//!
+//! The trigger file is `containers.toml` (or `devcontainer.toml`) at
+//! the pack root:
+//!
+//! ```toml
+//! engine = "podman"            # default "docker"
+//! images = ["postgres:16", "ghcr.io/acme/devbox:latest"]
+//! volumes = ["pgdata", "cargo-cache"]
+//! networks = ["dev"]
+//! ```
+//!
+//! Each manifest becomes one [`HandlerIntent::Run`] whose script pulls
+//! every image and creates each volume and network that doesn't exist
+//! yet, so a re-run never fails on "already exists". Containers
+//! themselves are left to compose files and devcontainer tooling;
+//! dodot only gets the machine ready for them.
+//!
+//! The sentinel is `<file>-<checksum>` over the manifest's canonical
+//! TOML, so reformatting or reordering keys is not a change. The
+//! run-once three-state policy of [`crate::handlers::plugins`]
+//! applies: an edited manifest shows as an older version until
+//! `dodot up --provision-rerun`.
+//!
+//! User-facing reference: `docs/user/handlers/containers.lex`.
+
+use std::path::Path;
+
+use serde::Deserialize;
+
+use crate::datastore::{DataStore, DidRunStatus};
+use crate::fs::Fs;
+use crate::handlers::run_once::file_checksum_bytes;
+use crate::handlers::{
+    ExecutionPhase, Handler, HandlerConfig, HandlerStatus, MatchMode, HANDLER_CONTAINERS,
+};
+use crate::operations::HandlerIntent;
+use crate::paths::Pather;
+use crate::rules::RuleMatch;
+use crate::shell::sh_quote;
+use crate::{DodotError, Result};
+
+/// Container engines the handler drives. Both share the
+/// `pull` / `volume` / `network` CLI.
+const ENGINES: &[&str] = &["docker", "podman"];
+
+/// A parsed `containers.toml`. Every key is optional.
+#[derive(Debug, Clone, Default, PartialEq, Eq, Deserialize)]
+#[serde(deny_unknown_fields)]
+pub struct ContainersSpec {
+    /// `docker` (default) or `podman`.
+    pub engine: Option<String>,
+    /// Image references to pull.
+    #[serde(default)]
+    pub images: Vec<String>,
+    /// Named volumes to create.
+    #[serde(default)]
+    pub volumes: Vec<String>,
+    /// Networks to create.
+    #[serde(default)]
+    pub networks: Vec<String>,
+}
+
+impl ContainersSpec {
+    pub fn engine(&self) -> &str {
+        self.engine.as_deref().unwrap_or("docker")
+    }
+
+    fn is_empty(&self) -> bool {
+        self.images.is_empty() && self.volumes.is_empty() && self.networks.is_empty()
+    }
+}
+
+/// Parse a manifest into its spec and the canonical TOML the sentinel
+/// hashes. `file` names the manifest in errors. Unknown keys, an
+/// unknown engine and blank names are errors so a typo doesn't
+/// silently set up nothing.
+pub fn parse_containers_toml(file: &str, bytes: &[u8]) -> Result<(ContainersSpec, String)> {
+    let text = std::str::from_utf8(bytes)
+        .map_err(|e| DodotError::Other(format!("{file} is not UTF-8: {e}")))?;
+    let table: toml::Table = text
+        .parse()
+        .map_err(|e| DodotError::Other(format!("failed to parse {file}: {e}")))?;
+    let canonical = toml::to_string(&table).unwrap_or_default();
+    let spec: ContainersSpec = toml::Value::Table(table)
+        .try_into()
+        .map_err(|e| DodotError::Other(format!("{file}: {e}")))?;
+
+    if !ENGINES.contains(&spec.engine()) {
+        return Err(DodotError::Other(format!(
+            "{file}: engine must be one of {}, got {:?}",
+            ENGINES.join(", "),
+            spec.engine()
+        )));
+    }
+    for (key, names) in [
+        ("images", &spec.images),
+        ("volumes", &spec.volumes),
+        ("networks", &spec.networks),
+    ] {
+        if names.iter().any(|n| n.trim().is_empty()) {
+            return Err(DodotError::Other(format!(
+                "{file}: `{key}` has an empty entry"
+            )));
+        }
+    }
+    Ok((spec, canonical))
+}
+
+/// The shell script that brings the engine's state in line with
+/// `spec`. Volumes and networks are created only when `inspect` says
+/// they're missing; images are always pulled, since the script only
+/// runs when the manifest is new or changed.
+pub fn containers_script(spec: &ContainersSpec) -> String {
+    let mut script = format!("set -e\nengine={}\n", sh_quote(spec.engine()));
+    if spec.is_empty() {
+        return script;
+    }
+    script.push_str(
+        "command -v \"$engine\" >/dev/null 2>&1 || \
+         { echo \"$engine is not installed\" >&2; exit 127; }\n",
+    );
+    for image in &spec.images {
+        script.push_str(&format!("\"$engine\" pull {}\n", sh_quote(image)));
+    }
+    for (kind, names) in [("volume", &spec.volumes), ("network", &spec.networks)] {
+        for name in names {
+            let name = sh_quote(name);
+            script.push_str(&format!(
+                "\"$engine\" {kind} inspect {name} >/dev/null 2>&1 || \
+                 \"$engine\" {kind} create {name}\n"
+            ));
+        }
+    }
+    script
+}
+
+/// Sentinel checksum for a manifest.
+fn spec_checksum(canonical: &str) -> String {
+    file_checksum_bytes(canonical.as_bytes())
+}
+
+fn file_name(path: &Path) -> String {
+    path.file_name()
+        .unwrap_or_default()
+        .to_string_lossy()
+        .into_owned()
+}
+
+pub struct ContainersHandler<'a> {
+    fs: &'a dyn Fs,
+}
+
+impl<'a> ContainersHandler<'a> {
+    pub fn new(fs: &'a dyn Fs) -> Self {
+        Self { fs }
+    }
+}
+
+impl Handler for ContainersHandler<'_> {
+    fn name(&self) -> &str {
+        HANDLER_CONTAINERS
+    }
+
+    fn phase(&self) -> ExecutionPhase {
+        ExecutionPhase::Provision
+    }
+
+    fn match_mode(&self) -> MatchMode {
+        MatchMode::Precise
+    }
+
+    fn to_intents(
+        &self,
+        matches: &[RuleMatch],
+        _config: &HandlerConfig,
+        _paths: &dyn Pather,
+        fs: &dyn Fs,
+    ) -> Result<Vec<HandlerIntent>> {
+        let mut intents = Vec::new();
+        for m in matches {
+            if m.is_dir {
+                continue;
+            }
+            let Some(bytes) = super::manifest_bytes(m, fs) else {
+                continue;
+            };
+            let filename = file_name(&m.relative_path);
+            let (spec, canonical) = parse_containers_toml(&filename, &bytes)?;
+            let checksum = spec_checksum(&canonical);
+            // `sh -c <script> <$0> <manifest>`: the trailing argument
+            // is the manifest so the run header and the snapshot both
+            // point at it.
+            let arguments = vec![
+                "-c".into(),
+                containers_script(&spec),
+                format!("dodot-{HANDLER_CONTAINERS}"),
+                m.absolute_path.to_string_lossy().into_owned(),
+            ];
+            intents.push(HandlerIntent::Run {
+                pack: m.pack.clone(),
+                handler: HANDLER_CONTAINERS.into(),
+                executable: "sh".into(),
+                arguments,
+                sentinel: format!("{filename}-{checksum}"),
+                filename,
+                content_hash: checksum,
+            });
+        }
+        Ok(intents)
+    }
+
+    fn check_status(
+        &self,
+        file: &Path,
+        pack: &str,
+        datastore: &dyn DataStore,
+    ) -> Result<HandlerStatus> {
+        let filename = file_name(file);
+        let (_, canonical) = parse_containers_toml(&filename, &self.fs.read_file(file)?)?;
+        let status = datastore.did_run(
+            pack,
+            HANDLER_CONTAINERS,
+            &filename,
+            &spec_checksum(&canonical),
+        )?;
+        let (deployed, message) = match status {
+            DidRunStatus::NeverRan => (false, "containers not set up".to_string()),
+            DidRunStatus::RanCurrent => (true, "containers set up".to_string()),
+            DidRunStatus::RanDifferent { .. } => (
+                true,
+                "containers set up (older version — run `dodot up --provision-rerun` to apply current)"
+                    .to_string(),
+            ),
+        };
+        Ok(HandlerStatus {
+            file: file.to_string_lossy().into_owned(),
+            handler: HANDLER_CONTAINERS.into(),
+            deployed,
+            message,
+        })
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::testing::TempEnvironment;
+    use std::collections::HashMap;
+
+    fn plan(env: &TempEnvironment, file: &str, content: &str) -> Result<Vec<HandlerIntent>> {
+        let path = env.dotfiles_root.join("dev").join(file);
+        env.fs.write_file(&path, content.as_bytes()).unwrap();
+        let m = RuleMatch {
+            relative_path: file.into(),
+            absolute_path: path,
+            pack: "dev".into(),
+            handler: HANDLER_CONTAINERS.into(),
+            is_dir: false,
+            options: HashMap::new(),
+            preprocessor_source: None,
+            rendered_bytes: None,
+        };
+        ContainersHandler::new(env.fs.as_ref()).to_intents(
+            &[m],
+            &HandlerConfig::default(),
+            env.paths.as_ref(),
+            env.fs.as_ref(),
+        )
+    }
+
+    fn env() -> TempEnvironment {
+        TempEnvironment::builder()
+            .pack("dev")
+            .file("README", "x")
+            .done()
+            .build()
+    }
+
+    #[test]
+    fn one_run_intent_pulls_images_and_creates_missing_volumes_and_networks() {
+        let env = env();
+        let intents = plan(
+            &env,
+            "containers.toml",
+            "engine = \"podman\"\nimages = [\"postgres:16\"]\nvolumes = [\"pgdata\"]\nnetworks = [\"dev\"]\n",
+        )
+        .unwrap();
+        assert_eq!(intents.len(), 1);
+        let HandlerIntent::Run {
+            executable,
+            arguments,
+            sentinel,
+            filename,
+            ..
+        } = &intents[0]
+        else {
+            panic!("expected Run intent");
+        };
+        assert_eq!(executable, "sh");
+        assert_eq!(filename, "containers.toml");
+        assert!(sentinel.starts_with("containers.toml-"), "{sentinel}");
+        let script = &arguments[1];
+        assert!(script.contains("engine='podman'"), "{script}");
+        assert!(
+            script.contains("\"$engine\" pull 'postgres:16'"),
+            "{script}"
+        );
+        assert!(
+            script.contains(
+                "\"$engine\" volume inspect 'pgdata' >/dev/null 2>&1 || \"$engine\" volume create 'pgdata'"
+            ),
+            "{script}"
+        );
+        assert!(
+            script.contains("\"$engine\" network create 'dev'"),
+            "{script}"
+        );
+        assert!(arguments.last().unwrap().ends_with("dev/containers.toml"));
+    }
+
+    #[test]
+    fn sentinel_ignores_formatting_but_not_content() {
+        let env = env();
+        let sentinel =
+            |content: &str| match plan(&env, "devcontainer.toml", content).unwrap().remove(0) {
+                HandlerIntent::Run { sentinel, .. } => sentinel,
+                _ => unreachable!(),
+            };
+        let a = sentinel("images = [\"redis:7\"]\nvolumes = [\"v\"]\n");
+        let b = sentinel("# cache\nvolumes = [ \"v\" ]\n\nimages = [\"redis:7\"]\n");
+        let c = sentinel("images = [\"redis:7\", \"postgres:16\"]\nvolumes = [\"v\"]\n");
+        assert_eq!(a, b);
+        assert_ne!(a, c);
+    }
+
+    #[test]
+    fn unknown_keys_engines_and_blank_names_are_rejected() {
+        let err = parse_containers_toml("containers.toml", b"image = [\"x\"]\n")
+            .unwrap_err()
+            .to_string();
+        assert!(err.contains("unknown field `image`"), "{err}");
+
+        let err = parse_containers_toml("containers.toml", b"engine = \"lxc\"\n")
+            .unwrap_err()
+            .to_string();
+        assert!(err.contains("docker, podman"), "{err}");
+
+        let err = parse_containers_toml("containers.toml", b"volumes = [\" \"]\n")
+            .unwrap_err()
+            .to_string();
+        assert!(err.contains("`volumes` has an empty entry"), "{err}");
+    }
+
+    #[test]
+    fn an_empty_manifest_needs_no_engine() {
+        let (spec, _) = parse_containers_toml("containers.toml", b"").unwrap();
+        assert_eq!(spec.engine(), "docker");
+        let script = containers_script(&spec);
+        assert!(!script.contains("command -v"), "{script}");
+    }
+}
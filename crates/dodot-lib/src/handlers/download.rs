@@ -0,0 +1,330 @@
+//! Download handler — single-binary tools fetched from a URL.
+//!
+//! The trigger file is `tools.toml` at the pack root. Each table names
+//! one tool that isn't in a package manager (or not in a recent enough
+//! version):
+//!
+//! ```toml
+//! [rg]
+//! version = "14.1.1"
+//! url = "https://github.com/BurntSushi/ripgrep/releases/download/{version}/ripgrep-{version}-x86_64-unknown-linux-musl.tar.gz"
+//! sha256 = "…"                     # of the .tar.gz
+//! member = "ripgrep-{version}-x86_64-unknown-linux-musl/rg"
+//!
+//! [jq]
+//! url = "https://github.com/jqlang/jq/releases/download/jq-1.7.1/jq-linux-amd64"
+//! sha256 = "…"
+//! ```
+//!
+//! `{version}` in `url` and `member` is replaced by `version`. Without
+//! `member` the download is the binary; with it, the download is an
+//! archive (`.tar.gz` / `.zip`, or `format = …`) and `member` the file
+//! to take out of it. `bin` names the installed command (default: the
+//! table name).
+//!
+//! Every tool plans to one [`HandlerIntent::Fetch`] with a
+//! [`FetchSpec::Binary`] spec, so download, sha256 check, extraction
+//! and sentinels are the externals executor's. The binary lands in the
+//! datastore and is linked from the pack's managed bin dir,
+//! `<data>/packs/<pack>/download/bin/`, which the init script puts on
+//! `$PATH`. The sentinel is keyed on the sha256: bumping `version`
+//! (and with it `sha256`) downloads the new release on the next `up`.
+//!
+//! User-facing reference: `docs/user/handlers/download.lex`.
+
+use std::collections::BTreeMap;
+use std::path::{Path, PathBuf};
+
+use serde::Deserialize;
+
+use crate::datastore::DataStore;
+use crate::external::{ArchiveFormat, FetchSpec};
+use crate::fs::Fs;
+use crate::handlers::{
+    ExecutionPhase, Handler, HandlerConfig, HandlerStatus, MatchMode, HANDLER_DOWNLOAD,
+};
+use crate::operations::HandlerIntent;
+use crate::paths::Pather;
+use crate::rules::RuleMatch;
+use crate::{DodotError, Result};
+
+/// Filename the handler matches against by default.
+pub const TOOLS_TOML: &str = "tools.toml";
+
+/// Placeholder in `url` and `member` replaced by the tool's `version`.
+const VERSION_PLACEHOLDER: &str = "{version}";
+
+/// Name of the managed bin dir inside the handler's data dir, and so
+/// not usable as a tool name.
+const BIN_DIR: &str = "bin";
+
+/// One tool's table in `tools.toml`.
+#[derive(Debug, Clone, PartialEq, Eq, Deserialize)]
+#[serde(deny_unknown_fields)]
+pub struct ToolSpec {
+    /// Substituted for `{version}` in `url` and `member`.
+    pub version: Option<String>,
+    pub url: String,
+    /// Hash of the downloaded bytes (the archive, when `member` is set).
+    pub sha256: String,
+    /// Path of the binary inside the archive.
+    pub member: Option<String>,
+    /// Archive format when the URL doesn't end in `.tar.gz` / `.zip`.
+    pub format: Option<ArchiveFormat>,
+    /// Command name in the bin dir. Defaults to the table name.
+    pub bin: Option<String>,
+}
+
+impl ToolSpec {
+    /// The command name this tool installs as.
+    pub fn bin_name<'a>(&'a self, name: &'a str) -> &'a str {
+        self.bin.as_deref().unwrap_or(name)
+    }
+
+    /// The fetch recipe, with `{version}` filled in.
+    pub fn fetch_spec(&self) -> FetchSpec {
+        let expand = |s: &str| match &self.version {
+            Some(v) => s.replace(VERSION_PLACEHOLDER, v),
+            None => s.to_string(),
+        };
+        FetchSpec::Binary {
+            url: expand(&self.url),
+            sha256: self.sha256.clone(),
+            member: self.member.as_deref().map(expand),
+            format: self.format,
+        }
+    }
+}
+
+/// Parse `tools.toml` into tool name → spec. Unknown keys, unsafe
+/// names and a `{version}` with no `version` to fill it are errors.
+pub fn parse_tools_toml(bytes: &[u8]) -> Result<BTreeMap<String, ToolSpec>> {
+    let text = std::str::from_utf8(bytes)
+        .map_err(|e| DodotError::Other(format!("{TOOLS_TOML} is not UTF-8: {e}")))?;
+    let tools: BTreeMap<String, ToolSpec> = toml::from_str(text)
+        .map_err(|e| DodotError::Other(format!("failed to parse {TOOLS_TOML}: {e}")))?;
+    for (name, spec) in &tools {
+        check_name(name, "tool name").map_err(|e| tool_error(name, &e))?;
+        if name == BIN_DIR {
+            return Err(tool_error(name, "`bin` is reserved for the bin dir"));
+        }
+        if let Some(bin) = &spec.bin {
+            check_name(bin, "`bin`").map_err(|e| tool_error(name, &e))?;
+        }
+        let templated = spec.url.contains(VERSION_PLACEHOLDER)
+            || spec
+                .member
+                .as_deref()
+                .is_some_and(|m| m.contains(VERSION_PLACEHOLDER));
+        if templated && spec.version.is_none() {
+            return Err(tool_error(name, "uses `{version}` but sets no `version`"));
+        }
+    }
+    Ok(tools)
+}
+
+fn tool_error(name: &str, reason: &str) -> DodotError {
+    DodotError::Other(format!("{TOOLS_TOML}: [{name}]: {reason}"))
+}
+
+/// Names become path components and sentinel prefixes: ASCII letters,
+/// digits, `-`, `_` and `.`, not starting with a dot.
+fn check_name(value: &str, what: &str) -> std::result::Result<(), String> {
+    let ok = !value.is_empty()
+        && !value.starts_with('.')
+        && value
+            .chars()
+            .all(|c| c.is_ascii_alphanumeric() || matches!(c, '-' | '_' | '.'));
+    if ok {
+        Ok(())
+    } else {
+        Err(format!(
+            "{what} {value:?} may only use ASCII letters, digits, `-`, `_` and `.`"
+        ))
+    }
+}
+
+/// The pack's managed bin dir: where its tools are linked, and what
+/// the init script adds to `$PATH`.
+pub fn bin_dir(paths: &dyn Pather, pack: &str) -> PathBuf {
+    paths.handler_data_dir(pack, HANDLER_DOWNLOAD).join(BIN_DIR)
+}
+
+pub struct DownloadHandler<'a> {
+    fs: &'a dyn Fs,
+}
+
+impl<'a> DownloadHandler<'a> {
+    pub fn new(fs: &'a dyn Fs) -> Self {
+        Self { fs }
+    }
+}
+
+impl Handler for DownloadHandler<'_> {
+    fn name(&self) -> &str {
+        HANDLER_DOWNLOAD
+    }
+
+    fn phase(&self) -> ExecutionPhase {
+        ExecutionPhase::Provision
+    }
+
+    fn match_mode(&self) -> MatchMode {
+        MatchMode::Precise
+    }
+
+    fn to_intents(
+        &self,
+        matches: &[RuleMatch],
+        _config: &HandlerConfig,
+        paths: &dyn Pather,
+        fs: &dyn Fs,
+    ) -> Result<Vec<HandlerIntent>> {
+        let mut intents = Vec::new();
+        for m in matches {
+            if m.is_dir {
+                continue;
+            }
+            let Some(bytes) = super::manifest_bytes(m, fs) else {
+                continue;
+            };
+
+            let dir = bin_dir(paths, &m.pack);
+            for (name, spec) in parse_tools_toml(&bytes)? {
+                intents.push(HandlerIntent::Fetch {
+                    pack: m.pack.clone(),
+                    handler: HANDLER_DOWNLOAD.into(),
+                    user_path: dir.join(spec.bin_name(&name)),
+                    spec: spec.fetch_spec(),
+                    name,
+                });
+            }
+        }
+        Ok(intents)
+    }
+
+    fn check_status(
+        &self,
+        file: &Path,
+        pack: &str,
+        datastore: &dyn DataStore,
+    ) -> Result<HandlerStatus> {
+        let tools = parse_tools_toml(&self.fs.read_file(file)?)?;
+        let mut pending = Vec::new();
+        for (name, spec) in &tools {
+            let sentinel = crate::execution::fetch_sentinel(name, &spec.fetch_spec())
+                .expect("binary fetches are content-addressed");
+            if !datastore.has_sentinel(pack, HANDLER_DOWNLOAD, &sentinel)? {
+                pending.push(match &spec.version {
+                    Some(v) => format!("{name} {v}"),
+                    None => name.clone(),
+                });
+            }
+        }
+        let message = if pending.is_empty() {
+            "tools downloaded".into()
+        } else {
+            format!("tools not downloaded: {}", pending.join(", "))
+        };
+        Ok(HandlerStatus {
+            file: file.to_string_lossy().into_owned(),
+            handler: HANDLER_DOWNLOAD.into(),
+            deployed: pending.is_empty(),
+            message,
+        })
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::testing::TempEnvironment;
+    use std::collections::HashMap;
+
+    fn plan(env: &TempEnvironment, content: &str) -> Result<Vec<HandlerIntent>> {
+        let path = env.dotfiles_root.join("cli").join(TOOLS_TOML);
+        env.fs.write_file(&path, content.as_bytes()).unwrap();
+        let m = RuleMatch {
+            relative_path: TOOLS_TOML.into(),
+            absolute_path: path,
+            pack: "cli".into(),
+            handler: HANDLER_DOWNLOAD.into(),
+            is_dir: false,
+            options: HashMap::new(),
+            preprocessor_source: None,
+            rendered_bytes: None,
+        };
+        DownloadHandler::new(env.fs.as_ref()).to_intents(
+            &[m],
+            &HandlerConfig::default(),
+            env.paths.as_ref(),
+            env.fs.as_ref(),
+        )
+    }
+
+    #[test]
+    fn tools_plan_to_binary_fetches_into_the_bin_dir() {
+        let env = TempEnvironment::builder()
+            .pack("cli")
+            .file("aliases.sh", "x")
+            .done()
+            .build();
+        let intents = plan(
+            &env,
+            r#"
+[rg]
+version = "14.1.1"
+url = "https://example.com/{version}/ripgrep-{version}.tar.gz"
+sha256 = "aaaa"
+member = "ripgrep-{version}/rg"
+
+[jq]
+url = "https://example.com/jq-linux"
+sha256 = "bbbb"
+bin = "jq1"
+"#,
+        )
+        .unwrap();
+        assert_eq!(intents.len(), 2);
+
+        let HandlerIntent::Fetch {
+            name,
+            spec,
+            user_path,
+            ..
+        } = &intents[1]
+        else {
+            panic!("expected Fetch intent");
+        };
+        assert_eq!(name, "rg");
+        assert_eq!(*user_path, bin_dir(env.paths.as_ref(), "cli").join("rg"));
+        let FetchSpec::Binary { url, member, .. } = spec else {
+            panic!("expected a binary spec");
+        };
+        assert_eq!(url, "https://example.com/14.1.1/ripgrep-14.1.1.tar.gz");
+        assert_eq!(member.as_deref(), Some("ripgrep-14.1.1/rg"));
+
+        let HandlerIntent::Fetch { user_path, .. } = &intents[0] else {
+            panic!("expected Fetch intent");
+        };
+        assert!(user_path.ends_with("download/bin/jq1"));
+    }
+
+    #[test]
+    fn bad_tables_are_rejected() {
+        let err = parse_tools_toml(b"[rg]\nurl = \"https://x/{version}\"\nsha256 = \"a\"\n")
+            .unwrap_err()
+            .to_string();
+        assert!(err.contains("sets no `version`"), "{err}");
+
+        let err = parse_tools_toml(b"[rg]\nurl = \"u\"\nsha256 = \"a\"\nbin = \"../rg\"\n")
+            .unwrap_err()
+            .to_string();
+        assert!(err.contains("`bin`"), "{err}");
+
+        let err = parse_tools_toml(b"[rg]\nurl = \"u\"\nsha = \"a\"\n")
+            .unwrap_err()
+            .to_string();
+        assert!(err.contains("failed to parse tools.toml"), "{err}");
+    }
+}
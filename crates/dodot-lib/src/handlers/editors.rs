@@ -0,0 +1,504 @@
+//! Editors handler — VS Code and JetBrains settings, linked to
+//! wherever this platform keeps them.
+//!
+//! Editors keep user settings under the OS's application-support
+//! directory, at a path that differs per platform and, for JetBrains,
+//! per installed version. A pack names the editor by directory instead
+//! and dodot works out the rest:
+//!
+//! ```text
+//! editors/vscode/settings.json               → <support>/Code/User/settings.json
+//! editors/vscode/snippets/go.json            → <support>/Code/User/snippets/go.json
+//! editors/jetbrains/IntelliJIdea/keymaps/my.xml
+//!                                            → <support>/JetBrains/IntelliJIdea2024.3/keymaps/my.xml
+//! ```
+//!
+//! `<support>` is `~/Library/Application Support` on macOS and
+//! `$XDG_CONFIG_HOME` elsewhere — the editors' own locations, whatever
+//! `app_uses_library` says for the symlink handler's `_app/`.
+//!
+//! Every file is linked on its own, through the handler's data dir like
+//! symlink's double links: the editor keeps caches and workspace state
+//! next to its settings, so the directory itself is never replaced.
+//!
+//! JetBrains keeps one directory per product and version. A product
+//! directory named without a version (`IntelliJIdea`, `PyCharm`) links
+//! into every version installed when `up` plans, so re-running `up`
+//! after an upgrade covers the new one; a product that isn't installed
+//! is skipped with a warning. A directory named with its version
+//! (`GoLand2024.2`) links into exactly that one.
+//!
+//! User-facing reference: `docs/user/handlers/editors.lex`.
+
+use std::collections::HashMap;
+use std::path::{Path, PathBuf};
+
+use crate::datastore::DataStore;
+use crate::fs::Fs;
+use crate::handlers::undo::{links_into, UndoAction, UndoContext};
+use crate::handlers::{
+    ExecutionPhase, Handler, HandlerConfig, HandlerStatus, MatchMode, HANDLER_EDITORS,
+};
+use crate::operations::HandlerIntent;
+use crate::paths::Pather;
+use crate::rules::RuleMatch;
+use crate::{DodotError, Result};
+
+/// An editor this handler knows where to put settings for.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Editor {
+    /// VS Code or a fork: `<support>/<folder>/User`.
+    VsCode(&'static str),
+    /// JetBrains IDEs: `<support>/JetBrains/<product><version>`.
+    JetBrains,
+}
+
+impl Editor {
+    /// The editor a pack directory name stands for.
+    pub fn for_dir(name: &str) -> Option<Self> {
+        match name {
+            "vscode" => Some(Editor::VsCode("Code")),
+            "vscode-insiders" => Some(Editor::VsCode("Code - Insiders")),
+            "vscodium" => Some(Editor::VsCode("VSCodium")),
+            "cursor" => Some(Editor::VsCode("Cursor")),
+            "jetbrains" => Some(Editor::JetBrains),
+            _ => None,
+        }
+    }
+}
+
+/// Directory names [`Editor::for_dir`] understands.
+pub const EDITOR_DIRS: &[&str] = &[
+    "vscode",
+    "vscode-insiders",
+    "vscodium",
+    "cursor",
+    "jetbrains",
+];
+
+/// Split a JetBrains product directory name into product and version:
+/// `IntelliJIdea2024.1` → (`IntelliJIdea`, `Some("2024.1")`).
+fn split_version(name: &str) -> (&str, Option<&str>) {
+    match name.find(|c: char| c.is_ascii_digit()) {
+        Some(at) if is_version(&name[at..]) => (&name[..at], Some(&name[at..])),
+        _ => (name, None),
+    }
+}
+
+fn is_version(s: &str) -> bool {
+    s.starts_with(|c: char| c.is_ascii_digit()) && s.chars().all(|c| c.is_ascii_digit() || c == '.')
+}
+
+/// Installed versions of JetBrains `product` under `root`, oldest first.
+fn installed_versions(fs: &dyn Fs, root: &Path, product: &str) -> Result<Vec<PathBuf>> {
+    if !fs.is_dir(root) {
+        return Ok(Vec::new());
+    }
+    let mut found: Vec<PathBuf> = fs
+        .read_dir(root)?
+        .into_iter()
+        .filter(|e| {
+            e.is_dir
+                && e.name
+                    .strip_prefix(product)
+                    .is_some_and(|version| is_version(version))
+        })
+        .map(|e| e.path)
+        .collect();
+    found.sort();
+    Ok(found)
+}
+
+/// Every file below `dir`, with its path relative to `dir`, skipping
+/// what the pack ignores.
+fn collect_files(
+    fs: &dyn Fs,
+    root: &Path,
+    dir: &Path,
+    ignore: &[String],
+    out: &mut Vec<(PathBuf, PathBuf)>,
+) -> Result<()> {
+    let mut entries = fs.read_dir(dir)?;
+    entries.sort_by(|a, b| a.name.cmp(&b.name));
+    for entry in entries {
+        if crate::rules::should_skip_entry(&entry.name, ignore) {
+            continue;
+        }
+        if entry.is_dir {
+            collect_files(fs, root, &entry.path, ignore, out)?;
+        } else if let Ok(rel) = entry.path.strip_prefix(root) {
+            out.push((entry.path.clone(), rel.to_path_buf()));
+        }
+    }
+    Ok(())
+}
+
+/// The links one editor directory asks for, as `(source, user_path)`,
+/// plus what couldn't be placed, for warnings.
+struct Plan {
+    links: Vec<(PathBuf, PathBuf)>,
+    skipped: Vec<String>,
+}
+
+pub struct EditorsHandler {
+    /// Whether settings go under `~/Library/Application Support`
+    /// rather than `$XDG_CONFIG_HOME`.
+    macos: bool,
+}
+
+impl EditorsHandler {
+    pub fn new() -> Self {
+        Self {
+            macos: cfg!(target_os = "macos"),
+        }
+    }
+
+    /// A handler for the given platform, whatever this one is.
+    pub fn for_platform(macos: bool) -> Self {
+        Self { macos }
+    }
+
+    /// Where editors keep their settings on this platform.
+    pub fn support_dir(&self, paths: &dyn Pather) -> PathBuf {
+        if self.macos {
+            paths.home_dir().join("Library/Application Support")
+        } else {
+            paths.xdg_config_home().to_path_buf()
+        }
+    }
+
+    fn plan(
+        &self,
+        m: &RuleMatch,
+        config: &HandlerConfig,
+        paths: &dyn Pather,
+        fs: &dyn Fs,
+    ) -> Result<Option<Plan>> {
+        let dir_name = m
+            .relative_path
+            .file_name()
+            .map(|n| n.to_string_lossy().into_owned())
+            .unwrap_or_default();
+        let Some(editor) = Editor::for_dir(&dir_name) else {
+            return Ok(None);
+        };
+        let support = self.support_dir(paths);
+        let mut plan = Plan {
+            links: Vec::new(),
+            skipped: Vec::new(),
+        };
+        match editor {
+            Editor::VsCode(folder) => {
+                let user_dir = support.join(folder).join("User");
+                let mut files = Vec::new();
+                collect_files(
+                    fs,
+                    &m.absolute_path,
+                    &m.absolute_path,
+                    &config.pack_ignore,
+                    &mut files,
+                )?;
+                for (source, rel) in files {
+                    plan.links.push((source, user_dir.join(rel)));
+                }
+            }
+            Editor::JetBrains => {
+                let root = support.join("JetBrains");
+                let mut entries = fs.read_dir(&m.absolute_path)?;
+                entries.sort_by(|a, b| a.name.cmp(&b.name));
+                for entry in entries {
+                    if crate::rules::should_skip_entry(&entry.name, &config.pack_ignore) {
+                        continue;
+                    }
+                    if !entry.is_dir {
+                        plan.skipped.push(format!(
+                            "`{}` is not inside a product directory",
+                            entry.name
+                        ));
+                        continue;
+                    }
+                    let targets = match split_version(&entry.name) {
+                        (_, Some(_)) => vec![root.join(&entry.name)],
+                        (product, None) => installed_versions(fs, &root, product)?,
+                    };
+                    if targets.is_empty() {
+                        plan.skipped.push(format!("no {} is installed", entry.name));
+                        continue;
+                    }
+                    let mut files = Vec::new();
+                    collect_files(
+                        fs,
+                        &entry.path,
+                        &entry.path,
+                        &config.pack_ignore,
+                        &mut files,
+                    )?;
+                    for target in &targets {
+                        for (source, rel) in &files {
+                            plan.links.push((source.clone(), target.join(rel)));
+                        }
+                    }
+                }
+            }
+        }
+        Ok(Some(plan))
+    }
+}
+
+impl Default for EditorsHandler {
+    fn default() -> Self {
+        Self::new()
+    }
+}
+
+impl Handler for EditorsHandler {
+    fn name(&self) -> &str {
+        HANDLER_EDITORS
+    }
+
+    fn phase(&self) -> ExecutionPhase {
+        ExecutionPhase::Link
+    }
+
+    fn match_mode(&self) -> MatchMode {
+        MatchMode::Precise
+    }
+
+    fn to_intents(
+        &self,
+        matches: &[RuleMatch],
+        config: &HandlerConfig,
+        paths: &dyn Pather,
+        fs: &dyn Fs,
+    ) -> Result<Vec<HandlerIntent>> {
+        let mut intents = Vec::new();
+        // Data links are named after the source file, so two different
+        // sources with one name can't both be linked from one pack.
+        let mut by_name: HashMap<std::ffi::OsString, PathBuf> = HashMap::new();
+        for m in matches.iter().filter(|m| m.is_dir) {
+            let Some(plan) = self.plan(m, config, paths, fs)? else {
+                continue;
+            };
+            for (source, user_path) in plan.links {
+                let name = source.file_name().unwrap_or_default().to_os_string();
+                if let Some(other) = by_name.get(&name).filter(|other| **other != source) {
+                    return Err(DodotError::Other(format!(
+                        "pack `{}`: `{}` and `{}` have the same file name; \
+                         the editors handler links one file per name per pack — \
+                         move one of them to another pack",
+                        m.pack,
+                        other.display(),
+                        source.display()
+                    )));
+                }
+                by_name.insert(name, source.clone());
+                intents.push(HandlerIntent::Link {
+                    pack: m.pack.clone(),
+                    handler: HANDLER_EDITORS.into(),
+                    source,
+                    user_path,
+                    mode: config.link_mode,
+                    perms: None,
+                });
+            }
+        }
+        Ok(intents)
+    }
+
+    fn warnings_for_matches(
+        &self,
+        matches: &[RuleMatch],
+        config: &HandlerConfig,
+        paths: &dyn Pather,
+        fs: &dyn Fs,
+    ) -> Vec<String> {
+        let mut warnings = Vec::new();
+        for m in matches.iter().filter(|m| m.is_dir) {
+            let rel = m.relative_path.display();
+            match self.plan(m, config, paths, fs) {
+                Ok(None) => warnings.push(format!(
+                    "warning: pack `{}` has `{rel}`, which is not an editor dodot knows \
+                     ({}); it is ignored",
+                    m.pack,
+                    EDITOR_DIRS.join(", ")
+                )),
+                Ok(Some(plan)) => {
+                    for reason in plan.skipped {
+                        warnings.push(format!(
+                            "warning: pack `{}` skips `{rel}`: {reason}",
+                            m.pack
+                        ));
+                    }
+                }
+                Err(_) => {}
+            }
+        }
+        warnings
+    }
+
+    fn check_status(
+        &self,
+        file: &Path,
+        pack: &str,
+        datastore: &dyn DataStore,
+    ) -> Result<HandlerStatus> {
+        let has_state = datastore.has_handler_state(pack, HANDLER_EDITORS)?;
+        Ok(HandlerStatus {
+            file: file.to_string_lossy().into_owned(),
+            handler: HANDLER_EDITORS.into(),
+            deployed: has_state,
+            message: if has_state {
+                "editor settings linked".into()
+            } else {
+                "editor settings pending".into()
+            },
+        })
+    }
+
+    /// Remove the planned links that still point into this pack's data
+    /// dir, like symlink, then clear the state.
+    fn undo_actions(&self, cx: &UndoContext) -> Result<Vec<UndoAction>> {
+        let mut actions: Vec<UndoAction> = cx
+            .intents
+            .iter()
+            .filter_map(|intent| match intent {
+                HandlerIntent::Link { user_path, .. }
+                    if links_into(cx.fs, user_path, cx.handler_dir) =>
+                {
+                    Some(UndoAction::RemoveUserLink {
+                        path: user_path.clone(),
+                    })
+                }
+                _ => None,
+            })
+            .collect();
+        actions.push(UndoAction::ClearState);
+        Ok(actions)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::testing::TempEnvironment;
+
+    fn editor_match(env: &TempEnvironment, dir: &str) -> RuleMatch {
+        RuleMatch {
+            relative_path: dir.into(),
+            absolute_path: env.dotfiles_root.join("editors").join(dir),
+            pack: "editors".into(),
+            handler: HANDLER_EDITORS.into(),
+            is_dir: true,
+            options: HashMap::new(),
+            preprocessor_source: None,
+            rendered_bytes: None,
+        }
+    }
+
+    fn links(intents: &[HandlerIntent]) -> Vec<(String, PathBuf)> {
+        intents
+            .iter()
+            .map(|i| {
+                let HandlerIntent::Link {
+                    source, user_path, ..
+                } = i
+                else {
+                    panic!("expected Link intent");
+                };
+                (
+                    source.file_name().unwrap().to_string_lossy().into_owned(),
+                    user_path.clone(),
+                )
+            })
+            .collect()
+    }
+
+    #[test]
+    fn vscode_files_link_into_the_platform_user_dir() {
+        let env = TempEnvironment::builder()
+            .pack("editors")
+            .file("vscode/settings.json", "{}")
+            .file("vscode/snippets/go.json", "{}")
+            .file("vscodium/settings.json", "{}")
+            .done()
+            .build();
+        let m = editor_match(&env, "vscode");
+        let config = HandlerConfig::default();
+
+        let linux = EditorsHandler::for_platform(false)
+            .to_intents(&[m.clone()], &config, env.paths.as_ref(), env.fs.as_ref())
+            .unwrap();
+        let user = env.paths.xdg_config_home().join("Code/User");
+        assert_eq!(
+            links(&linux),
+            vec![
+                ("settings.json".into(), user.join("settings.json")),
+                ("go.json".into(), user.join("snippets/go.json")),
+            ]
+        );
+
+        let macos = EditorsHandler::for_platform(true)
+            .to_intents(&[m.clone()], &config, env.paths.as_ref(), env.fs.as_ref())
+            .unwrap();
+        assert_eq!(
+            links(&macos)[0].1,
+            env.home
+                .join("Library/Application Support/Code/User/settings.json")
+        );
+
+        // Both would need the data link `settings.json`.
+        let err = EditorsHandler::for_platform(false)
+            .to_intents(
+                &[m, editor_match(&env, "vscodium")],
+                &config,
+                env.paths.as_ref(),
+                env.fs.as_ref(),
+            )
+            .unwrap_err()
+            .to_string();
+        assert!(err.contains("same file name"), "{err}");
+    }
+
+    #[test]
+    fn jetbrains_products_link_into_every_installed_version() {
+        let env = TempEnvironment::builder()
+            .pack("editors")
+            .file("jetbrains/IntelliJIdea/keymaps/mine.xml", "<keymap/>")
+            .file("jetbrains/GoLand2024.2/options/editor.xml", "<app/>")
+            .file("jetbrains/PyCharm/options/other.xml", "<app/>")
+            .done()
+            .build();
+        let root = env.paths.xdg_config_home().join("JetBrains");
+        for installed in [
+            "IntelliJIdea2024.1",
+            "IntelliJIdea2024.3",
+            "IntelliJIdeaCE2024.3",
+        ] {
+            env.fs.mkdir_all(&root.join(installed)).unwrap();
+        }
+        let m = editor_match(&env, "jetbrains");
+        let handler = EditorsHandler::for_platform(false);
+        let config = HandlerConfig::default();
+
+        let intents = handler
+            .to_intents(&[m.clone()], &config, env.paths.as_ref(), env.fs.as_ref())
+            .unwrap();
+        let targets: Vec<PathBuf> = links(&intents).into_iter().map(|(_, p)| p).collect();
+        assert_eq!(
+            targets,
+            vec![
+                root.join("GoLand2024.2/options/editor.xml"),
+                root.join("IntelliJIdea2024.1/keymaps/mine.xml"),
+                root.join("IntelliJIdea2024.3/keymaps/mine.xml"),
+            ]
+        );
+
+        let warnings =
+            handler.warnings_for_matches(&[m], &config, env.paths.as_ref(), env.fs.as_ref());
+        assert_eq!(warnings.len(), 1, "{warnings:?}");
+        assert!(
+            warnings[0].contains("no PyCharm is installed"),
+            "{warnings:?}"
+        );
+    }
+}
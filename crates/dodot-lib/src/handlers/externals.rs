@@ -53,23 +53,8 @@ impl Handler for ExternalsHandler {
             if m.is_dir {
                 continue;
             }
-            let bytes = match m.rendered_bytes.as_deref() {
-                Some(b) => b.to_vec(),
-                None => match fs.read_file(&m.absolute_path) {
-                    Ok(b) => b,
-                    Err(_) => {
-                        // Same posture as install handler's first-time
-                        // passive placeholder: skip silently and let
-                        // status surface "pending" through the symlink
-                        // chain.
-                        tracing::debug!(
-                            pack = %m.pack,
-                            file = %m.absolute_path.display(),
-                            "externals.toml unreadable; skipping intent planning"
-                        );
-                        continue;
-                    }
-                },
+            let Some(bytes) = super::manifest_bytes(m, fs) else {
+                continue;
             };
 
             let parsed = crate::external::parse_externals_toml(&bytes)?;
@@ -0,0 +1,364 @@
+//! Gitconfig handler — adds pack fragments to git's config through
+//! `include.path` instead of symlinking one whole `~/.gitconfig`.
+//!
+//! Any number of packs can ship a fragment (`git/core.gitinclude`,
+//! `work/identity.gitinclude`). Each is staged in the datastore like a
+//! shell script; [`write_includes`] then rewrites one marker-delimited
+//! block in the user's git config listing every staged fragment:
+//!
+//! ```text
+//! # >>> dodot managed includes >>>
+//! [include]
+//! 	path = "/home/alice/.local/share/dodot/packs/git/gitconfig/core.gitinclude"
+//! # <<< dodot managed includes <<<
+//! ```
+//!
+//! Everything outside the block is the user's and is never touched.
+//! The block is rebuilt on every `up` / `down`, so a fragment that
+//! leaves its pack drops out of git's view, and the block goes away
+//! entirely once nothing is staged.
+//!
+//! The block goes into `~/.gitconfig`, unless that file is a symlink
+//! (typically a pack's own gitconfig linked in by the symlink handler
+//! — writing through it would edit the pack). Then it goes into
+//! `$XDG_CONFIG_HOME/git/config`, which git also reads.
+
+use std::fmt::Write;
+use std::path::{Path, PathBuf};
+
+use crate::datastore::DataStore;
+use crate::fs::Fs;
+use crate::handlers::{ExecutionPhase, Handler, HandlerConfig, HandlerStatus, HANDLER_GITCONFIG};
+use crate::operations::HandlerIntent;
+use crate::paths::Pather;
+use crate::rules::RuleMatch;
+use crate::{DodotError, Result};
+
+/// First line of the managed block.
+pub const BLOCK_START: &str = "# >>> dodot managed includes >>>";
+/// Last line of the managed block.
+pub const BLOCK_END: &str = "# <<< dodot managed includes <<<";
+
+pub struct GitconfigHandler;
+
+impl Handler for GitconfigHandler {
+    fn name(&self) -> &str {
+        HANDLER_GITCONFIG
+    }
+
+    /// Shares the shell handler's slot: both stage files and then
+    /// regenerate one shared artifact from the datastore, and both are
+    /// configuration — wiped and re-staged on every `up`.
+    fn phase(&self) -> ExecutionPhase {
+        ExecutionPhase::ShellInit
+    }
+
+    fn to_intents(
+        &self,
+        matches: &[RuleMatch],
+        _config: &HandlerConfig,
+        _paths: &dyn Pather,
+        _fs: &dyn Fs,
+    ) -> Result<Vec<HandlerIntent>> {
+        Ok(matches
+            .iter()
+            .filter(|m| !m.is_dir)
+            .map(|m| HandlerIntent::Stage {
+                pack: m.pack.clone(),
+                handler: HANDLER_GITCONFIG.into(),
+                source: m.absolute_path.clone(),
+            })
+            .collect())
+    }
+
+    fn check_status(
+        &self,
+        file: &Path,
+        pack: &str,
+        datastore: &dyn DataStore,
+    ) -> Result<HandlerStatus> {
+        let has_state = datastore.has_handler_state(pack, HANDLER_GITCONFIG)?;
+        Ok(HandlerStatus {
+            file: file.to_string_lossy().into_owned(),
+            handler: HANDLER_GITCONFIG.into(),
+            deployed: has_state,
+            message: if has_state {
+                "included in gitconfig".into()
+            } else {
+                "not included in gitconfig".into()
+            },
+        })
+    }
+}
+
+/// The config files git reads that dodot may write its block into, in
+/// order of preference.
+fn candidates(paths: &dyn Pather) -> [PathBuf; 2] {
+    [
+        paths.home_dir().join(".gitconfig"),
+        paths.xdg_config_home().join("git").join("config"),
+    ]
+}
+
+/// Whether writing `path` would land in a file dodot doesn't own
+/// outright — the file or its directory is a link into a pack.
+fn is_linked(fs: &dyn Fs, path: &Path) -> bool {
+    fs.is_symlink(path) || path.parent().is_some_and(|dir| fs.is_symlink(dir))
+}
+
+/// Every staged fragment, as datastore link paths, sorted by pack and
+/// file name so the block is stable across runs.
+pub fn staged_fragments(fs: &dyn Fs, paths: &dyn Pather) -> Result<Vec<PathBuf>> {
+    let packs_dir = paths.data_dir().join("packs");
+    if !fs.exists(&packs_dir) {
+        return Ok(Vec::new());
+    }
+    let mut packs = fs.read_dir(&packs_dir)?;
+    packs.sort_by(|a, b| a.name.cmp(&b.name));
+
+    let mut fragments = Vec::new();
+    for pack in packs.iter().filter(|p| p.is_dir) {
+        let dir = paths.handler_data_dir(&pack.name, HANDLER_GITCONFIG);
+        if !fs.is_dir(&dir) {
+            continue;
+        }
+        let mut entries = fs.read_dir(&dir)?;
+        entries.sort_by(|a, b| a.name.cmp(&b.name));
+        fragments.extend(entries.into_iter().filter(|e| e.is_symlink).map(|e| e.path));
+    }
+    Ok(fragments)
+}
+
+/// The block's `path = …` line for `fragment`, without indentation.
+pub fn include_line(fragment: &Path) -> String {
+    let value = fragment
+        .display()
+        .to_string()
+        .replace('\\', "\\\\")
+        .replace('"', "\\\"");
+    format!("path = \"{value}\"")
+}
+
+/// Where the managed block goes: `~/.gitconfig`, or git's XDG config
+/// when that is a link into a pack. `None` when both are.
+pub fn include_file(fs: &dyn Fs, paths: &dyn Pather) -> Option<PathBuf> {
+    candidates(paths)
+        .into_iter()
+        .find(|candidate| !is_linked(fs, candidate))
+}
+
+/// Whether git's config already includes `fragment` — in dodot's block
+/// or added by hand.
+pub fn is_included(fs: &dyn Fs, paths: &dyn Pather, fragment: &Path) -> bool {
+    let line = include_line(fragment);
+    candidates(paths).iter().any(|candidate| {
+        fs.read_to_string(candidate)
+            .is_ok_and(|content| content.lines().any(|l| l.trim() == line))
+    })
+}
+
+/// The managed block for `fragments`, trailing newline included.
+fn render_block(fragments: &[PathBuf]) -> String {
+    let mut block = String::new();
+    writeln!(block, "{BLOCK_START}").unwrap();
+    writeln!(block, "[include]").unwrap();
+    for fragment in fragments {
+        writeln!(block, "\t{}", include_line(fragment)).unwrap();
+    }
+    writeln!(block, "{BLOCK_END}").unwrap();
+    block
+}
+
+/// `content` with the managed block removed, and whether there was one.
+/// An unterminated block (someone deleted the end marker) runs to the
+/// end of the file.
+fn strip_block(content: &str) -> (String, bool) {
+    let mut kept = String::with_capacity(content.len());
+    let mut inside = false;
+    let mut found = false;
+    for line in content.split_inclusive('\n') {
+        let trimmed = line.trim_end();
+        if !inside && trimmed == BLOCK_START {
+            inside = true;
+            found = true;
+        } else if inside && trimmed == BLOCK_END {
+            inside = false;
+        } else if !inside {
+            kept.push_str(line);
+        }
+    }
+    (kept, found)
+}
+
+/// Bring the managed include block in line with the datastore: write
+/// it (replacing any previous one) when fragments are staged, remove it
+/// when none are. Returns the file holding the block, if any.
+///
+/// A file left empty by removing the block is deleted — dodot created
+/// it. A stale block in the other candidate (left from before
+/// `~/.gitconfig` became a link) is removed too.
+pub fn write_includes(fs: &dyn Fs, paths: &dyn Pather) -> Result<Option<PathBuf>> {
+    let fragments = staged_fragments(fs, paths)?;
+    let [home, xdg] = candidates(paths);
+
+    let target = if fragments.is_empty() {
+        None
+    } else if let Some(file) = include_file(fs, paths) {
+        Some(file)
+    } else {
+        return Err(DodotError::Other(format!(
+            "gitconfig: both {} and {} are symlinks; dodot won't write \
+             its include block through a link into a pack",
+            home.display(),
+            xdg.display()
+        )));
+    };
+
+    for candidate in [&home, &xdg] {
+        if target.as_ref() == Some(candidate) || is_linked(fs, candidate) {
+            continue;
+        }
+        if !fs.exists(candidate) {
+            continue;
+        }
+        let content = fs.read_to_string(candidate)?;
+        let (kept, found) = strip_block(&content);
+        if !found {
+            continue;
+        }
+        if kept.trim().is_empty() {
+            fs.remove_file(candidate)?;
+        } else {
+            fs.write_file_atomic(candidate, kept.as_bytes())?;
+        }
+    }
+
+    let Some(target) = target else {
+        return Ok(None);
+    };
+    let existing = if fs.exists(&target) {
+        fs.read_to_string(&target)?
+    } else {
+        String::new()
+    };
+    let (mut updated, _) = strip_block(&existing);
+    if !updated.is_empty() && !updated.ends_with('\n') {
+        updated.push('\n');
+    }
+    updated.push_str(&render_block(&fragments));
+    if updated != existing {
+        if let Some(parent) = target.parent() {
+            fs.mkdir_all(parent)?;
+        }
+        fs.write_file_atomic(&target, updated.as_bytes())?;
+    }
+    Ok(Some(target))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::datastore::{FilesystemDataStore, NoopCommandRunner};
+    use crate::testing::TempEnvironment;
+    use std::sync::Arc;
+
+    #[test]
+    fn name_and_phase_identity() {
+        assert_eq!(GitconfigHandler.name(), HANDLER_GITCONFIG);
+        assert_eq!(GitconfigHandler.phase(), ExecutionPhase::ShellInit);
+    }
+
+    #[test]
+    fn include_block_tracks_staged_fragments_and_keeps_user_lines() {
+        let env = TempEnvironment::builder()
+            .pack("git")
+            .file("core.gitinclude", "[core]\n\tautocrlf = input\n")
+            .done()
+            .pack("work")
+            .file("identity.gitinclude", "[user]\n\temail = me@work\n")
+            .done()
+            .home_file(".gitconfig", "[user]\n\tname = Me\n")
+            .build();
+        let ds = FilesystemDataStore::new(
+            env.fs.clone(),
+            env.paths.clone(),
+            Arc::new(NoopCommandRunner),
+        );
+        let core = env.dotfiles_root.join("git/core.gitinclude");
+        let identity = env.dotfiles_root.join("work/identity.gitinclude");
+        ds.create_data_link("git", HANDLER_GITCONFIG, &core)
+            .unwrap();
+        ds.create_data_link("work", HANDLER_GITCONFIG, &identity)
+            .unwrap();
+
+        let gitconfig = env.home.join(".gitconfig");
+        let written = write_includes(env.fs.as_ref(), env.paths.as_ref()).unwrap();
+        assert_eq!(written.as_deref(), Some(gitconfig.as_path()));
+        let content = env.fs.read_to_string(&gitconfig).unwrap();
+        assert!(content.starts_with("[user]\n\tname = Me\n"), "{content}");
+        let core_line = content.find("git/gitconfig/core.gitinclude").unwrap();
+        let identity_line = content.find("work/gitconfig/identity.gitinclude").unwrap();
+        assert!(core_line < identity_line);
+
+        // Rewriting replaces the block rather than appending a second.
+        write_includes(env.fs.as_ref(), env.paths.as_ref()).unwrap();
+        let again = env.fs.read_to_string(&gitconfig).unwrap();
+        assert_eq!(again, content);
+
+        ds.remove_state("work", HANDLER_GITCONFIG).unwrap();
+        write_includes(env.fs.as_ref(), env.paths.as_ref()).unwrap();
+        let content = env.fs.read_to_string(&gitconfig).unwrap();
+        assert!(!content.contains("identity.gitinclude"));
+        assert_eq!(content.matches(BLOCK_START).count(), 1);
+
+        ds.remove_state("git", HANDLER_GITCONFIG).unwrap();
+        assert_eq!(
+            write_includes(env.fs.as_ref(), env.paths.as_ref()).unwrap(),
+            None
+        );
+        assert_eq!(
+            env.fs.read_to_string(&gitconfig).unwrap(),
+            "[user]\n\tname = Me\n"
+        );
+    }
+
+    #[test]
+    fn linked_home_gitconfig_sends_the_block_to_xdg_and_empty_files_go_away() {
+        let env = TempEnvironment::builder()
+            .pack("git")
+            .file("gitconfig", "[user]\n\tname = Me\n")
+            .file("core.gitinclude", "[core]\n")
+            .done()
+            .build();
+        let gitconfig = env.home.join(".gitconfig");
+        env.fs
+            .symlink(&env.dotfiles_root.join("git/gitconfig"), &gitconfig)
+            .unwrap();
+        let ds = FilesystemDataStore::new(
+            env.fs.clone(),
+            env.paths.clone(),
+            Arc::new(NoopCommandRunner),
+        );
+        ds.create_data_link(
+            "git",
+            HANDLER_GITCONFIG,
+            &env.dotfiles_root.join("git/core.gitinclude"),
+        )
+        .unwrap();
+
+        let xdg = env.paths.xdg_config_home().join("git/config");
+        let written = write_includes(env.fs.as_ref(), env.paths.as_ref()).unwrap();
+        assert_eq!(written.as_deref(), Some(xdg.as_path()));
+        assert!(env.fs.read_to_string(&xdg).unwrap().contains(BLOCK_START));
+        assert_eq!(
+            env.fs
+                .read_to_string(&env.dotfiles_root.join("git/gitconfig"))
+                .unwrap(),
+            "[user]\n\tname = Me\n"
+        );
+
+        ds.remove_state("git", HANDLER_GITCONFIG).unwrap();
+        write_includes(env.fs.as_ref(), env.paths.as_ref()).unwrap();
+        assert!(!env.fs.exists(&xdg));
+    }
+}
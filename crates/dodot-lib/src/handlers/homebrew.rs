@@ -5,11 +5,56 @@
 //! [`crate::handlers::run_once::RunOnceHandler`]. This module supplies
 //! the [`BrewfileCommand`] specialization: program name (`brew`) and
 //! argument shape (`bundle --file <path>`).
+//!
+//! **Lockfile pins.** `brew bundle` writes `Brewfile.lock.json` next to
+//! the Brewfile it installs from. Once that file is committed to the
+//! pack, dodot adds `--no-upgrade` so a new machine installs what is
+//! already pinned instead of upgrading everything the Brewfile names.
+//! `dodot provision --upgrade` drops the flag for one run, letting brew
+//! upgrade and rewrite the pins. The sentinel still hashes the Brewfile
+//! alone: pulling a new lockfile doesn't re-run the bundle on its own.
+//!
+//! **Partial progress.** A `brew bundle` that fails halfway has still
+//! installed some entries. dodot reads the bundle's output to tell
+//! which, and records them:
+//!
+//! ```text
+//! <data_dir>/packs/<pack>/homebrew-progress/<Brewfile>.json
+//! ```
+//!
+//! The next run of the same Brewfile content passes the installed
+//! entries to brew's `HOMEBREW_BUNDLE_*_SKIP` variables so only the
+//! failed and never-reached ones are retried, and `dodot status` shows
+//! which entries failed. A successful run drops the record; an edited
+//! Brewfile ignores it.
+//!
+//! **Installed check.** The sentinel says a Brewfile ran, not that its
+//! packages are still there. `dodot status --check-drift` also reads
+//! the Brewfile's `brew` and `cask` lines and looks each one up in the
+//! Homebrew prefix — `opt/<name>` or `Cellar/<name>` for a formula,
+//! `Caskroom/<name>` for a cask, the directories brew's own receipts
+//! live in — so it can name the missing ones without running
+//! `brew bundle` (see [`missing_from_prefix`]).
+//!
+//! **Prerequisites.** Some Brewfile entries fail for reasons brew
+//! reports badly, deep into a long bundle: `mas` entries without `mas`
+//! installed or without an App Store sign-in, and casks whose package
+//! installer asks for an administrator password when nothing can type
+//! one. `up`'s pre-flight asks [`bundle_prerequisites`] about each
+//! Brewfile that will run, so these stop the run before it starts,
+//! with what to do about them.
 
-use std::path::Path;
+use std::collections::HashSet;
+use std::path::{Path, PathBuf};
 
+use serde::{Deserialize, Serialize};
+
+use crate::datastore::CommandRunner;
+use crate::fs::Fs;
 use crate::handlers::run_once::RunOnceCommand;
 use crate::handlers::{ExecutionPhase, HANDLER_HOMEBREW};
+use crate::paths::Pather;
+use crate::{DodotError, Result};
 
 /// [`RunOnceCommand`] for the `homebrew` handler.
 ///
@@ -41,6 +86,47 @@ impl RunOnceCommand for BrewfileCommand {
         )
     }
 
+    fn sibling_arguments(&self, fs: &dyn Fs, path: &Path) -> Vec<String> {
+        if fs.exists(&lockfile_for(path)) {
+            vec![NO_UPGRADE.into()]
+        } else {
+            Vec::new()
+        }
+    }
+
+    /// `brew uninstall` everything the Brewfile declares — formulae
+    /// and casks separately, since brew won't mix them in one call.
+    /// Packages another Brewfile also lists are uninstalled too; brew
+    /// refuses to remove formulae other installed formulae depend on.
+    fn undo_commands(
+        &self,
+        runner: &dyn CommandRunner,
+        path: &Path,
+    ) -> Result<Vec<(String, Vec<String>)>> {
+        let brewfile = path.to_string_lossy().into_owned();
+        let mut commands = Vec::new();
+        for kind in ["--formula", "--cask"] {
+            let listed = runner.run(
+                "brew",
+                &["bundle", "list", "--file", brewfile.as_str(), kind].map(String::from),
+            )?;
+            let names: Vec<String> = listed
+                .stdout
+                .lines()
+                .map(str::trim)
+                .filter(|l| !l.is_empty())
+                .map(String::from)
+                .collect();
+            if names.is_empty() {
+                continue;
+            }
+            let mut arguments = vec!["uninstall".to_string(), kind.to_string()];
+            arguments.extend(names);
+            commands.push(("brew".to_string(), arguments));
+        }
+        Ok(commands)
+    }
+
     fn status_deployed(&self) -> &str {
         "brew packages installed"
     }
@@ -54,6 +140,485 @@ impl RunOnceCommand for BrewfileCommand {
     }
 }
 
+/// `brew bundle` flag that keeps installed formulae at their current
+/// (pinned) versions.
+pub const NO_UPGRADE: &str = "--no-upgrade";
+
+/// The Brewfile a `brew bundle` command line runs: the value of its
+/// `--file` option, wherever other flags put it.
+pub fn brewfile_argument(arguments: &[String]) -> Option<&str> {
+    let at = arguments.iter().position(|a| a == "--file")?;
+    arguments.get(at + 1).map(String::as_str)
+}
+
+/// The lockfile `brew bundle` keeps next to `brewfile`:
+/// `Brewfile` → `Brewfile.lock.json`.
+pub fn lockfile_for(brewfile: &Path) -> PathBuf {
+    let mut name = brewfile.file_name().unwrap_or_default().to_os_string();
+    name.push(".lock.json");
+    brewfile.with_file_name(name)
+}
+
+/// Datastore subdirectory holding partial-progress records, alongside
+/// the handler directories.
+pub const PROGRESS_DIR: &str = "homebrew-progress";
+
+/// `brew bundle` skip lists the installed entries are passed through.
+/// An entry name in the wrong list is ignored by brew, so every list
+/// gets every name rather than dodot guessing each entry's kind.
+const SKIP_VARIABLES: &[&str] = &[
+    "HOMEBREW_BUNDLE_TAP_SKIP",
+    "HOMEBREW_BUNDLE_BREW_SKIP",
+    "HOMEBREW_BUNDLE_CASK_SKIP",
+];
+
+/// What a failed `brew bundle` got done before it stopped.
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize, Deserialize)]
+pub struct BundleProgress {
+    /// Checksum of the Brewfile content the run was for.
+    pub content_hash: String,
+    /// Entries brew reported as installed, already present or skipped.
+    pub installed: Vec<String>,
+    /// Entries brew reported as failed.
+    pub failed: Vec<String>,
+}
+
+impl BundleProgress {
+    /// Read `brew bundle`'s per-entry lines (`Using x`, `Installing x`,
+    /// `Tapping x`, `Installing x has failed!`, …). An entry counts as
+    /// installed once it's named without failing. Entries a previous
+    /// run already installed are carried over from `previous`.
+    pub fn from_output(stdout: &str, content_hash: &str, previous: Option<&Self>) -> Self {
+        let mut progress = Self {
+            content_hash: content_hash.to_string(),
+            ..Self::default()
+        };
+        let mut named = Vec::new();
+        for line in stdout.lines().map(str::trim) {
+            match line.strip_suffix(" has failed!") {
+                Some(rest) => {
+                    if let Some(name) = bundle_entry(rest) {
+                        push_unique(&mut progress.failed, name);
+                    }
+                }
+                None => {
+                    if let Some(name) = bundle_entry(line) {
+                        push_unique(&mut named, name);
+                    }
+                }
+            }
+        }
+        let carried = previous
+            .filter(|p| p.content_hash == content_hash)
+            .map(|p| p.installed.clone())
+            .unwrap_or_default();
+        for name in carried.into_iter().chain(named) {
+            if !progress.failed.contains(&name) {
+                push_unique(&mut progress.installed, name);
+            }
+        }
+        progress
+    }
+
+    /// Whether this record describes the Brewfile content `hash`.
+    pub fn applies_to(&self, hash: &str) -> bool {
+        self.content_hash == hash
+    }
+}
+
+/// The entry name in one `brew bundle` progress line, if it is one.
+fn bundle_entry(line: &str) -> Option<String> {
+    let rest = [
+        "Using ",
+        "Installing ",
+        "Upgrading ",
+        "Tapping ",
+        "Skipping ",
+    ]
+    .iter()
+    .find_map(|verb| line.strip_prefix(verb))?;
+    // `Skipping x (on skip list)` and friends carry a parenthetical.
+    let name = rest.split(" (").next().unwrap_or(rest).trim();
+    (!name.is_empty()).then(|| name.to_string())
+}
+
+fn push_unique(list: &mut Vec<String>, name: String) {
+    if !list.contains(&name) {
+        list.push(name);
+    }
+}
+
+fn progress_path(paths: &dyn Pather, pack: &str, filename: &str) -> PathBuf {
+    paths
+        .handler_data_dir(pack, PROGRESS_DIR)
+        .join(format!("{filename}.json"))
+}
+
+/// Replace the progress record for `filename` in `pack` (on-disk name).
+pub fn write_progress(
+    fs: &dyn Fs,
+    paths: &dyn Pather,
+    pack: &str,
+    filename: &str,
+    progress: &BundleProgress,
+) -> Result<()> {
+    let path = progress_path(paths, pack, filename);
+    if let Some(parent) = path.parent() {
+        fs.mkdir_all(parent)?;
+    }
+    let body = serde_json::to_string_pretty(progress)
+        .map_err(|e| DodotError::Other(format!("brew progress serialization failed: {e}")))?;
+    fs.write_file_atomic(&path, body.as_bytes())
+}
+
+/// The progress record for `filename` in `pack`. Missing or unreadable
+/// reads as `None`, the same as "no failed run".
+pub fn load_progress(
+    fs: &dyn Fs,
+    paths: &dyn Pather,
+    pack: &str,
+    filename: &str,
+) -> Option<BundleProgress> {
+    let text = fs
+        .read_to_string(&progress_path(paths, pack, filename))
+        .ok()?;
+    serde_json::from_str(&text).ok()
+}
+
+/// Drop the progress record for `filename` in `pack`, after a run that
+/// got everything done.
+pub fn clear_progress(fs: &dyn Fs, paths: &dyn Pather, pack: &str, filename: &str) -> Result<()> {
+    let path = progress_path(paths, pack, filename);
+    if fs.exists(&path) {
+        fs.remove_file(&path)?;
+    }
+    Ok(())
+}
+
+/// The command for a `brew bundle` run intent, resuming from
+/// `progress` when it describes the same Brewfile content: the
+/// installed entries go to brew's skip lists through `env`. The
+/// Brewfile stays the last argument.
+pub fn resume_command(
+    executable: &str,
+    arguments: &[String],
+    progress: Option<&BundleProgress>,
+    content_hash: &str,
+) -> (String, Vec<String>) {
+    let Some(progress) = progress.filter(|p| p.applies_to(content_hash) && !p.installed.is_empty())
+    else {
+        return (executable.to_string(), arguments.to_vec());
+    };
+    let names = progress.installed.join(" ");
+    let mut wrapped: Vec<String> = SKIP_VARIABLES
+        .iter()
+        .map(|var| format!("{var}={names}"))
+        .collect();
+    wrapped.push(executable.to_string());
+    wrapped.extend(arguments.iter().cloned());
+    ("env".to_string(), wrapped)
+}
+
+/// Update `filename`'s progress record from the outcome of a run:
+/// cleared on success, rewritten from brew's output on failure.
+/// Best-effort — the run's own result is what the caller reports.
+pub fn record_outcome(
+    fs: &dyn Fs,
+    paths: &dyn Pather,
+    pack: &str,
+    filename: &str,
+    content_hash: &str,
+    outcome: &Result<()>,
+) {
+    let written = match outcome {
+        Ok(()) => clear_progress(fs, paths, pack, filename),
+        Err(DodotError::CommandFailed { stdout, .. }) => {
+            let previous = load_progress(fs, paths, pack, filename);
+            let progress = BundleProgress::from_output(stdout, content_hash, previous.as_ref());
+            write_progress(fs, paths, pack, filename, &progress)
+        }
+        Err(_) => Ok(()),
+    };
+    if let Err(e) = written {
+        tracing::warn!(pack, filename, error = %e, "brew progress record not updated");
+    }
+}
+
+/// Default Homebrew prefixes: Apple silicon, Intel macOS, Linux.
+const DEFAULT_PREFIXES: &[&str] = &["/opt/homebrew", "/usr/local", "/home/linuxbrew/.linuxbrew"];
+
+/// One `brew` or `cask` line of a Brewfile.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct DeclaredPackage {
+    /// As written, possibly tap-qualified (`user/tap/tool`).
+    pub name: String,
+    pub cask: bool,
+}
+
+impl DeclaredPackage {
+    /// The name brew installs it under: the last segment of a
+    /// tap-qualified name.
+    pub fn short_name(&self) -> &str {
+        self.name.rsplit('/').next().unwrap_or(&self.name)
+    }
+
+    /// How status lists it: casks carry a `(cask)` suffix, as in
+    /// [`missing_entries`].
+    pub fn display(&self) -> String {
+        if self.cask {
+            format!("{} (cask)", self.name)
+        } else {
+            self.name.clone()
+        }
+    }
+}
+
+/// The formulae and casks a Brewfile declares, in order. Only the
+/// plain `brew "name"` / `cask "name"` form is read (options after the
+/// name are fine); `tap`, `mas`, `vscode` and Ruby logic are skipped,
+/// so the result can miss entries but never invents one.
+pub fn declared_packages(brewfile: &str) -> Vec<DeclaredPackage> {
+    brewfile
+        .lines()
+        .filter_map(|line| {
+            let line = line.trim();
+            let (cask, rest) = if let Some(rest) = line.strip_prefix("brew ") {
+                (false, rest)
+            } else if let Some(rest) = line.strip_prefix("cask ") {
+                (true, rest)
+            } else {
+                return None;
+            };
+            let rest = rest.trim_start();
+            let quote = rest.chars().next().filter(|c| *c == '"' || *c == '\'')?;
+            let name = rest[1..].split(quote).next()?;
+            (!name.is_empty() && rest[1..].len() > name.len()).then(|| DeclaredPackage {
+                name: name.to_string(),
+                cask,
+            })
+        })
+        .collect()
+}
+
+/// The app names of a Brewfile's `mas "Name", id: 123` lines, in
+/// order.
+pub fn declared_mas_apps(brewfile: &str) -> Vec<String> {
+    brewfile
+        .lines()
+        .filter_map(|line| {
+            let rest = line.trim().strip_prefix("mas ")?.trim_start();
+            let quote = rest.chars().next().filter(|c| *c == '"' || *c == '\'')?;
+            let name = rest[1..].split(quote).next()?;
+            (!name.is_empty()).then(|| name.to_string())
+        })
+        .collect()
+}
+
+/// What [`bundle_prerequisites`] may assume about this run.
+#[derive(Debug, Clone, Copy)]
+pub struct BundleHost {
+    /// `mas` and casks only exist on macOS; elsewhere brew skips them.
+    pub macos: bool,
+    /// Whether a password prompt would reach a person.
+    pub interactive: bool,
+}
+
+impl BundleHost {
+    pub fn current() -> Self {
+        use std::io::IsTerminal;
+        Self {
+            macos: cfg!(target_os = "macos"),
+            interactive: std::io::stdin().is_terminal(),
+        }
+    }
+}
+
+/// Why `brew bundle` can't install `brewfile` (its content) on this
+/// machine, one actionable line per reason. Checks the App Store
+/// entries — `mas` installed (or declared in the same Brewfile), an
+/// account signed in where `mas account` can still tell — and, for a
+/// run that can't prompt, casks missing from `prefix` whose package
+/// installers need `sudo` while no cached credentials exist.
+/// Questions brew can't answer are skipped rather than guessed.
+pub fn bundle_prerequisites(
+    fs: &dyn Fs,
+    runner: &dyn CommandRunner,
+    prefix: Option<&Path>,
+    brewfile: &str,
+    host: BundleHost,
+) -> Vec<String> {
+    if !host.macos {
+        return Vec::new();
+    }
+    let mut problems = Vec::new();
+
+    let apps = declared_mas_apps(brewfile);
+    if !apps.is_empty() {
+        let declares_mas = declared_packages(brewfile)
+            .iter()
+            .any(|p| !p.cask && p.short_name() == "mas");
+        if runner.find_executable("mas").is_none() {
+            if !declares_mas {
+                problems.push(format!(
+                    "App Store apps ({}) need `mas`, which is not installed: \
+                     add `brew \"mas\"` to the Brewfile or run `brew install mas`",
+                    apps.join(", ")
+                ));
+            }
+        } else if let Err(DodotError::CommandFailed { stdout, stderr, .. }) =
+            runner.run("mas", &["account".to_string()])
+        {
+            // Newer macOS versions can't report the account at all;
+            // only a definite "not signed in" is a problem.
+            if format!("{stdout}{stderr}")
+                .to_lowercase()
+                .contains("not signed in")
+            {
+                problems.push(format!(
+                    "App Store apps ({}) need an App Store account: \
+                     sign in from the App Store app first",
+                    apps.join(", ")
+                ));
+            }
+        }
+    }
+
+    if !host.interactive {
+        let pending: Vec<String> = match prefix {
+            Some(prefix) => declared_packages(brewfile)
+                .into_iter()
+                .filter(|p| p.cask && !fs.exists(&prefix.join("Caskroom").join(p.short_name())))
+                .map(|p| p.name)
+                .collect(),
+            None => Vec::new(),
+        };
+        let needs_sudo = casks_needing_sudo(runner, &pending);
+        if !needs_sudo.is_empty() && runner.run("sudo", &["-n".into(), "true".into()]).is_err() {
+            problems.push(format!(
+                "casks {} run package installers that ask for an administrator \
+                 password, and this run can't prompt: run `sudo -v` first, \
+                 or run `dodot up` from a terminal",
+                needs_sudo.join(", ")
+            ));
+        }
+    }
+    problems
+}
+
+/// The casks among `names` whose install runs a `.pkg` installer (the
+/// `pkg` or `installer` artifacts), which needs `sudo`. From
+/// `brew info --cask --json=v2`; empty when brew can't say.
+fn casks_needing_sudo(runner: &dyn CommandRunner, names: &[String]) -> Vec<String> {
+    if names.is_empty() {
+        return Vec::new();
+    }
+    let mut args = vec!["info".to_string(), "--cask".into(), "--json=v2".into()];
+    args.extend(names.iter().cloned());
+    let Ok(out) = runner.run("brew", &args) else {
+        return Vec::new();
+    };
+    let Ok(info) = serde_json::from_str::<serde_json::Value>(&out.stdout) else {
+        return Vec::new();
+    };
+    info["casks"]
+        .as_array()
+        .into_iter()
+        .flatten()
+        .filter(|cask| {
+            cask["artifacts"].as_array().is_some_and(|artifacts| {
+                artifacts.iter().any(|a| {
+                    a.as_object()
+                        .is_some_and(|o| o.contains_key("pkg") || o.contains_key("installer"))
+                })
+            })
+        })
+        .filter_map(|cask| cask["token"].as_str().map(str::to_string))
+        .collect()
+}
+
+/// The Homebrew prefix: `$HOMEBREW_PREFIX`, else the first default
+/// prefix with a `Cellar`, else what `brew --prefix` prints. `None`
+/// when brew isn't installed.
+pub fn brew_prefix(fs: &dyn Fs, runner: &dyn CommandRunner) -> Option<PathBuf> {
+    if let Some(prefix) = std::env::var_os("HOMEBREW_PREFIX").filter(|p| !p.is_empty()) {
+        return Some(PathBuf::from(prefix));
+    }
+    if let Some(prefix) = DEFAULT_PREFIXES
+        .iter()
+        .map(PathBuf::from)
+        .find(|p| fs.is_dir(&p.join("Cellar")))
+    {
+        return Some(prefix);
+    }
+    let out = runner.run("brew", &["--prefix".to_string()]).ok()?;
+    let prefix = out.stdout.trim();
+    (!prefix.is_empty()).then(|| PathBuf::from(prefix))
+}
+
+/// Declared packages with no install under `prefix`, as
+/// [`DeclaredPackage::display`] names. `opt/` also holds a link per
+/// formula alias, so `brew "python"` is found when `python@3.12` is
+/// installed.
+pub fn missing_from_prefix(fs: &dyn Fs, prefix: &Path, brewfile: &str) -> Vec<String> {
+    declared_packages(brewfile)
+        .into_iter()
+        .filter(|p| {
+            let name = p.short_name();
+            let installed = if p.cask {
+                fs.exists(&prefix.join("Caskroom").join(name))
+            } else {
+                fs.exists(&prefix.join("opt").join(name))
+                    || fs.exists(&prefix.join("Cellar").join(name))
+            };
+            !installed
+        })
+        .map(|p| p.display())
+        .collect()
+}
+
+/// Brewfile entries that aren't installed yet, for dry-run reporting.
+///
+/// Asks `brew bundle check` first: exit 0 means nothing is missing.
+/// On a non-zero exit we can't read its verbose listing (the runner
+/// drops stdout for failed commands), so the missing set is computed
+/// by diffing `brew bundle list` against `brew list` for formulae and
+/// casks. Tap-qualified names (`user/tap/tool`) compare by their last
+/// segment, matching what `brew list` prints. Casks come back as
+/// `"<name> (cask)"`.
+///
+/// A spawn failure (brew not on PATH) is returned as an error so the
+/// caller can fall back to a plain "would run" line.
+pub fn missing_entries(runner: &dyn CommandRunner, brewfile: &str) -> Result<Vec<String>> {
+    let check = ["bundle", "check", "--no-upgrade", "--file", brewfile].map(String::from);
+    match runner.run("brew", &check) {
+        Ok(_) => return Ok(Vec::new()),
+        Err(DodotError::CommandFailed { exit_code, .. }) if exit_code >= 0 => {}
+        Err(e) => return Err(e),
+    }
+
+    let mut missing = Vec::new();
+    for (kind, suffix) in [("--formula", ""), ("--cask", " (cask)")] {
+        let declared = runner.run(
+            "brew",
+            &["bundle", "list", "--file", brewfile, kind].map(String::from),
+        )?;
+        let installed = runner.run("brew", &["list", kind, "-1"].map(String::from))?;
+        let installed: HashSet<&str> = installed.stdout.lines().map(str::trim).collect();
+        for entry in declared
+            .stdout
+            .lines()
+            .map(str::trim)
+            .filter(|l| !l.is_empty())
+        {
+            let short = entry.rsplit('/').next().unwrap_or(entry);
+            if !installed.contains(short) {
+                missing.push(format!("{entry}{suffix}"));
+            }
+        }
+    }
+    Ok(missing)
+}
+
 #[cfg(test)]
 mod tests {
     use super::*;
@@ -129,6 +694,7 @@ mod tests {
                 assert_eq!(arguments[0], "bundle");
                 assert_eq!(arguments[1], "--file");
                 assert!(arguments[2].ends_with("Brewfile"));
+                assert_eq!(arguments.len(), 3, "no lockfile, no --no-upgrade");
                 assert!(sentinel.starts_with("Brewfile-"));
                 assert_eq!(sentinel.len(), "Brewfile-".len() + 16);
                 assert_eq!(filename, "Brewfile");
@@ -138,4 +704,218 @@ mod tests {
             other => panic!("expected Run, got {other:?}"),
         }
     }
+
+    #[test]
+    fn failed_bundle_records_progress_and_resumes_past_installed_entries() {
+        let env = TempEnvironment::builder().pack("dev").done().build();
+        let output = "Tapping homebrew/cask-fonts\n\
+                      Using git\n\
+                      Installing ripgrep\n\
+                      Installing broken-tool\n\
+                      Installing broken-tool has failed!\n\
+                      Homebrew Bundle failed! 1 Brewfile dependency failed to install.\n";
+        let failed: Result<()> = Err(DodotError::CommandFailed {
+            command: "brew bundle".into(),
+            exit_code: 1,
+            stderr: String::new(),
+            stdout: output.into(),
+        });
+        let (fs, paths) = (env.fs.as_ref(), env.paths.as_ref());
+        record_outcome(fs, paths, "dev", "Brewfile", "abc", &failed);
+
+        let progress = load_progress(fs, paths, "dev", "Brewfile").unwrap();
+        assert_eq!(
+            progress.installed,
+            vec!["homebrew/cask-fonts", "git", "ripgrep"]
+        );
+        assert_eq!(progress.failed, vec!["broken-tool"]);
+
+        let args = vec!["bundle".to_string(), "--file".into(), "/p/Brewfile".into()];
+        let (exe, wrapped) = resume_command("brew", &args, Some(&progress), "abc");
+        assert_eq!(exe, "env");
+        assert_eq!(
+            wrapped[1],
+            "HOMEBREW_BUNDLE_BREW_SKIP=homebrew/cask-fonts git ripgrep"
+        );
+        assert_eq!(wrapped.last().unwrap(), "/p/Brewfile");
+        // Edited Brewfile: the record no longer applies.
+        let (exe, unchanged) = resume_command("brew", &args, Some(&progress), "def");
+        assert_eq!((exe.as_str(), unchanged), ("brew", args.clone()));
+
+        // A second failure keeps what the first run installed.
+        let retry: Result<()> = Err(DodotError::CommandFailed {
+            command: "brew bundle".into(),
+            exit_code: 1,
+            stderr: String::new(),
+            stdout: "Installing broken-tool\nInstalling broken-tool has failed!\n".into(),
+        });
+        record_outcome(fs, paths, "dev", "Brewfile", "abc", &retry);
+        let progress = load_progress(fs, paths, "dev", "Brewfile").unwrap();
+        assert_eq!(progress.installed.len(), 3);
+
+        record_outcome(fs, paths, "dev", "Brewfile", "abc", &Ok(()));
+        assert!(load_progress(fs, paths, "dev", "Brewfile").is_none());
+    }
+
+    #[test]
+    fn missing_packages_are_found_from_the_prefix_without_brew() {
+        let env = TempEnvironment::builder().build();
+        let fs = env.fs.as_ref();
+        let prefix = env.home.join("homebrew");
+        fs.mkdir_all(&prefix.join("Cellar/ripgrep/14.1.1")).unwrap();
+        fs.mkdir_all(&prefix.join("opt/python")).unwrap();
+        fs.mkdir_all(&prefix.join("Caskroom/firefox")).unwrap();
+
+        let brewfile = r#"
+tap "homebrew/cask-fonts"
+brew "ripgrep"
+brew 'python'
+brew "user/tap/fd", args: ["HEAD"]
+cask "firefox"
+cask "iterm2"
+mas "Xcode", id: 497799835
+# brew "commented"
+"#;
+        assert_eq!(declared_packages(brewfile).len(), 5);
+        assert_eq!(
+            missing_from_prefix(fs, &prefix, brewfile),
+            vec!["user/tap/fd".to_string(), "iterm2 (cask)".to_string()]
+        );
+    }
+
+    #[test]
+    fn lockfile_next_to_brewfile_adds_no_upgrade() {
+        let env = TempEnvironment::builder()
+            .pack("dev")
+            .file("Brewfile", "brew \"ripgrep\"")
+            .file("Brewfile.lock.json", "{}")
+            .done()
+            .build();
+        let brewfile = env.dotfiles_root.join("dev/Brewfile");
+        assert_eq!(
+            lockfile_for(&brewfile),
+            env.dotfiles_root.join("dev/Brewfile.lock.json")
+        );
+        assert_eq!(
+            BrewfileCommand.sibling_arguments(env.fs.as_ref(), &brewfile),
+            vec![NO_UPGRADE.to_string()]
+        );
+
+        // The flag goes ahead of `--file <path>`: the Brewfile stays
+        // the last argument.
+        let runner = crate::datastore::NoopCommandRunner;
+        let handler = RunOnceHandler::new(env.fs.as_ref(), &runner, BrewfileCommand);
+        let matches = vec![RuleMatch {
+            relative_path: "Brewfile".into(),
+            absolute_path: brewfile.clone(),
+            pack: "dev".into(),
+            handler: "homebrew".into(),
+            is_dir: false,
+            options: HashMap::new(),
+            preprocessor_source: None,
+            rendered_bytes: None,
+        }];
+        let intents = handler
+            .to_intents(
+                &matches,
+                &HandlerConfig::default(),
+                env.paths.as_ref(),
+                env.fs.as_ref() as &dyn Fs,
+            )
+            .unwrap();
+        let HandlerIntent::Run { arguments, .. } = &intents[0] else {
+            panic!("expected Run, got {:?}", intents[0]);
+        };
+        let brewfile = brewfile.to_string_lossy().into_owned();
+        assert_eq!(
+            *arguments,
+            vec!["bundle", NO_UPGRADE, "--file", brewfile.as_str()]
+        );
+    }
+
+    /// Answers per command line; anything else fails like a missing
+    /// command. `installed` drives `find_executable`.
+    struct Mac {
+        answers: Vec<(&'static str, Result<&'static str>)>,
+        installed: &'static [&'static str],
+    }
+
+    impl CommandRunner for Mac {
+        fn run(
+            &self,
+            executable: &str,
+            arguments: &[String],
+        ) -> Result<crate::datastore::CommandOutput> {
+            let line = std::iter::once(executable.to_string())
+                .chain(arguments.iter().cloned())
+                .collect::<Vec<_>>()
+                .join(" ");
+            let failed = |stderr: &str| DodotError::CommandFailed {
+                command: line.clone(),
+                exit_code: 1,
+                stderr: stderr.into(),
+                stdout: String::new(),
+            };
+            match self.answers.iter().find(|(cmd, _)| *cmd == line) {
+                Some((_, Ok(stdout))) => Ok(crate::datastore::CommandOutput {
+                    exit_code: 0,
+                    stdout: stdout.to_string(),
+                    stderr: String::new(),
+                }),
+                Some((_, Err(e))) => Err(failed(&e.to_string())),
+                None => Err(failed("not found")),
+            }
+        }
+
+        fn find_executable(&self, name: &str) -> Option<PathBuf> {
+            self.installed
+                .contains(&name)
+                .then(|| PathBuf::from("/opt/homebrew/bin").join(name))
+        }
+    }
+
+    #[test]
+    fn prerequisites_name_what_bundle_would_trip_over() {
+        let env = TempEnvironment::builder().build();
+        let fs = env.fs.as_ref();
+        let prefix = env.home.join("homebrew");
+        fs.mkdir_all(&prefix.join("Caskroom/firefox")).unwrap();
+        let brewfile = "cask \"firefox\"\ncask \"docker\"\nmas \"Xcode\", id: 497799835\n";
+        let cask_info =
+            r#"{"casks": [{"token": "docker", "artifacts": [{"pkg": ["Docker.pkg"]}]}]}"#;
+        let headless = BundleHost {
+            macos: true,
+            interactive: false,
+        };
+
+        let bare = Mac {
+            answers: vec![("brew info --cask --json=v2 docker", Ok(cask_info))],
+            installed: &["brew"],
+        };
+        let problems = bundle_prerequisites(fs, &bare, Some(&prefix), brewfile, headless);
+        assert_eq!(problems.len(), 2, "{problems:#?}");
+        assert!(problems[0].contains("Xcode") && problems[0].contains("brew install mas"));
+        assert!(problems[1].contains("docker") && problems[1].contains("sudo -v"));
+
+        let ready = Mac {
+            answers: vec![
+                ("brew info --cask --json=v2 docker", Ok(cask_info)),
+                (
+                    "mas account",
+                    Err(DodotError::Other("Not signed in".into())),
+                ),
+                ("sudo -n true", Ok("")),
+            ],
+            installed: &["brew", "mas"],
+        };
+        let problems = bundle_prerequisites(fs, &ready, Some(&prefix), brewfile, headless);
+        assert_eq!(problems.len(), 1, "{problems:#?}");
+        assert!(problems[0].contains("sign in"), "{problems:#?}");
+
+        let linux = BundleHost {
+            macos: false,
+            interactive: false,
+        };
+        assert!(bundle_prerequisites(fs, &bare, Some(&prefix), brewfile, linux).is_empty());
+    }
 }
@@ -24,11 +24,28 @@
 //! invoking it with bash would be incorrect. A script named
 //! `install.sh` announces portability and should work anywhere `bash`
 //! is available.
+//!
+//! # Sandbox
+//!
+//! A fresh subprocess still inherits the environment of whatever shell
+//! ran `dodot up`, so a script can work on one machine only because
+//! something happened to be exported there. `[install] sandbox` clears
+//! it: the script sees the allowlisted variables plus `DOTFILES_ROOT`,
+//! `DODOT_PACK` and `DODOT_DATA_DIR`, the same three `dodot run` sets.
+//! `nice`, `timeout_secs` and `unshare` add the matching wrapper
+//! commands. All of it is expressed as a longer command line
+//! (`env -i … timeout 600 nice -n 10 bash -- install.sh`), built at
+//! planning time by [`Sandbox::wrap`], so the executor and the
+//! datastore run it like any other command. None of it changes the
+//! sentinel: tightening the sandbox doesn't re-run scripts.
 
 use std::path::Path;
 
+use serde::Serialize;
+
 use crate::handlers::run_once::RunOnceCommand;
-use crate::handlers::{ExecutionPhase, HANDLER_INSTALL};
+use crate::handlers::{ExecutionPhase, HandlerConfig, HANDLER_INSTALL};
+use crate::paths::Pather;
 
 /// [`RunOnceCommand`] for the `install` handler.
 ///
@@ -58,6 +75,32 @@ impl RunOnceCommand for InstallCommand {
         )
     }
 
+    fn wrap_command(
+        &self,
+        config: &HandlerConfig,
+        pack: &str,
+        paths: &dyn Pather,
+        command: (String, Vec<String>),
+    ) -> (String, Vec<String>) {
+        let vars = [
+            (
+                "DOTFILES_ROOT",
+                paths.dotfiles_root().to_string_lossy().into_owned(),
+            ),
+            (
+                "DODOT_PACK",
+                crate::packs::display_name_for(pack).to_string(),
+            ),
+            (
+                "DODOT_DATA_DIR",
+                paths.data_dir().to_string_lossy().into_owned(),
+            ),
+        ];
+        config
+            .install_sandbox
+            .wrap(command, &vars, &|name| std::env::var(name).ok())
+    }
+
     fn status_deployed(&self) -> &str {
         "installed"
     }
@@ -71,11 +114,75 @@ impl RunOnceCommand for InstallCommand {
     }
 }
 
+/// How install scripts run: `[install]` in the config. The default is
+/// no sandbox at all.
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize)]
+pub struct Sandbox {
+    /// Clear the environment down to `env_allowlist` and dodot's own
+    /// variables.
+    pub clean_env: bool,
+    pub env_allowlist: Vec<String>,
+    /// `nice -n` value; 0 is off.
+    pub nice: i32,
+    /// `timeout` in seconds; 0 is off.
+    pub timeout_secs: u64,
+    /// `unshare` flags; empty is off.
+    pub unshare: Vec<String>,
+}
+
+impl Sandbox {
+    /// Prefix `command` with the wrappers this sandbox asks for, in
+    /// the order `env -i`, `timeout`, `nice`, `unshare`. `dodot_vars`
+    /// are set only when the environment is cleared; `lookup` reads
+    /// the current value of an allowlisted variable.
+    pub fn wrap(
+        &self,
+        command: (String, Vec<String>),
+        dodot_vars: &[(&str, String)],
+        lookup: &dyn Fn(&str) -> Option<String>,
+    ) -> (String, Vec<String>) {
+        let mut prefix: Vec<String> = Vec::new();
+        if self.clean_env {
+            prefix.push("env".into());
+            prefix.push("-i".into());
+            for name in &self.env_allowlist {
+                if let Some(value) = lookup(name) {
+                    prefix.push(format!("{name}={value}"));
+                }
+            }
+            for (name, value) in dodot_vars {
+                prefix.push(format!("{name}={value}"));
+            }
+        }
+        if self.timeout_secs > 0 {
+            prefix.push("timeout".into());
+            prefix.push(self.timeout_secs.to_string());
+        }
+        if self.nice > 0 {
+            prefix.push("nice".into());
+            prefix.push("-n".into());
+            prefix.push(self.nice.to_string());
+        }
+        if !self.unshare.is_empty() {
+            prefix.push("unshare".into());
+            prefix.extend(self.unshare.iter().cloned());
+        }
+        if prefix.is_empty() {
+            return command;
+        }
+        let (executable, arguments) = command;
+        let wrapper = prefix.remove(0);
+        prefix.push(executable);
+        prefix.extend(arguments);
+        (wrapper, prefix)
+    }
+}
+
 /// Pick the interpreter for an install script based on its extension.
 ///
 /// Module-level docs explain why extension — not the user's login
 /// shell — is the right signal.
-fn interpreter_for(path: &Path) -> &'static str {
+pub(crate) fn interpreter_for(path: &Path) -> &'static str {
     match path.extension().and_then(|e| e.to_str()) {
         Some("zsh") => "zsh",
         _ => "bash",
@@ -105,6 +212,51 @@ mod tests {
         assert_eq!(interpreter_for(Path::new("/a/b/install.zsh")), "zsh");
     }
 
+    #[test]
+    fn sandbox_wraps_command_keeping_script_last() {
+        let command = || {
+            (
+                "bash".to_string(),
+                vec!["--".to_string(), "/d/vim/install.sh".to_string()],
+            )
+        };
+        let vars = [("DODOT_PACK", "vim".to_string())];
+        let lookup = |name: &str| (name == "HOME").then(|| "/home/me".to_string());
+
+        assert_eq!(
+            Sandbox::default().wrap(command(), &vars, &lookup),
+            command()
+        );
+
+        let sandbox = Sandbox {
+            clean_env: true,
+            env_allowlist: vec!["HOME".into(), "EDITOR".into()],
+            nice: 10,
+            timeout_secs: 600,
+            unshare: vec!["--net".into()],
+        };
+        let (executable, arguments) = sandbox.wrap(command(), &vars, &lookup);
+        assert_eq!(executable, "env");
+        assert_eq!(
+            arguments,
+            [
+                "-i",
+                "HOME=/home/me",
+                "DODOT_PACK=vim",
+                "timeout",
+                "600",
+                "nice",
+                "-n",
+                "10",
+                "unshare",
+                "--net",
+                "bash",
+                "--",
+                "/d/vim/install.sh",
+            ]
+        );
+    }
+
     #[test]
     fn install_command_identity() {
         assert_eq!(InstallCommand.handler_name(), HANDLER_INSTALL);
@@ -10,16 +10,29 @@
 //! linking) but must not mutate anything — mutations are the executor's
 //! job. This keeps planning idempotent and safe to re-run.
 
+pub mod agent;
+pub mod autostart;
+pub mod containers;
+pub mod download;
+pub mod editors;
 pub mod externals;
 pub mod filter;
 pub mod gate;
+pub mod gitconfig;
 pub mod homebrew;
 pub mod install;
 pub mod nix;
+pub mod options;
+pub mod packages;
 pub mod path;
+pub mod plugins;
 pub mod run_once;
 pub mod shell;
+pub mod sshkeys;
 pub mod symlink;
+pub mod system;
+pub mod toolchains;
+pub mod undo;
 
 use std::collections::HashMap;
 use std::path::Path;
@@ -85,7 +98,8 @@ pub enum ExecutionPhase {
     Setup,
     /// Stage directories onto `$PATH` (path).
     PathExport,
-    /// Register shell init files (shell).
+    /// Register shell init files (shell) and git config includes
+    /// (gitconfig).
     ShellInit,
     /// Catchall: link remaining files (symlink). Always last.
     Link,
@@ -109,6 +123,61 @@ impl ExecutionPhase {
             }
         }
     }
+
+    /// The run stage this phase executes in.
+    pub fn stage(self) -> RunStage {
+        match self {
+            Self::Filter | Self::External => RunStage::PreProvision,
+            Self::Provision | Self::Setup => RunStage::Provision,
+            Self::PathExport | Self::ShellInit | Self::Link => RunStage::Link,
+        }
+    }
+}
+
+/// The stages of an `up` run, in execution order.
+///
+/// Phases order a single pack's handlers; stages order the whole run.
+/// Every pack finishes a stage before any pack starts the next, so a
+/// pack's install script can use the tools another pack's Brewfile
+/// installed, and nothing links until everything is provisioned.
+/// Within a stage each pack's intents keep their phase order, and packs
+/// whose handlers are all [`Handler::parallel_safe`] run side by side
+/// (see [`crate::packs::orchestration::schedule`]).
+///
+/// - [`PreProvision`](Self::PreProvision): fetch external content.
+/// - [`Provision`](Self::Provision): install packages, run setup
+///   scripts.
+/// - [`Link`](Self::Link): stage `$PATH` directories, register shell
+///   init files, link configs.
+/// - [`PostLink`](Self::PostLink): work that needs the deployed result
+///   in place. No built-in handler declares it; `up` runs the
+///   `[pack] verify` checks here, after the init script is regenerated.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord, Hash, Serialize)]
+pub enum RunStage {
+    PreProvision,
+    Provision,
+    Link,
+    PostLink,
+}
+
+impl RunStage {
+    /// Every stage, in execution order.
+    pub const ALL: [RunStage; 4] = [
+        RunStage::PreProvision,
+        RunStage::Provision,
+        RunStage::Link,
+        RunStage::PostLink,
+    ];
+
+    /// Lower-case name for logs and docs (`pre-provision`, …).
+    pub fn label(self) -> &'static str {
+        match self {
+            Self::PreProvision => "pre-provision",
+            Self::Provision => "provision",
+            Self::Link => "link",
+            Self::PostLink => "post-link",
+        }
+    }
 }
 
 /// Whether a handler matches specific names or acts as a catchall.
@@ -178,6 +247,34 @@ pub trait Handler: Send + Sync {
         self.phase().category()
     }
 
+    /// The run stage this handler's intents execute in.
+    ///
+    /// Derived from [`Self::phase`]; override to move a handler to a
+    /// stage its phase doesn't imply (e.g. [`RunStage::PostLink`]).
+    fn stage(&self) -> RunStage {
+        self.phase().stage()
+    }
+
+    /// Whether two packs can run this handler's intents at the same
+    /// time. Defaults to `true`. Return `false` when execution goes
+    /// through shared global state — a package manager's lock, a
+    /// user script that may call one — so packs using the handler run
+    /// one at a time.
+    fn parallel_safe(&self) -> bool {
+        true
+    }
+
+    /// Named shared resources this handler's intents use while they
+    /// run (the `RESOURCE_*` constants). Defaults to none. Two packs
+    /// whose intents hold a resource in common don't run at the same
+    /// time — the earlier pack finishes first — while packs with
+    /// nothing in common still run side by side. A handler that isn't
+    /// [`parallel_safe`](Self::parallel_safe) conflicts with every
+    /// pack and needs none.
+    fn resources(&self) -> &'static [&'static str] {
+        &[]
+    }
+
     /// How this handler decides what to claim.
     ///
     /// Defaults to [`MatchMode::Precise`]. Override to `Catchall` for
@@ -218,12 +315,15 @@ pub trait Handler: Send + Sync {
     /// `_lib/` entries on non-macOS platforms (per
     /// `docs/proposals/macos-paths.lex` §4.2): the pack is otherwise
     /// fine, other entries deploy normally, but the user gets a visible
-    /// "skipped on this platform" notice.
+    /// "skipped on this platform" notice. It also flags files caught by
+    /// the large-file guard. `fs` is for read-only inspection, as in
+    /// [`Self::to_intents`].
     fn warnings_for_matches(
         &self,
         _matches: &[RuleMatch],
         _config: &HandlerConfig,
         _paths: &dyn Pather,
+        _fs: &dyn Fs,
     ) -> Vec<String> {
         Vec::new()
     }
@@ -235,6 +335,15 @@ pub trait Handler: Send + Sync {
         pack: &str,
         datastore: &dyn DataStore,
     ) -> Result<HandlerStatus>;
+
+    /// Ordered steps that undo this handler's work for one pack,
+    /// consumed by `dodot down`. Must end with
+    /// [`UndoAction::ClearState`](undo::UndoAction::ClearState), which
+    /// the default returns on its own. Read-only, like
+    /// [`Self::to_intents`]. See [`undo`].
+    fn undo_actions(&self, _cx: &undo::UndoContext) -> Result<Vec<undo::UndoAction>> {
+        Ok(vec![undo::UndoAction::ClearState])
+    }
 }
 
 /// Configuration subset relevant to handlers.
@@ -273,6 +382,25 @@ pub struct HandlerConfig {
     /// per-file fallback doesn't pick up `.DS_Store`, `.git`, etc.
     #[serde(default, skip_serializing_if = "Vec::is_empty")]
     pub pack_ignore: Vec<String>,
+    /// How the symlink handler materializes targets (`[symlink] mode`).
+    pub link_mode: crate::operations::LinkMode,
+    /// Whether the system handler installs anything (`[system] enabled`).
+    pub system_enabled: bool,
+    /// Whether each system file asks before installing (`[system] confirm`).
+    pub system_confirm: bool,
+    /// Absolute paths the system handler refuses (`[system] protected`).
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub system_protected: Vec<String>,
+    /// What the symlink handler does with oversized files
+    /// (`[symlink] large_files`).
+    pub large_files: symlink::guard::LargeFiles,
+    /// Size above which any file trips the guard, in bytes; 0 disables.
+    pub max_file_size: u64,
+    /// Size above which a binary file trips the guard, in bytes; 0
+    /// disables.
+    pub max_binary_size: u64,
+    /// Environment and limits for install scripts (`[install]`).
+    pub install_sandbox: install::Sandbox,
 }
 
 impl Default for HandlerConfig {
@@ -285,6 +413,14 @@ impl Default for HandlerConfig {
             targets: std::collections::HashMap::new(),
             auto_chmod_exec: true,
             pack_ignore: Vec::new(),
+            link_mode: crate::operations::LinkMode::Symlink,
+            system_enabled: false,
+            system_confirm: true,
+            system_protected: Vec::new(),
+            large_files: symlink::guard::LargeFiles::Warn,
+            max_file_size: 50 * 1024 * 1024,
+            max_binary_size: 1024 * 1024,
+            install_sandbox: install::Sandbox::default(),
         }
     }
 }
@@ -292,6 +428,7 @@ impl Default for HandlerConfig {
 /// Well-known handler names.
 pub const HANDLER_SYMLINK: &str = "symlink";
 pub const HANDLER_SHELL: &str = "shell";
+pub const HANDLER_GITCONFIG: &str = "gitconfig";
 pub const HANDLER_PATH: &str = "path";
 pub const HANDLER_INSTALL: &str = "install";
 pub const HANDLER_HOMEBREW: &str = "homebrew";
@@ -300,6 +437,30 @@ pub const HANDLER_IGNORE: &str = "ignore";
 pub const HANDLER_SKIP: &str = "skip";
 pub const HANDLER_GATE: &str = "gate";
 pub const HANDLER_EXTERNAL: &str = "external";
+pub const HANDLER_PLUGINS: &str = "plugins";
+pub const HANDLER_DOWNLOAD: &str = "download";
+pub const HANDLER_SSHKEYS: &str = "sshkeys";
+pub const HANDLER_CONTAINERS: &str = "containers";
+pub const HANDLER_SYSTEM: &str = "system";
+pub const HANDLER_AUTOSTART: &str = "autostart";
+pub const HANDLER_AGENT: &str = "agent";
+pub const HANDLER_EDITORS: &str = "editors";
+pub const HANDLER_NPM: &str = "npm";
+pub const HANDLER_PIP: &str = "pip";
+pub const HANDLER_CARGO: &str = "cargo";
+pub const HANDLER_GEM: &str = "gem";
+pub const HANDLER_ASDF: &str = "asdf";
+pub const HANDLER_MISE: &str = "mise";
+pub const HANDLER_FLAKE: &str = "flake";
+
+/// Shared resources handlers declare through [`Handler::resources`].
+/// The init script and the git config include block aren't among
+/// them: `up` writes those once, after the link stage.
+pub const RESOURCE_SSH_AGENT: &str = "ssh-agent";
+pub const RESOURCE_GNUPG: &str = "gnupg";
+pub const RESOURCE_USER_SERVICES: &str = "user-services";
+pub const RESOURCE_LOGIN_ITEMS: &str = "login-items";
+pub const RESOURCE_PLUGIN_MANAGERS: &str = "plugin-managers";
 
 /// Names of all configuration-category handlers in the registry.
 ///
@@ -327,12 +488,41 @@ pub fn configuration_handler_names(fs: &dyn Fs) -> Vec<String> {
         .collect()
 }
 
+/// The content of a manifest a handler plans from (`externals.toml`,
+/// `plugins.toml`, …): the preprocessor's rendered bytes when there are
+/// any, the file on disk otherwise.
+///
+/// `None` for a first-time templated pack, whose file has no rendered
+/// baseline and isn't on disk yet. Same posture as the run-once
+/// handlers' passive placeholder: plan nothing for it, let status
+/// report it pending through the symlink chain, and let the next
+/// `dodot up` plan it for real.
+pub(crate) fn manifest_bytes(m: &RuleMatch, fs: &dyn Fs) -> Option<Vec<u8>> {
+    if let Some(bytes) = m.rendered_bytes.as_deref() {
+        return Some(bytes.to_vec());
+    }
+    match fs.read_file(&m.absolute_path) {
+        Ok(bytes) => Some(bytes),
+        Err(_) => {
+            tracing::debug!(
+                pack = %m.pack,
+                file = %m.absolute_path.display(),
+                handler = %m.handler,
+                "manifest unreadable; skipping intent planning"
+            );
+            None
+        }
+    }
+}
+
 /// Create the default handler registry.
 ///
 /// Returns a map from handler name to handler instance. The `fs`
 /// reference is needed by the run-once handlers (install, homebrew,
-/// nix) for checksum computation; `runner` is threaded in for any
-/// environmental pre-flight a `RunOnceCommand` may want to do at
+/// nix, npm/pip/cargo/gem), the toolchain handlers and the plugins,
+/// sshkeys and containers handlers for checksum computation; `runner`
+/// is threaded in for any environmental pre-flight a `RunOnceCommand`
+/// (or a toolchain handler's manager probe) may want to do at
 /// intent-production time (see the lifecycle-invariant note on
 /// `RunOnceCommand` — per-content validation is out of scope for
 /// run-once handlers).
@@ -350,6 +540,10 @@ pub fn create_registry<'a>(
     );
     registry.insert(HANDLER_SYMLINK.into(), Box::new(symlink::SymlinkHandler));
     registry.insert(HANDLER_SHELL.into(), Box::new(shell::ShellHandler));
+    registry.insert(
+        HANDLER_GITCONFIG.into(),
+        Box::new(gitconfig::GitconfigHandler),
+    );
     registry.insert(HANDLER_PATH.into(), Box::new(path::PathHandler));
     registry.insert(
         HANDLER_INSTALL.into(),
@@ -371,6 +565,51 @@ pub fn create_registry<'a>(
         HANDLER_NIX.into(),
         Box::new(run_once::RunOnceHandler::new(fs, runner, nix::NixCommand)),
     );
+    for tool in packages::PackageTool::ALL {
+        registry.insert(
+            tool.handler_name().into(),
+            Box::new(run_once::RunOnceHandler::new(
+                fs,
+                runner,
+                packages::PackagesCommand(tool),
+            )),
+        );
+    }
+    for toolchain in toolchains::Toolchain::ALL {
+        registry.insert(
+            toolchain.handler_name().into(),
+            Box::new(toolchains::ToolchainHandler::new(fs, runner, toolchain)),
+        );
+    }
+    registry.insert(
+        HANDLER_PLUGINS.into(),
+        Box::new(plugins::PluginsHandler::new(fs)),
+    );
+    registry.insert(
+        HANDLER_DOWNLOAD.into(),
+        Box::new(download::DownloadHandler::new(fs)),
+    );
+    registry.insert(
+        HANDLER_SSHKEYS.into(),
+        Box::new(sshkeys::SshKeysHandler::new(fs)),
+    );
+    registry.insert(
+        HANDLER_CONTAINERS.into(),
+        Box::new(containers::ContainersHandler::new(fs)),
+    );
+    registry.insert(
+        HANDLER_SYSTEM.into(),
+        Box::new(system::SystemHandler::new(fs)),
+    );
+    registry.insert(
+        HANDLER_AUTOSTART.into(),
+        Box::new(autostart::AutostartHandler::new(fs)),
+    );
+    registry.insert(HANDLER_AGENT.into(), Box::new(agent::AgentHandler::new(fs)));
+    registry.insert(
+        HANDLER_EDITORS.into(),
+        Box::new(editors::EditorsHandler::new()),
+    );
     validate_registry(&registry);
     registry
 }
@@ -475,10 +714,31 @@ mod tests {
             registry[HANDLER_HOMEBREW].phase(),
             ExecutionPhase::Provision
         );
+        assert_eq!(registry[HANDLER_PLUGINS].phase(), ExecutionPhase::Provision);
+        assert_eq!(registry[HANDLER_ASDF].phase(), ExecutionPhase::Provision);
+        assert_eq!(registry[HANDLER_MISE].phase(), ExecutionPhase::Provision);
+        assert_eq!(registry[HANDLER_FLAKE].phase(), ExecutionPhase::Provision);
+        assert_eq!(
+            registry[HANDLER_DOWNLOAD].phase(),
+            ExecutionPhase::Provision
+        );
+        assert_eq!(registry[HANDLER_SSHKEYS].phase(), ExecutionPhase::Provision);
+        assert_eq!(
+            registry[HANDLER_CONTAINERS].phase(),
+            ExecutionPhase::Provision
+        );
+        assert_eq!(registry[HANDLER_SYSTEM].phase(), ExecutionPhase::Setup);
+        assert_eq!(registry[HANDLER_AUTOSTART].phase(), ExecutionPhase::Setup);
+        assert_eq!(registry[HANDLER_AGENT].phase(), ExecutionPhase::Setup);
         assert_eq!(registry[HANDLER_INSTALL].phase(), ExecutionPhase::Setup);
         assert_eq!(registry[HANDLER_PATH].phase(), ExecutionPhase::PathExport);
         assert_eq!(registry[HANDLER_SHELL].phase(), ExecutionPhase::ShellInit);
+        assert_eq!(
+            registry[HANDLER_GITCONFIG].phase(),
+            ExecutionPhase::ShellInit
+        );
         assert_eq!(registry[HANDLER_SYMLINK].phase(), ExecutionPhase::Link);
+        assert_eq!(registry[HANDLER_EDITORS].phase(), ExecutionPhase::Link);
     }
 
     #[test]
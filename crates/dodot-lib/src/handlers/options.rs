@@ -0,0 +1,376 @@
+//! Option schemas for `[[rules]]` entries.
+//!
+//! A rule can pass handler-specific settings through its `options`
+//! table. Each handler declares the options it reads here; config load
+//! checks every rule against its handler's schema, so a typo'd key or
+//! a value of the wrong type is an error naming the rule instead of a
+//! setting that silently does nothing.
+//!
+//! Options reach handlers as strings on [`RuleMatch::options`]
+//! (`crate::rules::RuleMatch`), already validated and normalized.
+
+use std::collections::{BTreeMap, HashMap};
+
+use super::{
+    HANDLER_ASDF, HANDLER_CARGO, HANDLER_CONTAINERS, HANDLER_DOWNLOAD, HANDLER_EXTERNAL,
+    HANDLER_FLAKE, HANDLER_GEM, HANDLER_GITCONFIG, HANDLER_HOMEBREW, HANDLER_IGNORE,
+    HANDLER_INSTALL, HANDLER_MISE, HANDLER_NIX, HANDLER_NPM, HANDLER_PATH, HANDLER_PIP,
+    HANDLER_PLUGINS, HANDLER_SHELL, HANDLER_SKIP, HANDLER_SSHKEYS, HANDLER_SYMLINK,
+};
+
+/// `symlink`: deploy the match here instead of the resolved target.
+pub const OPTION_TARGET: &str = "target";
+/// `symlink`: per-rule override of `[symlink] mode`.
+pub const OPTION_MODE: &str = "mode";
+/// `symlink`: file name to deploy the match under.
+pub const OPTION_TARGET_NAME: &str = "target_name";
+/// `symlink`: source name → deployed name, for rules matching many files.
+pub const OPTION_RENAME: &str = "rename";
+/// `symlink`: deploy matches as dotfiles in `$HOME`, like `_home/`.
+pub const OPTION_DOT_PREFIX: &str = "dot_prefix";
+/// `symlink`: octal mode to keep the deployed file at.
+pub const OPTION_CHMOD: &str = "chmod";
+/// `symlink`: `user[:group]` to keep the deployed file owned by.
+pub const OPTION_CHOWN: &str = "chown";
+/// `path`: per-rule override of `[path] priority`.
+pub const OPTION_PATH_PRIORITY: &str = "path_priority";
+
+/// Options that pick a deploy path or name; `target` pins the whole
+/// path, so it can't be combined with the others.
+const SYMLINK_NAMING_OPTIONS: &[&str] = &[OPTION_TARGET_NAME, OPTION_RENAME, OPTION_DOT_PREFIX];
+
+/// Type of an option's value.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum OptionKind {
+    /// Any string.
+    Text,
+    /// One of a fixed set of strings.
+    Choice(&'static [&'static str]),
+    /// `true` or `false`; normalized to `"true"` / `"false"`.
+    Bool,
+    /// A table of string values; normalized to a JSON object.
+    Map,
+    /// A 32-bit integer; normalized to its decimal form.
+    Int,
+}
+
+impl OptionKind {
+    fn describe(self) -> String {
+        match self {
+            OptionKind::Text => "a string".into(),
+            OptionKind::Choice(values) => format!("one of {}", quote_list(values)),
+            OptionKind::Bool => "a boolean".into(),
+            OptionKind::Map => "a table of strings".into(),
+            OptionKind::Int => "an integer".into(),
+        }
+    }
+}
+
+/// One option a handler accepts.
+#[derive(Debug, Clone, Copy)]
+pub struct OptionSpec {
+    pub name: &'static str,
+    pub kind: OptionKind,
+    pub help: &'static str,
+}
+
+const SYMLINK_OPTIONS: &[OptionSpec] = &[
+    OptionSpec {
+        name: OPTION_TARGET,
+        kind: OptionKind::Text,
+        help: "deploy path; absolute, `~/`, `$HOME/` or `$XDG_*/`, or relative to $XDG_CONFIG_HOME",
+    },
+    OptionSpec {
+        name: OPTION_MODE,
+        kind: OptionKind::Choice(&["symlink", "copy", "hardlink"]),
+        help: "how to materialize the target, overriding `[symlink] mode`",
+    },
+    OptionSpec {
+        name: OPTION_TARGET_NAME,
+        kind: OptionKind::Text,
+        help: "file name to deploy as, in the resolved target directory",
+    },
+    OptionSpec {
+        name: OPTION_RENAME,
+        kind: OptionKind::Map,
+        help: "source name → deployed name for the files the rule matches",
+    },
+    OptionSpec {
+        name: OPTION_DOT_PREFIX,
+        kind: OptionKind::Bool,
+        help: "deploy as `$HOME/.<name>`, as if under `_home/`",
+    },
+    OptionSpec {
+        name: OPTION_CHMOD,
+        kind: OptionKind::Text,
+        help: "octal mode (`\"0600\"`) set after every deploy and checked by `status`",
+    },
+    OptionSpec {
+        name: OPTION_CHOWN,
+        kind: OptionKind::Text,
+        help: "`user`, `user:group` or `:group` set after every deploy where permitted",
+    },
+];
+
+const PATH_OPTIONS: &[OptionSpec] = &[OptionSpec {
+    name: OPTION_PATH_PRIORITY,
+    kind: OptionKind::Int,
+    help: "`[path] priority` for the directories the rule matches",
+}];
+
+/// The options `handler` accepts, or `None` if rules can't route to
+/// it (unknown, or internal like `gate`). An empty slice means the
+/// handler takes no options.
+pub fn option_schema(handler: &str) -> Option<&'static [OptionSpec]> {
+    match handler {
+        HANDLER_SYMLINK => Some(SYMLINK_OPTIONS),
+        HANDLER_PATH => Some(PATH_OPTIONS),
+        HANDLER_SHELL | HANDLER_GITCONFIG | HANDLER_INSTALL | HANDLER_HOMEBREW | HANDLER_NIX
+        | HANDLER_NPM | HANDLER_PIP | HANDLER_CARGO | HANDLER_GEM | HANDLER_ASDF | HANDLER_MISE
+        | HANDLER_FLAKE | HANDLER_EXTERNAL | HANDLER_PLUGINS | HANDLER_DOWNLOAD
+        | HANDLER_SSHKEYS | HANDLER_CONTAINERS | HANDLER_IGNORE | HANDLER_SKIP => Some(&[]),
+        _ => None,
+    }
+}
+
+/// Handlers a rule may name, for error messages.
+pub fn routable_handlers() -> Vec<&'static str> {
+    vec![
+        HANDLER_SYMLINK,
+        HANDLER_SHELL,
+        HANDLER_GITCONFIG,
+        HANDLER_PATH,
+        HANDLER_INSTALL,
+        HANDLER_HOMEBREW,
+        HANDLER_NIX,
+        HANDLER_NPM,
+        HANDLER_PIP,
+        HANDLER_CARGO,
+        HANDLER_GEM,
+        HANDLER_ASDF,
+        HANDLER_MISE,
+        HANDLER_FLAKE,
+        HANDLER_EXTERNAL,
+        HANDLER_PLUGINS,
+        HANDLER_DOWNLOAD,
+        HANDLER_SSHKEYS,
+        HANDLER_CONTAINERS,
+        HANDLER_IGNORE,
+        HANDLER_SKIP,
+    ]
+}
+
+/// Check `options` against `handler`'s schema and normalize them to
+/// the string form handlers read. The error is the reason only; the
+/// caller adds where the rule came from.
+pub fn validate_options(
+    handler: &str,
+    options: &BTreeMap<String, toml::Value>,
+) -> std::result::Result<HashMap<String, String>, String> {
+    let Some(schema) = option_schema(handler) else {
+        return Err(format!(
+            "unknown handler `{handler}`; rules can use {}",
+            quote_list(&routable_handlers())
+        ));
+    };
+
+    let mut normalized = HashMap::new();
+    for (key, value) in options {
+        let Some(spec) = schema.iter().find(|s| s.name == key) else {
+            return Err(if schema.is_empty() {
+                format!("unknown option `{key}`: the {handler} handler takes no options")
+            } else {
+                format!(
+                    "unknown option `{key}` for the {handler} handler; allowed: {}",
+                    allowed_list(schema)
+                )
+            });
+        };
+        let text = match (spec.kind, value) {
+            (OptionKind::Text, toml::Value::String(s)) => s.clone(),
+            (OptionKind::Choice(values), toml::Value::String(s))
+                if values.contains(&s.as_str()) =>
+            {
+                s.clone()
+            }
+            (OptionKind::Bool, toml::Value::Boolean(b)) => b.to_string(),
+            (OptionKind::Int, toml::Value::Integer(n)) if i32::try_from(*n).is_ok() => {
+                n.to_string()
+            }
+            (OptionKind::Map, toml::Value::Table(table))
+                if table.values().all(toml::Value::is_str) =>
+            {
+                let map: BTreeMap<&str, &str> = table
+                    .iter()
+                    .filter_map(|(k, v)| Some((k.as_str(), v.as_str()?)))
+                    .collect();
+                serde_json::to_string(&map).expect("string map serializes")
+            }
+            _ => {
+                return Err(format!(
+                    "option `{key}` for the {handler} handler must be {}, got {}",
+                    spec.kind.describe(),
+                    value
+                ))
+            }
+        };
+        normalized.insert(key.clone(), text);
+    }
+    if let Some(target) = normalized.get(OPTION_TARGET) {
+        crate::paths::check_target(target).map_err(|e| format!("option `{OPTION_TARGET}`: {e}"))?;
+    }
+    if let Some(mode) = normalized.get(OPTION_CHMOD) {
+        crate::perms::parse_mode(mode).map_err(|e| format!("option `{OPTION_CHMOD}`: {e}"))?;
+    }
+    if let Some(owner) = normalized.get(OPTION_CHOWN) {
+        crate::perms::parse_owner(owner).map_err(|e| format!("option `{OPTION_CHOWN}`: {e}"))?;
+    }
+    if handler == HANDLER_SYMLINK && normalized.contains_key(OPTION_TARGET) {
+        if let Some(other) = SYMLINK_NAMING_OPTIONS
+            .iter()
+            .find(|o| normalized.contains_key(**o))
+        {
+            return Err(format!(
+                "options `{OPTION_TARGET}` and `{other}` both say where the match goes; pick one"
+            ));
+        }
+    }
+    Ok(normalized)
+}
+
+/// Read a [`OptionKind::Map`] option back from its normalized form.
+pub fn parse_map_option(value: &str) -> BTreeMap<String, String> {
+    serde_json::from_str(value).unwrap_or_default()
+}
+
+fn allowed_list(schema: &[OptionSpec]) -> String {
+    schema
+        .iter()
+        .map(|s| format!("`{}` ({}: {})", s.name, s.kind.describe(), s.help))
+        .collect::<Vec<_>>()
+        .join(", ")
+}
+
+fn quote_list(values: &[&str]) -> String {
+    values
+        .iter()
+        .map(|v| format!("`{v}`"))
+        .collect::<Vec<_>>()
+        .join(", ")
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn options(toml_src: &str) -> BTreeMap<String, toml::Value> {
+        toml::from_str(toml_src).unwrap()
+    }
+
+    #[test]
+    fn valid_options_are_normalized() {
+        let out = validate_options(
+            HANDLER_SYMLINK,
+            &options("target = \"/etc/foo\"\nmode = \"copy\""),
+        )
+        .unwrap();
+        assert_eq!(out["target"], "/etc/foo");
+        assert_eq!(out["mode"], "copy");
+    }
+
+    #[test]
+    fn unknown_key_lists_allowed_options() {
+        let err = validate_options(HANDLER_SYMLINK, &options("taget = \"x\"")).unwrap_err();
+        assert!(err.contains("unknown option `taget`"), "{err}");
+        assert!(err.contains("`target`") && err.contains("`mode`"), "{err}");
+
+        let err = validate_options(HANDLER_SHELL, &options("x = 1")).unwrap_err();
+        assert!(err.contains("takes no options"), "{err}");
+    }
+
+    #[test]
+    fn wrong_type_and_bad_choice_are_rejected() {
+        let err = validate_options(HANDLER_SYMLINK, &options("target = 3")).unwrap_err();
+        assert!(err.contains("must be a string"), "{err}");
+
+        let err = validate_options(HANDLER_SYMLINK, &options("mode = \"move\"")).unwrap_err();
+        assert!(
+            err.contains("one of `symlink`, `copy`, `hardlink`"),
+            "{err}"
+        );
+    }
+
+    #[test]
+    fn naming_options_normalize_and_conflict_with_target() {
+        let out = validate_options(
+            HANDLER_SYMLINK,
+            &options("dot_prefix = true\nrename = { gitconfig = \".gitconfig\" }"),
+        )
+        .unwrap();
+        assert_eq!(out["dot_prefix"], "true");
+        assert_eq!(parse_map_option(&out["rename"])["gitconfig"], ".gitconfig");
+
+        let err = validate_options(HANDLER_SYMLINK, &options("rename = { a = 1 }")).unwrap_err();
+        assert!(err.contains("must be a table of strings"), "{err}");
+        let err = validate_options(
+            HANDLER_SYMLINK,
+            &options("target = \"/etc/x\"\ntarget_name = \"y\""),
+        )
+        .unwrap_err();
+        assert!(err.contains("pick one"), "{err}");
+    }
+
+    #[test]
+    fn chmod_and_chown_are_checked() {
+        let out = validate_options(
+            HANDLER_SYMLINK,
+            &options("chmod = \"0600\"\nchown = \"root:wheel\""),
+        )
+        .unwrap();
+        assert_eq!(out["chmod"], "0600");
+        assert_eq!(out["chown"], "root:wheel");
+
+        let err = validate_options(HANDLER_SYMLINK, &options("chmod = \"rw\"")).unwrap_err();
+        assert!(
+            err.contains("option `chmod`: expected an octal mode"),
+            "{err}"
+        );
+        let err = validate_options(HANDLER_SYMLINK, &options("chown = \"me:\"")).unwrap_err();
+        assert!(err.contains("option `chown`"), "{err}");
+    }
+
+    #[test]
+    fn target_variables_are_checked() {
+        let out = validate_options(
+            HANDLER_SYMLINK,
+            &options("target = \"$XDG_DATA_HOME/fonts\""),
+        )
+        .unwrap();
+        assert_eq!(out["target"], "$XDG_DATA_HOME/fonts");
+
+        let err =
+            validate_options(HANDLER_SYMLINK, &options("target = \"$DATA/fonts\"")).unwrap_err();
+        assert!(
+            err.contains("option `target`: unknown variable `$DATA`"),
+            "{err}"
+        );
+    }
+
+    #[test]
+    fn path_priority_is_an_integer() {
+        let out = validate_options(HANDLER_PATH, &options("path_priority = -5")).unwrap();
+        assert_eq!(out["path_priority"], "-5");
+
+        let err = validate_options(HANDLER_PATH, &options("path_priority = \"10\"")).unwrap_err();
+        assert!(err.contains("must be an integer"), "{err}");
+        assert!(validate_options(HANDLER_PATH, &options("path_priority = 9999999999")).is_err());
+    }
+
+    #[test]
+    fn internal_and_unknown_handlers_are_not_routable() {
+        assert!(validate_options("gate", &BTreeMap::new()).is_err());
+        assert!(validate_options("symlnk", &BTreeMap::new())
+            .unwrap_err()
+            .contains("unknown handler `symlnk`"));
+    }
+}
@@ -0,0 +1,304 @@
+//! Language package handlers — `npm`, `pip`, `cargo` and `gem` install
+//! globally-available packages listed in a pack-root text file, via
+//! the shared [`crate::handlers::run_once`] machinery.
+//!
+//! | File                      | Handler | Runs                                   |
+//! |---------------------------|---------|----------------------------------------|
+//! | `npm-packages.txt`        | `npm`   | `npm install -g <packages>`            |
+//! | `requirements-global.txt` | `pip`   | `python3 -m pip install --user -r <f>` |
+//! | `cargo-crates.txt`        | `cargo` | `cargo install <crates>`               |
+//! | `gems.txt`                | `gem`   | `gem install --conservative <gems>`    |
+//!
+//! The list files hold one package per line (anything a tool's install
+//! command accepts: `typescript@5`, `ripgrep@14.1.0`), with `#`
+//! comments and blank lines ignored. `requirements-global.txt` is a
+//! regular pip requirements file and goes to pip as-is.
+//!
+//! Each tool is a [`PackageTool`] adapter; they share one
+//! [`PackagesCommand`], so sentinels, the notify-don't-rerun policy and
+//! `dodot status` rows behave exactly like `homebrew`'s. The only
+//! pre-flight is environmental: the tool must be runnable, otherwise
+//! planning fails with a message saying what to install.
+
+use std::path::Path;
+
+use crate::datastore::CommandRunner;
+use crate::fs::Fs;
+use crate::handlers::run_once::RunOnceCommand;
+use crate::handlers::{ExecutionPhase, HANDLER_CARGO, HANDLER_GEM, HANDLER_NPM, HANDLER_PIP};
+use crate::{DodotError, Result};
+
+/// Reads the list file named by `$1` into `"$@"`, dropping comments,
+/// and runs `@CMD@` with it unless the list is empty. `set -f` keeps
+/// entries like `requests[socks]` from globbing.
+const LIST_SCRIPT_TEMPLATE: &str =
+    r#"set -f; set -- $(sed 's/#.*//' "$1"); [ "$#" -eq 0 ] || exec @CMD@ "$@""#;
+
+/// One language package manager.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum PackageTool {
+    Npm,
+    Pip,
+    Cargo,
+    Gem,
+}
+
+impl PackageTool {
+    pub const ALL: [PackageTool; 4] = [
+        PackageTool::Npm,
+        PackageTool::Pip,
+        PackageTool::Cargo,
+        PackageTool::Gem,
+    ];
+
+    pub fn handler_name(self) -> &'static str {
+        match self {
+            PackageTool::Npm => HANDLER_NPM,
+            PackageTool::Pip => HANDLER_PIP,
+            PackageTool::Cargo => HANDLER_CARGO,
+            PackageTool::Gem => HANDLER_GEM,
+        }
+    }
+
+    /// `(executable, arguments)` that succeeds iff the tool is usable.
+    fn probe(self) -> (&'static str, &'static [&'static str]) {
+        match self {
+            PackageTool::Npm => ("npm", &["--version"]),
+            PackageTool::Pip => ("python3", &["-m", "pip", "--version"]),
+            PackageTool::Cargo => ("cargo", &["--version"]),
+            PackageTool::Gem => ("gem", &["--version"]),
+        }
+    }
+
+    /// What to install when [`Self::probe`] fails.
+    fn install_hint(self) -> &'static str {
+        match self {
+            PackageTool::Npm => "install Node.js, which ships npm",
+            PackageTool::Pip => "install Python 3 with pip",
+            PackageTool::Cargo => "install Rust with rustup",
+            PackageTool::Gem => "install Ruby, which ships gem",
+        }
+    }
+
+    fn install_command(self, path: &Path) -> (String, Vec<String>) {
+        let path = path.to_string_lossy().into_owned();
+        let list_install = |cmd: &str| {
+            (
+                "sh".to_string(),
+                vec![
+                    "-c".into(),
+                    LIST_SCRIPT_TEMPLATE.replace("@CMD@", cmd),
+                    format!("dodot-{}", self.handler_name()),
+                    path.clone(),
+                ],
+            )
+        };
+        match self {
+            PackageTool::Npm => list_install("npm install -g"),
+            PackageTool::Pip => (
+                "python3".into(),
+                vec![
+                    "-m".into(),
+                    "pip".into(),
+                    "install".into(),
+                    "--user".into(),
+                    "-r".into(),
+                    path.clone(),
+                ],
+            ),
+            PackageTool::Cargo => list_install("cargo install"),
+            PackageTool::Gem => list_install("gem install --conservative"),
+        }
+    }
+}
+
+/// [`RunOnceCommand`] for the language package handlers.
+pub struct PackagesCommand(pub PackageTool);
+
+impl RunOnceCommand for PackagesCommand {
+    fn handler_name(&self) -> &str {
+        self.0.handler_name()
+    }
+
+    fn phase(&self) -> ExecutionPhase {
+        ExecutionPhase::Provision
+    }
+
+    fn command_for(&self, path: &Path) -> (String, Vec<String>) {
+        self.0.install_command(path)
+    }
+
+    /// The tool must run. A missing `npm` is the same on every run
+    /// whatever the list says, so this stays within the run-once
+    /// lifecycle invariant.
+    fn validate(&self, _fs: &dyn Fs, runner: &dyn CommandRunner, path: &Path) -> Result<()> {
+        let (executable, arguments) = self.0.probe();
+        let arguments: Vec<String> = arguments.iter().map(|a| a.to_string()).collect();
+        if runner.run(executable, &arguments).is_ok() {
+            return Ok(());
+        }
+        let file = path.file_name().unwrap_or_default().to_string_lossy();
+        Err(DodotError::Other(format!(
+            "{} needs `{}`, which isn't available on this machine; {}, \
+             or add `{file}` to `[mappings] ignore` for this pack",
+            path.display(),
+            self.0.handler_name(),
+            self.0.install_hint(),
+        )))
+    }
+
+    fn status_deployed(&self) -> &str {
+        match self.0 {
+            PackageTool::Npm => "npm packages installed",
+            PackageTool::Pip => "pip packages installed",
+            PackageTool::Cargo => "cargo crates installed",
+            PackageTool::Gem => "gems installed",
+        }
+    }
+
+    fn status_pending(&self) -> &str {
+        match self.0 {
+            PackageTool::Npm => "npm packages not installed",
+            PackageTool::Pip => "pip packages not installed",
+            PackageTool::Cargo => "cargo crates not installed",
+            PackageTool::Gem => "gems not installed",
+        }
+    }
+
+    fn status_ran_different(&self) -> &str {
+        match self.0 {
+            PackageTool::Npm => "npm packages older version",
+            PackageTool::Pip => "pip packages older version",
+            PackageTool::Cargo => "cargo crates older version",
+            PackageTool::Gem => "gems older version",
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::datastore::CommandOutput;
+    use crate::handlers::run_once::RunOnceHandler;
+    use crate::handlers::{Handler, HandlerConfig};
+    use crate::operations::HandlerIntent;
+    use crate::rules::RuleMatch;
+    use crate::testing::TempEnvironment;
+
+    #[test]
+    fn list_tools_run_through_sh_with_the_file_as_argument() {
+        let (exe, args) = PackagesCommand(PackageTool::Npm).command_for(Path::new("/p/n.txt"));
+        assert_eq!(exe, "sh");
+        assert_eq!(args[0], "-c");
+        assert!(
+            args[1].contains("exec npm install -g \"$@\""),
+            "{}",
+            args[1]
+        );
+        assert_eq!(args[2], "dodot-npm");
+        assert_eq!(args[3], "/p/n.txt");
+
+        let (_, args) = PackagesCommand(PackageTool::Gem).command_for(Path::new("/p/gems.txt"));
+        assert!(args[1].contains("gem install --conservative"));
+    }
+
+    #[test]
+    fn pip_reads_the_requirements_file_itself() {
+        let (exe, args) = PackagesCommand(PackageTool::Pip).command_for(Path::new("/p/r.txt"));
+        assert_eq!(exe, "python3");
+        assert_eq!(args, ["-m", "pip", "install", "--user", "-r", "/p/r.txt"]);
+    }
+
+    #[test]
+    fn list_script_skips_comments_and_empty_lists() {
+        let env = TempEnvironment::builder()
+            .pack("node")
+            .file("list.txt", "# tools\ntypescript@5 # compiler\n\nprettier\n")
+            .file("empty.txt", "# nothing yet\n")
+            .done()
+            .build();
+        let script = LIST_SCRIPT_TEMPLATE.replace("@CMD@", "printf '%s|'");
+        let run = |file: &str| {
+            let out = std::process::Command::new("sh")
+                .args(["-c", &script, "test"])
+                .arg(env.dotfiles_root.join("node").join(file))
+                .output()
+                .unwrap();
+            assert!(out.status.success());
+            String::from_utf8(out.stdout).unwrap()
+        };
+        assert_eq!(run("list.txt"), "typescript@5|prettier|");
+        assert_eq!(run("empty.txt"), "");
+    }
+
+    /// Answers `<tool> --version` when the tool is "installed";
+    /// otherwise fails the way a spawn of a missing binary does.
+    struct ProbeRunner {
+        installed: bool,
+    }
+
+    impl CommandRunner for ProbeRunner {
+        fn run(&self, executable: &str, arguments: &[String]) -> Result<CommandOutput> {
+            if self.installed {
+                return Ok(CommandOutput {
+                    exit_code: 0,
+                    stdout: "1.0.0".into(),
+                    stderr: String::new(),
+                });
+            }
+            Err(DodotError::CommandFailed {
+                command: format!("{executable} {}", arguments.join(" ")),
+                exit_code: -1,
+                stderr: "No such file or directory".into(),
+                stdout: String::new(),
+            })
+        }
+    }
+
+    #[test]
+    fn missing_tool_fails_planning_with_a_hint() {
+        let env = TempEnvironment::builder()
+            .pack("rust")
+            .file("cargo-crates.txt", "ripgrep\n")
+            .done()
+            .build();
+        let m = RuleMatch {
+            relative_path: "cargo-crates.txt".into(),
+            absolute_path: env.dotfiles_root.join("rust/cargo-crates.txt"),
+            pack: "rust".into(),
+            handler: HANDLER_CARGO.into(),
+            is_dir: false,
+            options: Default::default(),
+            preprocessor_source: None,
+            rendered_bytes: None,
+        };
+        let plan = |runner: &dyn CommandRunner| {
+            RunOnceHandler::new(env.fs.as_ref(), runner, PackagesCommand(PackageTool::Cargo))
+                .to_intents(
+                    std::slice::from_ref(&m),
+                    &HandlerConfig::default(),
+                    env.paths.as_ref(),
+                    env.fs.as_ref(),
+                )
+        };
+
+        let err = plan(&ProbeRunner { installed: false })
+            .unwrap_err()
+            .to_string();
+        assert!(err.contains("needs `cargo`"), "{err}");
+        assert!(err.contains("rustup"), "{err}");
+
+        let intents = plan(&ProbeRunner { installed: true }).unwrap();
+        match &intents[0] {
+            HandlerIntent::Run {
+                executable,
+                sentinel,
+                ..
+            } => {
+                assert_eq!(executable, "sh");
+                assert!(sentinel.starts_with("cargo-crates.txt-"), "{sentinel}");
+            }
+            other => panic!("expected Run, got {other:?}"),
+        }
+    }
+}
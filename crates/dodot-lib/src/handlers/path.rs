@@ -1,4 +1,11 @@
 //! Path handler — stages directories for addition to $PATH via dodot-init.sh.
+//!
+//! A matched directory (`bin/`) goes on `$PATH` as a whole. A matched
+//! file — an executable at the pack root, routed here by
+//! `mappings.executable` — is linked into the pack's path data dir,
+//! which goes on `$PATH` in its place. A file deeper in the pack
+//! (`bin/script.sh`, say, if a rule mis-matches one) is never staged
+//! on its own; it reaches `$PATH` through its directory.
 
 use std::path::Path;
 
@@ -30,7 +37,7 @@ impl Handler for PathHandler {
     ) -> Result<Vec<HandlerIntent>> {
         Ok(matches
             .iter()
-            .filter(|m| m.is_dir)
+            .filter(|m| m.is_dir || at_pack_root(m))
             .map(|m| HandlerIntent::Stage {
                 pack: m.pack.clone(),
                 handler: HANDLER_PATH.into(),
@@ -59,6 +66,13 @@ impl Handler for PathHandler {
     }
 }
 
+/// Whether `m` sits directly in the pack directory.
+fn at_pack_root(m: &RuleMatch) -> bool {
+    m.relative_path
+        .parent()
+        .is_none_or(|p| p.as_os_str().is_empty())
+}
+
 #[cfg(test)]
 mod tests {
     use super::*;
@@ -137,12 +151,14 @@ mod tests {
     }
 
     #[test]
-    fn to_intents_drops_non_directory_matches() {
-        // The path handler should not stage a regular file even if a
-        // rule (mis-)matched one — only directories get added to $PATH.
+    fn to_intents_stages_matched_files_too() {
+        // An executable at the pack root is staged on its own, next to
+        // the pack's `bin/`; a file inside `bin/` is not, even if a
+        // rule (mis-)matched it — the directory already covers it.
         let env = TempEnvironment::builder()
             .pack("dev")
             .file("bin/script.sh", "echo hi")
+            .file("deploy", "echo deploy")
             .done()
             .build();
 
@@ -153,6 +169,7 @@ mod tests {
                 env.dotfiles_root.join("dev/bin/script.sh"),
             ),
             dir_match("dev", "bin", env.dotfiles_root.join("dev/bin")),
+            file_match("dev", "deploy", env.dotfiles_root.join("dev/deploy")),
         ];
 
         let intents = PathHandler
@@ -164,8 +181,26 @@ mod tests {
             )
             .unwrap();
 
-        assert_eq!(intents.len(), 1, "only the directory match should stage");
-        assert_eq!(intents[0].handler(), HANDLER_PATH);
+        let sources: Vec<_> = intents
+            .iter()
+            .map(|i| match i {
+                HandlerIntent::Stage {
+                    handler, source, ..
+                } => {
+                    assert_eq!(handler, HANDLER_PATH);
+                    source.clone()
+                }
+                other => panic!("expected Stage intent, got {other:?}"),
+            })
+            .collect();
+        assert_eq!(
+            sources,
+            vec![
+                env.dotfiles_root.join("dev/bin"),
+                env.dotfiles_root.join("dev/deploy"),
+            ],
+            "bin/script.sh must not be staged on its own"
+        );
     }
 
     #[test]
@@ -0,0 +1,455 @@
+//! Plugins handler — bootstrap shell/editor plugin managers and run
+//! their headless plugin install.
+//!
+//! The trigger file is `plugins.toml` at the pack root. Each table
+//! names one plugin manager dodot knows how to drive:
+//!
+//! ```toml
+//! [tpm]                 # tmux plugin manager
+//!
+//! [vim-plug]
+//! editor = "nvim"
+//!
+//! [zinit]
+//! path = "~/.zinit/bin"
+//! ```
+//!
+//! For every table the handler emits one [`HandlerIntent::Run`] whose
+//! command clones (or downloads) the manager when it's missing and
+//! then runs the manager's non-interactive install. Per-manager
+//! knowledge — default location, bootstrap, install command — lives
+//! in a small [`PluginManager`] adapter.
+//!
+//! Each manager gets its own sentinel, `<manager>-<checksum>`, hashed
+//! over that manager's table only. Editing the `[zinit]` block leaves
+//! `tpm` current; the run-once three-state policy (never ran / ran /
+//! older version) applies per manager exactly as it does for install
+//! scripts and Brewfiles.
+//!
+//! User-facing reference: `docs/user/handlers/plugins.lex`.
+
+use std::collections::BTreeMap;
+use std::path::{Path, PathBuf};
+
+use serde::Deserialize;
+
+use crate::datastore::{DataStore, DidRunStatus};
+use crate::fs::Fs;
+use crate::handlers::run_once::file_checksum_bytes;
+use crate::handlers::{
+    ExecutionPhase, Handler, HandlerConfig, HandlerStatus, MatchMode, HANDLER_PLUGINS,
+    RESOURCE_PLUGIN_MANAGERS,
+};
+use crate::operations::HandlerIntent;
+use crate::paths::{expand_tilde, Pather};
+use crate::rules::RuleMatch;
+use crate::shell::sh_quote;
+use crate::{DodotError, Result};
+
+/// Filename the handler matches against by default.
+pub const PLUGINS_TOML: &str = "plugins.toml";
+
+/// One manager's table in `plugins.toml`. Every key is optional; an
+/// empty table means "this manager, with its defaults".
+#[derive(Debug, Clone, Default, PartialEq, Eq, Deserialize)]
+#[serde(deny_unknown_fields)]
+pub struct ManagerSpec {
+    /// Where the manager lives. `~` expands to the home directory.
+    pub path: Option<String>,
+    /// Replaces the manager's headless install command.
+    pub install: Option<String>,
+    /// `vim` or `nvim`; vim-plug only.
+    pub editor: Option<String>,
+}
+
+/// Per-manager knowledge: where it lives, how to fetch it, and how to
+/// run its plugin install without a UI.
+pub trait PluginManager: Send + Sync {
+    /// The table name in `plugins.toml` (and the sentinel prefix).
+    fn name(&self) -> &'static str;
+
+    /// Install location when the spec doesn't set `path`.
+    fn default_path(&self, home: &Path, spec: &ManagerSpec) -> PathBuf;
+
+    /// Shell command that installs the manager at `$dest`.
+    fn bootstrap(&self, spec: &ManagerSpec) -> String;
+
+    /// Shell command that installs the declared plugins headlessly.
+    /// `$dest` holds the manager's location.
+    fn install(&self, spec: &ManagerSpec) -> String;
+
+    /// Reject spec keys the manager doesn't use.
+    fn check(&self, spec: &ManagerSpec) -> std::result::Result<(), String> {
+        if spec.editor.is_some() {
+            return Err("`editor` only applies to vim-plug".into());
+        }
+        Ok(())
+    }
+}
+
+/// tmux plugin manager — `git clone`, then `bin/install_plugins`.
+pub struct Tpm;
+
+impl PluginManager for Tpm {
+    fn name(&self) -> &'static str {
+        "tpm"
+    }
+
+    fn default_path(&self, home: &Path, _spec: &ManagerSpec) -> PathBuf {
+        home.join(".tmux/plugins/tpm")
+    }
+
+    fn bootstrap(&self, _spec: &ManagerSpec) -> String {
+        "git clone --depth 1 https://github.com/tmux-plugins/tpm \"$dest\"".into()
+    }
+
+    fn install(&self, _spec: &ManagerSpec) -> String {
+        "\"$dest/bin/install_plugins\"".into()
+    }
+}
+
+/// vim-plug — a single `plug.vim` in the editor's autoload dir, then
+/// `:PlugInstall --sync` from a headless editor.
+pub struct VimPlug;
+
+impl VimPlug {
+    fn is_nvim(spec: &ManagerSpec) -> bool {
+        spec.editor.as_deref() == Some("nvim")
+    }
+}
+
+impl PluginManager for VimPlug {
+    fn name(&self) -> &'static str {
+        "vim-plug"
+    }
+
+    fn default_path(&self, home: &Path, spec: &ManagerSpec) -> PathBuf {
+        if Self::is_nvim(spec) {
+            home.join(".local/share/nvim/site/autoload/plug.vim")
+        } else {
+            home.join(".vim/autoload/plug.vim")
+        }
+    }
+
+    fn bootstrap(&self, _spec: &ManagerSpec) -> String {
+        "curl -fsSLo \"$dest\" --create-dirs \
+         https://raw.githubusercontent.com/junegunn/vim-plug/master/plug.vim"
+            .into()
+    }
+
+    fn install(&self, spec: &ManagerSpec) -> String {
+        if Self::is_nvim(spec) {
+            "nvim --headless +'PlugInstall --sync' +qa".into()
+        } else {
+            "vim -E -s +'PlugInstall --sync' +qa".into()
+        }
+    }
+
+    fn check(&self, spec: &ManagerSpec) -> std::result::Result<(), String> {
+        match spec.editor.as_deref() {
+            None | Some("vim") | Some("nvim") => Ok(()),
+            Some(other) => Err(format!("editor must be \"vim\" or \"nvim\", got {other:?}")),
+        }
+    }
+}
+
+/// zinit — `git clone`, then an interactive-mode zsh that loads the
+/// user's `.zshrc`, which makes zinit fetch every declared plugin.
+pub struct Zinit;
+
+impl PluginManager for Zinit {
+    fn name(&self) -> &'static str {
+        "zinit"
+    }
+
+    fn default_path(&self, home: &Path, _spec: &ManagerSpec) -> PathBuf {
+        home.join(".local/share/zinit/zinit.git")
+    }
+
+    fn bootstrap(&self, _spec: &ManagerSpec) -> String {
+        "git clone --depth 1 https://github.com/zdharma-continuum/zinit.git \"$dest\"".into()
+    }
+
+    fn install(&self, _spec: &ManagerSpec) -> String {
+        "zsh -i -c exit".into()
+    }
+}
+
+/// Every built-in adapter.
+pub fn builtin_managers() -> Vec<Box<dyn PluginManager>> {
+    vec![Box::new(Tpm), Box::new(VimPlug), Box::new(Zinit)]
+}
+
+fn find_manager(name: &str) -> Option<Box<dyn PluginManager>> {
+    builtin_managers().into_iter().find(|m| m.name() == name)
+}
+
+/// Parse `plugins.toml` into manager name → spec. Unknown manager
+/// names and unknown keys are errors so a typo doesn't silently
+/// install nothing.
+pub fn parse_plugins_toml(bytes: &[u8]) -> Result<BTreeMap<String, (ManagerSpec, String)>> {
+    let text = std::str::from_utf8(bytes)
+        .map_err(|e| DodotError::Other(format!("{PLUGINS_TOML} is not UTF-8: {e}")))?;
+    let table: toml::Table = text
+        .parse()
+        .map_err(|e| DodotError::Other(format!("failed to parse {PLUGINS_TOML}: {e}")))?;
+
+    let mut out = BTreeMap::new();
+    for (name, value) in table {
+        let Some(manager) = find_manager(&name) else {
+            let known: Vec<&str> = builtin_managers().iter().map(|m| m.name()).collect();
+            return Err(DodotError::Other(format!(
+                "{PLUGINS_TOML}: unknown plugin manager `{name}` (supported: {})",
+                known.join(", ")
+            )));
+        };
+        let toml::Value::Table(body) = value else {
+            return Err(DodotError::Other(format!(
+                "{PLUGINS_TOML}: `{name}` must be a table, e.g. `[{name}]`"
+            )));
+        };
+        // Hash the table's canonical TOML so key order and formatting
+        // don't count as a change.
+        let canonical = toml::to_string(&body).unwrap_or_default();
+        let spec: ManagerSpec = toml::Value::Table(body)
+            .try_into()
+            .map_err(|e| DodotError::Other(format!("{PLUGINS_TOML}: [{name}]: {e}")))?;
+        manager
+            .check(&spec)
+            .map_err(|e| DodotError::Other(format!("{PLUGINS_TOML}: [{name}]: {e}")))?;
+        out.insert(name, (spec, canonical));
+    }
+    Ok(out)
+}
+
+/// The shell script that bootstraps `manager` at `dest` when missing
+/// and runs its plugin install.
+pub fn manager_script(manager: &dyn PluginManager, spec: &ManagerSpec, dest: &Path) -> String {
+    let install = spec
+        .install
+        .clone()
+        .unwrap_or_else(|| manager.install(spec));
+    format!(
+        "set -e\ndest={}\nif [ ! -e \"$dest\" ]; then\n  {}\nfi\n{}\n",
+        sh_quote(&dest.to_string_lossy()),
+        manager.bootstrap(spec),
+        install
+    )
+}
+
+/// Sentinel checksum for one manager's table.
+fn spec_checksum(name: &str, canonical: &str) -> String {
+    file_checksum_bytes(format!("{name}\n{canonical}").as_bytes())
+}
+
+pub struct PluginsHandler<'a> {
+    fs: &'a dyn Fs,
+}
+
+impl<'a> PluginsHandler<'a> {
+    pub fn new(fs: &'a dyn Fs) -> Self {
+        Self { fs }
+    }
+}
+
+impl Handler for PluginsHandler<'_> {
+    fn name(&self) -> &str {
+        HANDLER_PLUGINS
+    }
+
+    fn phase(&self) -> ExecutionPhase {
+        ExecutionPhase::Provision
+    }
+
+    /// Two packs can name the same manager, which installs into one
+    /// directory.
+    fn resources(&self) -> &'static [&'static str] {
+        &[RESOURCE_PLUGIN_MANAGERS]
+    }
+
+    fn match_mode(&self) -> MatchMode {
+        MatchMode::Precise
+    }
+
+    fn to_intents(
+        &self,
+        matches: &[RuleMatch],
+        _config: &HandlerConfig,
+        paths: &dyn Pather,
+        fs: &dyn Fs,
+    ) -> Result<Vec<HandlerIntent>> {
+        let mut intents = Vec::new();
+        for m in matches {
+            if m.is_dir {
+                continue;
+            }
+            let Some(bytes) = super::manifest_bytes(m, fs) else {
+                continue;
+            };
+
+            for (name, (spec, canonical)) in parse_plugins_toml(&bytes)? {
+                let manager = find_manager(&name).expect("parse only admits known managers");
+                let dest = match &spec.path {
+                    Some(p) => expand_tilde(p, paths.home_dir()),
+                    None => manager.default_path(paths.home_dir(), &spec),
+                };
+                let checksum = spec_checksum(&name, &canonical);
+                // `sh -c <script> <$0> <plugins.toml>`: the trailing
+                // argument is the manifest so the run header and the
+                // snapshot both point at it.
+                let arguments = vec![
+                    "-c".into(),
+                    manager_script(manager.as_ref(), &spec, &dest),
+                    format!("dodot-{name}"),
+                    m.absolute_path.to_string_lossy().into_owned(),
+                ];
+                intents.push(HandlerIntent::Run {
+                    pack: m.pack.clone(),
+                    handler: HANDLER_PLUGINS.into(),
+                    executable: "sh".into(),
+                    arguments,
+                    sentinel: format!("{name}-{checksum}"),
+                    filename: name,
+                    content_hash: checksum,
+                });
+            }
+        }
+        Ok(intents)
+    }
+
+    fn check_status(
+        &self,
+        file: &Path,
+        pack: &str,
+        datastore: &dyn DataStore,
+    ) -> Result<HandlerStatus> {
+        let managers = parse_plugins_toml(&self.fs.read_file(file)?)?;
+        let mut pending = Vec::new();
+        let mut older = Vec::new();
+        for (name, (_, canonical)) in &managers {
+            match datastore.did_run(pack, HANDLER_PLUGINS, name, &spec_checksum(name, canonical))? {
+                DidRunStatus::NeverRan => pending.push(name.as_str()),
+                DidRunStatus::RanDifferent { .. } => older.push(name.as_str()),
+                DidRunStatus::RanCurrent => {}
+            }
+        }
+        let message = if !pending.is_empty() {
+            format!("plugins not installed: {}", pending.join(", "))
+        } else if !older.is_empty() {
+            format!(
+                "plugins older version: {} (run `dodot up --provision-rerun` to apply current)",
+                older.join(", ")
+            )
+        } else {
+            "plugins installed".into()
+        };
+        Ok(HandlerStatus {
+            file: file.to_string_lossy().into_owned(),
+            handler: HANDLER_PLUGINS.into(),
+            deployed: pending.is_empty(),
+            message,
+        })
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::testing::TempEnvironment;
+    use std::collections::HashMap;
+
+    fn plan(env: &TempEnvironment, content: &str) -> Result<Vec<HandlerIntent>> {
+        let path = env.dotfiles_root.join("tmux").join(PLUGINS_TOML);
+        env.fs.write_file(&path, content.as_bytes()).unwrap();
+        let m = RuleMatch {
+            relative_path: PLUGINS_TOML.into(),
+            absolute_path: path,
+            pack: "tmux".into(),
+            handler: HANDLER_PLUGINS.into(),
+            is_dir: false,
+            options: HashMap::new(),
+            preprocessor_source: None,
+            rendered_bytes: None,
+        };
+        PluginsHandler::new(env.fs.as_ref()).to_intents(
+            &[m],
+            &HandlerConfig::default(),
+            env.paths.as_ref(),
+            env.fs.as_ref(),
+        )
+    }
+
+    #[test]
+    fn one_run_intent_per_manager_with_its_own_sentinel() {
+        let env = TempEnvironment::builder()
+            .pack("tmux")
+            .file("tmux.conf", "x")
+            .done()
+            .build();
+        let intents = plan(&env, "[tpm]\n\n[vim-plug]\neditor = \"nvim\"\n").unwrap();
+        assert_eq!(intents.len(), 2);
+
+        let HandlerIntent::Run {
+            executable,
+            arguments,
+            sentinel,
+            filename,
+            ..
+        } = &intents[0]
+        else {
+            panic!("expected Run intent");
+        };
+        assert_eq!(executable, "sh");
+        assert_eq!(filename, "tpm");
+        assert!(sentinel.starts_with("tpm-"));
+        let script = &arguments[1];
+        let dest = env.home.join(".tmux/plugins/tpm");
+        assert!(
+            script.contains(&format!("dest='{}'", dest.display())),
+            "{script}"
+        );
+        assert!(script.contains("git clone --depth 1 https://github.com/tmux-plugins/tpm"));
+        assert!(arguments.last().unwrap().ends_with("tmux/plugins.toml"));
+
+        let HandlerIntent::Run { arguments, .. } = &intents[1] else {
+            panic!("expected Run intent");
+        };
+        assert!(arguments[1].contains("nvim --headless +'PlugInstall --sync' +qa"));
+        assert!(arguments[1].contains(".local/share/nvim/site/autoload/plug.vim"));
+    }
+
+    #[test]
+    fn editing_one_manager_leaves_the_others_checksum_alone() {
+        let env = TempEnvironment::builder()
+            .pack("tmux")
+            .file("tmux.conf", "x")
+            .done()
+            .build();
+        let sentinels = |content: &str| -> Vec<String> {
+            plan(&env, content)
+                .unwrap()
+                .into_iter()
+                .map(|i| match i {
+                    HandlerIntent::Run { sentinel, .. } => sentinel,
+                    _ => unreachable!(),
+                })
+                .collect()
+        };
+        let before = sentinels("[tpm]\n[zinit]\n");
+        let after = sentinels("[tpm]\n[zinit]\npath = \"~/.zinit/bin\"\n");
+        assert_eq!(before[0], after[0]);
+        assert_ne!(before[1], after[1]);
+    }
+
+    #[test]
+    fn unknown_managers_and_keys_are_rejected() {
+        let err = parse_plugins_toml(b"[antigen]\n").unwrap_err().to_string();
+        assert!(err.contains("unknown plugin manager `antigen`"), "{err}");
+        assert!(err.contains("tpm, vim-plug, zinit"), "{err}");
+
+        let err = parse_plugins_toml(b"[tpm]\neditor = \"vim\"\n")
+            .unwrap_err()
+            .to_string();
+        assert!(err.contains("only applies to vim-plug"), "{err}");
+    }
+}
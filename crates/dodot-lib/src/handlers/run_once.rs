@@ -54,6 +54,7 @@ use sha2::{Digest, Sha256};
 
 use crate::datastore::{CommandRunner, DataStore};
 use crate::fs::Fs;
+use crate::handlers::undo::{UndoAction, UndoContext};
 use crate::handlers::{ExecutionPhase, Handler, HandlerConfig, HandlerStatus};
 use crate::operations::HandlerIntent;
 use crate::paths::Pather;
@@ -104,10 +105,55 @@ pub trait RunOnceCommand: Send + Sync {
     /// Execution phase for this handler.
     fn phase(&self) -> ExecutionPhase;
 
+    /// See [`Handler::parallel_safe`]. Defaults to `false`: run-once
+    /// commands drive package managers or user scripts, which share
+    /// locks and global state across packs.
+    fn parallel_safe(&self) -> bool {
+        false
+    }
+
     /// Build the `(executable, arguments)` tuple for invoking the
     /// command against `path`.
     fn command_for(&self, path: &Path) -> (String, Vec<String>);
 
+    /// Flags added to [`Self::command_for`] based on what sits next to
+    /// `path` on disk (e.g. `--no-upgrade` when a `Brewfile.lock.json`
+    /// pins versions). They go in ahead of the file's path — and of the
+    /// option introducing it, as in `--file <path>` — so the path stays
+    /// the last argument. Default: none. Like
+    /// [`Self::validate`], this is environmental — it must not read
+    /// `path`'s own content, which is what the sentinel hashes.
+    fn sibling_arguments(&self, _fs: &dyn Fs, _path: &Path) -> Vec<String> {
+        Vec::new()
+    }
+
+    /// Wrap the `(executable, arguments)` built from
+    /// [`Self::command_for`] in whatever `config` says the command runs
+    /// under — the install handler's `[install]` sandbox. Default:
+    /// unchanged. Wrappers must keep the file's path as the last
+    /// argument; the executor and linter look for it there.
+    fn wrap_command(
+        &self,
+        _config: &HandlerConfig,
+        _pack: &str,
+        _paths: &dyn Pather,
+        command: (String, Vec<String>),
+    ) -> (String, Vec<String>) {
+        command
+    }
+
+    /// Commands that reverse what running `path` installed, for
+    /// `dodot down --deprovision`. Default: none — an install script's
+    /// side effects are opaque to dodot. `runner` may be used to ask
+    /// the tool what `path` declares.
+    fn undo_commands(
+        &self,
+        _runner: &dyn CommandRunner,
+        _path: &Path,
+    ) -> Result<Vec<(String, Vec<String>)>> {
+        Ok(Vec::new())
+    }
+
     /// Optional pre-flight check. Default: no-op.
     ///
     /// **Scope: environmental, not content.** See the
@@ -203,11 +249,15 @@ impl<C: RunOnceCommand> Handler for RunOnceHandler<'_, C> {
         self.cmd.phase()
     }
 
+    fn parallel_safe(&self) -> bool {
+        self.cmd.parallel_safe()
+    }
+
     fn to_intents(
         &self,
         matches: &[RuleMatch],
-        _config: &HandlerConfig,
-        _paths: &dyn Pather,
+        config: &HandlerConfig,
+        paths: &dyn Pather,
         _fs: &dyn Fs,
     ) -> Result<Vec<HandlerIntent>> {
         let mut intents = Vec::new();
@@ -265,7 +315,16 @@ impl<C: RunOnceCommand> Handler for RunOnceHandler<'_, C> {
                 .into_owned();
             let sentinel = format!("{filename}-{checksum}");
 
-            let (executable, arguments) = self.cmd.command_for(&m.absolute_path);
+            let (executable, mut arguments) = self.cmd.command_for(&m.absolute_path);
+            let siblings = self.cmd.sibling_arguments(self.fs, &m.absolute_path);
+            let mut at = arguments.len().saturating_sub(1);
+            if at > 0 && arguments[at - 1].starts_with('-') {
+                at -= 1;
+            }
+            arguments.splice(at..at, siblings);
+            let (executable, arguments) =
+                self.cmd
+                    .wrap_command(config, &m.pack, paths, (executable, arguments));
 
             intents.push(HandlerIntent::Run {
                 pack: m.pack.clone(),
@@ -324,6 +383,29 @@ impl<C: RunOnceCommand> Handler for RunOnceHandler<'_, C> {
             message,
         })
     }
+
+    /// With `--deprovision`, the command's own reverse
+    /// ([`RunOnceCommand::undo_commands`]) for each planned file, then
+    /// the sentinel cleanup.
+    fn undo_actions(&self, cx: &UndoContext) -> Result<Vec<UndoAction>> {
+        let mut actions = Vec::new();
+        if cx.deprovision {
+            for intent in cx.intents {
+                let HandlerIntent::Run { filename, .. } = intent else {
+                    continue;
+                };
+                let path = cx.pack_path.join(filename);
+                for (executable, arguments) in self.cmd.undo_commands(self.runner, &path)? {
+                    actions.push(UndoAction::RunCommand {
+                        executable,
+                        arguments,
+                    });
+                }
+            }
+        }
+        actions.push(UndoAction::ClearState);
+        Ok(actions)
+    }
 }
 
 /// Canonical run-state copy for a [`RunOnceCommand`] — used by
@@ -367,6 +449,12 @@ pub fn run_once_status_messages(handler: &str) -> RunOnceStatusMessages {
     if handler == HANDLER_NIX {
         return status_messages_for(&crate::handlers::nix::NixCommand);
     }
+    if let Some(tool) = crate::handlers::packages::PackageTool::ALL
+        .into_iter()
+        .find(|t| t.handler_name() == handler)
+    {
+        return status_messages_for(&crate::handlers::packages::PackagesCommand(tool));
+    }
     RunOnceStatusMessages {
         pending: "never ran".into(),
         deployed: "ran".into(),
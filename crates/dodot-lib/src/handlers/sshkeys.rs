@@ -0,0 +1,422 @@
+//! SSH keys handler — generate missing keypairs during provisioning.
+//!
+//! The trigger file is `sshkeys.toml` at the pack root. Each table
+//! names one keypair the machine should have:
+//!
+//! ```toml
+//! [github]
+//! comment = "ada@laptop"
+//!
+//! [work]
+//! type = "rsa"
+//! bits = 4096
+//! path = "~/.ssh/id_work"
+//! agent = true
+//! ```
+//!
+//! For every table the handler emits one [`HandlerIntent::Run`] whose
+//! script runs `ssh-keygen` only when the private key is missing,
+//! tightens permissions (`0600` private, `0644` public, `0700` for a
+//! key directory it creates), optionally loads the key into the agent
+//! (the macOS keychain too), and prints the public key as a
+//! `# status:` line so it can be pasted into GitHub and friends.
+//!
+//! Private keys never touch the repo: the manifest only describes
+//! keys, and a `path` inside the dotfiles root is rejected. Existing
+//! keys are never overwritten, and `dodot down` leaves them alone.
+//!
+//! Sentinels are per key, `<name>-<checksum>` over that key's table,
+//! with the same run-once three-state policy as [`crate::handlers::plugins`].
+//!
+//! User-facing reference: `docs/user/handlers/sshkeys.lex`.
+
+use std::collections::BTreeMap;
+use std::path::{Path, PathBuf};
+
+use serde::Deserialize;
+
+use crate::datastore::{DataStore, DidRunStatus};
+use crate::fs::Fs;
+use crate::handlers::run_once::file_checksum_bytes;
+use crate::handlers::{
+    ExecutionPhase, Handler, HandlerConfig, HandlerStatus, MatchMode, HANDLER_SSHKEYS,
+    RESOURCE_SSH_AGENT,
+};
+use crate::operations::HandlerIntent;
+use crate::paths::{expand_tilde, Pather};
+use crate::rules::RuleMatch;
+use crate::shell::sh_quote;
+use crate::{DodotError, Result};
+
+/// Filename the handler matches against by default.
+pub const SSHKEYS_TOML: &str = "sshkeys.toml";
+
+/// Key types `ssh-keygen -t` accepts that we allow.
+const KEY_TYPES: &[&str] = &["ed25519", "rsa", "ecdsa"];
+
+/// One key's table in `sshkeys.toml`. Every key is optional; an empty
+/// table means "an ed25519 key with ssh-keygen's default comment".
+#[derive(Debug, Clone, Default, PartialEq, Eq, Deserialize)]
+#[serde(deny_unknown_fields)]
+pub struct KeySpec {
+    /// `ed25519` (default), `rsa` or `ecdsa`.
+    #[serde(rename = "type")]
+    pub key_type: Option<String>,
+    /// Key size; `rsa` and `ecdsa` only.
+    pub bits: Option<u32>,
+    /// Public-key comment. ssh-keygen defaults to `user@host`.
+    pub comment: Option<String>,
+    /// Private key location. `~` expands to the home directory.
+    /// Default `~/.ssh/id_<type>_<name>`.
+    pub path: Option<String>,
+    /// Load the key into `ssh-agent` (and the keychain on macOS).
+    #[serde(default)]
+    pub agent: bool,
+    /// Ask for a passphrase on the terminal instead of generating an
+    /// unencrypted key.
+    #[serde(default)]
+    pub passphrase: bool,
+}
+
+impl KeySpec {
+    fn key_type(&self) -> &str {
+        self.key_type.as_deref().unwrap_or("ed25519")
+    }
+
+    fn check(&self) -> std::result::Result<(), String> {
+        let t = self.key_type();
+        if !KEY_TYPES.contains(&t) {
+            return Err(format!(
+                "type must be one of {}, got {t:?}",
+                KEY_TYPES.join(", ")
+            ));
+        }
+        if self.bits.is_some() && t == "ed25519" {
+            return Err("`bits` does not apply to ed25519 keys".into());
+        }
+        Ok(())
+    }
+}
+
+/// Parse `sshkeys.toml` into key name → (spec, canonical table).
+/// Unknown keys are errors so a typo doesn't silently generate a key
+/// with the wrong settings.
+pub fn parse_sshkeys_toml(bytes: &[u8]) -> Result<BTreeMap<String, (KeySpec, String)>> {
+    let text = std::str::from_utf8(bytes)
+        .map_err(|e| DodotError::Other(format!("{SSHKEYS_TOML} is not UTF-8: {e}")))?;
+    let table: toml::Table = text
+        .parse()
+        .map_err(|e| DodotError::Other(format!("failed to parse {SSHKEYS_TOML}: {e}")))?;
+
+    let mut out = BTreeMap::new();
+    for (name, value) in table {
+        if name.is_empty()
+            || !name
+                .chars()
+                .all(|c| c.is_ascii_alphanumeric() || c == '-' || c == '_')
+        {
+            return Err(DodotError::Other(format!(
+                "{SSHKEYS_TOML}: key name `{name}` may only use letters, digits, `-` and `_`"
+            )));
+        }
+        let toml::Value::Table(body) = value else {
+            return Err(DodotError::Other(format!(
+                "{SSHKEYS_TOML}: `{name}` must be a table, e.g. `[{name}]`"
+            )));
+        };
+        // Hash the table's canonical TOML so key order and formatting
+        // don't count as a change.
+        let canonical = toml::to_string(&body).unwrap_or_default();
+        let spec: KeySpec = toml::Value::Table(body)
+            .try_into()
+            .map_err(|e| DodotError::Other(format!("{SSHKEYS_TOML}: [{name}]: {e}")))?;
+        spec.check()
+            .map_err(|e| DodotError::Other(format!("{SSHKEYS_TOML}: [{name}]: {e}")))?;
+        out.insert(name, (spec, canonical));
+    }
+    Ok(out)
+}
+
+/// Where the private key for `name` lives.
+pub fn key_path(name: &str, spec: &KeySpec, home: &Path) -> PathBuf {
+    match &spec.path {
+        Some(p) => expand_tilde(p, home),
+        None => home
+            .join(".ssh")
+            .join(format!("id_{}_{name}", spec.key_type())),
+    }
+}
+
+/// The shell script that generates the key at `key` when missing,
+/// fixes permissions, optionally adds it to the agent, and prints the
+/// public key.
+pub fn key_script(spec: &KeySpec, key: &Path) -> String {
+    let mut keygen = format!("ssh-keygen -q -t {}", spec.key_type());
+    if let Some(bits) = spec.bits {
+        keygen.push_str(&format!(" -b {bits}"));
+    }
+    if let Some(comment) = &spec.comment {
+        keygen.push_str(&format!(" -C {}", sh_quote(comment)));
+    }
+    keygen.push_str(" -f \"$key\"");
+    if !spec.passphrase {
+        keygen.push_str(" -N ''");
+    }
+
+    let mut script = format!(
+        "set -e\nkey={}\ndir=$(dirname \"$key\")\n\
+         if [ ! -d \"$dir\" ]; then mkdir -p \"$dir\"; chmod 700 \"$dir\"; fi\n\
+         if [ ! -e \"$key\" ]; then {keygen}; fi\n\
+         chmod 600 \"$key\"\n\
+         if [ -e \"$key.pub\" ]; then chmod 644 \"$key.pub\"; fi\n",
+        sh_quote(&key.to_string_lossy()),
+    );
+    if spec.agent {
+        let keychain = if cfg!(target_os = "macos") {
+            " --apple-use-keychain"
+        } else {
+            ""
+        };
+        script.push_str(&format!(
+            "ssh-add{keychain} \"$key\" || echo \"# status: could not add $key to ssh-agent (is one running?)\"\n"
+        ));
+    }
+    script.push_str("if [ -e \"$key.pub\" ]; then echo \"# status: $(cat \"$key.pub\")\"; fi\n");
+    script
+}
+
+/// Sentinel checksum for one key's table.
+fn spec_checksum(name: &str, canonical: &str) -> String {
+    file_checksum_bytes(format!("{name}\n{canonical}").as_bytes())
+}
+
+pub struct SshKeysHandler<'a> {
+    fs: &'a dyn Fs,
+}
+
+impl<'a> SshKeysHandler<'a> {
+    pub fn new(fs: &'a dyn Fs) -> Self {
+        Self { fs }
+    }
+}
+
+impl Handler for SshKeysHandler<'_> {
+    fn name(&self) -> &str {
+        HANDLER_SSHKEYS
+    }
+
+    fn phase(&self) -> ExecutionPhase {
+        ExecutionPhase::Provision
+    }
+
+    /// `ssh-add` talks to the one agent the `agent` handler manages.
+    fn resources(&self) -> &'static [&'static str] {
+        &[RESOURCE_SSH_AGENT]
+    }
+
+    fn match_mode(&self) -> MatchMode {
+        MatchMode::Precise
+    }
+
+    fn to_intents(
+        &self,
+        matches: &[RuleMatch],
+        _config: &HandlerConfig,
+        paths: &dyn Pather,
+        fs: &dyn Fs,
+    ) -> Result<Vec<HandlerIntent>> {
+        let mut intents = Vec::new();
+        for m in matches {
+            if m.is_dir {
+                continue;
+            }
+            let Some(bytes) = super::manifest_bytes(m, fs) else {
+                continue;
+            };
+
+            for (name, (spec, canonical)) in parse_sshkeys_toml(&bytes)? {
+                let key = key_path(&name, &spec, paths.home_dir());
+                if key.starts_with(paths.dotfiles_root()) {
+                    return Err(DodotError::Other(format!(
+                        "{SSHKEYS_TOML}: [{name}]: path {} is inside the dotfiles repo; \
+                         private keys must live outside it",
+                        key.display()
+                    )));
+                }
+                let checksum = spec_checksum(&name, &canonical);
+                // `sh -c <script> <$0> <sshkeys.toml>`: the trailing
+                // argument is the manifest so the run header and the
+                // snapshot both point at it — never at the key.
+                let arguments = vec![
+                    "-c".into(),
+                    key_script(&spec, &key),
+                    format!("dodot-sshkey-{name}"),
+                    m.absolute_path.to_string_lossy().into_owned(),
+                ];
+                intents.push(HandlerIntent::Run {
+                    pack: m.pack.clone(),
+                    handler: HANDLER_SSHKEYS.into(),
+                    executable: "sh".into(),
+                    arguments,
+                    sentinel: format!("{name}-{checksum}"),
+                    filename: name,
+                    content_hash: checksum,
+                });
+            }
+        }
+        Ok(intents)
+    }
+
+    fn check_status(
+        &self,
+        file: &Path,
+        pack: &str,
+        datastore: &dyn DataStore,
+    ) -> Result<HandlerStatus> {
+        let keys = parse_sshkeys_toml(&self.fs.read_file(file)?)?;
+        let mut pending = Vec::new();
+        let mut older = Vec::new();
+        for (name, (_, canonical)) in &keys {
+            match datastore.did_run(pack, HANDLER_SSHKEYS, name, &spec_checksum(name, canonical))? {
+                DidRunStatus::NeverRan => pending.push(name.as_str()),
+                DidRunStatus::RanDifferent { .. } => older.push(name.as_str()),
+                DidRunStatus::RanCurrent => {}
+            }
+        }
+        let message = if !pending.is_empty() {
+            format!("ssh keys not generated: {}", pending.join(", "))
+        } else if !older.is_empty() {
+            format!(
+                "ssh keys older version: {} (run `dodot up --provision-rerun` to apply current)",
+                older.join(", ")
+            )
+        } else {
+            "ssh keys generated".into()
+        };
+        Ok(HandlerStatus {
+            file: file.to_string_lossy().into_owned(),
+            handler: HANDLER_SSHKEYS.into(),
+            deployed: pending.is_empty(),
+            message,
+        })
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::testing::TempEnvironment;
+    use std::collections::HashMap;
+
+    fn plan(env: &TempEnvironment, content: &str) -> Result<Vec<HandlerIntent>> {
+        let path = env.dotfiles_root.join("ssh").join(SSHKEYS_TOML);
+        env.fs.write_file(&path, content.as_bytes()).unwrap();
+        let m = RuleMatch {
+            relative_path: SSHKEYS_TOML.into(),
+            absolute_path: path,
+            pack: "ssh".into(),
+            handler: HANDLER_SSHKEYS.into(),
+            is_dir: false,
+            options: HashMap::new(),
+            preprocessor_source: None,
+            rendered_bytes: None,
+        };
+        SshKeysHandler::new(env.fs.as_ref()).to_intents(
+            &[m],
+            &HandlerConfig::default(),
+            env.paths.as_ref(),
+            env.fs.as_ref(),
+        )
+    }
+
+    fn env() -> TempEnvironment {
+        TempEnvironment::builder()
+            .pack("ssh")
+            .file("config", "Host *")
+            .done()
+            .build()
+    }
+
+    #[test]
+    fn one_run_intent_per_key_defaulting_to_ed25519() {
+        let env = env();
+        let intents = plan(&env, "[github]\ncomment = \"ada@laptop\"\n\n[work]\ntype = \"rsa\"\nbits = 4096\nagent = true\n").unwrap();
+        assert_eq!(intents.len(), 2);
+
+        let HandlerIntent::Run {
+            executable,
+            arguments,
+            sentinel,
+            filename,
+            ..
+        } = &intents[0]
+        else {
+            panic!("expected Run intent");
+        };
+        assert_eq!(executable, "sh");
+        assert_eq!(filename, "github");
+        assert!(sentinel.starts_with("github-"));
+        let script = &arguments[1];
+        let key = env.home.join(".ssh/id_ed25519_github");
+        assert!(
+            script.contains(&format!("key='{}'", key.display())),
+            "{script}"
+        );
+        assert!(
+            script.contains("ssh-keygen -q -t ed25519 -C 'ada@laptop' -f \"$key\" -N ''"),
+            "{script}"
+        );
+        assert!(!script.contains("ssh-add"), "{script}");
+        // The manifest, not the key, is the trailing argument.
+        assert!(arguments.last().unwrap().ends_with(SSHKEYS_TOML));
+
+        let HandlerIntent::Run { arguments, .. } = &intents[1] else {
+            panic!("expected Run intent");
+        };
+        assert!(arguments[1].contains("-t rsa -b 4096"), "{}", arguments[1]);
+        assert!(arguments[1].contains("ssh-add"), "{}", arguments[1]);
+    }
+
+    #[test]
+    fn existing_keys_are_never_regenerated() {
+        let spec = KeySpec::default();
+        let script = key_script(&spec, Path::new("/home/ada/.ssh/id"));
+        assert!(script.contains("if [ ! -e \"$key\" ]; then ssh-keygen"));
+    }
+
+    #[test]
+    fn key_path_inside_repo_is_rejected() {
+        let env = env();
+        let err = plan(&env, "[oops]\npath = \"~/dotfiles/ssh/id_oops\"\n").unwrap_err();
+        assert!(
+            err.to_string().contains("inside the dotfiles repo"),
+            "{err}"
+        );
+    }
+
+    #[test]
+    fn invalid_specs_are_errors() {
+        let env = env();
+        for bad in [
+            "[k]\ntype = \"dsa\"\n",
+            "[k]\nbits = 256\n",
+            "[k]\ncolour = \"red\"\n",
+            "[\"bad name\"]\n",
+        ] {
+            assert!(plan(&env, bad).is_err(), "accepted: {bad}");
+        }
+    }
+
+    #[test]
+    fn sentinels_are_per_key() {
+        let env = env();
+        let a = plan(&env, "[github]\n\n[work]\n").unwrap();
+        let b = plan(&env, "[github]\n\n[work]\ncomment = \"x\"\n").unwrap();
+        let sentinel = |i: &HandlerIntent| match i {
+            HandlerIntent::Run { sentinel, .. } => sentinel.clone(),
+            _ => unreachable!(),
+        };
+        assert_eq!(sentinel(&a[0]), sentinel(&b[0]));
+        assert_ne!(sentinel(&a[1]), sentinel(&b[1]));
+    }
+}
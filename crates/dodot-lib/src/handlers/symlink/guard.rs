@@ -0,0 +1,147 @@
+//! Large-file guard — catches junk the catchall is about to link.
+//!
+//! The symlink handler claims everything nothing else did, so a disk
+//! image, a database dump or a build artifact committed by accident
+//! would be linked into `$HOME` like any dotfile. Before linking a
+//! file, the handler asks [`oversized`] whether it is larger than
+//! `[symlink] max_file_size_mb`, or binary and larger than
+//! `[symlink] max_binary_size_kb`. What happens then is
+//! `[symlink] large_files`: `warn` (link it, say so), `skip` (don't
+//! link it, say so) or `off` (don't check).
+//!
+//! "Binary" is a NUL byte in the first [`SNIFF_BYTES`] bytes — the
+//! same heuristic git uses. Small binaries (a binary plist, an icon)
+//! stay under the binary threshold and pass.
+
+use std::io::Read;
+use std::path::Path;
+
+use serde::Serialize;
+
+use crate::fs::Fs;
+
+/// How much of a file to read when deciding whether it is binary.
+pub const SNIFF_BYTES: usize = 8000;
+
+/// `[symlink] large_files`.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Default, Serialize)]
+#[serde(rename_all = "lowercase")]
+pub enum LargeFiles {
+    /// Link the file and warn.
+    #[default]
+    Warn,
+    /// Leave the file unlinked and warn.
+    Skip,
+    /// No check.
+    Off,
+}
+
+impl LargeFiles {
+    /// Parse the `[symlink] large_files` config value.
+    pub fn parse(s: &str) -> Option<Self> {
+        match s {
+            "warn" => Some(Self::Warn),
+            "skip" => Some(Self::Skip),
+            "off" => Some(Self::Off),
+            _ => None,
+        }
+    }
+}
+
+/// Why `path` trips the guard (`"2.1 GB"`, `"binary, 3.4 MB"`), or
+/// `None` when it passes. A limit of 0 disables that check; files that
+/// can't be read pass, leaving the error to the link itself.
+pub fn oversized(fs: &dyn Fs, path: &Path, max_size: u64, max_binary_size: u64) -> Option<String> {
+    let len = fs.stat(path).ok()?.len;
+    if max_size > 0 && len > max_size {
+        return Some(human_size(len));
+    }
+    if max_binary_size > 0 && len > max_binary_size && is_binary(fs, path) {
+        return Some(format!("binary, {}", human_size(len)));
+    }
+    None
+}
+
+/// Whether the start of `path` contains a NUL byte.
+fn is_binary(fs: &dyn Fs, path: &Path) -> bool {
+    let Ok(reader) = fs.open_read(path) else {
+        return false;
+    };
+    let mut head = Vec::with_capacity(SNIFF_BYTES);
+    if reader
+        .take(SNIFF_BYTES as u64)
+        .read_to_end(&mut head)
+        .is_err()
+    {
+        return false;
+    }
+    head.contains(&0)
+}
+
+/// `1536` → `"1.5 KB"`. Binary units, one decimal.
+pub fn human_size(bytes: u64) -> String {
+    const UNITS: [&str; 4] = ["KB", "MB", "GB", "TB"];
+    if bytes < 1024 {
+        return format!("{bytes} B");
+    }
+    let mut value = bytes as f64 / 1024.0;
+    let mut unit = 0;
+    while value >= 1024.0 && unit + 1 < UNITS.len() {
+        value /= 1024.0;
+        unit += 1;
+    }
+    format!("{value:.1} {}", UNITS[unit])
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::testing::TempEnvironment;
+
+    #[test]
+    fn size_and_binary_limits_are_checked_separately() {
+        let text = "x".repeat(4096);
+        let mut blob = vec![0u8; 4096];
+        blob[0] = b'P';
+        let env = TempEnvironment::builder()
+            .pack("junk")
+            .file("notes.txt", &text)
+            .file("small.plist", "bplist00\0\0")
+            .done()
+            .build();
+        let pack = env.dotfiles_root.join("junk");
+        env.fs.write_file(&pack.join("dump.bin"), &blob).unwrap();
+        let fs = env.fs.as_ref();
+
+        // Text passes the binary check whatever its size…
+        assert_eq!(oversized(fs, &pack.join("notes.txt"), 0, 1024), None);
+        // …but not the plain size limit.
+        assert_eq!(
+            oversized(fs, &pack.join("notes.txt"), 1024, 0).as_deref(),
+            Some("4.0 KB")
+        );
+        assert_eq!(
+            oversized(fs, &pack.join("dump.bin"), 0, 1024).as_deref(),
+            Some("binary, 4.0 KB")
+        );
+        // A small binary stays under the binary threshold.
+        assert_eq!(oversized(fs, &pack.join("small.plist"), 0, 1024), None);
+        assert_eq!(oversized(fs, &pack.join("dump.bin"), 0, 0), None);
+    }
+
+    #[test]
+    fn human_size_uses_binary_units() {
+        assert_eq!(human_size(12), "12 B");
+        assert_eq!(human_size(1536), "1.5 KB");
+        assert_eq!(human_size(50 * 1024 * 1024), "50.0 MB");
+        assert_eq!(human_size(3 * 1024 * 1024 * 1024), "3.0 GB");
+    }
+
+    #[test]
+    fn large_files_parses_its_three_values() {
+        assert_eq!(LargeFiles::parse("warn"), Some(LargeFiles::Warn));
+        assert_eq!(LargeFiles::parse("skip"), Some(LargeFiles::Skip));
+        assert_eq!(LargeFiles::parse("off"), Some(LargeFiles::Off));
+        assert_eq!(LargeFiles::parse("block"), None);
+    }
+}
@@ -3,7 +3,9 @@
 //! Creates double-link chains from source files to user-visible locations.
 //! Target resolution priority (highest first):
 //!
-//! 0. **Custom target** from `[symlink.targets]` config
+//! 0. **Custom target** from a `[[rules]]` `target` option or
+//!    `[symlink.targets]` config; a rule's `dot_prefix = true` routes
+//!    its matches as if they sat under `_home/`
 //! 1. **File-level prefixes** (top-level files only, skip pack namespace):
 //!    a. `home.X` → `$HOME/.X`
 //!    b. `app.X`  → `<app_support_dir>/X`
@@ -38,6 +40,12 @@
 //! than silently letting `targets` win. Two ways to say where one file
 //! goes is bug-bait — the user must pick one.
 //!
+//! Whatever the resolved path, a rule's `target_name` (for the match
+//! itself) or `rename` map (per source name) replaces its last
+//! component, so `gitconfig` in the repo can deploy as `.gitconfig`.
+//! Its `chmod` / `chown` options ride along on the intents; the
+//! executor applies them after deploying (see [`crate::perms`]).
+//!
 //! See `docs/proposals/macos-paths.lex` for the full rationale behind
 //! the third coordinate (`app_support_dir`) and the `_app/` / `_lib/`
 //! prefix family.
@@ -46,14 +54,24 @@ use std::path::{Path, PathBuf};
 
 use crate::datastore::DataStore;
 use crate::fs::Fs;
+use crate::handlers::options::{
+    parse_map_option, OPTION_DOT_PREFIX, OPTION_MODE, OPTION_RENAME, OPTION_TARGET,
+    OPTION_TARGET_NAME,
+};
+use crate::handlers::undo::{links_into, UndoAction, UndoContext};
 use crate::handlers::{
     ExecutionPhase, Handler, HandlerConfig, HandlerScope, HandlerStatus, MatchMode, HANDLER_SYMLINK,
 };
-use crate::operations::HandlerIntent;
+use crate::operations::{HandlerIntent, LinkMode};
 use crate::paths::Pather;
+use crate::perms::Perms;
 use crate::rules::RuleMatch;
 use crate::Result;
 
+pub mod guard;
+
+use guard::LargeFiles;
+
 pub struct SymlinkHandler;
 
 impl Handler for SymlinkHandler {
@@ -89,8 +107,54 @@ impl Handler for SymlinkHandler {
             if is_protected(&rel_str, &config.protected_paths) {
                 continue;
             }
+            // `warnings_for_matches` says why the file was left out.
+            if config.large_files == LargeFiles::Skip && guarded(m, config, fs).is_some() {
+                continue;
+            }
+
+            // `[[rules]]` options: `mode` overrides `[symlink] mode` for
+            // this match; `target` pins the whole match (file or
+            // directory, linked wholesale) to one path.
+            let overridden;
+            let config = match m.options.get(OPTION_MODE).and_then(|v| LinkMode::parse(v)) {
+                Some(link_mode) => {
+                    overridden = HandlerConfig {
+                        link_mode,
+                        ..config.clone()
+                    };
+                    &overridden
+                }
+                None => config,
+            };
+            if let Some(target) = m.options.get(OPTION_TARGET) {
+                intents.push(HandlerIntent::Link {
+                    pack: m.pack.clone(),
+                    handler: HANDLER_SYMLINK.into(),
+                    source: m.absolute_path.clone(),
+                    user_path: custom_target_path(target, paths),
+                    mode: config.link_mode,
+                    perms: Perms::from_options(&m.options),
+                });
+                continue;
+            }
 
-            if m.is_dir {
+            let first = intents.len();
+            if m.options.get(OPTION_DOT_PREFIX).map(String::as_str) == Some("true") {
+                // Linked wholesale, like `target`: the rule chose the
+                // location for everything it matched.
+                if let Resolution::Path(user_path) =
+                    resolve_target_full(&m.pack, &format!("_home/{rel_str}"), config, paths)
+                {
+                    intents.push(HandlerIntent::Link {
+                        pack: m.pack.clone(),
+                        handler: HANDLER_SYMLINK.into(),
+                        source: m.absolute_path.clone(),
+                        user_path,
+                        mode: config.link_mode,
+                        perms: None,
+                    });
+                }
+            } else if m.is_dir {
                 intents.extend(dir_intents(m, config, paths, fs)?);
             } else {
                 check_routing_conflict(&m.pack, &rel_str, config)?;
@@ -100,6 +164,8 @@ impl Handler for SymlinkHandler {
                         handler: HANDLER_SYMLINK.into(),
                         source: m.absolute_path.clone(),
                         user_path,
+                        mode: config.link_mode,
+                        perms: None,
                     }),
                     Resolution::Skip { .. } => {
                         // `_lib/` on non-macOS — silently skipped here;
@@ -108,6 +174,8 @@ impl Handler for SymlinkHandler {
                     }
                 }
             }
+            rename_targets(m, &mut intents[first..]);
+            set_perms(m, &mut intents[first..]);
         }
 
         Ok(intents)
@@ -118,16 +186,29 @@ impl Handler for SymlinkHandler {
         matches: &[RuleMatch],
         config: &HandlerConfig,
         paths: &dyn Pather,
+        fs: &dyn Fs,
     ) -> Vec<String> {
-        if cfg!(target_os = "macos") {
-            return Vec::new();
-        }
         let mut out = Vec::new();
         for m in matches {
             let rel_str = m.relative_path.to_string_lossy();
             if is_protected(&rel_str, &config.protected_paths) {
                 continue;
             }
+            if let Some(reason) = guarded(m, config, fs) {
+                let outcome = match config.large_files {
+                    LargeFiles::Skip => "not linked",
+                    _ => "linked anyway",
+                };
+                out.push(format!(
+                    "warning: pack `{}` contains `{rel_str}` ({reason}), too large to \
+                     be a dotfile — {outcome}; ignore it in the pack or set \
+                     `[symlink] large_files`",
+                    m.pack
+                ));
+            }
+            if cfg!(target_os = "macos") {
+                continue;
+            }
             // Surface a single warning per macOS-only entry, covering
             // both the per-subtree `_lib/` directory prefix and the
             // top-level `lib.X` file prefix. The resolver returns
@@ -174,6 +255,84 @@ impl Handler for SymlinkHandler {
             },
         })
     }
+
+    /// Remove every planned user link that still points into this
+    /// pack's symlink data dir, then clear the state. Copies and hard
+    /// links (`mode = "copy"` / `"hardlink"`) can't be told apart from
+    /// user files and stay.
+    fn undo_actions(&self, cx: &UndoContext) -> Result<Vec<UndoAction>> {
+        let mut actions: Vec<UndoAction> = cx
+            .intents
+            .iter()
+            .filter_map(|intent| match intent {
+                HandlerIntent::Link { user_path, .. }
+                    if links_into(cx.fs, user_path, cx.handler_dir) =>
+                {
+                    Some(UndoAction::RemoveUserLink {
+                        path: user_path.clone(),
+                    })
+                }
+                _ => None,
+            })
+            .collect();
+        actions.push(UndoAction::ClearState);
+        Ok(actions)
+    }
+}
+
+/// Apply a rule's `target_name` / `rename` options to the Link intents
+/// planned for `m`. `target_name` names the match itself; `rename`
+/// keys are pack-relative paths or bare file names, so one rule can
+/// rename files it reaches by recursing into a directory.
+fn rename_targets(m: &RuleMatch, intents: &mut [HandlerIntent]) {
+    let target_name = m.options.get(OPTION_TARGET_NAME);
+    let renames = m
+        .options
+        .get(OPTION_RENAME)
+        .map(|v| parse_map_option(v))
+        .unwrap_or_default();
+    if target_name.is_none() && renames.is_empty() {
+        return;
+    }
+    let pack_root = m
+        .absolute_path
+        .ancestors()
+        .nth(m.relative_path.components().count())
+        .unwrap_or(&m.absolute_path)
+        .to_path_buf();
+    for intent in intents {
+        let HandlerIntent::Link {
+            source, user_path, ..
+        } = intent
+        else {
+            continue;
+        };
+        let own_name = target_name.filter(|_| *source == m.absolute_path).cloned();
+        let name = own_name.or_else(|| {
+            let rel = source.strip_prefix(&pack_root).ok()?.to_string_lossy();
+            let file_name = source.file_name()?.to_string_lossy();
+            renames
+                .get(rel.as_ref())
+                .or_else(|| renames.get(file_name.as_ref()))
+                .cloned()
+        });
+        if let Some(name) = name {
+            *user_path = user_path.with_file_name(name);
+        }
+    }
+}
+
+/// Attach a rule's `chmod` / `chown` options to the Link intents
+/// planned for `m`; every file a directory rule reaches gets them.
+fn set_perms(m: &RuleMatch, intents: &mut [HandlerIntent]) {
+    let Some(wanted) = Perms::from_options(&m.options) else {
+        return;
+    };
+    for intent in intents {
+        if let HandlerIntent::Link { perms, .. } = intent {
+            *perms = Some(wanted.clone());
+        }
+    }
 }
 
 /// Produce symlink intents for a directory match.
@@ -217,6 +376,8 @@ fn dir_intents(
             handler: HANDLER_SYMLINK.into(),
             source: m.absolute_path.clone(),
             user_path,
+            mode: config.link_mode,
+            perms: None,
         }]);
     }
 
@@ -267,6 +428,8 @@ fn collect_per_file_intents(
                 handler: HANDLER_SYMLINK.into(),
                 source: entry.path.clone(),
                 user_path,
+                mode: config.link_mode,
+                perms: None,
             }),
             Resolution::Skip { .. } => continue,
         }
@@ -336,6 +499,13 @@ fn strip_file_prefix(rel_path: &str) -> Option<(FilePrefix, &str)> {
     None
 }
 
+/// True when a top-level filename carries a file-level routing prefix
+/// (`home.xinitrc`). The scanner uses it to keep such files away from
+/// the executable rule: the name already says where the file goes.
+pub(crate) fn has_file_prefix(name: &str) -> bool {
+    strip_file_prefix(name).is_some()
+}
+
 /// True when `rel_path` carries any filesystem-naming routing prefix —
 /// either a file-level prefix at the top level, or a subtree directory
 /// prefix anywhere from the pack root.
@@ -420,6 +590,16 @@ pub(crate) fn resolve_target(
     }
 }
 
+/// A `[symlink.targets]` value or `target` rule option, with `~` and
+/// variables expanded: absolute paths are used as-is, relative ones
+/// resolve from `XDG_CONFIG_HOME`.
+fn custom_target_path(target: &str, paths: &dyn Pather) -> PathBuf {
+    // Config load has already rejected targets that don't expand;
+    // this only falls back for configs built in code.
+    crate::paths::expand_target(target, paths)
+        .unwrap_or_else(|_| paths.xdg_config_home().join(target))
+}
+
 /// Same as [`resolve_target`] but exposes the full [`Resolution`]
 /// outcome, including the `Skip` variant produced by `_lib/` on
 /// non-macOS platforms.
@@ -442,12 +622,7 @@ pub(crate) fn resolve_target_full(
 
     // Priority 0: Custom target override from [symlink.targets]
     if let Some(target) = config.targets.get(rel_path) {
-        if target.starts_with('/') {
-            // Absolute path — use as-is
-            return Resolution::Path(PathBuf::from(target));
-        }
-        // Relative path — resolve from XDG_CONFIG_HOME
-        return Resolution::Path(xdg_config.join(target));
+        return Resolution::Path(custom_target_path(target, paths));
     }
 
     // Priority 1: file-level prefixes (per-file opt-in, top-level only).
@@ -586,7 +761,25 @@ fn is_force_app(rel_path: &str, force_app: &[String]) -> bool {
     force_app.iter().any(|entry| entry == first_segment)
 }
 
-/// Check if a path is in the protected paths list.
+/// Why the large-file guard stops `m`, if it does. Only file matches
+/// are checked — a directory linked wholesale isn't walked — and a
+/// rule's `target` exempts its match: someone chose where it goes.
+fn guarded(m: &RuleMatch, config: &HandlerConfig, fs: &dyn Fs) -> Option<String> {
+    if config.large_files == LargeFiles::Off || m.is_dir || m.options.contains_key(OPTION_TARGET) {
+        return None;
+    }
+    guard::oversized(
+        fs,
+        &m.absolute_path,
+        config.max_file_size,
+        config.max_binary_size,
+    )
+}
+
+/// Check if a path is in the protected paths list. Entries match the
+/// path or one of its parent directories, with or without the leading
+/// dot a `home.`-less source drops; glob entries (`.ssh/id_*`) match
+/// one component per `*`.
 fn is_protected(rel_path: &str, protected_paths: &[String]) -> bool {
     let normalized = rel_path.strip_prefix("./").unwrap_or(rel_path);
     let with_dot = if !normalized.starts_with('.') {
@@ -596,6 +789,14 @@ fn is_protected(rel_path: &str, protected_paths: &[String]) -> bool {
     };
 
     for protected in protected_paths {
+        if protected.contains(['*', '?', '[']) {
+            if let Ok(pattern) = glob::Pattern::new(protected) {
+                if glob_covers(&pattern, normalized) || glob_covers(&pattern, &with_dot) {
+                    return true;
+                }
+            }
+            continue;
+        }
         // Exact match
         if protected == normalized || protected == &with_dot {
             return true;
@@ -611,5 +812,18 @@ fn is_protected(rel_path: &str, protected_paths: &[String]) -> bool {
     false
 }
 
+/// Whether `pattern` matches `path` or one of its parent directories.
+fn glob_covers(pattern: &glob::Pattern, path: &str) -> bool {
+    let options = glob::MatchOptions {
+        case_sensitive: true,
+        require_literal_separator: true,
+        require_literal_leading_dot: false,
+    };
+    path.match_indices('/')
+        .map(|(i, _)| &path[..i])
+        .chain(std::iter::once(path))
+        .any(|prefix| pattern.matches_with(prefix, options))
+}
+
 #[cfg(test)]
 mod tests;
@@ -450,8 +450,12 @@ fn lib_file_prefix_emits_warning_on_non_macos() {
     };
     let handler = SymlinkHandler;
     let config = HandlerConfig::default();
-    let warnings =
-        handler.warnings_for_matches(std::slice::from_ref(&m), &config, env.paths.as_ref());
+    let warnings = handler.warnings_for_matches(
+        std::slice::from_ref(&m),
+        &config,
+        env.paths.as_ref(),
+        env.fs.as_ref(),
+    );
 
     if cfg!(target_os = "macos") {
         assert!(
@@ -112,6 +112,101 @@ fn targets_without_prefix_is_not_a_conflict() {
     }
 }
 
+#[test]
+fn rule_options_rename_and_dot_prefix_deployed_names() {
+    let env = crate::testing::TempEnvironment::builder()
+        .pack("git")
+        .file("gitconfig", "")
+        .file("vim/vimrc", "")
+        .file("vim/colors/nord.vim", "")
+        .done()
+        .build();
+    let mut named = build_dir_match(&env, "git", "gitconfig");
+    named.is_dir = false;
+    named.options.insert("target_name".into(), "config".into());
+    let mut dotted = build_dir_match(&env, "git", "gitconfig");
+    dotted.is_dir = false;
+    dotted.options.insert("dot_prefix".into(), "true".into());
+    let mut protected_dir = build_dir_match(&env, "git", "vim");
+    protected_dir.options.insert(
+        "rename".into(),
+        r#"{"vimrc":".vimrc","vim/colors/nord.vim":"nord-dark.vim"}"#.into(),
+    );
+    let config = HandlerConfig {
+        protected_paths: vec!["vim/secret".into()],
+        ..HandlerConfig::default()
+    };
+
+    let intents = SymlinkHandler
+        .to_intents(
+            &[named, dotted, protected_dir],
+            &config,
+            env.paths.as_ref(),
+            env.fs.as_ref(),
+        )
+        .unwrap();
+    let targets: Vec<PathBuf> = intents
+        .iter()
+        .map(|i| match i {
+            HandlerIntent::Link { user_path, .. } => user_path.clone(),
+            other => panic!("expected Link, got {other:?}"),
+        })
+        .collect();
+    assert_eq!(targets[0], env.paths.xdg_config_home().join("git/config"));
+    assert_eq!(targets[1], env.home.join(".gitconfig"));
+    // Per-file mode inside the directory: each file renamed by its own key.
+    assert!(targets.contains(&env.paths.xdg_config_home().join("git/vim/.vimrc")));
+    assert!(targets.contains(
+        &env.paths
+            .xdg_config_home()
+            .join("git/vim/colors/nord-dark.vim")
+    ));
+}
+
+#[test]
+fn rule_options_pin_target_and_override_mode() {
+    let env = crate::testing::TempEnvironment::builder()
+        .pack("etc")
+        .file("hosts", "")
+        .file("themes/nord.yaml", "")
+        .done()
+        .build();
+    let mut file = build_dir_match(&env, "etc", "hosts");
+    file.is_dir = false;
+    file.options.insert("target".into(), "/etc/hosts".into());
+    file.options.insert("mode".into(), "copy".into());
+    let mut dir = build_dir_match(&env, "etc", "themes");
+    dir.options.insert("target".into(), "warp/themes".into());
+
+    let intents = SymlinkHandler
+        .to_intents(
+            &[file, dir],
+            &HandlerConfig::default(),
+            env.paths.as_ref(),
+            env.fs.as_ref(),
+        )
+        .unwrap();
+    assert_eq!(intents.len(), 2, "a directory target links wholesale");
+    match &intents[0] {
+        HandlerIntent::Link {
+            user_path, mode, ..
+        } => {
+            assert_eq!(user_path, &PathBuf::from("/etc/hosts"));
+            assert_eq!(*mode, crate::operations::LinkMode::Copy);
+        }
+        other => panic!("expected Link, got {other:?}"),
+    }
+    match &intents[1] {
+        HandlerIntent::Link {
+            user_path, mode, ..
+        } => {
+            assert_eq!(user_path, &env.paths.xdg_config_home().join("warp/themes"));
+            assert_eq!(*mode, crate::operations::LinkMode::Symlink);
+        }
+        other => panic!("expected Link, got {other:?}"),
+    }
+}
+
 #[test]
 fn has_routing_prefix_unit() {
     // File-level prefixes
@@ -340,8 +435,12 @@ fn lib_prefix_emits_warning_on_non_macos() {
     };
     let handler = SymlinkHandler;
     let config = HandlerConfig::default();
-    let warnings =
-        handler.warnings_for_matches(std::slice::from_ref(&m), &config, env.paths.as_ref());
+    let warnings = handler.warnings_for_matches(
+        std::slice::from_ref(&m),
+        &config,
+        env.paths.as_ref(),
+        env.fs.as_ref(),
+    );
 
     if cfg!(target_os = "macos") {
         assert!(
@@ -155,6 +155,18 @@ fn not_protected() {
     assert!(!is_protected("vimrc", &[".ssh/id_rsa".into()]));
 }
 
+#[test]
+fn protected_glob() {
+    let protected = [".ssh/id_*".to_string(), ".config/*/token".to_string()];
+    assert!(is_protected("ssh/id_work", &protected));
+    assert!(is_protected(".config/hub/token", &protected));
+    // A glob covers what's below a matching directory, but `*` stays
+    // within one component.
+    assert!(is_protected("ssh/id_work/key", &[".ssh/id_*".into()]));
+    assert!(!is_protected(".config/a/b/token", &protected));
+    assert!(!is_protected("ssh/config", &protected));
+}
+
 // ── force_home matching ─────────────────────────────────────
 
 #[test]
@@ -0,0 +1,489 @@
+//! System handler — install files outside `$HOME` with `sudo`.
+//!
+//! A pack's `_system/` directory mirrors the filesystem root:
+//!
+//! ```text
+//! work/_system/etc/profile.d/work.sh   →  /etc/profile.d/work.sh
+//! work/_system/etc/hosts.d/vpn         →  /etc/hosts.d/vpn
+//! ```
+//!
+//! Nothing happens unless the config opts in with `[system] enabled =
+//! true`; until then the directory is still claimed, so it is never
+//! symlinked into `$HOME`, and the pack gets a warning instead.
+//!
+//! Each file becomes one [`HandlerIntent::Run`] whose script runs
+//! `sudo` only for the operations that need it: create the parent
+//! directory, keep the file being replaced as `<target>.dodot-orig`
+//! (once — the first original is the one worth keeping), and copy the
+//! new content into place through a temporary file. With `[system]
+//! confirm` on (the default) the script asks on the terminal before
+//! touching each target; a declined or unattended file fails its run,
+//! so it stays pending and is asked about again on the next `up`.
+//!
+//! Targets under `$HOME` belong to the symlink handler and are
+//! rejected, as is anything matching `[system] protected` (sudoers,
+//! passwd, the boot partition, system binaries, …). Both are planning
+//! errors rather than skips: the pack asked for something dodot won't
+//! do.
+//!
+//! Sentinels are per target, `<target-slug>-<checksum>`, with the same
+//! run-once three-state policy as [`crate::handlers::sshkeys`]. `dodot
+//! down --deprovision` restores each `.dodot-orig`, or removes a target
+//! that didn't exist before dodot installed it.
+//!
+//! User-facing reference: `docs/user/handlers/system.lex`.
+
+use std::path::{Component, Path, PathBuf};
+
+use crate::datastore::{DataStore, DidRunStatus};
+use crate::fs::Fs;
+use crate::handlers::run_once::file_checksum_bytes;
+use crate::handlers::undo::{UndoAction, UndoContext};
+use crate::handlers::{
+    ExecutionPhase, Handler, HandlerConfig, HandlerStatus, MatchMode, HANDLER_SYSTEM,
+};
+use crate::operations::HandlerIntent;
+use crate::paths::Pather;
+use crate::rules::RuleMatch;
+use crate::{DodotError, Result};
+
+/// Suffix of the copy kept of a file the handler replaced.
+pub const ORIGINAL_SUFFIX: &str = ".dodot-orig";
+
+/// Script `$0`; `$1` is the target, `$2` the pack file.
+const SCRIPT_NAME: &str = "dodot-system";
+
+/// Asks on the terminal before the install goes ahead. Without a
+/// terminal there is nobody to ask, which counts as "no".
+const CONFIRM_STEP: &str = "\
+if ! { : </dev/tty; } 2>/dev/null; then
+  echo \"dodot: $1 needs confirmation but there is no terminal (set [system] confirm = false for unattended runs)\" >&2
+  exit 1
+fi
+printf 'dodot: install %s as root? [y/N] ' \"$1\" >/dev/tty
+read -r answer </dev/tty || answer=
+case $answer in
+  y|Y|yes|YES) ;;
+  *) echo \"dodot: declined $1; it stays pending\" >&2; exit 1 ;;
+esac
+";
+
+/// The install script. Identical content is a no-op, so a re-run
+/// after a wiped sentinel doesn't prompt or touch the file.
+pub fn install_script(confirm: bool) -> String {
+    let mut script = String::from(
+        "set -e\n\
+         if [ -f \"$1\" ] && cmp -s \"$2\" \"$1\"; then echo \"# status: $1 already current\"; exit 0; fi\n",
+    );
+    if confirm {
+        script.push_str(CONFIRM_STEP);
+    }
+    script.push_str(&format!(
+        "mode=0644\n\
+         if [ -x \"$2\" ]; then mode=0755; fi\n\
+         sudo mkdir -p \"$(dirname \"$1\")\"\n\
+         if [ -e \"$1\" ] && [ ! -e \"$1{ORIGINAL_SUFFIX}\" ]; then sudo cp -p \"$1\" \"$1{ORIGINAL_SUFFIX}\"; fi\n\
+         sudo cp \"$2\" \"$1.dodot-new\"\n\
+         sudo chmod \"$mode\" \"$1.dodot-new\"\n\
+         sudo mv -f \"$1.dodot-new\" \"$1\"\n\
+         echo \"# status: installed $1\"\n"
+    ));
+    script
+}
+
+/// The `down --deprovision` script: put the original back, or remove
+/// a target dodot created.
+pub fn restore_script() -> String {
+    format!(
+        "set -e\n\
+         if [ -e \"$1{ORIGINAL_SUFFIX}\" ]; then sudo mv -f \"$1{ORIGINAL_SUFFIX}\" \"$1\"\n\
+         elif [ -e \"$1\" ]; then sudo rm -f \"$1\"\n\
+         fi\n"
+    )
+}
+
+/// Where a file at `rel` inside the `_system/` directory installs.
+/// `None` when `rel` isn't a plain relative path.
+pub fn system_target(rel: &Path) -> Option<PathBuf> {
+    if rel.as_os_str().is_empty() || !rel.components().all(|c| matches!(c, Component::Normal(_))) {
+        return None;
+    }
+    Some(Path::new("/").join(rel))
+}
+
+/// Whether `target` is, or sits under, one of `protected`.
+pub fn is_protected_target(target: &Path, protected: &[String]) -> bool {
+    protected
+        .iter()
+        .any(|p| !p.is_empty() && target.starts_with(Path::new(p.trim_end_matches('/'))))
+}
+
+/// Sentinel/filename key for a target: its path with `/` flattened.
+fn target_slug(target: &Path) -> String {
+    target
+        .to_string_lossy()
+        .trim_start_matches('/')
+        .replace('/', "_")
+}
+
+/// Every file below `dir`, with its path relative to `dir`, skipping
+/// what the pack ignores.
+fn collect_files(
+    fs: &dyn Fs,
+    root: &Path,
+    dir: &Path,
+    ignore: &[String],
+    out: &mut Vec<(PathBuf, PathBuf)>,
+) -> Result<()> {
+    for entry in fs.read_dir(dir)? {
+        if crate::rules::should_skip_entry(&entry.name, ignore) {
+            continue;
+        }
+        if entry.is_dir {
+            collect_files(fs, root, &entry.path, ignore, out)?;
+        } else if let Ok(rel) = entry.path.strip_prefix(root) {
+            out.push((entry.path.clone(), rel.to_path_buf()));
+        }
+    }
+    Ok(())
+}
+
+pub struct SystemHandler<'a> {
+    fs: &'a dyn Fs,
+}
+
+impl<'a> SystemHandler<'a> {
+    pub fn new(fs: &'a dyn Fs) -> Self {
+        Self { fs }
+    }
+}
+
+impl Handler for SystemHandler<'_> {
+    fn name(&self) -> &str {
+        HANDLER_SYSTEM
+    }
+
+    /// After provisioning, so a package that owns a target directory
+    /// (`/etc/nginx/conf.d`) is installed first.
+    fn phase(&self) -> ExecutionPhase {
+        ExecutionPhase::Setup
+    }
+
+    /// Writes go through `sudo`, whose password prompt can't be
+    /// shared between packs running at once.
+    fn parallel_safe(&self) -> bool {
+        false
+    }
+
+    fn match_mode(&self) -> MatchMode {
+        MatchMode::Precise
+    }
+
+    fn to_intents(
+        &self,
+        matches: &[RuleMatch],
+        config: &HandlerConfig,
+        paths: &dyn Pather,
+        fs: &dyn Fs,
+    ) -> Result<Vec<HandlerIntent>> {
+        if !config.system_enabled {
+            return Ok(Vec::new());
+        }
+        let mut intents = Vec::new();
+        for m in matches {
+            if !m.is_dir {
+                continue;
+            }
+            let mut files = Vec::new();
+            collect_files(
+                fs,
+                &m.absolute_path,
+                &m.absolute_path,
+                &config.pack_ignore,
+                &mut files,
+            )?;
+            files.sort();
+
+            for (source, rel) in files {
+                let shown = m.relative_path.join(&rel);
+                let target = system_target(&rel).ok_or_else(|| {
+                    DodotError::Other(format!("system file {}: not a plain path", shown.display()))
+                })?;
+                if target.starts_with(paths.home_dir()) {
+                    return Err(DodotError::Other(format!(
+                        "system file {} maps to {}, inside $HOME; \
+                         files under $HOME belong in the pack itself (symlink handler)",
+                        shown.display(),
+                        target.display()
+                    )));
+                }
+                if is_protected_target(&target, &config.system_protected) {
+                    return Err(DodotError::Other(format!(
+                        "system file {} maps to {}, which is protected by [system] protected; \
+                         dodot won't write it",
+                        shown.display(),
+                        target.display()
+                    )));
+                }
+
+                let checksum = file_checksum_bytes(&fs.read_file(&source)?);
+                let filename = target_slug(&target);
+                // `sh -c <script> <$0> <target> <pack file>`: the pack
+                // file goes last so the run header names it.
+                let arguments = vec![
+                    "-c".into(),
+                    install_script(config.system_confirm),
+                    SCRIPT_NAME.into(),
+                    target.to_string_lossy().into_owned(),
+                    source.to_string_lossy().into_owned(),
+                ];
+                intents.push(HandlerIntent::Run {
+                    pack: m.pack.clone(),
+                    handler: HANDLER_SYSTEM.into(),
+                    executable: "sh".into(),
+                    arguments,
+                    sentinel: format!("{filename}-{checksum}"),
+                    filename,
+                    content_hash: checksum,
+                });
+            }
+        }
+        Ok(intents)
+    }
+
+    fn warnings_for_matches(
+        &self,
+        matches: &[RuleMatch],
+        config: &HandlerConfig,
+        _paths: &dyn Pather,
+        _fs: &dyn Fs,
+    ) -> Vec<String> {
+        if config.system_enabled {
+            return Vec::new();
+        }
+        matches
+            .iter()
+            .map(|m| {
+                format!(
+                    "warning: pack `{}` contains `{}` but [system] enabled = false; \
+                     its files are not installed",
+                    m.pack,
+                    m.relative_path.display()
+                )
+            })
+            .collect()
+    }
+
+    fn check_status(
+        &self,
+        file: &Path,
+        pack: &str,
+        datastore: &dyn DataStore,
+    ) -> Result<HandlerStatus> {
+        let mut files = Vec::new();
+        if self.fs.is_dir(file) {
+            collect_files(self.fs, file, file, &[], &mut files)?;
+        }
+        files.sort();
+
+        let mut pending = Vec::new();
+        let mut older = Vec::new();
+        for (source, rel) in &files {
+            let Some(target) = system_target(rel) else {
+                continue;
+            };
+            let checksum = file_checksum_bytes(&self.fs.read_file(source)?);
+            let shown = target.display().to_string();
+            match datastore.did_run(pack, HANDLER_SYSTEM, &target_slug(&target), &checksum)? {
+                DidRunStatus::NeverRan => pending.push(shown),
+                DidRunStatus::RanDifferent { .. } => older.push(shown),
+                DidRunStatus::RanCurrent => {}
+            }
+        }
+        let message = if !pending.is_empty() {
+            format!("system files not installed: {}", pending.join(", "))
+        } else if !older.is_empty() {
+            format!(
+                "system files older version: {} (run `dodot up --provision-rerun` to apply current)",
+                older.join(", ")
+            )
+        } else {
+            "system files installed".into()
+        };
+        Ok(HandlerStatus {
+            file: file.to_string_lossy().into_owned(),
+            handler: HANDLER_SYSTEM.into(),
+            deployed: pending.is_empty(),
+            message,
+        })
+    }
+
+    /// Under `--deprovision`, restore every planned target. Like the
+    /// install, each restore goes through `sudo`.
+    fn undo_actions(&self, cx: &UndoContext) -> Result<Vec<UndoAction>> {
+        let mut actions = Vec::new();
+        if cx.deprovision {
+            for intent in cx.intents {
+                if let HandlerIntent::Run { arguments, .. } = intent {
+                    if let Some(target) = arguments.get(3) {
+                        actions.push(UndoAction::RunCommand {
+                            executable: "sh".into(),
+                            arguments: vec![
+                                "-c".into(),
+                                restore_script(),
+                                SCRIPT_NAME.into(),
+                                target.clone(),
+                            ],
+                        });
+                    }
+                }
+            }
+        }
+        actions.push(UndoAction::ClearState);
+        Ok(actions)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::testing::TempEnvironment;
+    use std::collections::HashMap;
+
+    fn work_env() -> TempEnvironment {
+        TempEnvironment::builder()
+            .pack("work")
+            .file("_system/etc/profile.d/work.sh", "export WORK=1\n")
+            .file("_system/etc/hosts.d/vpn", "10.0.0.1 vpn\n")
+            .done()
+            .build()
+    }
+
+    fn plan(env: &TempEnvironment, config: &HandlerConfig) -> Result<Vec<HandlerIntent>> {
+        let m = RuleMatch {
+            relative_path: "_system".into(),
+            absolute_path: env.dotfiles_root.join("work/_system"),
+            pack: "work".into(),
+            handler: HANDLER_SYSTEM.into(),
+            is_dir: true,
+            options: HashMap::new(),
+            preprocessor_source: None,
+            rendered_bytes: None,
+        };
+        SystemHandler::new(env.fs.as_ref()).to_intents(
+            &[m],
+            config,
+            env.paths.as_ref(),
+            env.fs.as_ref(),
+        )
+    }
+
+    fn enabled() -> HandlerConfig {
+        HandlerConfig {
+            system_enabled: true,
+            system_protected: vec!["/etc/sudoers.d".into()],
+            ..HandlerConfig::default()
+        }
+    }
+
+    #[test]
+    fn disabled_by_default_plans_nothing() {
+        let env = work_env();
+        assert!(plan(&env, &HandlerConfig::default()).unwrap().is_empty());
+    }
+
+    #[test]
+    fn one_run_intent_per_file_targeting_the_mirrored_path() {
+        let env = work_env();
+        let intents = plan(&env, &enabled()).unwrap();
+        assert_eq!(intents.len(), 2);
+
+        let HandlerIntent::Run {
+            executable,
+            arguments,
+            filename,
+            sentinel,
+            ..
+        } = &intents[0]
+        else {
+            panic!("expected Run intent");
+        };
+        assert_eq!(executable, "sh");
+        assert_eq!(filename, "etc_hosts.d_vpn");
+        assert!(sentinel.starts_with("etc_hosts.d_vpn-"));
+        assert_eq!(arguments[3], "/etc/hosts.d/vpn");
+        // The pack file is the trailing argument.
+        assert!(arguments[4].ends_with("_system/etc/hosts.d/vpn"));
+        let script = &arguments[1];
+        assert!(script.contains("sudo mv -f"), "{script}");
+        assert!(script.contains("</dev/tty"), "{script}");
+
+        let unattended = HandlerConfig {
+            system_confirm: false,
+            ..enabled()
+        };
+        let HandlerIntent::Run { arguments, .. } = &plan(&env, &unattended).unwrap()[0] else {
+            panic!("expected Run intent");
+        };
+        assert!(!arguments[1].contains("/dev/tty"), "{}", arguments[1]);
+    }
+
+    #[test]
+    fn protected_and_home_targets_are_errors() {
+        let env = work_env();
+        env.fs
+            .write_file(
+                &env.dotfiles_root.join("work/_system/etc/sudoers.d/work"),
+                b"ada ALL=(ALL) ALL\n",
+            )
+            .unwrap();
+        let err = plan(&env, &enabled()).unwrap_err();
+        assert!(err.to_string().contains("protected"), "{err}");
+
+        let env = work_env();
+        let home = env.home.strip_prefix("/").unwrap().join(".profile");
+        let source = env.dotfiles_root.join("work/_system").join(home);
+        env.fs.mkdir_all(source.parent().unwrap()).unwrap();
+        env.fs.write_file(&source, b"x\n").unwrap();
+        let err = plan(&env, &enabled()).unwrap_err();
+        assert!(err.to_string().contains("inside $HOME"), "{err}");
+    }
+
+    #[test]
+    fn deprovision_restores_each_target() {
+        let env = work_env();
+        let intents = plan(&env, &enabled()).unwrap();
+        let handler = SystemHandler::new(env.fs.as_ref());
+        let cx = |deprovision| UndoContext {
+            pack: "work",
+            pack_path: Path::new("/unused"),
+            handler_dir: Path::new("/unused"),
+            intents: &intents,
+            deprovision,
+            fs: env.fs.as_ref(),
+        };
+        assert_eq!(
+            handler.undo_actions(&cx(false)).unwrap(),
+            vec![UndoAction::ClearState]
+        );
+        let actions = handler.undo_actions(&cx(true)).unwrap();
+        assert_eq!(actions.len(), 3);
+        let UndoAction::RunCommand { arguments, .. } = &actions[0] else {
+            panic!("expected RunCommand");
+        };
+        assert_eq!(arguments.last().unwrap(), "/etc/hosts.d/vpn");
+        assert!(arguments[1].contains(ORIGINAL_SUFFIX));
+    }
+
+    #[test]
+    fn protection_covers_the_subtree_only() {
+        let protected = vec!["/etc/pam.d".to_string(), "/boot/".to_string()];
+        assert!(is_protected_target(Path::new("/etc/pam.d"), &protected));
+        assert!(is_protected_target(
+            Path::new("/etc/pam.d/sudo"),
+            &protected
+        ));
+        assert!(is_protected_target(Path::new("/boot/grub.cfg"), &protected));
+        assert!(!is_protected_target(Path::new("/etc/pam.dx"), &protected));
+    }
+}
@@ -0,0 +1,558 @@
+//! Toolchain handlers — `asdf`, `mise` and `flake` install the
+//! language runtimes a pack declares, through the version manager the
+//! declaration is written for.
+//!
+//! | File             | Handler | Runs, per tool                                    |
+//! |------------------|---------|---------------------------------------------------|
+//! | `.tool-versions` | `asdf`  | `asdf plugin add <tool>`, `asdf install <tool> <v>` |
+//! | `mise.toml`      | `mise`  | `mise install <tool>@<v>…` for each `[tools]` key |
+//! | `flake.nix`      | `flake` | `nix profile install path:<pack>` (one "tool")    |
+//!
+//! Like [`plugins`](crate::handlers::plugins), each declared tool gets
+//! its own [`HandlerIntent::Run`] and sentinel, `<tool>-<checksum>`,
+//! hashed over that tool's versions only. Bumping `nodejs` in
+//! `.tool-versions` leaves `python` current; the run-once three-state
+//! policy (never ran / ran / older version) applies per tool. A flake
+//! is one unit, hashed over `flake.nix` and its `flake.lock`, so a
+//! `nix flake update` counts as an edit.
+//!
+//! The managers are not dodot's to install. When `asdf --version` (or
+//! `mise`, `nix`) fails, the handler plans nothing for the file and
+//! [`Handler::warnings_for_matches`] says why, so one pack's
+//! `.tool-versions` doesn't stop `up` on a machine that uses another
+//! version manager. That check is about the machine, not the file.
+//!
+//! User-facing reference: `docs/user/handlers/toolchains.lex`.
+
+use std::path::Path;
+
+use crate::datastore::{CommandRunner, DataStore, DidRunStatus};
+use crate::fs::Fs;
+use crate::handlers::run_once::file_checksum_bytes;
+use crate::handlers::{
+    ExecutionPhase, Handler, HandlerConfig, HandlerStatus, HANDLER_ASDF, HANDLER_FLAKE,
+    HANDLER_MISE,
+};
+use crate::operations::HandlerIntent;
+use crate::paths::Pather;
+use crate::rules::RuleMatch;
+use crate::shell::sh_quote;
+use crate::{DodotError, Result};
+
+/// Same defensive flag the `nix` handler passes; a no-op when the
+/// features are already enabled in `nix.conf`.
+const NIX_FEATURES: &str = "--extra-experimental-features 'nix-command flakes'";
+
+/// One version manager.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Toolchain {
+    Asdf,
+    Mise,
+    Flake,
+}
+
+/// One tool a file declares, with the versions to install.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Tool {
+    pub name: String,
+    pub versions: Vec<String>,
+}
+
+impl Toolchain {
+    pub const ALL: [Toolchain; 3] = [Toolchain::Asdf, Toolchain::Mise, Toolchain::Flake];
+
+    pub fn handler_name(self) -> &'static str {
+        match self {
+            Toolchain::Asdf => HANDLER_ASDF,
+            Toolchain::Mise => HANDLER_MISE,
+            Toolchain::Flake => HANDLER_FLAKE,
+        }
+    }
+
+    /// The program the handler drives.
+    fn manager(self) -> &'static str {
+        match self {
+            Toolchain::Asdf => "asdf",
+            Toolchain::Mise => "mise",
+            Toolchain::Flake => "nix",
+        }
+    }
+
+    /// The default file name, for messages.
+    fn file(self) -> &'static str {
+        match self {
+            Toolchain::Asdf => ".tool-versions",
+            Toolchain::Mise => "mise.toml",
+            Toolchain::Flake => "flake.nix",
+        }
+    }
+
+    /// What to install when the manager doesn't run.
+    fn install_hint(self) -> &'static str {
+        match self {
+            Toolchain::Asdf => "install asdf to use it",
+            Toolchain::Mise => "install mise to use it",
+            Toolchain::Flake => "install Nix to use it",
+        }
+    }
+
+    /// The tools `bytes` declares. A flake is a single tool named
+    /// `flake`; its versions are whatever the lock file pins.
+    pub fn tools(self, bytes: &[u8]) -> Result<Vec<Tool>> {
+        let text = || {
+            std::str::from_utf8(bytes)
+                .map_err(|e| DodotError::Other(format!("{} is not UTF-8: {e}", self.file())))
+        };
+        match self {
+            Toolchain::Asdf => parse_tool_versions(text()?),
+            Toolchain::Mise => parse_mise_toml(text()?),
+            Toolchain::Flake => Ok(vec![Tool {
+                name: "flake".into(),
+                versions: Vec::new(),
+            }]),
+        }
+    }
+
+    /// Shell script that installs `tool`. `pack_dir` is where the
+    /// declaring file lives.
+    pub fn script(self, tool: &Tool, pack_dir: &Path) -> String {
+        let name = sh_quote(&tool.name);
+        match self {
+            Toolchain::Asdf => {
+                let mut script = format!(
+                    "set -e\nasdf plugin list 2>/dev/null | grep -qx {name} || asdf plugin add {name}\n"
+                );
+                for version in &tool.versions {
+                    script.push_str(&format!("asdf install {name} {}\n", sh_quote(version)));
+                }
+                script
+            }
+            Toolchain::Mise => {
+                let specs: Vec<String> = tool
+                    .versions
+                    .iter()
+                    .map(|v| sh_quote(&format!("{}@{v}", tool.name)))
+                    .collect();
+                format!("set -e\nmise install {}\n", specs.join(" "))
+            }
+            Toolchain::Flake => format!(
+                "set -e\nnix profile install {} {NIX_FEATURES}\n",
+                sh_quote(&format!("path:{}", pack_dir.display()))
+            ),
+        }
+    }
+}
+
+/// `.tool-versions`: `<tool> <version>…` per line, `#` comments.
+fn parse_tool_versions(text: &str) -> Result<Vec<Tool>> {
+    let mut tools = Vec::new();
+    for line in text.lines() {
+        let line = line.split('#').next().unwrap_or_default();
+        let mut words = line.split_whitespace();
+        let Some(name) = words.next() else {
+            continue;
+        };
+        let versions: Vec<String> = words.map(str::to_string).collect();
+        if versions.is_empty() {
+            return Err(DodotError::Other(format!(
+                ".tool-versions: `{name}` has no version"
+            )));
+        }
+        tools.push(Tool {
+            name: name.into(),
+            versions,
+        });
+    }
+    Ok(tools)
+}
+
+/// `mise.toml`: the `[tools]` table. A value is a version, a list of
+/// versions, or a table with a `version` key. Other tables (`[env]`,
+/// `[tasks]`) are mise's business, not an install.
+fn parse_mise_toml(text: &str) -> Result<Vec<Tool>> {
+    let table: toml::Table = text
+        .parse()
+        .map_err(|e| DodotError::Other(format!("failed to parse mise.toml: {e}")))?;
+    let Some(tools) = table.get("tools") else {
+        return Ok(Vec::new());
+    };
+    let toml::Value::Table(tools) = tools else {
+        return Err(DodotError::Other(
+            "mise.toml: `tools` must be a table, e.g. `[tools]`".into(),
+        ));
+    };
+    let bad = |name: &str| {
+        DodotError::Other(format!(
+            "mise.toml: [tools] `{name}` must be a version, a list of versions \
+             or a table with `version`"
+        ))
+    };
+    let mut out = Vec::new();
+    for (name, value) in tools {
+        let versions = match value {
+            toml::Value::String(v) => vec![v.clone()],
+            toml::Value::Array(items) => items
+                .iter()
+                .map(|i| {
+                    i.as_str()
+                        .map(str::to_string)
+                        .ok_or_else(|| bad(name.as_str()))
+                })
+                .collect::<Result<_>>()?,
+            toml::Value::Table(t) => match t.get("version").and_then(|v| v.as_str()) {
+                Some(v) => vec![v.to_string()],
+                None => return Err(bad(name.as_str())),
+            },
+            _ => return Err(bad(name.as_str())),
+        };
+        out.push(Tool {
+            name: name.clone(),
+            versions,
+        });
+    }
+    Ok(out)
+}
+
+/// Sentinel checksum for one tool.
+fn tool_checksum(tool: &Tool) -> String {
+    file_checksum_bytes(format!("{}\n{}", tool.name, tool.versions.join("\n")).as_bytes())
+}
+
+pub struct ToolchainHandler<'a> {
+    fs: &'a dyn Fs,
+    runner: &'a dyn CommandRunner,
+    toolchain: Toolchain,
+}
+
+impl<'a> ToolchainHandler<'a> {
+    pub fn new(fs: &'a dyn Fs, runner: &'a dyn CommandRunner, toolchain: Toolchain) -> Self {
+        Self {
+            fs,
+            runner,
+            toolchain,
+        }
+    }
+
+    /// Whether the manager runs on this machine.
+    fn available(&self) -> bool {
+        self.runner
+            .run(self.toolchain.manager(), &["--version".to_string()])
+            .is_ok()
+    }
+
+    /// `(tool, checksum)` for each tool `path` declares. `bytes` is the
+    /// file's content; a flake's checksum also covers `flake.lock`.
+    fn plan_tools(&self, path: &Path, bytes: &[u8]) -> Result<Vec<(Tool, String)>> {
+        let tools = self.toolchain.tools(bytes)?;
+        if self.toolchain != Toolchain::Flake {
+            return Ok(tools
+                .into_iter()
+                .map(|t| {
+                    let checksum = tool_checksum(&t);
+                    (t, checksum)
+                })
+                .collect());
+        }
+        let mut hashed = bytes.to_vec();
+        let lock = path.with_file_name("flake.lock");
+        if self.fs.exists(&lock) {
+            hashed.extend(self.fs.read_file(&lock)?);
+        }
+        let checksum = file_checksum_bytes(&hashed);
+        Ok(tools.into_iter().map(|t| (t, checksum.clone())).collect())
+    }
+}
+
+impl Handler for ToolchainHandler<'_> {
+    fn name(&self) -> &str {
+        self.toolchain.handler_name()
+    }
+
+    fn phase(&self) -> ExecutionPhase {
+        ExecutionPhase::Provision
+    }
+
+    /// Version managers keep global state (shims, the Nix profile).
+    fn parallel_safe(&self) -> bool {
+        false
+    }
+
+    fn to_intents(
+        &self,
+        matches: &[RuleMatch],
+        _config: &HandlerConfig,
+        _paths: &dyn Pather,
+        fs: &dyn Fs,
+    ) -> Result<Vec<HandlerIntent>> {
+        let files: Vec<&RuleMatch> = matches.iter().filter(|m| !m.is_dir).collect();
+        if files.is_empty() || !self.available() {
+            // `warnings_for_matches` tells the user.
+            return Ok(Vec::new());
+        }
+        let handler = self.toolchain.handler_name();
+        let mut intents = Vec::new();
+        for m in files {
+            let Some(bytes) = super::manifest_bytes(m, fs) else {
+                continue;
+            };
+            let pack_dir = m.absolute_path.parent().unwrap_or(Path::new("/"));
+            for (tool, checksum) in self.plan_tools(&m.absolute_path, &bytes)? {
+                // `sh -c <script> <$0> <file>`: the trailing argument is
+                // the declaring file so the run header and the snapshot
+                // both point at it.
+                let arguments = vec![
+                    "-c".into(),
+                    self.toolchain.script(&tool, pack_dir),
+                    format!("dodot-{handler}"),
+                    m.absolute_path.to_string_lossy().into_owned(),
+                ];
+                intents.push(HandlerIntent::Run {
+                    pack: m.pack.clone(),
+                    handler: handler.into(),
+                    executable: "sh".into(),
+                    arguments,
+                    sentinel: format!("{}-{checksum}", tool.name),
+                    filename: tool.name,
+                    content_hash: checksum,
+                });
+            }
+        }
+        Ok(intents)
+    }
+
+    fn warnings_for_matches(
+        &self,
+        matches: &[RuleMatch],
+        _config: &HandlerConfig,
+        _paths: &dyn Pather,
+        _fs: &dyn Fs,
+    ) -> Vec<String> {
+        let files: Vec<&RuleMatch> = matches.iter().filter(|m| !m.is_dir).collect();
+        if files.is_empty() || self.available() {
+            return Vec::new();
+        }
+        files
+            .iter()
+            .map(|m| {
+                format!(
+                    "warning: pack `{}` skips `{}`: `{}` isn't installed on this machine ({})",
+                    m.pack,
+                    m.relative_path.display(),
+                    self.toolchain.manager(),
+                    self.toolchain.install_hint(),
+                )
+            })
+            .collect()
+    }
+
+    fn check_status(
+        &self,
+        file: &Path,
+        pack: &str,
+        datastore: &dyn DataStore,
+    ) -> Result<HandlerStatus> {
+        let handler = self.toolchain.handler_name();
+        if !self.available() {
+            return Ok(HandlerStatus {
+                file: file.to_string_lossy().into_owned(),
+                handler: handler.into(),
+                deployed: false,
+                message: format!("skipped: `{}` not installed", self.toolchain.manager()),
+            });
+        }
+        let bytes = self.fs.read_file(file)?;
+        let mut pending = Vec::new();
+        let mut older = Vec::new();
+        for (tool, checksum) in self.plan_tools(file, &bytes)? {
+            match datastore.did_run(pack, handler, &tool.name, &checksum)? {
+                DidRunStatus::NeverRan => pending.push(tool.name),
+                DidRunStatus::RanDifferent { .. } => older.push(tool.name),
+                DidRunStatus::RanCurrent => {}
+            }
+        }
+        let message = if !pending.is_empty() {
+            format!("tools not installed: {}", pending.join(", "))
+        } else if !older.is_empty() {
+            format!(
+                "tools older version: {} (run `dodot up --provision-rerun` to apply current)",
+                older.join(", ")
+            )
+        } else {
+            "tools installed".into()
+        };
+        Ok(HandlerStatus {
+            file: file.to_string_lossy().into_owned(),
+            handler: handler.into(),
+            deployed: pending.is_empty(),
+            message,
+        })
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::datastore::CommandOutput;
+    use crate::testing::TempEnvironment;
+    use std::collections::HashMap;
+
+    /// Answers `<manager> --version` when the manager is "installed";
+    /// otherwise fails the way a spawn of a missing binary does.
+    struct ProbeRunner {
+        installed: bool,
+    }
+
+    impl CommandRunner for ProbeRunner {
+        fn run(&self, executable: &str, arguments: &[String]) -> Result<CommandOutput> {
+            if self.installed {
+                return Ok(CommandOutput {
+                    exit_code: 0,
+                    stdout: "1.0.0".into(),
+                    stderr: String::new(),
+                });
+            }
+            Err(DodotError::CommandFailed {
+                command: format!("{executable} {}", arguments.join(" ")),
+                exit_code: -1,
+                stderr: "No such file or directory".into(),
+                stdout: String::new(),
+            })
+        }
+    }
+
+    fn matched(env: &TempEnvironment, file: &str, handler: &str) -> RuleMatch {
+        RuleMatch {
+            relative_path: file.into(),
+            absolute_path: env.dotfiles_root.join("dev").join(file),
+            pack: "dev".into(),
+            handler: handler.into(),
+            is_dir: false,
+            options: HashMap::new(),
+            preprocessor_source: None,
+            rendered_bytes: None,
+        }
+    }
+
+    fn sentinels(intents: &[HandlerIntent]) -> Vec<String> {
+        intents
+            .iter()
+            .map(|i| match i {
+                HandlerIntent::Run { sentinel, .. } => sentinel.clone(),
+                _ => unreachable!(),
+            })
+            .collect()
+    }
+
+    #[test]
+    fn one_run_per_tool_with_its_own_sentinel() {
+        let env = TempEnvironment::builder()
+            .pack("dev")
+            .file(
+                ".tool-versions",
+                "nodejs 20.11.0\npython 3.12.1 3.11.7 # both\n",
+            )
+            .done()
+            .build();
+        let runner = ProbeRunner { installed: true };
+        let handler = ToolchainHandler::new(env.fs.as_ref(), &runner, Toolchain::Asdf);
+        let m = matched(&env, ".tool-versions", HANDLER_ASDF);
+        let plan = || {
+            handler
+                .to_intents(
+                    std::slice::from_ref(&m),
+                    &HandlerConfig::default(),
+                    env.paths.as_ref(),
+                    env.fs.as_ref(),
+                )
+                .unwrap()
+        };
+
+        let intents = plan();
+        assert_eq!(intents.len(), 2);
+        let HandlerIntent::Run {
+            executable,
+            arguments,
+            filename,
+            ..
+        } = &intents[1]
+        else {
+            panic!("expected Run intent");
+        };
+        assert_eq!(executable, "sh");
+        assert_eq!(filename, "python");
+        assert!(
+            arguments[1].contains("asdf plugin add 'python'"),
+            "{}",
+            arguments[1]
+        );
+        assert!(arguments[1].contains("asdf install 'python' '3.11.7'"));
+        assert!(arguments.last().unwrap().ends_with("dev/.tool-versions"));
+
+        // Bumping python leaves nodejs current.
+        let before = sentinels(&intents);
+        env.fs
+            .write_file(&m.absolute_path, b"nodejs 20.11.0\npython 3.12.2\n")
+            .unwrap();
+        let after = sentinels(&plan());
+        assert_eq!(before[0], after[0]);
+        assert_ne!(before[1], after[1]);
+    }
+
+    #[test]
+    fn missing_manager_skips_with_a_warning() {
+        let env = TempEnvironment::builder()
+            .pack("dev")
+            .file("mise.toml", "[tools]\nnode = \"20\"\n")
+            .done()
+            .build();
+        let runner = ProbeRunner { installed: false };
+        let handler = ToolchainHandler::new(env.fs.as_ref(), &runner, Toolchain::Mise);
+        let m = [matched(&env, "mise.toml", HANDLER_MISE)];
+        let config = HandlerConfig::default();
+
+        let intents = handler
+            .to_intents(&m, &config, env.paths.as_ref(), env.fs.as_ref())
+            .unwrap();
+        assert!(intents.is_empty());
+        let warnings =
+            handler.warnings_for_matches(&m, &config, env.paths.as_ref(), env.fs.as_ref());
+        assert_eq!(warnings.len(), 1);
+        assert!(
+            warnings[0].contains("skips `mise.toml`: `mise` isn't installed"),
+            "{}",
+            warnings[0]
+        );
+    }
+
+    #[test]
+    fn mise_tools_accept_strings_lists_and_tables() {
+        let tools = Toolchain::Mise
+            .tools(
+                b"[env]\nFOO = \"1\"\n\n[tools]\nnode = \"20\"\npython = [\"3.12\", \"3.11\"]\n\
+                  go = { version = \"1.22\" }\n",
+            )
+            .unwrap();
+        let mut names: Vec<(&str, Vec<String>)> = tools
+            .iter()
+            .map(|t| (t.name.as_str(), t.versions.clone()))
+            .collect();
+        names.sort();
+        assert_eq!(
+            names,
+            [
+                ("go", vec!["1.22".to_string()]),
+                ("node", vec!["20".into()]),
+                ("python", vec!["3.12".into(), "3.11".into()]),
+            ]
+        );
+        let python = tools.iter().find(|t| t.name == "python").unwrap();
+        let script = Toolchain::Mise.script(python, Path::new("/p"));
+        assert!(script.contains("mise install 'python@3.12' 'python@3.11'"));
+
+        let err = Toolchain::Mise
+            .tools(b"[tools]\nnode = 20\n")
+            .unwrap_err()
+            .to_string();
+        assert!(err.contains("`node` must be a version"), "{err}");
+    }
+}
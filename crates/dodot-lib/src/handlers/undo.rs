@@ -0,0 +1,103 @@
+//! Reverse actions handlers contribute to `dodot down`.
+//!
+//! Planning a deploy is the handler's job ([`Handler::to_intents`]);
+//! so is describing how to take it back. [`Handler::undo_actions`]
+//! returns an ordered list of [`UndoAction`]s for one pack, which
+//! `down` executes (or lists, under `--dry-run`). The default is just
+//! [`UndoAction::ClearState`] — drop the handler's datastore subtree —
+//! which is all the shell and path handlers need: the regenerated init
+//! script stops sourcing the files and adding the PATH entries.
+//!
+//! Handlers add steps in front of that:
+//!
+//! - symlink removes the user-visible links that still point into its
+//!   data dir, so `down` doesn't leave dangling links in `$HOME`;
+//! - run-once handlers may contribute commands that reverse
+//!   provisioning (homebrew: `brew uninstall` the Brewfile's entries).
+//!   These change the system, not dodot's bookkeeping, so they only
+//!   appear when the user asked for them (`down --deprovision`).
+//!
+//! [`Handler::to_intents`]: crate::handlers::Handler::to_intents
+//! [`Handler::undo_actions`]: crate::handlers::Handler::undo_actions
+
+use std::path::{Path, PathBuf};
+
+use serde::Serialize;
+
+use crate::datastore::format_command_for_display;
+use crate::fs::Fs;
+use crate::operations::HandlerIntent;
+
+/// One step of undoing a handler's work for a pack.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+#[serde(tag = "kind", rename_all = "snake_case")]
+pub enum UndoAction {
+    /// Delete a user-visible symlink dodot created. Only emitted for
+    /// links that still resolve into the handler's data dir (or, under
+    /// the direct link strategy, at a source a data link records);
+    /// anything the user replaced since is left alone.
+    RemoveUserLink { path: PathBuf },
+    /// Run a command that reverses provisioning. Only emitted when
+    /// [`UndoContext::deprovision`] is set.
+    RunCommand {
+        executable: String,
+        arguments: Vec<String>,
+    },
+    /// Remove the handler's datastore state for the pack. Every
+    /// handler ends with this.
+    ClearState,
+}
+
+impl UndoAction {
+    /// One-line description for `--dry-run` rows and verbose action
+    /// lists.
+    pub fn describe(&self, handler: &str) -> String {
+        match self {
+            UndoAction::RemoveUserLink { path } => format!("remove link {}", path.display()),
+            UndoAction::RunCommand {
+                executable,
+                arguments,
+            } => format!("run {}", format_command_for_display(executable, arguments)),
+            UndoAction::ClearState => format!("clear {handler} state"),
+        }
+    }
+}
+
+/// What a handler gets to plan its undo for one pack.
+pub struct UndoContext<'a> {
+    /// On-disk pack directory name (datastore key).
+    pub pack: &'a str,
+    /// Absolute path of the pack in the dotfiles repo.
+    pub pack_path: &'a Path,
+    /// `handler_data_dir(pack, handler)`.
+    pub handler_dir: &'a Path,
+    /// The intents this handler would plan for the pack today (passive
+    /// planning — nothing rendered or written). Empty when planning
+    /// failed; handlers must still return at least `ClearState`.
+    pub intents: &'a [HandlerIntent],
+    /// Whether to include commands that undo provisioning.
+    pub deprovision: bool,
+    pub fs: &'a dyn Fs,
+}
+
+/// `true` when `user_path` is a symlink into `handler_dir` — i.e. a
+/// link dodot made and the user hasn't replaced. A direct link (see
+/// [`LinkStrategy`]) counts when the data link of the same name in
+/// `handler_dir` points where it does.
+///
+/// [`LinkStrategy`]: crate::operations::LinkStrategy
+pub fn links_into(fs: &dyn Fs, user_path: &Path, handler_dir: &Path) -> bool {
+    if !fs.is_symlink(user_path) {
+        return false;
+    }
+    let Ok(target) = fs.readlink(user_path) else {
+        return false;
+    };
+    if target.starts_with(handler_dir) {
+        return true;
+    }
+    target.file_name().is_some_and(|name| {
+        fs.readlink(&handler_dir.join(name))
+            .is_ok_and(|recorded| recorded == target)
+    })
+}
@@ -1,6 +1,8 @@
+pub mod api;
 pub mod commands;
 pub mod config;
 pub mod conflicts;
+pub mod copies;
 pub mod datastore;
 pub mod equivalence;
 pub mod error;
@@ -9,17 +11,25 @@ pub mod external;
 pub mod fs;
 pub mod gates;
 pub mod handlers;
+pub mod notify;
 pub mod operations;
 pub mod packs;
 pub mod paths;
+pub mod perms;
 pub mod plists;
 pub mod preprocessing;
 pub mod probe;
+pub mod progress;
 pub mod prompts;
 pub mod render;
 pub mod rules;
 pub mod secret;
+pub mod serve;
 pub mod shell;
+pub mod timing;
+pub mod trace;
+pub mod trash;
+pub mod verify;
 
 // The testing module is available:
 // - Always during `cargo test` (dev-dependencies provide tempfile)
@@ -27,4 +37,4 @@ pub mod shell;
 #[cfg(any(test, feature = "test-utils"))]
 pub mod testing;
 
-pub use error::{DodotError, Result};
+pub use error::{DodotError, ExitCode, Result};
@@ -0,0 +1,307 @@
+//! Notifications when a run ends (`[notify]`).
+//!
+//! A long unattended `up` or `provision` — a fresh machine working
+//! through a big Brewfile — ends with nobody watching the terminal.
+//! With `[notify]` set, [`run_finished`] shows a desktop notification
+//! (`osascript` on macOS, `notify-send` elsewhere) and POSTs the run
+//! summary to each webhook. Everything is best effort: a notification
+//! that can't be delivered is a line on stderr, never a change to the
+//! run's outcome. Dry runs, and runs shorter than `min_seconds`, stay
+//! quiet.
+
+use std::time::{Duration, Instant};
+
+use serde_json::json;
+use tracing::{debug, info};
+
+use crate::config::NotifySection;
+use crate::datastore::CommandRunner;
+use crate::packs::orchestration::ExecutionContext;
+use crate::{DodotError, Result};
+
+/// How a run ended, as a notification tells it.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct RunSummary {
+    /// The command, e.g. `up`.
+    pub command: String,
+    pub success: bool,
+    /// One line: the run's outcome or its error.
+    pub text: String,
+    pub elapsed: Duration,
+}
+
+impl RunSummary {
+    pub fn title(&self) -> String {
+        let outcome = if self.success { "finished" } else { "failed" };
+        format!("dodot {} {outcome}", self.command)
+    }
+
+    /// Title, text and duration on one line.
+    pub fn line(&self) -> String {
+        format!(
+            "{}: {} ({}s)",
+            self.title(),
+            self.text,
+            self.elapsed.as_secs()
+        )
+    }
+
+    /// The webhook body. `text` is what Slack and Matrix show; the
+    /// other fields are for integrations that want structure.
+    pub fn payload(&self) -> serde_json::Value {
+        json!({
+            "text": self.line(),
+            "command": self.command,
+            "success": self.success,
+            "summary": self.text,
+            "elapsed_secs": self.elapsed.as_secs(),
+        })
+    }
+}
+
+/// Reject `[notify]` values dodot can't act on, at config load.
+pub fn check_config(config: &NotifySection) -> Result<()> {
+    if !matches!(config.on.as_str(), "always" | "failure") {
+        return Err(DodotError::Config(format!(
+            "invalid `[notify] on = {:?}`: expected \"always\" or \"failure\"",
+            config.on
+        )));
+    }
+    for url in &config.webhooks {
+        if !(url.starts_with("https://") || url.starts_with("http://")) {
+            return Err(DodotError::Config(format!(
+                "invalid `[notify] webhooks` entry {:?}: expected an http(s) URL",
+                redact(url)
+            )));
+        }
+    }
+    Ok(())
+}
+
+/// Whether `summary` should be sent anywhere under `config`.
+pub fn wanted(config: &NotifySection, summary: &RunSummary) -> bool {
+    let destinations = config.desktop || !config.webhooks.is_empty();
+    destinations
+        && (config.on == "always" || !summary.success)
+        && summary.elapsed >= Duration::from_secs(config.min_seconds)
+}
+
+/// The command showing a desktop notification on this platform.
+pub fn desktop_command(title: &str, body: &str) -> (String, Vec<String>) {
+    if cfg!(target_os = "macos") {
+        let script = format!(
+            "display notification {} with title {}",
+            applescript_string(body),
+            applescript_string(title)
+        );
+        ("osascript".into(), vec!["-e".into(), script])
+    } else {
+        (
+            "notify-send".into(),
+            vec!["--app-name=dodot".into(), title.into(), body.into()],
+        )
+    }
+}
+
+fn applescript_string(text: &str) -> String {
+    format!("\"{}\"", text.replace('\\', "\\\\").replace('"', "\\\""))
+}
+
+/// A webhook URL with everything after the host dropped. Slack and
+/// Matrix webhook paths are credentials, so messages never show them.
+fn redact(url: &str) -> String {
+    let (scheme, rest) = url.split_once("://").unwrap_or(("", url));
+    let host = rest.split('/').next().unwrap_or_default();
+    if scheme.is_empty() {
+        format!("{host}/…")
+    } else {
+        format!("{scheme}://{host}/…")
+    }
+}
+
+/// Send `summary` to every destination in `config`. Returns one line
+/// per destination that failed.
+pub fn send(
+    config: &NotifySection,
+    summary: &RunSummary,
+    runner: &dyn CommandRunner,
+) -> Vec<String> {
+    let mut failures = Vec::new();
+    if config.desktop {
+        let (executable, arguments) = desktop_command(&summary.title(), &summary.text);
+        match runner.run(&executable, &arguments) {
+            Ok(out) if out.exit_code == 0 => {}
+            Ok(out) => failures.push(format!(
+                "{executable} exited with {}: {}",
+                out.exit_code,
+                out.stderr.trim()
+            )),
+            Err(e) => failures.push(format!("{executable}: {e}")),
+        }
+    }
+    if !config.webhooks.is_empty() {
+        // Short deadlines: the run is over, and a dead webhook
+        // shouldn't keep the terminal waiting.
+        let agent = ureq::AgentBuilder::new()
+            .timeout_connect(Duration::from_secs(5))
+            .timeout(Duration::from_secs(10))
+            .build();
+        let body = summary.payload().to_string();
+        for url in &config.webhooks {
+            let sent = agent
+                .post(url)
+                .set("Content-Type", "application/json")
+                .send_string(&body);
+            match sent {
+                Ok(_) => debug!(url = %redact(url), "webhook notified"),
+                Err(ureq::Error::Status(code, _)) => {
+                    failures.push(format!("webhook {}: HTTP {code}", redact(url)))
+                }
+                Err(ureq::Error::Transport(t)) => {
+                    failures.push(format!("webhook {}: {}", redact(url), t.kind()))
+                }
+            }
+        }
+    }
+    failures
+}
+
+/// Notify about a finished `command`, per the root `[notify]` config.
+/// `describe` gives a successful result's outcome and one-line text;
+/// an error's first line stands for itself.
+pub fn run_finished<T>(
+    command: &str,
+    started: Instant,
+    result: &Result<T>,
+    describe: impl FnOnce(&T) -> (bool, String),
+    ctx: &ExecutionContext,
+) {
+    if ctx.dry_run {
+        return;
+    }
+    let config = match ctx.config_manager.root_config() {
+        Ok(cfg) => cfg.notify,
+        Err(e) => {
+            debug!(error = %e, "no notification: root config did not load");
+            return;
+        }
+    };
+    let (success, text) = match result {
+        Ok(value) => describe(value),
+        Err(e) => (
+            false,
+            e.to_string().lines().next().unwrap_or_default().to_string(),
+        ),
+    };
+    let summary = RunSummary {
+        command: command.into(),
+        success,
+        text,
+        elapsed: started.elapsed(),
+    };
+    if !wanted(&config, &summary) {
+        return;
+    }
+    info!(command, success, "sending run notification");
+    for failure in send(&config, &summary, ctx.command_runner.as_ref()) {
+        eprintln!("dodot: notification not delivered: {failure}");
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::datastore::CommandOutput;
+    use std::sync::Mutex;
+
+    fn config() -> NotifySection {
+        NotifySection {
+            desktop: true,
+            webhooks: Vec::new(),
+            on: "always".into(),
+            min_seconds: 30,
+        }
+    }
+
+    fn summary(success: bool, secs: u64) -> RunSummary {
+        RunSummary {
+            command: "up".into(),
+            success,
+            text: "3 packs: 3 deployed".into(),
+            elapsed: Duration::from_secs(secs),
+        }
+    }
+
+    #[derive(Default)]
+    struct Record(Mutex<Vec<Vec<String>>>);
+
+    impl CommandRunner for Record {
+        fn run(&self, exe: &str, args: &[String]) -> Result<CommandOutput> {
+            let mut call = vec![exe.to_string()];
+            call.extend(args.iter().cloned());
+            self.0.lock().unwrap().push(call);
+            Ok(CommandOutput {
+                exit_code: 0,
+                stdout: String::new(),
+                stderr: String::new(),
+            })
+        }
+    }
+
+    #[test]
+    fn short_runs_and_successes_under_on_failure_stay_quiet() {
+        let mut cfg = config();
+        assert!(wanted(&cfg, &summary(true, 45)));
+        assert!(!wanted(&cfg, &summary(true, 5)));
+
+        cfg.on = "failure".into();
+        assert!(!wanted(&cfg, &summary(true, 45)));
+        assert!(wanted(&cfg, &summary(false, 45)));
+
+        cfg.desktop = false;
+        assert!(!wanted(&cfg, &summary(false, 45)), "nowhere to send");
+    }
+
+    #[test]
+    fn desktop_notification_goes_through_the_runner() {
+        let runner = Record::default();
+        assert!(send(&config(), &summary(false, 90), &runner).is_empty());
+        let calls = runner.0.lock().unwrap();
+        assert_eq!(calls.len(), 1);
+        let call = calls[0].join(" ");
+        assert!(call.contains("dodot up failed"), "{call}");
+        assert!(call.contains("3 packs: 3 deployed"), "{call}");
+    }
+
+    #[test]
+    fn payload_carries_a_text_line_for_chat_webhooks() {
+        let payload = summary(true, 125).payload();
+        assert_eq!(
+            payload["text"],
+            "dodot up finished: 3 packs: 3 deployed (125s)"
+        );
+        assert_eq!(payload["success"], true);
+        assert_eq!(payload["elapsed_secs"], 125);
+    }
+
+    #[test]
+    fn config_rejects_unknown_values_without_leaking_webhook_paths() {
+        let mut cfg = config();
+        cfg.on = "sometimes".into();
+        assert!(check_config(&cfg).is_err());
+
+        cfg.on = "failure".into();
+        cfg.webhooks = vec!["hooks.slack.com/services/T000/B000/secret".into()];
+        let err = check_config(&cfg).unwrap_err().to_string();
+        assert!(err.contains("hooks.slack.com/…"), "{err}");
+        assert!(!err.contains("secret"), "{err}");
+    }
+
+    #[test]
+    fn applescript_strings_are_escaped() {
+        assert_eq!(
+            applescript_string(r#"say "hi" \o/"#),
+            r#""say \"hi\" \\o/""#
+        );
+    }
+}
@@ -91,6 +91,78 @@ impl Operation {
     }
 }
 
+/// How a [`HandlerIntent::Link`] materializes at the user path.
+///
+/// `Symlink` is the default double-link. `Copy` and `Hardlink` exist
+/// for environments that can't follow symlinks (some network homes,
+/// container bind mounts); both still record the datastore data link
+/// so `status` / `down` see the file, and record a content hash of
+/// what was deployed so `status` can tell when the copy is behind its
+/// source. See [`crate::copies`].
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Default, Serialize)]
+#[serde(rename_all = "lowercase")]
+pub enum LinkMode {
+    #[default]
+    Symlink,
+    Copy,
+    Hardlink,
+}
+
+impl LinkMode {
+    /// Parse the `[symlink] mode` config value.
+    pub fn parse(s: &str) -> Option<Self> {
+        match s {
+            "symlink" => Some(Self::Symlink),
+            "copy" => Some(Self::Copy),
+            "hardlink" => Some(Self::Hardlink),
+            _ => None,
+        }
+    }
+
+    pub fn as_str(self) -> &'static str {
+        match self {
+            Self::Symlink => "symlink",
+            Self::Copy => "copy",
+            Self::Hardlink => "hardlink",
+        }
+    }
+}
+
+/// Where a [`LinkMode::Symlink`] user link points.
+///
+/// `Double` (the default) links the user path to the datastore data
+/// link, which links to the source: one indirection that lets dodot
+/// re-point or retire every deployed file from inside its data dir.
+/// `Direct` links the user path straight at the source, so tools that
+/// resolve one hop (or users reading `ls -l`) see the pack file. The
+/// data link is still created either way — it is the record `status`,
+/// `down` and `disable` work from.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Default, Serialize)]
+#[serde(rename_all = "lowercase")]
+pub enum LinkStrategy {
+    #[default]
+    Double,
+    Direct,
+}
+
+impl LinkStrategy {
+    /// Parse the `[symlink] link_strategy` config value.
+    pub fn parse(s: &str) -> Option<Self> {
+        match s {
+            "double" => Some(Self::Double),
+            "direct" => Some(Self::Direct),
+            _ => None,
+        }
+    }
+
+    pub fn as_str(self) -> &'static str {
+        match self {
+            Self::Double => "double",
+            Self::Direct => "direct",
+        }
+    }
+}
+
 /// Higher-level intent produced by handlers.
 ///
 /// Handlers declare *what* they want, not *how* to do it. The executor
@@ -104,11 +176,17 @@ impl Operation {
 pub enum HandlerIntent {
     /// Symlink handler: create both legs of the double-link.
     /// Executor splits this into CreateDataLink + CreateUserLink.
+    /// With a non-default `mode` the user leg is a copy or hard link
+    /// of the source instead of a symlink. `perms` (a rule's `chmod` /
+    /// `chown`) is applied to the deployed target afterwards.
     Link {
         pack: String,
         handler: String,
         source: PathBuf,
         user_path: PathBuf,
+        mode: LinkMode,
+        #[serde(skip_serializing_if = "Option::is_none")]
+        perms: Option<crate::perms::Perms>,
     },
 
     /// Shell/path handlers: stage a file in the datastore.
@@ -183,6 +261,14 @@ pub struct OperationResult {
     pub operation: Operation,
     pub success: bool,
     pub message: String,
+    /// Failed because something dodot doesn't own is in the way, which
+    /// `--force` would replace.
+    #[serde(skip_serializing_if = "is_false")]
+    pub conflict: bool,
+    /// Under `--dry-run`, what the operation would write into a shared
+    /// file (the init script, git's config), for the report to show.
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub preview: Option<String>,
 }
 
 impl OperationResult {
@@ -191,6 +277,8 @@ impl OperationResult {
             operation,
             success: true,
             message: message.into(),
+            conflict: false,
+            preview: None,
         }
     }
 
@@ -199,8 +287,28 @@ impl OperationResult {
             operation,
             success: false,
             message: message.into(),
+            conflict: false,
+            preview: None,
         }
     }
+
+    /// A failure `--force` would have gone past.
+    pub fn conflict(operation: Operation, message: impl Into<String>) -> Self {
+        Self {
+            conflict: true,
+            ..Self::fail(operation, message)
+        }
+    }
+
+    /// Attach what a dry-run operation would write.
+    pub fn with_preview(mut self, preview: impl Into<String>) -> Self {
+        self.preview = Some(preview.into());
+        self
+    }
+}
+
+fn is_false(b: &bool) -> bool {
+    !*b
 }
 
 #[cfg(test)]
@@ -226,6 +334,8 @@ mod tests {
             handler: "symlink".into(),
             source: PathBuf::from("/src/gitconfig"),
             user_path: PathBuf::from("/home/.gitconfig"),
+            mode: LinkMode::Symlink,
+            perms: None,
         };
         assert_eq!(intent.pack(), "git");
         assert_eq!(intent.handler(), "symlink");
@@ -53,6 +53,18 @@ pub struct ExecutionContext {
     /// is on disk. Default `false`; surfaced via the `--diff` flag on
     /// `dodot status`.
     pub show_diff: bool,
+    /// `--lint` / `--strict`: run shellcheck over shell sources and
+    /// install scripts before `up` or `provision` executes anything.
+    /// See [`crate::shell::lint`].
+    pub lint: crate::shell::LintOptions,
+    /// One-shot template variables from `--var` / `--vars-file`,
+    /// layered over every pack's `[preprocessor.template.vars]` for
+    /// this invocation only. See
+    /// [`crate::preprocessing::template::invocation`].
+    pub template_vars: std::collections::BTreeMap<String, String>,
+    /// `--only` / `--skip`: the subset of each pack's matched files
+    /// this invocation deploys. See [`crate::rules::FileFilter`].
+    pub file_filter: crate::rules::FileFilter,
     /// How pack-status output should render rows: `Full` keeps today's
     /// per-file listing, `Short` collapses each pack to one summary
     /// line. Consumed by every command that renders through the
@@ -65,6 +77,12 @@ pub struct ExecutionContext {
     /// every command that renders through the `pack-status` template;
     /// ignored by commands that emit `message` / `list` output.
     pub group_mode: crate::commands::GroupMode,
+    /// How much of a pack-status result to render: `Quiet` (errors
+    /// and a one-line summary), `Normal`, or `Verbose` (adds per-file
+    /// actions, skipped rows and timings). Wired from the CLI global
+    /// `--quiet` / `--verbose` flags; independent of `verbose` below,
+    /// which only governs install-script streaming.
+    pub render_verbosity: crate::commands::RenderVerbosity,
     /// When true, install-script execution streams raw stdout/stderr
     /// to the user's terminal. The default (`false`) keeps output
     /// quiet — only the `# status:` progress markers and the leading
@@ -72,8 +90,9 @@ pub struct ExecutionContext {
     /// global `--verbose`/`--debug` flag.
     pub verbose: bool,
     /// Snapshot of the host's gate-relevant facts (os, arch, hostname,
-    /// username). Detected once per context so per-pack scanning and
-    /// matching avoid re-running `hostname(1)`/env reads. Constructed
+    /// username) plus the machine's roles from local config. Detected
+    /// once per context so per-pack scanning and matching avoid
+    /// re-running `hostname(1)`/env reads. Constructed
     /// by [`Self::production`]; tests build via `HostFacts::for_tests`.
     pub host_facts: Arc<HostFacts>,
 }
@@ -81,8 +100,8 @@ pub struct ExecutionContext {
 impl ExecutionContext {
     /// Create a default production context from a dotfiles root path.
     ///
-    /// Wires up the real filesystem, XDG paths, filesystem-backed
-    /// datastore with shell command runner, and clapfig config manager.
+    /// Wires up the real filesystem, XDG paths, the datastore backend
+    /// named by `[datastore] backend` with shell command runner, and clapfig config manager.
     /// `verbose` controls whether install-script stdout/stderr is
     /// streamed to the terminal; the field is also stored on the
     /// returned context for any other consumer that cares. Callers
@@ -103,8 +122,26 @@ impl ExecutionContext {
         // same error path, just without preempting Pather construction.
         // If the read fails here we leave `app_support_dir` at the
         // platform default and let the actual command surface the error.
+        let mut host_facts = HostFacts::detect();
         let mut paths_builder = crate::paths::XdgPather::builder().dotfiles_root(dotfiles_root);
         if let Ok(root_config) = config_manager.root_config() {
+            // Shared-home setups: this host's state lives in its own
+            // namespace. Without a hostname there is nothing stable to
+            // key on, so say so rather than share a namespace silently.
+            if root_config.datastore.per_host {
+                let host = host_facts.hostname.clone().ok_or_else(|| {
+                    crate::DodotError::Config(
+                        "`[datastore] per_host` is on but the hostname can't be \
+                         determined; set $HOSTNAME"
+                            .into(),
+                    )
+                })?;
+                paths_builder = paths_builder.host(host);
+            }
+            paths_builder = paths_builder.flat_layout(
+                crate::packs::Layout::parse(&root_config.pack.layout)
+                    == Some(crate::packs::Layout::Flat),
+            );
             if !root_config.symlink.app_uses_library {
                 // Resolve XDG the way XdgPatherBuilder will, then pin
                 // app_support_dir at the same path. We can't read the
@@ -120,14 +157,31 @@ impl ExecutionContext {
             }
         }
         let paths = Arc::new(paths_builder.build()?);
-        let fs: Arc<dyn Fs> = Arc::new(crate::fs::OsFs::new());
+        let mut fs: Arc<dyn Fs> = Arc::new(crate::fs::OsFs::new());
+        if crate::fs::no_write_home_requested() {
+            fs = Arc::new(crate::fs::HomeGuardFs::new(fs, paths.as_ref()));
+        }
+        // A broken roles file must not take every command down with
+        // it: the machine counts as untagged, and `status` repeats the
+        // error so it doesn't go unnoticed.
+        host_facts.roles = match crate::gates::load_roles(fs.as_ref(), paths.as_ref()) {
+            Ok(roles) => roles,
+            Err(err) => {
+                tracing::warn!(error = %err, "ignoring machine roles");
+                Vec::new()
+            }
+        };
         let runner: Arc<dyn crate::datastore::CommandRunner> =
             Arc::new(crate::datastore::ShellCommandRunner::new(verbose));
-        let datastore: Arc<dyn DataStore> = Arc::new(crate::datastore::FilesystemDataStore::new(
-            fs.clone(),
-            paths.clone(),
-            runner.clone(),
-        ));
+        // Same soft-fail as above for reading the config; an unknown or
+        // unavailable backend, though, is a hard error — silently
+        // falling back would split state across two stores.
+        let backend = config_manager
+            .root_config()
+            .map(|c| c.datastore.backend)
+            .unwrap_or_else(|_| "filesystem".into());
+        let datastore =
+            crate::datastore::open(&backend, fs.clone(), paths.clone(), runner.clone())?;
 
         Ok(Self {
             fs,
@@ -142,10 +196,14 @@ impl ExecutionContext {
             force: false,
             check_drift: false,
             show_diff: false,
+            lint: Default::default(),
+            template_vars: Default::default(),
+            file_filter: Default::default(),
             view_mode: crate::commands::ViewMode::default(),
             group_mode: crate::commands::GroupMode::default(),
+            render_verbosity: crate::commands::RenderVerbosity::default(),
             verbose,
-            host_facts: Arc::new(HostFacts::detect()),
+            host_facts: Arc::new(host_facts),
         })
     }
 }
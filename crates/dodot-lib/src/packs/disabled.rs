@@ -0,0 +1,182 @@
+//! Disabled packs — switched off on this machine, ready to switch back.
+//!
+//! `dodot down` forgets everything: links, shell state and the
+//! provisioning sentinels that stop install scripts and `brew bundle`
+//! from running again. `dodot disable <pack>` is the reversible
+//! version. It removes what the pack shows the user — links in
+//! `$HOME`, shell init, `$PATH` entries, git includes — and sets the
+//! configuration handlers' datastore state aside, along with a record
+//! of each link it removed. Code-execution state stays where it is, so
+//! the pack still counts as provisioned.
+//!
+//! `dodot enable <pack>` moves the state back and recreates the
+//! recorded links: the pack returns exactly as it was deployed, without
+//! planning or running anything. While disabled, `up`, `plan` and
+//! `provision` skip the pack and `status` marks it `disabled`.
+//!
+//! Everything lives under `<data_dir>/disabled/<pack>/` (per host when
+//! state is namespaced), keyed by the pack's on-disk directory name:
+//! `disabled.json` plus `state/<handler>/`, a verbatim copy of the
+//! handler's datastore subtree.
+
+use std::path::{Path, PathBuf};
+
+use serde::{Deserialize, Serialize};
+
+use crate::fs::Fs;
+use crate::paths::Pather;
+use crate::{DodotError, Result};
+
+const SCHEMA_VERSION: u32 = 1;
+const RECORD: &str = "disabled.json";
+const STATE: &str = "state";
+
+/// What `disable` took down for one pack.
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq)]
+pub struct DisabledPack {
+    version: u32,
+    /// Unix seconds.
+    pub disabled_at: u64,
+    /// Handlers whose state was set aside.
+    pub handlers: Vec<String>,
+    /// User-visible links `disable` removed.
+    pub links: Vec<RemovedLink>,
+}
+
+/// A link `disable` removed: `path` pointed at `target`.
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq)]
+pub struct RemovedLink {
+    pub path: PathBuf,
+    pub target: PathBuf,
+}
+
+impl DisabledPack {
+    pub fn new(disabled_at: u64) -> Self {
+        Self {
+            version: SCHEMA_VERSION,
+            disabled_at,
+            handlers: Vec::new(),
+            links: Vec::new(),
+        }
+    }
+}
+
+/// `<data_dir>/disabled/<pack>`.
+pub fn pack_dir(paths: &dyn Pather, pack: &str) -> PathBuf {
+    paths.disabled_dir().join(pack)
+}
+
+/// Where `handler`'s state waits while `pack` is disabled.
+pub fn stashed_handler_dir(paths: &dyn Pather, pack: &str, handler: &str) -> PathBuf {
+    pack_dir(paths, pack).join(STATE).join(handler)
+}
+
+/// Whether the pack with on-disk name `pack` is disabled.
+pub fn is_disabled(fs: &dyn Fs, paths: &dyn Pather, pack: &str) -> bool {
+    fs.exists(&pack_dir(paths, pack).join(RECORD))
+}
+
+/// Read `pack`'s record. `None` when it isn't disabled.
+pub fn load(fs: &dyn Fs, paths: &dyn Pather, pack: &str) -> Result<Option<DisabledPack>> {
+    let path = pack_dir(paths, pack).join(RECORD);
+    if !fs.exists(&path) {
+        return Ok(None);
+    }
+    let raw = fs.read_to_string(&path)?;
+    let record: DisabledPack = serde_json::from_str(&raw)
+        .map_err(|e| DodotError::Other(format!("failed to parse {}: {e}", path.display())))?;
+    if record.version != SCHEMA_VERSION {
+        return Err(DodotError::Other(format!(
+            "{} has unsupported schema version {} (expected {SCHEMA_VERSION})",
+            path.display(),
+            record.version
+        )));
+    }
+    Ok(Some(record))
+}
+
+/// Write `pack`'s record. `disable` writes it before touching
+/// anything, so an interrupted run still leaves a pack `enable` (or
+/// `down`) can finish.
+pub fn save(fs: &dyn Fs, paths: &dyn Pather, pack: &str, record: &DisabledPack) -> Result<()> {
+    let dir = pack_dir(paths, pack);
+    fs.mkdir_all(&dir)?;
+    let body = serde_json::to_string_pretty(record)
+        .map_err(|e| DodotError::Other(format!("failed to serialise disabled record: {e}")))?;
+    fs.write_file_atomic(&dir.join(RECORD), body.as_bytes())
+}
+
+/// Move `handler`'s datastore state for `pack` aside.
+pub fn stash(fs: &dyn Fs, paths: &dyn Pather, pack: &str, handler: &str) -> Result<()> {
+    let to = stashed_handler_dir(paths, pack, handler);
+    move_dir(fs, &paths.handler_data_dir(pack, handler), &to)
+}
+
+/// Move `handler`'s stashed state back into the datastore.
+pub fn restore(fs: &dyn Fs, paths: &dyn Pather, pack: &str, handler: &str) -> Result<()> {
+    let from = stashed_handler_dir(paths, pack, handler);
+    move_dir(fs, &from, &paths.handler_data_dir(pack, handler))
+}
+
+/// Forget `pack`'s record and whatever state is still set aside.
+pub fn discard(fs: &dyn Fs, paths: &dyn Pather, pack: &str) -> Result<()> {
+    let dir = pack_dir(paths, pack);
+    if fs.exists(&dir) {
+        fs.remove_dir_all(&dir)?;
+    }
+    Ok(())
+}
+
+/// On-disk names of every disabled pack, sorted.
+pub fn list(fs: &dyn Fs, paths: &dyn Pather) -> Result<Vec<String>> {
+    let root = paths.disabled_dir();
+    if !fs.exists(&root) {
+        return Ok(Vec::new());
+    }
+    let mut names: Vec<String> = fs
+        .read_dir(&root)?
+        .into_iter()
+        .filter(|e| e.is_dir && fs.exists(&e.path.join(RECORD)))
+        .map(|e| e.name)
+        .collect();
+    names.sort();
+    Ok(names)
+}
+
+fn move_dir(fs: &dyn Fs, from: &Path, to: &Path) -> Result<()> {
+    if let Some(parent) = to.parent() {
+        fs.mkdir_all(parent)?;
+    }
+    fs.rename(from, to)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::testing::TempEnvironment;
+
+    #[test]
+    fn state_round_trips_through_the_stash() {
+        let env = TempEnvironment::builder().build();
+        let fs = env.fs.as_ref();
+        let paths = env.paths.as_ref();
+        let live = paths.handler_data_dir("010-vim", "symlink");
+        fs.mkdir_all(&live).unwrap();
+        fs.write_file(&live.join("marker"), b"x").unwrap();
+
+        stash(fs, paths, "010-vim", "symlink").unwrap();
+        assert!(!fs.exists(&live));
+        let mut record = DisabledPack::new(1_700_000_000);
+        record.handlers.push("symlink".into());
+        save(fs, paths, "010-vim", &record).unwrap();
+        assert!(is_disabled(fs, paths, "010-vim"));
+        assert_eq!(list(fs, paths).unwrap(), vec!["010-vim".to_string()]);
+        assert_eq!(load(fs, paths, "010-vim").unwrap(), Some(record));
+
+        restore(fs, paths, "010-vim", "symlink").unwrap();
+        discard(fs, paths, "010-vim").unwrap();
+        assert_eq!(fs.read_to_string(&live.join("marker")).unwrap(), "x");
+        assert!(!is_disabled(fs, paths, "010-vim"));
+        assert!(list(fs, paths).unwrap().is_empty());
+    }
+}
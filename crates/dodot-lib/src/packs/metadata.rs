@@ -0,0 +1,105 @@
+//! Pack metadata — what a pack says about itself in its `[pack]`
+//! section: `description`, `author`, `version`, `url` and
+//! `min_dodot`.
+//!
+//! Everything but `min_dodot` is informational: `dodot list` shows it
+//! and `--output json` carries it for tools that catalogue packs.
+//! `min_dodot` is enforced. A pack that needs a newer dodot than the
+//! one running is skipped by `up`, `plan` and `provision` with a
+//! warning naming both versions (see
+//! [`drop_incompatible`](crate::packs::orchestration::drop_incompatible)),
+//! rather than half-deploying with handlers or config keys this
+//! release doesn't understand. `status` and `down` still see the pack.
+//!
+//! Versions are dotted numbers, `MAJOR[.MINOR[.PATCH]]`; a pre-release
+//! suffix (`-rc.1`) is ignored, so `6.0.0-rc.1` satisfies `6.0`.
+
+use serde::Serialize;
+
+use crate::config::PackSection;
+
+/// The version of dodot that is running.
+pub const DODOT_VERSION: &str = env!("CARGO_PKG_VERSION");
+
+/// The metadata keys of one pack's `[pack]` section. Empty strings
+/// mean unset.
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize)]
+pub struct PackMetadata {
+    #[serde(skip_serializing_if = "String::is_empty")]
+    pub description: String,
+    #[serde(skip_serializing_if = "String::is_empty")]
+    pub author: String,
+    #[serde(skip_serializing_if = "String::is_empty")]
+    pub version: String,
+    #[serde(skip_serializing_if = "String::is_empty")]
+    pub url: String,
+    #[serde(skip_serializing_if = "String::is_empty")]
+    pub min_dodot: String,
+}
+
+impl PackMetadata {
+    pub fn from_section(section: &PackSection) -> Self {
+        Self {
+            description: section.description.clone(),
+            author: section.author.clone(),
+            version: section.version.clone(),
+            url: section.url.clone(),
+            min_dodot: section.min_dodot.clone(),
+        }
+    }
+
+    pub fn is_empty(&self) -> bool {
+        *self == Self::default()
+    }
+
+    /// Why this dodot can't run the pack, or `None` when it can.
+    pub fn incompatibility(&self) -> Option<String> {
+        incompatibility(&self.min_dodot, DODOT_VERSION)
+    }
+}
+
+/// `MAJOR[.MINOR[.PATCH]]` as a comparable triple; missing components
+/// are zero. `None` when `s` isn't a version.
+pub fn parse_version(s: &str) -> Option<(u64, u64, u64)> {
+    let core = s.trim().trim_start_matches('v');
+    let core = core.split(['-', '+']).next().unwrap_or_default();
+    let mut parts = core.split('.');
+    let mut next = |required: bool| match parts.next() {
+        Some(part) => part.parse::<u64>().ok(),
+        None if required => None,
+        None => Some(0),
+    };
+    let version = (next(true)?, next(false)?, next(false)?);
+    parts.next().is_none().then_some(version)
+}
+
+/// `None` when `running` satisfies `min` (or `min` is unset).
+pub fn incompatibility(min: &str, running: &str) -> Option<String> {
+    if min.is_empty() {
+        return None;
+    }
+    let (Some(required), Some(current)) = (parse_version(min), parse_version(running)) else {
+        return Some(format!("needs dodot {min}, which isn't a version"));
+    };
+    (current < required).then(|| format!("needs dodot >= {min} (this is {running})"))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn versions_compare_numerically() {
+        assert_eq!(parse_version("5.2"), Some((5, 2, 0)));
+        assert_eq!(parse_version("v6.0.0-rc.1"), Some((6, 0, 0)));
+        assert_eq!(parse_version("5.x"), None);
+        assert_eq!(parse_version("1.2.3.4"), None);
+
+        assert_eq!(incompatibility("", "5.2.0"), None);
+        assert_eq!(incompatibility("5.2", "5.10.0"), None);
+        assert_eq!(
+            incompatibility("5.10", "5.2.0").as_deref(),
+            Some("needs dodot >= 5.10 (this is 5.2.0)")
+        );
+    }
+}
@@ -46,9 +46,20 @@
 //! "A applies before B", not "A is required for B to make sense".
 //! A pack with a missing dependency is the user's problem, not the
 //! framework's.
+//!
+//! # Flat layout
+//!
+//! `[pack] layout = "flat"` in the root config is for repos without
+//! pack directories: the root itself is one implicit pack named
+//! [`FLAT_PACK`], its files matched by the same rules. Discovery goes
+//! through [`scan_root`], which picks the layout; [`scan_packs`] is the
+//! directory scan the default layout uses.
 
 pub mod context;
+pub mod disabled;
+pub mod metadata;
 pub mod orchestration;
+pub mod pins;
 pub mod types;
 
 use std::collections::HashMap;
@@ -56,6 +67,7 @@ use std::path::{Path, PathBuf};
 
 use serde::Serialize;
 
+use crate::config::PackSection;
 use crate::fs::Fs;
 use crate::handlers::HandlerConfig;
 use crate::{DodotError, Result};
@@ -278,6 +290,53 @@ pub fn discover_packs(
     Ok(scan_packs(fs, dotfiles_root, ignore_patterns)?.packs)
 }
 
+/// Name of the implicit pack a flat dotfiles root deploys as. Fixed
+/// rather than taken from the repo directory, so the datastore keeps
+/// recognising it wherever the repo is cloned.
+pub const FLAT_PACK: &str = "dotfiles";
+
+/// How the dotfiles root is organised (`[pack] layout`).
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Layout {
+    /// One pack per top-level directory — the default.
+    Packs,
+    /// The root is a single pack, [`FLAT_PACK`].
+    Flat,
+}
+
+impl Layout {
+    pub fn parse(value: &str) -> Option<Self> {
+        match value {
+            "packs" => Some(Layout::Packs),
+            "flat" => Some(Layout::Flat),
+            _ => None,
+        }
+    }
+}
+
+/// Scan the dotfiles root the way the root config's `[pack]` section
+/// lays it out. Under the flat layout the result is the one implicit
+/// pack and nothing is ever ignored; otherwise it is [`scan_packs`].
+pub fn scan_root(fs: &dyn Fs, dotfiles_root: &Path, pack: &PackSection) -> Result<DiscoveredPacks> {
+    if Layout::parse(&pack.layout) == Some(Layout::Flat) {
+        return Ok(DiscoveredPacks {
+            packs: vec![Pack::new(
+                FLAT_PACK.into(),
+                dotfiles_root.to_path_buf(),
+                HandlerConfig::default(),
+            )],
+            ignored: Vec::new(),
+        });
+    }
+    scan_packs(fs, dotfiles_root, &pack.ignore)
+}
+
+/// Active packs of the dotfiles root under its layout. See
+/// [`scan_root`].
+pub fn discover_root(fs: &dyn Fs, dotfiles_root: &Path, pack: &PackSection) -> Result<Vec<Pack>> {
+    Ok(scan_root(fs, dotfiles_root, pack)?.packs)
+}
+
 /// Check if a name matches any ignore pattern.
 fn is_ignored(name: &str, patterns: &[String]) -> bool {
     for pattern in patterns {
@@ -306,6 +365,36 @@ mod tests {
     use super::*;
     use crate::testing::TempEnvironment;
 
+    #[test]
+    fn flat_layout_discovers_the_root_as_one_pack() {
+        let env = TempEnvironment::builder()
+            .pack("vim")
+            .file("vimrc", "x")
+            .done()
+            .build();
+        let mut section = PackSection {
+            ignore: Vec::new(),
+            os: Vec::new(),
+            roles: Vec::new(),
+            verify: Vec::new(),
+            layout: "packs".into(),
+        };
+        let names = |section: &PackSection| -> Vec<String> {
+            discover_root(env.fs.as_ref(), &env.dotfiles_root, section)
+                .unwrap()
+                .into_iter()
+                .map(|p| p.name)
+                .collect()
+        };
+        assert_eq!(names(&section), vec!["vim"]);
+
+        section.layout = "flat".into();
+        let packs = discover_root(env.fs.as_ref(), &env.dotfiles_root, &section).unwrap();
+        assert_eq!(packs.len(), 1);
+        assert_eq!(packs[0].name, FLAT_PACK);
+        assert_eq!(packs[0].path, env.dotfiles_root);
+    }
+
     #[test]
     fn discover_finds_pack_directories() {
         let env = TempEnvironment::builder()
@@ -11,18 +11,26 @@
 //! re-exported here for the historical `crate::packs::orchestration::X`
 //! surface.
 
-use tracing::{debug, info};
+use tracing::{debug, info, warn};
 
 use crate::execution::Executor;
 use crate::operations::OperationResult;
+use crate::packs::disabled;
+use crate::packs::metadata::PackMetadata;
+use crate::packs::pins::Pins;
 use crate::packs::{self, Pack};
+use crate::timing::{self, Phase};
+use crate::trace::{self, Stage};
 use crate::Result;
 
 pub use crate::packs::context::ExecutionContext;
 pub use crate::packs::types::{Command, ExecuteResult, PackResult};
 
 mod planning;
+pub mod preflight;
+mod repair;
 mod resolve;
+pub mod schedule;
 
 #[cfg(test)]
 mod test_support;
@@ -31,7 +39,8 @@ pub(crate) use planning::filter_pre_preprocess_gates;
 pub use planning::{
     collect_pack_intents, collect_pack_intents_with_preprocessors, plan_pack, PackPlan,
 };
-pub use resolve::{resolve_pack_dir_name, validate_pack_names};
+pub use repair::{damaged_generated_files, repair_generated_files};
+pub use resolve::{expand_pack_selectors, resolve_pack_dir_name, validate_pack_names};
 
 // ── Pipeline ────────────────────────────────────────────────────
 
@@ -58,10 +67,11 @@ pub fn execute(
     );
 
     // Discover packs
-    let mut all_packs = packs::discover_packs(
+    let discovery_span = timing::span(Phase::Discovery, || "packs".into());
+    let mut all_packs = packs::discover_root(
         ctx.fs.as_ref(),
         ctx.paths.dotfiles_root(),
-        &root_config.pack.ignore,
+        &root_config.pack,
     )?;
     info!(
         count = all_packs.len(),
@@ -78,6 +88,9 @@ pub fn execute(
         info!(count = all_packs.len(), "packs after filter");
     }
 
+    drop(discovery_span);
+    trace::record(Stage::Packs, None, &all_packs);
+
     let total_packs = all_packs.len();
     let mut pack_results = Vec::with_capacity(total_packs);
     let mut successful = 0;
@@ -107,16 +120,15 @@ pub fn execute(
             }
         };
 
-        // C3: skip packs gated out by `[pack] os` on this host. Counted
-        // as successful (it's the configured behaviour, not a failure)
-        // with no operations — same shape `.dodotignore` would have if
-        // it reached this loop.
-        if !crate::gates::pack_os_active(&pack_config.pack.os, host) {
+        // C3: skip packs gated out by `[pack] os` or `[pack] roles` on
+        // this host. Counted as successful (it's the configured
+        // behaviour, not a failure) with no operations — same shape
+        // `.dodotignore` would have if it reached this loop.
+        if let Some(reason) = crate::gates::pack_inactive_reason(&pack_config.pack, host) {
             debug!(
                 pack = %pack.name,
-                allowed = ?pack_config.pack.os,
-                current_os = %host.os,
-                "pack inactive on this OS, skipping"
+                %reason,
+                "pack inactive on this host, skipping"
             );
             successful += 1;
             pack_results.push(PackResult {
@@ -175,12 +187,13 @@ pub fn execute(
 /// execution. This is the shared first step for commands that need
 /// to inspect multiple packs before acting (e.g. conflict detection).
 pub fn prepare_packs(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<Vec<Pack>> {
+    let _span = timing::span(Phase::Discovery, || "packs".into());
     let root_config = ctx.config_manager.root_config()?;
 
-    let mut all_packs = packs::discover_packs(
+    let mut all_packs = packs::discover_root(
         ctx.fs.as_ref(),
         ctx.paths.dotfiles_root(),
-        &root_config.pack.ignore,
+        &root_config.pack,
     )?;
     info!(count = all_packs.len(), "discovered packs");
 
@@ -199,10 +212,70 @@ pub fn prepare_packs(pack_filter: Option<&[String]>, ctx: &ExecutionContext) ->
         pack.config = pack_config.to_handler_config();
         configured.push(pack);
     }
+    trace::record(Stage::Packs, None, &configured);
 
     Ok(configured)
 }
 
+/// Drop pinned packs from `packs`, returning one warning per pack
+/// dropped. Commands that change a pack (`up`, `plan`, `provision`)
+/// call this after [`prepare_packs`]; see [`crate::packs::pins`].
+pub fn drop_pinned(packs: &mut Vec<Pack>, ctx: &ExecutionContext) -> Result<Vec<String>> {
+    let pins = Pins::load(ctx.fs.as_ref(), ctx.paths.as_ref())?;
+    let mut warnings = Vec::new();
+    packs.retain(|pack| {
+        if !pins.is_pinned(&pack.name) {
+            return true;
+        }
+        debug!(pack = %pack.name, "pack is pinned, skipping");
+        warnings.push(format!(
+            "pack '{0}' is pinned, skipping (run 'dodot unpin {0}' to update it)",
+            pack.display_name
+        ));
+        false
+    });
+    Ok(warnings)
+}
+
+/// Drop disabled packs from `packs`, returning one warning per pack
+/// dropped. Called next to [`drop_pinned`]; see
+/// [`crate::packs::disabled`].
+pub fn drop_disabled(packs: &mut Vec<Pack>, ctx: &ExecutionContext) -> Result<Vec<String>> {
+    let mut warnings = Vec::new();
+    packs.retain(|pack| {
+        if !disabled::is_disabled(ctx.fs.as_ref(), ctx.paths.as_ref(), &pack.name) {
+            return true;
+        }
+        debug!(pack = %pack.name, "pack is disabled, skipping");
+        warnings.push(format!(
+            "pack '{0}' is disabled, skipping (run 'dodot enable {0}' to restore it)",
+            pack.display_name
+        ));
+        false
+    });
+    Ok(warnings)
+}
+
+/// Drop packs whose `[pack] min_dodot` is newer than this dodot,
+/// returning one warning per pack dropped. Called next to
+/// [`drop_disabled`]; see [`crate::packs::metadata`].
+pub fn drop_incompatible(packs: &mut Vec<Pack>, ctx: &ExecutionContext) -> Result<Vec<String>> {
+    let mut warnings = Vec::new();
+    let mut kept = Vec::with_capacity(packs.len());
+    for pack in packs.drain(..) {
+        let config = ctx.config_manager.config_for_pack(&pack.path)?;
+        match PackMetadata::from_section(&config.pack).incompatibility() {
+            None => kept.push(pack),
+            Some(reason) => {
+                debug!(pack = %pack.name, %reason, "pack is incompatible, skipping");
+                warnings.push(format!("pack '{}' {reason}, skipping", pack.display_name));
+            }
+        }
+    }
+    *packs = kept;
+    Ok(warnings)
+}
+
 /// Result of [`scan_ignored`]: the `.dodotignore`-marked packs split by
 /// the two distinct jobs they serve.
 ///
@@ -233,10 +306,10 @@ pub struct IgnoredScan {
 /// unfiltered sweep set; see its docs for why they differ.
 pub fn scan_ignored(pack_filter: Option<&[String]>, ctx: &ExecutionContext) -> Result<IgnoredScan> {
     let root_config = ctx.config_manager.root_config()?;
-    let all_ignored = packs::scan_packs(
+    let all_ignored = packs::scan_root(
         ctx.fs.as_ref(),
         ctx.paths.dotfiles_root(),
-        &root_config.pack.ignore,
+        &root_config.pack,
     )?
     .ignored;
 
@@ -304,6 +377,39 @@ pub fn ignored_packs_with_state(dir_names: &[String], ctx: &ExecutionContext) ->
     Ok(n)
 }
 
+/// Resolve `[path] priority` and `position`, and `path` rules'
+/// `path_priority`, for every discovered pack, keyed by the
+/// on-disk directory name the datastore uses. Feeds the deterministic
+/// PATH ordering in [`shell::generate_init_script`](crate::shell::generate_init_script);
+/// the init script is global, so this covers every pack regardless of
+/// the current command's pack filter.
+///
+/// `dodot init-sh` calls this on every shell start, so a pack whose
+/// `.dodot.toml` doesn't load is logged and placed with the defaults
+/// rather than failing the whole script.
+pub fn path_priorities(ctx: &ExecutionContext) -> Result<crate::shell::PathPriorities> {
+    let root_config = ctx.config_manager.root_config()?;
+    let discovered = packs::scan_root(
+        ctx.fs.as_ref(),
+        ctx.paths.dotfiles_root(),
+        &root_config.pack,
+    )?;
+    let mut priorities = crate::shell::PathPriorities::new();
+    for pack in &discovered.packs {
+        let placement = match ctx.config_manager.config_for_pack(&pack.path) {
+            Ok(config) => {
+                crate::shell::PathPlacement::from_config(&config.path).with_rules(&config.rules)
+            }
+            Err(err) => {
+                warn!(pack = %pack.name, error = %err, "pack config unreadable, using default PATH placement");
+                crate::shell::PathPlacement::default()
+            }
+        };
+        priorities.insert(pack.name.clone(), placement);
+    }
+    Ok(priorities)
+}
+
 /// Execute a pre-collected set of intents.
 ///
 /// This is the second half of the two-phase execution model.
@@ -320,21 +426,109 @@ pub fn execute_intents(
         force = ctx.force,
         "executing intents"
     );
-    let auto_chmod = ctx.config_manager.root_config()?.path.auto_chmod_exec;
-    let fetcher = crate::external::UreqFetcher::new();
-    let git = crate::external::ShellGitRunner::new();
-    let executor = Executor::new(
-        ctx.datastore.as_ref(),
-        ctx.fs.as_ref(),
-        ctx.paths.as_ref(),
-        ctx.dry_run,
-        ctx.force,
-        ctx.provision_rerun,
-        auto_chmod,
-    )
-    .with_fetcher(&fetcher)
-    .with_git(&git);
-    executor.execute(intents)
+    ExecutorSettings::from_ctx(ctx)?.execute(intents)
+}
+
+/// The parts of an [`ExecutionContext`] an executor needs, read once.
+/// Every field is `Sync`, so the scheduler can hand one to several
+/// threads; the context as a whole makes no such promise.
+#[derive(Clone)]
+pub(crate) struct ExecutorSettings<'a> {
+    fs: &'a dyn crate::fs::Fs,
+    datastore: &'a dyn crate::datastore::DataStore,
+    paths: &'a dyn crate::paths::Pather,
+    command_runner: &'a dyn crate::datastore::CommandRunner,
+    dry_run: bool,
+    force: bool,
+    provision_rerun: bool,
+    auto_chmod: bool,
+    link_strategy: crate::operations::LinkStrategy,
+    /// Read only under `--dry-run`, to preview `PATH` lines.
+    path_priorities: Option<crate::shell::PathPriorities>,
+}
+
+impl<'a> ExecutorSettings<'a> {
+    pub(crate) fn from_ctx(ctx: &'a ExecutionContext) -> Result<Self> {
+        let root_config = ctx.config_manager.root_config()?;
+        Ok(Self {
+            fs: ctx.fs.as_ref(),
+            datastore: ctx.datastore.as_ref(),
+            paths: ctx.paths.as_ref(),
+            command_runner: ctx.command_runner.as_ref(),
+            dry_run: ctx.dry_run,
+            force: ctx.force,
+            provision_rerun: ctx.provision_rerun,
+            auto_chmod: root_config.path.auto_chmod_exec,
+            link_strategy: crate::operations::LinkStrategy::parse(
+                &root_config.symlink.link_strategy,
+            )
+            .unwrap_or_default(),
+            path_priorities: if ctx.dry_run {
+                Some(path_priorities(ctx)?)
+            } else {
+                None
+            },
+        })
+    }
+
+    /// Treat every run-once intent as `--force` would: `dodot
+    /// provision` re-runs them all.
+    pub(crate) fn rerunning(mut self) -> Self {
+        self.provision_rerun = true;
+        self
+    }
+
+    fn executor<'s>(
+        &'s self,
+        fetcher: &'s dyn crate::external::HttpFetcher,
+        git: &'s dyn crate::external::GitRunner,
+    ) -> Executor<'s> {
+        let mut executor = Executor::new(
+            self.datastore,
+            self.fs,
+            self.paths,
+            self.dry_run,
+            self.force,
+            self.provision_rerun,
+            self.auto_chmod,
+        )
+        .with_fetcher(fetcher)
+        .with_git(git)
+        .with_command_runner(self.command_runner)
+        .with_link_strategy(self.link_strategy);
+        if let Some(priorities) = &self.path_priorities {
+            executor = executor.with_path_priorities(priorities);
+        }
+        executor
+    }
+
+    pub(crate) fn execute(
+        &self,
+        intents: Vec<crate::operations::HandlerIntent>,
+    ) -> Result<Vec<OperationResult>> {
+        let _span = timing::span(Phase::Execution, || {
+            intents
+                .first()
+                .map(|i| i.pack().to_string())
+                .unwrap_or_default()
+        });
+        let fetcher = crate::external::UreqFetcher::new();
+        let git = crate::external::ShellGitRunner::new();
+        let pack = intents.first().map(|i| i.pack().to_string());
+        let results = self.executor(&fetcher, &git).execute(intents)?;
+        trace::record(Stage::Operations, pack.as_deref(), &results);
+        Ok(results)
+    }
+
+    /// The provisioning work `intents` hold, for dry-run summaries.
+    pub(crate) fn estimate<'i>(
+        &self,
+        intents: impl IntoIterator<Item = &'i crate::operations::HandlerIntent>,
+    ) -> crate::execution::WorkEstimate {
+        let fetcher = crate::external::UreqFetcher::new();
+        let git = crate::external::ShellGitRunner::new();
+        self.executor(&fetcher, &git).estimate(intents)
+    }
 }
 
 /// Run the standard handler pipeline for a pack: scan → match rules →
@@ -397,6 +591,26 @@ mod tests {
         }
     }
 
+    #[test]
+    fn path_priorities_fall_back_for_a_broken_pack_config() {
+        let env = TempEnvironment::builder()
+            .pack("tools")
+            .file("bin/hello", "#!/bin/sh")
+            .config("[path]\npriority = 10\n")
+            .done()
+            .pack("broken")
+            .file("bin/oops", "#!/bin/sh")
+            .config("[path\npriority = ")
+            .done()
+            .build();
+
+        let ctx = make_context(&env);
+        let priorities = path_priorities(&ctx).unwrap();
+
+        assert_eq!(priorities["tools"].priority, 10);
+        assert_eq!(priorities["broken"], crate::shell::PathPlacement::default());
+    }
+
     #[test]
     fn execute_filters_by_pack_name() {
         let env = TempEnvironment::builder()
@@ -540,8 +754,12 @@ mod tests {
             force: false,
             check_drift: false,
             show_diff: false,
+            lint: Default::default(),
+            template_vars: Default::default(),
+            file_filter: Default::default(),
             view_mode: crate::commands::ViewMode::Full,
             group_mode: crate::commands::GroupMode::Name,
+            render_verbosity: crate::commands::RenderVerbosity::Normal,
             verbose: false,
             host_facts: Arc::new(crate::gates::HostFacts::detect()),
         };
@@ -18,6 +18,8 @@ use crate::handlers;
 use crate::packs::context::ExecutionContext;
 use crate::packs::Pack;
 use crate::rules::{self, Scanner};
+use crate::timing::{self, Phase};
+use crate::trace::{self, Stage};
 use crate::Result;
 
 // ── Built-in "up" pipeline helpers ──────────────────────────────
@@ -35,13 +37,19 @@ pub fn collect_pack_intents(
     pack: &Pack,
     ctx: &ExecutionContext,
 ) -> Result<Vec<crate::operations::HandlerIntent>> {
-    let pack_config = ctx.config_manager.config_for_pack(&pack.path)?;
+    let mut pack_config = ctx.config_manager.config_for_pack(&pack.path)?;
+    crate::preprocessing::template::invocation::apply(&mut pack_config, &ctx.template_vars);
     // [secret] is intentionally root-only — see SecretSection docs.
     let root_config = ctx.config_manager.root_config()?;
     let (registry, _secret_registry) = crate::preprocessing::default_registry(
         &pack_config.preprocessor,
         &root_config.secret,
         ctx.paths.as_ref(),
+        crate::preprocessing::template::load_template_data(
+            ctx.fs.as_ref(),
+            ctx.paths.as_ref(),
+            &pack.path,
+        )?,
         ctx.command_runner.clone(),
     )?;
     collect_pack_intents_inner(pack, ctx, &pack_config, Some(&registry))
@@ -93,13 +101,19 @@ pub fn plan_pack(
     ctx: &ExecutionContext,
     mode: crate::preprocessing::PreprocessMode,
 ) -> Result<PackPlan> {
-    let pack_config = ctx.config_manager.config_for_pack(&pack.path)?;
+    let mut pack_config = ctx.config_manager.config_for_pack(&pack.path)?;
+    crate::preprocessing::template::invocation::apply(&mut pack_config, &ctx.template_vars);
     // [secret] is intentionally root-only — see SecretSection docs.
     let root_config = ctx.config_manager.root_config()?;
     let (registry, _secret_registry) = crate::preprocessing::default_registry(
         &pack_config.preprocessor,
         &root_config.secret,
         ctx.paths.as_ref(),
+        crate::preprocessing::template::load_template_data(
+            ctx.fs.as_ref(),
+            ctx.paths.as_ref(),
+            &pack.path,
+        )?,
         ctx.command_runner.clone(),
     )?;
     plan_pack_inner(pack, ctx, &pack_config, Some(&registry), mode)
@@ -110,12 +124,14 @@ pub fn plan_pack(
 /// re-merge config for every pack (the ConfigManager caches by path,
 /// but passing the config explicitly makes the data flow obvious).
 /// Resolve the gate table for a pack: built-in seed plus any
-/// user-defined `[gates]` entries from config.
+/// user-defined `[gates]` entries from config, and whether bare
+/// platform suffixes gate (`[mappings] platform_suffixes`).
 fn build_gate_table(pack_config: &crate::config::DodotConfig) -> Result<GateTable> {
     let mut table = GateTable::with_builtins();
     if !pack_config.gates.is_empty() {
         table.merge_user(&pack_config.gates)?;
     }
+    table.set_platform_suffixes(pack_config.mappings.platform_suffixes);
     Ok(table)
 }
 
@@ -152,7 +168,7 @@ pub(crate) fn filter_pre_preprocess_gates(
     pack_name: &str,
     mappings_gates: &std::collections::HashMap<String, String>,
 ) -> Result<Vec<crate::rules::PackEntry>> {
-    use crate::gates::{parse_basename_gate, BasenameGate};
+    use crate::gates::BasenameGate;
     use crate::rules::GateFailure;
 
     // Pre-compile + sort + validate `[mappings.gates]` globs via the
@@ -196,7 +212,7 @@ pub(crate) fn filter_pre_preprocess_gates(
             .file_name()
             .map(|n| n.to_string_lossy().to_string())
             .unwrap_or_default();
-        let basename_gate = parse_basename_gate(&filename);
+        let basename_gate = gates.parse_basename(&filename);
         // Forward-slash-normalised path so Windows backslashes
         // don't break globs written with `/` in config and docs.
         let rel_str = crate::gates::rel_path_for_glob(&entry.relative_path);
@@ -299,21 +315,25 @@ fn plan_pack_inner(
     preprocessors: Option<&crate::preprocessing::PreprocessorRegistry>,
     mode: crate::preprocessing::PreprocessMode,
 ) -> Result<PackPlan> {
-    let rules = crate::config::mappings_to_rules(&pack_config.mappings);
-    let gates = build_gate_table(pack_config)?;
     let host = ctx.host_facts.as_ref();
+    let mut rules = crate::config::mappings_to_rules(&pack_config.mappings);
+    rules.extend(crate::config::user_rules(
+        &pack_config.rules,
+        &format!("pack {}", pack.name),
+        &host.roles,
+    )?);
+    let gates = build_gate_table(pack_config)?;
 
-    // [pack] os gate — short-circuit inactive packs. Without this,
-    // intent collection still runs for packs the host doesn't deploy,
-    // which can hit cross-pack conflict detection or trigger
+    // [pack] os / roles gate — short-circuit inactive packs. Without
+    // this, intent collection still runs for packs the host doesn't
+    // deploy, which can hit cross-pack conflict detection or trigger
     // preprocessor side-effects (template render, secret-provider
-    // calls) that the user explicitly opted out of via `[pack] os`.
-    if !crate::gates::pack_os_active(&pack_config.pack.os, host) {
+    // calls) that the user explicitly opted out of.
+    if let Some(reason) = crate::gates::pack_inactive_reason(&pack_config.pack, host) {
         debug!(
             pack = %pack.name,
-            allowed = ?pack_config.pack.os,
-            current_os = %host.os,
-            "pack inactive on this OS, returning empty plan"
+            %reason,
+            "pack inactive on this host, returning empty plan"
         );
         return Ok(PackPlan {
             intents: Vec::new(),
@@ -324,6 +344,7 @@ fn plan_pack_inner(
     // Phase 1: Walk pack directory. The walk handles directory-segment
     // gates (`_<label>/`) — passing gates expand transparently, failing
     // gates surface as PackEntry { gate_failure: Some(...) }.
+    let walk_span = timing::span(Phase::Matching, || format!("{} walk", pack.name));
     let scanner = Scanner::new(ctx.fs.as_ref());
     let entries = scanner.walk_pack(&pack.path, &pack_config.pack.ignore, &gates, host)?;
     debug!(pack = %pack.name, entries = entries.len(), "walked pack directory");
@@ -343,9 +364,25 @@ fn plan_pack_inner(
         &pack_config.mappings.gates,
     )?;
 
+    drop(walk_span);
+
     // Phase 2: Preprocessing
     let preprocess_result = if let Some(registry) = preprocessors {
         if !registry.is_empty() && pack_config.preprocessor.enabled {
+            let _span = timing::span(Phase::Preprocess, || pack.name.clone());
+            // Phase 2a: generator templates render into the pack, and
+            // their outputs go through phase 2b and the rules below
+            // like any pack file.
+            let entries = crate::preprocessing::generate::generate_into_pack(
+                entries,
+                registry,
+                &pack_config.preprocessor.template.generate,
+                pack,
+                ctx.fs.as_ref(),
+                ctx.paths.as_ref(),
+                mode,
+                ctx.force,
+            )?;
             crate::preprocessing::pipeline::preprocess_pack(
                 entries,
                 registry,
@@ -369,6 +406,7 @@ fn plan_pack_inner(
     // matches in phase 1.5; match_entries sees them as gate_failure
     // entries and re-emits them.)
     let all_entries = preprocess_result.merged_entries();
+    let matching_span = timing::span(Phase::Matching, || format!("{} match", pack.name));
     let mut matches = scanner.match_entries(
         &all_entries,
         &rules,
@@ -377,7 +415,11 @@ fn plan_pack_inner(
         host,
         &pack_config.mappings.gates,
     )?;
+    // `--only` / `--skip` narrow the matched set before any handler
+    // sees it.
+    ctx.file_filter.apply(&mut matches);
     debug!(pack = %pack.name, files = matches.len(), "matched rules");
+    drop(matching_span);
 
     // Propagate preprocessor source info and in-memory rendered
     // bytes onto each match. Handlers that hash rendered content
@@ -395,6 +437,8 @@ fn plan_pack_inner(
         }
     }
 
+    trace::record(Stage::Matches, Some(&pack.name), &matches);
+
     // Phase 4: Group by handler
     let groups = rules::group_by_handler(&matches);
 
@@ -447,6 +491,8 @@ fn plan_pack_inner(
         }
 
         if let Some(handler_matches) = groups.get(handler_name) {
+            let intents_span =
+                timing::span(Phase::Intents, || format!("{}/{handler_name}", pack.name));
             let intents = handler.to_intents(
                 handler_matches,
                 &pack.config,
@@ -459,10 +505,15 @@ fn plan_pack_inner(
                 intents = intents.len(),
                 "generated intents"
             );
+            drop(intents_span);
             all_intents.extend(intents);
 
-            let warnings =
-                handler.warnings_for_matches(handler_matches, &pack.config, ctx.paths.as_ref());
+            let warnings = handler.warnings_for_matches(
+                handler_matches,
+                &pack.config,
+                ctx.paths.as_ref(),
+                ctx.fs.as_ref(),
+            );
             for w in &warnings {
                 tracing::warn!(pack = %pack.name, handler = %handler_name, "{w}");
             }
@@ -492,6 +543,7 @@ fn plan_pack_inner(
         warnings = all_warnings.len(),
         "collected intents"
     );
+    trace::record(Stage::Intents, Some(&pack.name), &all_intents);
     Ok(PackPlan {
         intents: all_intents,
         warnings: all_warnings,
@@ -650,6 +702,7 @@ mod tests {
                 handler,
                 source,
                 user_path,
+                ..
             } => {
                 assert_eq!(p, "app");
                 assert_eq!(handler, "symlink");
@@ -0,0 +1,393 @@
+//! Pre-flight checks for `up`.
+//!
+//! Planning decides *what* a run will do; these checks ask whether this
+//! machine can do it, after planning and before anything is touched.
+//! Without them a run stops at the first read-only directory or missing
+//! tool, with some packs deployed and the rest not. Every problem is
+//! collected, so one `up` reports all of them:
+//!
+//! - **Target directories.** The nearest existing ancestor of every
+//!   link / fetch target, and of the data dir, must be a directory
+//!   with its write bit set.
+//! - **Disk space.** Copy-mode links need room for their sources on
+//!   the target filesystem (asked of `df`; skipped when it can't say).
+//! - **Tools.** Every command a run-once intent will actually run
+//!   (`brew`, `nix`, `sh` …) and `git` for git externals must be
+//!   installed, per [`CommandRunner::find_executable`].
+//! - **Brewfile prerequisites.** For each Brewfile that will run:
+//!   `mas` and an App Store sign-in for `mas` entries, and a way to
+//!   answer `sudo` for casks with package installers — see
+//!   [`homebrew::bundle_prerequisites`].
+//!
+//! Run-once intents whose current version already ran are left out:
+//! they won't run, so a tool uninstalled since doesn't block the run.
+
+use std::collections::{BTreeMap, HashMap};
+use std::path::{Path, PathBuf};
+
+use crate::datastore::{CommandRunner, DidRunStatus};
+use crate::external::FetchSpec;
+use crate::fs::Fs;
+use crate::handlers::homebrew;
+use crate::handlers::symlink::guard::human_size;
+use crate::handlers::HANDLER_HOMEBREW;
+use crate::operations::{HandlerIntent, LinkMode};
+use crate::packs::orchestration::ExecutionContext;
+
+/// Check the planned intents against this machine. Returns one line
+/// per problem, empty when the run can go ahead.
+pub fn check(pack_intents: &[(String, Vec<HandlerIntent>)], ctx: &ExecutionContext) -> Vec<String> {
+    let fs = ctx.fs.as_ref();
+    let home = ctx.paths.home_dir();
+    let mut dirs = DirChecks::default();
+    let mut copies: BTreeMap<PathBuf, u64> = BTreeMap::new();
+    let mut tools: BTreeMap<String, Vec<String>> = BTreeMap::new();
+    let mut brewfiles: Vec<(String, PathBuf)> = Vec::new();
+
+    dirs.check(fs, "dodot", ctx.paths.data_dir());
+    for (pack, intents) in pack_intents {
+        for intent in intents {
+            match intent {
+                HandlerIntent::Link {
+                    source,
+                    user_path,
+                    mode,
+                    ..
+                } => {
+                    // Under --no-write-home the user leg is never
+                    // created, so its directory doesn't matter.
+                    if fs.write_refused(user_path) {
+                        continue;
+                    }
+                    if let Some(dir) = dirs.check(fs, pack, parent(user_path)) {
+                        if *mode == LinkMode::Copy {
+                            *copies.entry(dir).or_default() += tree_size(fs, source);
+                        }
+                    }
+                }
+                HandlerIntent::Fetch {
+                    spec, user_path, ..
+                } => {
+                    dirs.check(fs, pack, parent(user_path));
+                    if matches!(spec, FetchSpec::GitRepo { .. }) {
+                        need_tool(&mut tools, "git", pack);
+                    }
+                }
+                HandlerIntent::Run {
+                    handler,
+                    executable,
+                    arguments,
+                    filename,
+                    content_hash,
+                    ..
+                } => {
+                    let will_run = ctx.provision_rerun
+                        || !matches!(
+                            ctx.datastore.did_run(pack, handler, filename, content_hash),
+                            Ok(DidRunStatus::RanCurrent | DidRunStatus::RanDifferent { .. })
+                        );
+                    if will_run {
+                        need_tool(&mut tools, executable, pack);
+                        if handler == HANDLER_HOMEBREW {
+                            if let Some(file) = brewfile_argument(arguments) {
+                                brewfiles.push((pack.clone(), file));
+                            }
+                        }
+                    }
+                }
+                HandlerIntent::Stage { .. } => {}
+            }
+        }
+    }
+
+    let mut problems = dirs.problems(home);
+    problems.extend(space_problems(ctx.command_runner.as_ref(), &copies, home));
+    for (tool, packs) in tools {
+        if ctx.command_runner.find_executable(&tool).is_none() {
+            problems.push(format!(
+                "`{tool}` is not installed (needed by {})",
+                packs.join(", ")
+            ));
+        }
+    }
+    // Without brew the line above already says what to do.
+    if ctx.command_runner.find_executable("brew").is_some() {
+        let runner = ctx.command_runner.as_ref();
+        let host = homebrew::BundleHost::current();
+        let prefix = homebrew::brew_prefix(fs, runner);
+        for (pack, file) in brewfiles {
+            let Ok(content) = fs.read_to_string(&file) else {
+                continue;
+            };
+            problems.extend(
+                homebrew::bundle_prerequisites(fs, runner, prefix.as_deref(), &content, host)
+                    .into_iter()
+                    .map(|p| format!("{pack}: {p}")),
+            );
+        }
+    }
+    problems
+}
+
+/// The Brewfile a `brew bundle` run reads: the value of `--file`.
+fn brewfile_argument(arguments: &[String]) -> Option<PathBuf> {
+    let at = arguments.iter().position(|a| a == "--file")?;
+    arguments.get(at + 1).map(PathBuf::from)
+}
+
+fn parent(path: &Path) -> &Path {
+    path.parent().unwrap_or(path)
+}
+
+fn need_tool(tools: &mut BTreeMap<String, Vec<String>>, tool: &str, pack: &str) {
+    let packs = tools.entry(tool.to_string()).or_default();
+    if !packs.iter().any(|p| p == pack) {
+        packs.push(pack.to_string());
+    }
+}
+
+/// Verdicts on target directories, one per existing ancestor, so a
+/// read-only `~/.config` is one problem however many links go there.
+#[derive(Default)]
+struct DirChecks {
+    /// Existing ancestor → problem with it, if any.
+    verdicts: HashMap<PathBuf, Option<&'static str>>,
+    /// Existing ancestor with a problem → (first pack, first dir, how
+    /// many dirs in all).
+    failures: BTreeMap<PathBuf, (String, PathBuf, usize)>,
+}
+
+impl DirChecks {
+    /// Check that `dir` can be created and written to. Returns its
+    /// nearest existing ancestor when it can.
+    fn check(&mut self, fs: &dyn Fs, pack: &str, dir: &Path) -> Option<PathBuf> {
+        let mut existing = dir;
+        while !fs.exists(existing) {
+            existing = existing.parent()?;
+        }
+        let verdict = *self
+            .verdicts
+            .entry(existing.to_path_buf())
+            .or_insert_with(|| match fs.stat(existing) {
+                Ok(meta) if !meta.is_dir => Some("is not a directory"),
+                Ok(meta) if meta.mode & 0o200 == 0 => Some("is read-only"),
+                Ok(_) => None,
+                Err(_) => Some("can't be read"),
+            });
+        if verdict.is_none() {
+            return Some(existing.to_path_buf());
+        }
+        self.failures
+            .entry(existing.to_path_buf())
+            .and_modify(|(_, _, count)| *count += 1)
+            .or_insert_with(|| (pack.to_string(), dir.to_path_buf(), 1));
+        None
+    }
+
+    fn problems(&self, home: &Path) -> Vec<String> {
+        self.failures
+            .iter()
+            .map(|(existing, (pack, dir, count))| {
+                let reason = self.verdicts[existing].expect("only failed verdicts are recorded");
+                let mut line = format!(
+                    "{pack}: can't write to {}: {} {reason}",
+                    display(dir, home),
+                    display(existing, home)
+                );
+                if *count > 1 {
+                    line.push_str(&format!(" (and {} more)", count - 1));
+                }
+                line
+            })
+            .collect()
+    }
+}
+
+/// Bytes `path` takes up: its length, or its files' total for a
+/// directory.
+fn tree_size(fs: &dyn Fs, path: &Path) -> u64 {
+    if !fs.is_dir(path) {
+        return fs.stat(path).map(|m| m.len).unwrap_or(0);
+    }
+    fs.read_dir(path)
+        .map(|entries| entries.iter().map(|e| tree_size(fs, &e.path)).sum())
+        .unwrap_or(0)
+}
+
+/// Copies that won't fit, summed per filesystem.
+fn space_problems(
+    runner: &dyn CommandRunner,
+    copies: &BTreeMap<PathBuf, u64>,
+    home: &Path,
+) -> Vec<String> {
+    let mut per_mount: BTreeMap<String, (u64, u64)> = BTreeMap::new();
+    for (dir, needed) in copies {
+        let Some((mount, available)) = available_space(runner, dir) else {
+            continue;
+        };
+        per_mount.entry(mount).or_insert((0, available)).0 += needed;
+    }
+    per_mount
+        .into_iter()
+        .filter(|(_, (needed, available))| needed > available)
+        .map(|(mount, (needed, available))| {
+            format!(
+                "not enough space on {} for copies: {} needed, {} free",
+                display(Path::new(&mount), home),
+                human_size(needed),
+                human_size(available)
+            )
+        })
+        .collect()
+}
+
+/// Mount point and free bytes of the filesystem holding `dir`, from
+/// POSIX `df -Pk` output. `None` when `df` fails or says something
+/// else.
+fn available_space(runner: &dyn CommandRunner, dir: &Path) -> Option<(String, u64)> {
+    let args = ["-Pk".to_string(), dir.display().to_string()];
+    let out = runner.run("df", &args).ok()?;
+    let line = out.stdout.lines().nth(1)?;
+    let columns: Vec<&str> = line.split_whitespace().collect();
+    let kilobytes: u64 = columns.get(3)?.parse().ok()?;
+    let mount = columns.get(5..)?.join(" ");
+    Some((mount, kilobytes * 1024))
+}
+
+fn display(path: &Path, home: &Path) -> String {
+    match path.strip_prefix(home) {
+        Ok(rel) if rel.as_os_str().is_empty() => "~".into(),
+        Ok(rel) => format!("~/{}", rel.display()),
+        Err(_) => path.display().to_string(),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::commands::tests::support::make_ctx;
+    use crate::datastore::CommandOutput;
+    use crate::testing::TempEnvironment;
+    use crate::Result;
+
+    /// Runner with a fixed `df` answer and a list of missing tools.
+    struct Machine {
+        df: &'static str,
+        missing: &'static [&'static str],
+    }
+
+    impl CommandRunner for Machine {
+        fn run(&self, _: &str, _: &[String]) -> Result<CommandOutput> {
+            Ok(CommandOutput {
+                exit_code: 0,
+                stdout: self.df.into(),
+                stderr: String::new(),
+            })
+        }
+
+        fn find_executable(&self, name: &str) -> Option<PathBuf> {
+            (!self.missing.contains(&name)).then(|| PathBuf::from("/usr/bin").join(name))
+        }
+    }
+
+    fn link(pack: &str, source: PathBuf, user_path: PathBuf, mode: LinkMode) -> HandlerIntent {
+        HandlerIntent::Link {
+            pack: pack.into(),
+            handler: "symlink".into(),
+            source,
+            user_path,
+            mode,
+            perms: None,
+        }
+    }
+
+    fn run(pack: &str, executable: &str) -> HandlerIntent {
+        HandlerIntent::Run {
+            pack: pack.into(),
+            handler: "homebrew".into(),
+            executable: executable.into(),
+            arguments: Vec::new(),
+            sentinel: "Brewfile-0123456789abcdef".into(),
+            filename: "Brewfile".into(),
+            content_hash: "0123456789abcdef".into(),
+        }
+    }
+
+    #[test]
+    fn every_problem_is_reported_at_once() {
+        let env = TempEnvironment::builder()
+            .pack("vim")
+            .file("vimrc", &"x".repeat(4096))
+            .done()
+            .build();
+        let mut ctx = make_ctx(&env);
+        ctx.command_runner = std::sync::Arc::new(Machine {
+            df: "Filesystem 1024-blocks Used Available Capacity Mounted on\n\
+                 /dev/disk1 100 99 1 99% /\n",
+            missing: &["brew"],
+        });
+
+        let locked = env.home.join("locked");
+        env.fs.mkdir_all(&locked).unwrap();
+        // Judged by the mode bits, so this holds under root too.
+        let _guard = env.read_only(&locked);
+        let vimrc = env.dotfiles_root.join("vim/vimrc");
+        let intents = vec![(
+            "vim".to_string(),
+            vec![
+                link(
+                    "vim",
+                    vimrc.clone(),
+                    locked.join("a/.vimrc"),
+                    LinkMode::Symlink,
+                ),
+                link(
+                    "vim",
+                    vimrc.clone(),
+                    locked.join(".exrc"),
+                    LinkMode::Symlink,
+                ),
+                link("vim", vimrc, env.home.join(".vimrc"), LinkMode::Copy),
+                run("vim", "brew"),
+                run("vim", "sh"),
+            ],
+        )];
+
+        let problems = check(&intents, &ctx);
+        assert_eq!(problems.len(), 3, "{problems:#?}");
+        assert_eq!(
+            problems[0],
+            "vim: can't write to ~/locked/a: ~/locked is read-only (and 1 more)"
+        );
+        assert!(
+            problems[1].starts_with("not enough space on / for copies: 4.0 KB needed"),
+            "{problems:#?}"
+        );
+        assert_eq!(problems[2], "`brew` is not installed (needed by vim)");
+    }
+
+    #[test]
+    fn tools_for_intents_that_already_ran_are_not_needed() {
+        let env = TempEnvironment::builder().build();
+        let mut ctx = make_ctx(&env);
+        ctx.command_runner = std::sync::Arc::new(Machine {
+            df: "",
+            missing: &["brew"],
+        });
+        let intents = vec![("mac".to_string(), vec![run("mac", "brew")])];
+        assert_eq!(check(&intents, &ctx).len(), 1);
+
+        env.fs
+            .mkdir_all(&env.paths.handler_data_dir("mac", "homebrew"))
+            .unwrap();
+        env.fs
+            .write_file(
+                &env.paths
+                    .handler_data_dir("mac", "homebrew")
+                    .join("Brewfile-0123456789abcdef"),
+                b"",
+            )
+            .unwrap();
+        assert!(check(&intents, &ctx).is_empty());
+    }
+}
@@ -0,0 +1,191 @@
+//! Recovery for data-dir files cut short by a crash.
+//!
+//! Everything dodot writes into the data dir goes through
+//! [`Fs::write_file_atomic`](crate::fs::Fs::write_file_atomic), so a
+//! crash mid-write leaves the previous file plus a `.dodot-tmp`
+//! sibling rather than a truncated file. This pass cleans up after
+//! such crashes, and after older dodot versions that wrote in place:
+//!
+//! - stray `.dodot-tmp` files are removed (they would otherwise count
+//!   as handler state);
+//! - `dodot-init.sh` and `deployment-map.tsv` are regenerated from the
+//!   datastore when their trailer line is missing.
+//!
+//! `up` runs the repair. `status` only reports damage through
+//! [`damaged_generated_files`], and `init-sh` writes nothing: it builds
+//! its script fresh from the datastore, so a damaged file on disk
+//! can't affect it.
+//!
+//! Sentinels need no repair: a sentinel whose payload doesn't parse
+//! still marks its revision as run, it just shows no run metadata.
+
+use std::path::Path;
+
+use tracing::warn;
+
+use crate::fs::{Fs, ATOMIC_TMP_SUFFIX};
+use crate::packs::orchestration::{path_priorities, ExecutionContext};
+use crate::{probe, shell, Result};
+
+/// Sweep stray temp files and regenerate truncated generated files.
+/// Returns one human-readable line per repair, suitable for the
+/// command's warnings.
+pub fn repair_generated_files(ctx: &ExecutionContext) -> Result<Vec<String>> {
+    let fs = ctx.fs.as_ref();
+    let paths = ctx.paths.as_ref();
+    let mut repaired = Vec::new();
+
+    let removed = sweep_temp_files(fs, paths.data_dir(), 3);
+    if removed > 0 {
+        repaired.push(format!(
+            "removed {removed} incomplete write(s) left in the data dir by an interrupted run"
+        ));
+    }
+
+    let init = paths.init_script_path();
+    if is_truncated(fs, &init, shell::init_script_is_complete) {
+        let root_config = ctx.config_manager.root_config()?;
+        shell::write_init_script(
+            fs,
+            paths,
+            root_config.profiling.enabled,
+            &path_priorities(ctx)?,
+        )?;
+        repaired.push(format!("regenerated truncated {}", init.display()));
+    }
+
+    let map = paths.deployment_map_path();
+    if is_truncated(fs, &map, probe::deployment_map_is_complete) {
+        probe::write_deployment_map(fs, paths)?;
+        repaired.push(format!("regenerated truncated {}", map.display()));
+    }
+
+    for line in &repaired {
+        warn!("{line}");
+    }
+    Ok(repaired)
+}
+
+/// Report, without touching anything, what [`repair_generated_files`]
+/// would fix. One line per finding, suitable for `status` warnings.
+pub fn damaged_generated_files(ctx: &ExecutionContext) -> Vec<String> {
+    let fs = ctx.fs.as_ref();
+    let paths = ctx.paths.as_ref();
+    let mut damaged = Vec::new();
+
+    let strays = count_temp_files(fs, paths.data_dir(), 3);
+    if strays > 0 {
+        damaged.push(format!(
+            "{strays} incomplete write(s) left in the data dir by an interrupted run; `dodot up` removes them"
+        ));
+    }
+    let init = paths.init_script_path();
+    if is_truncated(fs, &init, shell::init_script_is_complete) {
+        damaged.push(format!(
+            "{} is truncated; `dodot up` regenerates it",
+            init.display()
+        ));
+    }
+    let map = paths.deployment_map_path();
+    if is_truncated(fs, &map, probe::deployment_map_is_complete) {
+        damaged.push(format!(
+            "{} is truncated; `dodot up` regenerates it",
+            map.display()
+        ));
+    }
+    damaged
+}
+
+/// A file that exists but fails its completeness check. Missing files
+/// are not truncated — they are simply not generated yet.
+fn is_truncated(fs: &dyn Fs, path: &Path, complete: fn(&str) -> bool) -> bool {
+    if !fs.exists(path) {
+        return false;
+    }
+    match fs.read_to_string(path) {
+        Ok(content) => !complete(&content),
+        // Unreadable as UTF-8 counts as damaged too.
+        Err(_) => true,
+    }
+}
+
+/// Remove `*.dodot-tmp` files under `dir`, descending `depth` levels
+/// (data dir → `packs` → `<pack>` → `<handler>`). Symlinked
+/// directories are not followed. Returns how many were removed.
+fn sweep_temp_files(fs: &dyn Fs, dir: &Path, depth: usize) -> usize {
+    let Ok(entries) = fs.read_dir(dir) else {
+        return 0;
+    };
+    let mut removed = 0;
+    for entry in entries {
+        if entry.is_file && entry.name.ends_with(ATOMIC_TMP_SUFFIX) {
+            if fs.remove_file(&entry.path).is_ok() {
+                removed += 1;
+            }
+        } else if entry.is_dir && !entry.is_symlink && depth > 0 {
+            removed += sweep_temp_files(fs, &entry.path, depth - 1);
+        }
+    }
+    removed
+}
+
+/// Count `*.dodot-tmp` files the way [`sweep_temp_files`] would find
+/// them, without removing any.
+fn count_temp_files(fs: &dyn Fs, dir: &Path, depth: usize) -> usize {
+    let Ok(entries) = fs.read_dir(dir) else {
+        return 0;
+    };
+    let mut found = 0;
+    for entry in entries {
+        if entry.is_file && entry.name.ends_with(ATOMIC_TMP_SUFFIX) {
+            found += 1;
+        } else if entry.is_dir && !entry.is_symlink && depth > 0 {
+            found += count_temp_files(fs, &entry.path, depth - 1);
+        }
+    }
+    found
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::packs::orchestration::test_support::make_context;
+    use crate::paths::Pather;
+    use crate::testing::TempEnvironment;
+
+    #[test]
+    fn regenerates_truncated_files_and_sweeps_temps() {
+        let env = TempEnvironment::builder()
+            .pack("vim")
+            .file("vimrc", "x")
+            .done()
+            .build();
+        let ctx = make_context(&env);
+        let fs = env.fs.as_ref();
+
+        let init = env.paths.init_script_path();
+        fs.mkdir_all(init.parent().unwrap()).unwrap();
+        fs.write_file(&init, b"#!/bin/sh\n# Generated by dodot")
+            .unwrap();
+        let stray = env
+            .paths
+            .handler_data_dir("vim", "install")
+            .join(".install.sh-0123456789abcdef.dodot-tmp");
+        fs.mkdir_all(stray.parent().unwrap()).unwrap();
+        fs.write_file(&stray, b"{\"comp").unwrap();
+
+        // Reporting alone leaves both in place.
+        assert_eq!(damaged_generated_files(&ctx).len(), 2);
+        assert!(fs.exists(&stray));
+
+        let repaired = repair_generated_files(&ctx).unwrap();
+        assert_eq!(repaired.len(), 2, "{repaired:?}");
+        assert!(!fs.exists(&stray));
+        let script = fs.read_to_string(&init).unwrap();
+        assert!(shell::init_script_is_complete(&script));
+
+        // A second pass finds nothing to do.
+        assert!(repair_generated_files(&ctx).unwrap().is_empty());
+        assert!(damaged_generated_files(&ctx).is_empty());
+    }
+}
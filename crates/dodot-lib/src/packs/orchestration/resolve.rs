@@ -2,9 +2,9 @@
 //!
 //! User-supplied pack identifiers come in two flavours: the on-disk
 //! directory name (`010-nvim`) and the display name (`nvim`). These
-//! helpers map either form onto a concrete on-disk directory, and
-//! validate a list of names before any orchestration loop touches the
-//! filesystem.
+//! helpers map either form onto a concrete on-disk directory, expand
+//! globs and `[groups]` into pack names, and validate a list of names
+//! before any orchestration loop touches the filesystem.
 
 use crate::packs;
 use crate::packs::context::ExecutionContext;
@@ -21,10 +21,10 @@ use crate::packs::context::ExecutionContext;
 /// packs (the caller decides whether being ignored is fatal).
 pub fn resolve_pack_dir_name(input: &str, ctx: &ExecutionContext) -> crate::Result<String> {
     let root_config = ctx.config_manager.root_config()?;
-    let scanned = packs::scan_packs(
+    let scanned = packs::scan_root(
         ctx.fs.as_ref(),
         ctx.paths.dotfiles_root(),
-        &root_config.pack.ignore,
+        &root_config.pack,
     )?;
     if let Some(p) = scanned
         .packs
@@ -52,10 +52,10 @@ pub fn resolve_pack_dir_name(input: &str, ctx: &ExecutionContext) -> crate::Resu
 /// The display name is the recommended form.
 pub fn validate_pack_names(names: &[String], ctx: &ExecutionContext) -> crate::Result<Vec<String>> {
     let root_config = ctx.config_manager.root_config()?;
-    let scanned = packs::scan_packs(
+    let scanned = packs::scan_root(
         ctx.fs.as_ref(),
         ctx.paths.dotfiles_root(),
-        &root_config.pack.ignore,
+        &root_config.pack,
     )?;
 
     let mut warnings = Vec::new();
@@ -82,13 +82,86 @@ pub fn validate_pack_names(names: &[String], ctx: &ExecutionContext) -> crate::R
     Ok(warnings)
 }
 
+/// Expand pack selectors into concrete pack names.
+///
+/// Each input is, in order of precedence:
+///
+/// - an existing pack (display or on-disk name) — kept as-is, so a pack
+///   never loses to a same-named group;
+/// - a group from the root config's `[groups]` table — replaced by its
+///   members, which may themselves be names or globs (not groups);
+/// - a glob (`lang-*`, `?sh`, `[ab]*`) — replaced by the display names
+///   of every active pack it matches;
+/// - anything else — kept as-is, so [`validate_pack_names`] reports it.
+///
+/// A glob or group member glob that matches nothing is a
+/// [`DodotError::PackNotFound`](crate::DodotError::PackNotFound) —
+/// the same error a misspelled name gets. Output is de-duplicated and
+/// keeps first-seen order.
+pub fn expand_pack_selectors(
+    names: &[String],
+    ctx: &ExecutionContext,
+) -> crate::Result<Vec<String>> {
+    let root_config = ctx.config_manager.root_config()?;
+    let scanned = packs::scan_root(
+        ctx.fs.as_ref(),
+        ctx.paths.dotfiles_root(),
+        &root_config.pack,
+    )?;
+    let is_pack = |input: &str| {
+        scanned
+            .packs
+            .iter()
+            .any(|p| p.display_name == input || p.name == input)
+    };
+
+    let mut out: Vec<String> = Vec::new();
+    let mut push = |name: String| {
+        if !out.contains(&name) {
+            out.push(name);
+        }
+    };
+    for input in names {
+        let selectors: Vec<&String> = match root_config.groups.get(input) {
+            Some(members) if !is_pack(input) => members.iter().collect(),
+            _ => vec![input],
+        };
+        for selector in selectors {
+            if is_pack(selector) || !is_glob(selector) {
+                push(selector.clone());
+                continue;
+            }
+            let pattern = glob::Pattern::new(selector).map_err(|e| {
+                crate::DodotError::Config(format!("invalid pack pattern `{selector}`: {e}"))
+            })?;
+            let matched: Vec<String> = scanned
+                .packs
+                .iter()
+                .filter(|p| pattern.matches(&p.display_name) || pattern.matches(&p.name))
+                .map(|p| p.display_name.clone())
+                .collect();
+            if matched.is_empty() {
+                return Err(crate::DodotError::PackNotFound {
+                    name: selector.clone(),
+                });
+            }
+            matched.into_iter().for_each(&mut push);
+        }
+    }
+    Ok(out)
+}
+
+fn is_glob(s: &str) -> bool {
+    s.contains(['*', '?', '['])
+}
+
 #[cfg(test)]
 mod tests {
     #![allow(unused_imports)]
 
     use super::super::execute;
     use super::super::test_support::{make_context, TestUpCommand};
-    use super::resolve_pack_dir_name;
+    use super::{expand_pack_selectors, resolve_pack_dir_name};
     use crate::testing::TempEnvironment;
 
     #[test]
@@ -132,4 +205,52 @@ mod tests {
             crate::DodotError::PackNotFound { ref name } if name == "nope"
         ));
     }
+
+    fn lang_env() -> TempEnvironment {
+        TempEnvironment::builder()
+            .pack("lang-go")
+            .file("goenv", "x")
+            .done()
+            .pack("010-lang-rust")
+            .file("cargo", "x")
+            .done()
+            .pack("vim")
+            .file("vimrc", "x")
+            .done()
+            .build()
+    }
+
+    #[test]
+    fn expand_pack_selectors_matches_globs_against_display_names() {
+        let env = lang_env();
+        let ctx = make_context(&env);
+        let mut got = expand_pack_selectors(&["lang-*".into(), "vim".into()], &ctx).unwrap();
+        got.sort();
+        assert_eq!(got, vec!["lang-go", "lang-rust", "vim"]);
+
+        let err = expand_pack_selectors(&["zz-*".into()], &ctx).unwrap_err();
+        assert!(matches!(err, crate::DodotError::PackNotFound { ref name } if name == "zz-*"));
+    }
+
+    #[test]
+    fn expand_pack_selectors_expands_groups_and_dedups() {
+        use crate::fs::Fs;
+        let env = lang_env();
+        env.fs
+            .write_file(
+                &env.dotfiles_root.join(".dodot.toml"),
+                b"[groups]\ndev = [\"lang-*\", \"vim\"]\nvim = [\"lang-go\"]\n",
+            )
+            .unwrap();
+        let ctx = make_context(&env);
+
+        let got =
+            expand_pack_selectors(&["dev".into(), "vim".into(), "lang-go".into()], &ctx).unwrap();
+        assert_eq!(got.len(), 3, "got {got:?}");
+        assert!(got.contains(&"vim".to_string()));
+
+        // A real pack named like a group is selected as the pack.
+        let got = expand_pack_selectors(&["vim".into()], &ctx).unwrap();
+        assert_eq!(got, vec!["vim"]);
+    }
 }
@@ -0,0 +1,333 @@
+//! Stage scheduler for `up`.
+//!
+//! Handlers declare a [`RunStage`] (derived from their phase) and
+//! whether they are [`parallel_safe`](crate::handlers::Handler::parallel_safe).
+//! `up` splits each pack's intents by stage, then runs the stages in
+//! order across every pack:
+//!
+//! ```text
+//! pre-provision   fetch externals              all packs
+//! provision       brew / nix / install.sh …    all packs
+//! link            PATH, shell init, symlinks   all packs
+//! post-link       (declared by no built-in handler today)
+//! ```
+//!
+//! Within a stage, a pack's intents keep their phase order. Packs that
+//! use any handler that isn't parallel-safe go first, one at a time in
+//! pack order — a Brewfile is installed before any other pack's work in
+//! the stage starts. The remaining packs then run side by side on up to
+//! [`std::thread::available_parallelism`] threads, except that packs
+//! holding a named resource in common
+//! ([`resources`](crate::handlers::Handler::resources): `ssh-agent`,
+//! `plugin-managers`, …) run one after the other, in pack order. A pack
+//! starts once nothing running holds one of its resources and no pack
+//! before it still waiting needs one.
+//!
+//! A pack whose stage fails with an error (not just a failed operation)
+//! sits out the later stages, as it did when each pack ran start to
+//! finish on its own.
+
+use std::collections::{BTreeMap, BTreeSet, HashMap};
+use std::sync::{Condvar, Mutex};
+
+use tracing::{debug, info};
+
+use super::ExecutorSettings;
+use crate::handlers::{self, RunStage};
+use crate::operations::{HandlerIntent, OperationResult};
+use crate::Result;
+
+/// What the scheduler needs to know about a handler.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct HandlerTraits {
+    pub stage: RunStage,
+    pub parallel_safe: bool,
+    pub resources: &'static [&'static str],
+}
+
+/// [`HandlerTraits`] for every registered handler, by name.
+pub fn handler_traits(fs: &dyn crate::fs::Fs) -> HashMap<String, HandlerTraits> {
+    // Only `stage()` / `parallel_safe()` are read, never `to_intents`,
+    // so a noop runner is enough (see `configuration_handler_names`).
+    let runner = crate::datastore::NoopCommandRunner;
+    handlers::create_registry(fs, &runner)
+        .iter()
+        .map(|(name, h)| {
+            let traits = HandlerTraits {
+                stage: h.stage(),
+                parallel_safe: h.parallel_safe(),
+                resources: h.resources(),
+            };
+            (name.clone(), traits)
+        })
+        .collect()
+}
+
+/// Traits for a handler the registry doesn't know: the link stage,
+/// one pack at a time.
+const UNKNOWN_HANDLER: HandlerTraits = HandlerTraits {
+    stage: RunStage::Link,
+    parallel_safe: false,
+    resources: &[],
+};
+
+/// One pack's intents for one stage.
+#[derive(Debug)]
+pub struct StageWork {
+    pub pack: String,
+    pub intents: Vec<HandlerIntent>,
+}
+
+/// Split each pack's intents by stage. Stages with no intents are left
+/// out; packs keep their order within a stage, intents theirs.
+pub fn split_by_stage(
+    pack_intents: Vec<(String, Vec<HandlerIntent>)>,
+    traits: &HashMap<String, HandlerTraits>,
+) -> BTreeMap<RunStage, Vec<StageWork>> {
+    let mut stages: BTreeMap<RunStage, Vec<StageWork>> = BTreeMap::new();
+    for (pack, intents) in pack_intents {
+        let mut by_stage: BTreeMap<RunStage, Vec<HandlerIntent>> = BTreeMap::new();
+        for intent in intents {
+            let stage = traits_for(traits, intent.handler()).stage;
+            by_stage.entry(stage).or_default().push(intent);
+        }
+        for (stage, intents) in by_stage {
+            stages.entry(stage).or_default().push(StageWork {
+                pack: pack.clone(),
+                intents,
+            });
+        }
+    }
+    stages
+}
+
+/// Run one stage: the packs using a handler that isn't parallel-safe
+/// in order, then the rest in parallel, one at a time among packs that
+/// share a resource. Results come back in `work` order.
+pub(crate) fn run_stage(
+    stage: RunStage,
+    work: Vec<StageWork>,
+    traits: &HashMap<String, HandlerTraits>,
+    settings: &ExecutorSettings<'_>,
+) -> Vec<(String, Result<Vec<OperationResult>>)> {
+    let (serial, parallel): (Vec<_>, Vec<_>) = work.into_iter().enumerate().partition(|(_, w)| {
+        w.intents
+            .iter()
+            .any(|i| !traits_for(traits, i.handler()).parallel_safe)
+    });
+    info!(
+        stage = stage.label(),
+        serial = serial.len(),
+        parallel = parallel.len(),
+        "running stage"
+    );
+
+    let run = |(index, work): (usize, StageWork)| {
+        debug!(stage = stage.label(), pack = %work.pack, "running pack");
+        (index, work.pack, settings.execute(work.intents))
+    };
+    let mut results: Vec<_> = serial.into_iter().map(run).collect();
+
+    let workers = std::thread::available_parallelism().map_or(1, |n| n.get());
+    if parallel.len() < 2 || workers < 2 {
+        // In pack order, which already keeps resource holders apart.
+        results.extend(parallel.into_iter().map(run));
+    } else {
+        let waiting: Vec<_> = parallel
+            .into_iter()
+            .map(|item| {
+                let resources = resources_of(&item.1, traits);
+                (item, resources)
+            })
+            .collect();
+        let threads = workers.min(waiting.len());
+        let queue = Mutex::new(Queue {
+            waiting,
+            held: BTreeSet::new(),
+        });
+        let freed = Condvar::new();
+        let worker = || {
+            let mut done = Vec::new();
+            while let Some((item, resources)) = take_next(&queue, &freed) {
+                done.push(run(item));
+                let mut state = queue.lock().expect("stage queue poisoned");
+                for resource in &resources {
+                    state.held.remove(resource);
+                }
+                freed.notify_all();
+            }
+            done
+        };
+        std::thread::scope(|scope| {
+            let handles: Vec<_> = (0..threads).map(|_| scope.spawn(worker)).collect();
+            for handle in handles {
+                results.extend(handle.join().expect("stage worker thread panicked"));
+            }
+        });
+    }
+
+    results.sort_by_key(|(index, _, _)| *index);
+    results
+        .into_iter()
+        .map(|(_, pack, result)| (pack, result))
+        .collect()
+}
+
+type Resources = BTreeSet<&'static str>;
+
+/// Packs waiting to run in a parallel stage, in pack order, and the
+/// resources the running ones hold.
+struct Queue {
+    waiting: Vec<((usize, StageWork), Resources)>,
+    held: Resources,
+}
+
+/// Every resource a pack's intents hold.
+fn resources_of(work: &StageWork, traits: &HashMap<String, HandlerTraits>) -> Resources {
+    work.intents
+        .iter()
+        .flat_map(|i| traits_for(traits, i.handler()).resources.iter().copied())
+        .collect()
+}
+
+/// Block until a waiting pack can start, take it and mark its
+/// resources held. `None` once nothing is left.
+fn take_next(queue: &Mutex<Queue>, freed: &Condvar) -> Option<((usize, StageWork), Resources)> {
+    let mut queue = queue.lock().expect("stage queue poisoned");
+    loop {
+        if queue.waiting.is_empty() {
+            return None;
+        }
+        let wants: Vec<&Resources> = queue.waiting.iter().map(|(_, r)| r).collect();
+        if let Some(pos) = next_runnable(&wants, &queue.held) {
+            let (item, resources) = queue.waiting.remove(pos);
+            debug!(pack = %item.1.pack, ?resources, "taking resources");
+            queue.held.extend(resources.iter().copied());
+            return Some((item, resources));
+        }
+        queue = freed.wait(queue).expect("stage queue poisoned");
+    }
+}
+
+/// The first waiting pack whose resources are neither held nor wanted
+/// by a pack ahead of it, so packs sharing a resource start in order.
+/// With nothing held the first pack always qualifies, so a queue never
+/// stalls while no pack runs.
+fn next_runnable(waiting: &[&Resources], held: &Resources) -> Option<usize> {
+    let mut reserved = held.clone();
+    for (pos, wants) in waiting.iter().enumerate() {
+        if reserved.is_disjoint(wants) {
+            return Some(pos);
+        }
+        reserved.extend(wants.iter().copied());
+    }
+    None
+}
+
+fn traits_for<'a>(traits: &'a HashMap<String, HandlerTraits>, handler: &str) -> &'a HandlerTraits {
+    traits.get(handler).unwrap_or(&UNKNOWN_HANDLER)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::operations::LinkMode;
+    use std::path::PathBuf;
+
+    fn link(pack: &str, handler: &str) -> HandlerIntent {
+        HandlerIntent::Link {
+            pack: pack.into(),
+            handler: handler.into(),
+            source: PathBuf::from(format!("/d/{pack}/{handler}")),
+            user_path: PathBuf::from(format!("/h/{pack}-{handler}")),
+            mode: LinkMode::Symlink,
+            perms: None,
+        }
+    }
+
+    #[test]
+    fn intents_split_into_stages_in_pack_order() {
+        let traits: HashMap<String, HandlerTraits> = [
+            ("homebrew", RunStage::Provision, false),
+            ("plugins", RunStage::Provision, true),
+            ("symlink", RunStage::Link, true),
+        ]
+        .into_iter()
+        .map(|(name, stage, parallel_safe)| {
+            let traits = HandlerTraits {
+                stage,
+                parallel_safe,
+                resources: &[],
+            };
+            (name.to_string(), traits)
+        })
+        .collect();
+
+        let stages = split_by_stage(
+            vec![
+                (
+                    "vim".into(),
+                    vec![link("vim", "plugins"), link("vim", "symlink")],
+                ),
+                ("git".into(), vec![link("git", "symlink")]),
+                ("brew".into(), vec![link("brew", "homebrew")]),
+            ],
+            &traits,
+        );
+        let order: Vec<(RunStage, Vec<&str>)> = stages
+            .iter()
+            .map(|(stage, work)| (*stage, work.iter().map(|w| w.pack.as_str()).collect()))
+            .collect();
+        assert_eq!(
+            order,
+            vec![
+                (RunStage::Provision, vec!["vim", "brew"]),
+                (RunStage::Link, vec!["vim", "git"]),
+            ]
+        );
+        // An unregistered handler lands in the link stage.
+        let stages = split_by_stage(vec![("x".into(), vec![link("x", "mystery")])], &traits);
+        assert!(stages.contains_key(&RunStage::Link));
+    }
+
+    #[test]
+    fn builtin_stages_follow_phases() {
+        let env = crate::testing::TempEnvironment::builder().build();
+        let traits = handler_traits(env.fs.as_ref());
+        assert_eq!(traits["external"].stage, RunStage::PreProvision);
+        assert_eq!(traits["homebrew"].stage, RunStage::Provision);
+        assert!(!traits["homebrew"].parallel_safe);
+        assert!(!traits["install"].parallel_safe);
+        assert!(traits["plugins"].parallel_safe);
+        assert!(!traits["mise"].parallel_safe);
+        assert_eq!(traits["symlink"].stage, RunStage::Link);
+        assert!(traits["symlink"].parallel_safe);
+        assert!(traits["symlink"].resources.is_empty());
+        assert!(traits["sshkeys"].resources.contains(&"ssh-agent"));
+        assert!(traits["agent"].resources.contains(&"ssh-agent"));
+    }
+
+    #[test]
+    fn packs_sharing_a_resource_start_in_pack_order() {
+        let set = |names: &[&'static str]| names.iter().copied().collect::<Resources>();
+        let (a, b, ac, c, none) = (
+            set(&["a"]),
+            set(&["b"]),
+            set(&["a", "c"]),
+            set(&["c"]),
+            set(&[]),
+        );
+
+        // `a` is held: the next `a` pack waits, `b` goes.
+        assert_eq!(next_runnable(&[&a, &b, &ac], &set(&["a"])), Some(1));
+        // `c` is free but an earlier pack waiting on `a` wants it too,
+        // so the `c` pack waits its turn; one with no resources doesn't.
+        assert_eq!(
+            next_runnable(&[&a, &ac, &c, &none], &set(&["a", "b"])),
+            Some(3)
+        );
+        assert_eq!(next_runnable(&[&a, &ac, &c], &set(&["a", "b"])), None);
+        // Nothing held: the first pack always starts.
+        assert_eq!(next_runnable(&[&ac, &a], &set(&[])), Some(0));
+    }
+}
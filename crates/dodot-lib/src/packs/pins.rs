@@ -0,0 +1,159 @@
+//! Pinned packs — this machine's list of packs `up` must not touch.
+//!
+//! `dodot pin <pack>` freezes a pack where it is: `up`, `plan` and
+//! `provision` skip it, so its links, shell state and sentinels stay
+//! exactly as the last run left them while the repo moves on. Useful
+//! for a temporary local divergence (a work laptop holding an older
+//! `git` pack, a half-migrated `nvim`) without editing the repo.
+//! `dodot status` still reports the pack, marked `pinned`.
+//!
+//! Pins are host state, not repo state: they live in
+//! `<data_dir>/pins.json` (per host when state is namespaced), keyed
+//! by the pack's on-disk directory name like the rest of the
+//! datastore.
+
+use std::collections::BTreeMap;
+
+use serde::{Deserialize, Serialize};
+
+use crate::fs::Fs;
+use crate::paths::Pather;
+use crate::{DodotError, Result};
+
+const SCHEMA_VERSION: u32 = 1;
+
+/// One pinned pack.
+#[derive(Debug, Clone, Serialize, Deserialize, PartialEq, Eq)]
+pub struct Pin {
+    /// Unix seconds.
+    pub pinned_at: u64,
+    /// Why, as given to `dodot pin --reason`.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub reason: Option<String>,
+}
+
+#[derive(Debug, Clone, Serialize, Deserialize)]
+struct PinFile {
+    version: u32,
+    #[serde(default)]
+    packs: BTreeMap<String, Pin>,
+}
+
+impl Default for PinFile {
+    fn default() -> Self {
+        Self {
+            version: SCHEMA_VERSION,
+            packs: BTreeMap::new(),
+        }
+    }
+}
+
+/// The pinned packs of this machine. Mutations are in-memory until
+/// [`Pins::save`].
+#[derive(Debug, Clone, Default)]
+pub struct Pins {
+    file: PinFile,
+}
+
+impl Pins {
+    /// Read the pin file. Missing means nothing is pinned.
+    pub fn load(fs: &dyn Fs, paths: &dyn Pather) -> Result<Self> {
+        let path = paths.pins_path();
+        if !fs.exists(&path) {
+            return Ok(Self::default());
+        }
+        let raw = fs.read_to_string(&path)?;
+        let file: PinFile = serde_json::from_str(&raw)
+            .map_err(|e| DodotError::Other(format!("failed to parse {}: {e}", path.display())))?;
+        if file.version != SCHEMA_VERSION {
+            return Err(DodotError::Other(format!(
+                "{} has unsupported schema version {} (expected {SCHEMA_VERSION})",
+                path.display(),
+                file.version
+            )));
+        }
+        Ok(Self { file })
+    }
+
+    /// Write the pin file, or remove it once nothing is pinned.
+    pub fn save(&self, fs: &dyn Fs, paths: &dyn Pather) -> Result<()> {
+        let path = paths.pins_path();
+        if self.file.packs.is_empty() {
+            if fs.exists(&path) {
+                fs.remove_file(&path)?;
+            }
+            return Ok(());
+        }
+        if let Some(parent) = path.parent() {
+            fs.mkdir_all(parent)?;
+        }
+        let body = serde_json::to_string_pretty(&self.file)
+            .map_err(|e| DodotError::Other(format!("failed to serialise pins: {e}")))?;
+        fs.write_file_atomic(&path, body.as_bytes())
+    }
+
+    /// Whether the pack with on-disk name `pack` is pinned.
+    pub fn is_pinned(&self, pack: &str) -> bool {
+        self.file.packs.contains_key(pack)
+    }
+
+    pub fn get(&self, pack: &str) -> Option<&Pin> {
+        self.file.packs.get(pack)
+    }
+
+    /// Pin `pack`. Returns `false` when it already was; the original
+    /// pin (and its reason) is kept.
+    pub fn pin(&mut self, pack: &str, pin: Pin) -> bool {
+        if self.is_pinned(pack) {
+            return false;
+        }
+        self.file.packs.insert(pack.to_string(), pin);
+        true
+    }
+
+    /// Unpin `pack`. Returns `false` when it wasn't pinned.
+    pub fn unpin(&mut self, pack: &str) -> bool {
+        self.file.packs.remove(pack).is_some()
+    }
+
+    /// Pinned packs by on-disk name, sorted.
+    pub fn iter(&self) -> impl Iterator<Item = (&str, &Pin)> {
+        self.file.packs.iter().map(|(k, v)| (k.as_str(), v))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::testing::TempEnvironment;
+
+    #[test]
+    fn pins_round_trip_and_the_file_goes_away_when_empty() {
+        let env = TempEnvironment::builder().build();
+        let fs = env.fs.as_ref();
+        let paths = env.paths.as_ref();
+        assert!(!Pins::load(fs, paths).unwrap().is_pinned("git"));
+
+        let mut pins = Pins::load(fs, paths).unwrap();
+        let pin = Pin {
+            pinned_at: 1_700_000_000,
+            reason: Some("waiting on git 2.45".into()),
+        };
+        assert!(pins.pin("010-git", pin.clone()));
+        assert!(!pins.pin(
+            "010-git",
+            Pin {
+                pinned_at: 1,
+                reason: None
+            }
+        ));
+        pins.save(fs, paths).unwrap();
+
+        let mut pins = Pins::load(fs, paths).unwrap();
+        assert_eq!(pins.get("010-git"), Some(&pin));
+        assert!(pins.unpin("010-git"));
+        assert!(!pins.unpin("010-git"));
+        pins.save(fs, paths).unwrap();
+        assert!(!fs.exists(&paths.pins_path()));
+    }
+}
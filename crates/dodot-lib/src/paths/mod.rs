@@ -44,6 +44,10 @@ use std::path::{Path, PathBuf};
 
 use crate::Result;
 
+mod vars;
+
+pub use vars::{check_target, expand_target, TARGET_VARIABLES};
+
 /// Provides all path calculations for dodot.
 ///
 /// Every path that dodot uses — XDG directories, pack locations,
@@ -90,8 +94,38 @@ pub trait Pather: Send + Sync {
     /// Shell scripts directory (e.g. `~/.local/share/dodot/shell`).
     fn shell_dir(&self) -> &Path;
 
-    /// Absolute path to a pack's source directory.
+    /// Parent of every host's data dir when state is namespaced per
+    /// host (`[datastore] per_host`), e.g. `~/.local/share/dodot/hosts`.
+    /// `None` when one data dir serves every host.
+    fn hosts_dir(&self) -> Option<&Path> {
+        None
+    }
+
+    /// The other host whose data dir `path` lies in, for a shared
+    /// `$HOME` where another machine's `dodot up` left links behind.
+    /// `None` for this host's own paths and without per-host state.
+    fn linked_host(&self, path: &Path) -> Option<String> {
+        let rest = path.strip_prefix(self.hosts_dir()?).ok()?;
+        if path.starts_with(self.data_dir()) {
+            return None;
+        }
+        rest.components()
+            .next()
+            .map(|c| c.as_os_str().to_string_lossy().into_owned())
+    }
+
+    /// Whether the dotfiles root is one implicit pack
+    /// (`[pack] layout = "flat"`). See [`crate::packs::Layout`].
+    fn flat_layout(&self) -> bool {
+        false
+    }
+
+    /// Absolute path to a pack's source directory. Under the flat
+    /// layout, the implicit pack's is the dotfiles root itself.
     fn pack_path(&self, pack: &str) -> PathBuf {
+        if self.flat_layout() && pack == crate::packs::FLAT_PACK {
+            return self.dotfiles_root().to_path_buf();
+        }
         self.dotfiles_root().join(pack)
     }
 
@@ -116,6 +150,28 @@ pub trait Pather: Send + Sync {
         self.shell_dir().join("dodot-init.sh")
     }
 
+    /// fish counterpart of the init script: PATH additions only.
+    fn init_script_fish_path(&self) -> PathBuf {
+        self.shell_dir().join("dodot-init.fish")
+    }
+
+    /// nushell counterpart of the init script: PATH additions only.
+    fn init_script_nu_path(&self) -> PathBuf {
+        self.shell_dir().join("dodot-init.nu")
+    }
+
+    /// Directory of generated command shims (`[path] shims = true`),
+    /// one wrapper per executable in a deployed path directory.
+    fn shim_dir(&self) -> PathBuf {
+        self.data_dir().join("bin")
+    }
+
+    /// Where `--force` moves the user files it replaces, one directory
+    /// per item. See [`crate::trash`].
+    fn trash_dir(&self) -> PathBuf {
+        self.data_dir().join("trash")
+    }
+
     /// Path to the deployment map TSV, overwritten on every `up` / `down`.
     /// See `docs/proposals/profiling.lex` §3.2.
     fn deployment_map_path(&self) -> PathBuf {
@@ -136,6 +192,12 @@ pub trait Pather: Send + Sync {
         self.data_dir().join("probes").join("shell-init")
     }
 
+    /// Trace files written by `dodot --profile` (Chrome trace-event
+    /// JSON, one per run).
+    fn probes_trace_dir(&self) -> PathBuf {
+        self.data_dir().join("probes").join("trace")
+    }
+
     /// On-disk cache for homebrew-cask probe data. One JSON file per
     /// cask token; TTL-based invalidation. See
     /// `docs/proposals/macos-paths.lex` §8.2.
@@ -156,6 +218,58 @@ pub trait Pather: Send + Sync {
         self.data_dir().join("prompts.json")
     }
 
+    /// Packs `dodot pin` froze on this machine. See
+    /// [`crate::packs::pins`].
+    fn pins_path(&self) -> PathBuf {
+        self.data_dir().join("pins.json")
+    }
+
+    /// The actions of recent `up` runs, for `dodot changes`. See
+    /// [`crate::commands::changes`].
+    fn run_actions_path(&self) -> PathBuf {
+        self.data_dir().join("run-actions.json")
+    }
+
+    /// Recent adoptions, for rolling back a failed or unwanted one. See
+    /// `commands::adopt::journal`.
+    fn adopt_journal_path(&self) -> PathBuf {
+        self.data_dir().join("adopt-journal.json")
+    }
+
+    /// State and records of packs `dodot disable` switched off. See
+    /// [`crate::packs::disabled`].
+    fn disabled_dir(&self) -> PathBuf {
+        self.data_dir().join("disabled")
+    }
+
+    /// Host-local template data (`data.*` in templates), merged over
+    /// every pack's `data.toml` / `data.json`. Lives in the config dir
+    /// because it is hand-edited and never part of the dotfiles repo.
+    fn host_vars_path(&self) -> PathBuf {
+        self.config_dir().join("vars.toml")
+    }
+
+    /// User pack archetypes for `dodot init --type <name>`, one
+    /// directory per type. Lives in the config dir: it is hand-made
+    /// (or shared across an organization), never part of a pack.
+    fn pack_templates_dir(&self) -> PathBuf {
+        self.config_dir().join("templates")
+    }
+
+    /// Host-local theme selection and style overrides for rendered
+    /// output (see `render::ThemeSelection`).
+    fn host_theme_path(&self) -> PathBuf {
+        self.config_dir().join("theme.toml")
+    }
+
+    /// Host-local settings describing this machine: its `roles` (see
+    /// [`crate::gates::load_roles`]) and, once moved, where its data
+    /// dir lives (`data_dir`). Never part of the dotfiles repo: the
+    /// same repo serves every machine.
+    fn local_config_path(&self) -> PathBuf {
+        self.config_dir().join("local.toml")
+    }
+
     /// Per-file baseline cache used by the preprocessing pipeline to
     /// detect divergence and drive cache-backed reverse-merge.
     ///
@@ -229,6 +343,8 @@ pub struct XdgPather {
     xdg_config_home: PathBuf,
     app_support_dir: PathBuf,
     shell_dir: PathBuf,
+    hosts_dir: Option<PathBuf>,
+    flat_layout: bool,
 }
 
 /// Builder for [`XdgPather`].
@@ -244,6 +360,8 @@ pub struct XdgPatherBuilder {
     cache_dir: Option<PathBuf>,
     xdg_config_home: Option<PathBuf>,
     app_support_dir: Option<PathBuf>,
+    host: Option<String>,
+    flat_layout: bool,
 }
 
 impl XdgPatherBuilder {
@@ -289,6 +407,21 @@ impl XdgPatherBuilder {
         self
     }
 
+    /// Namespace state under `hosts/<host>` of the data dir, for a
+    /// data dir several machines share (`[datastore] per_host`).
+    /// Characters that can't appear in a path component become `_`.
+    pub fn host(mut self, host: impl Into<String>) -> Self {
+        self.host = Some(host.into());
+        self
+    }
+
+    /// Treat the dotfiles root as the single implicit pack
+    /// (`[pack] layout = "flat"`).
+    pub fn flat_layout(mut self, flat: bool) -> Self {
+        self.flat_layout = flat;
+        self
+    }
+
     pub fn build(self) -> Result<XdgPather> {
         let home = self.home.unwrap_or_else(resolve_home);
 
@@ -302,17 +435,22 @@ impl XdgPatherBuilder {
                 .unwrap_or_else(|_| home.join(".config"))
         });
 
-        let data_dir = self.data_dir.unwrap_or_else(|| {
-            let xdg_data = std::env::var("XDG_DATA_HOME")
-                .map(PathBuf::from)
-                .unwrap_or_else(|_| home.join(".local").join("share"));
-            xdg_data.join("dodot")
-        });
-
         let config_dir = self
             .config_dir
             .unwrap_or_else(|| xdg_config_home.join("dodot"));
 
+        // A data dir moved by `dodot relocate-data` is recorded in
+        // local.toml and wins over the XDG default.
+        let data_dir = self
+            .data_dir
+            .or_else(|| configured_data_dir(&config_dir, &home))
+            .unwrap_or_else(|| {
+                let xdg_data = std::env::var("XDG_DATA_HOME")
+                    .map(PathBuf::from)
+                    .unwrap_or_else(|_| home.join(".local").join("share"));
+                xdg_data.join("dodot")
+            });
+
         let cache_dir = self.cache_dir.unwrap_or_else(|| {
             let xdg_cache = std::env::var("XDG_CACHE_HOME")
                 .map(PathBuf::from)
@@ -320,6 +458,27 @@ impl XdgPatherBuilder {
             xdg_cache.join("dodot")
         });
 
+        let (data_dir, hosts_dir) = match self.host {
+            Some(host) => {
+                let hosts = data_dir.join("hosts");
+                let component: String = host
+                    .chars()
+                    .map(|c| {
+                        if c == '/' || c == '\\' || c == '\0' {
+                            '_'
+                        } else {
+                            c
+                        }
+                    })
+                    .collect();
+                let component = match component.as_str() {
+                    "" | "." | ".." => "unknown-host".to_string(),
+                    _ => component,
+                };
+                (hosts.join(component), Some(hosts))
+            }
+            None => (data_dir, None),
+        };
         let shell_dir = data_dir.join("shell");
 
         // Application-support root: macOS routes to `~/Library/Application Support`,
@@ -342,6 +501,8 @@ impl XdgPatherBuilder {
             xdg_config_home,
             app_support_dir,
             shell_dir,
+            hosts_dir,
+            flat_layout: self.flat_layout,
         })
     }
 }
@@ -390,6 +551,14 @@ impl Pather for XdgPather {
     fn shell_dir(&self) -> &Path {
         &self.shell_dir
     }
+
+    fn hosts_dir(&self) -> Option<&Path> {
+        self.hosts_dir.as_deref()
+    }
+
+    fn flat_layout(&self) -> bool {
+        self.flat_layout
+    }
 }
 
 /// Resolve `HOME` from environment, falling back to the `dirs` approach.
@@ -431,8 +600,18 @@ fn resolve_dotfiles_root(home: &Path) -> PathBuf {
     home.join("dotfiles")
 }
 
+/// The `data_dir` set in `<config_dir>/local.toml`, with `~`
+/// expanded. A file that can't be read or parsed is ignored here;
+/// loading the machine's roles reports it.
+fn configured_data_dir(config_dir: &Path, home: &Path) -> Option<PathBuf> {
+    let text = std::fs::read_to_string(config_dir.join("local.toml")).ok()?;
+    let table: toml::Table = toml::from_str(&text).ok()?;
+    let dir = table.get("data_dir")?.as_str()?;
+    Some(expand_tilde(dir, home)).filter(|p| p.is_absolute())
+}
+
 /// Expand a leading `~` to the home directory.
-fn expand_tilde(path: &str, home: &Path) -> PathBuf {
+pub(crate) fn expand_tilde(path: &str, home: &Path) -> PathBuf {
     if let Some(rest) = path.strip_prefix("~/") {
         home.join(rest)
     } else if path == "~" {
@@ -478,6 +657,27 @@ mod tests {
         assert_eq!(pather.shell_dir(), Path::new("/h/data/dodot/shell"));
     }
 
+    #[test]
+    fn data_dir_recorded_in_local_toml_wins_over_xdg() {
+        let tmp = tempfile::tempdir().unwrap();
+        let config = tmp.path().join(".config/dodot");
+        std::fs::create_dir_all(&config).unwrap();
+        std::fs::write(
+            config.join("local.toml"),
+            "data_dir = \"~/state/dodot\"\nroles = [\"work\"]\n",
+        )
+        .unwrap();
+
+        let pather = XdgPather::builder()
+            .home(tmp.path())
+            .dotfiles_root(tmp.path().join("dotfiles"))
+            .config_dir(&config)
+            .build()
+            .unwrap();
+        assert_eq!(pather.data_dir(), tmp.path().join("state/dodot"));
+        assert_eq!(pather.shell_dir(), tmp.path().join("state/dodot/shell"));
+    }
+
     #[test]
     fn pack_path_joins_dotfiles_root() {
         let pather = XdgPather::builder()
@@ -489,6 +689,23 @@ mod tests {
         assert_eq!(pather.pack_path("vim"), PathBuf::from("/h/dotfiles/vim"));
     }
 
+    #[test]
+    fn flat_layout_pack_path_is_the_root() {
+        let pather = XdgPather::builder()
+            .home("/h")
+            .dotfiles_root("/h/dotfiles")
+            .flat_layout(true)
+            .build()
+            .unwrap();
+
+        assert!(pather.flat_layout());
+        assert_eq!(
+            pather.pack_path(crate::packs::FLAT_PACK),
+            PathBuf::from("/h/dotfiles")
+        );
+        assert_eq!(pather.pack_path("vim"), PathBuf::from("/h/dotfiles/vim"));
+    }
+
     #[test]
     fn pack_data_dir_structure() {
         let pather = XdgPather::builder()
@@ -517,6 +734,43 @@ mod tests {
         );
     }
 
+    #[test]
+    fn per_host_state_is_namespaced_and_other_hosts_are_named() {
+        let pather = XdgPather::builder()
+            .home("/h")
+            .data_dir("/h/data/dodot")
+            .host("laptop/1")
+            .build()
+            .unwrap();
+
+        assert_eq!(pather.data_dir(), Path::new("/h/data/dodot/hosts/laptop_1"));
+        assert_eq!(
+            pather.handler_data_dir("vim", "symlink"),
+            PathBuf::from("/h/data/dodot/hosts/laptop_1/packs/vim/symlink")
+        );
+        assert_eq!(
+            pather.linked_host(Path::new(
+                "/h/data/dodot/hosts/desktop/packs/vim/symlink/vimrc"
+            )),
+            Some("desktop".into())
+        );
+        assert_eq!(
+            pather.linked_host(&pather.handler_data_dir("vim", "symlink").join("vimrc")),
+            None
+        );
+
+        let shared = XdgPather::builder()
+            .home("/h")
+            .data_dir("/h/data/dodot")
+            .build()
+            .unwrap();
+        assert_eq!(shared.hosts_dir(), None);
+        assert_eq!(
+            shared.linked_host(Path::new("/h/data/dodot/hosts/desktop/x")),
+            None
+        );
+    }
+
     #[test]
     fn init_script_path() {
         let pather = XdgPather::builder()
@@ -0,0 +1,225 @@
+//! Variables in user-written targets.
+//!
+//! `[symlink.targets]` values and the `target` rule option may start
+//! from the home directory or an XDG base directory instead of
+//! spelling out an absolute path:
+//!
+//! ```toml
+//! [symlink.targets]
+//! "bashrc"  = "~/.bashrc"
+//! "foo.lua" = "$XDG_DATA_HOME/nvim/site/foo.lua"
+//! "env"     = "${WORK_DIR:-~/work}/.env"
+//! ```
+//!
+//! Only the variables in [`TARGET_VARIABLES`] can be used bare; their
+//! values come from the [`Pather`] (or the XDG defaults), never from
+//! whatever happens to be exported. Any other variable needs a
+//! default — `${VAR:-default}` — so a target never silently expands to
+//! the empty string. Config load runs [`check_target`] on every
+//! target, so a typo is an error naming the entry rather than a link
+//! in the wrong place.
+
+use std::path::{Path, PathBuf};
+
+use super::Pather;
+
+/// Variables a target may use without a default.
+pub const TARGET_VARIABLES: &[&str] = &[
+    "HOME",
+    "XDG_CONFIG_HOME",
+    "XDG_DATA_HOME",
+    "XDG_CACHE_HOME",
+    "XDG_STATE_HOME",
+];
+
+/// Check that `target` only uses supported syntax and variables,
+/// without resolving it. The error is the reason only; the caller adds
+/// which entry it was.
+pub fn check_target(target: &str) -> std::result::Result<(), String> {
+    let known = |name: &str| TARGET_VARIABLES.contains(&name).then(String::new);
+    expand(target, &known, &|_| None).map(|_| ())
+}
+
+/// Expand `~` and variables in `target`. The result is absolute when
+/// the target is, or relative to `$XDG_CONFIG_HOME` otherwise — the
+/// rule plain relative targets have always followed.
+pub fn expand_target(target: &str, paths: &dyn Pather) -> std::result::Result<PathBuf, String> {
+    let home = paths.home_dir();
+    let known = |name: &str| {
+        let dir = match name {
+            "HOME" => home.to_path_buf(),
+            "XDG_CONFIG_HOME" => paths.xdg_config_home().to_path_buf(),
+            "XDG_DATA_HOME" => xdg_base("XDG_DATA_HOME", home, ".local/share"),
+            "XDG_CACHE_HOME" => xdg_base("XDG_CACHE_HOME", home, ".cache"),
+            "XDG_STATE_HOME" => xdg_base("XDG_STATE_HOME", home, ".local/state"),
+            _ => return None,
+        };
+        Some(dir.to_string_lossy().into_owned())
+    };
+    let env = |name: &str| std::env::var(name).ok().filter(|v| !v.is_empty());
+    let expanded = expand(target, &known, &env)?;
+    if expanded.starts_with('/') {
+        Ok(PathBuf::from(expanded))
+    } else {
+        Ok(paths.xdg_config_home().join(expanded))
+    }
+}
+
+/// An XDG base directory: the variable when it holds an absolute path
+/// (the spec says to ignore relative ones), else its default under
+/// `home`.
+fn xdg_base(var: &str, home: &Path, default: &str) -> PathBuf {
+    std::env::var(var)
+        .ok()
+        .filter(|v| v.starts_with('/'))
+        .map(PathBuf::from)
+        .unwrap_or_else(|| home.join(default))
+}
+
+/// Expand `text`. `known` answers for [`TARGET_VARIABLES`], `env` for
+/// the variable of a `${VAR:-default}`.
+fn expand(
+    text: &str,
+    known: &dyn Fn(&str) -> Option<String>,
+    env: &dyn Fn(&str) -> Option<String>,
+) -> std::result::Result<String, String> {
+    let mut out = String::new();
+    let mut rest = text;
+    if rest == "~" || rest.starts_with("~/") {
+        out.push_str(&known("HOME").unwrap_or_default());
+        rest = &rest[1..];
+    } else if rest.starts_with('~') {
+        return Err("`~user` paths are not supported; use `~/` or `$HOME`".into());
+    }
+
+    while let Some(at) = rest.find('$') {
+        out.push_str(&rest[..at]);
+        rest = &rest[at + 1..];
+        if let Some(braced) = rest.strip_prefix('{') {
+            let end = closing_brace(braced).ok_or_else(|| format!("unclosed `${{` in {text:?}"))?;
+            let (name, default) = match braced[..end].split_once(":-") {
+                Some((name, default)) => (name, Some(default)),
+                None => (&braced[..end], None),
+            };
+            check_name(name)?;
+            let value = match (known(name), default) {
+                (Some(value), _) => value,
+                (None, Some(default)) => match env(name) {
+                    Some(value) => value,
+                    None => expand(default, known, env)?,
+                },
+                (None, None) => return Err(unknown(name)),
+            };
+            out.push_str(&value);
+            rest = &braced[end + 1..];
+        } else {
+            let len = rest
+                .find(|c: char| !(c.is_ascii_alphanumeric() || c == '_'))
+                .unwrap_or(rest.len());
+            let name = &rest[..len];
+            if name.is_empty() {
+                return Err(format!(
+                    "`$` must start a variable name in {text:?}; write `$HOME` or `${{VAR:-default}}`"
+                ));
+            }
+            check_name(name)?;
+            out.push_str(&known(name).ok_or_else(|| unknown(name))?);
+            rest = &rest[len..];
+        }
+    }
+    out.push_str(rest);
+    Ok(out)
+}
+
+/// Index of the `}` closing a `${`, allowing `${…}` inside a default.
+fn closing_brace(text: &str) -> Option<usize> {
+    let mut depth = 0;
+    for (i, c) in text.char_indices() {
+        match c {
+            '{' => depth += 1,
+            '}' if depth == 0 => return Some(i),
+            '}' => depth -= 1,
+            _ => {}
+        }
+    }
+    None
+}
+
+fn check_name(name: &str) -> std::result::Result<(), String> {
+    let valid = name
+        .chars()
+        .next()
+        .is_some_and(|c| c.is_ascii_alphabetic() || c == '_')
+        && name.chars().all(|c| c.is_ascii_alphanumeric() || c == '_');
+    if valid {
+        Ok(())
+    } else {
+        Err(format!("invalid variable name {name:?}"))
+    }
+}
+
+fn unknown(name: &str) -> String {
+    let known: Vec<String> = TARGET_VARIABLES.iter().map(|v| format!("${v}")).collect();
+    format!(
+        "unknown variable `${name}`; targets can use {}, or `${{{name}:-default}}` for anything else",
+        known.join(", ")
+    )
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::paths::XdgPather;
+
+    fn pather() -> XdgPather {
+        XdgPather::builder()
+            .home("/home/alice")
+            .dotfiles_root("/home/alice/dotfiles")
+            .xdg_config_home("/home/alice/.config")
+            .data_dir("/home/alice/.local/share/dodot")
+            .build()
+            .unwrap()
+    }
+
+    #[test]
+    fn home_and_xdg_variables_expand_from_the_pather() {
+        let paths = pather();
+        let expand = |t: &str| expand_target(t, &paths).unwrap();
+        assert_eq!(expand("~/.bashrc"), PathBuf::from("/home/alice/.bashrc"));
+        assert_eq!(expand("~"), PathBuf::from("/home/alice"));
+        assert_eq!(expand("$HOME/.vimrc"), PathBuf::from("/home/alice/.vimrc"));
+        assert_eq!(
+            expand("${XDG_CONFIG_HOME}/nvim"),
+            PathBuf::from("/home/alice/.config/nvim")
+        );
+        // Relative targets still resolve from $XDG_CONFIG_HOME.
+        assert_eq!(expand("app/x"), PathBuf::from("/home/alice/.config/app/x"));
+        assert_eq!(expand("/etc/hosts"), PathBuf::from("/etc/hosts"));
+    }
+
+    #[test]
+    fn other_variables_need_a_default() {
+        let paths = pather();
+        assert_eq!(
+            expand_target("${DODOT_TEST_UNSET_VAR:-~/work}/.env", &paths).unwrap(),
+            PathBuf::from("/home/alice/work/.env")
+        );
+        assert_eq!(
+            expand_target("${DODOT_TEST_UNSET_VAR:-$HOME/w}", &paths).unwrap(),
+            PathBuf::from("/home/alice/w")
+        );
+
+        let err = check_target("$WORK/.env").unwrap_err();
+        assert!(err.contains("unknown variable `$WORK`"), "{err}");
+        assert!(err.contains("${WORK:-default}"), "{err}");
+        assert!(check_target("${WORK:-/srv/work}/.env").is_ok());
+    }
+
+    #[test]
+    fn malformed_targets_are_rejected() {
+        for target in ["~bob/.vimrc", "${HOME", "$/x", "${1X:-a}", "cost$"] {
+            assert!(check_target(target).is_err(), "{target}");
+        }
+        assert!(check_target("~/.config/${XDG_STATE_HOME}").is_ok());
+    }
+}
@@ -0,0 +1,257 @@
+//! Mode and ownership of deployed targets — the `chmod` and `chown`
+//! options of a symlink `[[rules]]` entry.
+//!
+//! Some files only work with the right permissions: ssh refuses a key
+//! or `config` others can read, gpg complains about a world-readable
+//! `~/.gnupg`, and netrc readers skip a `.netrc` that isn't private.
+//! A rule pins them:
+//!
+//! ```toml
+//! [[rules]]
+//! pattern = "netrc"
+//! handler = "symlink"
+//! options = { target = "~/.netrc", chmod = "0600" }
+//! ```
+//!
+//! The executor applies the mode after every link, copy or hard link,
+//! so each `up` restores it, and `status` reports a target whose mode
+//! or owner has drifted as stale. Both follow symlinks: under the
+//! default link mode the mode set is the pack file's, which is what a
+//! program reading through the link sees. A directory gets the mode
+//! itself, not its contents.
+//!
+//! Changing the owner usually needs root. Where the process isn't
+//! permitted, `up` leaves the owner alone and says so instead of
+//! failing the deploy.
+
+use std::collections::HashMap;
+use std::path::Path;
+
+use serde::Serialize;
+
+use crate::fs::Fs;
+use crate::handlers::options::{OPTION_CHMOD, OPTION_CHOWN};
+use crate::{DodotError, Result};
+
+/// What a rule asks for. Owner names stay names until applied, so a
+/// saved plan reads the way the config was written.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct Perms {
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub mode: Option<u32>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub user: Option<String>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub group: Option<String>,
+}
+
+impl Perms {
+    /// The `chmod` / `chown` options of a rule match, or `None` when it
+    /// sets neither. Options are validated at config load.
+    pub fn from_options(options: &HashMap<String, String>) -> Option<Self> {
+        let mode = options.get(OPTION_CHMOD).and_then(|m| parse_mode(m).ok());
+        let (user, group) = options
+            .get(OPTION_CHOWN)
+            .and_then(|o| parse_owner(o).ok())
+            .unwrap_or_default();
+        if mode.is_none() && user.is_none() && group.is_none() {
+            return None;
+        }
+        Some(Self { mode, user, group })
+    }
+}
+
+/// Parse an octal mode: `"600"`, `"0600"` or `"0o600"`.
+pub fn parse_mode(s: &str) -> std::result::Result<u32, String> {
+    let digits = s.strip_prefix("0o").unwrap_or(s);
+    let octal = !digits.is_empty() && digits.bytes().all(|b| (b'0'..=b'7').contains(&b));
+    match u32::from_str_radix(digits, 8) {
+        Ok(mode) if octal && mode <= 0o7777 => Ok(mode),
+        _ => Err(format!("expected an octal mode like \"0600\", got {s:?}")),
+    }
+}
+
+/// Parse `user`, `user:group` or `:group`; each a name or numeric id.
+pub fn parse_owner(s: &str) -> std::result::Result<(Option<String>, Option<String>), String> {
+    let invalid = || format!("expected `user`, `user:group` or `:group`, got {s:?}");
+    let (user, group) = match s.split_once(':') {
+        Some((_, "")) => return Err(invalid()),
+        Some((user, group)) => (user, Some(group.to_string())),
+        None => (s, None),
+    };
+    let user = (!user.is_empty()).then(|| user.to_string());
+    if user.is_none() && group.is_none() {
+        return Err(invalid());
+    }
+    Ok((user, group))
+}
+
+/// Apply `perms` to `path`. The mode always; the owner where
+/// permitted — a refused `chown` comes back as a note for the
+/// operation's message rather than an error.
+pub fn apply(fs: &dyn Fs, path: &Path, perms: &Perms) -> Result<Option<String>> {
+    if let Some(mode) = perms.mode {
+        fs.set_permissions(path, mode)?;
+    }
+    if perms.user.is_none() && perms.group.is_none() {
+        return Ok(None);
+    }
+    let (uid, gid) = resolve(fs, perms)?;
+    let meta = fs.stat(path)?;
+    if uid.map_or(true, |u| u == meta.uid) && gid.map_or(true, |g| g == meta.gid) {
+        return Ok(None);
+    }
+    match fs.chown(path, uid, gid) {
+        Ok(()) => Ok(None),
+        Err(DodotError::Fs { source, .. })
+            if source.kind() == std::io::ErrorKind::PermissionDenied =>
+        {
+            Ok(Some("owner left unchanged: not permitted".into()))
+        }
+        Err(e) => Err(e),
+    }
+}
+
+/// How `path` differs from `perms`, or `None` when it matches (or
+/// can't be read — a missing target is reported on its own).
+pub fn drift(fs: &dyn Fs, path: &Path, perms: &Perms) -> Option<String> {
+    let meta = fs.stat(path).ok()?;
+    let mut diffs = Vec::new();
+    if let Some(mode) = perms.mode {
+        let actual = meta.mode & 0o7777;
+        if actual != mode {
+            diffs.push(format!("mode {actual:04o}, want {mode:04o}"));
+        }
+    }
+    if perms.user.is_some() || perms.group.is_some() {
+        match resolve(fs, perms) {
+            Ok((uid, gid)) => {
+                if let (Some(uid), Some(user)) = (uid, &perms.user) {
+                    if uid != meta.uid {
+                        diffs.push(format!("owner {}, want {user}", meta.uid));
+                    }
+                }
+                if let (Some(gid), Some(group)) = (gid, &perms.group) {
+                    if gid != meta.gid {
+                        diffs.push(format!("group {}, want {group}", meta.gid));
+                    }
+                }
+            }
+            Err(e) => diffs.push(e.to_string()),
+        }
+    }
+    (!diffs.is_empty()).then(|| diffs.join(", "))
+}
+
+/// Numeric ids for the user and group `perms` names.
+fn resolve(fs: &dyn Fs, perms: &Perms) -> Result<(Option<u32>, Option<u32>)> {
+    let uid = perms
+        .user
+        .as_deref()
+        .map(|name| lookup_id(fs, "/etc/passwd", "user", name))
+        .transpose()?;
+    let gid = perms
+        .group
+        .as_deref()
+        .map(|name| lookup_id(fs, "/etc/group", "group", name))
+        .transpose()?;
+    Ok((uid, gid))
+}
+
+/// A numeric id as is, or a name looked up in `db` (`name:x:id:…`).
+/// Accounts only a directory service knows (most macOS users) need
+/// the numeric id.
+fn lookup_id(fs: &dyn Fs, db: &str, what: &str, name: &str) -> Result<u32> {
+    if let Ok(id) = name.parse() {
+        return Ok(id);
+    }
+    let text = fs.read_to_string(Path::new(db)).unwrap_or_default();
+    text.lines()
+        .filter(|line| !line.starts_with('#'))
+        .find_map(|line| {
+            let mut fields = line.split(':');
+            if fields.next()? != name {
+                return None;
+            }
+            fields.nth(1)?.parse().ok()
+        })
+        .ok_or_else(|| {
+            DodotError::Other(format!(
+                "unknown {what} `{name}` (not in {db}); use a numeric id"
+            ))
+        })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::testing::TempEnvironment;
+
+    #[test]
+    fn modes_and_owners_parse() {
+        assert_eq!(parse_mode("600"), Ok(0o600));
+        assert_eq!(parse_mode("0600"), Ok(0o600));
+        assert_eq!(parse_mode("0o4755"), Ok(0o4755));
+        assert!(parse_mode("rw").is_err());
+        assert!(parse_mode("0800").is_err());
+        assert!(parse_mode("17777").is_err());
+
+        assert_eq!(parse_owner("me"), Ok((Some("me".into()), None)));
+        assert_eq!(
+            parse_owner("0:wheel"),
+            Ok((Some("0".into()), Some("wheel".into())))
+        );
+        assert_eq!(parse_owner(":staff"), Ok((None, Some("staff".into()))));
+        assert!(parse_owner("").is_err());
+        assert!(parse_owner("me:").is_err());
+    }
+
+    #[test]
+    fn apply_sets_the_mode_and_drift_notices_changes() {
+        let env = TempEnvironment::builder()
+            .pack("net")
+            .file("netrc", "machine example.com")
+            .done()
+            .build();
+        let fs = env.fs.as_ref();
+        let file = env.dotfiles_root.join("net/netrc");
+        let options = HashMap::from([(OPTION_CHMOD.to_string(), "0600".to_string())]);
+        let perms = Perms::from_options(&options).unwrap();
+
+        assert_eq!(apply(fs, &file, &perms).unwrap(), None);
+        assert_eq!(fs.stat(&file).unwrap().mode & 0o777, 0o600);
+        assert_eq!(drift(fs, &file, &perms), None);
+
+        fs.set_permissions(&file, 0o644).unwrap();
+        assert_eq!(
+            drift(fs, &file, &perms).as_deref(),
+            Some("mode 0644, want 0600")
+        );
+    }
+
+    #[test]
+    fn owner_already_in_place_needs_no_privilege() {
+        let env = TempEnvironment::builder()
+            .pack("net")
+            .file("netrc", "x")
+            .done()
+            .build();
+        let fs = env.fs.as_ref();
+        let file = env.dotfiles_root.join("net/netrc");
+        let meta = fs.stat(&file).unwrap();
+        let perms = Perms {
+            mode: None,
+            user: Some(meta.uid.to_string()),
+            group: Some(meta.gid.to_string()),
+        };
+        assert_eq!(apply(fs, &file, &perms).unwrap(), None);
+        assert_eq!(drift(fs, &file, &perms), None);
+
+        let perms = Perms {
+            group: Some("no-such-group-here".into()),
+            ..perms
+        };
+        let err = drift(fs, &file, &perms).unwrap();
+        assert!(err.contains("unknown group `no-such-group-here`"), "{err}");
+    }
+}
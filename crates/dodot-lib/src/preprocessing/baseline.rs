@@ -13,8 +13,9 @@
 //! # Lifecycle
 //!
 //! - **Write**: `preprocess_pack` calls [`Baseline::write`] after every
-//!   successful expansion. Re-running `dodot up` overwrites the file in
-//!   place.
+//!   successful expansion whose output changed. Re-running `dodot up`
+//!   with the same source, context and output leaves the record (and
+//!   the rendered file) untouched; `--force` rewrites both.
 //! - **Read**: `dodot transform check` and the clean filter call
 //!   [`Baseline::load`] to drive divergence detection.
 //! - **Cleanup**: `dodot down` deletes the per-pack subdirectory; the
@@ -303,7 +304,7 @@ pub(crate) fn hex_sha256(bytes: &[u8]) -> String {
     hex_encode_32(&hasher.finalize().into())
 }
 
-fn hex_encode_32(bytes: &[u8; 32]) -> String {
+pub(crate) fn hex_encode_32(bytes: &[u8; 32]) -> String {
     let mut out = String::with_capacity(64);
     for b in bytes {
         out.push(hex_nibble(b >> 4));
@@ -0,0 +1,500 @@
+//! Filter preprocessor — deploy-time transformations chained per glob.
+//!
+//! `[preprocessor.filters]` maps a filename glob to an ordered list of
+//! filters. A matching file is read, passed through each filter in
+//! turn, and the result is written to the datastore and deployed from
+//! there — the same route a rendered template takes:
+//!
+//! ```toml
+//! [preprocessor.filters]
+//! "*.conf"     = ["strip-comments", "line-endings:lf"]
+//! "ssh_config" = ["envsubst", "chmod:600"]
+//! ```
+//!
+//! A filter spec is `name` or `name:arg`. Filters are looked up in a
+//! [`FilterRegistry`]; the built-ins are:
+//!
+//! - `strip-comments[:<marker>]` — drop lines whose first non-blank
+//!   text is `marker` (default `#`). A leading `#!` line is kept.
+//! - `envsubst` — replace `$VAR` / `${VAR}` with the environment value
+//!   (empty when unset), like gettext's `envsubst`.
+//! - `line-endings:lf|crlf` — normalise line endings (default `lf`).
+//! - `chmod:<octal>` — deploy with this mode instead of the source's.
+//!
+//! Each filter takes the previous one's output, so a chain composes
+//! like middleware. Filters only apply to files no other preprocessor
+//! claims: the filter preprocessor is registered last, so a
+//! `config.tmpl` still renders through the template engine.
+
+use std::collections::HashMap;
+use std::path::{Path, PathBuf};
+
+use crate::fs::Fs;
+use crate::preprocessing::{ExpandedFile, Preprocessor, TransformType};
+use crate::{DodotError, Result};
+
+/// Content on its way through a filter chain, plus the deploy mode
+/// any filter has set so far.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Filtered {
+    pub content: Vec<u8>,
+    pub mode: Option<u32>,
+}
+
+/// One transformation step.
+pub trait Filter: Send + Sync {
+    /// The spec name this filter was built from (e.g. `"envsubst"`).
+    fn name(&self) -> &str;
+
+    /// Transform `input`, returning the next stage's input.
+    fn apply(&self, input: Filtered) -> Result<Filtered>;
+}
+
+/// Builds a filter from the optional `:arg` part of its spec.
+pub type FilterFactory = fn(Option<&str>) -> Result<Box<dyn Filter>>;
+
+/// Named filter constructors, consulted when a `[preprocessor.filters]`
+/// spec is parsed.
+pub struct FilterRegistry {
+    factories: HashMap<String, FilterFactory>,
+}
+
+impl FilterRegistry {
+    /// An empty registry.
+    pub fn new() -> Self {
+        Self {
+            factories: HashMap::new(),
+        }
+    }
+
+    /// The built-in filters: `strip-comments`, `envsubst`,
+    /// `line-endings`, `chmod`.
+    pub fn with_builtins() -> Self {
+        let mut registry = Self::new();
+        registry.register("strip-comments", StripComments::build);
+        registry.register("envsubst", Envsubst::build);
+        registry.register("line-endings", LineEndings::build);
+        registry.register("chmod", Chmod::build);
+        registry
+    }
+
+    /// Register (or replace) a filter under `name`.
+    pub fn register(&mut self, name: &str, factory: FilterFactory) {
+        self.factories.insert(name.to_string(), factory);
+    }
+
+    /// Build one filter from a `name` / `name:arg` spec.
+    pub fn build(&self, spec: &str) -> Result<Box<dyn Filter>> {
+        let (name, arg) = match spec.split_once(':') {
+            Some((name, arg)) => (name, Some(arg)),
+            None => (spec, None),
+        };
+        let factory = self.factories.get(name).ok_or_else(|| {
+            let mut known: Vec<&str> = self.factories.keys().map(String::as_str).collect();
+            known.sort();
+            DodotError::Config(format!(
+                "unknown filter `{name}` in [preprocessor.filters]: known filters are {}",
+                known.join(", ")
+            ))
+        })?;
+        factory(arg)
+    }
+
+    /// Build a chain from an ordered list of specs.
+    pub fn chain(&self, specs: &[String]) -> Result<FilterChain> {
+        let filters = specs
+            .iter()
+            .map(|spec| self.build(spec))
+            .collect::<Result<_>>()?;
+        Ok(FilterChain { filters })
+    }
+}
+
+impl Default for FilterRegistry {
+    fn default() -> Self {
+        Self::with_builtins()
+    }
+}
+
+/// Filters applied in order, each to the previous one's output.
+pub struct FilterChain {
+    filters: Vec<Box<dyn Filter>>,
+}
+
+impl FilterChain {
+    pub fn apply(&self, input: Filtered) -> Result<Filtered> {
+        self.filters.iter().try_fold(input, |acc, f| f.apply(acc))
+    }
+
+    /// Filter names in application order.
+    pub fn names(&self) -> Vec<&str> {
+        self.filters.iter().map(|f| f.name()).collect()
+    }
+}
+
+/// The preprocessor that runs `[preprocessor.filters]` chains.
+pub struct FilterPreprocessor {
+    /// Sorted by pattern text; the first matching glob wins.
+    rules: Vec<(glob::Pattern, FilterChain)>,
+}
+
+impl FilterPreprocessor {
+    /// Compile `filters` (glob → specs) against `registry`. Invalid
+    /// globs and unknown filters are config errors.
+    pub fn from_config(
+        filters: &HashMap<String, Vec<String>>,
+        registry: &FilterRegistry,
+    ) -> Result<Self> {
+        let mut patterns: Vec<&String> = filters.keys().collect();
+        patterns.sort();
+        let mut rules = Vec::with_capacity(patterns.len());
+        for pattern in patterns {
+            let glob = glob::Pattern::new(pattern).map_err(|e| {
+                DodotError::Config(format!(
+                    "invalid glob {pattern:?} in [preprocessor.filters]: {e}"
+                ))
+            })?;
+            rules.push((glob, registry.chain(&filters[pattern])?));
+        }
+        Ok(Self { rules })
+    }
+
+    fn chain_for(&self, filename: &str) -> Option<&FilterChain> {
+        self.rules
+            .iter()
+            .find(|(glob, _)| glob.matches(filename))
+            .map(|(_, chain)| chain)
+    }
+}
+
+impl Preprocessor for FilterPreprocessor {
+    fn name(&self) -> &str {
+        "filter"
+    }
+
+    fn transform_type(&self) -> TransformType {
+        TransformType::Generative
+    }
+
+    fn matches_extension(&self, filename: &str) -> bool {
+        self.chain_for(filename).is_some()
+    }
+
+    fn stripped_name(&self, filename: &str) -> String {
+        filename.to_string()
+    }
+
+    fn expand(&self, source: &Path, fs: &dyn Fs) -> Result<Vec<ExpandedFile>> {
+        let filename = source
+            .file_name()
+            .unwrap_or_default()
+            .to_string_lossy()
+            .to_string();
+        let chain = self.chain_for(&filename).ok_or_else(|| {
+            DodotError::Other(format!("no filter chain matches {}", source.display()))
+        })?;
+        let source_mode = fs.stat(source)?.mode & 0o777;
+        let out = chain.apply(Filtered {
+            content: fs.read_file(source)?,
+            mode: None,
+        })?;
+
+        // Always carry a mode: the source's (so a filtered script keeps
+        // its exec bit) unless `chmod` set one. A set mode also opts
+        // the output into the divergence guard and baseline cache, so
+        // `status` can show filtered files without re-running filters.
+        Ok(vec![ExpandedFile {
+            relative_path: PathBuf::from(filename),
+            content: out.content,
+            deploy_mode: Some(out.mode.unwrap_or(source_mode)),
+            ..Default::default()
+        }])
+    }
+}
+
+fn utf8(content: Vec<u8>, filter: &str) -> Result<String> {
+    String::from_utf8(content)
+        .map_err(|_| DodotError::Other(format!("filter `{filter}` needs UTF-8 text input")))
+}
+
+fn no_arg(name: &str, arg: Option<&str>) -> Result<()> {
+    match arg {
+        None => Ok(()),
+        Some(arg) => Err(DodotError::Config(format!(
+            "filter `{name}` takes no argument (got `{name}:{arg}`)"
+        ))),
+    }
+}
+
+// ── Built-in filters ────────────────────────────────────────────
+
+struct StripComments {
+    marker: String,
+}
+
+impl StripComments {
+    fn build(arg: Option<&str>) -> Result<Box<dyn Filter>> {
+        let marker = arg.unwrap_or("#");
+        if marker.is_empty() {
+            return Err(DodotError::Config(
+                "filter `strip-comments:` needs a non-empty comment marker".into(),
+            ));
+        }
+        Ok(Box::new(Self {
+            marker: marker.to_string(),
+        }))
+    }
+}
+
+impl Filter for StripComments {
+    fn name(&self) -> &str {
+        "strip-comments"
+    }
+
+    fn apply(&self, input: Filtered) -> Result<Filtered> {
+        let text = utf8(input.content, self.name())?;
+        let mut out = String::with_capacity(text.len());
+        for (i, line) in text.split_inclusive('\n').enumerate() {
+            let is_shebang = i == 0 && line.starts_with("#!");
+            if !is_shebang && line.trim_start().starts_with(&self.marker) {
+                continue;
+            }
+            out.push_str(line);
+        }
+        Ok(Filtered {
+            content: out.into_bytes(),
+            mode: input.mode,
+        })
+    }
+}
+
+struct Envsubst {
+    lookup: fn(&str) -> Option<String>,
+}
+
+impl Envsubst {
+    fn build(arg: Option<&str>) -> Result<Box<dyn Filter>> {
+        no_arg("envsubst", arg)?;
+        Ok(Box::new(Self {
+            lookup: |name| std::env::var(name).ok(),
+        }))
+    }
+
+    fn substitute(&self, text: &str) -> String {
+        let mut out = String::with_capacity(text.len());
+        let mut rest = text;
+        while let Some(pos) = rest.find('$') {
+            out.push_str(&rest[..pos]);
+            let after = &rest[pos + 1..];
+            let (name, consumed) = if let Some(braced) = after.strip_prefix('{') {
+                match braced.find('}') {
+                    Some(end) if is_var_name(&braced[..end]) => (&braced[..end], end + 2),
+                    _ => ("", 0),
+                }
+            } else {
+                let end = after
+                    .find(|c: char| !(c.is_ascii_alphanumeric() || c == '_'))
+                    .unwrap_or(after.len());
+                if is_var_name(&after[..end]) {
+                    (&after[..end], end)
+                } else {
+                    ("", 0)
+                }
+            };
+            if consumed == 0 {
+                out.push('$');
+                rest = after;
+            } else {
+                out.push_str(&(self.lookup)(name).unwrap_or_default());
+                rest = &after[consumed..];
+            }
+        }
+        out.push_str(rest);
+        out
+    }
+}
+
+fn is_var_name(s: &str) -> bool {
+    s.chars()
+        .next()
+        .is_some_and(|c| c.is_ascii_alphabetic() || c == '_')
+        && s.chars().all(|c| c.is_ascii_alphanumeric() || c == '_')
+}
+
+impl Filter for Envsubst {
+    fn name(&self) -> &str {
+        "envsubst"
+    }
+
+    fn apply(&self, input: Filtered) -> Result<Filtered> {
+        let text = utf8(input.content, self.name())?;
+        Ok(Filtered {
+            content: self.substitute(&text).into_bytes(),
+            mode: input.mode,
+        })
+    }
+}
+
+struct LineEndings {
+    crlf: bool,
+}
+
+impl LineEndings {
+    fn build(arg: Option<&str>) -> Result<Box<dyn Filter>> {
+        let crlf = match arg.unwrap_or("lf") {
+            "lf" => false,
+            "crlf" => true,
+            other => {
+                return Err(DodotError::Config(format!(
+                    "filter `line-endings:{other}`: expected `lf` or `crlf`"
+                )))
+            }
+        };
+        Ok(Box::new(Self { crlf }))
+    }
+}
+
+impl Filter for LineEndings {
+    fn name(&self) -> &str {
+        "line-endings"
+    }
+
+    fn apply(&self, input: Filtered) -> Result<Filtered> {
+        let mut lf = Vec::with_capacity(input.content.len());
+        let mut bytes = input.content.iter().peekable();
+        while let Some(&b) = bytes.next() {
+            if b == b'\r' && bytes.peek() == Some(&&b'\n') {
+                continue;
+            }
+            lf.push(b);
+        }
+        let content = if self.crlf {
+            let mut crlf = Vec::with_capacity(lf.len());
+            for b in lf {
+                if b == b'\n' {
+                    crlf.push(b'\r');
+                }
+                crlf.push(b);
+            }
+            crlf
+        } else {
+            lf
+        };
+        Ok(Filtered {
+            content,
+            mode: input.mode,
+        })
+    }
+}
+
+struct Chmod {
+    mode: u32,
+}
+
+impl Chmod {
+    fn build(arg: Option<&str>) -> Result<Box<dyn Filter>> {
+        let mode = arg
+            .and_then(|a| u32::from_str_radix(a, 8).ok())
+            .filter(|m| *m <= 0o777)
+            .ok_or_else(|| {
+                DodotError::Config(format!(
+                    "filter `chmod` needs an octal mode like `chmod:600` (got {arg:?})"
+                ))
+            })?;
+        Ok(Box::new(Self { mode }))
+    }
+}
+
+impl Filter for Chmod {
+    fn name(&self) -> &str {
+        "chmod"
+    }
+
+    fn apply(&self, input: Filtered) -> Result<Filtered> {
+        Ok(Filtered {
+            content: input.content,
+            mode: Some(self.mode),
+        })
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn run(specs: &[&str], content: &str) -> Filtered {
+        let specs: Vec<String> = specs.iter().map(|s| s.to_string()).collect();
+        FilterRegistry::with_builtins()
+            .chain(&specs)
+            .unwrap()
+            .apply(Filtered {
+                content: content.as_bytes().to_vec(),
+                mode: None,
+            })
+            .unwrap()
+    }
+
+    #[test]
+    fn chain_applies_filters_in_order() {
+        let out = run(
+            &["strip-comments", "line-endings:crlf", "chmod:600"],
+            "#!/bin/sh\n# note\nexport A=1\r\n  # indented\nB=2\n",
+        );
+        assert_eq!(
+            String::from_utf8(out.content).unwrap(),
+            "#!/bin/sh\r\nexport A=1\r\nB=2\r\n"
+        );
+        assert_eq!(out.mode, Some(0o600));
+    }
+
+    #[test]
+    fn envsubst_replaces_set_and_unset_variables() {
+        let filter = Envsubst {
+            lookup: |name| (name == "USER").then(|| "ada".to_string()),
+        };
+        assert_eq!(
+            filter.substitute("user=$USER home=${HOME_X}/x cost=$5 ${USER}s $"),
+            "user=ada home=/x cost=$5 adas $"
+        );
+    }
+
+    #[test]
+    fn bad_specs_are_config_errors() {
+        let registry = FilterRegistry::with_builtins();
+        for spec in [
+            "minify",
+            "chmod:rw",
+            "chmod",
+            "line-endings:cr",
+            "envsubst:x",
+        ] {
+            let err = registry.build(spec).err().unwrap().to_string();
+            assert!(err.contains("config error"), "{spec}: {err}");
+        }
+    }
+
+    #[test]
+    fn preprocessor_claims_matching_files_and_keeps_source_mode() {
+        use crate::testing::TempEnvironment;
+
+        let env = TempEnvironment::builder()
+            .pack("shell")
+            .file_with_mode("prompt.conf", "# comment\nPS1=x\n", 0o640)
+            .done()
+            .build();
+        let source = env.dotfiles_root.join("shell/prompt.conf");
+
+        let mut filters = HashMap::new();
+        filters.insert("*.conf".to_string(), vec!["strip-comments".to_string()]);
+        let pp =
+            FilterPreprocessor::from_config(&filters, &FilterRegistry::with_builtins()).unwrap();
+        assert!(pp.matches_extension("prompt.conf"));
+        assert!(!pp.matches_extension("prompt.sh"));
+
+        let out = pp.expand(&source, env.fs.as_ref()).unwrap();
+        assert_eq!(out.len(), 1);
+        assert_eq!(out[0].relative_path, PathBuf::from("prompt.conf"));
+        assert_eq!(out[0].content, b"PS1=x\n");
+        assert_eq!(out[0].deploy_mode, Some(0o640));
+    }
+}
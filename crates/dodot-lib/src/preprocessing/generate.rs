@@ -0,0 +1,225 @@
+//! Templates that generate into the pack (`[preprocessor.template]
+//! generate`).
+//!
+//! A template normally renders into the datastore and deploys from
+//! there. A template whose filename matches a `generate` glob renders
+//! into the pack instead — `aliases.sh.tmpl` writes `<pack>/aliases.sh`
+//! — and the output joins the pack's entries as an ordinary file, ahead
+//! of the regular preprocessing pass. Rules then match it like anything
+//! hand-written: a generated `aliases.sh` is sourced by the shell
+//! handler, a generated `bin/` script goes on PATH, and an output whose
+//! own name is a preprocessor's (`hosts.tmpl.tmpl` renders `hosts.tmpl`)
+//! is rendered again by the pass that follows. Two phases, not a loop:
+//! the second pass never generates.
+//!
+//! The output is a real file in the dotfiles repo, so it usually
+//! belongs in `.gitignore`. dodot records the hash of what it last
+//! wrote and refuses to overwrite a file that differs from it — a
+//! hand-written file, or an edit made in place — unless `--force`.
+//!
+//! Passive commands (`status`, `up --dry-run`) don't render: the
+//! generator drops out and they see whatever output the last `dodot
+//! up` left in the pack.
+
+use std::path::Path;
+
+use tracing::{debug, info};
+
+use crate::fs::Fs;
+use crate::packs::Pack;
+use crate::paths::Pather;
+use crate::preprocessing::baseline::hex_sha256;
+use crate::preprocessing::pipeline::{normalize_relative, validate_safe_relative_path};
+use crate::preprocessing::{PreprocessMode, PreprocessorRegistry};
+use crate::rules::PackEntry;
+use crate::{DodotError, Result};
+
+/// Cache namespace holding the hash of each generated file.
+const GENERATED: &str = "generated";
+
+/// Whether `filename` matches one of the `generate` globs.
+pub fn is_generator(filename: &str, patterns: &[String]) -> bool {
+    patterns.iter().any(|p| {
+        glob::Pattern::new(p)
+            .map(|g| g.matches(filename))
+            .unwrap_or(false)
+    })
+}
+
+/// Render the pack's generator templates into the pack and return the
+/// entries with each generator replaced by its output. Entries that
+/// aren't generators pass through untouched.
+#[allow(clippy::too_many_arguments)]
+pub fn generate_into_pack(
+    entries: Vec<PackEntry>,
+    registry: &PreprocessorRegistry,
+    patterns: &[String],
+    pack: &Pack,
+    fs: &dyn Fs,
+    paths: &dyn Pather,
+    mode: PreprocessMode,
+    force: bool,
+) -> Result<Vec<PackEntry>> {
+    if patterns.is_empty() {
+        return Ok(entries);
+    }
+    let (generators, mut rest): (Vec<PackEntry>, Vec<PackEntry>) =
+        entries.into_iter().partition(|e| {
+            let filename = file_name(&e.relative_path);
+            !e.is_dir
+                && e.gate_failure.is_none()
+                && is_generator(&filename, patterns)
+                && registry
+                    .find_for_file(&filename)
+                    .is_some_and(|p| p.name() == "template")
+        });
+    if generators.is_empty() || mode == PreprocessMode::Passive {
+        return Ok(rest);
+    }
+
+    for entry in generators {
+        let filename = file_name(&entry.relative_path);
+        let template = registry
+            .find_for_file(&filename)
+            .expect("generators were partitioned on find_for_file");
+        info!(pack = %pack.name, file = %filename, "generating into pack");
+        for expanded in template.expand(&entry.absolute_path, fs)? {
+            if expanded.is_dir {
+                continue;
+            }
+            let relative = match entry.relative_path.parent() {
+                Some(parent) => parent.join(&expanded.relative_path),
+                None => expanded.relative_path.clone(),
+            };
+            validate_safe_relative_path(&relative, template.name(), &entry.absolute_path)?;
+            let relative = normalize_relative(&relative);
+            let output = pack.path.join(&relative);
+            write_output(
+                pack,
+                &relative,
+                &output,
+                &expanded.content,
+                fs,
+                paths,
+                force,
+            )
+            .map_err(|message| DodotError::PreprocessorError {
+                preprocessor: template.name().into(),
+                source_file: entry.absolute_path.clone(),
+                message,
+            })?;
+
+            // The walk saw last run's output; this one replaces it.
+            rest.retain(|e| e.relative_path != relative);
+            rest.push(PackEntry {
+                relative_path: relative,
+                absolute_path: output,
+                is_dir: false,
+                gate_failure: None,
+            });
+        }
+    }
+    rest.sort_by(|a, b| a.relative_path.cmp(&b.relative_path));
+    Ok(rest)
+}
+
+/// Write `content` to `output` unless it already holds it, refusing to
+/// replace a file dodot didn't write there.
+fn write_output(
+    pack: &Pack,
+    relative: &Path,
+    output: &Path,
+    content: &[u8],
+    fs: &dyn Fs,
+    paths: &dyn Pather,
+    force: bool,
+) -> std::result::Result<(), String> {
+    let mut record = paths
+        .preprocessor_baseline_dir(&pack.name, GENERATED)
+        .join(relative)
+        .into_os_string();
+    record.push(".sha256");
+    let record = std::path::PathBuf::from(record);
+    let hash = hex_sha256(content);
+    if fs.exists(output) {
+        let current = fs.read_file(output).map_err(|e| e.to_string())?;
+        let current_hash = hex_sha256(&current);
+        if current_hash == hash {
+            debug!(pack = %pack.name, file = %relative.display(), "generated file unchanged");
+            return Ok(());
+        }
+        let recorded = fs.read_to_string(&record).ok();
+        if !force && recorded.as_deref().map(str::trim) != Some(current_hash.as_str()) {
+            return Err(format!(
+                "{} exists and is not the file dodot last generated there; move it aside, \
+                 or run `dodot up --force` to overwrite it",
+                relative.display()
+            ));
+        }
+    }
+    let write = || -> Result<()> {
+        if let Some(parent) = output.parent() {
+            fs.mkdir_all(parent)?;
+        }
+        fs.write_file(output, content)?;
+        if let Some(parent) = record.parent() {
+            fs.mkdir_all(parent)?;
+        }
+        fs.write_file(&record, hash.as_bytes())
+    };
+    write().map_err(|e| e.to_string())
+}
+
+fn file_name(path: &Path) -> String {
+    path.file_name()
+        .map(|n| n.to_string_lossy().into_owned())
+        .unwrap_or_default()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::testing::TempEnvironment;
+
+    fn pack(env: &TempEnvironment, name: &str) -> Pack {
+        Pack::new(
+            name.into(),
+            env.dotfiles_root.join(name),
+            crate::handlers::HandlerConfig::default(),
+        )
+    }
+
+    #[test]
+    fn generator_globs_match_the_filename() {
+        let patterns = vec!["*.gen.tmpl".to_string(), "aliases.sh.tmpl".to_string()];
+        assert!(is_generator("prompt.gen.tmpl", &patterns));
+        assert!(is_generator("aliases.sh.tmpl", &patterns));
+        assert!(!is_generator("gitconfig.tmpl", &patterns));
+        assert!(!is_generator("aliases.sh.tmpl", &[]));
+    }
+
+    #[test]
+    fn output_is_only_replaced_when_dodot_wrote_it() {
+        let env = TempEnvironment::builder()
+            .pack("sh")
+            .file("aliases.sh", "alias mine=1")
+            .done()
+            .build();
+        let pack = pack(&env, "sh");
+        let output = env.dotfiles_root.join("sh/aliases.sh");
+        let relative = Path::new("aliases.sh");
+        let fs = env.fs.as_ref();
+        let paths = env.paths.as_ref();
+
+        // A hand-written file is left alone…
+        let err =
+            write_output(&pack, relative, &output, b"alias a=1", fs, paths, false).unwrap_err();
+        assert!(err.contains("not the file dodot last generated"), "{err}");
+        assert_eq!(fs.read_to_string(&output).unwrap(), "alias mine=1");
+
+        // …unless forced; from then on dodot owns it.
+        write_output(&pack, relative, &output, b"alias a=1", fs, paths, true).unwrap();
+        write_output(&pack, relative, &output, b"alias a=2", fs, paths, false).unwrap();
+        assert_eq!(fs.read_to_string(&output).unwrap(), "alias a=2");
+    }
+}
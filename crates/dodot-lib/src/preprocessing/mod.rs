@@ -12,6 +12,8 @@ pub mod age;
 pub mod baseline;
 pub mod conflict;
 pub mod divergence;
+pub mod filter;
+pub mod generate;
 pub mod gpg;
 pub mod identity;
 pub mod no_reverse;
@@ -185,6 +187,19 @@ pub trait Preprocessor: Send + Sync {
     fn supports_reverse_merge(&self) -> bool {
         false
     }
+
+    /// The [`context_hash`](ExpandedFile::context_hash) the next
+    /// `expand` would carry, known without expanding.
+    ///
+    /// Default `None`. A preprocessor that emits exactly one file, named
+    /// by [`stripped_name`](Self::stripped_name) and determined by the
+    /// source bytes and this hash alone, returns `Some`; the pipeline
+    /// then skips `expand` — and the secret lookups it would make —
+    /// when both match the last render's baseline and the rendered file
+    /// is intact.
+    fn render_fingerprint(&self) -> Option<[u8; 32]> {
+        None
+    }
 }
 
 /// Registry of available preprocessors.
@@ -243,6 +258,8 @@ impl Default for PreprocessorRegistry {
 /// Contains all user-facing preprocessors:
 /// - [`unarchive::UnarchivePreprocessor`] for `.tar.gz` extraction
 /// - [`template::TemplatePreprocessor`] for Jinja2-style templates
+/// - [`filter::FilterPreprocessor`] when `[preprocessor.filters]` has
+///   entries
 ///
 /// The [`identity`] preprocessor is test-only and is intentionally *not*
 /// registered here (it would match innocuous-looking `.identity` files in
@@ -257,10 +274,14 @@ impl Default for PreprocessorRegistry {
 /// secrets are disabled, the template preprocessor is built without a
 /// registry and `secret(...)` calls in templates surface a config-
 /// pointing render error.
+///
+/// `template_data` becomes the templates' `data.*` namespace — the
+/// pack's merged data files, from [`template::load_template_data`].
 pub fn default_registry(
     preprocessor_config: &crate::config::PreprocessorSection,
     secret_config: &crate::config::SecretSection,
     pather: &dyn crate::paths::Pather,
+    template_data: serde_json::Value,
     command_runner: std::sync::Arc<dyn crate::datastore::CommandRunner>,
 ) -> Result<(
     PreprocessorRegistry,
@@ -276,7 +297,8 @@ pub fn default_registry(
         template_config.extensions.clone(),
         template_config.vars.clone(),
         pather,
-    )?;
+    )?
+    .with_data(template_data);
 
     let secret_registry = if secret_config.enabled {
         build_secret_registry(
@@ -320,6 +342,16 @@ pub fn default_registry(
         )));
     }
 
+    // Filters go last: registration order is match order, so a file
+    // another preprocessor claims (a template, an archive) keeps that
+    // preprocessor and only plain files are filtered.
+    if !preprocessor_config.filters.is_empty() {
+        registry.register(Box::new(filter::FilterPreprocessor::from_config(
+            &preprocessor_config.filters,
+            &filter::FilterRegistry::with_builtins(),
+        )?));
+    }
+
     Ok((registry, secret_registry))
 }
 
@@ -408,6 +440,15 @@ pub fn build_secret_registry(
         any_enabled = true;
     }
 
+    if config.providers.vault.enabled {
+        // HashiCorp Vault. Address / agent / namespace knobs become
+        // CLI flags; auth is whatever the vault binary already has.
+        let provider =
+            crate::secret::VaultProvider::from_config(Arc::clone(&runner), &config.providers.vault);
+        reg.register(Arc::new(provider));
+        any_enabled = true;
+    }
+
     if any_enabled {
         Some(Arc::new(reg))
     } else {
@@ -525,12 +566,24 @@ mod tests {
                 sops: crate::config::SecretProviderSops { enabled: false },
                 keychain: crate::config::SecretProviderKeychain { enabled: false },
                 secret_tool: crate::config::SecretProviderSecretTool { enabled: false },
+                vault: crate::config::SecretProviderVault {
+                    enabled: false,
+                    address: String::new(),
+                    agent_address: String::new(),
+                    namespace: String::new(),
+                },
             },
         };
         let runner: std::sync::Arc<dyn crate::datastore::CommandRunner> =
             std::sync::Arc::new(NoopRunner);
-        let (reg, _) =
-            default_registry(&preprocessor, &secret, env.paths.as_ref(), runner).unwrap();
+        let (reg, _) = default_registry(
+            &preprocessor,
+            &secret,
+            env.paths.as_ref(),
+            serde_json::Value::Object(Default::default()),
+            runner,
+        )
+        .unwrap();
         reg
     }
 
@@ -541,6 +594,7 @@ mod tests {
                 extensions: vec!["tmpl".into()],
                 vars: Default::default(),
                 no_reverse: Vec::new(),
+                generate: Vec::new(),
             },
             age: crate::config::PreprocessorAgeSection {
                 enabled: false,
@@ -551,6 +605,7 @@ mod tests {
                 enabled: false,
                 extensions: vec!["gpg".into(), "asc".into()],
             },
+            filters: Default::default(),
         }
     }
 
@@ -591,6 +646,19 @@ mod tests {
         assert_eq!(asc_pp.name(), "gpg");
     }
 
+    #[test]
+    fn default_registry_consults_filters_after_other_preprocessors() {
+        let mut pre = empty_preprocessor_section();
+        pre.filters
+            .insert("*".into(), vec!["line-endings:lf".into()]);
+        let reg = make_default_registry(pre);
+        assert_eq!(
+            reg.find_for_file("config.toml.tmpl").unwrap().name(),
+            "template"
+        );
+        assert_eq!(reg.find_for_file("gitconfig").unwrap().name(), "filter");
+    }
+
     #[test]
     fn registry_does_not_match_partial_extension() {
         let mut registry = PreprocessorRegistry::new();
@@ -15,9 +15,9 @@ use crate::datastore::DataStore;
 use crate::fs::Fs;
 use crate::packs::Pack;
 use crate::paths::Pather;
-use crate::preprocessing::baseline::{cache_filename_for, hex_sha256, Baseline};
+use crate::preprocessing::baseline::{cache_filename_for, hex_encode_32, hex_sha256, Baseline};
 use crate::preprocessing::divergence::DivergenceState;
-use crate::preprocessing::PreprocessorRegistry;
+use crate::preprocessing::{Preprocessor, PreprocessorRegistry};
 use crate::rules::PackEntry;
 use crate::{DodotError, Result};
 
@@ -61,7 +61,11 @@ pub enum PreprocessMode {
 /// rejected because they would silently fail at the datastore layer with
 /// an opaque error — here we produce a clean diagnostic naming the
 /// preprocessor and source file.
-fn validate_safe_relative_path(path: &Path, preprocessor: &str, source_file: &Path) -> Result<()> {
+pub(crate) fn validate_safe_relative_path(
+    path: &Path,
+    preprocessor: &str,
+    source_file: &Path,
+) -> Result<()> {
     let mut has_normal = false;
     for component in path.components() {
         match component {
@@ -97,7 +101,7 @@ fn validate_safe_relative_path(path: &Path, preprocessor: &str, source_file: &Pa
 /// Normalise a validated relative path by dropping `CurDir` components,
 /// so that `./foo` and `foo` are treated as the same virtual path for
 /// collision detection. Only call after [`validate_safe_relative_path`].
-fn normalize_relative(path: &Path) -> PathBuf {
+pub(crate) fn normalize_relative(path: &Path) -> PathBuf {
     let mut out = PathBuf::new();
     for component in path.components() {
         if let Component::Normal(n) = component {
@@ -256,13 +260,114 @@ fn check_divergence(
     })
 }
 
+/// The stored baseline of `virtual_relative`, with the datastore path
+/// and bytes of its render, when the datastore file still holds exactly
+/// what that baseline recorded. `None` when there is no readable
+/// baseline or the file is missing, replaced or edited.
+fn intact_render(
+    fs: &dyn Fs,
+    paths: &dyn Pather,
+    pack_name: &str,
+    virtual_relative: &Path,
+) -> Result<Option<(Baseline, PathBuf, Vec<u8>)>> {
+    let cache_filename = cache_filename_for(virtual_relative);
+    let Ok(Some(previous)) =
+        Baseline::load(fs, paths, pack_name, PREPROCESSED_HANDLER, &cache_filename)
+    else {
+        return Ok(None);
+    };
+    let deployed_path = paths
+        .handler_data_dir(pack_name, PREPROCESSED_HANDLER)
+        .join(virtual_relative);
+    if !fs.exists(&deployed_path) || fs.is_symlink(&deployed_path) {
+        return Ok(None);
+    }
+    let deployed_bytes = fs.read_file(&deployed_path)?;
+    if hex_sha256(&deployed_bytes) != previous.rendered_hash {
+        return Ok(None);
+    }
+    Ok(Some((previous, deployed_path, deployed_bytes)))
+}
+
+/// The virtual path, datastore path and bytes of `entry`'s last render
+/// when it is still current without rendering again; `None` when
+/// `expand` has to run.
+///
+/// Only preprocessors with a
+/// [`render_fingerprint`](Preprocessor::render_fingerprint) qualify.
+/// Current means the stored baseline has the source's hash and that
+/// fingerprint, and [`intact_render`] finds its output untouched.
+fn current_render(
+    fs: &dyn Fs,
+    paths: &dyn Pather,
+    pack_name: &str,
+    entry: &PackEntry,
+    preprocessor: &dyn Preprocessor,
+    filename: &str,
+) -> Result<Option<(PathBuf, PathBuf, Vec<u8>)>> {
+    let Some(fingerprint) = preprocessor.render_fingerprint() else {
+        return Ok(None);
+    };
+    let stripped = PathBuf::from(preprocessor.stripped_name(filename));
+    let virtual_relative = match entry.relative_path.parent() {
+        Some(parent) if parent != Path::new("") => parent.join(stripped),
+        _ => stripped,
+    };
+    let virtual_relative = normalize_relative(&virtual_relative);
+    let Some((previous, deployed_path, bytes)) =
+        intact_render(fs, paths, pack_name, &virtual_relative)?
+    else {
+        return Ok(None);
+    };
+    let source_bytes = fs.read_file(&entry.absolute_path)?;
+    if previous.source_hash != hex_sha256(&source_bytes)
+        || previous.context_hash != hex_encode_32(&fingerprint)
+    {
+        return Ok(None);
+    }
+    Ok(Some((virtual_relative, deployed_path, bytes)))
+}
+
+/// The datastore path of `virtual_relative` when its last render is
+/// still current, `None` when it needs writing.
+///
+/// The post-render counterpart of [`current_render`], for
+/// preprocessors that can't fingerprint their inputs up front: the
+/// stored baseline must match `candidate` on source, context and
+/// rendered output, and [`intact_render`] must find the output
+/// untouched.
+fn unchanged_render(
+    fs: &dyn Fs,
+    paths: &dyn Pather,
+    pack_name: &str,
+    virtual_relative: &Path,
+    candidate: &Baseline,
+) -> Result<Option<PathBuf>> {
+    let Some((previous, deployed_path, _)) = intact_render(fs, paths, pack_name, virtual_relative)?
+    else {
+        return Ok(None);
+    };
+    if previous.source_hash != candidate.source_hash
+        || previous.context_hash != candidate.context_hash
+        || previous.rendered_hash != candidate.rendered_hash
+        || previous.tracked_render != candidate.tracked_render
+    {
+        return Ok(None);
+    }
+    Ok(Some(deployed_path))
+}
+
 /// Run the preprocessing pipeline for a pack's file entries.
 ///
 /// 1. Partition entries into preprocessor files vs regular files.
 /// 2. **In `PreprocessMode::Active`** (real `dodot up` runs): for each
 ///    preprocessor file, expand, write results to datastore (unless the
 ///    deployed file has diverged from the cached baseline — see step 5),
-///    write the baseline cache record.
+///    write the baseline cache record. A template whose source and
+///    context match the cached baseline is not rendered at all (see
+///    `current_render`), and any other render whose output also
+///    matches is not rewritten (see `unchanged_render`), so repeat
+///    deploys neither call secret providers nor touch targets.
 /// 3. Create virtual `PackEntry`s pointing to the datastore files.
 /// 4. Check for collisions between virtual and regular entries.
 /// 5. **Divergence guard** (Active only): unless `force` is `true`,
@@ -287,10 +392,12 @@ fn check_divergence(
 ///    `docs/proposals/secrets.lex` §7.4.
 /// 7. Return the result for merging into the handler pipeline.
 ///
-/// Set `force = true` to bypass the divergence guard. Surfaces as
+/// Set `force = true` to bypass the divergence guard and both
+/// unchanged-render skips. Surfaces as
 /// `dodot up --force` in the CLI; needed when the user knows they want
-/// to overwrite a divergent deployed file (e.g. after rotating an env
-/// var that a template references). Ignored in `Passive` mode (no
+/// to overwrite a divergent deployed file, or to re-render after
+/// rotating an env var or secret that a template references — neither
+/// is part of the template's fingerprint. Ignored in `Passive` mode (no
 /// writes happen there at all).
 #[allow(clippy::too_many_arguments)] // pipeline core: every parameter is load-bearing
 pub fn preprocess_pack(
@@ -423,6 +530,39 @@ pub fn preprocess_pack(
             )?;
         }
 
+        // Incremental deploys: a template whose source and context match
+        // its last render, with that render still intact in the
+        // datastore, is reused as-is. No `expand`, so no secret lookups;
+        // the baseline and secrets sidecar already describe it.
+        if !force {
+            if let Some((virtual_relative, datastore_path, bytes)) =
+                current_render(fs, paths, &pack.name, entry, preprocessor, &filename)?
+            {
+                if claimed_paths.contains(&virtual_relative) {
+                    return Err(DodotError::PreprocessorCollision {
+                        pack: pack.name.clone(),
+                        source_file: filename.clone(),
+                        expanded_name: virtual_relative.to_string_lossy().into_owned(),
+                    });
+                }
+                debug!(
+                    pack = %pack.name,
+                    file = %virtual_relative.display(),
+                    "inputs unchanged (skipping render)"
+                );
+                claimed_paths.insert(virtual_relative.clone());
+                source_map.insert(datastore_path.clone(), entry.absolute_path.clone());
+                rendered_bytes.insert(datastore_path.clone(), Arc::from(bytes));
+                virtual_entries.push(PackEntry {
+                    relative_path: virtual_relative,
+                    absolute_path: datastore_path,
+                    is_dir: false,
+                    gate_failure: None,
+                });
+                continue;
+            }
+        }
+
         // Expand the source file
         let expanded_files = preprocessor.expand(&entry.absolute_path, fs)?;
 
@@ -547,8 +687,40 @@ pub fn preprocess_pack(
             }
             let was_skipped = skip_path.is_some();
 
+            // Incremental deploys: build the would-be baseline up
+            // front and, unless forced, compare it with the last one.
+            // Same source, same context and same output, with the
+            // datastore file still holding those bytes, means there is
+            // nothing to write — leaving the file alone keeps its
+            // mtime, so editors and file watchers on the deployed
+            // path don't see a spurious change on every `dodot up`.
+            let baseline = if !expanded.is_dir && !was_skipped && participates_in_divergence_guard {
+                let source_bytes = fs.read_file(&entry.absolute_path)?;
+                Some(Baseline::build(
+                    &entry.absolute_path,
+                    &expanded.content,
+                    &source_bytes,
+                    expanded.tracked_render.as_deref(),
+                    expanded.context_hash.as_ref(),
+                ))
+            } else {
+                None
+            };
+            let unchanged_path = match &baseline {
+                Some(b) if !force => unchanged_render(fs, paths, &pack.name, &virtual_relative, b)?,
+                _ => None,
+            };
+            let was_unchanged = unchanged_path.is_some();
+
             let datastore_path = if let Some(p) = skip_path {
                 p
+            } else if let Some(p) = unchanged_path {
+                debug!(
+                    pack = %pack.name,
+                    file = %virtual_relative.display(),
+                    "render unchanged (skipping write)"
+                );
+                p
             } else if expanded.is_dir {
                 datastore.write_rendered_dir(
                     &pack.name,
@@ -602,7 +774,9 @@ pub fn preprocess_pack(
             //     paired with burgertocow tracking, AND
             //   - the divergence guard didn't skip the write (otherwise
             //     we'd update the baseline to match a render that never
-            //     hit disk, breaking future divergence detection).
+            //     hit disk, breaking future divergence detection), AND
+            //   - the render changed (an unchanged render keeps its
+            //     baseline, timestamp included).
             //
             // Mode-gating happens at the function boundary: this whole
             // branch only runs in `PreprocessMode::Active`. Passive
@@ -616,19 +790,9 @@ pub fn preprocess_pack(
             // (no marker stream — `tracked_render = None` — but
             // rendered_hash is still meaningful for divergence
             // detection per `secrets.lex` §4.4).
-            let should_write_baseline = !expanded.is_dir
-                && !was_skipped
-                && (expanded.tracked_render.is_some() || expanded.deploy_mode.is_some());
-            if should_write_baseline {
+            let baseline = baseline.filter(|_| !was_unchanged);
+            if let Some(baseline) = baseline {
                 let cache_filename = cache_filename_for(&virtual_relative);
-                let source_bytes = fs.read_file(&entry.absolute_path)?;
-                let baseline = Baseline::build(
-                    &entry.absolute_path,
-                    &expanded.content,
-                    &source_bytes,
-                    expanded.tracked_render.as_deref(),
-                    expanded.context_hash.as_ref(),
-                );
                 if let Err(err) =
                     baseline.write(fs, paths, &pack.name, PREPROCESSED_HANDLER, &cache_filename)
                 {
@@ -359,3 +359,183 @@ fn end_to_end_baseline_for_real_template_preprocessor() {
     // Rendered hash is SHA-256 hex.
     assert_eq!(baseline.rendered_hash.len(), 64);
 }
+
+#[test]
+fn unchanged_render_is_not_rewritten_unless_forced() {
+    // A second `up` with the same source, context and output must
+    // leave the datastore file and its baseline alone. The baseline
+    // timestamp is zeroed between runs as a marker: it survives an
+    // unchanged run and is replaced by a forced one or a new context.
+    let env = TempEnvironment::builder()
+        .pack("app")
+        .file("config.toml.tracked", "name = {{ name }}")
+        .done()
+        .build();
+    let datastore = make_datastore(&env);
+    let pack = make_pack("app", env.dotfiles_root.join("app"));
+
+    let run = |context: u8, force: bool| {
+        let mut registry = PreprocessorRegistry::new();
+        registry.register(Box::new(ScriptedPreprocessor {
+            name: "tracked-scripted",
+            extension: ".tracked",
+            outputs: vec![crate::preprocessing::ExpandedFile {
+                relative_path: PathBuf::from("config.toml"),
+                content: b"name = rendered".to_vec(),
+                is_dir: false,
+                tracked_render: Some("name = \u{1e}rendered\u{1f}".into()),
+                context_hash: Some([context; 32]),
+                secret_line_ranges: Vec::new(),
+                deploy_mode: None,
+            }],
+            ..Default::default()
+        }));
+        let entries = vec![PackEntry {
+            relative_path: "config.toml.tracked".into(),
+            absolute_path: env.dotfiles_root.join("app/config.toml.tracked"),
+            is_dir: false,
+            gate_failure: None,
+        }];
+        let result = preprocess_pack(
+            entries,
+            &registry,
+            &pack,
+            env.fs.as_ref(),
+            &datastore,
+            env.paths.as_ref(),
+            PreprocessMode::Active,
+            force,
+        )
+        .unwrap();
+        assert_eq!(result.virtual_entries.len(), 1);
+        assert!(result.skipped.is_empty());
+    };
+    let load = || {
+        crate::preprocessing::baseline::Baseline::load(
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            "app",
+            "preprocessed",
+            "config.toml",
+        )
+        .unwrap()
+        .unwrap()
+    };
+    let zero_timestamp = || {
+        let mut baseline = load();
+        baseline.timestamp = 0;
+        baseline
+            .write(
+                env.fs.as_ref(),
+                env.paths.as_ref(),
+                "app",
+                "preprocessed",
+                "config.toml",
+            )
+            .unwrap();
+    };
+
+    run(1, false);
+    zero_timestamp();
+    run(1, false);
+    assert_eq!(load().timestamp, 0, "unchanged render rewrote its baseline");
+
+    run(1, true);
+    assert_ne!(load().timestamp, 0, "--force must rewrite");
+
+    zero_timestamp();
+    run(2, false);
+    assert_ne!(load().timestamp, 0, "a new context must rewrite");
+
+    // A datastore file that lost its bytes is rewritten too.
+    zero_timestamp();
+    let deployed = env
+        .paths
+        .handler_data_dir("app", "preprocessed")
+        .join("config.toml");
+    env.fs.remove_file(&deployed).unwrap();
+    run(2, false);
+    assert_eq!(env.fs.read_to_string(&deployed).unwrap(), "name = rendered");
+    assert_ne!(load().timestamp, 0);
+}
+
+#[test]
+fn unchanged_template_is_not_rendered_again() {
+    // A template whose source and context match its last render is
+    // reused from the datastore without expanding it, so a repeat `up`
+    // makes no secret lookups. `--force` and a source edit render it.
+    use crate::secret::test_support::MockSecretProvider;
+    use crate::secret::SecretRegistry;
+
+    let env = TempEnvironment::builder()
+        .pack("app")
+        .file("config.toml.tmpl", "token = {{ secret('pass:k') }}\n")
+        .done()
+        .build();
+    let datastore = make_datastore(&env);
+    let pack = make_pack("app", env.dotfiles_root.join("app"));
+    let mock = Arc::new(MockSecretProvider::new("pass").with("k", "v"));
+    let deployed = env
+        .paths
+        .handler_data_dir("app", "preprocessed")
+        .join("config.toml");
+
+    let run = |force: bool| {
+        // A fresh secret registry per run, as `dodot up` builds one per
+        // invocation, so its in-run cache can't hide a provider call.
+        let mut secrets = SecretRegistry::new();
+        secrets.register(mock.clone());
+        let template_pp = crate::preprocessing::template::TemplatePreprocessor::new(
+            vec!["tmpl".into()],
+            HashMap::new(),
+            env.paths.as_ref(),
+        )
+        .unwrap()
+        .with_secret_registry(Arc::new(secrets));
+        let mut registry = PreprocessorRegistry::new();
+        registry.register(Box::new(template_pp));
+        let entries = vec![PackEntry {
+            relative_path: "config.toml.tmpl".into(),
+            absolute_path: env.dotfiles_root.join("app/config.toml.tmpl"),
+            is_dir: false,
+            gate_failure: None,
+        }];
+        let result = preprocess_pack(
+            entries,
+            &registry,
+            &pack,
+            env.fs.as_ref(),
+            &datastore,
+            env.paths.as_ref(),
+            PreprocessMode::Active,
+            force,
+        )
+        .unwrap();
+        assert_eq!(result.virtual_entries.len(), 1);
+        assert_eq!(result.virtual_entries[0].absolute_path, deployed);
+        result.rendered_bytes[&deployed].to_vec()
+    };
+
+    assert_eq!(run(false), b"token = v\n");
+    assert_eq!(mock.resolve_call_count(), 1);
+
+    // The reused render still reaches the handlers.
+    assert_eq!(run(false), b"token = v\n");
+    assert_eq!(
+        mock.resolve_call_count(),
+        1,
+        "unchanged template was rendered"
+    );
+
+    run(true);
+    assert_eq!(mock.resolve_call_count(), 2, "--force must render");
+
+    env.fs
+        .write_file(
+            &env.dotfiles_root.join("app/config.toml.tmpl"),
+            b"token = {{ secret('pass:k') }}\n\n",
+        )
+        .unwrap();
+    run(false);
+    assert_eq!(mock.resolve_call_count(), 3, "an edited source must render");
+}
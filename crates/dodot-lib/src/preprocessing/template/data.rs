@@ -0,0 +1,210 @@
+//! Structured template data — the `data.*` namespace.
+//!
+//! `[preprocessor.template.vars]` holds flat strings that belong with
+//! the rules in `.dodot.toml`. Structured, machine-specific values
+//! (a work email, per-host font sizes, a list of git remotes) live in
+//! data files instead:
+//!
+//! - `data.toml` / `data.json` at the pack root — tracked with the pack;
+//! - `<config_dir>/vars.toml` (`~/.config/dodot/vars.toml`) — host-local,
+//!   never in the repo, applied to every pack.
+//!
+//! Sources merge in that order, tables recursively, later values
+//! winning: a host file can override one key of a pack's table without
+//! restating the rest. The merged document is what templates see as
+//! `{{ data.key }}` and what goes into the render context hash, so
+//! editing either file re-renders the templates that depend on it.
+//!
+//! Top-level strings double as bare names (`{{ email }}`) when
+//! `[preprocessor.template.vars]` doesn't define them. That is where
+//! `dodot up` puts answers to its missing-variable prompt
+//! ([`record_host_vars`]), so a bare name and a `data.*` key can both
+//! be answered once per machine.
+
+use std::path::{Path, PathBuf};
+
+use serde_json::{Map, Value};
+
+use crate::fs::Fs;
+use crate::paths::Pather;
+use crate::{DodotError, Result};
+
+/// Pack-root data files, in merge order. The default `[mappings]
+/// skip` list keeps them from being deployed.
+pub const PACK_DATA_FILES: &[&str] = &["data.toml", "data.json"];
+
+/// Load and merge the template data for the pack at `pack_path`.
+/// Missing files contribute nothing; a file that fails to parse is an
+/// error naming it, rather than a template that silently renders
+/// without its data.
+pub fn load_template_data(fs: &dyn Fs, pather: &dyn Pather, pack_path: &Path) -> Result<Value> {
+    let mut data = Value::Object(Map::new());
+    for name in PACK_DATA_FILES {
+        merge_file(fs, &pack_path.join(name), &mut data)?;
+    }
+    merge_file(fs, &pather.host_vars_path(), &mut data)?;
+    Ok(data)
+}
+
+fn merge_file(fs: &dyn Fs, path: &Path, into: &mut Value) -> Result<()> {
+    if !fs.exists(path) {
+        return Ok(());
+    }
+    let text = fs.read_to_string(path)?;
+    let parsed: Value = if path.extension().is_some_and(|e| e == "json") {
+        serde_json::from_str(&text).map_err(|e| data_error(path, e))?
+    } else {
+        toml::from_str(&text).map_err(|e| data_error(path, e))?
+    };
+    if !parsed.is_object() {
+        return Err(DodotError::Config(format!(
+            "template data {}: top level must be a table",
+            path.display()
+        )));
+    }
+    merge(into, parsed);
+    Ok(())
+}
+
+/// Store `answers` in the host vars file, each under the key the
+/// template used: `data.git.email` as `email` in `[git]`, a bare
+/// `email` at the top level. Existing values are kept. The file is
+/// parsed and written back, so comments in it are lost.
+pub fn record_host_vars(
+    fs: &dyn Fs,
+    pather: &dyn Pather,
+    answers: &[(String, String)],
+) -> Result<PathBuf> {
+    let path = pather.host_vars_path();
+    let mut table = if fs.exists(&path) {
+        toml::from_str::<toml::Table>(&fs.read_to_string(&path)?)
+            .map_err(|e| data_error(&path, e))?
+    } else {
+        toml::Table::new()
+    };
+    for (key, value) in answers {
+        let keys: Vec<&str> = key
+            .strip_prefix("data.")
+            .unwrap_or(key)
+            .split('.')
+            .collect();
+        let (last, parents) = keys.split_last().expect("split yields one piece");
+        let mut node = &mut table;
+        for part in parents {
+            node = node
+                .entry(part.to_string())
+                .or_insert_with(|| toml::Value::Table(toml::Table::new()))
+                .as_table_mut()
+                .ok_or_else(|| {
+                    DodotError::Config(format!(
+                        "template data {}: `{part}` isn't a table, can't store `{key}` under it",
+                        path.display()
+                    ))
+                })?;
+        }
+        node.insert(last.to_string(), toml::Value::String(value.clone()));
+    }
+    let text = toml::to_string(&table).map_err(|e| data_error(&path, e))?;
+    if let Some(parent) = path.parent() {
+        fs.mkdir_all(parent)?;
+    }
+    fs.write_file_atomic(&path, text.as_bytes())?;
+    Ok(path)
+}
+
+fn data_error(path: &Path, e: impl std::fmt::Display) -> DodotError {
+    DodotError::Config(format!("template data {}: {e}", path.display()))
+}
+
+/// Recursive merge: tables merge key by key, anything else (arrays
+/// included) is replaced wholesale.
+fn merge(base: &mut Value, overlay: Value) {
+    match (base, overlay) {
+        (Value::Object(base), Value::Object(overlay)) => {
+            for (key, value) in overlay {
+                match base.get_mut(&key) {
+                    Some(existing) => merge(existing, value),
+                    None => {
+                        base.insert(key, value);
+                    }
+                }
+            }
+        }
+        (base, overlay) => *base = overlay,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::testing::TempEnvironment;
+
+    #[test]
+    fn host_vars_override_pack_data_per_key() {
+        let env = TempEnvironment::builder()
+            .pack("git")
+            .file(
+                "data.toml",
+                "[user]\nname = \"Ada\"\nemail = \"ada@home.example\"\n",
+            )
+            .done()
+            .build();
+        let host_vars = env.paths.host_vars_path();
+        env.fs.mkdir_all(host_vars.parent().unwrap()).unwrap();
+        env.fs
+            .write_file(&host_vars, b"[user]\nemail = \"ada@work.example\"\n")
+            .unwrap();
+
+        let data = load_template_data(
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            &env.dotfiles_root.join("git"),
+        )
+        .unwrap();
+        assert_eq!(data["user"]["name"], "Ada");
+        assert_eq!(data["user"]["email"], "ada@work.example");
+    }
+
+    #[test]
+    fn recorded_answers_merge_into_host_vars() {
+        let env = TempEnvironment::builder().pack("git").done().build();
+        let host_vars = env.paths.host_vars_path();
+        env.fs.mkdir_all(host_vars.parent().unwrap()).unwrap();
+        env.fs
+            .write_file(&host_vars, b"[git]\nname = \"Ada\"\n")
+            .unwrap();
+
+        let answers = [
+            ("data.git.email".to_string(), "ada@example.com".to_string()),
+            ("editor".to_string(), "nvim".to_string()),
+        ];
+        record_host_vars(env.fs.as_ref(), env.paths.as_ref(), &answers).unwrap();
+
+        let data = load_template_data(
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            &env.dotfiles_root.join("git"),
+        )
+        .unwrap();
+        assert_eq!(data["git"]["name"], "Ada");
+        assert_eq!(data["git"]["email"], "ada@example.com");
+        assert_eq!(data["editor"], "nvim");
+    }
+
+    #[test]
+    fn unparseable_data_file_names_the_file() {
+        let env = TempEnvironment::builder()
+            .pack("git")
+            .file("data.json", "{ not json")
+            .done()
+            .build();
+
+        let err = load_template_data(
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            &env.dotfiles_root.join("git"),
+        )
+        .unwrap_err();
+        assert!(err.to_string().contains("data.json"), "{err}");
+    }
+}
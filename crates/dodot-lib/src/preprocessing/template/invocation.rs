@@ -0,0 +1,137 @@
+//! One-shot template variables (`--var key=value`, `--vars-file`).
+//!
+//! `up` and `provision` accept variables for a single invocation: an
+//! API token that should exist only in the file the template renders,
+//! not in `.dodot.toml`, `data.toml` or the host vars file. They layer
+//! over `[preprocessor.template.vars]` for every pack of the run and
+//! are never written anywhere by dodot — the rendered output (and its
+//! baseline copy in the cache dir, which reverse-merge diffs against)
+//! is the only place the value ends up. A later run without the
+//! variable finds it missing like any other undefined name.
+
+use std::collections::BTreeMap;
+
+use crate::config::DodotConfig;
+use crate::{DodotError, Result};
+
+use super::RESERVED_VARS;
+
+/// Parse one `--var` argument, `key=value`. The value may itself
+/// contain `=`; the key must be a plain template identifier.
+pub fn parse_var(pair: &str) -> Result<(String, String)> {
+    let (key, value) = pair.split_once('=').ok_or_else(|| {
+        DodotError::Config(format!(
+            "invalid --var {:?}: expected key=value",
+            redact(pair)
+        ))
+    })?;
+    check_key(key, "--var")?;
+    Ok((key.to_string(), value.to_string()))
+}
+
+/// Parse a `--vars-file`: a TOML document of top-level string values.
+/// `source` names the file (or `stdin`) in errors. Values are never
+/// echoed back in messages.
+pub fn parse_vars_file(source: &str, text: &str) -> Result<BTreeMap<String, String>> {
+    let table: toml::Table = toml::from_str(text).map_err(|e| {
+        DodotError::Config(format!(
+            "--vars-file {source}: not valid TOML: {}",
+            e.message()
+        ))
+    })?;
+    let mut vars = BTreeMap::new();
+    for (key, value) in table {
+        check_key(&key, &format!("--vars-file {source}"))?;
+        let toml::Value::String(value) = value else {
+            return Err(DodotError::Config(format!(
+                "--vars-file {source}: `{key}` must be a string"
+            )));
+        };
+        vars.insert(key, value);
+    }
+    Ok(vars)
+}
+
+/// The variables of one invocation: the vars file first, then each
+/// `--var` in order, later values winning.
+pub fn invocation_vars(
+    pairs: &[String],
+    file: Option<(&str, &str)>,
+) -> Result<BTreeMap<String, String>> {
+    let mut vars = match file {
+        Some((source, text)) => parse_vars_file(source, text)?,
+        None => BTreeMap::new(),
+    };
+    for pair in pairs {
+        let (key, value) = parse_var(pair)?;
+        vars.insert(key, value);
+    }
+    Ok(vars)
+}
+
+/// Layer `vars` over the pack config's `[preprocessor.template.vars]`.
+pub fn apply(config: &mut DodotConfig, vars: &BTreeMap<String, String>) {
+    config
+        .preprocessor
+        .template
+        .vars
+        .extend(vars.iter().map(|(k, v)| (k.clone(), v.clone())));
+}
+
+fn check_key(key: &str, origin: &str) -> Result<()> {
+    let mut chars = key.chars();
+    let identifier = chars
+        .next()
+        .is_some_and(|c| c.is_ascii_alphabetic() || c == '_')
+        && chars.all(|c| c.is_ascii_alphanumeric() || c == '_');
+    if !identifier {
+        return Err(DodotError::Config(format!(
+            "{origin}: invalid variable name {key:?}: use letters, digits and `_`"
+        )));
+    }
+    if RESERVED_VARS.contains(&key) {
+        return Err(DodotError::TemplateReservedVar { name: key.into() });
+    }
+    Ok(())
+}
+
+/// A `--var` argument with its value hidden, for error messages.
+fn redact(pair: &str) -> String {
+    match pair.split_once('=') {
+        Some((key, _)) => format!("{key}=…"),
+        None if pair.chars().count() > 24 => {
+            format!("{}…", pair.chars().take(24).collect::<String>())
+        }
+        None => pair.to_string(),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn vars_file_is_overridden_by_flags() {
+        let file = "token = \"from-file\"\nregion = \"eu\"\n";
+        let vars =
+            invocation_vars(&["token=a=b".to_string()], Some(("secrets.toml", file))).unwrap();
+        assert_eq!(vars["token"], "a=b");
+        assert_eq!(vars["region"], "eu");
+    }
+
+    #[test]
+    fn bad_names_and_values_are_rejected_without_echoing_values() {
+        assert!(parse_var("no-equals-sign").is_err());
+        assert!(parse_var("data=x").is_err(), "reserved namespace");
+        assert!(parse_var("git.email=x").is_err());
+
+        let err = parse_vars_file("stdin", "port = 8080\n")
+            .unwrap_err()
+            .to_string();
+        assert!(err.contains("`port` must be a string"), "{err}");
+        let err = parse_vars_file("stdin", "token = \"hunter2\nbroken")
+            .unwrap_err()
+            .to_string();
+        assert!(!err.contains("hunter2"), "{err}");
+    }
+}
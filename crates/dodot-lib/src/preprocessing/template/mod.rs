@@ -8,8 +8,13 @@
 //! - `dodot.*` — built-in values (os, arch, hostname, username, home,
 //!   dotfiles_root), computed once at preprocessor construction.
 //! - `env.*` — dynamic lookup of process environment variables.
+//! - `data.*` — structured values from the pack's `data.toml` /
+//!   `data.json` and the host-local `~/.config/dodot/vars.toml`
+//!   (see [`data`]).
 //! - bare names — user-defined variables from
-//!   `[preprocessor.template.vars]` in `.dodot.toml`.
+//!   `[preprocessor.template.vars]` in `.dodot.toml`, overridden by
+//!   one-shot `--var` values (see [`invocation`]) and falling back to
+//!   top-level strings in `data`.
 //!
 //! Uses MiniJinja strict undefined-behaviour: references to missing vars
 //! raise a render error rather than silently producing empty strings.
@@ -28,8 +33,12 @@
 //! at clean-filter time would re-trigger any secret-provider auth
 //! prompts on every `git status`.
 
+mod data;
+pub mod invocation;
 mod secrets;
 
+pub use data::{load_template_data, record_host_vars, PACK_DATA_FILES};
+
 use std::collections::{BTreeMap, HashMap};
 use std::path::{Path, PathBuf};
 use std::sync::{Arc, Mutex, OnceLock};
@@ -37,6 +46,7 @@ use std::sync::{Arc, Mutex, OnceLock};
 use burgertocow::Tracker;
 use minijinja::value::{Enumerator, Object, ObjectRepr, Value};
 use minijinja::{Error as MjError, ErrorKind as MjErrorKind, UndefinedBehavior};
+use serde::Serialize;
 use sha2::{Digest, Sha256};
 
 use crate::fs::Fs;
@@ -48,7 +58,12 @@ use crate::{DodotError, Result};
 use secrets::{finalize_secrets, make_secret_sentinel, next_render_id, SecretCallEntry};
 
 /// Reserved top-level variable names.
-const RESERVED_VARS: &[&str] = &["dodot", "env"];
+const RESERVED_VARS: &[&str] = &["dodot", "env", "data"];
+
+/// Globals MiniJinja and this preprocessor provide on their own. A
+/// `data` key never shadows them, and a reference to one is never
+/// missing.
+const BUILTIN_GLOBALS: &[&str] = &["secret", "range", "dict", "namespace", "debug", "loop"];
 
 /// MiniJinja object that looks up process environment variables on
 /// attribute access. `{{ env.SHELL }}` becomes `std::env::var("SHELL")`.
@@ -88,8 +103,11 @@ pub struct TemplatePreprocessor {
     extensions: Vec<String>,
     dodot_ns: BTreeMap<String, String>,
     user_vars: BTreeMap<String, String>,
-    /// SHA-256 of the deterministic projection of `dodot_ns` and
-    /// `user_vars` (sorted keys, length-prefixed). Reused as the
+    /// The merged `data.*` document. An empty table unless
+    /// [`Self::with_data`] was called.
+    data: serde_json::Value,
+    /// SHA-256 of the deterministic projection of `dodot_ns`,
+    /// `user_vars` and `data` (sorted keys, length-prefixed). Reused as the
     /// `context_hash` for every render this preprocessor performs.
     ///
     /// `env.*` references are intentionally **not** part of the
@@ -147,12 +165,14 @@ impl TemplatePreprocessor {
 
         let dodot_ns = build_dodot_context(pather);
         let user_vars: BTreeMap<String, String> = user_vars.into_iter().collect();
-        let context_hash = compute_context_hash(&dodot_ns, &user_vars);
+        let data = serde_json::Value::Object(Default::default());
+        let context_hash = compute_context_hash(&dodot_ns, &user_vars, &data);
 
         Ok(Self {
             extensions,
             dodot_ns,
             user_vars,
+            data,
             context_hash,
             secret_registry: None,
         })
@@ -170,6 +190,161 @@ impl TemplatePreprocessor {
         self
     }
 
+    /// Install the `data.*` namespace (see [`load_template_data`]) and
+    /// fold it into the context hash, so a changed data file
+    /// invalidates the renders that saw the old values.
+    pub fn with_data(mut self, data: serde_json::Value) -> Self {
+        self.context_hash = compute_context_hash(&self.dodot_ns, &self.user_vars, &data);
+        self.data = data;
+        self
+    }
+
+    /// Variables `source` uses that nothing defines, as the template
+    /// writes them (`email`, `data.git.email`), sorted. Empty when the
+    /// template renders, so a template whose only unset references are
+    /// guarded by `is defined` or `default(...)` asks for nothing; and
+    /// when it fails for any other reason, which the real render
+    /// reports. `secret(...)` calls are stubbed out, so no provider is
+    /// asked.
+    pub fn missing_variables(&self, source: &str) -> Vec<String> {
+        let mut env = minijinja::Environment::new();
+        self.install_namespaces(&mut env);
+        env.add_function("secret", |_reference: &str| String::new());
+        let Ok(template) = env.template_from_str(source) else {
+            return Vec::new();
+        };
+        match template.render(()) {
+            Err(e) if e.kind() == MjErrorKind::UndefinedError => {}
+            _ => return Vec::new(),
+        }
+        let mut missing: Vec<String> = template
+            .undeclared_variables(true)
+            .into_iter()
+            .filter_map(|name| self.unresolved(&name))
+            .collect();
+        missing.sort();
+        missing.dedup();
+        missing
+    }
+
+    /// Every variable `source` uses, where each one's value comes
+    /// from, and — when it doesn't parse, or fails to render for a
+    /// reason other than an undefined variable — the error with the
+    /// line MiniJinja blames. Like [`Self::missing_variables`], an
+    /// unset reference only counts as [`VarSource::Missing`] when the
+    /// render actually fails on one; otherwise it is guarded and
+    /// [`VarSource::Optional`]. `secret(...)` calls are stubbed out.
+    pub fn inventory(&self, source: &str) -> TemplateInventory {
+        let mut env = minijinja::Environment::new();
+        self.install_namespaces(&mut env);
+        env.add_function("secret", |_reference: &str| String::new());
+        let template = match env.template_from_str(source) {
+            Ok(template) => template,
+            Err(e) => {
+                return TemplateInventory {
+                    variables: Vec::new(),
+                    problem: Some(TemplateProblem::from_error(&e)),
+                }
+            }
+        };
+        let (unset, problem) = match template.render(()) {
+            Ok(_) => (VarSource::Optional, None),
+            Err(e) if e.kind() == MjErrorKind::UndefinedError => (VarSource::Missing, None),
+            Err(e) => (VarSource::Missing, Some(TemplateProblem::from_error(&e))),
+        };
+        let mut variables: Vec<TemplateVar> = template
+            .undeclared_variables(true)
+            .into_iter()
+            .filter_map(|name| {
+                let source = self.source_of(&name, unset)?;
+                Some(TemplateVar { name, source })
+            })
+            .collect();
+        variables.sort_by(|a, b| a.name.cmp(&b.name));
+        TemplateInventory { variables, problem }
+    }
+
+    /// Where `name` gets its value, `unset` when nothing supplies one,
+    /// or `None` for MiniJinja's own globals and `secret`.
+    fn source_of(&self, name: &str, unset: VarSource) -> Option<VarSource> {
+        let mut parts = name.split('.');
+        let root = parts.next()?;
+        let key = parts.next();
+        Some(match root {
+            _ if BUILTIN_GLOBALS.contains(&root) => return None,
+            "dodot" => match key {
+                Some(key) if !self.dodot_ns.contains_key(key) => unset,
+                _ => VarSource::Dodot,
+            },
+            "env" => match key {
+                Some(key) if std::env::var_os(key).is_none() => unset,
+                _ => VarSource::Env,
+            },
+            _ if self.unresolved(name).is_some() => unset,
+            _ if self.user_vars.contains_key(root) => VarSource::Vars,
+            _ => VarSource::Data,
+        })
+    }
+
+    /// `name` (a dotted path from `undeclared_variables`) if it
+    /// resolves to nothing. `dodot.*` and `env.*` are never reported:
+    /// those aren't values a prompt could supply.
+    fn unresolved(&self, name: &str) -> Option<String> {
+        let mut parts = name.split('.');
+        let root = parts.next()?;
+        match root {
+            "dodot" | "env" => None,
+            "data" => {
+                let mut node = &self.data;
+                for part in parts {
+                    node = match node.get(part) {
+                        Some(next) => next,
+                        None => return Some(name.to_string()),
+                    };
+                }
+                None
+            }
+            _ if BUILTIN_GLOBALS.contains(&root)
+                || self.user_vars.contains_key(root)
+                || self.data_fallbacks().any(|(key, _)| key == root) =>
+            {
+                None
+            }
+            _ => Some(root.to_string()),
+        }
+    }
+
+    /// Top-level strings in `data` that stand in for bare names
+    /// `[preprocessor.template.vars]` doesn't define.
+    fn data_fallbacks(&self) -> impl Iterator<Item = (&str, &str)> {
+        self.data
+            .as_object()
+            .into_iter()
+            .flatten()
+            .filter_map(|(key, value)| {
+                let key = key.as_str();
+                let shadowed = self.user_vars.contains_key(key)
+                    || RESERVED_VARS.contains(&key)
+                    || BUILTIN_GLOBALS.contains(&key);
+                (!shadowed).then_some((key, value.as_str()?))
+            })
+    }
+
+    /// Strict undefined plus every namespace: `dodot`, `env`, `data`,
+    /// the user vars and their `data` fallbacks.
+    fn install_namespaces(&self, env: &mut minijinja::Environment<'_>) {
+        env.set_undefined_behavior(UndefinedBehavior::Strict);
+        env.add_global("dodot", Value::from(self.dodot_ns.clone()));
+        env.add_global("env", Value::from_object(EnvLookup));
+        env.add_global("data", Value::from_serialize(&self.data));
+        for (name, val) in &self.user_vars {
+            env.add_global(name.clone(), Value::from(val.clone()));
+        }
+        for (name, val) in self.data_fallbacks() {
+            env.add_global(name.to_string(), Value::from(val));
+        }
+    }
+
     /// Build a fresh tracker with this preprocessor's namespaces
     /// installed and `UndefinedBehavior::Strict` set. Called per render
     /// because `Tracker::add_template` requires `&mut self`.
@@ -190,12 +365,7 @@ impl TemplatePreprocessor {
     fn make_tracker(&self, sidecar: Arc<Mutex<Vec<SecretCallEntry>>>, render_id: u64) -> Tracker {
         let mut tracker = Tracker::new();
         let env = tracker.env_mut();
-        env.set_undefined_behavior(UndefinedBehavior::Strict);
-        env.add_global("dodot", Value::from(self.dodot_ns.clone()));
-        env.add_global("env", Value::from_object(EnvLookup));
-        for (name, val) in &self.user_vars {
-            env.add_global(name.clone(), Value::from(val.clone()));
-        }
+        self.install_namespaces(env);
 
         // Install the `secret(...)` function. Two cases:
         //
@@ -328,6 +498,13 @@ impl Preprocessor for TemplatePreprocessor {
         true
     }
 
+    fn render_fingerprint(&self) -> Option<[u8; 32]> {
+        // One output per source, and no includes: the source bytes and
+        // this context decide the render. `env.*` and `secret(...)`
+        // values are not part of it; changing those needs `up --force`.
+        Some(self.context_hash)
+    }
+
     fn matches_extension(&self, filename: &str) -> bool {
         // Extensions are normalized (no leading dot) at construction.
         // We require a literal "." before the extension to avoid e.g.
@@ -425,6 +602,7 @@ impl Preprocessor for TemplatePreprocessor {
 fn compute_context_hash(
     dodot_ns: &BTreeMap<String, String>,
     user_vars: &BTreeMap<String, String>,
+    data: &serde_json::Value,
 ) -> [u8; 32] {
     let mut hasher = Sha256::new();
     for (k, v) in dodot_ns {
@@ -443,6 +621,15 @@ fn compute_context_hash(
         hasher.update(v.as_bytes());
         hasher.update([0x1e]);
     }
+    // serde_json objects iterate in sorted key order, so the
+    // serialization is canonical. An empty table hashes to nothing,
+    // keeping contexts from before `data.*` existed stable.
+    if data.as_object().is_some_and(|o| !o.is_empty()) {
+        hasher.update(b"data");
+        hasher.update([0x1f]);
+        hasher.update(data.to_string().as_bytes());
+        hasher.update([0x1e]);
+    }
     hasher.finalize().into()
 }
 
@@ -487,6 +674,63 @@ fn cached_hostname() -> Option<&'static String> {
     CACHE.get_or_init(crate::gates::detect_hostname).as_ref()
 }
 
+/// Where a template variable's value comes from on this machine.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "snake_case")]
+pub enum VarSource {
+    /// `dodot.*`, computed by dodot.
+    Dodot,
+    /// `env.*`, set in the environment.
+    Env,
+    /// A bare name from `[preprocessor.template.vars]` or `--var`.
+    Vars,
+    /// `data.*`, or a bare name falling back to a top-level string in
+    /// the data files or the host vars file.
+    Data,
+    /// Set nowhere, but guarded (`is defined`, `default(...)`): the
+    /// template renders without it.
+    Optional,
+    /// Set nowhere, and the render fails without it.
+    Missing,
+}
+
+/// One variable a template uses, as the template writes it
+/// (`email`, `data.git.email`, `env.EDITOR`).
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct TemplateVar {
+    pub name: String,
+    pub source: VarSource,
+}
+
+/// A template that doesn't parse or render.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct TemplateProblem {
+    /// 1-based line in the template source, when MiniJinja knows it.
+    pub line: Option<usize>,
+    pub message: String,
+}
+
+impl TemplateProblem {
+    fn from_error(err: &MjError) -> Self {
+        let message = match err.detail() {
+            Some(detail) => format!("{}: {detail}", err.kind()),
+            None => err.kind().to_string(),
+        };
+        Self {
+            line: err.line(),
+            message,
+        }
+    }
+}
+
+/// What [`TemplatePreprocessor::inventory`] finds in one template.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct TemplateInventory {
+    /// Sorted by name. Empty when the template doesn't parse.
+    pub variables: Vec<TemplateVar>,
+    pub problem: Option<TemplateProblem>,
+}
+
 /// Process-wide cached username. Same caching semantics as
 /// [`cached_hostname`]; detection shared with
 /// [`crate::gates::detect_username`].
@@ -595,6 +839,14 @@ mod tests {
         assert!(matches!(err, DodotError::TemplateReservedVar { .. }));
     }
 
+    #[test]
+    fn reserved_data_var_rejected() {
+        let mut vars = HashMap::new();
+        vars.insert("data".into(), "x".into());
+        let err = TemplatePreprocessor::new(vec!["tmpl".into()], vars, &make_pather()).unwrap_err();
+        assert!(matches!(err, DodotError::TemplateReservedVar { .. }));
+    }
+
     // ── Rendering ───────────────────────────────────────────────
 
     #[test]
@@ -712,6 +964,74 @@ mod tests {
         );
     }
 
+    #[test]
+    fn missing_variables_lists_every_unresolved_reference() {
+        let env = crate::testing::TempEnvironment::builder().build();
+        let mut vars = HashMap::new();
+        vars.insert("name".to_string(), "Ada".to_string());
+        let pp = TemplatePreprocessor::new(vec!["tmpl".into()], vars, env.paths.as_ref())
+            .unwrap()
+            .with_data(serde_json::json!({ "git": { "name": "Ada" }, "editor": "nvim" }));
+
+        let source = "{{ name }} {{ editor }} {{ email }} {{ data.git.name }} \
+                      {{ data.git.email }} {{ dodot.os }}";
+        assert_eq!(
+            pp.missing_variables(source),
+            vec!["data.git.email".to_string(), "email".to_string()]
+        );
+        // Guarded references alone render fine: nothing is missing.
+        assert!(pp
+            .missing_variables("{{ email | default('none') }}")
+            .is_empty());
+        // `editor` resolves through the data fallback when rendered.
+        assert!(pp.missing_variables("{{ editor }}").is_empty());
+    }
+
+    #[test]
+    fn inventory_names_each_source_and_the_broken_line() {
+        let env = crate::testing::TempEnvironment::builder().build();
+        let vars = HashMap::from([("name".to_string(), "Ada".to_string())]);
+        let pp = TemplatePreprocessor::new(vec!["tmpl".into()], vars, env.paths.as_ref())
+            .unwrap()
+            .with_data(
+                serde_json::json!({ "git": { "email": "ada@example.com" }, "editor": "nvim" }),
+            );
+
+        let source = "{{ name }} {{ editor }} {{ data.git.email }} {{ dodot.os }} \
+                      {{ env.PATH }} {{ secret('pass:x') }} {{ email }}";
+        let sources: Vec<(String, VarSource)> = pp
+            .inventory(source)
+            .variables
+            .into_iter()
+            .map(|v| (v.name, v.source))
+            .collect();
+        assert_eq!(
+            sources,
+            vec![
+                ("data.git.email".to_string(), VarSource::Data),
+                ("dodot.os".to_string(), VarSource::Dodot),
+                ("editor".to_string(), VarSource::Data),
+                ("email".to_string(), VarSource::Missing),
+                ("env.PATH".to_string(), VarSource::Env),
+                ("name".to_string(), VarSource::Vars),
+            ]
+        );
+
+        let guarded = pp.inventory("{{ email | default('none') }}");
+        assert_eq!(guarded.variables[0].source, VarSource::Optional);
+        assert_eq!(guarded.problem, None);
+
+        let broken = pp.inventory("line one\n{% if %}\n");
+        assert!(broken.variables.is_empty());
+        let problem = broken.problem.unwrap();
+        assert_eq!(problem.line, Some(2));
+        assert!(
+            problem.message.starts_with("syntax error"),
+            "{}",
+            problem.message
+        );
+    }
+
     #[test]
     fn syntax_error_reports_source_file() {
         let env = crate::testing::TempEnvironment::builder()
@@ -1151,6 +1471,32 @@ mod tests {
         assert_ne!(pp1.context_hash, pp2.context_hash);
     }
 
+    #[test]
+    fn renders_data_namespace_and_hashes_it() {
+        let env = crate::testing::TempEnvironment::builder()
+            .pack("git")
+            .file(
+                "gitconfig.tmpl",
+                "email={{ data.user.email }} remotes={{ data.remotes | join(\",\") }}",
+            )
+            .done()
+            .build();
+
+        let plain = new_pp(HashMap::new());
+        let pp = new_pp(HashMap::new()).with_data(serde_json::json!({
+            "user": { "email": "ada@example.com" },
+            "remotes": ["origin", "backup"],
+        }));
+        assert_ne!(plain.context_hash, pp.context_hash);
+
+        let source = env.dotfiles_root.join("git/gitconfig.tmpl");
+        let result = pp.expand(&source, env.fs.as_ref()).unwrap();
+        assert_eq!(
+            String::from_utf8_lossy(&result[0].content),
+            "email=ada@example.com remotes=origin,backup"
+        );
+    }
+
     #[test]
     fn context_hash_is_order_independent_for_user_vars() {
         // Hash inputs are gathered from a HashMap, so iteration order
@@ -173,9 +173,20 @@ pub fn format_deployment_map(entries: &[DeploymentMapEntry]) -> String {
         out.push_str(&format_row(e));
         out.push('\n');
     }
+    out.push_str(DEPLOYMENT_MAP_END);
+    out.push('\n');
     out
 }
 
+/// Trailer comment of every formatted map; its absence marks a file
+/// cut short mid-write.
+pub const DEPLOYMENT_MAP_END: &str = "# end of deployment map";
+
+/// Whether `content` is a complete deployment map.
+pub fn deployment_map_is_complete(content: &str) -> bool {
+    content.trim_end().ends_with(DEPLOYMENT_MAP_END)
+}
+
 fn format_row(e: &DeploymentMapEntry) -> String {
     format!(
         "{}\t{}\t{}\t{}\t{}",
@@ -194,7 +205,7 @@ pub fn write_deployment_map(fs: &dyn Fs, paths: &dyn Pather) -> Result<PathBuf>
     let content = format_deployment_map(&entries);
     let map_path = paths.deployment_map_path();
     fs.mkdir_all(paths.data_dir())?;
-    fs.write_file(&map_path, content.as_bytes())?;
+    fs.write_file_atomic(&map_path, content.as_bytes())?;
     Ok(map_path)
 }
 
@@ -464,20 +475,23 @@ vim\tshell\tsymlink\t/a\t/b
         ];
         let s = format_deployment_map(&entries);
         let lines: Vec<&str> = s.lines().collect();
-        assert_eq!(lines.len(), 4); // 2 comments + 2 data rows
+        assert_eq!(lines.len(), 5); // 2 comments + 2 data rows + trailer
         assert!(lines[0].starts_with('#'));
         assert!(lines[1].starts_with('#'));
         assert_eq!(lines[2], "vim\tshell\tsymlink\t/src/a\t/ds/a");
         assert_eq!(lines[3], "vim\tinstall\tfile\t\t/ds/sentinel");
+        assert_eq!(lines[4], DEPLOYMENT_MAP_END);
     }
 
     #[test]
     fn empty_input_produces_header_only() {
         let s = format_deployment_map(&[]);
         let lines: Vec<&str> = s.lines().collect();
-        assert_eq!(lines.len(), 2);
+        assert_eq!(lines.len(), 3);
         assert!(lines[0].starts_with("# dodot"));
         assert!(lines[1].starts_with("# columns"));
+        assert!(deployment_map_is_complete(&s));
+        assert!(!deployment_map_is_complete(&s[..s.len() - 10]));
     }
 
     #[test]
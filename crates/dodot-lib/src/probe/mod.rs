@@ -27,8 +27,8 @@ pub use cfprefsd_marker::{
 };
 pub use data_dir_tree::{collect_data_dir_tree, TreeNode};
 pub use deployment_map::{
-    collect_deployment_map, read_deployment_map, write_deployment_map, DeploymentKind,
-    DeploymentMapEntry,
+    collect_deployment_map, deployment_map_is_complete, read_deployment_map, write_deployment_map,
+    DeploymentKind, DeploymentMapEntry,
 };
 pub use last_up::{read_last_up_marker, write_last_up_marker};
 pub use shell_init::{
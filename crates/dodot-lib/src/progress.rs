@@ -0,0 +1,155 @@
+//! Live operation results for `--stream`.
+//!
+//! Commands collect every [`OperationResult`] and render them once the
+//! run is over, which for a long `up` (a slow `brew bundle`, a large
+//! download) means minutes with nothing on screen. The executor hands
+//! each result to [`report`] the moment its operation finishes; the CLI
+//! [`install`]s a [`ProgressSink`] that shows them as they come and
+//! calls [`finish`] before printing the usual report. With no sink
+//! installed, [`report`] is one atomic load.
+//!
+//! Dry runs don't report: nothing runs, so there is nothing to wait
+//! for. Packs may execute on several threads, so sinks are shared and
+//! events from different packs interleave.
+
+use std::sync::atomic::{AtomicBool, Ordering};
+use std::sync::{Arc, RwLock};
+
+use serde::Serialize;
+
+use crate::operations::OperationResult;
+
+/// One finished operation, as a sink sees it.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct ProgressEvent {
+    pub pack: String,
+    pub handler: String,
+    /// The operation's kind, e.g. `CreateUserLink`.
+    pub operation: &'static str,
+    pub success: bool,
+    pub message: String,
+}
+
+impl ProgressEvent {
+    pub fn from_result(result: &OperationResult) -> Self {
+        Self {
+            pack: result.operation.pack().to_string(),
+            handler: result.operation.handler().to_string(),
+            operation: result.operation.kind(),
+            success: result.success,
+            message: result.message.clone(),
+        }
+    }
+
+    /// The event as one line of NDJSON (no trailing newline), tagged
+    /// `"event": "operation"` so a reader can tell it from anything
+    /// added later.
+    pub fn to_json_line(&self) -> String {
+        #[derive(Serialize)]
+        struct Line<'a> {
+            event: &'static str,
+            #[serde(flatten)]
+            inner: &'a ProgressEvent,
+        }
+        serde_json::to_string(&Line {
+            event: "operation",
+            inner: self,
+        })
+        .expect("progress events always serialize")
+    }
+}
+
+/// Receives operations as they finish.
+pub trait ProgressSink: Send + Sync {
+    fn operation(&self, event: &ProgressEvent);
+
+    /// The run is over and the final report is about to print.
+    fn finish(&self) {}
+}
+
+static ACTIVE: AtomicBool = AtomicBool::new(false);
+static SINK: RwLock<Option<Arc<dyn ProgressSink>>> = RwLock::new(None);
+
+/// Send every operation from now on to `sink`, replacing any other.
+pub fn install(sink: Arc<dyn ProgressSink>) {
+    *SINK.write().unwrap() = Some(sink);
+    ACTIVE.store(true, Ordering::Relaxed);
+}
+
+/// Remove the installed sink, if any, and let it finish.
+pub fn finish() {
+    ACTIVE.store(false, Ordering::Relaxed);
+    let sink = SINK.write().unwrap().take();
+    if let Some(sink) = sink {
+        sink.finish();
+    }
+}
+
+/// Hand a finished operation to the installed sink.
+pub fn report(result: &OperationResult) {
+    if !ACTIVE.load(Ordering::Relaxed) {
+        return;
+    }
+    if let Some(sink) = SINK.read().unwrap().as_ref() {
+        sink.operation(&ProgressEvent::from_result(result));
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::operations::Operation;
+    use std::sync::Mutex;
+
+    #[derive(Default)]
+    struct Collect {
+        events: Mutex<Vec<ProgressEvent>>,
+        finished: AtomicBool,
+    }
+
+    impl ProgressSink for Collect {
+        fn operation(&self, event: &ProgressEvent) {
+            self.events.lock().unwrap().push(event.clone());
+        }
+
+        fn finish(&self) {
+            self.finished.store(true, Ordering::Relaxed);
+        }
+    }
+
+    #[test]
+    fn results_reach_the_sink_until_it_finishes() {
+        let result = |message: &str| {
+            OperationResult::ok(
+                Operation::CheckSentinel {
+                    pack: "progress-test".into(),
+                    handler: "install".into(),
+                    sentinel: "install.sh-0123".into(),
+                },
+                message,
+            )
+        };
+        let sink = Arc::new(Collect::default());
+        install(sink.clone());
+        report(&result("ran install.sh"));
+        finish();
+        report(&result("after finish"));
+
+        // Other tests may execute while the sink is installed; only
+        // look at this test's pack.
+        let events: Vec<ProgressEvent> = sink
+            .events
+            .lock()
+            .unwrap()
+            .iter()
+            .filter(|e| e.pack == "progress-test")
+            .cloned()
+            .collect();
+        assert_eq!(events.len(), 1);
+        assert!(sink.finished.load(Ordering::Relaxed));
+        assert_eq!(
+            events[0].to_json_line(),
+            r#"{"event":"operation","pack":"progress-test","handler":"install","operation":"CheckSentinel","success":true,"message":"ran install.sh"}"#
+        );
+    }
+}
@@ -0,0 +1,114 @@
+//! ASCII-only output (`--ascii`).
+//!
+//! dodot draws with a handful of non-ASCII glyphs: the handler symbols
+//! (`➞ ⚙ ×`), box-drawing trees, arrows, `✓` / `✗`, dashes and
+//! ellipses. A console without the font, a screen reader that spells
+//! each one out, or a log collector that mangles UTF-8 is better served
+//! by plain ASCII. With ASCII mode on, text output goes through
+//! [`plain`], which swaps each glyph for a stand-in of the same
+//! meaning; handler symbols switch to single-character stand-ins at the
+//! source so status columns stay aligned.
+//!
+//! Only the glyphs listed here change. File names and other user text
+//! in any script pass through as they are, and structured output
+//! (`--output json`) is never rewritten — the CLI turns the mode off
+//! for it.
+
+use std::borrow::Cow;
+use std::sync::atomic::{AtomicBool, Ordering};
+
+static ASCII_ONLY: AtomicBool = AtomicBool::new(false);
+
+/// Switch ASCII mode for the rest of the process. The CLI sets it from
+/// `--ascii` or `ascii = true` in `theme.toml`.
+pub fn set_ascii_only(on: bool) {
+    ASCII_ONLY.store(on, Ordering::Relaxed);
+}
+
+/// Whether ASCII mode is on.
+pub fn ascii_only() -> bool {
+    ASCII_ONLY.load(Ordering::Relaxed)
+}
+
+/// `text` for display: as is, or with dodot's glyphs replaced when
+/// ASCII mode is on.
+pub fn plain(text: &str) -> Cow<'_, str> {
+    if ascii_only() && !text.is_ascii() {
+        Cow::Owned(transliterate(text))
+    } else {
+        Cow::Borrowed(text)
+    }
+}
+
+/// A glyph that has to stay one character wide — a handler symbol, a
+/// progress mark — or its one-character stand-in in ASCII mode, so
+/// columns line up either way.
+pub fn symbol(glyph: &'static str) -> &'static str {
+    if !ascii_only() {
+        return glyph;
+    }
+    match glyph {
+        "➞" => ">",
+        "⚙" => "*",
+        "×" => "x",
+        "✓" => "v",
+        "✗" => "x",
+        "·" => ".",
+        "└" => "`",
+        other => other,
+    }
+}
+
+/// The ASCII stand-in for a glyph, or `None` to keep the character.
+fn stand_in(c: char) -> Option<&'static str> {
+    Some(match c {
+        '➞' | '→' => "->",
+        '←' => "<-",
+        '⚙' => "*",
+        '×' => "x",
+        '✓' => "ok",
+        '✗' => "!",
+        '·' => ".",
+        '—' | '–' => "-",
+        '…' => "...",
+        // Box drawing: `├─ ` becomes `|- `, `└─ ` becomes `` `- ``.
+        '─' => "-",
+        '│' | '├' => "|",
+        '└' => "`",
+        'µ' => "u",
+        _ => return None,
+    })
+}
+
+fn transliterate(text: &str) -> String {
+    let mut out = String::with_capacity(text.len());
+    for c in text.chars() {
+        match stand_in(c) {
+            Some(s) => out.push_str(s),
+            None => out.push(c),
+        }
+    }
+    out
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn glyphs_become_ascii_and_other_text_is_kept() {
+        assert_eq!(
+            transliterate("vimrc ➞ ~/.vimrc — ok"),
+            "vimrc -> ~/.vimrc - ok"
+        );
+        assert_eq!(
+            transliterate("│  ├─ nvim\n   └─ init.lua"),
+            "|  |- nvim\n   `- init.lua"
+        );
+        assert_eq!(
+            transliterate("~/…/telescope.lua 12 µs"),
+            "~/.../telescope.lua 12 us"
+        );
+        assert_eq!(transliterate("café/日本語"), "café/日本語");
+    }
+}
@@ -0,0 +1,260 @@
+//! Width-aware layout helpers for text output.
+//!
+//! Templates align columns with standout's `col(N)` filter, which pads
+//! short cells and cuts long ones at the end. That's the wrong end for
+//! a path — `~/.config/nvim/lua/plugins/tel…` hides the file name — and
+//! it does nothing for free text that runs past the terminal edge. The
+//! template environment belongs to standout-render, so these helpers
+//! run on the display data before it reaches a template: commands
+//! shorten paths and wrap notes here, and the template only pads.
+//!
+//! Widths are counted in characters, like `col(N)`.
+
+use std::sync::atomic::{AtomicUsize, Ordering};
+
+use super::glyphs;
+
+/// Width used when the terminal width is unknown (`COLUMNS` unset or
+/// not a number) — wide enough for typical paths, narrow enough for
+/// a split pane.
+pub const DEFAULT_WIDTH: usize = 100;
+
+/// Marks elided text: `…`, or `...` in ASCII mode (see
+/// [`glyphs`]), counted against the width like any other text.
+fn ellipsis() -> &'static str {
+    if glyphs::ascii_only() {
+        "..."
+    } else {
+        "…"
+    }
+}
+
+/// Best-effort terminal width, read from `COLUMNS`. Shells export it
+/// for interactive sessions; pipes and CI fall back to
+/// [`DEFAULT_WIDTH`].
+pub fn terminal_width() -> usize {
+    std::env::var("COLUMNS")
+        .ok()
+        .and_then(|v| v.trim().parse::<usize>().ok())
+        .filter(|w| *w > 0)
+        .unwrap_or(DEFAULT_WIDTH)
+}
+
+/// Width text output is fitted to; 0 while unset.
+static OUTPUT_WIDTH: AtomicUsize = AtomicUsize::new(0);
+
+/// Record the width the current command's output is fitted to: the
+/// terminal width for text output, `None` for structured output
+/// (JSON), which keeps every string whole. The CLI sets it once the
+/// output mode is known.
+pub fn set_output_width(width: Option<usize>) {
+    OUTPUT_WIDTH.store(width.unwrap_or(0), Ordering::Relaxed);
+}
+
+/// The width set by [`set_output_width`], if output is to be fitted.
+pub fn output_width() -> Option<usize> {
+    Some(OUTPUT_WIDTH.load(Ordering::Relaxed)).filter(|w| *w > 0)
+}
+
+/// Display width of `s`, in characters.
+pub fn text_width(s: &str) -> usize {
+    s.chars().count()
+}
+
+/// Shorten `s` to at most `width` characters, marking the cut at the
+/// end with `…`.
+pub fn truncate_end(s: &str, width: usize) -> String {
+    if text_width(s) <= width {
+        return s.to_string();
+    }
+    let mark = ellipsis();
+    if width < text_width(mark) {
+        return s.chars().take(width).collect();
+    }
+    let mut out: String = s.chars().take(width - text_width(mark)).collect();
+    out.push_str(mark);
+    out
+}
+
+/// Shorten `s` to at most `width` characters, marking the cut at the
+/// start with `…`.
+pub fn truncate_start(s: &str, width: usize) -> String {
+    let len = text_width(s);
+    if len <= width {
+        return s.to_string();
+    }
+    let mark = ellipsis();
+    if width < text_width(mark) {
+        return s.chars().skip(len - width).collect();
+    }
+    let mut out = String::from(mark);
+    out.extend(s.chars().skip(len - (width - text_width(mark))));
+    out
+}
+
+/// Shorten a path to at most `width` characters by dropping whole
+/// components from the middle: `~/dotfiles/vim/.config/nvim/init.lua`
+/// becomes `~/dotfiles/…/nvim/init.lua`. The first and last components
+/// are always kept; when even `first/…/last` is too wide, the path is
+/// cut from the start so the file name survives.
+pub fn truncate_middle(path: &str, width: usize) -> String {
+    if text_width(path) <= width {
+        return path.to_string();
+    }
+    let parts: Vec<&str> = path.split('/').collect();
+    if parts.len() < 3 {
+        return truncate_start(path, width);
+    }
+
+    // Keep parts[..=head] and parts[tail..]; at least one part between
+    // them is replaced by the ellipsis.
+    let mark = ellipsis();
+    let joined = |head: usize, tail: usize| {
+        format!(
+            "{}/{mark}/{}",
+            parts[..=head].join("/"),
+            parts[tail..].join("/")
+        )
+    };
+    let fits = |head: usize, tail: usize| text_width(&joined(head, tail)) <= width;
+
+    let (mut head, mut tail) = (0, parts.len() - 1);
+    if !fits(head, tail) {
+        return truncate_start(path, width);
+    }
+    // Grow from both ends in turn, so the result keeps context on
+    // either side of the cut.
+    loop {
+        let mut grew = false;
+        if head + 2 < tail && fits(head + 1, tail) {
+            head += 1;
+            grew = true;
+        }
+        if head + 2 < tail && fits(head, tail - 1) {
+            tail -= 1;
+            grew = true;
+        }
+        if !grew {
+            break;
+        }
+    }
+    joined(head, tail)
+}
+
+/// Break `text` into lines of at most `width` characters at spaces.
+/// Existing line breaks are kept, and lines that already fit are left
+/// as they are (indentation included); a single word wider than
+/// `width` gets a line of its own rather than being split.
+pub fn wrap(text: &str, width: usize) -> Vec<String> {
+    let width = width.max(1);
+    let mut lines = Vec::new();
+    for source in text.lines() {
+        if text_width(source) <= width {
+            lines.push(source.to_string());
+            continue;
+        }
+        let mut line = String::new();
+        for word in source.split(' ').filter(|w| !w.is_empty()) {
+            if !line.is_empty() && text_width(&line) + 1 + text_width(word) > width {
+                lines.push(std::mem::take(&mut line));
+            }
+            if !line.is_empty() {
+                line.push(' ');
+            }
+            line.push_str(word);
+        }
+        lines.push(line);
+    }
+    lines
+}
+
+/// [`wrap`] `text` for a slot that starts `indent` characters in, and
+/// join the lines so continuations line up under the first.
+pub fn wrap_hanging(text: &str, width: usize, indent: usize) -> String {
+    let separator = format!("\n{}", " ".repeat(indent));
+    wrap(text, width.saturating_sub(indent)).join(&separator)
+}
+
+/// Widest of `header` and every cell, in characters: the natural width
+/// of a column.
+pub fn column_width<'a>(header: &str, cells: impl Iterator<Item = &'a str>) -> usize {
+    cells
+        .map(text_width)
+        .chain(std::iter::once(text_width(header)))
+        .max()
+        .unwrap_or(0)
+}
+
+/// Take `overflow` characters out of `columns`, in order, never
+/// squeezing one below `min`. Returns what couldn't be taken (the
+/// terminal wraps that much).
+pub fn shrink_columns(columns: &mut [&mut usize], mut overflow: usize, min: usize) -> usize {
+    for col in columns.iter_mut() {
+        if overflow == 0 {
+            break;
+        }
+        let cut = col.saturating_sub(min).min(overflow);
+        **col -= cut;
+        overflow -= cut;
+    }
+    overflow
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn paths_lose_their_middle_not_their_file_name() {
+        let path = "~/dotfiles/vim/.config/nvim/lua/plugins/telescope.lua";
+        assert_eq!(truncate_middle(path, 80), path);
+
+        assert_eq!(
+            truncate_middle(path, 40),
+            "~/dotfiles/vim/…/plugins/telescope.lua"
+        );
+        assert_eq!(truncate_middle(path, 30), "~/dotfiles/vim/…/telescope.lua");
+        assert_eq!(truncate_middle(path, 24), "~/…/telescope.lua");
+
+        // Not even `first/…/last` fits: keep the end of the file name.
+        assert_eq!(truncate_middle(path, 8), "…ope.lua");
+        assert_eq!(truncate_middle("/a-very-long-file-name", 8), "…le-name");
+    }
+
+    #[test]
+    fn ends_are_cut_with_an_ellipsis() {
+        assert_eq!(truncate_end("installed", 5), "inst…");
+        assert_eq!(truncate_end("ok", 5), "ok");
+        assert_eq!(truncate_start("installed", 5), "…lled");
+        assert_eq!(truncate_end("x", 0), "");
+    }
+
+    #[test]
+    fn wrapping_breaks_at_spaces_and_keeps_line_breaks() {
+        assert_eq!(
+            wrap("the quick brown fox jumps", 10),
+            ["the quick", "brown fox", "jumps"]
+        );
+        assert_eq!(wrap("a\n  b  c", 10), ["a", "  b  c"]);
+        assert_eq!(
+            wrap("supercalifragilistic is long", 8)[0],
+            "supercalifragilistic"
+        );
+        assert_eq!(
+            wrap_hanging("one two three four", 12, 4),
+            "one two\n    three\n    four"
+        );
+    }
+
+    #[test]
+    fn columns_shrink_in_order_down_to_the_minimum() {
+        let (mut a, mut b) = (20, 15);
+        let left = shrink_columns(&mut [&mut a, &mut b], 10, 12);
+        assert_eq!((a, b, left), (12, 13, 0));
+
+        let left = shrink_columns(&mut [&mut a, &mut b], 10, 12);
+        assert_eq!((a, b, left), (12, 12, 9));
+
+        assert_eq!(column_width("FILE", ["vimrc", "ab"].into_iter()), 5);
+    }
+}
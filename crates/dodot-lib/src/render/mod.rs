@@ -8,123 +8,11 @@ use standout_render::{render_with_output, OutputMode, Renderer, Theme};
 
 use crate::Result;
 
-/// The dodot colour theme, defined in YAML for readability.
-///
-/// Style names are semantic — templates reference them by name,
-/// and the theme adapts to terminal capabilities automatically.
-const THEME_YAML: &str = r#"
-pack-name:
-  bold: true
-  fg: blue
+pub mod glyphs;
+pub mod layout;
+mod theme;
 
-filename:
-  fg: white
-
-handler-symbol:
-  bold: true
-  fg: yellow
-
-description:
-  dim: true
-
-deployed:
-  fg: green
-
-pending:
-  fg: magenta
-
-error:
-  fg: red
-  bold: true
-
-broken:
-  fg: red
-
-stale:
-  fg: yellow
-
-skipped:
-  dim: true
-
-warning:
-  fg: yellow
-
-message:
-  fg: cyan
-
-dim:
-  dim: true
-
-header:
-  bold: true
-
-dry-run:
-  fg: yellow
-  italic: true
-
-conflict-banner:
-  fg: white
-  bg: red
-  bold: true
-
-conflict-header:
-  fg: white
-  bg: red
-  bold: true
-
-conflict-target:
-  fg: red
-  bold: true
-
-conflict-pack:
-  fg: red
-
-conflict-hint:
-  dim: true
-
-ignored-pack:
-  dim: true
-  italic: true
-
-group-banner-deployed:
-  fg: green
-  bold: true
-
-group-banner-pending:
-  fg: yellow
-  bold: true
-
-group-banner-error:
-  fg: red
-  bold: true
-
-group-banner-ignored:
-  dim: true
-  bold: true
-
-# Tutorial prompt question text. The interactive `dodot tutorial`
-# uses inquire for the prompt UI; this style is mirrored by hand into
-# its `RenderConfig` (see `tutorial.rs::tutorial_render_config`). Keep
-# attributes here in sync with that function so users have one place
-# to change the look.
-tutorial-prompt:
-  italic: true
-
-# CLI help tags. The hand-written --help text in `dodot-cli/src/help/`
-# uses these alongside the semantic tags above. Mirror standout's
-# default help theme so the look matches the rest of dodot's output:
-#   item    — bold (command names, option flags)
-#   desc    — plain (descriptions next to items)
-#   usage   — plain (the usage line)
-#   example — plain (example blocks)
-#   about   — plain (intro / about text)
-item:
-  bold: true
-desc: {}
-usage: {}
-example: {}
-about: {}
-"#;
+pub use theme::{active_theme, set_active_theme, ThemeSelection, THEME_PRESETS};
 
 // ── Templates ───────────────────────────────────────────────────
 
@@ -161,6 +49,13 @@ pub const TEMPLATE_TRANSFORM_CHECK: &str = include_str!("../templates/transform-
 pub const TEMPLATE_TRANSFORM_INSTALL_HOOK: &str =
     include_str!("../templates/transform-install-hook.jinja");
 
+/// `dodot plan` changes grouped by pack.
+pub const TEMPLATE_PLAN: &str = include_str!("../templates/plan.jinja");
+
+/// `dodot preview` home-directory tree with create / replace /
+/// conflict markers.
+pub const TEMPLATE_PREVIEW: &str = include_str!("../templates/preview.jinja");
+
 /// `dodot refresh` per-mode output (default report / quiet / list-paths).
 pub const TEMPLATE_REFRESH: &str = include_str!("../templates/refresh.jinja");
 
@@ -168,6 +63,10 @@ pub const TEMPLATE_REFRESH: &str = include_str!("../templates/refresh.jinja");
 pub const TEMPLATE_TEMPLATE_INSTALL_FILTER: &str =
     include_str!("../templates/template-install-filter.jinja");
 
+/// `dodot template check` per-template findings and variable
+/// inventory.
+pub const TEMPLATE_TEMPLATE_CHECK: &str = include_str!("../templates/template-check.jinja");
+
 /// `dodot transform status` per-file state list.
 pub const TEMPLATE_TRANSFORM_STATUS: &str = include_str!("../templates/transform-status.jinja");
 
@@ -254,14 +153,18 @@ pub fn render_tutorial_step<T: serde::Serialize>(
 
     let theme = create_theme();
     render_with_output(body, data, &theme, mode)
+        .map(|text| glyphs::plain(&text).into_owned())
         .map_err(|e| crate::DodotError::Other(format!("tutorial render: {e}")))
 }
 
 // ── Renderer ────────────────────────────────────────────────────
 
-/// Create the dodot theme from the embedded YAML definition.
+/// Create the dodot theme: the built-in styles with the active preset
+/// and user overrides (see [`set_active_theme`]) merged on top.
 pub fn create_theme() -> Theme {
-    Theme::from_yaml(THEME_YAML).expect("built-in theme YAML must be valid")
+    active_theme()
+        .build()
+        .expect("active theme is validated when it is set")
 }
 
 /// Create a pre-compiled renderer with all dodot templates registered.
@@ -313,6 +216,7 @@ pub fn render<T: serde::Serialize>(
     };
 
     render_with_output(template, data, &theme, mode)
+        .map(|text| glyphs::plain(&text).into_owned())
         .map_err(|e| crate::DodotError::Other(format!("render failed: {e}")))
 }
 
@@ -0,0 +1,471 @@
+//! Theme presets and user style overrides.
+//!
+//! The built-in styles ([`BASE_STYLES`]) are the registry every
+//! template tag resolves against. On top of them sit, in order:
+//!
+//! 1. a preset (`dark`, `light`, `solarized`, `accessible`) — a colour
+//!    overlay that only touches the styles it names;
+//! 2. the user's overrides from `<config_dir>/theme.toml`
+//!    (`~/.config/dodot/theme.toml`).
+//!
+//! Overlays merge per attribute: overriding `error = { fg = "magenta" }`
+//! keeps the base style's `bold`. A style name that isn't in the base
+//! registry is an error rather than a silently unused entry, so a typo
+//! doesn't look like a theme that "doesn't work".
+//!
+//! Colour is never the only signal: every state a template colours is
+//! also spelled out (`deployed`, `error`, …) or marked (`+`, `~`, `!`).
+//! The `accessible` preset builds on that with a palette that stays
+//! apart under the common colour-vision deficiencies, and underlines
+//! the error states so they stand out even in monochrome.
+//!
+//! The selection is process-wide ([`set_active_theme`]) so the
+//! command output, the help screens and the tutorial all render with
+//! the same styles.
+
+use std::sync::OnceLock;
+
+use serde_json::{Map, Value};
+use standout_render::Theme;
+
+use crate::fs::Fs;
+use crate::paths::Pather;
+use crate::{DodotError, Result};
+
+/// Selectable presets, in the order `--theme` lists them. `default`
+/// is the base registry with no overlay.
+pub const THEME_PRESETS: &[&str] = &["default", "dark", "light", "solarized", "accessible"];
+
+/// The dodot styles. Style names are semantic — templates reference
+/// them by name, and the theme adapts to terminal capabilities
+/// automatically.
+const BASE_STYLES: &str = r##"
+[pack-name]
+bold = true
+fg = "blue"
+
+[filename]
+fg = "white"
+
+[handler-symbol]
+bold = true
+fg = "yellow"
+
+[description]
+dim = true
+
+[deployed]
+fg = "green"
+
+[pending]
+fg = "magenta"
+
+[error]
+fg = "red"
+bold = true
+
+[broken]
+fg = "red"
+
+[stale]
+fg = "yellow"
+
+[degraded]
+fg = "yellow"
+bold = true
+
+[skipped]
+dim = true
+
+[warning]
+fg = "yellow"
+
+[message]
+fg = "cyan"
+
+[dim]
+dim = true
+
+[header]
+bold = true
+
+[dry-run]
+fg = "yellow"
+italic = true
+
+[conflict-banner]
+fg = "white"
+bg = "red"
+bold = true
+
+[conflict-header]
+fg = "white"
+bg = "red"
+bold = true
+
+[conflict-target]
+fg = "red"
+bold = true
+
+[conflict-pack]
+fg = "red"
+
+[conflict-hint]
+dim = true
+
+[ignored-pack]
+dim = true
+italic = true
+
+[group-banner-deployed]
+fg = "green"
+bold = true
+
+[group-banner-pending]
+fg = "yellow"
+bold = true
+
+[group-banner-degraded]
+fg = "yellow"
+bold = true
+
+[group-banner-error]
+fg = "red"
+bold = true
+
+[group-banner-ignored]
+dim = true
+bold = true
+
+# Tutorial prompt question text. The interactive `dodot tutorial`
+# uses inquire for the prompt UI; this style is mirrored by hand into
+# its `RenderConfig` (see `tutorial.rs::tutorial_render_config`). Keep
+# attributes here in sync with that function so users have one place
+# to change the look.
+[tutorial-prompt]
+italic = true
+
+# CLI help tags. The hand-written --help text in `dodot-cli/src/help/`
+# uses these alongside the semantic tags above. Mirror standout's
+# default help theme so the look matches the rest of dodot's output:
+#   item    — bold (command names, option flags)
+#   desc    — plain (descriptions next to items)
+#   usage   — plain (the usage line)
+#   example — plain (example blocks)
+#   about   — plain (intro / about text)
+[item]
+bold = true
+
+[desc]
+[usage]
+[example]
+[about]
+"##;
+
+/// Bright variants that stay legible on dark backgrounds. Same
+/// palette as the dark half of the CLI's adaptive stylesheet.
+const PRESET_DARK: &str = r##"
+pack-name = { fg = "#FFFFFF" }
+handler-symbol = { fg = "#AAAAAA" }
+deployed = { fg = "#5FD75F" }
+pending = { fg = "#FFFFFF", bg = "#303030" }
+error = { fg = "#FF5F5F" }
+broken = { fg = "#FF5F5F" }
+stale = { fg = "#FFD75F" }
+warning = { fg = "#FFD75F" }
+degraded = { fg = "#FFAF5F" }
+message = { fg = "#5FAFD7" }
+dry-run = { fg = "#FFD75F" }
+conflict-target = { fg = "#FF5F5F" }
+conflict-pack = { fg = "#FF5F5F" }
+group-banner-deployed = { fg = "#5FD75F" }
+group-banner-pending = { fg = "#FFD75F" }
+group-banner-degraded = { fg = "#FFAF5F" }
+group-banner-error = { fg = "#FF5F5F" }
+"##;
+
+/// Darker variants for light backgrounds, where the base `white` and
+/// `yellow` wash out.
+const PRESET_LIGHT: &str = r##"
+pack-name = { fg = "#000000" }
+filename = { fg = "#303030" }
+handler-symbol = { fg = "#999999" }
+deployed = { fg = "#008700" }
+pending = { fg = "#000000", bg = "#F8F8F8" }
+error = { fg = "#D70000" }
+broken = { fg = "#D70000" }
+stale = { fg = "#AF8700" }
+warning = { fg = "#AF8700" }
+degraded = { fg = "#D75F00" }
+message = { fg = "#005F87" }
+dry-run = { fg = "#AF8700" }
+conflict-target = { fg = "#D70000" }
+conflict-pack = { fg = "#D70000" }
+group-banner-deployed = { fg = "#008700" }
+group-banner-pending = { fg = "#AF8700" }
+group-banner-degraded = { fg = "#D75F00" }
+group-banner-error = { fg = "#D70000" }
+"##;
+
+/// The Solarized accent colours; works on either Solarized background.
+const PRESET_SOLARIZED: &str = r##"
+pack-name = { fg = "#268BD2" }
+filename = { fg = "#839496" }
+handler-symbol = { fg = "#B58900" }
+deployed = { fg = "#859900" }
+pending = { fg = "#D33682" }
+error = { fg = "#DC322F" }
+broken = { fg = "#DC322F" }
+stale = { fg = "#B58900" }
+warning = { fg = "#CB4B16" }
+degraded = { fg = "#CB4B16" }
+message = { fg = "#2AA198" }
+dry-run = { fg = "#6C71C4" }
+conflict-banner = { fg = "#FDF6E3", bg = "#DC322F" }
+conflict-header = { fg = "#FDF6E3", bg = "#DC322F" }
+conflict-target = { fg = "#DC322F" }
+conflict-pack = { fg = "#DC322F" }
+group-banner-deployed = { fg = "#859900" }
+group-banner-pending = { fg = "#B58900" }
+group-banner-degraded = { fg = "#CB4B16" }
+group-banner-error = { fg = "#DC322F" }
+"##;
+
+/// The Okabe-Ito palette, distinguishable with protanopia,
+/// deuteranopia and tritanopia: blue for success rather than green,
+/// vermillion and orange kept apart by brightness, and error states
+/// underlined as well as coloured.
+const PRESET_ACCESSIBLE: &str = r##"
+pack-name = { fg = "#56B4E9" }
+handler-symbol = { fg = "#E69F00" }
+deployed = { fg = "#0072B2" }
+pending = { fg = "#CC79A7" }
+error = { fg = "#D55E00", underline = true }
+broken = { fg = "#D55E00", underline = true }
+stale = { fg = "#E69F00" }
+warning = { fg = "#E69F00" }
+degraded = { fg = "#E69F00", underline = true }
+message = { fg = "#56B4E9" }
+dry-run = { fg = "#CC79A7" }
+conflict-banner = { fg = "#FFFFFF", bg = "#D55E00" }
+conflict-header = { fg = "#FFFFFF", bg = "#D55E00" }
+conflict-target = { fg = "#D55E00", underline = true }
+conflict-pack = { fg = "#D55E00" }
+group-banner-deployed = { fg = "#0072B2" }
+group-banner-pending = { fg = "#CC79A7" }
+group-banner-degraded = { fg = "#E69F00", underline = true }
+group-banner-error = { fg = "#D55E00", underline = true }
+"##;
+
+/// A preset plus per-style overrides: everything needed to build the
+/// theme. `Default` is the base registry, untouched.
+#[derive(Debug, Clone, Default, PartialEq)]
+pub struct ThemeSelection {
+    /// One of [`THEME_PRESETS`]; `None` means `default`.
+    pub preset: Option<String>,
+    /// Style name → attribute table, merged over the preset.
+    pub styles: Map<String, Value>,
+    /// Plain ASCII instead of dodot's glyphs (see
+    /// [`super::glyphs`]). Doesn't change the styles.
+    pub ascii: bool,
+}
+
+impl ThemeSelection {
+    /// Read `<config_dir>/theme.toml`. A missing file is the default
+    /// selection.
+    ///
+    /// ```toml
+    /// preset = "solarized"
+    /// ascii = true
+    ///
+    /// [styles]
+    /// error = { fg = "magenta" }
+    /// pack-name = { fg = "#ff8700", underline = true }
+    /// ```
+    pub fn load(fs: &dyn Fs, pather: &dyn Pather) -> Result<Self> {
+        let path = pather.host_theme_path();
+        if !fs.exists(&path) {
+            return Ok(Self::default());
+        }
+        let text = fs.read_to_string(&path)?;
+        let theme_error = |msg: String| DodotError::Config(format!("{}: {msg}", path.display()));
+        let parsed: Value = toml::from_str(&text).map_err(|e| theme_error(e.to_string()))?;
+
+        let mut selection = Self::default();
+        for (key, value) in parsed.as_object().cloned().unwrap_or_default() {
+            match (key.as_str(), value) {
+                ("preset", Value::String(name)) => selection.preset = Some(name),
+                ("styles", Value::Object(styles)) => selection.styles = styles,
+                ("ascii", Value::Bool(ascii)) => selection.ascii = ascii,
+                ("preset" | "styles" | "ascii", _) => {
+                    return Err(theme_error(format!("`{key}` has the wrong type")))
+                }
+                (other, _) => {
+                    return Err(theme_error(format!(
+                        "unknown key `{other}` (expected `preset`, `styles` or `ascii`)"
+                    )))
+                }
+            }
+        }
+        Ok(selection)
+    }
+
+    /// `true` when nothing would change the base registry. `ascii`
+    /// doesn't count: it changes glyphs, not styles.
+    pub fn is_default(&self) -> bool {
+        matches!(self.preset.as_deref(), None | Some("default")) && self.styles.is_empty()
+    }
+
+    /// Merge base, preset and overrides and build the theme.
+    pub fn build(&self) -> Result<Theme> {
+        let mut styles = parse_styles(BASE_STYLES);
+        let preset = match self.preset.as_deref().unwrap_or("default") {
+            "default" => None,
+            "dark" => Some(PRESET_DARK),
+            "light" => Some(PRESET_LIGHT),
+            "solarized" => Some(PRESET_SOLARIZED),
+            "accessible" => Some(PRESET_ACCESSIBLE),
+            other => {
+                return Err(DodotError::Config(format!(
+                    "unknown theme `{other}` (expected one of: {})",
+                    THEME_PRESETS.join(", ")
+                )))
+            }
+        };
+        if let Some(preset) = preset {
+            merge_styles(&mut styles, parse_styles(preset))?;
+        }
+        merge_styles(&mut styles, self.styles.clone())?;
+
+        // The theme loader reads YAML; JSON is a subset of it, which
+        // saves hand-rolling a YAML emitter for a two-level mapping.
+        let document = Value::Object(styles).to_string();
+        Theme::from_yaml(&document).map_err(|e| DodotError::Config(format!("theme: {e}")))
+    }
+}
+
+fn parse_styles(toml_text: &str) -> Map<String, Value> {
+    match toml::from_str(toml_text).expect("built-in theme TOML must be valid") {
+        Value::Object(map) => map,
+        _ => unreachable!("TOML documents are tables"),
+    }
+}
+
+/// Merge `overlay` into `base` one attribute at a time.
+fn merge_styles(base: &mut Map<String, Value>, overlay: Map<String, Value>) -> Result<()> {
+    for (name, attrs) in overlay {
+        let Some(Value::Object(target)) = base.get_mut(&name) else {
+            return Err(DodotError::Config(format!("theme: unknown style `{name}`")));
+        };
+        let Value::Object(attrs) = attrs else {
+            return Err(DodotError::Config(format!(
+                "theme: style `{name}` must be a table of attributes"
+            )));
+        };
+        target.extend(attrs);
+    }
+    Ok(())
+}
+
+static ACTIVE: OnceLock<ThemeSelection> = OnceLock::new();
+
+/// Make `selection` the theme every later render uses. Validates it
+/// first, so a bad selection is reported here rather than at the first
+/// render. Only the first successful call takes effect.
+pub fn set_active_theme(selection: ThemeSelection) -> Result<()> {
+    selection.build()?;
+    let _ = ACTIVE.set(selection);
+    Ok(())
+}
+
+/// The selection set by [`set_active_theme`], or the default.
+pub fn active_theme() -> ThemeSelection {
+    ACTIVE.get().cloned().unwrap_or_default()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::testing::TempEnvironment;
+
+    #[test]
+    fn every_preset_builds() {
+        for preset in THEME_PRESETS {
+            let selection = ThemeSelection {
+                preset: Some(preset.to_string()),
+                ..Default::default()
+            };
+            selection
+                .build()
+                .unwrap_or_else(|e| panic!("{preset}: {e}"));
+        }
+    }
+
+    #[test]
+    fn presets_only_name_base_styles() {
+        let base = parse_styles(BASE_STYLES);
+        for preset in [
+            PRESET_DARK,
+            PRESET_LIGHT,
+            PRESET_SOLARIZED,
+            PRESET_ACCESSIBLE,
+        ] {
+            for name in parse_styles(preset).keys() {
+                assert!(base.contains_key(name), "preset names unknown style {name}");
+            }
+        }
+    }
+
+    #[test]
+    fn overrides_merge_per_attribute() {
+        let mut styles = parse_styles(BASE_STYLES);
+        let overlay = parse_styles("error = { fg = \"magenta\" }");
+        merge_styles(&mut styles, overlay).unwrap();
+        assert_eq!(styles["error"]["fg"], "magenta");
+        assert_eq!(styles["error"]["bold"], true);
+    }
+
+    #[test]
+    fn unknown_style_and_preset_are_rejected() {
+        let mut selection = ThemeSelection::default();
+        selection
+            .styles
+            .insert("eror".into(), serde_json::json!({ "fg": "red" }));
+        let err = selection.build().err().unwrap();
+        assert!(err.to_string().contains("eror"), "{err}");
+
+        let selection = ThemeSelection {
+            preset: Some("neon".into()),
+            ..Default::default()
+        };
+        let err = selection.build().err().unwrap();
+        assert!(err.to_string().contains("solarized"), "{err}");
+    }
+
+    #[test]
+    fn loads_preset_and_styles_from_config_dir() {
+        let env = TempEnvironment::builder().build();
+        let path = env.paths.host_theme_path();
+        env.fs.mkdir_all(path.parent().unwrap()).unwrap();
+        env.fs
+            .write_file(
+                &path,
+                b"preset = \"light\"\nascii = true\n\n[styles]\nerror = { fg = \"magenta\" }\n",
+            )
+            .unwrap();
+
+        let selection = ThemeSelection::load(env.fs.as_ref(), env.paths.as_ref()).unwrap();
+        assert_eq!(selection.preset.as_deref(), Some("light"));
+        assert!(selection.ascii);
+        assert_eq!(selection.styles["error"]["fg"], "magenta");
+        assert!(!selection.is_default());
+        selection.build().unwrap();
+    }
+
+    #[test]
+    fn missing_config_is_default() {
+        let env = TempEnvironment::builder().build();
+        let selection = ThemeSelection::load(env.fs.as_ref(), env.paths.as_ref()).unwrap();
+        assert!(selection.is_default());
+    }
+}
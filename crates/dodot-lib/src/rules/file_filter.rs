@@ -0,0 +1,171 @@
+//! `--only` / `--skip`: deploy a subset of a pack's matched files.
+//!
+//! The filter runs after rule matching, so every handler sees the same
+//! narrowed set and nothing about which handler claims a file changes.
+//! An excluded match is handed to the `skip` filter handler with the
+//! flag that excluded it recorded under [`FILTERED_BY`], which is how
+//! `status` tells it apart from a `mappings.skip` entry.
+//!
+//! A pattern is a glob over the pack-relative path (`nvim/init.lua`);
+//! `*` doesn't cross `/`. A pattern that matches a directory covers
+//! everything under it, a trailing `/` makes it match directories
+//! only, and a pattern without a `/` is also tried against each path
+//! segment, so `*.bak` catches `nvim/old.bak`. `--skip` wins over
+//! `--only`.
+
+use glob::{MatchOptions, Pattern};
+
+use crate::handlers::{HANDLER_GATE, HANDLER_IGNORE, HANDLER_SKIP};
+use crate::rules::RuleMatch;
+use crate::{DodotError, Result};
+
+/// Option key on an excluded match: the flag that excluded it
+/// (`--only` or `--skip`).
+pub const FILTERED_BY: &str = "filtered_by";
+
+const OPTIONS: MatchOptions = MatchOptions {
+    case_sensitive: true,
+    require_literal_separator: true,
+    require_literal_leading_dot: false,
+};
+
+#[derive(Debug, Clone)]
+struct FilterPattern {
+    glob: Pattern,
+    dir_only: bool,
+    anchored: bool,
+}
+
+impl FilterPattern {
+    fn new(flag: &str, raw: &str) -> Result<Self> {
+        let trimmed = raw.trim_end_matches('/');
+        if trimmed.is_empty() {
+            return Err(DodotError::Config(format!("{flag} `{raw}`: empty pattern")));
+        }
+        let glob = Pattern::new(trimmed)
+            .map_err(|e| DodotError::Config(format!("{flag} `{raw}`: {e}")))?;
+        Ok(Self {
+            glob,
+            dir_only: trimmed.len() < raw.len(),
+            anchored: trimmed.contains('/'),
+        })
+    }
+
+    /// Whether the pattern matches `path` or one of its leading
+    /// directories.
+    fn covers(&self, path: &str, is_dir: bool) -> bool {
+        let segments: Vec<&str> = path.split('/').collect();
+        (1..=segments.len()).any(|n| {
+            let candidate_is_dir = n < segments.len() || is_dir;
+            if self.dir_only && !candidate_is_dir {
+                return false;
+            }
+            let candidate = segments[..n].join("/");
+            self.glob.matches_with(&candidate, OPTIONS)
+                || (!self.anchored && self.glob.matches_with(segments[n - 1], OPTIONS))
+        })
+    }
+}
+
+/// The `--only` and `--skip` patterns of one invocation. The default
+/// filter lets everything through.
+#[derive(Debug, Clone, Default)]
+pub struct FileFilter {
+    only: Vec<FilterPattern>,
+    skip: Vec<FilterPattern>,
+}
+
+impl FileFilter {
+    /// Compile the patterns. An invalid glob is a config error rather
+    /// than a pattern that silently matches nothing.
+    pub fn new(only: &[String], skip: &[String]) -> Result<Self> {
+        let compile = |flag: &str, raw: &[String]| -> Result<Vec<FilterPattern>> {
+            raw.iter().map(|p| FilterPattern::new(flag, p)).collect()
+        };
+        Ok(Self {
+            only: compile("--only", only)?,
+            skip: compile("--skip", skip)?,
+        })
+    }
+
+    /// Whether any pattern was given.
+    pub fn is_active(&self) -> bool {
+        !self.only.is_empty() || !self.skip.is_empty()
+    }
+
+    /// The flag that leaves out the file at pack-relative `path`, or
+    /// `None` when it's deployed.
+    pub fn excludes(&self, path: &str, is_dir: bool) -> Option<&'static str> {
+        if self.skip.iter().any(|p| p.covers(path, is_dir)) {
+            Some("--skip")
+        } else if !self.only.is_empty() && !self.only.iter().any(|p| p.covers(path, is_dir)) {
+            Some("--only")
+        } else {
+            None
+        }
+    }
+
+    /// Hand every excluded match to the `skip` handler. Matches a
+    /// filter handler already claimed (ignored, skipped, gated out)
+    /// keep their handler.
+    pub fn apply(&self, matches: &mut [RuleMatch]) {
+        if !self.is_active() {
+            return;
+        }
+        for m in matches.iter_mut() {
+            if [HANDLER_IGNORE, HANDLER_SKIP, HANDLER_GATE].contains(&m.handler.as_str()) {
+                continue;
+            }
+            let path = crate::gates::rel_path_for_glob(&m.relative_path);
+            if let Some(flag) = self.excludes(&path, m.is_dir) {
+                m.handler = HANDLER_SKIP.into();
+                m.options.clear();
+                m.options.insert(FILTERED_BY.into(), flag.into());
+            }
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn filter(only: &[&str], skip: &[&str]) -> FileFilter {
+        let owned = |v: &[&str]| v.iter().map(|s| s.to_string()).collect::<Vec<_>>();
+        FileFilter::new(&owned(only), &owned(skip)).unwrap()
+    }
+
+    #[test]
+    fn only_keeps_matching_files_and_skip_wins() {
+        let f = filter(&[".vimrc", ".vim/"], &[".vim/swap"]);
+        assert_eq!(f.excludes(".vimrc", false), None);
+        assert_eq!(f.excludes(".vim/colors/dark.vim", false), None);
+        assert_eq!(f.excludes(".vim", true), None);
+        assert_eq!(f.excludes(".vim/swap/x", false), Some("--skip"));
+        assert_eq!(f.excludes(".gvimrc", false), Some("--only"));
+    }
+
+    #[test]
+    fn trailing_slash_matches_directories_only() {
+        let f = filter(&[], &["bin/"]);
+        assert_eq!(f.excludes("bin", false), None);
+        assert_eq!(f.excludes("bin", true), Some("--skip"));
+        assert_eq!(f.excludes("bin/tool", false), Some("--skip"));
+    }
+
+    #[test]
+    fn unanchored_patterns_match_any_segment() {
+        let f = filter(&[], &["*.bak"]);
+        assert_eq!(f.excludes("nvim/old.bak", false), Some("--skip"));
+        assert_eq!(f.excludes("nvim/init.lua", false), None);
+        let anchored = filter(&[], &["nvim/*.lua"]);
+        assert_eq!(anchored.excludes("nvim/init.lua", false), Some("--skip"));
+        assert_eq!(anchored.excludes("nvim/lua/x.lua", false), None);
+    }
+
+    #[test]
+    fn invalid_glob_is_a_config_error() {
+        let err = FileFilter::new(&["[".into()], &[]).unwrap_err();
+        assert!(err.to_string().contains("--only"), "{err}");
+    }
+}
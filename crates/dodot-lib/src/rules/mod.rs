@@ -7,11 +7,14 @@
 //! tier so a file the user wants dropped never gets claimed by a
 //! precise mapping or the catchall.
 
+mod file_filter;
 mod grouping;
 mod pattern;
 mod scanner;
 mod types;
 
+pub use file_filter::{FileFilter, FILTERED_BY};
 pub use grouping::{group_by_handler, handler_execution_order};
+pub use pattern::pattern_matches;
 pub use scanner::{should_skip_entry, Scanner, SPECIAL_FILES};
 pub use types::{GateFailure, PackEntry, Rule, RuleMatch};
@@ -29,6 +29,8 @@ pub(super) struct CompiledRule {
     /// already lowercased at compile time when this is true; the
     /// matcher lowercases the candidate filename to match.
     pub(super) case_insensitive: bool,
+    /// Mirror of [`Rule::executable`].
+    pub(super) executable: bool,
     pub(super) handler: String,
     pub(super) priority: i32,
     pub(super) options: HashMap<String, String>,
@@ -49,26 +51,10 @@ pub(super) fn compile_rules(rules: &[Rule]) -> Vec<CompiledRule> {
                 raw_pattern
             };
 
-            let pattern = if normalized.ends_with('/') {
-                // Directory pattern
-                let dir_name = normalized.trim_end_matches('/').to_string();
-                CompiledPattern::Directory(dir_name)
-            } else if normalized.contains('*')
-                || normalized.contains('?')
-                || normalized.contains('[')
-            {
-                // Glob pattern
-                match glob::Pattern::new(&normalized) {
-                    Ok(p) => CompiledPattern::Glob(p),
-                    Err(_) => CompiledPattern::Exact(normalized),
-                }
-            } else {
-                CompiledPattern::Exact(normalized)
-            };
-
             CompiledRule {
-                pattern,
+                pattern: compile_pattern(normalized),
                 case_insensitive,
+                executable: rule.executable,
                 handler: rule.handler.clone(),
                 priority: rule.priority,
                 options: rule.options.clone(),
@@ -77,6 +63,29 @@ pub(super) fn compile_rules(rules: &[Rule]) -> Vec<CompiledRule> {
         .collect()
 }
 
+fn compile_pattern(normalized: String) -> CompiledPattern {
+    if normalized.ends_with('/') {
+        // Directory pattern
+        let dir_name = normalized.trim_end_matches('/').to_string();
+        CompiledPattern::Directory(dir_name)
+    } else if normalized.contains('*') || normalized.contains('?') || normalized.contains('[') {
+        // Glob pattern
+        match glob::Pattern::new(&normalized) {
+            Ok(p) => CompiledPattern::Glob(p),
+            Err(_) => CompiledPattern::Exact(normalized),
+        }
+    } else {
+        CompiledPattern::Exact(normalized)
+    }
+}
+
+/// Whether a rule `pattern` matches the entry `name`, as the scanner
+/// would (case-sensitively). For settings resolved after the scan,
+/// like a `path` rule's `path_priority`.
+pub fn pattern_matches(pattern: &str, name: &str, is_dir: bool) -> bool {
+    matches_entry(&compile_pattern(pattern.to_string()), name, is_dir)
+}
+
 pub(super) fn matches_entry(pattern: &CompiledPattern, filename: &str, is_dir: bool) -> bool {
     match pattern {
         CompiledPattern::Exact(name) => filename == name,
@@ -92,11 +101,18 @@ pub(super) fn matches_entry(pattern: &CompiledPattern, filename: &str, is_dir: b
 /// win because they sit at the highest priority tier set by
 /// [`mappings_to_rules`](crate::config::mappings_to_rules), not because
 /// the matcher knows their names.
+///
+/// `is_exec` says whether the entry is a file with an execute bit; only
+/// then can an [`executable`](Rule::executable) rule match it. It is
+/// asked only when such a rule is the one left to match, so entries a
+/// named mapping claims are never stat'ed.
+#[allow(clippy::too_many_arguments)]
 pub(super) fn match_file<'a>(
     sorted: &'a [&'a CompiledRule],
     has_ci_rules: bool,
     filename: &str,
     is_dir: bool,
+    is_exec: &dyn Fn() -> bool,
     rel_path: &Path,
     abs_path: &Path,
     pack: &str,
@@ -119,18 +135,22 @@ pub(super) fn match_file<'a>(
     };
 
     for rule in sorted {
-        if matches_entry(&rule.pattern, pick(rule), is_dir) {
-            return Some(RuleMatch {
-                relative_path: rel_path.to_path_buf(),
-                absolute_path: abs_path.to_path_buf(),
-                pack: pack.to_string(),
-                handler: rule.handler.clone(),
-                is_dir,
-                options: rule.options.clone(),
-                preprocessor_source: None,
-                rendered_bytes: None,
-            });
+        if !matches_entry(&rule.pattern, pick(rule), is_dir) {
+            continue;
         }
+        if rule.executable && (is_dir || !is_exec()) {
+            continue;
+        }
+        return Some(RuleMatch {
+            relative_path: rel_path.to_path_buf(),
+            absolute_path: abs_path.to_path_buf(),
+            pack: pack.to_string(),
+            handler: rule.handler.clone(),
+            is_dir,
+            options: rule.options.clone(),
+            preprocessor_source: None,
+            rendered_bytes: None,
+        });
     }
 
     None
@@ -147,6 +167,7 @@ mod tests {
             handler: "install".into(),
             priority: 0,
             case_insensitive: false,
+            executable: false,
             options: HashMap::new(),
         }]);
         assert!(matches_entry(&compiled[0].pattern, "install.sh", false));
@@ -160,6 +181,7 @@ mod tests {
             handler: "shell".into(),
             priority: 0,
             case_insensitive: false,
+            executable: false,
             options: HashMap::new(),
         }]);
         assert!(matches_entry(&compiled[0].pattern, "aliases.sh", false));
@@ -174,6 +196,7 @@ mod tests {
             handler: "path".into(),
             priority: 0,
             case_insensitive: false,
+            executable: false,
             options: HashMap::new(),
         }]);
         assert!(matches_entry(&compiled[0].pattern, "bin", true));
@@ -188,6 +211,7 @@ mod tests {
             handler: "skip".into(),
             priority: 50,
             case_insensitive: true,
+            executable: false,
             options: HashMap::new(),
         }]);
         assert!(compiled[0].case_insensitive);
@@ -203,9 +227,52 @@ mod tests {
             handler: "symlink".into(),
             priority: 0,
             case_insensitive: false,
+            executable: false,
             options: HashMap::new(),
         }]);
         assert!(matches_entry(&compiled[0].pattern, "anything", false));
         assert!(matches_entry(&compiled[0].pattern, "vimrc", false));
     }
+
+    #[test]
+    fn execute_bit_is_checked_only_when_an_executable_rule_is_left() {
+        let rule = |pattern: &str, handler: &str, priority: i32, executable: bool| Rule {
+            pattern: pattern.into(),
+            handler: handler.into(),
+            priority,
+            case_insensitive: false,
+            executable,
+            options: HashMap::new(),
+        };
+        let compiled = compile_rules(&[
+            rule("*.sh", "shell", 10, false),
+            rule("*", "path", 5, true),
+            rule("*", "symlink", 0, false),
+        ]);
+        let sorted: Vec<&CompiledRule> = compiled.iter().collect();
+        let asked = std::cell::Cell::new(0);
+        let is_exec = || {
+            asked.set(asked.get() + 1);
+            true
+        };
+        let handler = |name: &str| {
+            match_file(
+                &sorted,
+                false,
+                name,
+                false,
+                &is_exec,
+                Path::new(name),
+                Path::new(name),
+                "tools",
+            )
+            .unwrap()
+            .handler
+        };
+
+        assert_eq!(handler("run.sh"), "shell");
+        assert_eq!(asked.get(), 0);
+        assert_eq!(handler("deploy"), "path");
+        assert_eq!(asked.get(), 1);
+    }
 }
@@ -9,7 +9,7 @@ use std::collections::HashMap;
 use std::path::Path;
 
 use crate::fs::Fs;
-use crate::gates::{parse_basename_gate, BasenameGate, GateTable, HostFacts};
+use crate::gates::{BasenameGate, GateTable, HostFacts};
 use crate::handlers::HANDLER_GATE;
 use crate::packs::Pack;
 use crate::rules::pattern::{compile_rules, match_file, CompiledRule};
@@ -19,6 +19,10 @@ use crate::{DodotError, Result};
 /// Files that are always skipped during scanning.
 pub const SPECIAL_FILES: &[&str] = &[".dodot.toml", ".dodotignore"];
 
+/// Hidden entries the top-level walk lists anyway: `.config/`, and
+/// `.tool-versions` for the asdf handler.
+const LISTED_HIDDEN: &[&str] = &[".config", ".tool-versions"];
+
 /// Should this entry name be skipped at scan or handler-recursion time?
 ///
 /// Combines the three always-on filters: dodot's own files
@@ -155,6 +159,9 @@ impl<'a> Scanner<'a> {
         // requested case-insensitive matching, match_file can skip the
         // per-entry `to_lowercase` allocation entirely.
         let has_ci_rules = compiled.iter().any(|r| r.case_insensitive);
+        // Likewise, only stat entries when some rule asks about the
+        // execute bit.
+        let has_exec_rules = compiled.iter().any(|r| r.executable);
         // Sort once per scan, then reuse the ordered slice for every entry.
         // Descending priority via `Reverse` (clippy 1.96 unnecessary_sort_by).
         let mut sorted: Vec<&CompiledRule> = compiled.iter().collect();
@@ -209,7 +216,7 @@ impl<'a> Scanner<'a> {
                 .find(|(pat, _)| pat.matches(&rel_str))
                 .map(|(_, label)| *label);
 
-            let basename_gate = parse_basename_gate(&filename);
+            let basename_gate = gates.parse_basename(&filename);
 
             if let Some(map_label) = mapping_gate_label {
                 if matches!(basename_gate, BasenameGate::Found { .. }) {
@@ -287,11 +294,27 @@ impl<'a> Scanner<'a> {
                 }
             };
 
+            // Only files directly in the pack are candidates, and a
+            // routing prefix (`home.xinitrc`) marks a dotfile that
+            // happens to be executable, not a command. The stat runs
+            // only when an executable rule is the one left to match.
+            let is_exec = || {
+                has_exec_rules
+                    && !entry.is_dir
+                    && entry.relative_path.components().count() == 1
+                    && !crate::handlers::symlink::has_file_prefix(&effective_filename)
+                    && self
+                        .fs
+                        .stat(&entry.absolute_path)
+                        .is_ok_and(|meta| meta.mode & 0o111 != 0)
+            };
+
             if let Some(rule_match) = match_file(
                 &sorted,
                 has_ci_rules,
                 &effective_filename,
                 entry.is_dir,
+                &is_exec,
                 &effective_rel_path,
                 &entry.absolute_path,
                 pack_name,
@@ -332,7 +355,7 @@ impl<'a> Scanner<'a> {
         for entry in entries {
             let name = &entry.name;
 
-            if name.starts_with('.') && name != ".config" {
+            if name.starts_with('.') && !LISTED_HIDDEN.contains(&name.as_str()) {
                 continue;
             }
             if SPECIAL_FILES.contains(&name.as_str()) {
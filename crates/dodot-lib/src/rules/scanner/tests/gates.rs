@@ -120,6 +120,7 @@ fn gate_compound_user_label_evaluates_and() {
         handler: "shell".into(),
         priority: 10,
         case_insensitive: false,
+        executable: false,
         options: HashMap::new(),
     });
 
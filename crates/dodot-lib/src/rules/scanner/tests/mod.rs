@@ -53,6 +53,7 @@ pub(super) fn default_rules() -> Vec<Rule> {
             handler: "path".into(),
             priority: 10,
             case_insensitive: false,
+            executable: false,
             options: HashMap::new(),
         },
         Rule {
@@ -60,6 +61,7 @@ pub(super) fn default_rules() -> Vec<Rule> {
             handler: "install".into(),
             priority: 20,
             case_insensitive: false,
+            executable: false,
             options: HashMap::new(),
         },
         Rule {
@@ -67,6 +69,7 @@ pub(super) fn default_rules() -> Vec<Rule> {
             handler: "shell".into(),
             priority: 10,
             case_insensitive: false,
+            executable: false,
             options: HashMap::new(),
         },
         Rule {
@@ -74,6 +77,7 @@ pub(super) fn default_rules() -> Vec<Rule> {
             handler: "shell".into(),
             priority: 10,
             case_insensitive: false,
+            executable: false,
             options: HashMap::new(),
         },
         Rule {
@@ -81,6 +85,7 @@ pub(super) fn default_rules() -> Vec<Rule> {
             handler: "shell".into(),
             priority: 10,
             case_insensitive: false,
+            executable: false,
             options: HashMap::new(),
         },
         Rule {
@@ -88,6 +93,7 @@ pub(super) fn default_rules() -> Vec<Rule> {
             handler: "homebrew".into(),
             priority: 10,
             case_insensitive: false,
+            executable: false,
             options: HashMap::new(),
         },
         Rule {
@@ -95,6 +101,7 @@ pub(super) fn default_rules() -> Vec<Rule> {
             handler: "symlink".into(),
             priority: 0,
             case_insensitive: false,
+            executable: false,
             options: HashMap::new(),
         },
     ]
@@ -144,6 +151,7 @@ fn scan_pack_skips_hidden_files() {
         .pack("test")
         .file("visible", "yes")
         .file(".hidden", "no")
+        .file(".tool-versions", "nodejs 20.11.0\n")
         .done()
         .build();
 
@@ -162,6 +170,8 @@ fn scan_pack_skips_hidden_files() {
 
     assert!(names.contains(&"visible".to_string()));
     assert!(!names.contains(&".hidden".to_string()));
+    // Listed for the asdf handler.
+    assert!(names.contains(&".tool-versions".to_string()));
 }
 
 #[test]
@@ -255,6 +265,7 @@ fn scan_pack_ignore_rule_outranks_catchall() {
             handler: "ignore".into(),
             priority: 100,
             case_insensitive: false,
+            executable: false,
             options: HashMap::new(),
         },
         Rule {
@@ -262,6 +273,7 @@ fn scan_pack_ignore_rule_outranks_catchall() {
             handler: "symlink".into(),
             priority: 0,
             case_insensitive: false,
+            executable: false,
             options: HashMap::new(),
         },
     ];
@@ -302,6 +314,7 @@ fn scan_pack_priority_ordering() {
             handler: "generic-shell".into(),
             priority: 5,
             case_insensitive: false,
+            executable: false,
             options: HashMap::new(),
         },
         Rule {
@@ -309,6 +322,7 @@ fn scan_pack_priority_ordering() {
             handler: "specific-shell".into(),
             priority: 10,
             case_insensitive: false,
+            executable: false,
             options: HashMap::new(),
         },
         Rule {
@@ -316,6 +330,7 @@ fn scan_pack_priority_ordering() {
             handler: "symlink".into(),
             priority: 0,
             case_insensitive: false,
+            executable: false,
             options: HashMap::new(),
         },
     ];
@@ -328,6 +343,52 @@ fn scan_pack_priority_ordering() {
     assert_eq!(matches[0].handler, "specific-shell");
 }
 
+#[test]
+fn executable_rule_claims_only_files_with_an_execute_bit() {
+    let env = TempEnvironment::builder()
+        .pack("tools")
+        .file_with_mode("deploy", "#!/bin/sh", 0o755)
+        .file_with_mode("notes", "x", 0o644)
+        .file_with_mode("home.xinitrc", "#!/bin/sh", 0o755)
+        .file_with_mode("run.sh", "#!/bin/sh", 0o755)
+        .file_with_mode("bin/helper", "#!/bin/sh", 0o755)
+        .done()
+        .build();
+
+    let scanner = Scanner::new(env.fs.as_ref());
+    let pack = make_pack("tools", env.dotfiles_root.join("tools"));
+    let mut rules = default_rules();
+    rules.push(Rule {
+        pattern: "*".into(),
+        handler: "path".into(),
+        priority: 5,
+        case_insensitive: false,
+        executable: true,
+        options: HashMap::new(),
+    });
+
+    let (gates, host) = test_gates();
+    let matches = scanner
+        .scan_pack(&pack, &rules, &[], &gates, &host, &HashMap::new())
+        .unwrap();
+    let routed: Vec<(String, &str)> = matches
+        .iter()
+        .map(|m| (m.relative_path.display().to_string(), m.handler.as_str()))
+        .collect();
+    assert_eq!(
+        routed,
+        vec![
+            ("bin".into(), "path"),
+            ("deploy".into(), "path"),
+            // A routing prefix keeps an executable dotfile a dotfile.
+            ("home.xinitrc".into(), "symlink"),
+            ("notes".into(), "symlink"),
+            // A named mapping outranks the execute bit.
+            ("run.sh".into(), "shell"),
+        ]
+    );
+}
+
 #[test]
 fn skip_handler_matches_case_insensitively() {
     // Note: case-only filename variants like "README" and "Readme"
@@ -352,6 +413,7 @@ fn skip_handler_matches_case_insensitively() {
             handler: "skip".into(),
             priority: 50,
             case_insensitive: true,
+            executable: false,
             options: HashMap::new(),
         },
         Rule {
@@ -359,6 +421,7 @@ fn skip_handler_matches_case_insensitively() {
             handler: "skip".into(),
             priority: 50,
             case_insensitive: true,
+            executable: false,
             options: HashMap::new(),
         },
         Rule {
@@ -366,6 +429,7 @@ fn skip_handler_matches_case_insensitively() {
             handler: "skip".into(),
             priority: 50,
             case_insensitive: true,
+            executable: false,
             options: HashMap::new(),
         },
         Rule {
@@ -373,6 +437,7 @@ fn skip_handler_matches_case_insensitively() {
             handler: "symlink".into(),
             priority: 0,
             case_insensitive: false,
+            executable: false,
             options: HashMap::new(),
         },
     ];
@@ -417,6 +482,7 @@ fn skip_handler_outranks_precise_handler() {
             handler: "skip".into(),
             priority: 50,
             case_insensitive: true,
+            executable: false,
             options: HashMap::new(),
         },
         Rule {
@@ -424,6 +490,7 @@ fn skip_handler_outranks_precise_handler() {
             handler: "shell".into(),
             priority: 10,
             case_insensitive: false,
+            executable: false,
             options: HashMap::new(),
         },
     ];
@@ -456,6 +523,7 @@ fn ignore_rule_outranks_skip() {
             handler: "ignore".into(),
             priority: 100,
             case_insensitive: false,
+            executable: false,
             options: HashMap::new(),
         },
         Rule {
@@ -463,6 +531,7 @@ fn ignore_rule_outranks_skip() {
             handler: "skip".into(),
             priority: 50,
             case_insensitive: true,
+            executable: false,
             options: HashMap::new(),
         },
         Rule {
@@ -470,6 +539,7 @@ fn ignore_rule_outranks_skip() {
             handler: "symlink".into(),
             priority: 0,
             case_insensitive: false,
+            executable: false,
             options: HashMap::new(),
         },
     ];
@@ -619,6 +689,7 @@ fn shell_glob_defaults_dont_override_skip_rules() {
         handler: crate::handlers::HANDLER_SKIP.into(),
         priority: 50,
         case_insensitive: true,
+        executable: false,
         options: HashMap::new(),
     });
 
@@ -29,6 +29,13 @@ pub struct Rule {
     #[serde(default, skip_serializing_if = "is_false")]
     pub case_insensitive: bool,
 
+    /// Match only files with an execute bit set. Set by the
+    /// `mappings.executable` rule so a script dropped at a pack's root
+    /// lands on `$PATH` without naming it anywhere. Never matches a
+    /// directory.
+    #[serde(default, skip_serializing_if = "is_false")]
+    pub executable: bool,
+
     /// Handler-specific options passed through from config.
     #[serde(default, skip_serializing_if = "HashMap::is_empty")]
     pub options: HashMap<String, String>,
@@ -23,6 +23,7 @@ pub mod registry;
 pub mod secret_string;
 pub mod secret_tool;
 pub mod sops;
+pub mod vault;
 
 #[cfg(test)]
 pub mod test_support;
@@ -37,3 +38,4 @@ pub use registry::{split_scheme, SecretRegistry};
 pub use secret_string::SecretString;
 pub use secret_tool::SecretToolProvider;
 pub use sops::SopsProvider;
+pub use vault::VaultProvider;
@@ -7,6 +7,7 @@
 //! - `pass:path/to/secret`   — single colon, no slashes
 //! - `sops:file.yaml#k.path` — single colon, fragment optional
 //! - `bw:Folder/Item`        — single colon
+//! - `vault:secret/gh#token` — single colon, field after `#`
 //!
 //! Rule: split at the first colon, take everything to its left as the
 //! scheme. The provider's `resolve()` sees what's after the colon
@@ -264,6 +265,7 @@ mod tests {
         assert_eq!(scheme_to_config_key("bw"), "bw");
         assert_eq!(scheme_to_config_key("sops"), "sops");
         assert_eq!(scheme_to_config_key("keychain"), "keychain");
+        assert_eq!(scheme_to_config_key("vault"), "vault");
     }
 
     #[test]
@@ -0,0 +1,447 @@
+//! `vault` provider — HashiCorp Vault CLI integration.
+//!
+//! Reference shape: `vault:<path>#<field>`, read from a KV secrets
+//! engine (v1 or v2 — the CLI detects the version from the mount).
+//!
+//! - `vault:secret/gh#token` → the `token` field of the secret at
+//!   `secret/gh`.
+//!
+//! The field is required: a Vault secret is a map with no default
+//! key, and guessing one would turn a typo into "field not present".
+//!
+//! Resolution: `vault kv get -field=<field> <path>` → emits the value
+//! on stdout, exit 0 on success, non-zero with diagnostic text on
+//! stderr for "no value found", "field not present" or "permission
+//! denied".
+//!
+//! Auth model: whatever the vault binary already uses — `VAULT_TOKEN`,
+//! the token helper (`~/.vault-token`, written by `vault login`), or a
+//! Vault Agent at `VAULT_AGENT_ADDR` that injects its auto-auth token.
+//! dodot never logs in itself. The probe runs `vault token lookup`
+//! and maps a missing or rejected token to `NotAuthenticated`, and an
+//! unreachable server to `Misconfigured`. The `address`,
+//! `agent_address` and `namespace` config knobs become the CLI's
+//! `-address` / `-agent-address` / `-namespace` flags, overriding the
+//! matching `VAULT_*` variables.
+//!
+//! See `secrets.lex` §5.2 (provider table) and §5.4 (error UX).
+
+use std::sync::Arc;
+
+use crate::datastore::CommandRunner;
+use crate::secret::provider::{ProbeResult, SecretProvider};
+use crate::secret::secret_string::SecretString;
+use crate::{DodotError, Result};
+
+/// `SecretProvider` impl for the HashiCorp Vault CLI (`vault`).
+pub struct VaultProvider {
+    runner: Arc<dyn CommandRunner>,
+    /// `-address` / `-agent-address` / `-namespace` flags passed to
+    /// every `vault` call. Empty when the config leaves them to the
+    /// environment.
+    connection_args: Vec<String>,
+}
+
+impl VaultProvider {
+    pub fn new(runner: Arc<dyn CommandRunner>) -> Self {
+        Self {
+            runner,
+            connection_args: Vec::new(),
+        }
+    }
+
+    /// Construct from `[secret.providers.vault]`. Empty knobs add no
+    /// flag, leaving the vault binary to read `VAULT_ADDR`,
+    /// `VAULT_AGENT_ADDR` and `VAULT_NAMESPACE` itself.
+    pub fn from_config(
+        runner: Arc<dyn CommandRunner>,
+        config: &crate::config::SecretProviderVault,
+    ) -> Self {
+        let connection_args = [
+            ("-address", &config.address),
+            ("-agent-address", &config.agent_address),
+            ("-namespace", &config.namespace),
+        ]
+        .into_iter()
+        .filter(|(_, value)| !value.is_empty())
+        .map(|(flag, value)| format!("{flag}={value}"))
+        .collect();
+        Self {
+            runner,
+            connection_args,
+        }
+    }
+
+    /// `vault <subcommand...> <connection flags> <rest...>`. Flags go
+    /// before positional arguments, where the CLI parses them.
+    fn args(&self, subcommand: &[&str], rest: &[String]) -> Vec<String> {
+        subcommand
+            .iter()
+            .map(|s| s.to_string())
+            .chain(self.connection_args.iter().cloned())
+            .chain(rest.iter().cloned())
+            .collect()
+    }
+
+    /// Parse the suffix the registry hands us into `(path, field)`.
+    fn parse_reference(suffix: &str) -> Result<(&str, &str)> {
+        let (path, field) = suffix.split_once('#').ok_or_else(|| {
+            DodotError::Other(format!(
+                "vault reference `vault:{suffix}` names no field. \
+                 Expected `vault:<path>#<field>`, e.g. `vault:secret/gh#token`."
+            ))
+        })?;
+        if path.is_empty() || field.is_empty() {
+            return Err(DodotError::Other(format!(
+                "vault reference `vault:{suffix}` has an empty {}. \
+                 Expected `vault:<path>#<field>`.",
+                if path.is_empty() { "path" } else { "field" }
+            )));
+        }
+        Ok((path, field))
+    }
+}
+
+impl SecretProvider for VaultProvider {
+    fn scheme(&self) -> &str {
+        "vault"
+    }
+
+    fn probe(&self) -> ProbeResult {
+        // Step 1: binary on PATH? `vault version` is local only.
+        match self.runner.run("vault", &["version".into()]) {
+            Ok(out) if out.exit_code == 0 => {}
+            Ok(_) => {
+                return ProbeResult::ProbeFailed {
+                    details: "`vault version` returned non-zero — the binary is on PATH \
+                              but not behaving as expected"
+                        .into(),
+                };
+            }
+            Err(_) => {
+                return ProbeResult::NotInstalled {
+                    hint: "install the Vault CLI: \
+                           https://developer.hashicorp.com/vault/install \
+                           (e.g. `brew install hashicorp/tap/vault`)"
+                        .into(),
+                };
+            }
+        }
+
+        // Step 2: a token the server accepts. `token lookup` reads the
+        // caller's own token, which every policy allows, so a failure
+        // is about the token or the connection, not about permissions
+        // on the secrets themselves.
+        let args = self.args(&["token", "lookup"], &["-format=json".into()]);
+        match self.runner.run("vault", &args) {
+            Ok(out) if out.exit_code == 0 => ProbeResult::Ok,
+            Ok(out) => {
+                let stderr = out.stderr.trim();
+                if stderr.contains("missing client token")
+                    || stderr.contains("permission denied")
+                    || stderr.contains("invalid token")
+                {
+                    ProbeResult::NotAuthenticated {
+                        hint: "Vault has no valid token. Run `vault login`, export \
+                               VAULT_TOKEN, or point VAULT_AGENT_ADDR at a running \
+                               Vault Agent with auto-auth, then re-run dodot."
+                            .into(),
+                    }
+                } else if stderr.contains("connection refused")
+                    || stderr.contains("no such host")
+                    || stderr.contains("dial tcp")
+                    || stderr.contains("HTTP response to HTTPS client")
+                {
+                    ProbeResult::Misconfigured {
+                        hint: format!(
+                            "cannot reach the Vault server ({stderr}). Set VAULT_ADDR, \
+                             or `address` in `[secret.providers.vault]`."
+                        ),
+                    }
+                } else {
+                    ProbeResult::ProbeFailed {
+                        details: format!(
+                            "`vault token lookup` exited with code {}: {stderr}",
+                            out.exit_code
+                        ),
+                    }
+                }
+            }
+            Err(_) => ProbeResult::ProbeFailed {
+                details: "could not run `vault token lookup` after a successful \
+                          `vault version`; intermittent subprocess failure"
+                    .into(),
+            },
+        }
+    }
+
+    fn resolve(&self, reference: &str) -> Result<SecretString> {
+        let (path, field) = Self::parse_reference(reference)?;
+        let args = self.args(&["kv", "get"], &[format!("-field={field}"), path.into()]);
+        let out = self.runner.run("vault", &args)?;
+        if out.exit_code != 0 {
+            let stderr = out.stderr.trim();
+            let err_msg = if stderr.contains("No value found") {
+                format!(
+                    "secret `vault:{reference}` not found: nothing at `{path}`. \
+                     Verify with `vault kv list {}`.",
+                    path.rsplit_once('/').map_or(path, |(parent, _)| parent)
+                )
+            } else if stderr.contains("not present in secret") {
+                format!(
+                    "secret `vault:{reference}` has no field `{field}`. \
+                     List its fields with `vault kv get {path}`."
+                )
+            } else if stderr.contains("permission denied") {
+                format!(
+                    "secret resolution for `vault:{reference}` failed: permission denied. \
+                     The token may have expired (run `vault login`), or its policy \
+                     doesn't grant read on `{path}`."
+                )
+            } else if stderr.is_empty() {
+                format!(
+                    "`vault kv get -field={field} {path}` exited with code {}",
+                    out.exit_code
+                )
+            } else {
+                format!(
+                    "`vault kv get -field={field} {path}` failed (exit {}): {stderr}",
+                    out.exit_code
+                )
+            };
+            return Err(DodotError::Other(err_msg));
+        }
+        // `-field` prints the raw value; strip one trailing '\n' if a
+        // CLI version adds it — same contract as op and bw.
+        let mut value = out.stdout;
+        if value.ends_with('\n') {
+            value.pop();
+        }
+        Ok(SecretString::new(value))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::datastore::CommandOutput;
+    use std::sync::Mutex;
+
+    type ScriptedResponse = (
+        String,
+        Vec<String>,
+        std::result::Result<CommandOutput, String>,
+    );
+
+    struct ScriptedRunner {
+        responses: Mutex<Vec<ScriptedResponse>>,
+    }
+    impl ScriptedRunner {
+        fn new() -> Self {
+            Self {
+                responses: Mutex::new(Vec::new()),
+            }
+        }
+        fn expect(
+            self,
+            exe: impl Into<String>,
+            args: Vec<&str>,
+            response: std::result::Result<CommandOutput, String>,
+        ) -> Self {
+            self.responses.lock().unwrap().push((
+                exe.into(),
+                args.into_iter().map(String::from).collect(),
+                response,
+            ));
+            self
+        }
+    }
+    impl CommandRunner for ScriptedRunner {
+        fn run(&self, exe: &str, args: &[String]) -> Result<CommandOutput> {
+            let mut r = self.responses.lock().unwrap();
+            if r.is_empty() {
+                return Err(DodotError::Other(format!(
+                    "ScriptedRunner: unexpected `{exe} {args:?}`"
+                )));
+            }
+            let (e, a, out) = r.remove(0);
+            assert_eq!(exe, e);
+            assert_eq!(args, a.as_slice());
+            out.map_err(DodotError::Other)
+        }
+    }
+    fn ok(stdout: &str) -> std::result::Result<CommandOutput, String> {
+        Ok(CommandOutput {
+            exit_code: 0,
+            stdout: stdout.into(),
+            stderr: String::new(),
+        })
+    }
+    fn err_out(exit: i32, stderr: &str) -> std::result::Result<CommandOutput, String> {
+        Ok(CommandOutput {
+            exit_code: exit,
+            stdout: String::new(),
+            stderr: stderr.into(),
+        })
+    }
+
+    // ── parse_reference ─────────────────────────────────────────
+
+    #[test]
+    fn parse_reference_splits_path_and_field() {
+        let (path, field) = VaultProvider::parse_reference("secret/gh#token").unwrap();
+        assert_eq!(path, "secret/gh");
+        assert_eq!(field, "token");
+    }
+
+    #[test]
+    fn parse_reference_requires_a_field() {
+        let e = VaultProvider::parse_reference("secret/gh")
+            .unwrap_err()
+            .to_string();
+        assert!(e.contains("names no field"));
+        let e = VaultProvider::parse_reference("secret/gh#")
+            .unwrap_err()
+            .to_string();
+        assert!(e.contains("empty field"));
+    }
+
+    // ── probe ───────────────────────────────────────────────────
+
+    #[test]
+    fn probe_ok_when_token_lookup_succeeds() {
+        let runner = Arc::new(
+            ScriptedRunner::new()
+                .expect("vault", vec!["version"], ok("Vault v1.15.2\n"))
+                .expect(
+                    "vault",
+                    vec!["token", "lookup", "-format=json"],
+                    ok(r#"{"data":{}}"#),
+                ),
+        );
+        assert!(matches!(
+            VaultProvider::new(runner).probe(),
+            ProbeResult::Ok
+        ));
+    }
+
+    #[test]
+    fn probe_not_installed_when_runner_errors() {
+        let runner = Arc::new(ScriptedRunner::new().expect(
+            "vault",
+            vec!["version"],
+            Err("command not found: vault".into()),
+        ));
+        match VaultProvider::new(runner).probe() {
+            ProbeResult::NotInstalled { hint } => assert!(hint.contains("Vault CLI")),
+            other => panic!("expected NotInstalled, got {other:?}"),
+        }
+    }
+
+    #[test]
+    fn probe_not_authenticated_without_a_token() {
+        let runner = Arc::new(
+            ScriptedRunner::new()
+                .expect("vault", vec!["version"], ok("Vault v1.15.2\n"))
+                .expect(
+                    "vault",
+                    vec!["token", "lookup", "-format=json"],
+                    err_out(2, "Error looking up token: missing client token"),
+                ),
+        );
+        match VaultProvider::new(runner).probe() {
+            ProbeResult::NotAuthenticated { hint } => {
+                assert!(hint.contains("vault login"));
+                assert!(hint.contains("VAULT_AGENT_ADDR"));
+            }
+            other => panic!("expected NotAuthenticated, got {other:?}"),
+        }
+    }
+
+    #[test]
+    fn probe_misconfigured_when_server_unreachable() {
+        let runner = Arc::new(
+            ScriptedRunner::new()
+                .expect("vault", vec!["version"], ok("Vault v1.15.2\n"))
+                .expect(
+                    "vault",
+                    vec!["token", "lookup", "-format=json"],
+                    err_out(
+                        2,
+                        "Get \"https://127.0.0.1:8200/v1/auth/token/lookup-self\": \
+                         dial tcp 127.0.0.1:8200: connect: connection refused",
+                    ),
+                ),
+        );
+        match VaultProvider::new(runner).probe() {
+            ProbeResult::Misconfigured { hint } => assert!(hint.contains("VAULT_ADDR")),
+            other => panic!("expected Misconfigured, got {other:?}"),
+        }
+    }
+
+    // ── resolve ─────────────────────────────────────────────────
+
+    #[test]
+    fn resolve_passes_config_flags_before_the_path() {
+        let config = crate::config::SecretProviderVault {
+            enabled: true,
+            address: "https://vault.example.com".into(),
+            agent_address: String::new(),
+            namespace: "team".into(),
+        };
+        let runner = Arc::new(ScriptedRunner::new().expect(
+            "vault",
+            vec![
+                "kv",
+                "get",
+                "-address=https://vault.example.com",
+                "-namespace=team",
+                "-field=token",
+                "secret/gh",
+            ],
+            ok("ghp_abc123"),
+        ));
+        let p = VaultProvider::from_config(runner, &config);
+        assert_eq!(
+            p.resolve("secret/gh#token").unwrap().expose().unwrap(),
+            "ghp_abc123"
+        );
+    }
+
+    #[test]
+    fn resolve_maps_missing_secret_and_field_to_actionable_messages() {
+        let runner = Arc::new(
+            ScriptedRunner::new()
+                .expect(
+                    "vault",
+                    vec!["kv", "get", "-field=token", "secret/apps/gh"],
+                    err_out(2, "No value found at secret/data/apps/gh"),
+                )
+                .expect(
+                    "vault",
+                    vec!["kv", "get", "-field=tokn", "secret/gh"],
+                    err_out(1, "Field \"tokn\" not present in secret"),
+                ),
+        );
+        let p = VaultProvider::new(runner);
+        let e = p.resolve("secret/apps/gh#token").unwrap_err().to_string();
+        assert!(e.contains("vault kv list secret/apps"), "{e}");
+        let e = p.resolve("secret/gh#tokn").unwrap_err().to_string();
+        assert!(e.contains("no field `tokn`"), "{e}");
+    }
+
+    #[test]
+    fn resolve_maps_permission_denied_to_token_or_policy() {
+        let runner = Arc::new(ScriptedRunner::new().expect(
+            "vault",
+            vec!["kv", "get", "-field=token", "secret/gh"],
+            err_out(2, "Code: 403. Errors:\n\n* permission denied"),
+        ));
+        let e = VaultProvider::new(runner)
+            .resolve("secret/gh#token")
+            .unwrap_err()
+            .to_string();
+        assert!(e.contains("permission denied"));
+        assert!(e.contains("policy"));
+    }
+}
@@ -0,0 +1,243 @@
+//! `dodot serve --socket <path>`: the [`crate::api`] facade over a
+//! local Unix socket, for GUI wrappers, editor plugins and status-bar
+//! widgets that would rather not shell out and parse text.
+//!
+//! The protocol is JSON-RPC 2.0, one request per line and one response
+//! per line. `params` is the method's options struct from
+//! [`crate::api`] as a JSON object, every field optional; `result` is
+//! the command's result serialized the way `--output json` prints it.
+//!
+//! - `status` — [`StatusOptions`] → pack status.
+//! - `plan` — [`PlanOptions`] → the plan `dodot plan --out` would save.
+//! - `link` — [`UpOptions`] → `dodot up --no-provision`; the
+//!   `no_provision` field is forced on, provisioning has its own method.
+//! - `provision` — [`ProvisionOptions`] → `dodot provision`.
+//!
+//! ```text
+//! → {"jsonrpc":"2.0","id":1,"method":"status","params":{"packs":["vim"]}}
+//! ← {"jsonrpc":"2.0","id":1,"result":{"packs":[…],…}}
+//! ```
+//!
+//! Connections are served one at a time and requests run in order, so
+//! two frontends can't deploy over each other. The repo is reopened for
+//! every connection, so config edits are picked up without a restart.
+//! The socket is created mode `0600`: anyone who can connect can deploy
+//! as the user running the server.
+
+use serde::Deserialize;
+use serde_json::{json, Value};
+
+use crate::api::{Dodot, PlanOptions, ProvisionOptions, StatusOptions, UpOptions};
+use crate::{DodotError, Result};
+
+/// Method names, for `--help` and error messages.
+pub const METHODS: [&str; 4] = ["status", "plan", "link", "provision"];
+
+/// JSON-RPC error codes. The first three are the spec's; command
+/// failures use the implementation-defined range.
+const PARSE_ERROR: i64 = -32700;
+const METHOD_NOT_FOUND: i64 = -32601;
+const INVALID_PARAMS: i64 = -32602;
+const COMMAND_FAILED: i64 = -32000;
+
+#[derive(Deserialize)]
+struct Request {
+    #[serde(default)]
+    id: Value,
+    method: String,
+    #[serde(default)]
+    params: Value,
+}
+
+/// Answer one request line. Never fails: malformed input and command
+/// errors become JSON-RPC error responses.
+pub fn handle_line(dodot: &mut Dodot, line: &str) -> Value {
+    let request: Request = match serde_json::from_str(line) {
+        Ok(request) => request,
+        Err(e) => {
+            return error(
+                Value::Null,
+                PARSE_ERROR,
+                format!("invalid request: {e}"),
+                None,
+            )
+        }
+    };
+    let id = request.id.clone();
+    match dispatch(dodot, &request) {
+        Ok(result) => json!({ "jsonrpc": "2.0", "id": id, "result": result }),
+        Err(Failure::Params(message)) => error(id, INVALID_PARAMS, message, None),
+        Err(Failure::Method) => error(
+            id,
+            METHOD_NOT_FOUND,
+            format!(
+                "unknown method `{}`; expected one of: {}",
+                request.method,
+                METHODS.join(", ")
+            ),
+            None,
+        ),
+        Err(Failure::Command(e)) => error(id, COMMAND_FAILED, e.to_string(), e.code()),
+    }
+}
+
+enum Failure {
+    Method,
+    Params(String),
+    Command(DodotError),
+}
+
+fn dispatch(dodot: &mut Dodot, request: &Request) -> std::result::Result<Value, Failure> {
+    match request.method.as_str() {
+        "status" => to_value(dodot.status(&params::<StatusOptions>(&request.params)?)),
+        "plan" => to_value(dodot.plan(&params::<PlanOptions>(&request.params)?)),
+        "link" => {
+            let mut opts = params::<UpOptions>(&request.params)?;
+            opts.no_provision = true;
+            to_value(dodot.up(&opts))
+        }
+        "provision" => to_value(dodot.provision(&params::<ProvisionOptions>(&request.params)?)),
+        _ => Err(Failure::Method),
+    }
+}
+
+/// Missing or `null` params mean all defaults.
+fn params<T: serde::de::DeserializeOwned>(params: &Value) -> std::result::Result<T, Failure> {
+    let params = if params.is_null() {
+        json!({})
+    } else {
+        params.clone()
+    };
+    serde_json::from_value(params).map_err(|e| Failure::Params(format!("invalid params: {e}")))
+}
+
+fn to_value(result: Result<impl serde::Serialize>) -> std::result::Result<Value, Failure> {
+    let result = result.map_err(Failure::Command)?;
+    serde_json::to_value(result).map_err(|e| {
+        Failure::Command(DodotError::Other(format!(
+            "result serialization failed: {e}"
+        )))
+    })
+}
+
+fn error(id: Value, code: i64, message: String, dodot_code: Option<&str>) -> Value {
+    let mut error = json!({ "code": code, "message": message });
+    if let Some(dodot_code) = dodot_code {
+        error["data"] = json!({ "code": dodot_code });
+    }
+    json!({ "jsonrpc": "2.0", "id": id, "error": error })
+}
+
+/// Listen on `socket` until the process is stopped, opening the repo
+/// with `open` for each connection. A stale socket file left by a
+/// server that died is replaced; a live one is an error.
+#[cfg(unix)]
+pub fn serve(socket: &std::path::Path, open: &dyn Fn() -> Result<Dodot>) -> Result<()> {
+    use std::io::{BufRead, BufReader, Write};
+    use std::os::unix::fs::PermissionsExt;
+    use std::os::unix::net::{UnixListener, UnixStream};
+
+    let io_err = |what: &str, e: std::io::Error| {
+        DodotError::Other(format!("{what} {}: {e}", socket.display()))
+    };
+    if socket.exists() {
+        if UnixStream::connect(socket).is_ok() {
+            return Err(DodotError::Other(format!(
+                "{} is in use by another server",
+                socket.display()
+            )));
+        }
+        std::fs::remove_file(socket).map_err(|e| io_err("removing stale socket", e))?;
+    }
+    let listener = UnixListener::bind(socket).map_err(|e| io_err("binding", e))?;
+    std::fs::set_permissions(socket, std::fs::Permissions::from_mode(0o600))
+        .map_err(|e| io_err("restricting", e))?;
+    tracing::info!(socket = %socket.display(), "serving");
+
+    for stream in listener.incoming() {
+        let stream = match stream {
+            Ok(stream) => stream,
+            Err(e) => {
+                tracing::warn!("accept failed: {e}");
+                continue;
+            }
+        };
+        // A repo that fails to open (a broken config, say) is reported
+        // to the client on every request rather than dropping it.
+        let mut dodot = open();
+        let mut writer = match stream.try_clone() {
+            Ok(writer) => writer,
+            Err(e) => {
+                tracing::warn!("connection setup failed: {e}");
+                continue;
+            }
+        };
+        for line in BufReader::new(stream).lines() {
+            let Ok(line) = line else { break };
+            if line.trim().is_empty() {
+                continue;
+            }
+            let response = match dodot.as_mut() {
+                Ok(dodot) => handle_line(dodot, &line),
+                Err(e) => error(Value::Null, COMMAND_FAILED, e.to_string(), e.code()),
+            };
+            if writeln!(writer, "{response}").is_err() {
+                break;
+            }
+        }
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::commands::tests::support::make_ctx;
+    use crate::testing::TempEnvironment;
+
+    #[test]
+    fn requests_run_through_the_facade() {
+        let env = TempEnvironment::builder()
+            .pack("vim")
+            .file("vimrc", "set nocompatible")
+            .done()
+            .build();
+        let mut dodot = Dodot::from_context(make_ctx(&env));
+
+        let linked = handle_line(
+            &mut dodot,
+            r#"{"jsonrpc":"2.0","id":1,"method":"link","params":{"packs":["vim"]}}"#,
+        );
+        assert_eq!(linked["id"], 1);
+        assert!(linked.get("result").is_some(), "response: {linked}");
+        env.assert_exists(&env.home.join(".vimrc"));
+
+        let status = handle_line(
+            &mut dodot,
+            r#"{"jsonrpc":"2.0","id":"s","method":"status"}"#,
+        );
+        assert_eq!(status["id"], "s");
+        assert!(status["result"].to_string().contains("vimrc"));
+    }
+
+    #[test]
+    fn bad_requests_get_error_responses() {
+        let env = TempEnvironment::builder().build();
+        let mut dodot = Dodot::from_context(make_ctx(&env));
+
+        let code =
+            |line: &str, dodot: &mut Dodot| handle_line(dodot, line)["error"]["code"].clone();
+        assert_eq!(code("not json", &mut dodot), PARSE_ERROR);
+        assert_eq!(
+            code(r#"{"id":1,"method":"uninstall"}"#, &mut dodot),
+            METHOD_NOT_FOUND
+        );
+        assert_eq!(
+            code(
+                r#"{"id":1,"method":"status","params":{"pack":"vim"}}"#,
+                &mut dodot
+            ),
+            INVALID_PARAMS
+        );
+    }
+}
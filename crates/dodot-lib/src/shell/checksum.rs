@@ -0,0 +1,123 @@
+//! Deploy-time content hashes for shell-sourced files.
+//!
+//! Shell sources are staged as symlinks, so an edit to `aliases.sh`
+//! (a `git pull`, another editor, a teammate on a shared repo) is live
+//! in the next shell without dodot noticing. To make that visible,
+//! `dodot up` records each staged source's checksum and `dodot status`
+//! flags any source whose current checksum differs as "changed since
+//! linked". Running `dodot up` again re-records and clears the flag.
+//!
+//! Layout: `<data_dir>/packs/<pack>/shell/.checksums/<filename>.sum`,
+//! one short hex digest per file (same format as run-once sentinels).
+//! The directory lives inside the handler dir, so the per-pack wipe at
+//! the start of `up` clears it along with the staged links. Sources
+//! deployed before this existed have no checksum and are never flagged.
+//!
+//! Init-script generation and the syntax check only consider symlinks,
+//! so the `.checksums` subdirectory is never sourced.
+
+use std::path::{Path, PathBuf};
+
+use crate::fs::Fs;
+use crate::handlers::run_once::file_checksum;
+use crate::paths::Pather;
+use crate::Result;
+
+/// Subdirectory (under each pack's shell handler dir) holding the
+/// recorded checksums.
+pub const CHECKSUMS_SUBDIR: &str = ".checksums";
+
+/// Path of the recorded checksum for one source.
+pub fn checksum_path(paths: &dyn Pather, pack: &str, source_filename: &str) -> PathBuf {
+    paths
+        .handler_data_dir(pack, "shell")
+        .join(CHECKSUMS_SUBDIR)
+        .join(format!("{source_filename}.sum"))
+}
+
+/// Record the checksum of every staged shell source in `packs`
+/// (on-disk pack names). Returns how many files were recorded.
+/// Packs outside this run keep their previous checksums, so
+/// `dodot up vim` doesn't silently acknowledge edits in other packs.
+pub fn record_source_checksums(fs: &dyn Fs, paths: &dyn Pather, packs: &[String]) -> Result<usize> {
+    let mut recorded = 0;
+    for pack in packs {
+        let shell_dir = paths.handler_data_dir(pack, "shell");
+        if !fs.is_dir(&shell_dir) {
+            continue;
+        }
+        for entry in fs.read_dir(&shell_dir)? {
+            if !entry.is_symlink {
+                continue;
+            }
+            let Ok(source) = fs.readlink(&entry.path) else {
+                continue;
+            };
+            let Ok(sum) = file_checksum(fs, &source) else {
+                continue;
+            };
+            let path = checksum_path(paths, pack, &entry.name);
+            if let Some(parent) = path.parent() {
+                fs.mkdir_all(parent)?;
+            }
+            fs.write_file(&path, sum.as_bytes())?;
+            recorded += 1;
+        }
+    }
+    Ok(recorded)
+}
+
+/// Whether `source` differs from the checksum recorded when it was
+/// last staged. `false` when nothing was recorded or the source can't
+/// be read — this is an informational signal, never a hard failure.
+pub fn changed_since_linked(fs: &dyn Fs, paths: &dyn Pather, pack: &str, source: &Path) -> bool {
+    let Some(filename) = source.file_name() else {
+        return false;
+    };
+    let path = checksum_path(paths, pack, &filename.to_string_lossy());
+    let recorded = match fs.read_to_string(&path) {
+        Ok(s) => s.trim().to_string(),
+        Err(_) => return false,
+    };
+    match file_checksum(fs, source) {
+        Ok(current) => !recorded.is_empty() && current != recorded,
+        Err(_) => false,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::testing::TempEnvironment;
+
+    #[test]
+    fn edits_after_recording_are_flagged_until_rerecorded() {
+        let env = TempEnvironment::builder()
+            .pack("dev")
+            .file("aliases.sh", "alias g=git\n")
+            .done()
+            .build();
+        let source = env.dotfiles_root.join("dev/aliases.sh");
+        let shell_dir = env.paths.handler_data_dir("dev", "shell");
+        env.fs.mkdir_all(&shell_dir).unwrap();
+        env.fs
+            .symlink(&source, &shell_dir.join("aliases.sh"))
+            .unwrap();
+
+        let fs = env.fs.as_ref();
+        let paths = env.paths.as_ref();
+        assert!(!changed_since_linked(fs, paths, "dev", &source));
+
+        let packs = vec!["dev".to_string()];
+        assert_eq!(record_source_checksums(fs, paths, &packs).unwrap(), 1);
+        assert!(!changed_since_linked(fs, paths, "dev", &source));
+
+        env.fs
+            .write_file(&source, b"alias g=git\nalias k=kubectl\n")
+            .unwrap();
+        assert!(changed_since_linked(fs, paths, "dev", &source));
+
+        record_source_checksums(fs, paths, &packs).unwrap();
+        assert!(!changed_since_linked(fs, paths, "dev", &source));
+    }
+}
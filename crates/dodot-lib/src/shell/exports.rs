@@ -0,0 +1,331 @@
+//! PATH exports beyond POSIX `dodot-init.sh`.
+//!
+//! `dodot-init.sh` serves bash, zsh and sh. Two more files carry the
+//! same `$PATH` additions, in the same order, for shells that can't
+//! source it:
+//!
+//! - `dodot-init.fish` — `source` it from `config.fish`;
+//! - `dodot-init.nu` — `source` it from nushell's `env.nu`.
+//!
+//! They only hold PATH entries; shell-handler sources are shell
+//! specific and stay in `dodot-init.sh`.
+//!
+//! Shells aren't the only consumers of `$PATH`: cron jobs, editors
+//! launched from a GUI and launchd/systemd services never run a shell
+//! profile. With `[path] shims = true`, every executable in a deployed
+//! path directory also gets a two-line wrapper in `<data_dir>/bin`, so
+//! one fixed directory — set once in the launchd or systemd user
+//! environment — exposes all of them. Shims resolve collisions the way
+//! `$PATH` does: the highest-priority pack's command wins.
+
+use std::collections::BTreeMap;
+use std::fmt::Write;
+use std::path::{Path, PathBuf};
+
+use crate::fs::Fs;
+use crate::paths::Pather;
+use crate::Result;
+
+use super::{path_entries, sh_quote, PathPosition, PathPriorities};
+
+/// First line after the shebang of every shim; how stale shims are
+/// told apart from files the user put in the shim dir.
+const SHIM_MARKER: &str = "# dodot shim";
+
+/// Regenerate `dodot-init.fish`, `dodot-init.nu` and (when `shims` is
+/// set) the shim directory from the datastore. Disabling shims removes
+/// the ones a previous run wrote.
+pub fn write_path_exports(
+    fs: &dyn Fs,
+    paths: &dyn Pather,
+    path_priorities: &PathPriorities,
+    shims: bool,
+) -> Result<()> {
+    let entries = path_entries(fs, paths, path_priorities)?;
+
+    fs.mkdir_all(paths.shell_dir())?;
+    fs.write_file_atomic(
+        &paths.init_script_fish_path(),
+        generate_fish_exports(&entries).as_bytes(),
+    )?;
+    fs.write_file_atomic(
+        &paths.init_script_nu_path(),
+        generate_nu_exports(&entries).as_bytes(),
+    )?;
+
+    let commands = if shims {
+        let dirs: Vec<PathBuf> = entries.into_iter().map(|(dir, _)| dir).collect();
+        collect_commands(fs, &dirs)?
+    } else {
+        BTreeMap::new()
+    };
+    sync_shims(fs, &paths.shim_dir(), &commands)
+}
+
+fn header(script: &mut String) {
+    writeln!(script, "# Generated by dodot — do not edit manually.").unwrap();
+    writeln!(script, "# Regenerated on every `dodot up` / `dodot down`.").unwrap();
+    writeln!(script).unwrap();
+}
+
+/// fish: prepend (or append) each directory unless it is already on
+/// `$PATH`. `entries` is in final `$PATH` order, so prepends are
+/// emitted reversed.
+pub fn generate_fish_exports(entries: &[(PathBuf, PathPosition)]) -> String {
+    let mut script = String::new();
+    header(&mut script);
+    if entries.is_empty() {
+        writeln!(script, "# No PATH additions.").unwrap();
+        return script;
+    }
+    writeln!(
+        script,
+        "# PATH additions (by [path] priority; later lines win)"
+    )
+    .unwrap();
+    let (appends, prepends) = split(entries);
+    for dir in prepends.iter().rev() {
+        let dir = fish_quote(&dir.display().to_string());
+        writeln!(
+            script,
+            "contains -- {dir} $PATH; or set -gx PATH {dir} $PATH"
+        )
+        .unwrap();
+    }
+    for dir in appends {
+        let dir = fish_quote(&dir.display().to_string());
+        writeln!(
+            script,
+            "contains -- {dir} $PATH; or set -gx PATH $PATH {dir}"
+        )
+        .unwrap();
+    }
+    script
+}
+
+/// nushell: one `prepend` of the list (and one `append` of the
+/// appended directories), then `uniq` so re-sourcing doesn't grow
+/// `$env.PATH`.
+pub fn generate_nu_exports(entries: &[(PathBuf, PathPosition)]) -> String {
+    let mut script = String::new();
+    header(&mut script);
+    if entries.is_empty() {
+        writeln!(script, "# No PATH additions.").unwrap();
+        return script;
+    }
+    writeln!(
+        script,
+        "# PATH additions (by [path] priority; first entry wins)"
+    )
+    .unwrap();
+    let (appends, prepends) = split(entries);
+    writeln!(
+        script,
+        "$env.PATH = ($env.PATH | split row (char esep) | prepend ["
+    )
+    .unwrap();
+    nu_list(&mut script, &prepends);
+    if appends.is_empty() {
+        writeln!(script, "] | uniq)").unwrap();
+    } else {
+        writeln!(script, "] | append [").unwrap();
+        nu_list(&mut script, &appends);
+        writeln!(script, "] | uniq)").unwrap();
+    }
+    script
+}
+
+fn nu_list(script: &mut String, dirs: &[&PathBuf]) {
+    for dir in dirs {
+        // JSON string escapes are valid nushell double-quoted strings.
+        let quoted = serde_json::to_string(&dir.display().to_string()).unwrap();
+        writeln!(script, "    {quoted}").unwrap();
+    }
+}
+
+/// `(appended, prepended)` directories, each in `$PATH` order.
+fn split(entries: &[(PathBuf, PathPosition)]) -> (Vec<&PathBuf>, Vec<&PathBuf>) {
+    let (appends, prepends): (Vec<_>, Vec<_>) = entries
+        .iter()
+        .partition(|(_, position)| *position == PathPosition::Append);
+    (
+        appends.into_iter().map(|(dir, _)| dir).collect(),
+        prepends.into_iter().map(|(dir, _)| dir).collect(),
+    )
+}
+
+/// Single-quote for fish, where only `\` and `'` are special inside
+/// single quotes.
+pub(crate) fn fish_quote(s: &str) -> String {
+    format!("'{}'", s.replace('\\', "\\\\").replace('\'', "\\'"))
+}
+
+/// Executables (any `x` bit, symlinks followed) in `entries`, keyed by
+/// command name. The first directory that has a name wins, matching
+/// `$PATH` lookup.
+fn collect_commands(fs: &dyn Fs, entries: &[PathBuf]) -> Result<BTreeMap<String, PathBuf>> {
+    let mut commands = BTreeMap::new();
+    for dir in entries {
+        if !fs.is_dir(dir) {
+            continue;
+        }
+        for entry in fs.read_dir(dir)? {
+            if commands.contains_key(&entry.name) || entry.name.starts_with('.') {
+                continue;
+            }
+            let Ok(meta) = fs.stat(&entry.path) else {
+                continue;
+            };
+            if meta.is_file && meta.mode & 0o111 != 0 {
+                commands.insert(entry.name, entry.path);
+            }
+        }
+    }
+    Ok(commands)
+}
+
+fn shim_script(target: &Path) -> String {
+    format!(
+        "#!/bin/sh\n{SHIM_MARKER} — regenerated on every `dodot up` / `dodot down`.\nexec {} \"$@\"\n",
+        sh_quote(&target.display().to_string())
+    )
+}
+
+/// Make `shim_dir` hold exactly one shim per entry of `commands`.
+/// Files without [`SHIM_MARKER`] are never touched.
+fn sync_shims(fs: &dyn Fs, shim_dir: &Path, commands: &BTreeMap<String, PathBuf>) -> Result<()> {
+    if fs.is_dir(shim_dir) {
+        for entry in fs.read_dir(shim_dir)? {
+            if commands.contains_key(&entry.name) || !is_shim(fs, &entry.path) {
+                continue;
+            }
+            fs.remove_file(&entry.path)?;
+        }
+    }
+    if commands.is_empty() {
+        return Ok(());
+    }
+
+    fs.mkdir_all(shim_dir)?;
+    for (name, target) in commands {
+        let path = shim_dir.join(name);
+        if fs.exists(&path) && !is_shim(fs, &path) {
+            // A user file in the shim dir shadows the command; leave it.
+            continue;
+        }
+        fs.write_file_with_mode(&path, shim_script(target).as_bytes(), 0o755)?;
+    }
+    Ok(())
+}
+
+fn is_shim(fs: &dyn Fs, path: &Path) -> bool {
+    fs.read_to_string(path)
+        .map(|text| {
+            text.lines()
+                .nth(1)
+                .is_some_and(|l| l.starts_with(SHIM_MARKER))
+        })
+        .unwrap_or(false)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::datastore::{DataStore, FilesystemDataStore, NoopCommandRunner};
+    use crate::shell::PathPlacement;
+    use crate::testing::TempEnvironment;
+    use std::sync::Arc;
+
+    fn env_with_bins() -> TempEnvironment {
+        TempEnvironment::builder()
+            .pack("tools")
+            .file_with_mode("bin/hello", "#!/bin/sh\necho hi\n", 0o755)
+            .file_with_mode("bin/README", "not a command", 0o644)
+            .done()
+            .pack("work")
+            .file_with_mode("bin/hello", "#!/bin/sh\necho work\n", 0o755)
+            .done()
+            .build()
+    }
+
+    fn deploy_bins(env: &TempEnvironment) {
+        let ds = FilesystemDataStore::new(
+            env.fs.clone(),
+            env.paths.clone(),
+            Arc::new(NoopCommandRunner),
+        );
+        for pack in ["tools", "work"] {
+            ds.create_data_link(pack, "path", &env.dotfiles_root.join(pack).join("bin"))
+                .unwrap();
+        }
+    }
+
+    #[test]
+    fn fish_and_nu_exports_follow_path_order() {
+        let entries = vec![
+            (PathBuf::from("/a/bin"), PathPosition::Prepend),
+            (PathBuf::from("/b/it's"), PathPosition::Prepend),
+            (PathBuf::from("/c/fallback"), PathPosition::Append),
+        ];
+
+        let fish = generate_fish_exports(&entries);
+        let a = fish.find("'/a/bin'").unwrap();
+        let b = fish.find("'/b/it\\'s'").unwrap();
+        assert!(b < a, "first entry must be prepended last:\n{fish}");
+        assert!(
+            fish.contains("or set -gx PATH $PATH '/c/fallback'"),
+            "{fish}"
+        );
+
+        let nu = generate_nu_exports(&entries);
+        assert!(nu.contains("prepend ["), "{nu}");
+        assert!(
+            nu.find("\"/a/bin\"").unwrap() < nu.find("\"/b/it's\"").unwrap(),
+            "{nu}"
+        );
+        assert!(
+            nu.find("append [").unwrap() < nu.find("\"/c/fallback\"").unwrap(),
+            "{nu}"
+        );
+    }
+
+    #[test]
+    fn shims_wrap_executables_and_priority_wins() {
+        let env = env_with_bins();
+        deploy_bins(&env);
+        let mut priorities = PathPriorities::new();
+        priorities.insert(
+            "work".into(),
+            PathPlacement {
+                priority: 10,
+                ..Default::default()
+            },
+        );
+
+        write_path_exports(env.fs.as_ref(), env.paths.as_ref(), &priorities, true).unwrap();
+
+        let shim_dir = env.paths.shim_dir();
+        let hello = env.fs.read_to_string(&shim_dir.join("hello")).unwrap();
+        assert!(hello.contains("work/bin/hello"), "{hello}");
+        assert!(!env.fs.exists(&shim_dir.join("README")));
+        assert!(env.fs.exists(&env.paths.init_script_fish_path()));
+        assert!(env.fs.exists(&env.paths.init_script_nu_path()));
+    }
+
+    #[test]
+    fn disabling_shims_removes_only_dodot_shims() {
+        let env = env_with_bins();
+        deploy_bins(&env);
+        let priorities = PathPriorities::new();
+        write_path_exports(env.fs.as_ref(), env.paths.as_ref(), &priorities, true).unwrap();
+        let shim_dir = env.paths.shim_dir();
+        env.fs
+            .write_file(&shim_dir.join("mine"), b"#!/bin/sh\necho mine\n")
+            .unwrap();
+
+        write_path_exports(env.fs.as_ref(), env.paths.as_ref(), &priorities, false).unwrap();
+
+        assert!(!env.fs.exists(&shim_dir.join("hello")));
+        assert!(env.fs.exists(&shim_dir.join("mine")));
+    }
+}
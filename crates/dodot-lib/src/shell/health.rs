@@ -0,0 +1,248 @@
+//! Shell-integration health checks.
+//!
+//! A broken shell integration is easy to miss: the rc line keeps
+//! sourcing whatever is there, files that moved are skipped by the
+//! `[ -f … ]` guards, and the shell starts fine minus half the
+//! aliases. So the generated init script carries a few cheap checks
+//! (builtins only, no forks) that print one line on stderr when
+//! something is off:
+//!
+//! - the data directory is gone (wiped, or a different `$XDG_DATA_HOME`)
+//! - the deployment map is missing or older than the init script — an
+//!   `up` / `down` that died between writing the two
+//! - a sourced file or PATH directory no longer exists (the pack file
+//!   was renamed or deleted without another `up`)
+//!
+//! Only the first problem found is reported, with the fix. [`check`]
+//! runs the same checks (and a couple that a running script can't
+//! make about itself) for `dodot doctor --shell`, reporting all of
+//! them.
+
+use std::fmt::Write;
+use std::path::{Path, PathBuf};
+
+use serde::Serialize;
+
+use super::{collect_entries, init_script_is_complete, sh_quote, PathPriorities};
+use crate::fs::Fs;
+use crate::paths::Pather;
+use crate::Result;
+
+/// The command every shell-health problem is fixed by.
+pub const FIX: &str = "dodot up";
+
+/// One problem with the shell integration.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct HealthIssue {
+    pub problem: String,
+    pub fix: String,
+}
+
+impl HealthIssue {
+    fn new(problem: String) -> Self {
+        Self {
+            problem,
+            fix: FIX.to_string(),
+        }
+    }
+}
+
+/// Every shell-integration problem on this machine, in the order the
+/// init script checks them.
+pub fn check(fs: &dyn Fs, paths: &dyn Pather) -> Result<Vec<HealthIssue>> {
+    let data_dir = paths.data_dir();
+    if !fs.is_dir(data_dir) {
+        return Ok(vec![HealthIssue::new(format!(
+            "data directory {} is missing",
+            data_dir.display()
+        ))]);
+    }
+
+    let mut issues = Vec::new();
+    let (sources, path_additions) = collect_entries(fs, paths, &PathPriorities::new())?;
+    let deployed = !sources.is_empty() || !path_additions.is_empty();
+
+    let init = paths.init_script_path();
+    let map = paths.deployment_map_path();
+    if !fs.exists(&init) {
+        if deployed {
+            issues.push(HealthIssue::new(format!(
+                "init script {} is missing",
+                init.display()
+            )));
+        }
+    } else if !fs
+        .read_to_string(&init)
+        .map(|content| init_script_is_complete(&content))
+        .unwrap_or(false)
+    {
+        issues.push(HealthIssue::new(format!(
+            "init script {} is incomplete",
+            init.display()
+        )));
+    }
+    if deployed && !fs.exists(&map) {
+        issues.push(HealthIssue::new(format!(
+            "deployment metadata is stale: {} is missing",
+            map.display()
+        )));
+    } else if fs.exists(&init) && fs.exists(&map) && newer_than(fs, &init, &map) {
+        issues.push(HealthIssue::new(format!(
+            "deployment metadata is stale: {} is older than the init script",
+            map.display()
+        )));
+    }
+
+    for (pack, target, _) in &sources {
+        if !fs.exists(target) {
+            issues.push(HealthIssue::new(format!(
+                "sourced file missing: {} [{pack}]",
+                target.display()
+            )));
+        }
+    }
+    for (_, pack, target, _) in &path_additions {
+        if !fs.exists(target) {
+            issues.push(HealthIssue::new(format!(
+                "PATH directory missing: {} [{pack}]",
+                target.display()
+            )));
+        }
+    }
+    Ok(issues)
+}
+
+/// `a` modified after `b`. Unreadable mtimes compare as not newer.
+fn newer_than(fs: &dyn Fs, a: &Path, b: &Path) -> bool {
+    match (fs.modified(a), fs.modified(b)) {
+        (Ok(a), Ok(b)) => a > b,
+        _ => false,
+    }
+}
+
+/// Emit the startup check. `targets` are the files and directories
+/// the script goes on to source or put on `$PATH`.
+pub(super) fn emit_health_check(script: &mut String, paths: &dyn Pather, targets: &[&PathBuf]) {
+    let data_dir = paths.data_dir().display().to_string();
+    let map = paths.deployment_map_path().display().to_string();
+    let init = paths.init_script_path().display().to_string();
+
+    writeln!(
+        script,
+        "# Health check: one line on stderr if the integration is broken."
+    )
+    .unwrap();
+    writeln!(script, "_dodot_health=").unwrap();
+    writeln!(script, "if [ ! -d {} ]; then", sh_quote(&data_dir)).unwrap();
+    writeln!(
+        script,
+        "  _dodot_health={}",
+        sh_quote(&format!("data directory {data_dir} is missing"))
+    )
+    .unwrap();
+    writeln!(
+        script,
+        "elif [ ! -f {m} ] || [ {i} -nt {m} ]; then",
+        m = sh_quote(&map),
+        i = sh_quote(&init)
+    )
+    .unwrap();
+    writeln!(script, "  _dodot_health='deployment metadata is stale'").unwrap();
+    if !targets.is_empty() {
+        writeln!(script, "else").unwrap();
+        write!(script, "  for _dodot_f in").unwrap();
+        for target in targets {
+            write!(script, " {}", sh_quote(&target.display().to_string())).unwrap();
+        }
+        writeln!(script, "; do").unwrap();
+        writeln!(
+            script,
+            "    [ -e \"$_dodot_f\" ] || {{ _dodot_health=\"missing $_dodot_f\"; break; }}"
+        )
+        .unwrap();
+        writeln!(script, "  done").unwrap();
+    }
+    writeln!(script, "fi").unwrap();
+    writeln!(
+        script,
+        "[ -n \"$_dodot_health\" ] && echo \"dodot: $_dodot_health; run '{FIX}' (details: dodot doctor --shell)\" >&2"
+    )
+    .unwrap();
+    writeln!(script, "unset _dodot_health _dodot_f").unwrap();
+    writeln!(script).unwrap();
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::datastore::{CommandOutput, CommandRunner, DataStore, FilesystemDataStore};
+    use crate::testing::TempEnvironment;
+    use std::sync::Arc;
+
+    struct NoopRunner;
+    impl CommandRunner for NoopRunner {
+        fn run(&self, _: &str, _: &[String]) -> Result<CommandOutput> {
+            Ok(CommandOutput {
+                exit_code: 0,
+                stdout: String::new(),
+                stderr: String::new(),
+            })
+        }
+    }
+
+    fn startup_stderr(env: &TempEnvironment) -> String {
+        let script = super::super::generate_init_script(
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            false,
+            &PathPriorities::new(),
+        )
+        .unwrap();
+        let out = std::process::Command::new("sh")
+            .arg("-c")
+            .arg(script)
+            .output()
+            .unwrap();
+        String::from_utf8_lossy(&out.stderr).into_owned()
+    }
+
+    #[test]
+    fn startup_check_and_doctor_agree() {
+        let env = TempEnvironment::builder()
+            .pack("git")
+            .file("aliases.sh", "alias g=git")
+            .done()
+            .build();
+        let ds = FilesystemDataStore::new(env.fs.clone(), env.paths.clone(), Arc::new(NoopRunner));
+        let source = env.dotfiles_root.join("git/aliases.sh");
+        ds.create_data_link("git", "shell", &source).unwrap();
+        let (fs, paths) = (env.fs.as_ref(), env.paths.as_ref());
+
+        // Nothing written by an `up` yet: no map, no init script.
+        assert!(startup_stderr(&env).contains("deployment metadata is stale"));
+        let problems: Vec<String> = check(fs, paths)
+            .unwrap()
+            .into_iter()
+            .map(|i| i.problem)
+            .collect();
+        assert_eq!(problems.len(), 2, "{problems:?}");
+
+        super::super::write_init_script(fs, paths, false, &PathPriorities::new()).unwrap();
+        crate::probe::write_deployment_map(fs, paths).unwrap();
+        assert_eq!(startup_stderr(&env), "");
+        assert!(check(fs, paths).unwrap().is_empty());
+
+        // The pack file goes away behind dodot's back.
+        fs.remove_file(&source).unwrap();
+        let stderr = startup_stderr(&env);
+        assert!(
+            stderr.contains(&format!("missing {}", source.display())),
+            "{stderr}"
+        );
+        assert!(stderr.contains("run 'dodot up'"), "{stderr}");
+        assert_eq!(stderr.lines().count(), 1);
+        let issues = check(fs, paths).unwrap();
+        assert_eq!(issues.len(), 1);
+        assert!(issues[0].problem.contains("sourced file missing"));
+    }
+}
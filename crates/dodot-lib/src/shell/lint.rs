@@ -0,0 +1,431 @@
+//! Optional shellcheck pass over shell profiles and install scripts.
+//!
+//! The syntax check in [`super::validate`] only asks whether a file
+//! parses. With `--lint` (or `[lint] enabled`), `up` and `provision`
+//! also run `shellcheck` over the planned shell sources and install
+//! scripts, before anything executes, and report what it finds as
+//! warnings — one line per finding, with its severity and `SC` code.
+//!
+//! Linting never blocks a run unless it is strict (`--strict`, or
+//! `[lint] strict`): then any finding stops the run the way a failed
+//! pre-flight check does. A missing `shellcheck` is one notice, never
+//! a failure. `.zsh` files are left out; shellcheck doesn't speak zsh.
+//!
+//! `shellcheck` goes through the context's
+//! [`CommandRunner`](crate::datastore::CommandRunner), so tests can
+//! answer for it.
+
+use std::path::{Path, PathBuf};
+
+use serde::Deserialize;
+
+use crate::config::LintSection;
+use crate::datastore::CommandRunner;
+use crate::fs::Fs;
+use crate::handlers::{HANDLER_INSTALL, HANDLER_SHELL};
+use crate::operations::HandlerIntent;
+use crate::{DodotError, Result};
+
+/// Severities shellcheck's `--severity` accepts, most severe first.
+pub const SEVERITIES: &[&str] = &["error", "warning", "info", "style"];
+
+/// Lint settings for one run, from the command line. `[lint]` in the
+/// root config can turn both on as well; see [`Self::resolve`].
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub struct LintOptions {
+    /// `--lint`.
+    pub enabled: bool,
+    /// `--strict`: findings fail the run. Implies `enabled`.
+    pub strict: bool,
+}
+
+impl LintOptions {
+    /// These options with the config's switched on too.
+    pub fn resolve(self, config: &LintSection) -> Self {
+        let enabled = self.enabled || self.strict || config.enabled;
+        Self {
+            enabled,
+            strict: self.strict || (enabled && config.strict),
+        }
+    }
+}
+
+/// Reject a `[lint]` severity shellcheck wouldn't take, at config load.
+pub fn check_config(config: &LintSection) -> Result<()> {
+    if !SEVERITIES.contains(&config.severity.as_str()) {
+        return Err(DodotError::Config(format!(
+            "invalid `[lint] severity = {:?}`: expected one of {}",
+            config.severity,
+            SEVERITIES.join(", ")
+        )));
+    }
+    Ok(())
+}
+
+/// One shellcheck comment.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct LintFinding {
+    pub pack: String,
+    pub file: PathBuf,
+    pub line: u64,
+    pub column: u64,
+    /// `error`, `warning`, `info` or `style`.
+    pub level: String,
+    /// The `SC` number.
+    pub code: u32,
+    pub message: String,
+}
+
+/// What a lint pass found.
+#[derive(Debug, Default)]
+pub struct LintReport {
+    /// Files shellcheck looked at.
+    pub checked: usize,
+    pub findings: Vec<LintFinding>,
+    /// Files shellcheck couldn't check, one line each.
+    pub failures: Vec<String>,
+    /// `shellcheck` isn't installed; nothing was checked.
+    pub missing: bool,
+}
+
+impl LintReport {
+    /// One line per finding, paths relative to `root` where they can
+    /// be.
+    pub fn finding_lines(&self, root: &Path) -> Vec<String> {
+        self.findings
+            .iter()
+            .map(|f| {
+                format!(
+                    "lint: {}: {}:{}:{}: {} SC{}: {}",
+                    f.pack,
+                    f.file.strip_prefix(root).unwrap_or(&f.file).display(),
+                    f.line,
+                    f.column,
+                    f.level,
+                    f.code,
+                    f.message
+                )
+            })
+            .collect()
+    }
+
+    /// Everything worth telling the user, findings first.
+    pub fn warnings(&self, root: &Path) -> Vec<String> {
+        let mut out = self.finding_lines(root);
+        out.extend(self.failures.iter().map(|f| format!("lint: {f}")));
+        if self.missing {
+            out.push("lint: `shellcheck` not on PATH, skipped linting".into());
+        }
+        out
+    }
+}
+
+/// The files a lint pass covers: staged shell sources and install
+/// scripts, as `(pack, file)`, in plan order.
+pub fn targets(pack_intents: &[(String, Vec<HandlerIntent>)]) -> Vec<(String, PathBuf)> {
+    let mut out = Vec::new();
+    for (pack, intents) in pack_intents {
+        for intent in intents {
+            let file = match intent {
+                HandlerIntent::Stage {
+                    handler, source, ..
+                } if handler == HANDLER_SHELL => source.clone(),
+                HandlerIntent::Run {
+                    handler, arguments, ..
+                } if handler == HANDLER_INSTALL => match arguments.last() {
+                    Some(script) => PathBuf::from(script),
+                    None => continue,
+                },
+                _ => continue,
+            };
+            let lintable = matches!(
+                file.extension().and_then(|e| e.to_str()),
+                Some("sh" | "bash")
+            );
+            if lintable && !out.iter().any(|(_, f)| *f == file) {
+                out.push((pack.clone(), file));
+            }
+        }
+    }
+    out
+}
+
+#[derive(Deserialize)]
+struct Json1 {
+    comments: Vec<Comment>,
+}
+
+#[derive(Deserialize)]
+struct Comment {
+    line: u64,
+    column: u64,
+    level: String,
+    code: u32,
+    message: String,
+}
+
+/// Run shellcheck over every [`targets`] file at `severity` or above.
+pub fn lint(
+    pack_intents: &[(String, Vec<HandlerIntent>)],
+    severity: &str,
+    fs: &dyn Fs,
+    runner: &dyn CommandRunner,
+) -> LintReport {
+    let mut report = LintReport::default();
+    let files = targets(pack_intents);
+    if files.is_empty() {
+        return report;
+    }
+    if runner.find_executable("shellcheck").is_none() {
+        report.missing = true;
+        return report;
+    }
+    for (pack, file) in files {
+        let mut arguments = vec![
+            "--format=json1".to_string(),
+            format!("--severity={severity}"),
+        ];
+        // A sourced profile has no shebang to name its dialect, and
+        // shellcheck's fallback is strict POSIX sh. Profiles are read
+        // by bash or zsh, so bash is the closer guess.
+        let has_shebang = fs.read_file(&file).is_ok_and(|b| b.starts_with(b"#!"));
+        if !has_shebang {
+            arguments.push("--shell=bash".into());
+        }
+        arguments.push(file.to_string_lossy().into_owned());
+        report.checked += 1;
+
+        // Exit 1 means "found something"; anything past that is
+        // shellcheck failing to check the file at all.
+        let output = match runner.run_bytes("shellcheck", &arguments) {
+            Ok(out) if matches!(out.exit_code, 0 | 1) => out,
+            Ok(out) => {
+                let why = out.stderr.lines().next().unwrap_or_default().to_string();
+                report.failures.push(format!(
+                    "{pack}: {}: shellcheck exited with {}: {why}",
+                    file.display(),
+                    out.exit_code
+                ));
+                continue;
+            }
+            Err(e) => {
+                report
+                    .failures
+                    .push(format!("{pack}: {}: {e}", file.display()));
+                continue;
+            }
+        };
+        match serde_json::from_slice::<Json1>(&output.stdout) {
+            Ok(parsed) => {
+                report
+                    .findings
+                    .extend(parsed.comments.into_iter().map(|c| LintFinding {
+                        pack: pack.clone(),
+                        file: file.clone(),
+                        line: c.line,
+                        column: c.column,
+                        level: c.level,
+                        code: c.code,
+                        message: c.message,
+                    }))
+            }
+            Err(e) => report.failures.push(format!(
+                "{pack}: {}: unreadable shellcheck output: {e}",
+                file.display()
+            )),
+        }
+    }
+    report
+}
+
+/// Lint per `options` and the root `[lint]` config. Returns the lines
+/// to show as warnings; a strict run with findings fails instead,
+/// except as a dry run, which only shows them.
+pub fn run(
+    pack_intents: &[(String, Vec<HandlerIntent>)],
+    options: LintOptions,
+    config: &LintSection,
+    fs: &dyn Fs,
+    runner: &dyn CommandRunner,
+    dotfiles_root: &Path,
+    dry_run: bool,
+) -> Result<Vec<String>> {
+    let options = options.resolve(config);
+    if !options.enabled {
+        return Ok(Vec::new());
+    }
+    let report = lint(pack_intents, &config.severity, fs, runner);
+    if options.strict && !dry_run && !report.findings.is_empty() {
+        return Err(DodotError::PreflightFailed {
+            problems: report.finding_lines(dotfiles_root),
+        });
+    }
+    Ok(report.warnings(dotfiles_root))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::datastore::CommandOutput;
+    use crate::fs::OsFs;
+    use std::sync::Mutex;
+
+    /// Answers `shellcheck` with canned JSON per file name.
+    struct Shellcheck {
+        installed: bool,
+        calls: Mutex<Vec<Vec<String>>>,
+    }
+
+    impl Shellcheck {
+        fn new(installed: bool) -> Self {
+            Self {
+                installed,
+                calls: Mutex::new(Vec::new()),
+            }
+        }
+    }
+
+    impl CommandRunner for Shellcheck {
+        fn run(&self, _: &str, args: &[String]) -> Result<CommandOutput> {
+            self.calls.lock().unwrap().push(args.to_vec());
+            let file = args.last().unwrap();
+            let (exit_code, stdout) = if file.ends_with("aliases.sh") {
+                (
+                    1,
+                    r#"{"comments":[{"file":"aliases.sh","line":3,"endLine":3,"column":7,"endColumn":9,"level":"warning","code":2086,"message":"Double quote to prevent globbing and word splitting.","fix":null}]}"#,
+                )
+            } else {
+                (0, r#"{"comments":[]}"#)
+            };
+            Ok(CommandOutput {
+                exit_code,
+                stdout: stdout.into(),
+                stderr: String::new(),
+            })
+        }
+
+        fn find_executable(&self, name: &str) -> Option<PathBuf> {
+            self.installed.then(|| PathBuf::from(name))
+        }
+    }
+
+    fn plan() -> Vec<(String, Vec<HandlerIntent>)> {
+        vec![(
+            "shell".into(),
+            vec![
+                HandlerIntent::Stage {
+                    pack: "shell".into(),
+                    handler: HANDLER_SHELL.into(),
+                    source: "/dots/shell/aliases.sh".into(),
+                },
+                HandlerIntent::Stage {
+                    pack: "shell".into(),
+                    handler: HANDLER_SHELL.into(),
+                    source: "/dots/shell/prompt.zsh".into(),
+                },
+                HandlerIntent::Run {
+                    pack: "shell".into(),
+                    handler: HANDLER_INSTALL.into(),
+                    executable: "bash".into(),
+                    arguments: vec!["--".into(), "/dots/shell/install.sh".into()],
+                    sentinel: "install.sh-0123".into(),
+                    filename: "install.sh".into(),
+                    content_hash: "0123".into(),
+                },
+            ],
+        )]
+    }
+
+    fn config() -> LintSection {
+        LintSection {
+            enabled: false,
+            strict: false,
+            severity: "warning".into(),
+        }
+    }
+
+    #[test]
+    fn shell_sources_and_install_scripts_are_linted_but_not_zsh() {
+        let runner = Shellcheck::new(true);
+        let report = lint(&plan(), "warning", &OsFs, &runner);
+        assert_eq!(report.checked, 2);
+        let calls = runner.calls.lock().unwrap();
+        assert!(calls[0].contains(&"--severity=warning".to_string()));
+        assert!(calls[0].contains(&"--shell=bash".to_string()));
+        assert_eq!(calls[1].last().unwrap(), "/dots/shell/install.sh");
+        assert_eq!(
+            report.warnings(Path::new("/dots")),
+            vec![
+                "lint: shell: shell/aliases.sh:3:7: warning SC2086: \
+                  Double quote to prevent globbing and word splitting."
+            ]
+        );
+    }
+
+    #[test]
+    fn findings_only_fail_a_strict_run() {
+        let runner = Shellcheck::new(true);
+        let root = Path::new("/dots");
+        let off = run(
+            &plan(),
+            LintOptions::default(),
+            &config(),
+            &OsFs,
+            &runner,
+            root,
+            false,
+        );
+        assert!(off.unwrap().is_empty());
+        assert!(runner.calls.lock().unwrap().is_empty(), "not enabled");
+
+        let lint = LintOptions {
+            enabled: true,
+            strict: false,
+        };
+        assert_eq!(
+            run(&plan(), lint, &config(), &OsFs, &runner, root, false)
+                .unwrap()
+                .len(),
+            1
+        );
+
+        let strict = LintOptions {
+            enabled: false,
+            strict: true,
+        };
+        let err = run(&plan(), strict, &config(), &OsFs, &runner, root, false).unwrap_err();
+        assert!(matches!(err, DodotError::PreflightFailed { .. }), "{err}");
+        // A dry run shows what a strict run would stop on.
+        assert_eq!(
+            run(&plan(), strict, &config(), &OsFs, &runner, root, true)
+                .unwrap()
+                .len(),
+            1
+        );
+
+        // `[lint] strict` only matters once linting is on.
+        let mut cfg = config();
+        cfg.strict = true;
+        assert_eq!(LintOptions::default().resolve(&cfg), LintOptions::default());
+        cfg.enabled = true;
+        assert!(LintOptions::default().resolve(&cfg).strict);
+    }
+
+    #[test]
+    fn missing_shellcheck_is_one_notice() {
+        let runner = Shellcheck::new(false);
+        let report = lint(&plan(), "warning", &OsFs, &runner);
+        assert!(report.missing);
+        assert_eq!(report.checked, 0);
+        assert_eq!(report.warnings(Path::new("/")).len(), 1);
+    }
+
+    #[test]
+    fn severity_must_be_one_shellcheck_knows() {
+        let mut cfg = config();
+        assert!(check_config(&cfg).is_ok());
+        cfg.severity = "pedantic".into();
+        let err = check_config(&cfg).unwrap_err().to_string();
+        assert!(err.contains("error, warning, info, style"), "{err}");
+    }
+}
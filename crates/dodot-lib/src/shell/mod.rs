@@ -36,7 +36,29 @@
 //! in the sourced file, which is a behavioural surprise nobody asked
 //! for. We pay the price of a slightly longer script in exchange for
 //! semantic equivalence with the un-instrumented form.
+//!
+//! # Lazy sources
+//!
+//! A shell file whose leading comment block carries
+//!
+//! ```sh
+//! # dodot: lazy=kubectl,helm
+//! ```
+//!
+//! is not sourced at startup. The script defines a stub function per
+//! named command instead; the first call to any of them removes every
+//! stub, sources the file, and re-runs the call. That is the one place
+//! we *do* source inside a function — the file opted in, and the
+//! scoping caveat is documented for it. Lazy files are not timed by
+//! the profiling wrapper, since they cost nothing at startup.
+//!
+//! # Health check
+//!
+//! Every script opens with a few builtin-only tests that print one
+//! line on stderr when the integration itself is broken — see
+//! [`health`].
 
+use std::collections::HashMap;
 use std::fmt::Write;
 use std::path::{Path, PathBuf};
 
@@ -44,12 +66,123 @@ use crate::fs::Fs;
 use crate::paths::Pather;
 use crate::Result;
 
+pub mod checksum;
+pub mod exports;
+pub mod health;
+pub mod lint;
 pub mod validate;
+pub use checksum::{changed_since_linked, record_source_checksums, CHECKSUMS_SUBDIR};
+pub use exports::write_path_exports;
+pub use lint::LintOptions;
 pub use validate::{
     error_sidecar_path, validate_shell_sources, NoopSyntaxChecker, ShellValidationFailure,
     ShellValidationReport, SyntaxCheckResult, SyntaxChecker, SystemSyntaxChecker, ERRORS_SUBDIR,
 };
 
+/// Per-pack `[path]` placement, keyed by the on-disk pack directory
+/// name (the datastore key). Packs absent from the map sort at
+/// priority 0 and prepend. Built by
+/// [`orchestration::path_priorities`](crate::packs::orchestration::path_priorities).
+pub type PathPriorities = HashMap<String, PathPlacement>;
+
+/// Which end of `$PATH` a directory goes on (`[path] position`).
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub enum PathPosition {
+    /// Ahead of the system's directories: the pack's commands win.
+    #[default]
+    Prepend,
+    /// After them: a fallback, found only when nothing else provides
+    /// the command.
+    Append,
+}
+
+impl PathPosition {
+    pub fn parse(value: &str) -> Option<Self> {
+        match value {
+            "prepend" => Some(Self::Prepend),
+            "append" => Some(Self::Append),
+            _ => None,
+        }
+    }
+
+    pub fn as_str(self) -> &'static str {
+        match self {
+            Self::Prepend => "prepend",
+            Self::Append => "append",
+        }
+    }
+}
+
+/// One pack's `[path]` settings that shape its PATH lines.
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct PathPlacement {
+    pub priority: i32,
+    /// `[path] position`: where directories without their own entry go.
+    pub position: PathPosition,
+    /// `[path.positions]`, keyed by the directory's path in the pack.
+    pub positions: HashMap<String, PathPosition>,
+    /// `path_priority` of the pack's `path` rules as `(pattern,
+    /// priority)`, in the order the scanner tries them.
+    pub rule_priorities: Vec<(String, i32)>,
+}
+
+impl PathPlacement {
+    /// Read a pack's `[path]` section. Values were checked at config
+    /// load; anything unparseable falls back to prepending.
+    pub fn from_config(section: &crate::config::PathSection) -> Self {
+        Self {
+            priority: section.priority,
+            position: PathPosition::parse(&section.position).unwrap_or_default(),
+            positions: section
+                .positions
+                .iter()
+                .map(|(dir, pos)| {
+                    let dir = dir.trim_end_matches('/').to_string();
+                    (dir, PathPosition::parse(pos).unwrap_or_default())
+                })
+                .collect(),
+            rule_priorities: Vec::new(),
+        }
+    }
+
+    /// Take `path_priority` from the pack's `[[rules]]` routing to the
+    /// `path` handler. Rules were validated at config load.
+    pub fn with_rules(mut self, rules: &[crate::config::RuleSpec]) -> Self {
+        let mut found: Vec<(i32, String, i32)> = rules
+            .iter()
+            .filter(|r| r.handler == crate::handlers::HANDLER_PATH)
+            .filter_map(|r| {
+                let value = r
+                    .options
+                    .get(crate::handlers::options::OPTION_PATH_PRIORITY)?
+                    .as_integer()?;
+                let rank = r.priority.unwrap_or(crate::config::DEFAULT_RULE_PRIORITY);
+                Some((rank, r.pattern.clone(), i32::try_from(value).ok()?))
+            })
+            .collect();
+        found.sort_by(|a, b| b.0.cmp(&a.0));
+        self.rule_priorities = found.into_iter().map(|(_, p, v)| (p, v)).collect();
+        self
+    }
+
+    /// Priority of the entry `name` (a directory, or a staged file):
+    /// the first matching rule's `path_priority`, else `[path] priority`.
+    pub fn priority_for(&self, name: &str, is_dir: bool) -> i32 {
+        self.rule_priorities
+            .iter()
+            .find(|(pattern, _)| crate::rules::pattern_matches(pattern, name, is_dir))
+            .map_or(self.priority, |(_, priority)| *priority)
+    }
+
+    /// Position of the directory at `relative` (its path in the pack).
+    pub fn position_for(&self, relative: &str) -> PathPosition {
+        self.positions
+            .get(relative.trim_end_matches('/'))
+            .copied()
+            .unwrap_or(self.position)
+    }
+}
+
 /// Append the "nothing to do" notice for an empty init script.
 fn append_empty_notice(script: &mut String) {
     writeln!(script, "# No shell scripts or PATH additions to load.").unwrap();
@@ -65,14 +198,46 @@ fn append_empty_notice(script: &mut String) {
 /// Scans the datastore for:
 /// - `packs/*/shell/*` — symlinks to shell scripts → `source` lines
 /// - `packs/*/path/*` — symlinks to directories → `PATH=` lines
+/// - `packs/*/download/bin` — the download handler's bin dir → `PATH=` line
 ///
 /// When `profiling_enabled` is true and there is at least one entry to
 /// emit, the script also carries the per-line timing wrapper described
 /// in the module docs.
+///
+/// PATH lines are ordered deterministically from `path_priorities`:
+/// the resulting `$PATH` lists higher-priority packs first, ties
+/// broken by pack name. Prepending lines are emitted in the reverse of
+/// that order — the last line wins lookup — and directories placed
+/// with `position = "append"` follow in order, after the system's.
+///
+/// The last line is always [`INIT_SCRIPT_END`], so a file cut short by
+/// a crash can be told apart from a complete one.
 pub fn generate_init_script(
     fs: &dyn Fs,
     paths: &dyn Pather,
     profiling_enabled: bool,
+    path_priorities: &PathPriorities,
+) -> Result<String> {
+    let mut script = generate_init_body(fs, paths, profiling_enabled, path_priorities)?;
+    writeln!(script, "{INIT_SCRIPT_END}").unwrap();
+    Ok(script)
+}
+
+/// Trailer line of every generated init script.
+pub const INIT_SCRIPT_END: &str = "# end of dodot init script";
+
+/// Whether `content` is a complete init script (ends with
+/// [`INIT_SCRIPT_END`]). Scripts written before the trailer existed
+/// read as incomplete and get regenerated once — harmless.
+pub fn init_script_is_complete(content: &str) -> bool {
+    content.trim_end().ends_with(INIT_SCRIPT_END)
+}
+
+fn generate_init_body(
+    fs: &dyn Fs,
+    paths: &dyn Pather,
+    profiling_enabled: bool,
+    path_priorities: &PathPriorities,
 ) -> Result<String> {
     let mut script = String::new();
 
@@ -81,19 +246,108 @@ pub fn generate_init_script(
     writeln!(script, "# Regenerated on every `dodot up` / `dodot down`.").unwrap();
     writeln!(script).unwrap();
 
+    let (shell_sources, path_additions) = collect_entries(fs, paths, path_priorities)?;
+
+    let targets: Vec<&PathBuf> = path_additions
+        .iter()
+        .map(|(_, _, target, _)| target)
+        .chain(shell_sources.iter().map(|(_, target, _)| target))
+        .collect();
+    health::emit_health_check(&mut script, paths, &targets);
+
+    // If nothing is deployed, add an explanatory comment
+    if path_additions.is_empty() && shell_sources.is_empty() {
+        append_empty_notice(&mut script);
+        return Ok(script);
+    }
+
+    // Profiling preamble (only when enabled and there's at least one entry).
+    let profiling_active = profiling_enabled;
+    if profiling_active {
+        emit_profiling_preamble(
+            &mut script,
+            &paths.probes_shell_init_dir(),
+            &paths.init_script_path(),
+        );
+    }
+
+    // Emit PATH additions
+    if !path_additions.is_empty() {
+        writeln!(
+            script,
+            "# PATH additions (by [path] priority; later lines win)"
+        )
+        .unwrap();
+        for (_, pack, target, position) in &path_additions {
+            writeln!(script, "# [{pack}]").unwrap();
+            if profiling_active {
+                emit_timed_path(&mut script, pack, target, *position);
+            } else {
+                writeln!(script, "export {}", path_assignment(target, *position)).unwrap();
+            }
+        }
+        writeln!(script).unwrap();
+    }
+
+    // Emit shell sources
+    if !shell_sources.is_empty() {
+        writeln!(script, "# Shell scripts").unwrap();
+        let mut lazy_count = 0;
+        for (pack, target, lazy) in &shell_sources {
+            if !lazy.is_empty() {
+                lazy_count += 1;
+                emit_lazy_source(&mut script, pack, target, lazy, lazy_count);
+                continue;
+            }
+            writeln!(script, "# [{pack}]").unwrap();
+            if profiling_active {
+                emit_timed_source(&mut script, pack, target);
+            } else {
+                // Loud-failure wrapper: if the source command itself
+                // exits non-zero, print a dodot-attributed message to
+                // stderr alongside the shell's own error so the user
+                // can see *which* dodot-managed file failed. The
+                // shell's native message already carries the line
+                // number; we add the breadcrumb back to dodot.
+                writeln!(script, "{}", source_line(target)).unwrap();
+            }
+        }
+        writeln!(script).unwrap();
+    }
+
+    // Profiling epilogue (close the report, scrub our state).
+    if profiling_active {
+        emit_profiling_epilogue(&mut script);
+    }
+
+    Ok(script)
+}
+
+type ShellSources = Vec<(String, PathBuf, Vec<String>)>; // (pack, target, lazy commands)
+type PathAdditions = Vec<(i32, String, PathBuf, PathPosition)>; // (priority, pack, target, position)
+
+/// Shell sources as `(pack, target, lazy commands)` and PATH additions as
+/// `(priority, pack, target, position)` from the datastore. PATH
+/// additions come back in emit order: prepends in the reverse of the
+/// final `$PATH` order, since each POSIX line goes in front of the
+/// last, then appends in final order.
+fn collect_entries(
+    fs: &dyn Fs,
+    paths: &dyn Pather,
+    path_priorities: &PathPriorities,
+) -> Result<(ShellSources, PathAdditions)> {
     // Discover all packs with state
     let packs_dir = paths.data_dir().join("packs");
     if !fs.exists(&packs_dir) {
-        append_empty_notice(&mut script);
-        return Ok(script);
+        return Ok((Vec::new(), Vec::new()));
     }
 
     let pack_entries = fs.read_dir(&packs_dir)?;
 
     // Collect shell sources and path additions separately so we can
     // group them in the output for readability.
-    let mut shell_sources: Vec<(String, PathBuf)> = Vec::new(); // (pack, target)
-    let mut path_additions: Vec<(String, PathBuf)> = Vec::new(); // (pack, target)
+    let mut shell_sources: ShellSources = Vec::new();
+    let mut path_additions: PathAdditions = Vec::new();
 
     for pack_entry in &pack_entries {
         if !pack_entry.is_dir {
@@ -106,6 +360,20 @@ pub fn generate_init_script(
         // expects to recognise here.
         let pack_dir = &pack_entry.name;
         let pack_display = crate::packs::display_name_for(pack_dir).to_string();
+        let placement = path_priorities.get(pack_dir).cloned().unwrap_or_default();
+        let priority = placement.priority;
+        let pack_path = paths.pack_path(pack_dir);
+        let position_of = |target: &Path| match target.strip_prefix(&pack_path) {
+            Ok(relative) => placement.position_for(&relative.to_string_lossy()),
+            Err(_) => placement.position,
+        };
+
+        // Agent handler: its exports come ahead of the pack's own
+        // scripts, which may well use the agent.
+        let agent_env = crate::handlers::agent::env_file(paths, pack_dir);
+        if fs.exists(&agent_env) {
+            shell_sources.push((pack_display.clone(), agent_env, Vec::new()));
+        }
 
         // Shell handler: source scripts
         let shell_dir = paths.handler_data_dir(pack_dir, "shell");
@@ -117,87 +385,148 @@ pub fn generate_init_script(
                     }
                     // Follow the symlink to get the actual file path
                     let target = fs.readlink(&entry.path)?;
-                    shell_sources.push((pack_display.clone(), target));
+                    let lazy = fs
+                        .read_to_string(&target)
+                        .map(|content| lazy_commands(&content))
+                        .unwrap_or_default();
+                    shell_sources.push((pack_display.clone(), target, lazy));
                 }
             }
         }
 
-        // Path handler: add to PATH
+        // Path handler: add to PATH. A staged directory goes on as
+        // is; staged single executables are reached through the data
+        // dir holding their links, added once at the highest priority
+        // among them.
         let path_dir = paths.handler_data_dir(pack_dir, "path");
         if fs.is_dir(&path_dir) {
             if let Ok(entries) = fs.read_dir(&path_dir) {
+                let mut files_priority: Option<i32> = None;
                 for entry in entries {
                     if !entry.is_symlink {
                         continue;
                     }
                     let target = fs.readlink(&entry.path)?;
-                    path_additions.push((pack_display.clone(), target));
+                    let name = target
+                        .file_name()
+                        .map(|n| n.to_string_lossy().into_owned())
+                        .unwrap_or_default();
+                    if fs.exists(&target) && !fs.is_dir(&target) {
+                        let file_priority = placement.priority_for(&name, false);
+                        files_priority = files_priority.max(Some(file_priority));
+                        continue;
+                    }
+                    let dir_priority = placement.priority_for(&name, true);
+                    let position = position_of(&target);
+                    path_additions.push((dir_priority, pack_display.clone(), target, position));
+                }
+                if let Some(files_priority) = files_priority {
+                    path_additions.push((
+                        files_priority,
+                        pack_display.clone(),
+                        path_dir.clone(),
+                        placement.position,
+                    ));
                 }
             }
         }
-    }
 
-    // If nothing is deployed, add an explanatory comment
-    if path_additions.is_empty() && shell_sources.is_empty() {
-        append_empty_notice(&mut script);
-        return Ok(script);
+        // Download handler: the managed bin dir goes on PATH as is.
+        let bin_dir = crate::handlers::download::bin_dir(paths, pack_dir);
+        if fs.is_dir(&bin_dir) {
+            path_additions.push((priority, pack_display.clone(), bin_dir, placement.position));
+        }
     }
 
-    // Profiling preamble (only when enabled and there's at least one entry).
-    let profiling_active = profiling_enabled;
-    if profiling_active {
-        emit_profiling_preamble(
-            &mut script,
-            &paths.probes_shell_init_dir(),
-            &paths.init_script_path(),
-        );
-    }
+    // Final $PATH order is (priority desc, pack asc, target asc) within
+    // each end. Prepends are emitted in the exact reverse since each
+    // line goes in front; appends as they are, after them.
+    path_additions.sort_by(|a, b| {
+        b.0.cmp(&a.0)
+            .then_with(|| a.1.cmp(&b.1))
+            .then_with(|| a.2.cmp(&b.2))
+    });
+    let (appends, mut prepends): (PathAdditions, PathAdditions) = path_additions
+        .into_iter()
+        .partition(|a| a.3 == PathPosition::Append);
+    prepends.reverse();
+    prepends.extend(appends);
+
+    Ok((shell_sources, prepends))
+}
 
-    // Emit PATH additions
-    if !path_additions.is_empty() {
-        writeln!(script, "# PATH additions").unwrap();
-        for (pack, target) in &path_additions {
-            writeln!(script, "# [{pack}]").unwrap();
-            if profiling_active {
-                emit_timed_path(&mut script, pack, target);
-            } else {
-                writeln!(script, "export PATH=\"{}:$PATH\"", target.display()).unwrap();
-            }
-        }
-        writeln!(script).unwrap();
-    }
+/// The unprofiled line sourcing `target`.
+pub fn source_line(target: &Path) -> String {
+    format!(
+        "[ -f \"{p}\" ] && {{ . \"{p}\" || echo \"dodot: shell source exited $?: {p}\" >&2; }}",
+        p = target.display()
+    )
+}
 
-    // Emit shell sources
-    if !shell_sources.is_empty() {
-        writeln!(script, "# Shell scripts").unwrap();
-        for (pack, target) in &shell_sources {
-            writeln!(script, "# [{pack}]").unwrap();
-            if profiling_active {
-                emit_timed_source(&mut script, pack, target);
+/// What one staged entry adds to the init script, for `--dry-run`: the
+/// lines the generator writes for it (unprofiled), and whether `script`
+/// — the current init script — already has an equivalent entry: the
+/// same file sourced, or the same directory placed the same way, in
+/// any form the generator uses. `lazy` are the file's lazy commands.
+/// `None` for handlers the init script doesn't read.
+pub fn prospective_entry(
+    handler: &str,
+    pack: &str,
+    target: &Path,
+    position: PathPosition,
+    lazy: &[String],
+    script: &str,
+) -> Option<(Vec<String>, bool)> {
+    match handler {
+        "shell" => {
+            let lines = if lazy.is_empty() {
+                vec![source_line(target)]
             } else {
-                // Loud-failure wrapper: if the source command itself
-                // exits non-zero, print a dodot-attributed message to
-                // stderr alongside the shell's own error so the user
-                // can see *which* dodot-managed file failed. The
-                // shell's native message already carries the line
-                // number; we add the breadcrumb back to dodot.
-                writeln!(
-                    script,
-                    "[ -f \"{p}\" ] && {{ . \"{p}\" || echo \"dodot: shell source exited $?: {p}\" >&2; }}",
-                    p = target.display()
-                )
-                .unwrap();
-            }
+                // The loader's number follows the file's place in the
+                // script; `1` stands in for it here.
+                let mut stub = String::new();
+                emit_lazy_source(&mut stub, pack, target, lazy, 1);
+                stub.lines().map(str::to_string).collect()
+            };
+            let present = script.contains(&format!(". \"{}\"", target.display()));
+            Some((lines, present))
         }
-        writeln!(script).unwrap();
+        "path" => {
+            let assignment = path_assignment(target, position);
+            let present = script.contains(&format!("export {assignment}"));
+            Some((vec![format!("export {assignment}")], present))
+        }
+        _ => None,
     }
+}
 
-    // Profiling epilogue (close the report, scrub our state).
-    if profiling_active {
-        emit_profiling_epilogue(&mut script);
+/// `PATH="dir:$PATH"` or `PATH="$PATH:dir"`.
+fn path_assignment(target: &Path, position: PathPosition) -> String {
+    match position {
+        PathPosition::Prepend => format!("PATH=\"{}:$PATH\"", target.display()),
+        PathPosition::Append => format!("PATH=\"$PATH:{}\"", target.display()),
     }
+}
 
-    Ok(script)
+/// Directories the path handler has deployed with their position, in
+/// final `$PATH` order: prepended ones (highest priority first), then
+/// appended ones. What the fish / nushell exports and the shim
+/// generator work from.
+pub fn path_entries(
+    fs: &dyn Fs,
+    paths: &dyn Pather,
+    path_priorities: &PathPriorities,
+) -> Result<Vec<(PathBuf, PathPosition)>> {
+    let (_, additions) = collect_entries(fs, paths, path_priorities)?;
+    let (appends, prepends): (PathAdditions, PathAdditions) = additions
+        .into_iter()
+        .partition(|a| a.3 == PathPosition::Append);
+    Ok(prepends
+        .into_iter()
+        .rev()
+        .chain(appends)
+        .map(|(_, _, target, position)| (target, position))
+        .collect())
 }
 
 /// Generate and write the init script to `data_dir/shell/dodot-init.sh`.
@@ -207,12 +536,13 @@ pub fn write_init_script(
     fs: &dyn Fs,
     paths: &dyn Pather,
     profiling_enabled: bool,
+    path_priorities: &PathPriorities,
 ) -> Result<PathBuf> {
-    let script_content = generate_init_script(fs, paths, profiling_enabled)?;
+    let script_content = generate_init_script(fs, paths, profiling_enabled, path_priorities)?;
     let script_path = paths.init_script_path();
 
     fs.mkdir_all(paths.shell_dir())?;
-    fs.write_file(&script_path, script_content.as_bytes())?;
+    fs.write_file_atomic(&script_path, script_content.as_bytes())?;
     fs.set_permissions(&script_path, 0o755)?;
 
     Ok(script_path)
@@ -311,13 +641,14 @@ fn emit_profiling_preamble(script: &mut String, profiles_dir: &Path, init_script
 
 /// One inline-timed `export PATH=…` row. The branch is one comparison
 /// at runtime — negligible on shells where the wrapper is inert.
-fn emit_timed_path(script: &mut String, pack: &str, target: &Path) {
+fn emit_timed_path(script: &mut String, pack: &str, target: &Path, position: PathPosition) {
     let target_str = target.display().to_string();
     let target_q = sh_quote(&target_str);
+    let assignment = path_assignment(target, position);
     writeln!(script, "if [ \"$_dodot_prof\" = \"1\" ]; then").unwrap();
     writeln!(
         script,
-        "  _dodot_t0=$EPOCHREALTIME; export PATH=\"{target_str}:$PATH\"; _dodot_t1=$EPOCHREALTIME"
+        "  _dodot_t0=$EPOCHREALTIME; export {assignment}; _dodot_t1=$EPOCHREALTIME"
     )
     .unwrap();
     writeln!(
@@ -326,7 +657,7 @@ fn emit_timed_path(script: &mut String, pack: &str, target: &Path) {
     )
     .unwrap();
     writeln!(script, "else").unwrap();
-    writeln!(script, "  export PATH=\"{target_str}:$PATH\"").unwrap();
+    writeln!(script, "  export {assignment}").unwrap();
     writeln!(script, "fi").unwrap();
 }
 
@@ -402,6 +733,66 @@ fn emit_timed_source(script: &mut String, pack: &str, target: &Path) {
     writeln!(script, "fi").unwrap();
 }
 
+/// Commands named by a `# dodot: lazy=a,b` directive in the file's
+/// leading comment block (shebang, comments and blank lines; the
+/// first line of code ends it). Names that can't be shell function
+/// names are dropped; none left means the file is sourced eagerly.
+pub fn lazy_commands(content: &str) -> Vec<String> {
+    let mut commands = Vec::new();
+    for line in content.lines() {
+        let line = line.trim();
+        if line.is_empty() {
+            continue;
+        }
+        let Some(comment) = line.strip_prefix('#') else {
+            break;
+        };
+        let Some(directive) = comment.trim_start().strip_prefix("dodot:") else {
+            continue;
+        };
+        for token in directive.split_whitespace() {
+            if let Some(names) = token.strip_prefix("lazy=") {
+                commands.extend(
+                    names
+                        .split(',')
+                        .filter(|n| is_function_name(n))
+                        .map(str::to_string),
+                );
+            }
+        }
+    }
+    commands.dedup();
+    commands
+}
+
+fn is_function_name(name: &str) -> bool {
+    !name.is_empty()
+        && !name.starts_with('-')
+        && name
+            .chars()
+            .all(|c| c.is_ascii_alphanumeric() || c == '_' || c == '-')
+}
+
+/// Stubs for one lazy file. `_dodot_lazy_<n>` removes every stub
+/// (itself included) before sourcing, so the re-run call reaches
+/// whatever the file defined — or the real binary.
+fn emit_lazy_source(script: &mut String, pack: &str, target: &Path, commands: &[String], n: usize) {
+    let p = target.display();
+    let loader = format!("_dodot_lazy_{n}");
+    let names = commands.join(" ");
+    writeln!(script, "# [{pack}] lazy: {names}").unwrap();
+    writeln!(script, "if [ -f \"{p}\" ]; then").unwrap();
+    writeln!(
+        script,
+        "  {loader}() {{ unset -f {names} {loader}; . \"{p}\" || echo \"dodot: shell source exited $?: {p}\" >&2; }}"
+    )
+    .unwrap();
+    for command in commands {
+        writeln!(script, "  {command}() {{ {loader}; {command} \"$@\"; }}").unwrap();
+    }
+    writeln!(script, "fi").unwrap();
+}
+
 /// Closes out the report (writes the `# end_t` marker) and clears
 /// every `_dodot_*` shell variable so we don't leak state into the
 /// user's interactive shell.
@@ -430,7 +821,7 @@ fn emit_profiling_epilogue(script: &mut String) {
 
 /// Single-quote a string for safe use in POSIX shell. Embedded single
 /// quotes are escaped via the `'\''` idiom.
-fn sh_quote(s: &str) -> String {
+pub(crate) fn sh_quote(s: &str) -> String {
     let mut out = String::with_capacity(s.len() + 2);
     out.push('\'');
     for c in s.chars() {
@@ -469,7 +860,13 @@ mod tests {
     #[test]
     fn empty_datastore_produces_helpful_script() {
         let env = TempEnvironment::builder().build();
-        let script = generate_init_script(env.fs.as_ref(), env.paths.as_ref(), false).unwrap();
+        let script = generate_init_script(
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            false,
+            &PathPriorities::new(),
+        )
+        .unwrap();
 
         assert!(script.starts_with("#!/bin/sh"));
         assert!(script.contains("Generated by dodot"));
@@ -493,7 +890,13 @@ mod tests {
         let source = env.dotfiles_root.join("vim/aliases.sh");
         ds.create_data_link("vim", "shell", &source).unwrap();
 
-        let script = generate_init_script(env.fs.as_ref(), env.paths.as_ref(), false).unwrap();
+        let script = generate_init_script(
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            false,
+            &PathPriorities::new(),
+        )
+        .unwrap();
 
         assert!(script.contains("# Shell scripts"), "script:\n{script}");
         assert!(script.contains("# [vim]"), "script:\n{script}");
@@ -508,6 +911,60 @@ mod tests {
         );
     }
 
+    #[test]
+    fn lazy_directive_defers_sourcing_until_first_call() {
+        let env = TempEnvironment::builder()
+            .pack("kube")
+            .file(
+                "kubectl.sh",
+                "#!/bin/sh\n# Completions are slow.\n# dodot: lazy=kubectl,kc\n\nkubectl() { echo \"real $*\"; }\nkc() { kubectl \"$@\"; }\nloaded=1\n",
+            )
+            .done()
+            .build();
+        let ds = make_datastore(&env);
+        let source = env.dotfiles_root.join("kube/kubectl.sh");
+        ds.create_data_link("kube", "shell", &source).unwrap();
+
+        let script = generate_init_script(
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            false,
+            &PathPriorities::new(),
+        )
+        .unwrap();
+        assert!(script.contains("# [kube] lazy: kubectl kc"), "{script}");
+        assert!(
+            !script.contains(&format!("[ -f \"{p}\" ] && {{ . ", p = source.display())),
+            "lazy file sourced eagerly:\n{script}"
+        );
+
+        let out = std::process::Command::new("sh")
+            .arg("-c")
+            .arg(format!(
+                "{script}\necho \"before=${{loaded:-0}}\"; kc get pods; echo \"after=${{loaded:-0}}\"; kubectl again"
+            ))
+            .output()
+            .unwrap();
+        assert_eq!(
+            String::from_utf8_lossy(&out.stdout),
+            "before=0\nreal get pods\nafter=1\nreal again\n"
+        );
+    }
+
+    #[test]
+    fn lazy_directive_only_counts_in_the_leading_comments() {
+        assert_eq!(
+            lazy_commands("# dodot: lazy=nvm\nnvm() { :; }\n"),
+            vec!["nvm"]
+        );
+        assert!(lazy_commands("export X=1\n# dodot: lazy=nvm\n").is_empty());
+        assert_eq!(
+            lazy_commands("#!/bin/zsh\n\n# dodot:  lazy=pyenv,bad;name,rbenv\n"),
+            vec!["pyenv", "rbenv"]
+        );
+        assert!(lazy_commands("# dodot: lazy=\n").is_empty());
+    }
+
     #[test]
     fn path_handler_state_produces_path_lines() {
         let env = TempEnvironment::builder()
@@ -520,7 +977,13 @@ mod tests {
         let source = env.dotfiles_root.join("vim/bin");
         ds.create_data_link("vim", "path", &source).unwrap();
 
-        let script = generate_init_script(env.fs.as_ref(), env.paths.as_ref(), false).unwrap();
+        let script = generate_init_script(
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            false,
+            &PathPriorities::new(),
+        )
+        .unwrap();
 
         assert!(script.contains("# PATH additions"), "script:\n{script}");
         assert!(script.contains("# [vim]"), "script:\n{script}");
@@ -530,6 +993,38 @@ mod tests {
         );
     }
 
+    #[test]
+    fn staged_executables_put_the_path_data_dir_on_path_once() {
+        let env = TempEnvironment::builder()
+            .pack("tools")
+            .file("bin/a", "#!/bin/sh")
+            .file("deploy", "#!/bin/sh")
+            .file("serve", "#!/bin/sh")
+            .done()
+            .build();
+
+        let ds = make_datastore(&env);
+        let pack_root = env.dotfiles_root.join("tools");
+        for name in ["bin", "deploy", "serve"] {
+            ds.create_data_link("tools", "path", &pack_root.join(name))
+                .unwrap();
+        }
+
+        let mut entries: Vec<PathBuf> =
+            path_entries(env.fs.as_ref(), env.paths.as_ref(), &PathPriorities::new())
+                .unwrap()
+                .into_iter()
+                .map(|(dir, _)| dir)
+                .collect();
+        entries.sort();
+        let mut expected = vec![
+            pack_root.join("bin"),
+            env.paths.handler_data_dir("tools", "path"),
+        ];
+        expected.sort();
+        assert_eq!(entries, expected);
+    }
+
     #[test]
     fn multiple_packs_combined() {
         let env = TempEnvironment::builder()
@@ -554,7 +1049,13 @@ mod tests {
         ds.create_data_link("vim", "path", &env.dotfiles_root.join("vim/bin"))
             .unwrap();
 
-        let script = generate_init_script(env.fs.as_ref(), env.paths.as_ref(), false).unwrap();
+        let script = generate_init_script(
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            false,
+            &PathPriorities::new(),
+        )
+        .unwrap();
 
         // Should have both shell sources
         assert!(script.contains("# [git]"), "script:\n{script}");
@@ -569,6 +1070,151 @@ mod tests {
         );
     }
 
+    #[test]
+    fn path_lines_ordered_by_priority_then_pack_name() {
+        let env = TempEnvironment::builder()
+            .pack("alpha")
+            .file("bin/a", "#!/bin/sh")
+            .done()
+            .pack("beta")
+            .file("bin/b", "#!/bin/sh")
+            .done()
+            .pack("gamma")
+            .file("bin/g", "#!/bin/sh")
+            .done()
+            .build();
+
+        let ds = make_datastore(&env);
+        for pack in ["gamma", "alpha", "beta"] {
+            ds.create_data_link(pack, "path", &env.dotfiles_root.join(pack).join("bin"))
+                .unwrap();
+        }
+
+        let line_pos = |script: &str, pack: &str| {
+            let line = format!(
+                "export PATH=\"{}:$PATH\"",
+                env.dotfiles_root.join(pack).join("bin").display()
+            );
+            script
+                .find(&line)
+                .unwrap_or_else(|| panic!("no PATH line for {pack}:\n{script}"))
+        };
+
+        // Equal priority: $PATH reads alpha, beta, gamma, so the
+        // prepend lines are emitted gamma, beta, alpha.
+        let script = generate_init_script(
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            false,
+            &PathPriorities::new(),
+        )
+        .unwrap();
+        assert!(line_pos(&script, "gamma") < line_pos(&script, "beta"));
+        assert!(line_pos(&script, "beta") < line_pos(&script, "alpha"));
+
+        // Raising gamma moves its line last, i.e. first in $PATH.
+        let priorities = PathPriorities::from([(
+            "gamma".to_string(),
+            PathPlacement {
+                priority: 10,
+                ..Default::default()
+            },
+        )]);
+        let script =
+            generate_init_script(env.fs.as_ref(), env.paths.as_ref(), false, &priorities).unwrap();
+        assert!(line_pos(&script, "beta") < line_pos(&script, "alpha"));
+        assert!(line_pos(&script, "alpha") < line_pos(&script, "gamma"));
+    }
+
+    #[test]
+    fn appended_directories_go_after_the_system_path() {
+        let env = TempEnvironment::builder()
+            .pack("tools")
+            .file("bin/t", "#!/bin/sh")
+            .file("fallback/f", "#!/bin/sh")
+            .done()
+            .build();
+        let ds = make_datastore(&env);
+        for dir in ["bin", "fallback"] {
+            ds.create_data_link("tools", "path", &env.dotfiles_root.join("tools").join(dir))
+                .unwrap();
+        }
+        let placement = PathPlacement {
+            positions: HashMap::from([("fallback".to_string(), PathPosition::Append)]),
+            ..Default::default()
+        };
+        let priorities = PathPriorities::from([("tools".to_string(), placement)]);
+
+        let script =
+            generate_init_script(env.fs.as_ref(), env.paths.as_ref(), false, &priorities).unwrap();
+        let bin = env.dotfiles_root.join("tools/bin");
+        let fallback = env.dotfiles_root.join("tools/fallback");
+        assert!(
+            script.contains(&format!("export PATH=\"{}:$PATH\"", bin.display())),
+            "{script}"
+        );
+        assert!(
+            script.contains(&format!("export PATH=\"$PATH:{}\"", fallback.display())),
+            "{script}"
+        );
+
+        let entries = path_entries(env.fs.as_ref(), env.paths.as_ref(), &priorities).unwrap();
+        assert_eq!(
+            entries,
+            vec![
+                (bin, PathPosition::Prepend),
+                (fallback, PathPosition::Append)
+            ]
+        );
+    }
+
+    #[test]
+    fn path_rules_weight_the_directories_they_match() {
+        let env = TempEnvironment::builder()
+            .pack("alpha")
+            .file("bin/a", "#!/bin/sh")
+            .done()
+            .pack("beta")
+            .file("bin/b", "#!/bin/sh")
+            .file("overrides/b", "#!/bin/sh")
+            .done()
+            .build();
+        let ds = make_datastore(&env);
+        ds.create_data_link("alpha", "path", &env.dotfiles_root.join("alpha/bin"))
+            .unwrap();
+        for dir in ["bin", "overrides"] {
+            ds.create_data_link("beta", "path", &env.dotfiles_root.join("beta").join(dir))
+                .unwrap();
+        }
+        let rules = [crate::config::RuleSpec {
+            pattern: "overrides/".into(),
+            handler: "path".into(),
+            priority: None,
+            options: [("path_priority".to_string(), toml::Value::Integer(10))].into(),
+            roles: Vec::new(),
+        }];
+        let placement = PathPlacement::default().with_rules(&rules);
+        assert_eq!(placement.priority_for("overrides", true), 10);
+        assert_eq!(placement.priority_for("bin", true), 0);
+        let priorities = PathPriorities::from([("beta".to_string(), placement)]);
+
+        let entries: Vec<PathBuf> = path_entries(env.fs.as_ref(), env.paths.as_ref(), &priorities)
+            .unwrap()
+            .into_iter()
+            .map(|(dir, _)| dir)
+            .collect();
+        // beta's overrides/ jumps ahead; its bin/ keeps the pack's
+        // priority and sorts after alpha's.
+        assert_eq!(
+            entries,
+            vec![
+                env.dotfiles_root.join("beta/overrides"),
+                env.dotfiles_root.join("alpha/bin"),
+                env.dotfiles_root.join("beta/bin"),
+            ]
+        );
+    }
+
     #[test]
     fn write_init_script_creates_executable_file() {
         let env = TempEnvironment::builder()
@@ -581,7 +1227,13 @@ mod tests {
         ds.create_data_link("vim", "shell", &env.dotfiles_root.join("vim/aliases.sh"))
             .unwrap();
 
-        let script_path = write_init_script(env.fs.as_ref(), env.paths.as_ref(), false).unwrap();
+        let script_path = write_init_script(
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            false,
+            &PathPriorities::new(),
+        )
+        .unwrap();
 
         assert_eq!(script_path, env.paths.init_script_path());
         env.assert_exists(&script_path);
@@ -607,23 +1259,70 @@ mod tests {
         let ds = make_datastore(&env);
 
         // Initially empty
-        let script1 = generate_init_script(env.fs.as_ref(), env.paths.as_ref(), false).unwrap();
+        let script1 = generate_init_script(
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            false,
+            &PathPriorities::new(),
+        )
+        .unwrap();
         assert!(!script1.contains("aliases.sh"));
 
         // Deploy shell script
         ds.create_data_link("vim", "shell", &env.dotfiles_root.join("vim/aliases.sh"))
             .unwrap();
 
-        let script2 = generate_init_script(env.fs.as_ref(), env.paths.as_ref(), false).unwrap();
+        let script2 = generate_init_script(
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            false,
+            &PathPriorities::new(),
+        )
+        .unwrap();
         assert!(script2.contains("aliases.sh"));
 
         // Remove state
         ds.remove_state("vim", "shell").unwrap();
 
-        let script3 = generate_init_script(env.fs.as_ref(), env.paths.as_ref(), false).unwrap();
+        let script3 = generate_init_script(
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            false,
+            &PathPriorities::new(),
+        )
+        .unwrap();
         assert!(!script3.contains("aliases.sh"));
     }
 
+    #[test]
+    fn agent_exports_are_sourced_before_the_packs_scripts() {
+        let env = TempEnvironment::builder()
+            .pack("gpg")
+            .file("aliases.sh", "alias g=gpg")
+            .done()
+            .build();
+        let ds = make_datastore(&env);
+        ds.create_data_link("gpg", "shell", &env.dotfiles_root.join("gpg/aliases.sh"))
+            .unwrap();
+        let agent_env = crate::handlers::agent::env_file(env.paths.as_ref(), "gpg");
+        env.fs.mkdir_all(agent_env.parent().unwrap()).unwrap();
+        env.fs
+            .write_file(&agent_env, b"export GPG_TTY=\"$(tty)\"\n")
+            .unwrap();
+
+        let script = generate_init_script(
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            false,
+            &PathPriorities::new(),
+        )
+        .unwrap();
+        let source = |p: &Path| script.find(&format!(". \"{}\"", p.display())).unwrap();
+        let exports = source(&agent_env);
+        let aliases = source(&env.dotfiles_root.join("gpg/aliases.sh"));
+        assert!(exports < aliases, "{script}");
+    }
+
     #[test]
     fn ignores_non_symlink_files_in_handler_dirs() {
         let env = TempEnvironment::builder().build();
@@ -635,7 +1334,13 @@ mod tests {
             .write_file(&shell_dir.join("not-a-symlink"), b"noise")
             .unwrap();
 
-        let script = generate_init_script(env.fs.as_ref(), env.paths.as_ref(), false).unwrap();
+        let script = generate_init_script(
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            false,
+            &PathPriorities::new(),
+        )
+        .unwrap();
         assert!(!script.contains("not-a-symlink"));
     }
 
@@ -654,7 +1359,13 @@ mod tests {
         ds.create_data_link("vim", "path", &env.dotfiles_root.join("vim/bin"))
             .unwrap();
 
-        let script = generate_init_script(env.fs.as_ref(), env.paths.as_ref(), false).unwrap();
+        let script = generate_init_script(
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            false,
+            &PathPriorities::new(),
+        )
+        .unwrap();
 
         let path_pos = script.find("# PATH additions").unwrap();
         let shell_pos = script.find("# Shell scripts").unwrap();
@@ -681,7 +1392,13 @@ mod tests {
         ds.create_data_link("vim", "shell", &env.dotfiles_root.join("vim/aliases.sh"))
             .unwrap();
 
-        let script = generate_init_script(env.fs.as_ref(), env.paths.as_ref(), false).unwrap();
+        let script = generate_init_script(
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            false,
+            &PathPriorities::new(),
+        )
+        .unwrap();
         assert!(!script.contains("_dodot_prof"));
         assert!(!script.contains("EPOCHREALTIME"));
         assert!(!script.contains("dodot shell-init profile"));
@@ -699,7 +1416,13 @@ mod tests {
         ds.create_data_link("vim", "shell", &env.dotfiles_root.join("vim/aliases.sh"))
             .unwrap();
 
-        let script = generate_init_script(env.fs.as_ref(), env.paths.as_ref(), true).unwrap();
+        let script = generate_init_script(
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            true,
+            &PathPriorities::new(),
+        )
+        .unwrap();
 
         // Preamble feature-detects bash 5+ / zsh + EPOCHREALTIME
         assert!(script.contains("BASH_VERSION"));
@@ -730,7 +1453,13 @@ mod tests {
         ds.create_data_link("vim", "path", &env.dotfiles_root.join("vim/bin"))
             .unwrap();
 
-        let script = generate_init_script(env.fs.as_ref(), env.paths.as_ref(), true).unwrap();
+        let script = generate_init_script(
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            true,
+            &PathPriorities::new(),
+        )
+        .unwrap();
 
         // Each entry has an if/else so unprofiled shells still source / set PATH.
         // (One else per entry; the epilogue uses an if-only form, so counting
@@ -761,7 +1490,13 @@ mod tests {
         ds.create_data_link("vim", "shell", &env.dotfiles_root.join("vim/aliases.sh"))
             .unwrap();
 
-        let script = generate_init_script(env.fs.as_ref(), env.paths.as_ref(), true).unwrap();
+        let script = generate_init_script(
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            true,
+            &PathPriorities::new(),
+        )
+        .unwrap();
 
         // Errors-log sibling is derived from the profile-file path.
         assert!(
@@ -805,7 +1540,13 @@ mod tests {
         ds.create_data_link("vim", "shell", &env.dotfiles_root.join("vim/aliases.sh"))
             .unwrap();
 
-        let script = generate_init_script(env.fs.as_ref(), env.paths.as_ref(), true).unwrap();
+        let script = generate_init_script(
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            true,
+            &PathPriorities::new(),
+        )
+        .unwrap();
         // End-of-run timestamp.
         assert!(script.contains("# end_t"));
         // We scrub our state to avoid leaking into the user's shell.
@@ -817,7 +1558,13 @@ mod tests {
     fn profiling_enabled_with_empty_datastore_skips_preamble() {
         // No deployed entries → empty notice only, no profiling boilerplate.
         let env = TempEnvironment::builder().build();
-        let script = generate_init_script(env.fs.as_ref(), env.paths.as_ref(), true).unwrap();
+        let script = generate_init_script(
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            true,
+            &PathPriorities::new(),
+        )
+        .unwrap();
         assert!(script.contains("No shell scripts or PATH additions"));
         assert!(!script.contains("_dodot_prof"));
     }
@@ -842,7 +1589,13 @@ mod tests {
         ds.create_data_link("vim", "shell", &env.dotfiles_root.join("vim/aliases.sh"))
             .unwrap();
 
-        let script = generate_init_script(env.fs.as_ref(), env.paths.as_ref(), true).unwrap();
+        let script = generate_init_script(
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            true,
+            &PathPriorities::new(),
+        )
+        .unwrap();
         // Pre-attempt initialisation present.
         assert!(
             script.contains("_dodot_rc=0;"),
@@ -873,7 +1626,13 @@ mod tests {
             .unwrap();
 
         // Profiling off: inline OR-echo form.
-        let plain = generate_init_script(env.fs.as_ref(), env.paths.as_ref(), false).unwrap();
+        let plain = generate_init_script(
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            false,
+            &PathPriorities::new(),
+        )
+        .unwrap();
         assert!(
             plain.contains("dodot: shell source exited $?:"),
             "plain script missing loud-failure echo:\n{plain}"
@@ -883,7 +1642,13 @@ mod tests {
         // arm (silent failure case); the with-stderr arm relies on
         // re-emitting the captured stderr to the user's TTY. Unprofiled
         // fallback uses the OR-echo form like the plain path.
-        let timed = generate_init_script(env.fs.as_ref(), env.paths.as_ref(), true).unwrap();
+        let timed = generate_init_script(
+            env.fs.as_ref(),
+            env.paths.as_ref(),
+            true,
+            &PathPriorities::new(),
+        )
+        .unwrap();
         assert!(
             timed.contains("echo \"dodot: shell source exited $_dodot_rc:"),
             "timed script missing silent-failure echo:\n{timed}"
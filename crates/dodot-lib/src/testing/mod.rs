@@ -18,6 +18,29 @@
 //!
 //! assert!(env.fs.exists(&env.dotfiles_root.join("vim/vimrc")));
 //! ```
+//!
+//! Every environment owns its own temp dir, so tests using it run in
+//! parallel without sharing state; only process-global state (`$SHELL`,
+//! see [`ShellEnvGuard`]) needs a lock.
+//!
+//! # Scenarios
+//!
+//! Handler integration tests read as given / when / then: the builder
+//! sets up packs (with file modes) and pre-existing home symlinks, the
+//! test runs a command, and [`TempEnvironment::assert_links`] checks a table of
+//! user paths against the pack files they must end up at:
+//!
+//! ```rust,ignore
+//! let env = TempEnvironment::builder()
+//!     .pack("vim").file("vimrc", "x").done()
+//!     .build();
+//! commands::up::up(None, &ctx).unwrap();
+//! env.assert_links(&[("~/.config/vim/vimrc", "vim/vimrc")]);
+//! ```
+//!
+//! Links are followed hop by hop, so a loop fails the assertion with
+//! the chain that looped instead of hanging or reporting "missing".
+//! [`TempEnvironment::read_only`] simulates unwritable targets.
 
 use std::path::{Path, PathBuf};
 use std::sync::{Arc, Mutex, MutexGuard};
@@ -138,6 +161,7 @@ impl TempEnvironment {
         TempEnvironmentBuilder {
             packs: Vec::new(),
             extra_home_files: Vec::new(),
+            home_symlinks: Vec::new(),
         }
     }
 
@@ -301,6 +325,118 @@ impl TempEnvironment {
         );
     }
 
+    /// Follow `path` through every symlink hop and return the chain,
+    /// starting with `path` itself. Relative targets resolve against
+    /// the link's directory. Fails on a loop (a path seen twice) or
+    /// after [`MAX_LINK_HOPS`] hops, naming the chain so far.
+    pub fn resolve_link_chain(&self, path: &Path) -> Result<Vec<PathBuf>, String> {
+        let mut chain = vec![path.to_path_buf()];
+        let mut current = path.to_path_buf();
+        while self.fs.is_symlink(&current) {
+            let target = self
+                .fs
+                .readlink(&current)
+                .map_err(|e| format!("readlink {}: {e}", current.display()))?;
+            let next = match current.parent() {
+                Some(dir) if target.is_relative() => dir.join(target),
+                _ => target,
+            };
+            if chain.contains(&next) {
+                chain.push(next);
+                return Err(format!("symlink loop: {}", display_chain(&chain)));
+            }
+            if chain.len() > MAX_LINK_HOPS {
+                return Err(format!("too many symlink hops: {}", display_chain(&chain)));
+            }
+            chain.push(next.clone());
+            current = next;
+        }
+        Ok(chain)
+    }
+
+    /// Assert that following `link` ends at `target`, whatever the
+    /// hops in between.
+    pub fn assert_resolves_to(&self, link: &Path, target: &Path) {
+        let chain = self
+            .resolve_link_chain(link)
+            .unwrap_or_else(|e| panic!("{e}"));
+        assert!(
+            self.fs.is_symlink(link),
+            "expected a symlink at {}",
+            link.display()
+        );
+        assert_eq!(
+            chain.last().map(PathBuf::as_path),
+            Some(target),
+            "{} resolves through {}, expected it to end at {}",
+            link.display(),
+            display_chain(&chain),
+            target.display()
+        );
+        assert!(
+            self.fs.exists(target),
+            "{} resolves to {}, which does not exist",
+            link.display(),
+            target.display()
+        );
+    }
+
+    /// Table-driven [`Self::assert_resolves_to`]: each row is a user
+    /// path (`~/`-prefixed, or relative to HOME) and the pack file it
+    /// must resolve to, relative to the dotfiles root. All rows are
+    /// checked; the failure lists every mismatch.
+    pub fn assert_links(&self, expected: &[(&str, &str)]) {
+        let mut failures = Vec::new();
+        for (user, source) in expected {
+            let link = self.home.join(user.trim_start_matches("~/"));
+            let target = self.dotfiles_root.join(source);
+            match self.resolve_link_chain(&link) {
+                Ok(chain) if chain.len() > 1 && chain.last() == Some(&target) => {}
+                Ok(chain) => {
+                    failures.push(format!("{user} -> {source}: got {}", display_chain(&chain)))
+                }
+                Err(e) => failures.push(format!("{user} -> {source}: {e}")),
+            }
+        }
+        assert!(
+            failures.is_empty(),
+            "link expectations failed:\n  {}",
+            failures.join("\n  ")
+        );
+    }
+
+    /// Make `path` unwritable until the returned guard drops: mode
+    /// `0o555` for directories, `0o444` for files. The previous mode is
+    /// restored on drop (including on panic), so the temp dir can still
+    /// be cleaned up. Root ignores mode bits; check
+    /// [`PermissionGuard::enforced`] before asserting on a denial.
+    pub fn read_only(&self, path: &Path) -> PermissionGuard {
+        let previous = self
+            .fs
+            .stat(path)
+            .unwrap_or_else(|e| panic!("failed to stat {}: {e}", path.display()))
+            .mode;
+        let is_dir = self.fs.is_dir(path);
+        let mode = if is_dir { 0o555 } else { 0o444 };
+        self.fs
+            .set_permissions(path, mode)
+            .unwrap_or_else(|e| panic!("failed to chmod {}: {e}", path.display()));
+        let enforced = if is_dir {
+            let probe = path.join(".dodot-permission-probe");
+            let writable = std::fs::write(&probe, b"").is_ok();
+            let _ = std::fs::remove_file(&probe);
+            !writable
+        } else {
+            std::fs::OpenOptions::new().append(true).open(path).is_err()
+        };
+        PermissionGuard {
+            fs: self.fs.clone(),
+            path: path.to_path_buf(),
+            previous,
+            enforced,
+        }
+    }
+
     /// Returns the list of file names in a directory.
     pub fn list_dir_names(&self, path: &Path) -> Vec<String> {
         self.fs
@@ -312,17 +448,55 @@ impl TempEnvironment {
     }
 }
 
+/// Hop limit for [`TempEnvironment::resolve_link_chain`], matching
+/// Linux's `MAXSYMLINKS`.
+const MAX_LINK_HOPS: usize = 40;
+
+fn display_chain(chain: &[PathBuf]) -> String {
+    chain
+        .iter()
+        .map(|p| p.display().to_string())
+        .collect::<Vec<_>>()
+        .join(" -> ")
+}
+
+/// Restores a path's mode when dropped. See
+/// [`TempEnvironment::read_only`].
+pub struct PermissionGuard {
+    fs: Arc<OsFs>,
+    path: PathBuf,
+    previous: u32,
+    enforced: bool,
+}
+
+impl PermissionGuard {
+    /// Whether the OS actually denies writes to the path. `false` when
+    /// tests run as root, where a test about permission errors has
+    /// nothing to observe and should return early.
+    pub fn enforced(&self) -> bool {
+        self.enforced
+    }
+}
+
+impl Drop for PermissionGuard {
+    fn drop(&mut self) {
+        let _ = self.fs.set_permissions(&self.path, self.previous);
+    }
+}
+
 // ── Builder ─────────────────────────────────────────────────────────
 
 /// Builder for [`TempEnvironment`].
 pub struct TempEnvironmentBuilder {
     packs: Vec<PackSpec>,
     extra_home_files: Vec<(String, String)>,
+    home_symlinks: Vec<(String, String)>,
 }
 
 struct PackSpec {
     name: String,
     files: Vec<(String, String)>,
+    modes: Vec<(String, u32)>,
     config: Option<String>,
     dodotignore: bool,
 }
@@ -335,6 +509,7 @@ impl TempEnvironmentBuilder {
             parent: self,
             name: name.to_string(),
             files: Vec::new(),
+            modes: Vec::new(),
             config: None,
             dodotignore: false,
         }
@@ -348,6 +523,15 @@ impl TempEnvironmentBuilder {
         self
     }
 
+    /// Add a symlink under HOME pointing at `target`, written verbatim
+    /// (relative targets stay relative). For pre-existing links dodot
+    /// has to cope with: stale links, loops, links into the repo.
+    pub fn home_symlink(mut self, relative_path: &str, target: &str) -> Self {
+        self.home_symlinks
+            .push((relative_path.to_string(), target.to_string()));
+        self
+    }
+
     /// Build the environment, creating all directories and files.
     pub fn build(self) -> TempEnvironment {
         let temp_dir = TempDir::new().expect("failed to create temp directory");
@@ -395,6 +579,10 @@ impl TempEnvironmentBuilder {
                 fs.write_file(&file_path, contents.as_bytes()).unwrap();
             }
 
+            for (rel_path, mode) in &pack.modes {
+                fs.set_permissions(&pack_dir.join(rel_path), *mode).unwrap();
+            }
+
             if let Some(config_toml) = &pack.config {
                 let config_path = pack_dir.join(".dodot.toml");
                 fs.write_file(&config_path, config_toml.as_bytes()).unwrap();
@@ -414,6 +602,9 @@ impl TempEnvironmentBuilder {
             }
             fs.write_file(&file_path, contents.as_bytes()).unwrap();
         }
+        for (rel_path, target) in &self.home_symlinks {
+            make_symlink(fs.as_ref(), &home.join(rel_path), target);
+        }
 
         // Build the pather with all paths pointing inside temp dir
         let paths = Arc::new(
@@ -442,11 +633,20 @@ impl TempEnvironmentBuilder {
     }
 }
 
+fn make_symlink(fs: &dyn Fs, link: &Path, target: &str) {
+    if let Some(parent) = link.parent() {
+        fs.mkdir_all(parent).unwrap();
+    }
+    fs.symlink(Path::new(target), link)
+        .unwrap_or_else(|e| panic!("failed to symlink {}: {e}", link.display()));
+}
+
 /// Builder for a single pack within a [`TempEnvironmentBuilder`].
 pub struct PackSpecBuilder {
     parent: TempEnvironmentBuilder,
     name: String,
     files: Vec<(String, String)>,
+    modes: Vec<(String, u32)>,
     config: Option<String>,
     dodotignore: bool,
 }
@@ -459,6 +659,13 @@ impl PackSpecBuilder {
         self
     }
 
+    /// Add a file with an explicit Unix mode (e.g. `0o755` for a
+    /// script, `0o600` for a key).
+    pub fn file_with_mode(mut self, relative_path: &str, contents: &str, mode: u32) -> Self {
+        self.modes.push((relative_path.to_string(), mode));
+        self.file(relative_path, contents)
+    }
+
     /// Set the `.dodot.toml` config for this pack.
     pub fn config(mut self, toml_contents: &str) -> Self {
         self.config = Some(toml_contents.to_string());
@@ -476,6 +683,7 @@ impl PackSpecBuilder {
         self.parent.packs.push(PackSpec {
             name: self.name,
             files: self.files,
+            modes: self.modes,
             config: self.config,
             dodotignore: self.dodotignore,
         });
@@ -701,4 +909,66 @@ mod tests {
         env.assert_dir_exists(&env.config_home);
         env.assert_dir_exists(env.paths.shell_dir());
     }
+
+    #[test]
+    fn environment_is_send_and_sync() {
+        fn assert_send_sync<T: Send + Sync>() {}
+        assert_send_sync::<TempEnvironment>();
+    }
+
+    #[test]
+    fn builder_creates_symlinks_and_modes() {
+        let env = TempEnvironment::builder()
+            .pack("bin")
+            .file_with_mode("tool.sh", "#!/bin/sh", 0o755)
+            .done()
+            .home_symlink(".tool", "dotfiles/bin/tool.sh")
+            .build();
+
+        let script = env.dotfiles_root.join("bin/tool.sh");
+        assert_eq!(env.fs.stat(&script).unwrap().mode & 0o777, 0o755);
+        env.assert_resolves_to(&env.home.join(".tool"), &script);
+        env.assert_links(&[("~/.tool", "bin/tool.sh")]);
+    }
+
+    #[test]
+    fn resolve_link_chain_detects_loops() {
+        let env = TempEnvironment::builder()
+            .home_symlink("a", "b")
+            .home_symlink("b", "a")
+            .build();
+
+        let err = env.resolve_link_chain(&env.home.join("a")).unwrap_err();
+        assert!(err.starts_with("symlink loop:"), "{err}");
+    }
+
+    #[test]
+    #[should_panic(expected = "link expectations failed")]
+    fn assert_links_reports_mismatches() {
+        let env = TempEnvironment::builder()
+            .pack("vim")
+            .file("vimrc", "x")
+            .done()
+            .build();
+        env.assert_links(&[("~/.vimrc", "vim/vimrc")]);
+    }
+
+    #[test]
+    fn read_only_guard_restores_mode() {
+        let env = TempEnvironment::builder()
+            .pack("vim")
+            .file("vimrc", "x")
+            .done()
+            .build();
+        let dir = env.dotfiles_root.join("vim");
+        let before = env.fs.stat(&dir).unwrap().mode;
+        {
+            let guard = env.read_only(&dir);
+            assert_eq!(env.fs.stat(&dir).unwrap().mode & 0o777, 0o555);
+            if guard.enforced() {
+                assert!(env.fs.write_file(&dir.join("new"), b"").is_err());
+            }
+        }
+        assert_eq!(env.fs.stat(&dir).unwrap().mode, before);
+    }
 }
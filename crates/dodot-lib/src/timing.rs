@@ -0,0 +1,334 @@
+//! Timing spans for `dodot --profile`.
+//!
+//! The pipeline marks its stages with [`span`]: pack discovery, the
+//! walk-and-match step, preprocessing, intent generation, execution,
+//! and every subprocess the command runner spawns. Recording is off
+//! until [`enable`] is called, and a disabled [`span`] is one atomic
+//! load — cheap enough to leave in hot paths.
+//!
+//! After the command, the CLI prints [`summarize`] as a table and
+//! writes the raw spans with [`write_trace`] in the Chrome trace-event
+//! format, which `chrome://tracing`, Perfetto (<https://ui.perfetto.dev>)
+//! and speedscope all open.
+//!
+//! Spans nest — an `execution` span contains the `subprocess` spans it
+//! triggered — so per-phase totals are inclusive and don't add up to
+//! the wall time.
+//!
+//! This is unrelated to `[profiling]`, which times shell startup from
+//! inside `dodot-init.sh`.
+
+use std::path::Path;
+use std::sync::atomic::{AtomicBool, Ordering};
+use std::sync::{Mutex, OnceLock};
+use std::time::{Duration, Instant};
+
+use serde::Serialize;
+
+use crate::fs::Fs;
+use crate::Result;
+
+/// Pipeline stage a span belongs to. Also the row order of the
+/// summary table.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord, Hash, Serialize)]
+#[serde(rename_all = "snake_case")]
+pub enum Phase {
+    Discovery,
+    Matching,
+    Preprocess,
+    Intents,
+    Execution,
+    Subprocess,
+}
+
+impl Phase {
+    pub fn as_str(self) -> &'static str {
+        match self {
+            Phase::Discovery => "discovery",
+            Phase::Matching => "matching",
+            Phase::Preprocess => "preprocess",
+            Phase::Intents => "intents",
+            Phase::Execution => "execution",
+            Phase::Subprocess => "subprocess",
+        }
+    }
+}
+
+/// One finished span. Offsets are relative to when recording started.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct SpanRecord {
+    pub phase: Phase,
+    /// What was timed: a pack name, `pack/handler`, or a command line.
+    pub label: String,
+    pub start: Duration,
+    pub duration: Duration,
+}
+
+/// Collects spans. The process-wide instance behind [`span`] is what
+/// the CLI uses; tests build their own.
+pub struct Recorder {
+    enabled: AtomicBool,
+    origin: Instant,
+    spans: Mutex<Vec<SpanRecord>>,
+}
+
+impl Default for Recorder {
+    fn default() -> Self {
+        Self::new()
+    }
+}
+
+impl Recorder {
+    /// A disabled recorder whose clock starts now.
+    pub fn new() -> Self {
+        Self {
+            enabled: AtomicBool::new(false),
+            origin: Instant::now(),
+            spans: Mutex::new(Vec::new()),
+        }
+    }
+
+    pub fn enable(&self) {
+        self.enabled.store(true, Ordering::Relaxed);
+    }
+
+    pub fn is_enabled(&self) -> bool {
+        self.enabled.load(Ordering::Relaxed)
+    }
+
+    /// Start a span that records itself when dropped. `label` is only
+    /// evaluated while recording, so callers can format freely.
+    pub fn span(&self, phase: Phase, label: impl FnOnce() -> String) -> SpanGuard<'_> {
+        let active = self.is_enabled().then(|| (phase, label(), Instant::now()));
+        SpanGuard {
+            recorder: self,
+            active,
+        }
+    }
+
+    /// Remove and return everything recorded so far, in start order.
+    pub fn take(&self) -> Vec<SpanRecord> {
+        let mut spans = std::mem::take(&mut *self.spans.lock().unwrap());
+        spans.sort_by_key(|s| s.start);
+        spans
+    }
+
+    fn record(&self, phase: Phase, label: String, started: Instant) {
+        let record = SpanRecord {
+            phase,
+            label,
+            start: started.saturating_duration_since(self.origin),
+            duration: started.elapsed(),
+        };
+        self.spans.lock().unwrap().push(record);
+    }
+}
+
+/// Records its span on drop. Hold it for the duration of the work:
+/// `let _span = timing::span(Phase::Matching, || pack.name.clone());`
+#[must_use = "the span ends when the guard is dropped"]
+pub struct SpanGuard<'a> {
+    recorder: &'a Recorder,
+    active: Option<(Phase, String, Instant)>,
+}
+
+impl Drop for SpanGuard<'_> {
+    fn drop(&mut self) {
+        if let Some((phase, label, started)) = self.active.take() {
+            self.recorder.record(phase, label, started);
+        }
+    }
+}
+
+fn global() -> &'static Recorder {
+    static RECORDER: OnceLock<Recorder> = OnceLock::new();
+    RECORDER.get_or_init(Recorder::new)
+}
+
+/// Turn on process-wide recording (`--profile`).
+pub fn enable() {
+    global().enable();
+}
+
+/// Start a span on the process-wide recorder. See [`Recorder::span`].
+pub fn span(phase: Phase, label: impl FnOnce() -> String) -> SpanGuard<'static> {
+    global().span(phase, label)
+}
+
+/// Drain the process-wide recorder.
+pub fn take() -> Vec<SpanRecord> {
+    global().take()
+}
+
+/// One row of the `--profile` table.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct PhaseSummary {
+    pub phase: Phase,
+    pub count: usize,
+    pub total: Duration,
+    /// The slowest single span and its label.
+    pub max: Duration,
+    pub slowest: String,
+}
+
+/// Aggregate spans per phase, in pipeline order.
+pub fn summarize(spans: &[SpanRecord]) -> Vec<PhaseSummary> {
+    let mut rows: Vec<PhaseSummary> = Vec::new();
+    for span in spans {
+        match rows.iter_mut().find(|r| r.phase == span.phase) {
+            Some(row) => {
+                row.count += 1;
+                row.total += span.duration;
+                if span.duration > row.max {
+                    row.max = span.duration;
+                    row.slowest = span.label.clone();
+                }
+            }
+            None => rows.push(PhaseSummary {
+                phase: span.phase,
+                count: 1,
+                total: span.duration,
+                max: span.duration,
+                slowest: span.label.clone(),
+            }),
+        }
+    }
+    rows.sort_by_key(|r| r.phase);
+    rows
+}
+
+/// Render the summary as an aligned plain-text table, with the wall
+/// time of the whole command as the last line.
+pub fn format_summary(rows: &[PhaseSummary], wall: Duration) -> String {
+    let mut out = format!(
+        "{:<11} {:>5} {:>10} {:>10}  {}\n",
+        "phase", "count", "total", "max", "slowest"
+    );
+    for row in rows {
+        out.push_str(&format!(
+            "{:<11} {:>5} {:>10} {:>10}  {}\n",
+            row.phase.as_str(),
+            row.count,
+            format_ms(row.total),
+            format_ms(row.max),
+            row.slowest
+        ));
+    }
+    out.push_str(&format!(
+        "{:<11} {:>5} {:>10}\n",
+        "wall",
+        "",
+        format_ms(wall)
+    ));
+    out
+}
+
+fn format_ms(d: Duration) -> String {
+    format!("{:.1}ms", d.as_secs_f64() * 1000.0)
+}
+
+/// Write `spans` to `path` as a Chrome trace-event JSON document
+/// (complete `"X"` events, microsecond timestamps).
+pub fn write_trace(fs: &dyn Fs, path: &Path, spans: &[SpanRecord]) -> Result<()> {
+    let events: Vec<serde_json::Value> = spans
+        .iter()
+        .map(|s| {
+            serde_json::json!({
+                "name": s.label,
+                "cat": s.phase.as_str(),
+                "ph": "X",
+                "ts": s.start.as_micros() as u64,
+                "dur": s.duration.as_micros() as u64,
+                "pid": 1,
+                "tid": 1,
+            })
+        })
+        .collect();
+    let doc = serde_json::json!({ "traceEvents": events, "displayTimeUnit": "ms" });
+    if let Some(parent) = path.parent() {
+        fs.mkdir_all(parent)?;
+    }
+    let text = serde_json::to_string_pretty(&doc)
+        .map_err(|e| crate::DodotError::Other(format!("trace serialization failed: {e}")))?;
+    fs.write_file(path, text.as_bytes())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::testing::TempEnvironment;
+
+    fn record(phase: Phase, label: &str, start_ms: u64, dur_ms: u64) -> SpanRecord {
+        SpanRecord {
+            phase,
+            label: label.into(),
+            start: Duration::from_millis(start_ms),
+            duration: Duration::from_millis(dur_ms),
+        }
+    }
+
+    #[test]
+    fn disabled_recorder_records_nothing_and_skips_labels() {
+        let recorder = Recorder::new();
+        {
+            let _span = recorder.span(Phase::Matching, || panic!("label evaluated"));
+        }
+        assert!(recorder.take().is_empty());
+    }
+
+    #[test]
+    fn enabled_recorder_records_on_drop() {
+        let recorder = Recorder::new();
+        recorder.enable();
+        {
+            let _outer = recorder.span(Phase::Execution, || "vim".into());
+            let _inner = recorder.span(Phase::Subprocess, || "brew bundle".into());
+        }
+        let spans = recorder.take();
+        assert_eq!(spans.len(), 2);
+        assert_eq!(spans[0].phase, Phase::Execution);
+        assert_eq!(spans[1].label, "brew bundle");
+        assert!(recorder.take().is_empty(), "take drains");
+    }
+
+    #[test]
+    fn summary_aggregates_per_phase_in_pipeline_order() {
+        let spans = [
+            record(Phase::Subprocess, "brew bundle", 10, 300),
+            record(Phase::Matching, "vim", 0, 4),
+            record(Phase::Subprocess, "sh install.sh", 320, 50),
+            record(Phase::Matching, "git", 5, 6),
+        ];
+        let rows = summarize(&spans);
+        assert_eq!(rows.len(), 2);
+        assert_eq!(rows[0].phase, Phase::Matching);
+        assert_eq!(rows[0].count, 2);
+        assert_eq!(rows[0].total, Duration::from_millis(10));
+        assert_eq!(rows[1].slowest, "brew bundle");
+
+        let table = format_summary(&rows, Duration::from_millis(400));
+        assert!(table.contains("subprocess"), "{table}");
+        assert!(table.contains("300.0ms"), "{table}");
+        assert!(table.lines().last().unwrap().contains("400.0ms"), "{table}");
+    }
+
+    #[test]
+    fn trace_is_chrome_trace_events() {
+        let env = TempEnvironment::builder().build();
+        let path = env.paths.data_dir().join("probes/trace/run.json");
+        write_trace(
+            env.fs.as_ref(),
+            &path,
+            &[record(Phase::Intents, "vim/symlink", 2, 3)],
+        )
+        .unwrap();
+
+        let doc: serde_json::Value =
+            serde_json::from_str(&env.fs.read_to_string(&path).unwrap()).unwrap();
+        let event = &doc["traceEvents"][0];
+        assert_eq!(event["ph"], "X");
+        assert_eq!(event["cat"], "intents");
+        assert_eq!(event["ts"], 2000);
+        assert_eq!(event["dur"], 3000);
+    }
+}
@@ -0,0 +1,240 @@
+//! Pipeline artifacts for `dodot --trace-dir <dir>`.
+//!
+//! Where [`crate::timing`] records how long each stage took, this
+//! records what each stage produced: the packs discovery found, the
+//! rule matches per pack, the intents the handlers generated, and the
+//! operation results the executor returned. Recording is off until
+//! [`enable`] is called; a disabled [`record`] is one atomic load and
+//! never serializes anything.
+//!
+//! After the command, the CLI writes everything with
+//! [`write_artifacts`]: one run directory per invocation holding a
+//! JSON file per stage plus `run.json` (version, arguments, files).
+//! That directory is meant to be attached to a bug report, or copied
+//! into a fixture for a regression test. It contains absolute paths
+//! and intent payloads, so look it over before sharing.
+
+use std::path::{Path, PathBuf};
+use std::sync::atomic::{AtomicBool, Ordering};
+use std::sync::{Mutex, OnceLock};
+
+use serde::Serialize;
+
+use crate::fs::Fs;
+use crate::{DodotError, Result};
+
+/// Pipeline stage an artifact belongs to, in pipeline order. Each
+/// stage becomes one file.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, PartialOrd, Ord, Hash, Serialize)]
+#[serde(rename_all = "snake_case")]
+pub enum Stage {
+    Packs,
+    Matches,
+    Intents,
+    Operations,
+}
+
+impl Stage {
+    pub const ALL: [Stage; 4] = [
+        Stage::Packs,
+        Stage::Matches,
+        Stage::Intents,
+        Stage::Operations,
+    ];
+
+    pub fn as_str(self) -> &'static str {
+        match self {
+            Stage::Packs => "packs",
+            Stage::Matches => "matches",
+            Stage::Intents => "intents",
+            Stage::Operations => "operations",
+        }
+    }
+
+    /// `01-packs.json`, `02-matches.json`, …
+    pub fn file_name(self) -> String {
+        let index = Self::ALL.iter().position(|s| *s == self).unwrap_or(0) + 1;
+        format!("{index:02}-{}.json", self.as_str())
+    }
+}
+
+/// One recorded artifact: what `stage` produced, for `pack` when the
+/// stage runs per pack.
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct Artifact {
+    #[serde(skip)]
+    pub stage: Stage,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub pack: Option<String>,
+    pub data: serde_json::Value,
+}
+
+/// Collects artifacts. The process-wide instance behind [`record`] is
+/// what the CLI uses; tests build their own.
+#[derive(Default)]
+pub struct Recorder {
+    enabled: AtomicBool,
+    artifacts: Mutex<Vec<Artifact>>,
+}
+
+impl Recorder {
+    /// A disabled recorder.
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    pub fn enable(&self) {
+        self.enabled.store(true, Ordering::Relaxed);
+    }
+
+    pub fn is_enabled(&self) -> bool {
+        self.enabled.load(Ordering::Relaxed)
+    }
+
+    /// Record `data` for `stage`. Values that fail to serialize are
+    /// recorded as their error message rather than dropped, so a gap
+    /// in the trace is visible.
+    pub fn record(&self, stage: Stage, pack: Option<&str>, data: &impl Serialize) {
+        if !self.is_enabled() {
+            return;
+        }
+        let data = serde_json::to_value(data)
+            .unwrap_or_else(|e| serde_json::json!({ "serialization_error": e.to_string() }));
+        self.artifacts.lock().unwrap().push(Artifact {
+            stage,
+            pack: pack.map(str::to_string),
+            data,
+        });
+    }
+
+    /// Remove and return everything recorded so far, in record order.
+    pub fn take(&self) -> Vec<Artifact> {
+        std::mem::take(&mut *self.artifacts.lock().unwrap())
+    }
+}
+
+fn global() -> &'static Recorder {
+    static RECORDER: OnceLock<Recorder> = OnceLock::new();
+    RECORDER.get_or_init(Recorder::new)
+}
+
+/// Turn on process-wide recording (`--trace-dir`).
+pub fn enable() {
+    global().enable();
+}
+
+/// Whether the process-wide recorder is on, for callers whose
+/// artifact is costly to assemble.
+pub fn is_enabled() -> bool {
+    global().is_enabled()
+}
+
+/// Record on the process-wide recorder. See [`Recorder::record`].
+pub fn record(stage: Stage, pack: Option<&str>, data: &impl Serialize) {
+    global().record(stage, pack, data);
+}
+
+/// Drain the process-wide recorder.
+pub fn take() -> Vec<Artifact> {
+    global().take()
+}
+
+/// `run.json`: enough to tell which invocation produced the files.
+#[derive(Debug, Serialize)]
+struct RunManifest<'a> {
+    dodot: &'static str,
+    args: &'a [String],
+    files: Vec<String>,
+}
+
+/// Write `artifacts` into a fresh run directory under `dir` and return
+/// it. Each stage that recorded anything becomes one file holding a
+/// JSON array of its artifacts in record order; `args` is the command
+/// line, kept in `run.json`.
+pub fn write_artifacts(
+    fs: &dyn Fs,
+    dir: &Path,
+    args: &[String],
+    artifacts: &[Artifact],
+) -> Result<PathBuf> {
+    let run_dir = fresh_run_dir(fs, dir)?;
+    let mut files = Vec::new();
+    for stage in Stage::ALL {
+        let entries: Vec<&Artifact> = artifacts.iter().filter(|a| a.stage == stage).collect();
+        if entries.is_empty() {
+            continue;
+        }
+        let name = stage.file_name();
+        write_json(fs, &run_dir.join(&name), &entries)?;
+        files.push(name);
+    }
+    let manifest = RunManifest {
+        dodot: env!("CARGO_PKG_VERSION"),
+        args,
+        files,
+    };
+    write_json(fs, &run_dir.join("run.json"), &manifest)?;
+    Ok(run_dir)
+}
+
+/// `<dir>/<unix seconds>`, suffixed `-2`, `-3`, … when a run in the
+/// same second already took the name.
+fn fresh_run_dir(fs: &dyn Fs, dir: &Path) -> Result<PathBuf> {
+    let stamp = crate::datastore::sentinel::unix_now();
+    let mut run_dir = dir.join(stamp.to_string());
+    let mut n = 1;
+    while fs.exists(&run_dir) {
+        n += 1;
+        run_dir = dir.join(format!("{stamp}-{n}"));
+    }
+    fs.mkdir_all(&run_dir)?;
+    Ok(run_dir)
+}
+
+fn write_json(fs: &dyn Fs, path: &Path, value: &impl Serialize) -> Result<()> {
+    let text = serde_json::to_string_pretty(value)
+        .map_err(|e| DodotError::Other(format!("trace serialization failed: {e}")))?;
+    fs.write_file(path, text.as_bytes())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::testing::TempEnvironment;
+
+    #[test]
+    fn disabled_recorder_records_nothing() {
+        let recorder = Recorder::new();
+        recorder.record(Stage::Packs, None, &["vim"]);
+        assert!(recorder.take().is_empty());
+    }
+
+    #[test]
+    fn artifacts_are_written_one_file_per_stage() {
+        let env = TempEnvironment::builder().build();
+        let recorder = Recorder::new();
+        recorder.enable();
+        recorder.record(Stage::Intents, Some("vim"), &["link vimrc"]);
+        recorder.record(Stage::Packs, None, &["vim", "git"]);
+        recorder.record(Stage::Intents, Some("git"), &["link gitconfig"]);
+
+        let dir = env.home.join("traces");
+        let args = vec!["dodot".to_string(), "up".to_string()];
+        let first = write_artifacts(env.fs.as_ref(), &dir, &args, &recorder.take()).unwrap();
+        let second = write_artifacts(env.fs.as_ref(), &dir, &args, &[]).unwrap();
+        assert_ne!(first, second, "each run gets its own directory");
+
+        let read = |name: &str| -> serde_json::Value {
+            serde_json::from_str(&env.fs.read_to_string(&first.join(name)).unwrap()).unwrap()
+        };
+        let intents = read("03-intents.json");
+        assert_eq!(intents[0]["pack"], "vim");
+        assert_eq!(intents[1]["data"][0], "link gitconfig");
+        assert_eq!(read("01-packs.json")[0]["data"][1], "git");
+        assert!(!env.fs.exists(&first.join("02-matches.json")));
+        assert_eq!(
+            read("run.json")["files"],
+            serde_json::json!(["01-packs.json", "03-intents.json"])
+        );
+    }
+}
@@ -0,0 +1,397 @@
+//! Trash for user files that `--force` replaces.
+//!
+//! `dodot up --force` deploys over whatever occupies a target path.
+//! Instead of deleting that occupant, the executor moves it here, one
+//! directory per item:
+//!
+//! ```text
+//! <data_dir>/trash/<id>/meta.json    original path, pack, timestamp, sha256
+//! <data_dir>/trash/objects/<sha256>  a trashed file's bytes
+//! <data_dir>/trash/<id>/item         a trashed directory or symlink
+//! ```
+//!
+//! `<id>` is `<unix-seconds>-<file name>`, so a lexical sort of the
+//! trash is chronological. `dodot trash list` shows the entries and
+//! `dodot trash restore <id>` moves one back where it came from.
+//!
+//! File contents are stored by sha256, so re-forcing the same deploy
+//! over the same file adds a `meta.json`, not another copy. Entries
+//! from before that (an `item` file, no hash) still restore. [`prune`]
+//! drops old and duplicate entries and the objects nothing refers to.
+//!
+//! Only content dodot didn't put there is trashed. Dodot's own
+//! symlinks, copies it recorded, and files byte-identical to the
+//! source are replaced without a trace, as before.
+
+use std::collections::HashSet;
+use std::io::Read;
+use std::path::{Path, PathBuf};
+use std::time::{SystemTime, UNIX_EPOCH};
+
+use serde::{Deserialize, Serialize};
+use sha2::{Digest, Sha256};
+
+use crate::error::fs_err;
+use crate::fs::Fs;
+use crate::paths::Pather;
+use crate::{DodotError, Result};
+
+const META_FILE: &str = "meta.json";
+const ITEM_NAME: &str = "item";
+/// Directory under the trash holding file contents by hash. Not a
+/// valid entry id: those start with a timestamp.
+const OBJECTS_DIR: &str = "objects";
+
+/// One trashed item.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct TrashEntry {
+    /// Directory name under the trash; what `trash restore` takes.
+    pub id: String,
+    /// Where the item lived before it was replaced.
+    pub original_path: PathBuf,
+    /// Pack whose deploy displaced it.
+    pub pack: String,
+    /// Unix seconds.
+    pub trashed_at: u64,
+    pub is_dir: bool,
+    /// Hex sha256 of a trashed file, naming its object. `None` for
+    /// directories, symlinks and entries trashed before objects.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub sha256: Option<String>,
+    /// Permission bits to restore a file with.
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub mode: Option<u32>,
+}
+
+/// Move `path` into the trash on behalf of `pack`.
+pub fn move_to_trash(
+    fs: &dyn Fs,
+    paths: &dyn Pather,
+    pack: &str,
+    path: &Path,
+) -> Result<TrashEntry> {
+    let trashed_at = SystemTime::now()
+        .duration_since(UNIX_EPOCH)
+        .map(|d| d.as_secs())
+        .unwrap_or(0);
+    let name = path
+        .file_name()
+        .map(|n| n.to_string_lossy().trim_start_matches('.').to_string())
+        .filter(|n| !n.is_empty())
+        .unwrap_or_else(|| "item".into());
+
+    let trash_dir = paths.trash_dir();
+    let mut id = format!("{trashed_at}-{name}");
+    let mut n = 1;
+    while fs.exists(&trash_dir.join(&id)) {
+        n += 1;
+        id = format!("{trashed_at}-{name}-{n}");
+    }
+    let entry_dir = trash_dir.join(&id);
+    fs.mkdir_all(&entry_dir)?;
+
+    let is_symlink = fs.is_symlink(path);
+    let mut entry = TrashEntry {
+        id,
+        original_path: path.to_path_buf(),
+        pack: pack.to_string(),
+        trashed_at,
+        is_dir: fs.is_dir(path) && !is_symlink,
+        sha256: None,
+        mode: None,
+    };
+    if entry.is_dir || is_symlink {
+        move_item(fs, path, &entry_dir.join(ITEM_NAME), entry.is_dir)?;
+    } else {
+        let hash = store_object(fs, &trash_dir, path)?;
+        entry.mode = fs.stat(path).ok().map(|m| m.mode & 0o7777);
+        entry.sha256 = Some(hash);
+        fs.remove_file(path)?;
+    }
+    let meta = serde_json::to_string_pretty(&entry)
+        .map_err(|e| DodotError::Other(format!("trash metadata serialization failed: {e}")))?;
+    fs.write_file(&entry_dir.join(META_FILE), meta.as_bytes())?;
+    Ok(entry)
+}
+
+/// Everything in the trash, newest first. Entries with missing or
+/// unreadable metadata are skipped.
+pub fn list(fs: &dyn Fs, paths: &dyn Pather) -> Result<Vec<TrashEntry>> {
+    let trash_dir = paths.trash_dir();
+    if !fs.is_dir(&trash_dir) {
+        return Ok(Vec::new());
+    }
+    let mut entries: Vec<TrashEntry> = fs
+        .read_dir(&trash_dir)?
+        .into_iter()
+        .filter_map(|e| read_meta(fs, &e.path))
+        .collect();
+    entries.sort_by(|a, b| (b.trashed_at, &b.id).cmp(&(a.trashed_at, &a.id)));
+    Ok(entries)
+}
+
+/// Move entry `id` back to its original path and drop it from the
+/// trash. A dodot symlink at the original path is removed first;
+/// anything else there is left alone and the restore fails.
+pub fn restore(fs: &dyn Fs, paths: &dyn Pather, id: &str) -> Result<TrashEntry> {
+    let entry_dir = paths.trash_dir().join(id);
+    let Some(entry) = read_meta(fs, &entry_dir) else {
+        return Err(DodotError::Other(format!(
+            "no trash entry `{id}`; `dodot trash list` shows what can be restored"
+        )));
+    };
+
+    let target = &entry.original_path;
+    if fs.is_symlink(target) {
+        fs.remove_file(target)?;
+    } else if fs.exists(target) {
+        return Err(DodotError::Other(format!(
+            "{} exists and is not a symlink; move it away before restoring `{id}`",
+            target.display()
+        )));
+    }
+    if let Some(parent) = target.parent() {
+        fs.mkdir_all(parent)?;
+    }
+    match &entry.sha256 {
+        // The object stays: other entries may share it, and `prune`
+        // collects it once none do.
+        Some(hash) => {
+            fs.copy_file(&objects_dir(&paths.trash_dir()).join(hash), target)?;
+            if let Some(mode) = entry.mode {
+                fs.set_permissions(target, mode)?;
+            }
+        }
+        None => move_item(fs, &entry_dir.join(ITEM_NAME), target, entry.is_dir)?,
+    }
+    fs.remove_dir_all(&entry_dir)?;
+    Ok(entry)
+}
+
+/// What [`prune`] removed (or, on a dry run, would remove).
+#[derive(Debug, Clone, Default, PartialEq, Eq, Serialize)]
+pub struct PruneReport {
+    /// Entries dropped, newest first.
+    pub entries: Vec<TrashEntry>,
+    /// Objects no remaining entry refers to.
+    pub objects: usize,
+    /// Bytes those objects and the dropped directories took.
+    pub bytes: u64,
+}
+
+/// Tidy the trash:
+///
+/// - entries trashed before `cutoff` (unix seconds) are dropped;
+/// - of entries with the same original path and content, only the
+///   newest is kept — restoring any of them gives the same file;
+/// - objects no remaining entry refers to are deleted.
+///
+/// With `dry_run` nothing is deleted; the report says what would be.
+pub fn prune(
+    fs: &dyn Fs,
+    paths: &dyn Pather,
+    cutoff: Option<u64>,
+    dry_run: bool,
+) -> Result<PruneReport> {
+    let trash_dir = paths.trash_dir();
+    let mut report = PruneReport::default();
+    let mut seen: HashSet<(PathBuf, String)> = HashSet::new();
+    let mut referenced: HashSet<String> = HashSet::new();
+
+    for entry in list(fs, paths)? {
+        let expired = cutoff.is_some_and(|c| entry.trashed_at < c);
+        let duplicate = entry
+            .sha256
+            .as_ref()
+            .is_some_and(|h| !seen.insert((entry.original_path.clone(), h.clone())));
+        if !expired && !duplicate {
+            referenced.extend(entry.sha256.clone());
+            continue;
+        }
+        let entry_dir = trash_dir.join(&entry.id);
+        report.bytes += tree_size(fs, &entry_dir);
+        if !dry_run {
+            fs.remove_dir_all(&entry_dir)?;
+        }
+        report.entries.push(entry);
+    }
+
+    let objects = objects_dir(&trash_dir);
+    if fs.is_dir(&objects) {
+        for object in fs.read_dir(&objects)? {
+            if referenced.contains(&object.name) {
+                continue;
+            }
+            report.objects += 1;
+            report.bytes += tree_size(fs, &object.path);
+            if !dry_run {
+                fs.remove_file(&object.path)?;
+            }
+        }
+    }
+    Ok(report)
+}
+
+/// Total bytes on disk under the trash, objects included.
+pub fn disk_usage(fs: &dyn Fs, paths: &dyn Pather) -> u64 {
+    tree_size(fs, &paths.trash_dir())
+}
+
+fn objects_dir(trash_dir: &Path) -> PathBuf {
+    trash_dir.join(OBJECTS_DIR)
+}
+
+/// Copy the file at `path` into the object store unless identical
+/// content is already there. Returns its hex sha256.
+fn store_object(fs: &dyn Fs, trash_dir: &Path, path: &Path) -> Result<String> {
+    let mut reader = fs.open_read(path)?;
+    let mut hasher = Sha256::new();
+    let mut buf = [0u8; 64 * 1024];
+    loop {
+        let n = reader.read(&mut buf).map_err(|e| fs_err(path, e))?;
+        if n == 0 {
+            break;
+        }
+        hasher.update(&buf[..n]);
+    }
+    let hash: String = hasher
+        .finalize()
+        .iter()
+        .map(|b| format!("{b:02x}"))
+        .collect();
+
+    let objects = objects_dir(trash_dir);
+    let object = objects.join(&hash);
+    if !fs.exists(&object) {
+        fs.mkdir_all(&objects)?;
+        // Copy beside the object, then rename, so an interrupted copy
+        // never leaves a truncated object under a valid hash.
+        let partial = objects.join(format!("{hash}.partial"));
+        fs.copy_file(path, &partial)?;
+        fs.rename(&partial, &object)?;
+    }
+    Ok(hash)
+}
+
+fn tree_size(fs: &dyn Fs, path: &Path) -> u64 {
+    match fs.lstat(path) {
+        Ok(meta) if meta.is_dir => fs
+            .read_dir(path)
+            .map(|entries| entries.iter().map(|e| tree_size(fs, &e.path)).sum())
+            .unwrap_or(0),
+        Ok(meta) => meta.len,
+        Err(_) => 0,
+    }
+}
+
+fn read_meta(fs: &dyn Fs, entry_dir: &Path) -> Option<TrashEntry> {
+    let text = fs.read_to_string(&entry_dir.join(META_FILE)).ok()?;
+    serde_json::from_str(&text).ok()
+}
+
+/// Rename, falling back to copy-and-delete for files when `from` and
+/// `to` are on different filesystems (e.g. a target under `/etc`).
+fn move_item(fs: &dyn Fs, from: &Path, to: &Path, is_dir: bool) -> Result<()> {
+    match fs.rename(from, to) {
+        Ok(()) => Ok(()),
+        Err(_) if !is_dir && !fs.is_symlink(from) => {
+            fs.copy_file(from, to)?;
+            fs.remove_file(from)
+        }
+        Err(e) => Err(e),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::testing::TempEnvironment;
+
+    #[test]
+    fn trash_and_restore_round_trip() {
+        let env = TempEnvironment::builder()
+            .home_file(".vimrc", "my own vimrc")
+            .build();
+        let original = env.home.join(".vimrc");
+
+        let entry = move_to_trash(env.fs.as_ref(), env.paths.as_ref(), "vim", &original).unwrap();
+        assert!(!env.fs.exists(&original));
+        assert!(entry.id.ends_with("-vimrc"), "{}", entry.id);
+        assert_eq!(
+            list(env.fs.as_ref(), env.paths.as_ref()).unwrap(),
+            vec![entry.clone()]
+        );
+
+        // A dodot symlink now sits where the file was; restore replaces it.
+        env.fs
+            .symlink(&env.dotfiles_root.join("vim/vimrc"), &original)
+            .unwrap();
+        restore(env.fs.as_ref(), env.paths.as_ref(), &entry.id).unwrap();
+        assert_eq!(env.fs.read_to_string(&original).unwrap(), "my own vimrc");
+        assert!(list(env.fs.as_ref(), env.paths.as_ref())
+            .unwrap()
+            .is_empty());
+    }
+
+    #[test]
+    fn restore_refuses_to_clobber_a_real_file() {
+        let env = TempEnvironment::builder()
+            .home_file(".gitconfig", "old")
+            .build();
+        let original = env.home.join(".gitconfig");
+        let entry = move_to_trash(env.fs.as_ref(), env.paths.as_ref(), "git", &original).unwrap();
+        env.fs.write_file(&original, b"new").unwrap();
+
+        let err = restore(env.fs.as_ref(), env.paths.as_ref(), &entry.id)
+            .unwrap_err()
+            .to_string();
+        assert!(err.contains("not a symlink"), "{err}");
+        assert_eq!(list(env.fs.as_ref(), env.paths.as_ref()).unwrap().len(), 1);
+
+        let err = restore(env.fs.as_ref(), env.paths.as_ref(), "nope")
+            .unwrap_err()
+            .to_string();
+        assert!(err.contains("no trash entry `nope`"), "{err}");
+    }
+
+    #[test]
+    fn identical_files_are_stored_once_and_pruned_together() {
+        let env = TempEnvironment::builder().build();
+        let (fs, paths) = (env.fs.as_ref(), env.paths.as_ref());
+        let vimrc = env.home.join(".vimrc");
+        let objects = objects_dir(&paths.trash_dir());
+
+        // Re-forcing over the same file three times: three entries,
+        // one object.
+        let mut ids = Vec::new();
+        for content in ["mine", "mine", "edited"] {
+            fs.write_file(&vimrc, content.as_bytes()).unwrap();
+            ids.push(move_to_trash(fs, paths, "vim", &vimrc).unwrap());
+        }
+        assert_eq!(ids[0].sha256, ids[1].sha256);
+        assert_eq!(fs.read_dir(&objects).unwrap().len(), 2);
+
+        // The older of the two "mine" entries is a duplicate.
+        let report = prune(fs, paths, None, true).unwrap();
+        assert_eq!(report.entries, vec![ids[0].clone()]);
+        assert_eq!(report.objects, 0);
+
+        // Restoring one entry leaves the object for its twin.
+        restore(fs, paths, &ids[0].id).unwrap();
+        assert_eq!(fs.read_to_string(&vimrc).unwrap(), "mine");
+        fs.remove_file(&vimrc).unwrap();
+        restore(fs, paths, &ids[1].id).unwrap();
+        assert_eq!(fs.read_to_string(&vimrc).unwrap(), "mine");
+
+        // The "mine" object now has no entry.
+        let report = prune(fs, paths, None, true).unwrap();
+        assert_eq!((report.entries.len(), report.objects), (0, 1));
+        assert_eq!(fs.read_dir(&objects).unwrap().len(), 2, "dry run");
+
+        // Everything is older than a cutoff in the future.
+        let report = prune(fs, paths, Some(u64::MAX), false).unwrap();
+        assert_eq!((report.entries.len(), report.objects), (1, 2));
+        assert!(list(fs, paths).unwrap().is_empty());
+        assert!(fs.read_dir(&objects).unwrap().is_empty());
+    }
+}
@@ -0,0 +1,198 @@
+//! Post-deploy verification checks from a pack's `[pack] verify`.
+//!
+//! `dodot up` runs each check with `sh -c` from the pack directory
+//! once the pack is linked and provisioned, and records the outcome:
+//!
+//! ```text
+//! <data_dir>/packs/<pack>/verify/last.json
+//! ```
+//!
+//! `dodot status` never runs checks — they can be slow or have side
+//! effects — it reads the record and shows one `verify` row per
+//! configured check. A failed check rolls the pack up as `degraded`.
+//! The record lives in the pack's datastore subtree, so `dodot down`
+//! clears it with the rest of the pack's state.
+
+use std::path::{Path, PathBuf};
+
+use serde::{Deserialize, Serialize};
+
+use crate::datastore::CommandRunner;
+use crate::fs::Fs;
+use crate::paths::Pather;
+use crate::{DodotError, Result};
+
+/// Datastore subdirectory holding the record, alongside the handler
+/// directories.
+pub const VERIFY_DIR: &str = "verify";
+const RECORD_FILE: &str = "last.json";
+
+/// How much of a failed check's output to keep.
+const OUTPUT_BUDGET: usize = 400;
+
+/// Outcome of one check.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct CheckResult {
+    /// The command as written in `[pack] verify`.
+    pub command: String,
+    pub passed: bool,
+    /// `-1` when the shell couldn't be started.
+    pub exit_code: i32,
+    /// Tail of stderr for a failed check; empty when it passed.
+    #[serde(default, skip_serializing_if = "String::is_empty")]
+    pub output: String,
+}
+
+/// The checks of one `dodot up`, in `[pack] verify` order.
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub struct VerifyRecord {
+    /// Unix seconds.
+    pub checked_at: u64,
+    pub checks: Vec<CheckResult>,
+}
+
+impl VerifyRecord {
+    /// The recorded result for `command`, if it ran.
+    pub fn result_for(&self, command: &str) -> Option<&CheckResult> {
+        self.checks.iter().find(|c| c.command == command)
+    }
+}
+
+/// Run `commands` from `pack_dir`. A failing check doesn't stop the
+/// ones after it.
+pub fn run_checks(
+    runner: &dyn CommandRunner,
+    pack_dir: &Path,
+    commands: &[String],
+) -> Vec<CheckResult> {
+    commands
+        .iter()
+        .map(|command| {
+            let arguments = vec![
+                "-c".to_string(),
+                format!("cd \"$1\" || exit 1\n{command}"),
+                "dodot-verify".to_string(),
+                pack_dir.display().to_string(),
+            ];
+            match runner.run("sh", &arguments) {
+                Ok(_) => CheckResult {
+                    command: command.clone(),
+                    passed: true,
+                    exit_code: 0,
+                    output: String::new(),
+                },
+                Err(DodotError::CommandFailed {
+                    exit_code, stderr, ..
+                }) => CheckResult {
+                    command: command.clone(),
+                    passed: false,
+                    exit_code,
+                    output: tail(&stderr),
+                },
+                Err(e) => CheckResult {
+                    command: command.clone(),
+                    passed: false,
+                    exit_code: -1,
+                    output: tail(&e.to_string()),
+                },
+            }
+        })
+        .collect()
+}
+
+fn record_path(paths: &dyn Pather, pack: &str) -> PathBuf {
+    paths.handler_data_dir(pack, VERIFY_DIR).join(RECORD_FILE)
+}
+
+/// Replace `pack`'s record. `pack` is the on-disk pack name.
+pub fn write_record(
+    fs: &dyn Fs,
+    paths: &dyn Pather,
+    pack: &str,
+    record: &VerifyRecord,
+) -> Result<()> {
+    let path = record_path(paths, pack);
+    if let Some(parent) = path.parent() {
+        fs.mkdir_all(parent)?;
+    }
+    let body = serde_json::to_string_pretty(record)
+        .map_err(|e| DodotError::Other(format!("verify record serialization failed: {e}")))?;
+    fs.write_file_atomic(&path, body.as_bytes())
+}
+
+/// `pack`'s last record. Missing or unreadable reads as `None`, the
+/// same as "never checked".
+pub fn load_record(fs: &dyn Fs, paths: &dyn Pather, pack: &str) -> Option<VerifyRecord> {
+    let text = fs.read_to_string(&record_path(paths, pack)).ok()?;
+    serde_json::from_str(&text).ok()
+}
+
+/// Drop `pack`'s record, for a pack whose `[pack] verify` went away.
+pub fn clear_record(fs: &dyn Fs, paths: &dyn Pather, pack: &str) -> Result<()> {
+    let dir = paths.handler_data_dir(pack, VERIFY_DIR);
+    if fs.exists(&dir) {
+        fs.remove_dir_all(&dir)?;
+    }
+    Ok(())
+}
+
+/// The end of `text`, trimmed to [`OUTPUT_BUDGET`] bytes.
+fn tail(text: &str) -> String {
+    let trimmed = text.trim();
+    if trimmed.len() <= OUTPUT_BUDGET {
+        return trimmed.to_string();
+    }
+    let mut start = trimmed.len() - OUTPUT_BUDGET;
+    while !trimmed.is_char_boundary(start) {
+        start += 1;
+    }
+    format!("…{}", &trimmed[start..])
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::datastore::ShellCommandRunner;
+    use crate::testing::TempEnvironment;
+
+    #[test]
+    fn checks_run_from_the_pack_dir_and_keep_going_after_a_failure() {
+        let env = TempEnvironment::builder()
+            .pack("tool")
+            .file("bin/tool", "#!/bin/sh\n")
+            .done()
+            .build();
+        let runner = ShellCommandRunner::new(false);
+        let results = run_checks(
+            &runner,
+            &env.dotfiles_root.join("tool"),
+            &[
+                "test -f bin/tool".into(),
+                "echo missing >&2; exit 4".into(),
+                "true".into(),
+            ],
+        );
+        assert!(results[0].passed);
+        assert!(!results[1].passed);
+        assert_eq!(results[1].exit_code, 4);
+        assert_eq!(results[1].output, "missing");
+        assert!(results[2].passed);
+
+        let record = VerifyRecord {
+            checked_at: 1,
+            checks: results,
+        };
+        write_record(env.fs.as_ref(), env.paths.as_ref(), "tool", &record).unwrap();
+        let loaded = load_record(env.fs.as_ref(), env.paths.as_ref(), "tool").unwrap();
+        assert_eq!(loaded, record);
+        assert!(
+            !loaded
+                .result_for("echo missing >&2; exit 4")
+                .unwrap()
+                .passed
+        );
+
+        clear_record(env.fs.as_ref(), env.paths.as_ref(), "tool").unwrap();
+        assert!(load_record(env.fs.as_ref(), env.paths.as_ref(), "tool").is_none());
+    }
+}
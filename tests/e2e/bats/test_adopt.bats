@@ -35,12 +35,25 @@ teardown() {
     create_pack_file "vim" "home.vimrc" "old content"
     create_home_file ".vimrc" "new content"
 
-    run dodot adopt --into vim --force "$HOME/.vimrc"
+    run dodot adopt --into vim --force --yes "$HOME/.vimrc"
     [ "$status" -eq 0 ]
 
     assert_file_contents "$DOTFILES_ROOT/vim/home.vimrc" "new content"
 }
 
+@test "adopt --force without --yes refuses to run without a terminal" {
+    create_pack_file "vim" "home.vimrc" "old content"
+    create_home_file ".vimrc" "new content"
+
+    run dodot adopt --into vim --force "$HOME/.vimrc" </dev/null
+    [ "$status" -eq 2 ]
+    assert_output_contains "Cancelled"
+    assert_output_contains "pass --yes"
+
+    # The pack file is untouched
+    assert_file_contents "$DOTFILES_ROOT/vim/home.vimrc" "old content"
+}
+
 @test "adopt reports error without --force when file exists in pack" {
     create_pack_file "vim" "home.vimrc" "old content"
     create_home_file ".vimrc" "new content"
@@ -15,6 +15,7 @@ teardown() {
     create_home_file ".vimrc" "existing content"
 
     run dodot up
+    [ "$status" -eq 3 ]
     assert_output_contains "conflict"
 
     # Make sure we didn't overwrite the user's file
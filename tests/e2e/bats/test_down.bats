@@ -16,7 +16,7 @@ teardown() {
     dodot up
     assert_exists "$XDG_DATA_HOME/dodot/packs/vim/symlink/home.vimrc"
 
-    run dodot down
+    run dodot down --yes
     [ "$status" -eq 0 ]
     assert_output_contains "deactivated"
 
@@ -28,7 +28,7 @@ teardown() {
     create_pack_file "vim" "home.vimrc" "x"
 
     dodot up
-    dodot down
+    dodot down --yes
 
     run dodot status
     [ "$status" -eq 0 ]
@@ -54,7 +54,7 @@ teardown() {
     create_pack_file "git" "home.gitconfig" "x"
 
     dodot up
-    dodot down vim
+    dodot down --yes vim
 
     # vim should be pending, git still deployed
     run dodot status vim
@@ -63,12 +63,31 @@ teardown() {
     assert_output_contains "deployed"
 }
 
-@test "down on already-inactive packs is safe" {
+@test "down without --yes refuses to run without a terminal" {
     create_pack_file "vim" "home.vimrc" "x"
 
-    # Never deployed — down should succeed
-    run dodot down
+    dodot up
+
+    run dodot down </dev/null
+    [ "$status" -eq 2 ]
+    assert_output_contains "Cancelled"
+    assert_output_contains "pass --yes"
+
+    # Nothing was removed
+    assert_exists "$XDG_DATA_HOME/dodot/packs/vim/symlink/home.vimrc"
+
+    run dodot down --yes </dev/null
     [ "$status" -eq 0 ]
+    assert_no_handler_state "vim" "symlink"
+}
+
+@test "down on already-inactive packs is safe" {
+    create_pack_file "vim" "home.vimrc" "x"
+
+    # Never deployed — down succeeds with the "nothing to do" code
+    run dodot down --yes
+    [ "$status" -eq 5 ]
+    assert_not_exists "$XDG_DATA_HOME/dodot/packs/vim/symlink"
 }
 
 @test "down removes shell handler state" {
@@ -77,7 +96,7 @@ teardown() {
     dodot up
     assert_exists "$XDG_DATA_HOME/dodot/packs/zsh/shell/aliases.sh"
 
-    dodot down
+    dodot down --yes
     assert_no_handler_state "zsh" "shell"
 }
 
@@ -88,6 +107,6 @@ teardown() {
     dodot up
     assert_exists "$XDG_DATA_HOME/dodot/packs/tools/path/bin"
 
-    dodot down
+    dodot down --yes
     assert_no_handler_state "tools" "path"
 }
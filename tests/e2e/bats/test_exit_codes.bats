@@ -23,16 +23,27 @@ teardown() {
 
 @test "up on a nonexistent pack exits non-zero with an error message" {
     run dodot up nonexistent-pack
-    [ "$status" -ne 0 ]
+    [ "$status" -eq 2 ]
     assert_output_contains "pack not found"
 }
 
 @test "down on a nonexistent pack exits non-zero with an error message" {
     run dodot down nonexistent-pack
-    [ "$status" -ne 0 ]
+    [ "$status" -eq 2 ]
     assert_output_contains "pack not found"
 }
 
+@test "down with nothing deployed exits 5" {
+    create_pack_file "vim" "home.vimrc" "x"
+    run dodot down --yes
+    [ "$status" -eq 5 ]
+}
+
+@test "up with no packs exits 5" {
+    run dodot up
+    [ "$status" -eq 5 ]
+}
+
 @test "adopt --into on a nonexistent pack exits non-zero with an error message" {
     create_home_file ".vimrc" "set nocompatible"
     run dodot adopt --into nonexistent-pack "$HOME/.vimrc"
@@ -109,7 +109,7 @@ teardown() {
     assert_output_contains "deployed"
 
     # Down
-    dodot down
+    dodot down --yes
 
     # Status after down
     run dodot status
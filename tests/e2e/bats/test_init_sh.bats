@@ -39,6 +39,19 @@ teardown() {
     assert_output_contains "bin"
 }
 
+@test "init-sh --fish prints fish PATH lines without shell sources" {
+    create_pack "tools"
+    create_pack_bin "tools" "mytool" '#!/bin/sh\necho hello'
+    create_pack_file "tools" "aliases.sh" "alias ll='ls -la'"
+    dodot up
+
+    run dodot init-sh --fish
+    [ "$status" -eq 0 ]
+    assert_output_contains "set -gx PATH"
+    assert_output_contains "bin"
+    assert_output_not_contains "aliases.sh"
+}
+
 @test "init-sh is empty when no packs deployed" {
     create_pack_file "vim" "home.vimrc" "x"
     # Don't deploy
@@ -56,8 +69,29 @@ teardown() {
     run dodot init-sh
     assert_output_contains "aliases.sh"
 
-    dodot down
+    dodot down --yes
 
     run dodot init-sh
     assert_output_not_contains "aliases.sh"
 }
+
+@test "sourcing init-sh warns once when a sourced file is gone" {
+    create_pack_file "zsh" "aliases.sh" "alias ll='ls -la'"
+    dodot up
+    rm "$DOTFILES_ROOT/zsh/aliases.sh"
+
+    run bash -c "
+        export HOME='$HOME'
+        export XDG_DATA_HOME='$XDG_DATA_HOME'
+        export DOTFILES_ROOT='$DOTFILES_ROOT'
+        export XDG_CONFIG_HOME='$XDG_CONFIG_HOME'
+        export XDG_CACHE_HOME='$XDG_CACHE_HOME'
+        eval \"\$($DODOT_BIN init-sh)\"
+    "
+    assert_output_contains "dodot: missing"
+    assert_output_contains "run 'dodot up'"
+
+    run dodot doctor --shell
+    [ "$status" -eq 2 ]
+    assert_output_contains "sourced file missing"
+}
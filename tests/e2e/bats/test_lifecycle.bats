@@ -35,7 +35,7 @@ teardown() {
     assert_exists "$HOME/.gitconfig"
 
     # 4. Down
-    run dodot down
+    run dodot down --yes
     [ "$status" -eq 0 ]
     assert_output_contains "deactivated"
 
@@ -53,7 +53,7 @@ teardown() {
     run dodot status
     assert_output_contains "deployed"
 
-    dodot down
+    dodot down --yes
     run dodot status
     assert_output_contains "pending"
 
@@ -80,7 +80,7 @@ teardown() {
     assert_output_contains "sourced"
     assert_output_contains "in PATH"
 
-    dodot down
+    dodot down --yes
 
     run dodot status
     assert_output_contains "pending"
@@ -100,7 +100,7 @@ teardown() {
     assert_output_contains "pending"
 
     # Down everything
-    dodot down
+    dodot down --yes
     run dodot status
     assert_output_not_contains "deployed"
 }
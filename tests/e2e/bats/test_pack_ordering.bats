@@ -90,14 +90,14 @@ teardown() {
     dodot up
 
     # down by display name
-    run dodot down brew
+    run dodot down --yes brew
     [ "$status" -eq 0 ]
     assert_output_contains "deactivated"
     assert_no_handler_state "010-brew" "shell"
 
     dodot up
     # down by raw directory name
-    run dodot down 010-brew
+    run dodot down --yes 010-brew
     [ "$status" -eq 0 ]
     assert_output_contains "deactivated"
     assert_no_handler_state "010-brew" "shell"
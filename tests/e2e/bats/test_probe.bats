@@ -62,7 +62,7 @@ teardown() {
     dodot up
     assert_file_contains "$XDG_DATA_HOME/dodot/deployment-map.tsv" "aliases.sh"
 
-    dodot down
+    dodot down --yes
 
     # File still exists (header preserved), but no data rows.
     assert_exists "$XDG_DATA_HOME/dodot/deployment-map.tsv"
@@ -36,7 +36,7 @@ teardown() {
 
 @test "shell files are not sourced after down" {
     dodot up
-    dodot down
+    dodot down --yes
 
     # Fresh eval should not load anything
     eval_init_sh
@@ -55,7 +55,7 @@ teardown() {
 
 @test "bin scripts are not on PATH after down" {
     dodot up
-    dodot down
+    dodot down --yes
     eval_init_sh
 
     assert_bin_not_available "tools" "devtool"
@@ -157,7 +157,7 @@ teardown() {
     assert_exists "$HOME/.ssh/config"
 
     # Tear down
-    dodot down
+    dodot down --yes
 
     # Status should show everything pending/not sourced
     run dodot status
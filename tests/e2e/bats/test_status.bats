@@ -98,7 +98,7 @@ teardown() {
     create_pack_file "vim" "home.vimrc" "x"
 
     dodot up
-    dodot down
+    dodot down --yes
     run dodot status
     [ "$status" -eq 0 ]
     assert_output_contains "pending"